@@ -1,7 +1,16 @@
 package api
 
+import (
+	"strconv"
+	"strings"
+)
+
 // Version API version
-const Version = "v1"
+const Version = "v2"
+
+// MinVersion oldest API version still served. Requests of older versions are
+// translated to and from the current version.
+const MinVersion = "v1"
 
 // OptionKey specifies a set of recognized query params
 type OptionKey string
@@ -9,6 +18,8 @@ type OptionKey string
 const (
 	// OptName query parameter used to lookup volume by name
 	OptName = OptionKey("Name")
+	// OptGroup query parameter used to lookup volumes by group.
+	OptGroup = OptionKey("Group")
 	// OptVolumeID query parameter used to lookup volume by ID.
 	OptVolumeID = OptionKey("VolumeID")
 	// OptSnapID query parameter used to lookup snap by ID.
@@ -17,6 +28,44 @@ const (
 	OptLabel = OptionKey("Label")
 	// OptConfigLabel query parameter used to lookup volume by set of labels.
 	OptConfigLabel = OptionKey("ConfigLabel")
+	// OptConsistency query parameter used to select the read consistency.
+	OptConsistency = OptionKey("Consistency")
+	// OptProtocol query parameter used to select an export protocol.
+	OptProtocol = OptionKey("Protocol")
+	// OptPath query parameter used to select a path within a volume.
+	OptPath = OptionKey("Path")
+	// OptLimit query parameter used to limit the number of results returned.
+	OptLimit = OptionKey("Limit")
+	// OptToken query parameter used to continue a paginated enumeration.
+	OptToken = OptionKey("Token")
+	// OptSort query parameter used to order the results of an enumeration.
+	OptSort = OptionKey("Sort")
+	// OptOp query parameter used to select audit records by operation.
+	OptOp = OptionKey("Op")
+	// OptPrincipal query parameter used to select audit records by principal.
+	OptPrincipal = OptionKey("Principal")
+	// OptSince query parameter used to select records after an RFC 3339 time.
+	OptSince = OptionKey("Since")
+	// OptUntil query parameter used to select records before an RFC 3339 time.
+	OptUntil = OptionKey("Until")
+	// OptFilter query parameter used to select volumes with a filter
+	// expression, such as "state=attached,label.env=prod".
+	OptFilter = OptionKey("Filter")
+	// OptFormat query parameter used to select the format of a volume list,
+	// json, yaml, csv or table.
+	OptFormat = OptionKey("Format")
+	// OptFromSnapID query parameter used to select the snapshot a diff
+	// starts from.
+	OptFromSnapID = OptionKey("FromSnapID")
+	// OptBaseSnapID query parameter used to select the snapshot whose
+	// hashes a fingerprint reuses.
+	OptBaseSnapID = OptionKey("BaseSnapID")
+	// OptForce query parameter used to force the removal of a driver that
+	// is in use.
+	OptForce = OptionKey("Force")
+	// OptLevel query parameter used to select log entries at or above a
+	// level.
+	OptLevel = OptionKey("Level")
 )
 
 // VolumeCreateRequest is the body of create REST request
@@ -29,13 +78,97 @@ type VolumeCreateRequest struct {
 	Spec *VolumeSpec `json:"spec,omitempty"`
 }
 
+// DriverCreateRequest is the body of the REST request to start a driver.
+type DriverCreateRequest struct {
+	// Name of the driver instance.
+	Name string `json:"name"`
+	// Params of the driver, as in the drivers section of the config file.
+	// The instance_of key selects the driver of instances not named after it.
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// DriverInstance is a running instance of a driver.
+type DriverInstance struct {
+	// Name of the instance, which serves its API on a socket of that name.
+	Name string `json:"name"`
+	// Driver the instance runs.
+	Driver string `json:"driver"`
+}
+
+// BandwidthLimits maps classes of background data movement, such as
+// migration or backup, to their bandwidth limit in bytes per second. A limit
+// of 0 removes the limit of a class.
+type BandwidthLimits map[string]uint64
+
+// VolumeResizeRequest is the body of the resize REST request.
+type VolumeResizeRequest struct {
+	// Size new size of the volume in bytes.
+	Size uint64 `json:"size"`
+}
+
+// VolumeTransferRequest is the body of the REST request to transfer the
+// ownership of a volume.
+type VolumeTransferRequest struct {
+	// Owner new owner of the volume.
+	Owner string `json:"owner"`
+}
+
+// VolumeAccessRequest is the body of the REST request to share a volume.
+type VolumeAccessRequest struct {
+	// Principal the volume is shared with.
+	Principal string `json:"principal"`
+	// Access granted to the principal, empty to revoke its access.
+	Access AccessType `json:"access,omitempty"`
+}
+
+// VolumeLocatorRequest is the body of the REST request to update the locator
+// of a volume.
+type VolumeLocatorRequest struct {
+	// Locator replaces the locator of the volume.
+	Locator VolumeLocator `json:"locator"`
+}
+
+// SnapExportRequest is the body of the REST request to export a snapshot.
+type SnapExportRequest struct {
+	// Location the snapshot is exported to.
+	Location SnapArchiveLocation `json:"location"`
+}
+
+// SnapImportRequest is the body of the REST request to import an exported
+// snapshot into a new volume.
+type SnapImportRequest struct {
+	// Location of the exported snapshot.
+	Location SnapArchiveLocation `json:"location"`
+	// Locator of the new volume, the locator of the exported volume if
+	// empty.
+	Locator VolumeLocator `json:"locator"`
+}
+
+// GCRequest is the body of the REST request to collect the orphans of a
+// driver.
+type GCRequest struct {
+	// Policy what to do with the orphans, the policy of the driver if empty.
+	Policy GCPolicy `json:"policy,omitempty"`
+}
+
 // VolumeCreateResponse is the body of create REST response
 type VolumeCreateResponse struct {
 	// ID of the newly created volume
 	ID VolumeID `json:"id"`
+	// FieldErrors problems with the fields of the spec of the request.
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
 	VolumeResponse
 }
 
+// FieldError is a problem with a field of a request, such as a VolumeSpec
+// field out of the range the driver supports.
+type FieldError struct {
+	// Field name, such as "Size" or "Cache.BlockSize".
+	Field string `json:"field"`
+	// Reason the value of the field is refused.
+	Reason string `json:"reason"`
+}
+
 // VolumeActionParam desired action on volume
 type VolumeActionParam int
 
@@ -60,6 +193,14 @@ type VolumeStateAction struct {
 	MountPath string `json:"mount_path"`
 	// DevicePath returned in Attach
 	DevicePath string `json:"device_path"`
+	// AttachOptions used when Attach is ParamOn
+	AttachOptions *AttachOptions `json:"attach_options,omitempty"`
+	// MountOptions used when Mount is ParamOn
+	MountOptions *MountOptions `json:"mount_options,omitempty"`
+	// DetachOptions used when Attach or Mount is ParamOff
+	DetachOptions *DetachOptions `json:"detach_options,omitempty"`
+	// Maintenance start or end the maintenance of the volume
+	Maintenance VolumeActionParam `json:"maintenance"`
 }
 
 // VolumeStateResponse is the body of the REST response
@@ -77,8 +218,48 @@ type VolumeResponse struct {
 
 // SnapCreateRequest request body to create a snap.
 type SnapCreateRequest struct {
-	ID     VolumeID `json:"id"`
-	Labels Labels   `json:"labels"`
+	ID       VolumeID `json:"id"`
+	Labels   Labels   `json:"labels"`
+	Writable bool     `json:"writable"`
+}
+
+// GroupSnapCreateRequest request body to snapshot the volumes of a group.
+type GroupSnapCreateRequest struct {
+	Group  string `json:"group"`
+	Labels Labels `json:"labels"`
+}
+
+// GroupSnapCreateResponse response body to GroupSnapCreateRequest
+type GroupSnapCreateResponse struct {
+	// Snaps IDs of the snaps by volume.
+	Snaps map[VolumeID]SnapID `json:"snaps,omitempty"`
+	VolumeResponse
+}
+
+// VolumeBulkRequest request body of the operations on many volumes.
+type VolumeBulkRequest struct {
+	IDs []VolumeID `json:"ids"`
+	// Labels of the snaps of a bulk snapshot.
+	Labels Labels `json:"labels,omitempty"`
+	// Writable snaps of a bulk snapshot.
+	Writable bool `json:"writable,omitempty"`
+}
+
+// VolumeBulkResponse response body to VolumeBulkRequest. The operation
+// succeeded on the volumes without an error.
+type VolumeBulkResponse struct {
+	// Snaps IDs of the snaps by volume, for bulk snapshots.
+	Snaps map[VolumeID]SnapID `json:"snaps,omitempty"`
+	// Volumes inspected, for bulk inspections.
+	Volumes []Volume `json:"volumes,omitempty"`
+	// Errors messages of the volumes the operation failed on.
+	Errors map[VolumeID]string `json:"errors,omitempty"`
+	VolumeResponse
+}
+
+// SnapProtectRequest request body to pin or unpin a snap.
+type SnapProtectRequest struct {
+	Protected bool `json:"protected"`
 }
 
 // SnapCreateResponse response body to SnapCreateRequest
@@ -88,6 +269,32 @@ type SnapCreateResponse struct {
 	VolumeResponse
 }
 
+// VolumeEnumerateResponse response body to a paginated volume enumeration.
+type VolumeEnumerateResponse struct {
+	Volumes []Volume `json:"volumes"`
+	// NextToken continues the enumeration, empty on the last page.
+	NextToken string `json:"next_token,omitempty"`
+}
+
+// SnapEnumerateResponse response body to a paginated snap enumeration.
+type SnapEnumerateResponse struct {
+	Snaps []VolumeSnap `json:"snaps"`
+	// NextToken continues the enumeration, empty on the last page.
+	NextToken string `json:"next_token,omitempty"`
+}
+
+// VolumeExportRequest request body to export a volume.
+type VolumeExportRequest struct {
+	Protocol ExportProtocol `json:"protocol"`
+}
+
+// VolumeExportResponse response body to VolumeExportRequest
+type VolumeExportResponse struct {
+	// Export describes how to reach the exported volume.
+	Export *VolumeExport `json:"export,omitempty"`
+	VolumeResponse
+}
+
 // ResponseStatusNew create VolumeResponse from error
 func ResponseStatusNew(err error) VolumeResponse {
 	if err == nil {
@@ -95,3 +302,40 @@ func ResponseStatusNew(err error) VolumeResponse {
 	}
 	return VolumeResponse{Error: err.Error()}
 }
+
+// VersionRange is the range of API versions a server or driver supports.
+type VersionRange struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+}
+
+// versionNumber returns the number of an API version such as v2, 0 if the
+// version is malformed.
+func versionNumber(version string) int {
+	if !strings.HasPrefix(version, "v") {
+		return 0
+	}
+	n, err := strconv.Atoi(version[1:])
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// Contains returns true if version is within the range.
+func (r VersionRange) Contains(version string) bool {
+	n := versionNumber(version)
+	return n != 0 && n >= versionNumber(r.Min) && n <= versionNumber(r.Max)
+}
+
+// Intersect returns the versions in both ranges, false if there are none.
+func (r VersionRange) Intersect(o VersionRange) (VersionRange, bool) {
+	i := r
+	if versionNumber(o.Min) > versionNumber(i.Min) {
+		i.Min = o.Min
+	}
+	if versionNumber(o.Max) < versionNumber(i.Max) {
+		i.Max = o.Max
+	}
+	return i, versionNumber(i.Min) != 0 && versionNumber(i.Min) <= versionNumber(i.Max)
+}
@@ -1,6 +1,10 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"time"
 )
 
@@ -65,6 +69,118 @@ const (
 // VolumeStateAny a filter that selects all volumes
 const VolumeStateAny = VolumePending | VolumeAvailable | VolumeAttached | VolumeDetached | VolumeError | VolumeDeleted
 
+var volumeStateNames = map[VolumeState]string{
+	VolumePending:   "Pending",
+	VolumeAvailable: "Available",
+	VolumeAttached:  "Attached",
+	VolumeDetached:  "Detached",
+	VolumeError:     "Error",
+	VolumeDeleted:   "Deleted",
+}
+
+func (s VolumeState) String() string {
+	if name, ok := volumeStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("VolumeState(%d)", int(s))
+}
+
+// UsageOp is an operation recorded in the usage history of a volume.
+type UsageOp string
+
+const (
+	// UsageAttach the volume was attached.
+	UsageAttach = UsageOp("attach")
+	// UsageDetach the volume was detached.
+	UsageDetach = UsageOp("detach")
+	// UsageMount the volume was mounted.
+	UsageMount = UsageOp("mount")
+	// UsageUnmount the volume was unmounted.
+	UsageUnmount = UsageOp("unmount")
+)
+
+// UsageEvent records where and when a volume was attached, detached,
+// mounted or unmounted.
+type UsageEvent struct {
+	// Op the operation.
+	Op UsageOp
+	// Node the operation ran on.
+	Node MachineID
+	// Path device path of an attach, or mount path of a mount or unmount.
+	Path string `json:",omitempty"`
+	// Time the operation completed.
+	Time time.Time
+}
+
+// StateTransition records a change of VolumeState.
+type StateTransition struct {
+	// From state before the transition.
+	From VolumeState
+	// To state after the transition.
+	To VolumeState
+	// Time of the transition.
+	Time time.Time
+	// Reason optional description of what caused the transition.
+	Reason string
+}
+
+// ReplicaState health of a copy of a volume.
+type ReplicaState string
+
+const (
+	// ReplicaInSync replica holds all acknowledged writes.
+	ReplicaInSync ReplicaState = "in_sync"
+	// ReplicaRebuilding replica is being resynchronized.
+	ReplicaRebuilding ReplicaState = "rebuilding"
+	// ReplicaFailed replica is unreachable or missed writes.
+	ReplicaFailed ReplicaState = "failed"
+)
+
+// Replica is the state of the copy of a volume on one node.
+type Replica struct {
+	// Node holding the copy.
+	Node MachineID
+	// State of the copy.
+	State ReplicaState
+	// Time the state last changed.
+	Time time.Time
+}
+
+// Consistency is the consistency level requested for metadata reads.
+type Consistency string
+
+const (
+	// ConsistencyStrong reads are served from the KVDB and reflect all
+	// completed writes. This is the default.
+	ConsistencyStrong = Consistency("strong")
+	// ConsistencyCached reads may be served from a local cache and can be
+	// stale. Use for latency sensitive paths only.
+	ConsistencyCached = Consistency("cached")
+)
+
+// SortKey orders the results of a paginated enumeration.
+type SortKey string
+
+const (
+	// SortByName orders volumes by locator name and snaps by ID. This is
+	// the default.
+	SortByName = SortKey("name")
+	// SortByCtime orders volumes and snaps by creation time.
+	SortByCtime = SortKey("ctime")
+)
+
+// EnumerateOptions selects a page of the results of Enumerate or
+// SnapEnumerate.
+type EnumerateOptions struct {
+	// Limit maximum number of results returned, all results if 0.
+	Limit int
+	// Token continuation token returned with the previous page, empty for
+	// the first page.
+	Token string
+	// SortBy orders the results, by name if empty.
+	SortBy SortKey
+}
+
 // Labels a name-value map
 type Labels map[string]string
 
@@ -75,6 +191,9 @@ type VolumeLocator struct {
 	Name string
 	// VolumeLabels set of name-value pairs that acts as search filters.
 	VolumeLabels Labels
+	// Group the volume belongs to. The volumes of a group, such as the data
+	// and log volumes of a database, are snapshotted together.
+	Group string `json:",omitempty"`
 }
 
 // CreateOptions are passed in with a CreateRequest
@@ -83,17 +202,128 @@ type CreateOptions struct {
 	FailIfExists bool
 	// CreateFromSnap will create a volume with specified SnapID
 	CreateFromSnap SnapID
+	// Profile names the VolumeProfile to create the volume from. The fields
+	// set in the spec of the request override those of the profile.
+	Profile string `json:",omitempty"`
+}
+
+// ReservationPolicy is the SCSI reservation taken when a block volume is
+// attached.
+type ReservationPolicy string
+
+const (
+	// ReservationNone no reservation is taken.
+	ReservationNone = ReservationPolicy("")
+	// ReservationExclusive only the attaching node may access the device.
+	ReservationExclusive = ReservationPolicy("exclusive")
+	// ReservationShared all attached nodes are registered and may access
+	// the device, other nodes are fenced.
+	ReservationShared = ReservationPolicy("shared")
+)
+
+// AttachOptions are passed in with an Attach request.
+type AttachOptions struct {
+	// ReadOnly attach the device read-only. Any number of nodes may attach a
+	// volume read-only as long as it is not attached read-write elsewhere.
+	ReadOnly bool
+	// Shared allow multiple nodes to attach the volume read-write. The
+	// application is responsible for coordinating writes.
+	Shared bool
+	// Reservation SCSI reservation policy for this attachment.
+	Reservation ReservationPolicy
+}
+
+// DetachOptions are passed in with a Detach or Unmount request to release a
+// volume that is still in use, for instance during failover from a wedged
+// node.
+type DetachOptions struct {
+	// Force lazily unmount the filesystems of the volume and remove its
+	// device even if it is still open.
+	Force bool
+	// Kill terminate the processes using the volume first.
+	Kill bool
+}
+
+// MountPropagation is the propagation of the mounts made under a mount to
+// its peers, as in mount(8).
+type MountPropagation string
+
+const (
+	// PropagationNone the propagation of the mount is left as the driver
+	// makes it.
+	PropagationNone = MountPropagation("")
+	// PropagationPrivate mounts are not propagated to or from the mount.
+	PropagationPrivate = MountPropagation("rprivate")
+	// PropagationShared mounts are propagated both to and from the mount,
+	// such as for containers that mount volumes for the host.
+	PropagationShared = MountPropagation("rshared")
+	// PropagationSlave mounts are propagated from the host to the mount but
+	// not back.
+	PropagationSlave = MountPropagation("rslave")
+)
+
+// MountOptions are passed in with a Mount request.
+type MountOptions struct {
+	// ReadOnly mount the volume read-only.
+	ReadOnly bool
+	// Remount change the options of a mount that exists at the mount path
+	// instead of mounting the volume again. Only ReadOnly and Propagation
+	// are changed.
+	Remount bool
+	// SELinuxLabel relabel the files of the volume with this SELinux
+	// context, such as system_u:object_r:container_file_t:s0:c1,c2.
+	SELinuxLabel string
+	// Propagation of the mount.
+	Propagation MountPropagation
+	// SubPath mount only this directory of the volume, relative to its
+	// root. It is created if missing. Containers sharing a volume each
+	// mount a subtree of it. Symbolic links on the path are not followed.
+	SubPath string
+}
+
+// AccessType is the access a principal has to a volume.
+type AccessType string
+
+const (
+	// AccessRead the volume may be inspected, listed and attached read-only.
+	AccessRead = AccessType("read")
+	// AccessWrite the volume may also be attached, mounted, snapshotted and
+	// resized.
+	AccessWrite = AccessType("write")
+	// AccessOwner the volume may also be deleted, transferred and shared.
+	// Only the owner has this access, it cannot be granted.
+	AccessOwner = AccessType("owner")
+)
+
+// Ownership records the tenant a volume belongs to and the principals it is
+// shared with.
+type Ownership struct {
+	// Owner of the volume, anyone may use volumes without an owner.
+	Owner string `json:",omitempty"`
+	// Acl access granted to other principals.
+	Acl map[string]AccessType `json:",omitempty"`
+}
+
+// Attachment records a node a volume is attached on.
+type Attachment struct {
+	// Node the volume is attached on.
+	Node MachineID
+	// Options used for this attachment.
+	Options AttachOptions
+	// Time of attach.
+	Time time.Time
 }
 
 // Filesystem supported filesystems
 type Filesystem string
 
 const (
-	FsNone Filesystem = "none"
-	FsExt4 Filesystem = "ext4"
-	FsXfs  Filesystem = "xfs"
-	FsZfs  Filesystem = "zfs"
-	FsNfs  Filesystem = "nfs"
+	FsNone  Filesystem = "none"
+	FsExt4  Filesystem = "ext4"
+	FsXfs   Filesystem = "xfs"
+	FsBtrfs Filesystem = "btrfs"
+	FsZfs   Filesystem = "zfs"
+	FsNfs   Filesystem = "nfs"
 )
 
 // VolumeSpec has the properties needed to create a volume.
@@ -115,10 +345,142 @@ type VolumeSpec struct {
 	Cos VolumeCos
 	// Perform dedupe on this disk
 	Dedupe bool
+	// Compressed compresses the data of the volume with Compression.
+	Compressed bool `json:",omitempty"`
+	// Compression algorithm of a compressed volume, the default of the
+	// driver if empty.
+	Compression Compression `json:",omitempty"`
 	// SnapshotInterval in minutes, set to 0 to disable Snapshots
 	SnapshotInterval int
+	// Retention of the scheduled snapshots, all are kept if nil.
+	Retention *RetentionPolicy `json:",omitempty"`
 	// Volume configuration labels
 	ConfigLabels Labels
+	// Cache fronts a block volume with a local cache device while attached.
+	Cache *CacheSpec
+	// RootDir owner and permissions of the root directory of the volume,
+	// left as the driver makes them if nil.
+	RootDir *RootDirSpec `json:",omitempty"`
+}
+
+// RootDirSpec is the owner and permissions of the root directory of a
+// volume, set when the volume is created and mounted so that containers
+// that do not run as root can write to it.
+type RootDirSpec struct {
+	// UID owner of the directory, left unchanged if nil.
+	UID *int `json:",omitempty"`
+	// GID group of the directory, left unchanged if nil.
+	GID *int `json:",omitempty"`
+	// Mode permissions of the directory, such as 0775, left unchanged if 0.
+	Mode uint32 `json:",omitempty"`
+}
+
+// Compression is an algorithm volumes are compressed with.
+type Compression string
+
+const (
+	// CompressionLz4 is used by block drivers that compress with VDO.
+	CompressionLz4 = Compression("lz4")
+	// CompressionLzo favours speed.
+	CompressionLzo = Compression("lzo")
+	// CompressionZlib favours ratio.
+	CompressionZlib = Compression("zlib")
+	// CompressionZstd balances speed and ratio.
+	CompressionZstd = Compression("zstd")
+)
+
+// RetentionPolicy decides which scheduled snapshots of a volume are kept, in
+// grandfather-father-son fashion. A snapshot is kept if any rule keeps it.
+// Protected snapshots and snapshots not taken by the scheduler are never
+// deleted.
+type RetentionPolicy struct {
+	// KeepLast number of most recent snapshots kept.
+	KeepLast int `json:",omitempty"`
+	// Hourly number of hours whose last snapshot is kept.
+	Hourly int `json:",omitempty"`
+	// Daily number of days whose last snapshot is kept.
+	Daily int `json:",omitempty"`
+	// Weekly number of weeks whose last snapshot is kept.
+	Weekly int `json:",omitempty"`
+	// Monthly number of months whose last snapshot is kept.
+	Monthly int `json:",omitempty"`
+}
+
+// VolumeProfile is a named VolumeSpec, such as "db-fast", that volumes of
+// any driver can be created from.
+type VolumeProfile struct {
+	Name string
+	// Description of the intended use of the profile.
+	Description string `json:",omitempty"`
+	Spec        VolumeSpec
+}
+
+// Quota limits the volumes of a tenant, the volumes owned by the principal
+// Tenant, across all drivers.
+type Quota struct {
+	Tenant string
+	// MaxVolumes the tenant may have, not limited if 0.
+	MaxVolumes int `json:",omitempty"`
+	// MaxBytes provisioned to the volumes of the tenant, not limited if 0.
+	MaxBytes uint64 `json:",omitempty"`
+}
+
+// QuotaUsage is a quota and the volumes and bytes the tenant has.
+type QuotaUsage struct {
+	Quota
+	Volumes int
+	Bytes   uint64
+}
+
+// CacheMode is the write policy of a volume cache.
+type CacheMode string
+
+const (
+	// CacheWritethrough writes complete once they reach the volume. The cache
+	// never holds data the volume does not have.
+	CacheWritethrough = CacheMode("writethrough")
+	// CacheWriteback writes complete once they reach the cache and are
+	// flushed to the volume in the background and on detach.
+	CacheWriteback = CacheMode("writeback")
+)
+
+// CacheSpec configures the local cache of a block volume.
+type CacheSpec struct {
+	// Device fast local block device, such as an SSD partition, dedicated to
+	// caching this volume. It must be one of the cache devices configured on
+	// the node the volume is attached to. Its contents are overwritten.
+	Device string
+	// Mode write policy, writethrough if empty.
+	Mode CacheMode
+	// BlockSize cache block size in bytes, a multiple of 32KiB. 256KiB if 0.
+	BlockSize uint64
+}
+
+// ExportProtocol is a network protocol block volumes can be exported over.
+type ExportProtocol string
+
+const (
+	// ProtocolISCSI exports volumes as iSCSI targets.
+	ProtocolISCSI ExportProtocol = "iscsi"
+	// ProtocolNVMeoF exports volumes as NVMe over Fabrics (TCP) subsystems.
+	ProtocolNVMeoF ExportProtocol = "nvmeof"
+)
+
+// VolumeExport describes how remote hosts reach an exported volume.
+type VolumeExport struct {
+	// Protocol the volume is exported over.
+	Protocol ExportProtocol
+	// Node exporting the volume.
+	Node MachineID
+	// Target protocol specific target name, the IQN for iSCSI or the NQN
+	// for NVMe-oF.
+	Target string
+	// Portals addresses the target is reachable on, as host:port.
+	Portals []string
+	// LUN of the volume within the target, the namespace ID for NVMe-oF.
+	LUN int
+	// Time the volume was exported.
+	Time time.Time
 }
 
 // MachineID is a node instance identifier for clustered systems.
@@ -142,18 +504,58 @@ type Volume struct {
 	LastScan time.Time
 	// Format Filesystem type if any
 	Format Filesystem
+	// FsUUID UUID of the filesystem recorded when the volume was formatted,
+	// checked against the device presented when it is attached.
+	FsUUID string `json:",omitempty"`
+	// OriginUUID UUID of the signature on the device the driver attaches,
+	// that of LUKS, VDO or the filesystem, recorded when the volume was
+	// formatted and checked before any layer is assembled over the device.
+	OriginUUID string `json:",omitempty"`
+	// Layers names of the layers of the driver when the volume was created,
+	// from the bottom up. Layers only initialize the volumes listing them.
+	Layers []string `json:",omitempty"`
 	// Status see VolumeStatus
 	Status VolumeStatus
 	// State see VolumeState
 	State VolumeState
+	// StateHistory most recent state transitions, oldest first.
+	StateHistory []StateTransition
+	// UsageHistory most recent attaches, detaches, mounts and unmounts,
+	// oldest first.
+	UsageHistory []UsageEvent `json:",omitempty"`
 	// AttachedOn - Node on which this volume is attached.
 	AttachedOn MachineID
+	// Attachments all nodes this volume is attached on, more than one for
+	// read-only or shared volumes.
+	Attachments []Attachment
 	// DevicePath
 	DevicePath string
 	// AttachPath
 	AttachPath string
+	// Pool the volume is carved out of, such as the NFS export holding it,
+	// empty for drivers with a single pool.
+	Pool string `json:",omitempty"`
+	// SubpathMounts paths the subdirectories of the volume are bind mounted
+	// at on the node it is mounted on.
+	SubpathMounts []string `json:",omitempty"`
+	// Maintenance IO to the volume is frozen: its mounts are read-only and
+	// it cannot be attached or mounted again until maintenance ends.
+	Maintenance bool
+	// Ownership owner of the volume and principals it is shared with.
+	Ownership Ownership
 	// ReplicaSet Set of nodes no which this Volume is erasure coded - for clustered storage arrays
 	ReplicaSet []MachineID
+	// Replicas health of the copies on the ReplicaSet nodes.
+	Replicas []Replica
+	// Exports network exports of this volume.
+	Exports []VolumeExport
+	// Parent snapshot this volume was cloned from, BadSnapID if none.
+	Parent SnapID
+	// DeleteTime time the volume was moved to the trash, zero otherwise.
+	DeleteTime time.Time
+	// Alerts raised on the volume, such as the corruption found by an
+	// integrity scan, until the condition is cleared.
+	Alerts []VolumeAlert `json:",omitempty"`
 	// Error Last recorded error
 	Error string
 }
@@ -168,14 +570,772 @@ type VolumeSnap struct {
 	Ctime time.Time
 	// SnapLabel arbitrary name value pairs
 	SnapLabels Labels
+	// Writable snaps are clones that can be mounted and written like a
+	// volume, other snaps are read-only crash-consistent copies.
+	Writable bool
+	// Protected snaps are never deleted by retention policies.
+	Protected bool `json:",omitempty"`
 	// Usage
 	Usage uint64
 }
 
-// VolumeStats
+const (
+	// GroupLabel SnapLabels key of the group of the volumes of a group
+	// snapshot.
+	GroupLabel = "osd.group"
+	// GroupSnapLabel SnapLabels key of the ID shared by the snaps of a
+	// group snapshot.
+	GroupSnapLabel = "osd.group_snap"
+	// WarmPoolLabel VolumeLabels key of the volumes created ahead of
+	// requests, set to the profile they were created from. The label is
+	// removed when a volume is claimed.
+	WarmPoolLabel = "osd.warm_pool"
+	// ScheduledSnapLabel SnapLabels key of the snaps taken by the snapshot
+	// scheduler, retention policies apply to them.
+	ScheduledSnapLabel = "osd.scheduled"
+	// JournalLabel VolumeLabels key of the volumes being created, set to
+	// the ID of the journal entry of their create so that an interrupted
+	// create rolls back only its own volume. The label is removed once the
+	// volume is created.
+	JournalLabel = "osd.journal"
+)
+
+// CatalogEntry is a file or directory within a volume.
+type CatalogEntry struct {
+	// Name of the file, relative to the listed directory.
+	Name string
+	// Dir is true for directories.
+	Dir bool
+	// Size in bytes.
+	Size uint64
+	// ModTime last modification time.
+	ModTime time.Time
+}
+
+// MountInfo is a path a volume is mounted at on a node.
+type MountInfo struct {
+	// Path the volume is mounted at.
+	Path string
+	// Source device or directory mounted at Path.
+	Source string
+	// Fstype type of the mounted filesystem, empty if the recorded mount is
+	// missing from the mount table.
+	Fstype string
+	// Options the filesystem is mounted with.
+	Options string
+	// Recorded is true if the driver recorded the mount, false for mounts
+	// made outside of OSD, such as bind mounts of a container runtime.
+	Recorded bool
+	// Processes using files under Path.
+	Processes []ProcessInfo
+}
+
+// ProcessInfo is a process using a mounted volume.
+type ProcessInfo struct {
+	Pid int
+	// Command name of the process.
+	Command string
+	// Container ID of the container the process runs in, empty if it runs
+	// on the host.
+	Container string `json:",omitempty"`
+}
+
+// VolumeGraph is the set of objects that depend on a volume.
+type VolumeGraph struct {
+	// Volume at the root of this graph.
+	Volume Volume
+	// ReplicaSet nodes that hold a copy of this volume.
+	ReplicaSet []MachineID
+	// Snaps taken of this volume and the clones derived from them.
+	Snaps []SnapGraph
+	// Backups cloud snapshots of this volume.
+	Backups []CloudSnap
+	// Exports network exports of this volume.
+	Exports []VolumeExport
+}
+
+// SnapGraph is a snapshot and the volumes cloned from it.
+type SnapGraph struct {
+	// Snap the snapshot.
+	Snap VolumeSnap
+	// Clones volumes created from this snapshot.
+	Clones []VolumeGraph
+}
+
+// VolumeStats are cumulative IO statistics for a volume.
 type VolumeStats struct {
+	// Reads completed successfully.
+	Reads uint64
+	// ReadMs time spent in reads in ms.
+	ReadMs uint64
+	// ReadBytes bytes read.
+	ReadBytes uint64
+	// Writes completed successfully.
+	Writes uint64
+	// WriteMs time spent in writes in ms.
+	WriteMs uint64
+	// WriteBytes bytes written.
+	WriteBytes uint64
+	// IOProgress IOs currently in progress.
+	IOProgress uint64
+	// IOMs time spent doing IOs in ms.
+	IOMs uint64
+	// CompressionRatio size of the data written to a compressed volume
+	// over the space it uses, 0 if unknown. With VDO it includes the
+	// savings of dedupe.
+	CompressionRatio float64 `json:",omitempty"`
+}
+
+// VolumeStatsSample is the IO rate of a volume over the sampling interval
+// ending at Time.
+type VolumeStatsSample struct {
+	// Time the sample was taken.
+	Time time.Time
+	// ReadIOPS reads per second.
+	ReadIOPS float64
+	// WriteIOPS writes per second.
+	WriteIOPS float64
+	// ReadBps bytes read per second.
+	ReadBps float64
+	// WriteBps bytes written per second.
+	WriteBps float64
+	// ReadLatencyMs average time of a read in ms.
+	ReadLatencyMs float64
+	// WriteLatencyMs average time of a write in ms.
+	WriteLatencyMs float64
+}
+
+// VolumeAlert is a condition of a volume that needs attention.
+type VolumeAlert struct {
+	// Type of the event published when the alert was raised.
+	Type EventType
+	// Time the alert was raised.
+	Time time.Time
+	// Message describes the condition.
+	Message string
 }
 
 // VolumeAlerts
 type VolumeAlerts struct {
+	// Alerts raised on the volume and not cleared.
+	Alerts []VolumeAlert `json:",omitempty"`
+}
+
+// AuditRecord records who performed a volume operation, when, with which
+// parameters and with what result.
+type AuditRecord struct {
+	// Time the operation completed.
+	Time time.Time
+	// Principal authenticated user of the request, "local" for requests
+	// on the local unix sockets.
+	Principal string
+	// Driver that served the operation.
+	Driver string
+	// Op operation, such as create, delete, attach, mount or snapshot.
+	Op string
+	// VolumeID volume operated on, if known.
+	VolumeID VolumeID `json:",omitempty"`
+	// Params request parameters.
+	Params json.RawMessage `json:",omitempty"`
+	// Error is "" on success or contains the error message on failure.
+	Error string `json:",omitempty"`
+}
+
+// LogEntry is an entry captured from the logs of a node.
+type LogEntry struct {
+	Time time.Time
+	// Level of the entry, such as info or warning.
+	Level string
+	// Driver that logged the entry, empty for entries of other components.
+	Driver  string `json:",omitempty"`
+	Message string
+	// Fields structured fields of the entry, such as volumeID, op and
+	// duration.
+	Fields map[string]string `json:",omitempty"`
+}
+
+// LogLevel is the log level of a driver.
+type LogLevel struct {
+	Driver string
+	// Level such as debug, info, warning or error.
+	Level string
+}
+
+// AuditFilter selects audit records. Empty fields match all records.
+type AuditFilter struct {
+	Driver    string
+	Op        string
+	Principal string
+	VolumeID  VolumeID
+	// Since and Until bound the time of the records.
+	Since time.Time
+	Until time.Time
+	// Limit returns only the most recent records if not 0.
+	Limit int
+}
+
+// HealthState is the health of a driver.
+type HealthState string
+
+const (
+	// HealthOK all checks passed.
+	HealthOK = HealthState("ok")
+	// HealthDegraded the driver serves requests, some with reduced capacity
+	// or redundancy.
+	HealthDegraded = HealthState("degraded")
+	// HealthDown the driver cannot serve requests.
+	HealthDown = HealthState("down")
+)
+
+// HealthReason is a failed driver health check.
+type HealthReason struct {
+	// Check that failed, such as "mount" or "writable".
+	Check string
+	// State of the driver because of this failure, HealthDegraded or
+	// HealthDown.
+	State HealthState
+	// Message describes the failure.
+	Message string
+}
+
+// DriverHealth is the result of the health checks of a driver.
+type DriverHealth struct {
+	// Driver name.
+	Driver string
+	// State is the worst state of the Reasons, HealthOK if there are none.
+	State HealthState
+	// Reasons failed checks.
+	Reasons []HealthReason `json:",omitempty"`
+	// Time of the check.
+	Time time.Time
+}
+
+// HealthResponse is the health of all drivers of a node.
+type HealthResponse struct {
+	// State is the worst state of the Drivers.
+	State HealthState
+	// Drivers health by driver.
+	Drivers []DriverHealth
+}
+
+// DriverStatus is the diagnostic status of a driver.
+type DriverStatus struct {
+	// Driver name.
+	Driver string
+	// Version of the driver or of its backend, if known.
+	Version string `json:",omitempty"`
+	// Capacity total bytes of the backend, 0 if unknown.
+	Capacity uint64 `json:",omitempty"`
+	// Free bytes available on the backend.
+	Free uint64 `json:",omitempty"`
+	// Endpoints servers, shares or API endpoints the driver uses.
+	Endpoints []string `json:",omitempty"`
+	// Pools capacity of each disk, export or pool of the backend.
+	Pools []PoolStatus `json:",omitempty"`
+	// Errors number of failed operations by operation.
+	Errors map[string]uint64 `json:",omitempty"`
+	// Details other driver specific key-value pairs, in display order.
+	Details [][2]string `json:",omitempty"`
+}
+
+// PoolStatus is the capacity of a disk, export or pool of a driver.
+type PoolStatus struct {
+	// Name of the pool, such as a device path or an export.
+	Name string
+	// Capacity total bytes of the pool, 0 if unknown.
+	Capacity uint64 `json:",omitempty"`
+	// Free bytes available in the pool.
+	Free uint64
+	// Provisioned sum of the sizes of the volumes of the pool, in capacity
+	// reports.
+	Provisioned uint64 `json:",omitempty"`
+	// Used bytes used by the volumes of the pool, in capacity reports.
+	Used uint64 `json:",omitempty"`
+	// Error why the capacity of the pool is unknown.
+	Error string `json:",omitempty"`
+}
+
+// DriverCapacity is the capacity of a driver on a node and the space
+// promised to and used by its volumes.
+type DriverCapacity struct {
+	// Node the driver runs on.
+	Node MachineID
+	// Driver name.
+	Driver string
+	// Shared the pools of the driver are shared by the nodes, such as network
+	// exports, and are counted once in the cluster capacity.
+	Shared bool `json:",omitempty"`
+	// Capacity total bytes of the pools.
+	Capacity uint64
+	// Free bytes available in the pools.
+	Free uint64
+	// Provisioned sum of the sizes of the volumes of the driver. It exceeds
+	// Capacity when thin provisioned volumes are overcommitted.
+	Provisioned uint64
+	// Used bytes used by the volumes of the driver.
+	Used uint64
+	// Pools capacity of each pool of the driver.
+	Pools []PoolStatus `json:",omitempty"`
+	// Time of the report.
+	Time time.Time
+}
+
+// ClusterCapacity is the capacity of the drivers of all nodes.
+type ClusterCapacity struct {
+	// Capacity total bytes of the pools.
+	Capacity uint64
+	// Free bytes available in the pools.
+	Free uint64
+	// Provisioned sum of the sizes of all volumes.
+	Provisioned uint64
+	// Used bytes used by all volumes.
+	Used uint64
+	// Overcommit ratio of Provisioned to Capacity, above 1 when thin
+	// provisioned volumes promise more space than the pools hold.
+	Overcommit float64
+	// Drivers capacity of each driver on each node.
+	Drivers []DriverCapacity
+	// Pools capacity of each pool, shared pools are listed once.
+	Pools []PoolCapacity `json:",omitempty"`
+}
+
+// MemberStatus is the state of the cluster or of one of its nodes.
+type MemberStatus string
+
+const (
+	// MemberInit the cluster is not initialized.
+	MemberInit = MemberStatus("init")
+	// MemberOnline the cluster or node is in service.
+	MemberOnline = MemberStatus("online")
+	// MemberOffline the node stopped sending heartbeats.
+	MemberOffline = MemberStatus("offline")
+	// MemberError the cluster or node failed.
+	MemberError = MemberStatus("error")
+	// MemberMaintenance the node takes no new volumes nor attaches.
+	MemberMaintenance = MemberStatus("maintenance")
+)
+
+// ClusterNode is a node of the cluster.
+type ClusterNode struct {
+	ID     MachineID
+	Ip     string
+	Status MemberStatus
+	// Region, Zone and Rack of the failure domains of the node.
+	Region string `json:",omitempty"`
+	Zone   string `json:",omitempty"`
+	Rack   string `json:",omitempty"`
+	// Cpu and Memory usage in percent, as of the last heartbeat.
+	Cpu    float64 `json:",omitempty"`
+	Memory float64 `json:",omitempty"`
+	// Heartbeat time of the last heartbeat received from the node, zero if
+	// none was.
+	Heartbeat time.Time `json:",omitempty"`
+}
+
+// ClusterStatus is the state of the cluster as seen by a node.
+type ClusterStatus struct {
+	ID     string
+	Status MemberStatus
+	// Node serving the request.
+	Node MachineID
+	// Nodes number of nodes by status.
+	Nodes map[MemberStatus]int
+}
+
+// PoolCapacity is the capacity of a pool and the space promised to and used
+// by the volumes it holds.
+type PoolCapacity struct {
+	// Driver of the pool.
+	Driver string
+	// Node of the pool, empty for the pools of shared drivers.
+	Node MachineID `json:",omitempty"`
+	// Name of the pool, the name of the driver if it reports no pools.
+	Name string
+	// Capacity total bytes of the pool.
+	Capacity uint64
+	// Free bytes available in the pool.
+	Free uint64
+	// Provisioned sum of the sizes of the volumes of the pool.
+	Provisioned uint64
+	// Used bytes used by the volumes of the pool.
+	Used uint64
+	// Overcommit ratio of Provisioned to Capacity.
+	Overcommit float64
+	// Alerts capacity thresholds the pool crossed, EventPoolOvercommitted
+	// or EventPoolLowSpace.
+	Alerts []EventType `json:",omitempty"`
+}
+
+// String renders the status as one "key: value" line per item, for display.
+func (s *DriverStatus) String() string {
+	var b bytes.Buffer
+	line := func(k string, v interface{}) {
+		fmt.Fprintf(&b, "%s: %v\n", k, v)
+	}
+	line("Driver", s.Driver)
+	if s.Version != "" {
+		line("Version", s.Version)
+	}
+	if s.Capacity != 0 {
+		line("Capacity", s.Capacity)
+		line("Free", s.Free)
+	}
+	for _, e := range s.Endpoints {
+		line("Endpoint", e)
+	}
+	for _, p := range s.Pools {
+		switch {
+		case p.Error != "":
+			line("Pool "+p.Name, p.Error)
+		case p.Capacity != 0:
+			line("Pool "+p.Name, fmt.Sprintf("%d of %d bytes free", p.Free, p.Capacity))
+		default:
+			line("Pool "+p.Name, fmt.Sprintf("%d bytes free", p.Free))
+		}
+	}
+	ops := make([]string, 0, len(s.Errors))
+	for op := range s.Errors {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		line(op+" errors", s.Errors[op])
+	}
+	for _, d := range s.Details {
+		line(d[0], d[1])
+	}
+	return b.String()
+}
+
+// Backend is a disk, export or node a driver places volumes on.
+type Backend struct {
+	// ID of the backend, such as an export or a node ID.
+	ID string
+	// Capacity total bytes of the backend.
+	Capacity uint64
+	// Used bytes used on the backend.
+	Used uint64
+	// Volumes the volumes on the backend that may be moved, with the bytes
+	// each uses.
+	Volumes map[VolumeID]uint64
+}
+
+// RebalanceRequest starts a rebalance of the volumes of a driver.
+type RebalanceRequest struct {
+	// Threshold difference in percentage points between the most and the
+	// least loaded backends that is tolerated, 10 if 0.
+	Threshold int
+	// MaxMoves maximum number of volumes to move, no limit if 0.
+	MaxMoves int
+	// IO balance the IO of the volumes instead of their used space.
+	IO bool `json:",omitempty"`
+	// DryRun plan the moves without making them.
+	DryRun bool `json:",omitempty"`
+}
+
+// JobState is the progress of a background job.
+type JobState string
+
+const (
+	// JobRunning the job is in progress.
+	JobRunning = JobState("running")
+	// JobDone the job completed.
+	JobDone = JobState("done")
+	// JobFailed the job stopped on an error.
+	JobFailed = JobState("failed")
+	// JobCancelled the job was cancelled.
+	JobCancelled = JobState("cancelled")
+)
+
+// RebalanceMove is a volume moved, or to move, between backends.
+type RebalanceMove struct {
+	// VolumeID of the volume.
+	VolumeID VolumeID
+	// From backend the volume is on.
+	From string
+	// To backend the volume is moved to.
+	To string
+	// Size bytes used by the volume.
+	Size uint64
+	// Done the volume was moved.
+	Done bool `json:",omitempty"`
+	// Error why the volume could not be moved.
+	Error string `json:",omitempty"`
+}
+
+// RebalanceJob is the plan and progress of a rebalance.
+type RebalanceJob struct {
+	// Driver name.
+	Driver string
+	// Request the job was started with.
+	Request RebalanceRequest
+	// State of the job. A dry run is done once planned.
+	State JobState
+	// Moves planned, in order.
+	Moves []RebalanceMove
+	// Moved number of volumes moved so far.
+	Moved int
+	// BytesMoved bytes of the volumes moved so far.
+	BytesMoved uint64
+	// Start time of the job.
+	Start time.Time
+	// End time of the job, zero while it runs.
+	End time.Time
+	// Error why the job failed.
+	Error string `json:",omitempty"`
+}
+
+// Orphan is storage on a backend of a driver that no volume or snapshot
+// references, for instance left behind by an interrupted create.
+type Orphan struct {
+	// ID identifies the storage to the driver, such as its path.
+	ID string
+	// Backend holding the storage.
+	Backend string `json:",omitempty"`
+	// Size bytes used by the storage.
+	Size uint64
+	// Mtime time the storage was last modified.
+	Mtime time.Time
+	// Reclaimed the storage was removed.
+	Reclaimed bool `json:",omitempty"`
+}
+
+// Fingerprint is a hash of the content of a volume. Volumes holding the same
+// data have the same fingerprint, so that copies made by migrations and
+// backups can be verified.
+type Fingerprint struct {
+	// VolumeID volume the fingerprint was computed for.
+	VolumeID VolumeID
+	// Algorithm hash and what it covers: sha256 of the data of block
+	// volumes, sha256-tree of the files of file volumes. Only fingerprints
+	// of the same algorithm compare.
+	Algorithm string
+	// Sum hex encoded hash.
+	Sum string
+	// Base snapshot whose recorded hashes were reused for the files
+	// unchanged since, empty if all data was read.
+	Base SnapID `json:",omitempty"`
+	// Hashed files whose data was read.
+	Hashed int `json:",omitempty"`
+	// Reused files whose hash was taken from the base snapshot.
+	Reused int `json:",omitempty"`
+	// Computed time the fingerprint was computed.
+	Computed time.Time
+}
+
+const (
+	// FingerprintSHA256 hashes the data of block volumes.
+	FingerprintSHA256 = "sha256"
+	// FingerprintTree hashes the files of file volumes, see pkg/diff.
+	FingerprintTree = "sha256-tree"
+)
+
+// SnapArchiveLocation is where a snapshot is exported to in an object store.
+type SnapArchiveLocation struct {
+	// Store name of the Object driver instance of the object store.
+	Store string `json:"store"`
+	// Bucket holding the archive.
+	Bucket string `json:"bucket"`
+	// Prefix of the keys of the objects of the archive.
+	Prefix string `json:"prefix"`
+}
+
+// SnapArchiveChunk is an object holding part of the data of an archive.
+type SnapArchiveChunk struct {
+	// Size bytes in the chunk.
+	Size int64
+	// Sum hex encoded SHA-256 of the chunk.
+	Sum string
+}
+
+// SnapArchiveGzip compresses each chunk of an archive with gzip.
+const SnapArchiveGzip = "gzip"
+
+// SnapArchive describes a snapshot exported to an object store, in a format
+// that any cluster can import into a new volume. The data is a diff stream,
+// see pkg/diff, split into chunks.
+type SnapArchive struct {
+	// Version of the archive format.
+	Version int
+	// Snap exported snapshot.
+	Snap VolumeSnap
+	// Locator of the volume the snapshot was taken of.
+	Locator VolumeLocator
+	// Spec of the volume the snapshot was taken of.
+	Spec *VolumeSpec
+	// Driver the snapshot was exported from.
+	Driver string
+	// Compression of each chunk, SnapArchiveGzip or none if empty.
+	Compression string `json:",omitempty"`
+	// Chunks of the data, in order.
+	Chunks []SnapArchiveChunk
+	// Exported time the export completed.
+	Exported time.Time
+}
+
+// CloudSnapRequest uploads a snapshot to an object store.
+type CloudSnapRequest struct {
+	// SnapID snapshot to upload.
+	SnapID SnapID
+	// Store name of the Object driver instance to upload to.
+	Store string
+	// Bucket to upload to, it must exist.
+	Bucket string
+	// NoCompression store chunks as is, for data that does not compress.
+	NoCompression bool `json:",omitempty"`
+}
+
+// CloudSnapRestoreRequest restores a cloud snapshot into a new volume.
+type CloudSnapRestoreRequest struct {
+	// Locator of the new volume, the locator of the snapshotted volume if
+	// empty.
+	Locator VolumeLocator
+}
+
+// CloudSnap is a snapshot uploaded to an object store, as recorded in the
+// cloud snapshot catalog.
+type CloudSnap struct {
+	// ID of the cloud snapshot.
+	ID string
+	// Driver the snapshot is of.
+	Driver string
+	// VolumeID volume the snapshot is of.
+	VolumeID VolumeID
+	// Owner of the volume when the snapshot was uploaded, who keeps access
+	// to it once the volume is deleted.
+	Owner string `json:",omitempty"`
+	// SnapID snapshot uploaded.
+	SnapID SnapID
+	// Node uploading the snapshot.
+	Node MachineID
+	// Location of the upload.
+	Location SnapArchiveLocation
+	// State of the upload. Failed uploads may be resumed.
+	State JobState
+	// Archive chunks uploaded so far, complete once done.
+	Archive SnapArchive
+	// Created time the upload started.
+	Created time.Time
+	// Completed time the upload completed.
+	Completed time.Time `json:",omitempty"`
+	// Error why the upload failed.
+	Error string `json:",omitempty"`
+}
+
+// GCPolicy is what the garbage collector does with orphans.
+type GCPolicy string
+
+const (
+	// GCReport orphans are only reported.
+	GCReport = GCPolicy("report")
+	// GCReclaim orphans are removed.
+	GCReclaim = GCPolicy("reclaim")
+)
+
+// EventType is the kind of a cluster or volume event.
+type EventType string
+
+const (
+	// EventNodeUp a node joined the cluster or came back online.
+	EventNodeUp = EventType("node_up")
+	// EventNodeDown a node went offline or left the cluster.
+	EventNodeDown = EventType("node_down")
+	// EventNodeMaintenanceStart a node entered maintenance.
+	EventNodeMaintenanceStart = EventType("node_maintenance_start")
+	// EventNodeMaintenanceEnd a node exited maintenance.
+	EventNodeMaintenanceEnd = EventType("node_maintenance_end")
+	// EventVolumeCreated a volume was created.
+	EventVolumeCreated = EventType("volume_created")
+	// EventVolumeDeleted a volume was deleted.
+	EventVolumeDeleted = EventType("volume_deleted")
+	// EventVolumeAttached a volume was attached.
+	EventVolumeAttached = EventType("volume_attached")
+	// EventVolumeDetached a volume was detached.
+	EventVolumeDetached = EventType("volume_detached")
+	// EventSnapshotCompleted a snapshot of a volume was taken.
+	EventSnapshotCompleted = EventType("snapshot_completed")
+	// EventVolumeCorrupt an integrity scan found a volume corrupt.
+	EventVolumeCorrupt = EventType("volume_corrupt")
+	// EventOrphanFound the garbage collector found storage no volume
+	// references.
+	EventOrphanFound = EventType("orphan_found")
+	// EventPoolOvercommitted the space provisioned to the volumes of a pool
+	// exceeds the overcommit threshold.
+	EventPoolOvercommitted = EventType("pool_overcommitted")
+	// EventPoolLowSpace the free space of a pool fell below the free space
+	// threshold.
+	EventPoolLowSpace = EventType("pool_low_space")
+	// EventPoolRecovered a pool is back within the capacity thresholds.
+	EventPoolRecovered = EventType("pool_recovered")
+	// EventEphemeralLeaked the mount of an ephemeral volume went away without
+	// the volume being unmounted, it is released and deleted.
+	EventEphemeralLeaked = EventType("ephemeral_leaked")
+	// EventVolumeMaintenanceStart a volume entered maintenance, its mounts
+	// are remounted read-only on every node.
+	EventVolumeMaintenanceStart = EventType("volume_maintenance_start")
+	// EventVolumeMaintenanceEnd a volume exited maintenance.
+	EventVolumeMaintenanceEnd = EventType("volume_maintenance_end")
+)
+
+// HookPhase is when a hook is called relative to the operation it hooks.
+type HookPhase string
+
+const (
+	// HookPre hooks are called before the operation, which is vetoed if a
+	// hook fails.
+	HookPre = HookPhase("pre")
+	// HookPost hooks are called once the operation returned.
+	HookPost = HookPhase("post")
+)
+
+// HookRequest describes a volume operation to the hooks called around it,
+// it is the body POSTed to webhooks.
+type HookRequest struct {
+	// Op hooked: create, delete, attach, snapshot, resize or transfer.
+	Op    string    `json:"op"`
+	Phase HookPhase `json:"phase"`
+	// Driver the operation is made on.
+	Driver string `json:"driver"`
+	// VolumeID of the volume operated on, or created for post hooks.
+	VolumeID VolumeID `json:"volume_id,omitempty"`
+	// Principal the operation is made for, empty for local callers.
+	Principal string `json:"principal,omitempty"`
+	// Owner the volume is transferred to, for transfers.
+	Owner string `json:"owner,omitempty"`
+	// Locator, Options and Spec of creates. The Spec of resizes holds
+	// the new size of the volume.
+	Locator *VolumeLocator `json:"locator,omitempty"`
+	Options *CreateOptions `json:"options,omitempty"`
+	Spec    *VolumeSpec    `json:"spec,omitempty"`
+	// AttachOptions of attaches.
+	AttachOptions *AttachOptions `json:"attach_options,omitempty"`
+	// Labels of snapshots.
+	Labels Labels `json:"labels,omitempty"`
+	// SnapID of the snapshot taken, for post hooks.
+	SnapID SnapID `json:"snap_id,omitempty"`
+	// Error of the operation, for post hooks.
+	Error string `json:"error,omitempty"`
+}
+
+// Event is published on the event bus when the state of the cluster or of a
+// volume changes.
+type Event struct {
+	Type EventType
+	// Time the event occurred.
+	Time time.Time
+	// Node the event was published on.
+	Node MachineID
+	// Subject node of node events.
+	Subject MachineID `json:",omitempty"`
+	// Driver of volume and pool events.
+	Driver string `json:",omitempty"`
+	// Pool of pool events.
+	Pool string `json:",omitempty"`
+	// VolumeID of volume events.
+	VolumeID VolumeID `json:",omitempty"`
+	// SnapID of snapshot events, if known.
+	SnapID SnapID `json:",omitempty"`
+	// Message details of the event, such as the problems found by an
+	// integrity scan.
+	Message string `json:",omitempty"`
 }
@@ -0,0 +1,247 @@
+package apiserver
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// localPrincipal is the principal of requests on the unauthenticated unix
+// sockets, which are trusted with all volumes.
+const localPrincipal = "local"
+
+var (
+	// ErrUnauthenticated is returned when a request carries no credentials
+	// an Authenticator accepts.
+	ErrUnauthenticated = errors.New("Request is not authenticated")
+)
+
+// Authenticator verifies the credentials of a REST request.
+type Authenticator interface {
+	// Authenticate returns the name of the authenticated principal or
+	// ErrUnauthenticated.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// TokenAuthenticator accepts requests with a bearer token from a fixed set.
+type TokenAuthenticator struct {
+	tokens map[string]string
+}
+
+// NewTokenAuthenticator returns an Authenticator for tokens, a map of token to
+// principal name.
+func NewTokenAuthenticator(tokens map[string]string) *TokenAuthenticator {
+	return &TokenAuthenticator{tokens: tokens}
+}
+
+// Authenticate checks the "Authorization: Bearer <token>" header.
+func (t *TokenAuthenticator) Authenticate(r *http.Request) (string, error) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return "", ErrUnauthenticated
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	for t, name := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return name, nil
+		}
+	}
+	return "", ErrUnauthenticated
+}
+
+// CertAuthenticator accepts requests made over TLS with a client certificate
+// verified against the server's client CA pool. If allowed is not empty the
+// certificate common name must also be listed.
+type CertAuthenticator struct {
+	allowed map[string]bool
+}
+
+// NewCertAuthenticator returns an Authenticator for TLS client certificates.
+func NewCertAuthenticator(allowed []string) *CertAuthenticator {
+	c := &CertAuthenticator{allowed: make(map[string]bool)}
+	for _, cn := range allowed {
+		c.allowed[cn] = true
+	}
+	return c
+}
+
+// Authenticate checks the verified client certificate chain of the request.
+func (c *CertAuthenticator) Authenticate(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", ErrUnauthenticated
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if len(c.allowed) != 0 && !c.allowed[cn] {
+		return "", ErrUnauthenticated
+	}
+	return cn, nil
+}
+
+// MultiAuthenticator accepts a request if any of its Authenticators does.
+type MultiAuthenticator []Authenticator
+
+// Authenticate tries each Authenticator in order.
+func (m MultiAuthenticator) Authenticate(r *http.Request) (string, error) {
+	for _, a := range m {
+		if name, err := a.Authenticate(r); err == nil {
+			return name, nil
+		}
+	}
+	return "", ErrUnauthenticated
+}
+
+// authenticate wraps h so that only requests accepted by a are served.
+func authenticate(a Authenticator, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, err := a.Authenticate(r)
+		if err != nil {
+			log.Warnf("Rejecting %s %s from %s: %v", r.Method, r.URL, r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		log.Debugf("%s %s authenticated as %s", r.Method, r.URL, name)
+		h.ServeHTTP(w, r.WithContext(volume.WithPrincipal(r.Context(), name)))
+	})
+}
+
+// principal returns the principal r was authenticated as, or localPrincipal
+// for requests on the unauthenticated unix sockets.
+func principal(r *http.Request) string {
+	if name := volume.Principal(r.Context()); name != "" {
+		return name
+	}
+	return localPrincipal
+}
+
+// authorize returns volume.ErrPermission if the principal of r lacks access
+// to volumeID of d. Missing volumes are left for the handler to report.
+func authorize(r *http.Request, d volume.VolumeDriver, volumeID api.VolumeID, access api.AccessType) error {
+	p := principal(r)
+	if p == localPrincipal {
+		return nil
+	}
+	vols, err := d.Inspect([]api.VolumeID{volumeID})
+	if err != nil || len(vols) == 0 {
+		return nil
+	}
+	return volume.Authorize(&vols[0], p, access)
+}
+
+// authorizeSnap returns the snapshot snapID of d, and volume.ErrPermission
+// if the principal of r lacks access to the volume it was taken of. Only the
+// local principal has access to snapshots whose volume is gone.
+// Errors volume.ErrEnoEnt, volume.ErrPermission may be returned.
+func authorizeSnap(r *http.Request,
+	d volume.VolumeDriver,
+	snapID api.SnapID,
+	access api.AccessType) (*api.VolumeSnap, error) {
+	snaps, err := d.SnapInspect([]api.SnapID{snapID})
+	if err != nil || len(snaps) == 0 {
+		return nil, volume.ErrEnoEnt
+	}
+	if p := principal(r); p != localPrincipal {
+		vols, err := d.Inspect([]api.VolumeID{snaps[0].VolumeID})
+		if err != nil || len(vols) == 0 {
+			return nil, volume.ErrPermission
+		}
+		if err = volume.Authorize(&vols[0], p, access); err != nil {
+			return nil, err
+		}
+	}
+	return &snaps[0], nil
+}
+
+// readableSnaps returns the snapshots of snaps the principal of r may read,
+// those of volumes it may read.
+func readableSnaps(r *http.Request, d volume.VolumeDriver, snaps []api.VolumeSnap) []api.VolumeSnap {
+	p := principal(r)
+	if p == localPrincipal {
+		return snaps
+	}
+	allowed := make([]api.VolumeSnap, 0, len(snaps))
+	readable := make(map[api.VolumeID]bool)
+	for _, s := range snaps {
+		ok, seen := readable[s.VolumeID]
+		if !seen {
+			vols, err := d.Inspect([]api.VolumeID{s.VolumeID})
+			ok = err == nil && len(vols) == 1 &&
+				volume.Authorize(&vols[0], p, api.AccessRead) == nil
+			readable[s.VolumeID] = ok
+		}
+		if ok {
+			allowed = append(allowed, s)
+		}
+	}
+	return allowed
+}
+
+// authorizeCloudSnap returns volume.ErrPermission if the principal of r lacks
+// access to the volume cs was uploaded from, or is not its recorded owner
+// once the volume is gone.
+func authorizeCloudSnap(r *http.Request, cs *api.CloudSnap, access api.AccessType) error {
+	p := principal(r)
+	if p == localPrincipal {
+		return nil
+	}
+	if d, err := volume.Get(cs.Driver); err == nil {
+		if vols, err := d.Inspect([]api.VolumeID{cs.VolumeID}); err == nil && len(vols) == 1 {
+			return volume.Authorize(&vols[0], p, access)
+		}
+	}
+	if cs.Owner != "" && cs.Owner == p {
+		return nil
+	}
+	return volume.ErrPermission
+}
+
+// readable returns the volumes of vols the principal of r may read.
+func readable(r *http.Request, vols []api.Volume) []api.Volume {
+	p := principal(r)
+	if p == localPrincipal {
+		return vols
+	}
+	allowed := make([]api.Volume, 0, len(vols))
+	for i := range vols {
+		if volume.Authorize(&vols[i], p, api.AccessRead) == nil {
+			allowed = append(allowed, vols[i])
+		}
+	}
+	return allowed
+}
+
+// NewServerTLSConfig returns a TLS configuration serving certFile/keyFile.
+// If clientCAFile is set, client certificates signed by it are requested and
+// verified, so that a CertAuthenticator can be used.
+func NewServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	c := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates found in " + clientCAFile)
+		}
+		c.ClientCAs = pool
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return c, nil
+}
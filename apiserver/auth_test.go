@@ -0,0 +1,115 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+func TestAuthenticate(t *testing.T) {
+	a := NewTokenAuthenticator(map[string]string{"secret": "admin"})
+	h := authenticate(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for token, code := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		r := httptest.NewRequest("GET", "/v1/volumes", nil)
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, code, w.Code, "Authorization %q", token)
+	}
+
+	// Requests without a verified client certificate are rejected.
+	_, err := NewCertAuthenticator(nil).Authenticate(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, ErrUnauthenticated, err)
+}
+
+// snapDriver serves a volume owned by alice and its snapshot, and a
+// snapshot whose volume is gone.
+type snapDriver struct {
+	volume.VolumeDriver
+}
+
+func (d *snapDriver) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
+	if ids[0] != "vol" {
+		return nil, nil
+	}
+	return []api.Volume{{ID: "vol", Ownership: api.Ownership{Owner: "alice"}}}, nil
+}
+
+func (d *snapDriver) SnapInspect(ids []api.SnapID) ([]api.VolumeSnap, error) {
+	switch ids[0] {
+	case "snap":
+		return []api.VolumeSnap{{ID: "snap", VolumeID: "vol"}}, nil
+	case "orphan":
+		return []api.VolumeSnap{{ID: "orphan", VolumeID: "gone"}}, nil
+	}
+	return nil, nil
+}
+
+func TestAuthorizeSnap(t *testing.T) {
+	d := &snapDriver{}
+	as := func(p string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		if p == "" {
+			return r
+		}
+		return r.WithContext(volume.WithPrincipal(r.Context(), p))
+	}
+
+	_, err := authorizeSnap(as("alice"), d, "missing", api.AccessRead)
+	assert.Equal(t, volume.ErrEnoEnt, err)
+	snap, err := authorizeSnap(as("alice"), d, "snap", api.AccessWrite)
+	if assert.NoError(t, err) {
+		assert.Equal(t, api.VolumeID("vol"), snap.VolumeID)
+	}
+	_, err = authorizeSnap(as("bob"), d, "snap", api.AccessRead)
+	assert.Equal(t, volume.ErrPermission, err, "Snapshot of another owner read")
+	_, err = authorizeSnap(as("alice"), d, "orphan", api.AccessRead)
+	assert.Equal(t, volume.ErrPermission, err, "Snapshot of a missing volume read")
+	_, err = authorizeSnap(as(""), d, "orphan", api.AccessOwner)
+	assert.NoError(t, err, "Local principal denied")
+
+	snaps := []api.VolumeSnap{{ID: "snap", VolumeID: "vol"}, {ID: "orphan", VolumeID: "gone"}}
+	assert.Len(t, readableSnaps(as("alice"), d, snaps), 1)
+	assert.Empty(t, readableSnaps(as("bob"), d, snaps))
+	assert.Len(t, readableSnaps(as(""), d, snaps), 2)
+}
+
+func TestAuthorizeCloudSnap(t *testing.T) {
+	as := func(p string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		return r.WithContext(volume.WithPrincipal(r.Context(), p))
+	}
+	// The driver of the upload is not running, only the owner has access.
+	cs := &api.CloudSnap{Driver: "auth_test_missing", VolumeID: "vol", Owner: "alice"}
+	assert.NoError(t, authorizeCloudSnap(as("alice"), cs, api.AccessOwner))
+	assert.Equal(t, volume.ErrPermission, authorizeCloudSnap(as("bob"), cs, api.AccessRead))
+	assert.NoError(t, authorizeCloudSnap(httptest.NewRequest("GET", "/", nil), cs, api.AccessOwner))
+	cs.Owner = ""
+	assert.Equal(t, volume.ErrPermission, authorizeCloudSnap(as("alice"), cs, api.AccessRead),
+		"Backup without an owner read")
+}
+
+func TestLocalOnly(t *testing.T) {
+	vd := newVolumeDriver("auth_test_logs").(*volDriver)
+	for _, h := range []http.HandlerFunc{vd.logLevel, vd.setLogLevel, vd.logs, vd.profileCreate, vd.profileDelete} {
+		r := httptest.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		h(w, r.WithContext(volume.WithPrincipal(r.Context(), "alice")))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}
+}
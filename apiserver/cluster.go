@@ -0,0 +1,115 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/cluster"
+)
+
+// clusterManager returns the cluster manager, or fails the request with 503
+// if the node is not clustered.
+func (m *manager) clusterManager(method string, w http.ResponseWriter) (*cluster.ClusterManager, bool) {
+	cm, err := cluster.Inst()
+	if err != nil {
+		m.sendError(method, "", w, err.Error(), http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return cm, true
+}
+
+// clusterError fails a request on node id with the status code of err.
+func (m *manager) clusterError(method string, id string, w http.ResponseWriter, err error) {
+	switch err {
+	case cluster.ErrNodeNotFound:
+		m.sendError(method, id, w, err.Error(), http.StatusNotFound)
+	case cluster.ErrRemoveSelf:
+		m.sendError(method, id, w, err.Error(), http.StatusBadRequest)
+	default:
+		// ErrDataLoss is returned with the volumes that would be lost.
+		if strings.HasPrefix(err.Error(), cluster.ErrDataLoss.Error()) {
+			m.sendError(method, id, w, err.Error(), http.StatusConflict)
+			return
+		}
+		m.sendError(method, id, w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// clusterStatus reports the state of the cluster.
+func (m *manager) clusterStatus(w http.ResponseWriter, r *http.Request) {
+	method := "clusterStatus"
+	cm, ok := m.clusterManager(method, w)
+	if !ok {
+		return
+	}
+	status, err := cm.Status()
+	if err != nil {
+		m.clusterError(method, "", w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// clusterNodes lists the nodes of the cluster.
+func (m *manager) clusterNodes(w http.ResponseWriter, r *http.Request) {
+	method := "clusterNodes"
+	cm, ok := m.clusterManager(method, w)
+	if !ok {
+		return
+	}
+	nodes, err := cm.Nodes()
+	if err != nil {
+		m.clusterError(method, "", w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(nodes)
+}
+
+// clusterNode reports a node of the cluster.
+func (m *manager) clusterNode(w http.ResponseWriter, r *http.Request) {
+	method := "clusterNode"
+	id := mux.Vars(r)["id"]
+	cm, ok := m.clusterManager(method, w)
+	if !ok {
+		return
+	}
+	node, err := cm.Node(id)
+	if err != nil {
+		m.clusterError(method, id, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(node)
+}
+
+// clusterNodeRemove decommissions a node. The Force query option removes
+// nodes holding the only in sync copy of volumes.
+func (m *manager) clusterNodeRemove(w http.ResponseWriter, r *http.Request) {
+	method := "clusterNodeRemove"
+	id := mux.Vars(r)["id"]
+	force := false
+	if v := r.URL.Query().Get(string(api.OptForce)); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			m.sendError(method, id, w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	cm, ok := m.clusterManager(method, w)
+	if !ok {
+		return
+	}
+	start := time.Now()
+	err := cm.Remove(id, force)
+	m.observe(r, method, "", start, map[string]string{"node": id}, err)
+	if err != nil {
+		m.clusterError(method, id, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(nil))
+}
@@ -7,9 +7,12 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"time"
 
 	types "github.com/libopenstorage/openstorage/api"
 	"github.com/libopenstorage/openstorage/config"
+	"github.com/libopenstorage/openstorage/pkg/spec"
+	"github.com/libopenstorage/openstorage/profile"
 	"github.com/libopenstorage/openstorage/volume"
 )
 
@@ -29,6 +32,7 @@ type handshakeResp struct {
 
 type volumeRequest struct {
 	Name string
+	Opts map[string]string
 }
 
 type volumeResponse struct {
@@ -72,11 +76,20 @@ func (d *driver) emptyResponse(w http.ResponseWriter) {
 }
 
 func (d *driver) volFromName(name string) (*volumeInfo, error) {
+	return d.volFromNameAt(name, types.ConsistencyStrong)
+}
+
+func (d *driver) volFromNameAt(name string, c types.Consistency) (*volumeInfo, error) {
 	v, err := volume.Get(d.name)
 	if err != nil {
 		return nil, fmt.Errorf("Cannot locate volume driver for %s: %s", d.name, err.Error())
 	}
-	volumes, err := v.Inspect([]types.VolumeID{types.VolumeID(name)})
+	volumes, err := volume.InspectAt(v, []types.VolumeID{types.VolumeID(name)}, c)
+	if err == nil && len(volumes) != 0 {
+		return &volumeInfo{vol: &volumes[0]}, nil
+	}
+	// Volumes created through the plugin are known by their locator name.
+	volumes, err = volume.EnumerateAt(v, types.VolumeLocator{Name: name}, nil, c)
 	if err != nil || len(volumes) == 0 {
 		return nil, fmt.Errorf("Cannot locate volume %s", name)
 	}
@@ -120,14 +133,58 @@ func (d *driver) create(w http.ResponseWriter, r *http.Request) {
 
 	d.logReq(method, request.Name).Info("")
 
-	// It is an error if the volume doesn't already exist.
 	_, err = d.volFromName(request.Name)
-	if err != nil {
+	if err == nil {
+		json.NewEncoder(w).Encode(&volumeResponse{})
+		return
+	}
+
+	// Without options it is an error if the volume doesn't already exist,
+	// otherwise the volume is created from the options.
+	if len(request.Opts) == 0 {
 		e := d.volNotFound(method, request.Name, err, w)
 		json.NewEncoder(w).Encode(&volumeResponse{Err: e})
 		return
 	}
-
+	// The profile option names the profile the other options override and
+	// the group option the group of the volume, neither is part of the spec.
+	var options *types.CreateOptions
+	if name, ok := request.Opts[spec.ProfileOpt]; ok {
+		options = &types.CreateOptions{Profile: name}
+	}
+	opts := make(map[string]string)
+	for k, v := range request.Opts {
+		if k != spec.ProfileOpt && k != spec.GroupOpt {
+			opts[k] = v
+		}
+	}
+	volSpec, err := spec.Parse(opts)
+	if err == nil {
+		volSpec, err = profile.Resolve(options, volSpec)
+	}
+	if err != nil {
+		d.logReq(method, request.Name).Warnf("Invalid options: %v", err)
+		json.NewEncoder(w).Encode(&volumeResponse{Err: err})
+		return
+	}
+	v, err := volume.Get(d.name)
+	if err != nil {
+		json.NewEncoder(w).Encode(&volumeResponse{Err: err})
+		return
+	}
+	start := time.Now()
+	locator := types.VolumeLocator{
+		Name:  request.Name,
+		Group: request.Opts[spec.GroupOpt],
+	}
+	id, err := volume.CreateCtx(r.Context(), v, locator, options, volSpec)
+	d.observe(r, "create", id, start, request, err)
+	if err != nil {
+		d.logReq(method, request.Name).Warnf("Cannot create volume: %v", err)
+		json.NewEncoder(w).Encode(&volumeResponse{Err: err})
+		return
+	}
+	d.logReq(method, request.Name).Infof("Created volume %v", id)
 	json.NewEncoder(w).Encode(&volumeResponse{})
 }
 
@@ -179,7 +236,9 @@ func (d *driver) mount(w http.ResponseWriter, r *http.Request) {
 
 	// If this is a block driver, first attach the volume.
 	if v.Type()&volume.Block != 0 {
-		attachPath, err := v.Attach(volInfo.vol.ID)
+		start := time.Now()
+		attachPath, err := volume.AttachCtx(r.Context(), v, volInfo.vol.ID, nil)
+		d.observe(r, "attach", volInfo.vol.ID, start, request, err)
 		if err != nil {
 			d.logReq(method, request.Name).Warnf("Cannot attach volume: %v", err.Error())
 			json.NewEncoder(w).Encode(&volumePathResponse{Err: err})
@@ -192,7 +251,9 @@ func (d *driver) mount(w http.ResponseWriter, r *http.Request) {
 	response.Mountpoint = path.Join(config.MountBase, request.Name)
 	os.MkdirAll(response.Mountpoint, 0755)
 
-	err = v.Mount(volInfo.vol.ID, response.Mountpoint)
+	start := time.Now()
+	err = volume.MountCtx(r.Context(), v, volInfo.vol.ID, response.Mountpoint)
+	d.observe(r, "mount", volInfo.vol.ID, start, request, err)
 	if err != nil {
 		d.logReq(method, request.Name).Warnf("Cannot mount volume %v, %v",
 			response.Mountpoint, err)
@@ -213,7 +274,8 @@ func (d *driver) path(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	volInfo, err := d.volFromName(request.Name)
+	// Path is called frequently by the container engine, serve it from cache.
+	volInfo, err := d.volFromNameAt(request.Name, types.ConsistencyCached)
 	if err != nil {
 		e := d.volNotFound(method, request.Name, err, w)
 		json.NewEncoder(w).Encode(&volumePathResponse{Err: e})
@@ -252,7 +314,9 @@ func (d *driver) unmount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	mountpoint := path.Join(config.MountBase, request.Name)
+	start := time.Now()
 	err = v.Unmount(volInfo.vol.ID, mountpoint)
+	d.observe(r, "unmount", volInfo.vol.ID, start, request, err)
 	if err != nil {
 		d.logReq(method, request.Name).Warnf("Cannot unmount volume %v, %v",
 			mountpoint, err)
@@ -261,7 +325,9 @@ func (d *driver) unmount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if v.Type()&volume.Block != 0 {
-		_ = v.Detach(volInfo.vol.ID)
+		start = time.Now()
+		err = volume.DetachCtx(r.Context(), v, volInfo.vol.ID)
+		d.observe(r, "detach", volInfo.vol.ID, start, request, err)
 	}
 	d.emptyResponse(w)
 }
@@ -0,0 +1,140 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// ManagerName is the name of the socket of the driver manager API.
+const ManagerName = "osd"
+
+// manager serves the endpoints that start and remove drivers on a running
+// daemon.
+type manager struct {
+	restBase
+	added   func(name string) error
+	removed func(name string)
+}
+
+func newManager(added func(name string) error, removed func(name string)) restServer {
+	return &manager{
+		restBase: restBase{version: apiVersion, name: ManagerName},
+		added:    added,
+		removed:  removed,
+	}
+}
+
+func (m *manager) String() string {
+	return m.name
+}
+
+// drivers lists the running driver instances.
+func (m *manager) drivers(w http.ResponseWriter, r *http.Request) {
+	var instances []api.DriverInstance
+	for _, name := range volume.Instances() {
+		if d, err := volume.DriverOf(name); err == nil {
+			instances = append(instances, api.DriverInstance{Name: name, Driver: d})
+		}
+	}
+	json.NewEncoder(w).Encode(instances)
+}
+
+// driverCreate starts a driver and serves its REST API.
+func (m *manager) driverCreate(w http.ResponseWriter, r *http.Request) {
+	var req api.DriverCreateRequest
+
+	method := "driverCreate"
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		m.sendError(m.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start := time.Now()
+	_, err := volume.New(req.Name, volume.DriverParams(req.Params))
+	if err == nil && m.added != nil {
+		if err = m.added(req.Name); err != nil {
+			volume.Disable(req.Name)
+		}
+	}
+	m.observe(r, "driverCreate", "", start, &req, err)
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(err))
+}
+
+// driverDelete stops serving a driver and shuts it down. The Force query
+// option removes drivers with volumes in use.
+func (m *manager) driverDelete(w http.ResponseWriter, r *http.Request) {
+	method := "driverDelete"
+	name := mux.Vars(r)["name"]
+	force := false
+	if v := r.URL.Query().Get(string(api.OptForce)); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			m.sendError(m.name, method, w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	start := time.Now()
+	err := volume.Remove(name, force)
+	if err == nil {
+		StopDriverAPI(name)
+		if m.removed != nil {
+			m.removed(name)
+		}
+	}
+	m.observe(r, "driverDelete", "", start, map[string]string{"name": name}, err)
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(err))
+}
+
+// bandwidth lists the bandwidth limits of background data movement.
+func (m *manager) bandwidth(w http.ResponseWriter, r *http.Request) {
+	limits := make(api.BandwidthLimits)
+	for class, limit := range volume.Bandwidths() {
+		limits[string(class)] = limit
+	}
+	json.NewEncoder(w).Encode(limits)
+}
+
+// bandwidthUpdate changes the bandwidth limits of the classes in the
+// request, the limits of other classes are left as they are.
+func (m *manager) bandwidthUpdate(w http.ResponseWriter, r *http.Request) {
+	var req api.BandwidthLimits
+
+	method := "bandwidthUpdate"
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		m.sendError(m.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start := time.Now()
+	for class, limit := range req {
+		volume.SetBandwidth(volume.BandwidthClass(class), limit)
+	}
+	m.observe(r, "bandwidthUpdate", "", start, &req, nil)
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(nil))
+}
+
+func (m *manager) Routes() []*Route {
+	return []*Route{
+		&Route{verb: "GET", path: version("drivers"), fn: m.drivers},
+		&Route{verb: "POST", path: version("drivers"), fn: m.driverCreate},
+		&Route{verb: "DELETE", path: version("drivers/{name}"), fn: m.driverDelete},
+		&Route{verb: "GET", path: version("bandwidth"), fn: m.bandwidth},
+		&Route{verb: "PUT", path: version("bandwidth"), fn: m.bandwidthUpdate},
+		&Route{verb: "GET", path: version("cluster/status"), fn: m.clusterStatus},
+		&Route{verb: "GET", path: version("cluster/nodes"), fn: m.clusterNodes},
+		&Route{verb: "GET", path: version("cluster/nodes/{id}"), fn: m.clusterNode},
+		&Route{verb: "DELETE", path: version("cluster/nodes/{id}"), fn: m.clusterNodeRemove},
+	}
+}
+
+// StartManagerAPI starts a REST server to start and remove drivers on the
+// running daemon. added is called to serve the API of a driver once it is
+// running and removed once it is shut down.
+func StartManagerAPI(port int, restBase string, added func(name string) error, removed func(name string)) error {
+	return startServer(ManagerName, restBase, port, newManager(added, removed))
+}
@@ -0,0 +1,190 @@
+package apiserver
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	limiter *RateLimiter
+	// unlimited paths serve probes and scrapers, which must not be turned
+	// away when a caller exceeds its limits.
+	unlimited = map[string]bool{"/health": true, "/metrics": true}
+)
+
+// SetRateLimiter limits the rate of requests to the REST servers started
+// afterwards.
+func SetRateLimiter(l *RateLimiter) {
+	limiter = l
+}
+
+type rate struct {
+	rate  float64
+	burst float64
+}
+
+type bucket struct {
+	rate
+	tokens float64
+	last   time.Time
+}
+
+// full returns true if b refilled to its burst by now, it is then the same
+// as a new bucket.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate.rate >= b.burst
+}
+
+// evictInterval between the evictions of the buckets of idle callers.
+const evictInterval = time.Minute
+
+// RateLimiter admits the requests of each caller, the authenticated
+// principal or "local" on the unix sockets, through token buckets. A caller
+// has one bucket for all its requests and one for each limited operation, a
+// route such as "POST /volumes", a request is admitted if all buckets
+// that apply to it have a token. Buckets of idle callers are evicted.
+type RateLimiter struct {
+	lock    sync.Mutex
+	limits  map[string]rate
+	buckets map[string]*bucket
+	evicted time.Time
+	now     func() time.Time
+}
+
+// NewRateLimiter returns a RateLimiter that admits all requests until limits
+// are set with Limit.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		limits:  make(map[string]rate),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Limit admits rate requests per second with bursts of up to burst requests
+// from each caller. The limit applies to each operation of method, such as
+// POST to create volumes or GET to enumerate them, to a single operation,
+// such as "POST /volumes", which takes precedence over the limit of
+// its method, or to all requests if method is "". A rate of 0 removes the
+// limit.
+func (l *RateLimiter) Limit(method string, r float64, burst int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	method = operation(method)
+	if r <= 0 {
+		delete(l.limits, method)
+		return
+	}
+	if burst < 1 {
+		burst = int(math.Ceil(r))
+	}
+	l.limits[method] = rate{rate: r, burst: float64(burst)}
+}
+
+// operation returns op, a method or a method and a route, with the method in
+// upper case.
+func operation(op string) string {
+	if i := strings.Index(op, " "); i >= 0 {
+		return strings.ToUpper(op[:i]) + op[i:]
+	}
+	return strings.ToUpper(op)
+}
+
+// Allow takes a token for a request of caller to op, the method and route of
+// the request such as "POST /volumes". If the request is not admitted
+// it returns false and how long to wait before retrying.
+func (l *RateLimiter) Allow(caller, op string) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	l.evict(now)
+
+	op = operation(op)
+	method := op
+	if i := strings.Index(op, " "); i >= 0 {
+		method = op[:i]
+	}
+	limits := make(map[string]rate, 2)
+	if r, ok := l.limits[""]; ok {
+		limits[""] = r
+	}
+	if r, ok := l.limits[op]; ok {
+		limits[op] = r
+	} else if r, ok := l.limits[method]; ok {
+		limits[op] = r
+	}
+
+	var admit []*bucket
+	var wait time.Duration
+	for m, r := range limits {
+		key := caller + " " + m
+		b, ok := l.buckets[key]
+		if !ok || b.rate != r {
+			b = &bucket{rate: r, tokens: r.burst, last: now}
+			l.buckets[key] = b
+		}
+		b.tokens = math.Min(r.burst, b.tokens+now.Sub(b.last).Seconds()*r.rate)
+		b.last = now
+		if b.tokens < 1 {
+			if w := time.Duration((1 - b.tokens) / r.rate * float64(time.Second)); w > wait {
+				wait = w
+			}
+			continue
+		}
+		admit = append(admit, b)
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, b := range admit {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// evict drops the buckets that refilled, at most every evictInterval.
+func (l *RateLimiter) evict(now time.Time) {
+	if now.Sub(l.evicted) < evictInterval {
+		return
+	}
+	l.evicted = now
+	for key, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// routeOperation returns the operation of the route to path with verb as
+// rate limits name it, without the API version, e.g. "POST /volumes".
+func routeOperation(verb, path string) string {
+	if p := strings.TrimPrefix(path, version("")); p != path {
+		path = "/" + p
+	}
+	return verb + " " + path
+}
+
+// rateLimit wraps h, serving op, so that requests not admitted by l are
+// rejected with 429.
+func rateLimit(l *RateLimiter, op string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unlimited[r.URL.Path] {
+			h.ServeHTTP(w, r)
+			return
+		}
+		caller := principal(r)
+		if ok, wait := l.Allow(caller, op); !ok {
+			log.Warnf("Rate limiting %s %s from %s", r.Method, r.URL, caller)
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,69 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter()
+	l.now = func() time.Time { return now }
+	l.Limit("", 10, 3)
+	l.Limit("post", 1, 1)
+
+	ok, _ := l.Allow("a", "POST /volumes")
+	assert.True(t, ok, "First create should be admitted")
+	ok, wait := l.Allow("a", "POST /volumes")
+	assert.False(t, ok, "Create above the method limit should be rejected")
+	assert.Equal(t, time.Second, wait, "Retry should wait for a token")
+	ok, _ = l.Allow("b", "POST /volumes")
+	assert.True(t, ok, "Callers should have their own buckets")
+	ok, _ = l.Allow("a", "POST /snapshot")
+	assert.True(t, ok, "Operations should have their own buckets")
+
+	ok, _ = l.Allow("a", "GET /volumes")
+	assert.True(t, ok, "Rejected requests should not take tokens")
+	ok, _ = l.Allow("a", "GET /volumes")
+	assert.False(t, ok, "Requests above the burst should be rejected")
+
+	now = now.Add(time.Second)
+	ok, _ = l.Allow("a", "POST /volumes")
+	assert.True(t, ok, "Tokens should be refilled over time")
+
+	// Operation limits take precedence over method limits.
+	l.Limit("POST /volumes", 10, 2)
+	now = now.Add(time.Second)
+	ok, _ = l.Allow("c", "POST /volumes")
+	assert.True(t, ok)
+	ok, _ = l.Allow("c", "POST /volumes")
+	assert.True(t, ok, "Operation limit should apply")
+
+	// Buckets of idle callers are evicted.
+	now = now.Add(evictInterval)
+	l.Allow("d", "GET /volumes")
+	assert.Equal(t, 1, len(l.buckets), "Idle buckets should be evicted")
+
+	h := rateLimit(l, "GET /volumes", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	codes := make(map[int]int)
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/v1/volumes", nil))
+		codes[w.Code]++
+	}
+	assert.Equal(t, 3, codes[http.StatusOK], "Burst should be admitted")
+	assert.Equal(t, 2, codes[http.StatusTooManyRequests], "Requests above the burst should be rejected")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "Health should not be limited")
+
+	assert.Equal(t, "POST /volumes/{id}", routeOperation("POST", volPath("/{id}")))
+	assert.Equal(t, "GET /health", routeOperation("GET", "/health"))
+}
@@ -1,16 +1,42 @@
 package apiserver
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"path"
+	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/audit"
+	"github.com/libopenstorage/openstorage/events"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/metrics"
+	"github.com/libopenstorage/openstorage/tracing"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+var (
+	netAuth Authenticator
+	netTLS  *tls.Config
 )
 
+// SetNetworkSecurity sets the Authenticator and, optionally, the TLS
+// configuration used by REST servers listening on a TCP port. The local unix
+// sockets are protected by filesystem permissions and are not authenticated.
+func SetNetworkSecurity(a Authenticator, tlsConfig *tls.Config) {
+	netAuth = a
+	netTLS = tlsConfig
+}
+
 // Route is a specification and  handler for a REST endpoint.
 type Route struct {
 	verb string
@@ -34,8 +60,7 @@ type restBase struct {
 }
 
 func (rest *restBase) logReq(request string, id string) *log.Entry {
-	return log.WithFields(log.Fields{
-		"Driver":  rest.name,
+	return logging.For(rest.name).WithFields(log.Fields{
 		"Request": request,
 		"ID":      id,
 	})
@@ -45,6 +70,50 @@ func (rest *restBase) sendError(request string, id string, w http.ResponseWriter
 	http.Error(w, msg, code)
 }
 
+// opEvents are the events published when driver operations succeed.
+var opEvents = map[string]api.EventType{
+	"create": api.EventVolumeCreated,
+	"delete": api.EventVolumeDeleted,
+	"attach": api.EventVolumeAttached,
+	"detach": api.EventVolumeDetached,
+}
+
+// observe records the outcome of a driver operation for metrics and in the
+// audit log, and publishes its event on success. params are the parameters
+// of the request r.
+func (rest *restBase) observe(r *http.Request,
+	op string,
+	id api.VolumeID,
+	start time.Time,
+	params interface{},
+	err error) {
+	metrics.Observe(rest.name, op, id, start, err)
+	logging.Op(rest.name, op, id, start, err)
+	audit.Record(principal(r), rest.name, op, id, params, err)
+	if t, ok := opEvents[op]; ok && err == nil {
+		events.Publish(api.Event{Type: t, Driver: rest.name, VolumeID: id})
+	}
+}
+
+// observeSnapshot observes the snapshot of volumeID like observe, and
+// publishes the EventSnapshotCompleted of snapID on success.
+func (rest *restBase) observeSnapshot(r *http.Request,
+	volumeID api.VolumeID,
+	snapID api.SnapID,
+	start time.Time,
+	params interface{},
+	err error) {
+	rest.observe(r, "snapshot", volumeID, start, params, err)
+	if err == nil {
+		events.Publish(api.Event{
+			Type:     api.EventSnapshotCompleted,
+			Driver:   rest.name,
+			VolumeID: volumeID,
+			SnapID:   snapID,
+		})
+	}
+}
+
 func (rest *restBase) notFound(w http.ResponseWriter, r *http.Request) {
 	log.Warnf("[%s] Not found: %+v ", rest.name, r.URL)
 	http.NotFound(w, r)
@@ -56,6 +125,84 @@ func (rest *restBase) volNotFound(request string, id string, e error, w http.Res
 	return err
 }
 
+// driverVersions returns the API versions the named driver can be served
+// with, those of the server if the driver is not running.
+func driverVersions(name string) api.VersionRange {
+	d, err := volume.Get(name)
+	if err != nil {
+		return api.VersionRange{Min: api.MinVersion, Max: api.Version}
+	}
+	return volume.APIVersions(d)
+}
+
+// requestVersion returns the API version of a request, empty for routes
+// that are not versioned.
+func requestVersion(r *http.Request) string {
+	return mux.Vars(r)["version"]
+}
+
+// checkVersion refuses requests of API versions the named driver does not
+// support.
+func checkVersion(name string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if v := requestVersion(r); v != "" {
+			versions := driverVersions(name)
+			if !versions.Contains(v) {
+				msg := fmt.Sprintf("API version %s is not supported, use %s to %s",
+					v, versions.Min, versions.Max)
+				log.Warnf("[%s] %s", name, msg)
+				http.Error(w, msg, http.StatusBadRequest)
+				return
+			}
+		}
+		fn(w, r)
+	}
+}
+
+var (
+	serversLock sync.Mutex
+	// servers of the REST APIs by driver name.
+	servers = make(map[string][]*http.Server)
+)
+
+func serve(name string, l net.Listener, h http.Handler) {
+	s := &http.Server{Handler: h}
+	serversLock.Lock()
+	servers[name] = append(servers[name], s)
+	serversLock.Unlock()
+	go s.Serve(l)
+}
+
+// Shutdown stops all REST servers started by StartDriverAPI and
+// StartPluginAPI and removes their sockets. Requests in progress are given
+// up to timeout to complete, the connections still open are then closed.
+func Shutdown(timeout time.Duration) {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for name, ss := range servers {
+		for _, s := range ss {
+			if err := s.Shutdown(ctx); err != nil {
+				log.Warnf("[%s] Closing the requests still in progress: %v", name, err)
+				s.Close()
+			}
+		}
+		delete(servers, name)
+	}
+}
+
+// StopDriverAPI stops the REST servers of driver name and removes their
+// sockets. Requests in progress are interrupted.
+func StopDriverAPI(name string) {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+	for _, s := range servers[name] {
+		s.Close()
+	}
+	delete(servers, name)
+}
+
 func startServer(name string, sockBase string, port int, rest restServer) error {
 
 	var (
@@ -67,22 +214,38 @@ func startServer(name string, sockBase string, port int, rest restServer) error
 	routes := rest.Routes()
 
 	for _, v := range routes {
-		router.Methods(v.verb).Path(v.path).HandlerFunc(v.fn)
+		h := tracing.Handler(v.verb+" "+v.path, checkVersion(name, v.fn))
+		if limiter != nil {
+			h = rateLimit(limiter, routeOperation(v.verb, v.path), h)
+		}
+		router.Methods(v.verb).Path(v.path).HandlerFunc(h.ServeHTTP)
 	}
+	var handler http.Handler = router
 	socket := path.Join(sockBase, name+".sock")
 	os.Remove(socket)
 	os.MkdirAll(path.Dir(socket), 0755)
 
-	log.Printf("Starting REST service on %+v", socket)
+	log.Infof("Starting REST service on %+v", socket)
 	listener, err = net.Listen("unix", socket)
 	if err != nil {
 		return err
 	}
-	go http.Serve(listener, router)
+	serve(name, listener, handler)
 	if port != 0 {
-		go http.ListenAndServe(fmt.Sprintf(":%v", port), router)
+		if netAuth == nil {
+			return errors.New("Refusing to serve the REST API on a TCP port without an authenticator")
+		}
+		tcp, err := net.Listen("tcp", fmt.Sprintf(":%v", port))
+		if err != nil {
+			return err
+		}
+		if netTLS != nil {
+			tcp = tls.NewListener(tcp, netTLS)
+		}
+		log.Infof("Starting REST service on %+v", tcp.Addr())
+		serve(name, tcp, authenticate(netAuth, handler))
 	}
-	return err
+	return nil
 }
 
 // StartDriverAPI starts a REST server to receive driver configuration commands
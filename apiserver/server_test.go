@@ -0,0 +1,37 @@
+package apiserver
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownDrains(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err, "Failed to listen") {
+		return
+	}
+	started := make(chan struct{})
+	serve("shutdown_test", l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	<-started
+	Shutdown(time.Second)
+	assert.NoError(t, <-done, "Request in progress should complete")
+
+	_, err = http.Get("http://" + l.Addr().String())
+	assert.Error(t, err, "Server should be stopped")
+}
@@ -1,18 +1,35 @@
 package apiserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
 
 	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/audit"
+	"github.com/libopenstorage/openstorage/cloudsnap"
+	"github.com/libopenstorage/openstorage/cluster"
+	"github.com/libopenstorage/openstorage/events"
+	"github.com/libopenstorage/openstorage/export"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/metrics"
+	"github.com/libopenstorage/openstorage/pkg/output"
+	"github.com/libopenstorage/openstorage/profile"
+	"github.com/libopenstorage/openstorage/quota"
 	"github.com/libopenstorage/openstorage/volume"
 )
 
 const (
-	apiVersion = "v1"
+	apiVersion = api.Version
 )
 
 type volDriver struct {
@@ -50,6 +67,42 @@ func (vd *volDriver) parseSnapID(r *http.Request) (api.SnapID, error) {
 	return api.BadSnapID, fmt.Errorf("could not parse snap ID")
 }
 
+// authorizedSnap returns snapID of d, or sends an error and returns nil if it
+// does not exist or the principal of r lacks access to the volume it was
+// taken of.
+func (vd *volDriver) authorizedSnap(method string,
+	w http.ResponseWriter,
+	r *http.Request,
+	d volume.VolumeDriver,
+	snapID api.SnapID,
+	access api.AccessType) *api.VolumeSnap {
+	snap, err := authorizeSnap(r, d, snapID, access)
+	switch err {
+	case nil:
+		return snap
+	case volume.ErrEnoEnt:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusForbidden)
+	}
+	return nil
+}
+
+// denied sends a Forbidden error and returns true if the principal of r
+// lacks access to volumeID of d.
+func (vd *volDriver) denied(method string,
+	w http.ResponseWriter,
+	r *http.Request,
+	d volume.VolumeDriver,
+	volumeID api.VolumeID,
+	access api.AccessType) bool {
+	if err := authorize(r, d, volumeID, access); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
 func (vd *volDriver) create(w http.ResponseWriter, r *http.Request) {
 	var dcRes api.VolumeCreateResponse
 	var dcReq api.VolumeCreateRequest
@@ -64,7 +117,32 @@ func (vd *volDriver) create(w http.ResponseWriter, r *http.Request) {
 		vd.notFound(w, r)
 		return
 	}
-	ID, err := d.Create(dcReq.Locator, dcReq.Options, dcReq.Spec)
+	// Clones carry the data of the snapshot to their owner.
+	if dcReq.Options != nil && dcReq.Options.CreateFromSnap != "" &&
+		vd.authorizedSnap(method, w, r, d, dcReq.Options.CreateFromSnap, api.AccessRead) == nil {
+		return
+	}
+	start := time.Now()
+	ID := api.BadVolumeID
+	spec, err := profile.Resolve(dcReq.Options, dcReq.Spec)
+	if err == nil {
+		ID, err = volume.CreateCtx(r.Context(), d, dcReq.Locator, dcReq.Options, spec)
+	}
+	if p := principal(r); err == nil && p != localPrincipal {
+		// Volumes created by remote principals belong to them.
+		if err = volume.Transfer(d, ID, p); err == volume.ErrNotSupported {
+			err = nil
+		} else if err != nil {
+			if derr := volume.DeleteCtx(context.Background(), d, ID); derr != nil {
+				log.Warnf("Failed to delete volume %v not transferred to %s: %v", ID, p, derr)
+			}
+			ID = api.BadVolumeID
+		}
+	}
+	vd.observe(r, "create", ID, start, &dcReq, err)
+	if verr, ok := err.(volume.ValidationError); ok {
+		dcRes.FieldErrors = verr
+	}
 	dcRes.VolumeResponse = api.VolumeResponse{Error: responseStatus(err)}
 	dcRes.ID = ID
 	json.NewEncoder(w).Encode(&dcRes)
@@ -95,23 +173,50 @@ func (vd *volDriver) volumeState(w http.ResponseWriter, r *http.Request) {
 		vd.notFound(w, r)
 		return
 	}
+	access := api.AccessWrite
+	if req.Attach == api.ParamOn && req.AttachOptions != nil && req.AttachOptions.ReadOnly &&
+		req.Mount == api.ParamIgnore && req.Format == api.ParamIgnore && req.Maintenance == api.ParamIgnore {
+		// Read-only attaches only need read access.
+		access = api.AccessRead
+	}
+	if vd.denied(method, w, r, d, volumeID, access) {
+		return
+	}
 	for {
+		if req.Maintenance != api.ParamIgnore {
+			start := time.Now()
+			err = volume.SetMaintenance(d, volumeID, req.Maintenance == api.ParamOn)
+			vd.observe(r, "maintenance", volumeID, start, &req, err)
+			if err != nil {
+				break
+			}
+			resp.Maintenance = req.Maintenance
+		}
 		if req.Format != api.ParamIgnore {
 			if req.Format == api.ParamOff {
 				err = fmt.Errorf("Invalid request to un-format")
 				break
 			}
-			err = d.Format(volumeID)
+			start := time.Now()
+			err = volume.FormatCtx(r.Context(), d, volumeID)
+			vd.observe(r, "format", volumeID, start, &req, err)
 			if err != nil {
 				break
 			}
 			resp.Format = api.ParamOn
 		}
 		if req.Attach != api.ParamIgnore {
+			start := time.Now()
 			if req.Attach == api.ParamOn {
-				resp.DevicePath, err = d.Attach(volumeID)
+				resp.DevicePath, err = volume.AttachCtx(r.Context(), d, volumeID, req.AttachOptions)
+				vd.observe(r, "attach", volumeID, start, &req, err)
 			} else {
-				err = d.Detach(volumeID)
+				if req.DetachOptions != nil {
+					err = volume.ForceDetach(r.Context(), d, volumeID, req.DetachOptions)
+				} else {
+					err = volume.DetachCtx(r.Context(), d, volumeID)
+				}
+				vd.observe(r, "detach", volumeID, start, &req, err)
 			}
 			if err != nil {
 				break
@@ -124,9 +229,17 @@ func (vd *volDriver) volumeState(w http.ResponseWriter, r *http.Request) {
 					err = fmt.Errorf("Invalid mount path")
 					break
 				}
-				err = d.Mount(volumeID, req.MountPath)
+				start := time.Now()
+				err = volume.MountWithOptions(r.Context(), d, volumeID, req.MountPath, req.MountOptions)
+				vd.observe(r, "mount", volumeID, start, &req, err)
 			} else {
-				err = d.Unmount(volumeID, req.MountPath)
+				start := time.Now()
+				if req.DetachOptions != nil {
+					err = volume.ForceUnmount(r.Context(), d, volumeID, req.MountPath, req.DetachOptions)
+				} else {
+					err = volume.UnmountCtx(r.Context(), d, volumeID, req.MountPath)
+				}
+				vd.observe(r, "unmount", volumeID, start, &req, err)
 			}
 			if err != nil {
 				break
@@ -158,7 +271,10 @@ func (vd *volDriver) inspect(w http.ResponseWriter, r *http.Request) {
 		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
 		return
 	}
-	dk, err := d.Inspect([]api.VolumeID{volumeID})
+	if vd.denied(method, w, r, d, volumeID, api.AccessRead) {
+		return
+	}
+	dk, err := volume.InspectCtx(r.Context(), d, []api.VolumeID{volumeID})
 	if err != nil {
 		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
 		return
@@ -183,8 +299,20 @@ func (vd *volDriver) delete(w http.ResponseWriter, r *http.Request) {
 		vd.notFound(w, r)
 		return
 	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessOwner) {
+		return
+	}
 
-	err = d.Delete(volumeID)
+	start := time.Now()
+	if trash, terr := volume.GetTrash(vd.name); terr == nil {
+		err = trash.Delete(volumeID)
+	} else {
+		err = volume.DeleteCtx(r.Context(), d, volumeID)
+	}
+	vd.observe(r, "delete", volumeID, start, nil, err)
+	if err == nil {
+		metrics.Forget(vd.name, volumeID)
+	}
 	res := api.ResponseStatusNew(err)
 	json.NewEncoder(w).Encode(res)
 }
@@ -207,6 +335,9 @@ func (vd *volDriver) enumerate(w http.ResponseWriter, r *http.Request) {
 	if v != nil {
 		locator.Name = v[0]
 	}
+	if g := params.Get(string(api.OptGroup)); g != "" {
+		locator.Group = g
+	}
 	v = params[string(api.OptLabel)]
 	if v != nil {
 		if err = json.Unmarshal([]byte(v[0]), &locator.VolumeLabels); err != nil {
@@ -221,22 +352,106 @@ func (vd *volDriver) enumerate(w http.ResponseWriter, r *http.Request) {
 			vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
 		}
 	}
+	opts, err := parseEnumerateOptions(params)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := output.ParseFilter(params.Get(string(api.OptFilter)))
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := output.ParseFormat(params.Get(string(api.OptFormat)))
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	consistency := api.ConsistencyStrong
+	v = params[string(api.OptConsistency)]
+	if v != nil {
+		consistency = api.Consistency(v[0])
+	}
+	var next string
 	v = params[string(api.OptVolumeID)]
 	if v != nil {
 		ids := make([]api.VolumeID, len(v))
 		for i, s := range v {
 			ids[i] = api.VolumeID(s)
 		}
-		vols, err = d.Inspect(ids)
+		vols, err = volume.InspectAt(d, ids, consistency)
 		if err != nil {
 			e := fmt.Errorf("Failed to inspect volumeID: %s", err.Error())
 			vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
 			return
 		}
+	} else if opts != nil && consistency == api.ConsistencyStrong && len(filter) == 0 {
+		vols, next, err = volume.EnumeratePage(d, locator, configLabels, opts)
+		if err != nil {
+			vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		vd.writeVolumes(w, format, readable(r, vols), next, true)
+		return
 	} else {
-		vols, _ = d.Enumerate(locator, configLabels)
+		vols, _ = volume.EnumerateAt(d, locator, configLabels, consistency)
+	}
+	vols = readable(r, filter.Apply(vols))
+	if opts != nil {
+		vols, next, err = volume.PageVolumes(vols, opts)
+		if err != nil {
+			vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	vd.writeVolumes(w, format, vols, next, opts != nil)
+}
+
+// writeVolumes writes an enumerate response in format. Paged JSON responses
+// are a VolumeEnumerateResponse, other formats carry the token of the next
+// page in the Next-Token header.
+func (vd *volDriver) writeVolumes(w http.ResponseWriter,
+	format output.Format,
+	vols []api.Volume,
+	next string,
+	paged bool) {
+	if format == output.JSON {
+		if paged {
+			json.NewEncoder(w).Encode(&api.VolumeEnumerateResponse{Volumes: vols, NextToken: next})
+		} else {
+			json.NewEncoder(w).Encode(vols)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", output.ContentTypes[format])
+	if next != "" {
+		w.Header().Set("Next-Token", next)
+	}
+	if err := output.Write(w, format, vols); err != nil {
+		vd.logReq("enumerate", "").Warnf("Failed to write volumes: %v", err)
+	}
+}
+
+// parseEnumerateOptions returns the pagination options of an enumerate
+// request, or nil if the request is not paginated.
+func parseEnumerateOptions(params url.Values) (*api.EnumerateOptions, error) {
+	limit := params.Get(string(api.OptLimit))
+	token := params.Get(string(api.OptToken))
+	if limit == "" && token == "" {
+		return nil, nil
+	}
+	opts := &api.EnumerateOptions{
+		Token:  token,
+		SortBy: api.SortKey(params.Get(string(api.OptSort))),
+	}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid limit %q", limit)
+		}
+		opts.Limit = n
 	}
-	json.NewEncoder(w).Encode(vols)
+	return opts, nil
 }
 
 func (vd *volDriver) snap(w http.ResponseWriter, r *http.Request) {
@@ -253,12 +468,187 @@ func (vd *volDriver) snap(w http.ResponseWriter, r *http.Request) {
 		vd.notFound(w, r)
 		return
 	}
-	ID, err := d.Snapshot(snapReq.ID, snapReq.Labels)
+	if vd.denied(method, w, r, d, snapReq.ID, api.AccessWrite) {
+		return
+	}
+	start := time.Now()
+	ID, err := volume.SnapshotCtx(r.Context(), d, snapReq.ID, snapReq.Labels, snapReq.Writable)
+	vd.observeSnapshot(r, snapReq.ID, ID, start, &snapReq, err)
 	snapRes.VolumeResponse = api.VolumeResponse{Error: responseStatus(err)}
 	snapRes.ID = ID
 	json.NewEncoder(w).Encode(&snapRes)
 }
 
+// snapGroup snapshots all the volumes of a group.
+func (vd *volDriver) snapGroup(w http.ResponseWriter, r *http.Request) {
+	var snapReq api.GroupSnapCreateRequest
+	var snapRes api.GroupSnapCreateResponse
+	method := "snapGroup"
+
+	if err := json.NewDecoder(r.Body).Decode(&snapReq); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if p := principal(r); p != localPrincipal {
+		vols, _ := d.Enumerate(api.VolumeLocator{Group: snapReq.Group}, nil)
+		for i := range vols {
+			if err = volume.Authorize(&vols[i], p, api.AccessWrite); err != nil {
+				vd.sendError(vd.name, method, w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+	}
+	snaps, err := volume.SnapshotGroup(r.Context(), d, snapReq.Group, snapReq.Labels)
+	for volumeID, snapID := range snaps {
+		vd.observeSnapshot(r, volumeID, snapID, time.Now(), &snapReq, nil)
+	}
+	snapRes.VolumeResponse = api.VolumeResponse{Error: responseStatus(err)}
+	snapRes.Snaps = snaps
+	json.NewEncoder(w).Encode(&snapRes)
+}
+
+// maxBulkVolumes bounds the volumes of a bulk request.
+const maxBulkVolumes = 1000
+
+// decodeBulk decodes the bulk request of r, it sends an error and returns
+// false if the request is invalid.
+func (vd *volDriver) decodeBulk(method string,
+	w http.ResponseWriter,
+	r *http.Request,
+	req *api.VolumeBulkRequest) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if len(req.IDs) > maxBulkVolumes {
+		e := fmt.Errorf("Too many volumes: %d, at most %d", len(req.IDs), maxBulkVolumes)
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// bulkErrors sets the errors of the volumes a bulk operation failed on.
+func bulkErrors(res *api.VolumeBulkResponse, err error) {
+	failed, ok := err.(volume.BulkError)
+	if !ok {
+		res.VolumeResponse = api.VolumeResponse{Error: responseStatus(err)}
+		return
+	}
+	res.Errors = make(map[api.VolumeID]string, len(failed))
+	for id, e := range failed {
+		res.Errors[id] = e.Error()
+	}
+}
+
+// bulkDelete deletes many volumes.
+func (vd *volDriver) bulkDelete(w http.ResponseWriter, r *http.Request) {
+	var req api.VolumeBulkRequest
+	var res api.VolumeBulkResponse
+	method := "bulkDelete"
+
+	if !vd.decodeBulk(method, w, r, &req) {
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	trash, terr := volume.GetTrash(vd.name)
+	err = volume.Bulk(r.Context(), req.IDs, func(ctx context.Context, id api.VolumeID) error {
+		if err := authorize(r, d, id, api.AccessOwner); err != nil {
+			return err
+		}
+		start := time.Now()
+		var err error
+		if terr == nil {
+			err = trash.Delete(id)
+		} else {
+			err = volume.DeleteCtx(ctx, d, id)
+		}
+		vd.observe(r, "delete", id, start, nil, err)
+		if err == nil {
+			metrics.Forget(vd.name, id)
+		}
+		return err
+	})
+	bulkErrors(&res, err)
+	json.NewEncoder(w).Encode(&res)
+}
+
+// bulkSnap snapshots many volumes.
+func (vd *volDriver) bulkSnap(w http.ResponseWriter, r *http.Request) {
+	var req api.VolumeBulkRequest
+	var res api.VolumeBulkResponse
+	method := "bulkSnap"
+
+	if !vd.decodeBulk(method, w, r, &req) {
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	var lock sync.Mutex
+	res.Snaps = make(map[api.VolumeID]api.SnapID, len(req.IDs))
+	err = volume.Bulk(r.Context(), req.IDs, func(ctx context.Context, id api.VolumeID) error {
+		if err := authorize(r, d, id, api.AccessWrite); err != nil {
+			return err
+		}
+		start := time.Now()
+		snapID, err := volume.SnapshotCtx(ctx, d, id, req.Labels, req.Writable)
+		vd.observeSnapshot(r, id, snapID, start, &req, err)
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		res.Snaps[id] = snapID
+		return nil
+	})
+	bulkErrors(&res, err)
+	json.NewEncoder(w).Encode(&res)
+}
+
+// bulkInspect inspects many volumes.
+func (vd *volDriver) bulkInspect(w http.ResponseWriter, r *http.Request) {
+	var req api.VolumeBulkRequest
+	var res api.VolumeBulkResponse
+	method := "bulkInspect"
+
+	if !vd.decodeBulk(method, w, r, &req) {
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	vols, err := volume.InspectMany(r.Context(), d, req.IDs)
+	res.Volumes = readable(r, vols)
+	if len(res.Volumes) != len(vols) {
+		failed, _ := err.(volume.BulkError)
+		if failed == nil {
+			failed = make(volume.BulkError)
+		}
+		for i := range vols {
+			if e := volume.Authorize(&vols[i], principal(r), api.AccessRead); e != nil {
+				failed[vols[i].ID] = e
+			}
+		}
+		err = failed
+	}
+	bulkErrors(&res, err)
+	json.NewEncoder(w).Encode(&res)
+}
+
 func (vd *volDriver) snapDelete(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var snapID api.SnapID
@@ -274,7 +664,12 @@ func (vd *volDriver) snapDelete(w http.ResponseWriter, r *http.Request) {
 		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
 		return
 	}
-	err = d.SnapDelete(snapID)
+	if vd.authorizedSnap(method, w, r, d, snapID, api.AccessWrite) == nil {
+		return
+	}
+	start := time.Now()
+	err = volume.SnapDeleteCtx(r.Context(), d, snapID)
+	vd.observe(r, "snapdelete", "", start, map[string]api.SnapID{"snapID": snapID}, err)
 	if err != nil {
 		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
 		return
@@ -283,6 +678,36 @@ func (vd *volDriver) snapDelete(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(api.VolumeResponse{Error: responseStatus(err)})
 }
 
+// snapProtect pins or unpins a snapshot.
+func (vd *volDriver) snapProtect(w http.ResponseWriter, r *http.Request) {
+	var req api.SnapProtectRequest
+	method := "snapProtect"
+
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	snapID, err := vd.parseSnapID(r)
+	if err != nil {
+		e := fmt.Errorf("Failed to parse SnapID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	snap := vd.authorizedSnap(method, w, r, d, snapID, api.AccessWrite)
+	if snap == nil {
+		return
+	}
+	start := time.Now()
+	err = volume.ProtectSnap(d, snapID, req.Protected)
+	vd.observe(r, "snapprotect", snap.VolumeID, start, &req, err)
+	json.NewEncoder(w).Encode(api.VolumeResponse{Error: responseStatus(err)})
+}
+
 func (vd *volDriver) snapInspect(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var snapID api.SnapID
@@ -298,6 +723,9 @@ func (vd *volDriver) snapInspect(w http.ResponseWriter, r *http.Request) {
 		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
 		return
 	}
+	if vd.authorizedSnap(method, w, r, d, snapID, api.AccessRead) == nil {
+		return
+	}
 	dk, err := d.SnapInspect([]api.SnapID{snapID})
 	if err != nil {
 		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
@@ -307,6 +735,133 @@ func (vd *volDriver) snapInspect(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(dk)
 }
 
+// snapDiff streams the changes from the snapshot in the FromSnapID query
+// option to the snapshot in the path, in the pkg/diff format.
+func (vd *volDriver) snapDiff(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var snapID api.SnapID
+
+	method := "snapDiff"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if snapID, err = vd.parseSnapID(r); err != nil {
+		e := fmt.Errorf("Failed to parse SnapID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	from := api.SnapID(r.URL.Query().Get(string(api.OptFromSnapID)))
+	if vd.authorizedSnap(method, w, r, d, snapID, api.AccessRead) == nil ||
+		(from != "" && vd.authorizedSnap(method, w, r, d, from, api.AccessRead) == nil) {
+		return
+	}
+	diff, err := volume.SnapDiff(d, from, snapID)
+	switch err {
+	case nil:
+	case volume.ErrEnoEnt:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	case volume.ErrEinval:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	case volume.ErrNotSupported:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer diff.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	// Diffs feed backups, they are streamed within the backup bandwidth.
+	out := volume.ThrottleWriter(r.Context(), volume.BandwidthBackup, w)
+	if _, err = io.Copy(out, diff); err != nil {
+		log.Warnf("Failed to stream the diff of snapshot %v: %v", snapID, err)
+	}
+}
+
+// snapExport exports a snapshot to an object store.
+func (vd *volDriver) snapExport(w http.ResponseWriter, r *http.Request) {
+	var req api.SnapExportRequest
+	var snapID api.SnapID
+	var err error
+
+	method := "snapExport"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if snapID, err = vd.parseSnapID(r); err != nil {
+		e := fmt.Errorf("Failed to parse SnapID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Exports carry the data of the volume out of the cluster.
+	snap := vd.authorizedSnap(method, w, r, d, snapID, api.AccessWrite)
+	if snap == nil {
+		return
+	}
+	start := time.Now()
+	archive, err := volume.ExportSnap(r.Context(), d, snapID, req.Location)
+	vd.observe(r, "snapexport", snap.VolumeID, start, &req, err)
+	switch err {
+	case nil:
+	case volume.ErrEnoEnt:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	case volume.ErrNotSupported:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(archive)
+}
+
+// snapImport creates a volume from a snapshot exported to an object store.
+func (vd *volDriver) snapImport(w http.ResponseWriter, r *http.Request) {
+	var req api.SnapImportRequest
+	var res api.VolumeCreateResponse
+	method := "snapImport"
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	start := time.Now()
+	ID, err := volume.ImportSnap(r.Context(), d, req.Location, req.Locator)
+	if p := principal(r); err == nil && p != localPrincipal {
+		if err = volume.Transfer(d, ID, p); err == volume.ErrNotSupported {
+			err = nil
+		} else if err != nil {
+			if derr := volume.DeleteCtx(context.Background(), d, ID); derr != nil {
+				log.Warnf("Failed to delete volume %v not transferred to %s: %v", ID, p, derr)
+			}
+			ID = api.BadVolumeID
+		}
+	}
+	vd.observe(r, "snapimport", ID, start, &req, err)
+	if verr, ok := err.(volume.ValidationError); ok {
+		res.FieldErrors = verr
+	}
+	res.VolumeResponse = api.VolumeResponse{Error: responseStatus(err)}
+	res.ID = ID
+	json.NewEncoder(w).Encode(&res)
+}
+
 func (vd *volDriver) snapEnumerate(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var labels api.Labels
@@ -328,6 +883,12 @@ func (vd *volDriver) snapEnumerate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	opts, err := parseEnumerateOptions(params)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	v, ok := params[string(api.OptSnapID)]
 	if ok && v != nil {
 		sids := make([]api.SnapID, len(params))
@@ -349,6 +910,18 @@ func (vd *volDriver) snapEnumerate(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		if opts != nil {
+			var next string
+			snaps, next, err = volume.SnapEnumeratePage(d, ids, labels, opts)
+			if err != nil {
+				e := fmt.Errorf("Failed to enumerate snaps: %s", err.Error())
+				vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+				return
+			}
+			snaps = readableSnaps(r, d, snaps)
+			json.NewEncoder(w).Encode(&api.SnapEnumerateResponse{Snaps: snaps, NextToken: next})
+			return
+		}
 		snaps, err = d.SnapEnumerate(ids, labels)
 		if err != nil {
 			e := fmt.Errorf("Failed to enumerate snaps: %s", err.Error())
@@ -357,17 +930,1099 @@ func (vd *volDriver) snapEnumerate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	json.NewEncoder(w).Encode(snaps)
+	json.NewEncoder(w).Encode(readableSnaps(r, d, snaps))
 }
 
-func (vd *volDriver) stats(w http.ResponseWriter, r *http.Request) {
-}
+func (vd *volDriver) graph(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
 
-func (vd *volDriver) alerts(w http.ResponseWriter, r *http.Request) {
+	method := "graph"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessRead) {
+		return
+	}
+	g, err := volume.Graph(d, volumeID)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(g)
+}
+
+func (vd *volDriver) catalog(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
+
+	method := "catalog"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessRead) {
+		return
+	}
+	p := r.URL.Query().Get(string(api.OptPath))
+	entries, err := volume.Catalog(d, volumeID, p)
+	switch err {
+	case nil:
+	case volume.ErrEnoEnt:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	case volume.ErrEinval:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	case volume.ErrNotSupported:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+// fingerprint hashes the content of a volume, reusing the hashes of the
+// snapshot in the BaseSnapID query option.
+func (vd *volDriver) fingerprint(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
+
+	method := "fingerprint"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessRead) {
+		return
+	}
+	base := api.SnapID(r.URL.Query().Get(string(api.OptBaseSnapID)))
+	f, err := volume.Fingerprint(d, volumeID, base)
+	switch err {
+	case nil:
+	case volume.ErrEnoEnt:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	case volume.ErrEinval:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	case volume.ErrNotSupported:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(f)
+}
+
+// mounts lists the paths a volume is mounted at and the processes using
+// them.
+func (vd *volDriver) mounts(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
+
+	method := "mounts"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessRead) {
+		return
+	}
+	mounts, err := volume.Mounts(d, volumeID)
+	switch err {
+	case nil:
+	case volume.ErrEnoEnt:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(mounts)
+}
+
+func (vd *volDriver) restore(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
+
+	method := "restore"
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	trash, err := volume.GetTrash(vd.name)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessOwner) {
+		return
+	}
+	start := time.Now()
+	err = trash.Restore(volumeID)
+	vd.observe(r, "restore", volumeID, start, nil, err)
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(err))
+}
+
+func (vd *volDriver) resize(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var req api.VolumeResizeRequest
+	var err error
+
+	method := "resize"
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessWrite) {
+		return
+	}
+	start := time.Now()
+	err = volume.Resize(d, volumeID, req.Size)
+	vd.observe(r, "resize", volumeID, start, &req, err)
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(err))
+}
+
+func (vd *volDriver) health(w http.ResponseWriter, r *http.Request) {
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(volume.CheckHealth(r.Context(), vd.name, d))
+}
+
+// status reports the diagnostic status of the driver, including the depth
+// of its operation queues and the number of failed operations.
+func (vd *volDriver) status(w http.ResponseWriter, r *http.Request) {
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	status := volume.Status(d)
+	status.Errors = metrics.Errors(vd.name)
+	if requestVersion(r) == "v1" {
+		// v1 reported the status as key value pairs.
+		json.NewEncoder(w).Encode(status.Details)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// versions reports the API versions the driver can be served with.
+func (vd *volDriver) versions(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(driverVersions(vd.name))
+}
+
+// clusterCapacity reports the capacity of the drivers of all nodes and the
+// space provisioned to their volumes.
+func (vd *volDriver) clusterCapacity(w http.ResponseWriter, r *http.Request) {
+	method := "clusterCapacity"
+	cm, err := cluster.Inst()
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	capacity, err := cm.Capacity()
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(capacity)
+}
+
+// healthAll reports the health of all drivers. It fails with 503 if a driver
+// is down, so that it can back load balancer and orchestrator probes.
+func (vd *volDriver) healthAll(w http.ResponseWriter, r *http.Request) {
+	resp := volume.Health(r.Context())
+	if resp.State == api.HealthDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(&resp)
+}
+
+// events streams the events of the cluster and of the volumes of this
+// driver as server-sent events until the client disconnects. The type query
+// option, which may be repeated, selects the events to stream.
+func (vd *volDriver) events(w http.ResponseWriter, r *http.Request) {
+	method := "events"
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		vd.sendError(vd.name, method, w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	var types []api.EventType
+	for _, t := range r.URL.Query()["type"] {
+		types = append(types, api.EventType(t))
+	}
+	sub := events.Subscribe(types...)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if e.Driver != "" && e.Driver != vd.name {
+				continue
+			}
+			b, err := json.Marshal(&e)
+			if err != nil {
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (vd *volDriver) profileError(method string, w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if err == profile.ErrNotFound {
+		code = http.StatusNotFound
+	}
+	vd.sendError(vd.name, method, w, err.Error(), code)
+}
+
+func (vd *volDriver) profiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := profile.Enumerate()
+	if err != nil {
+		vd.profileError("profiles", w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(profiles)
+}
+
+func (vd *volDriver) profileInspect(w http.ResponseWriter, r *http.Request) {
+	p, err := profile.Get(mux.Vars(r)["name"])
+	if err != nil {
+		vd.profileError("profileInspect", w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(p)
+}
+
+// profileCreate creates or replaces a profile. Profiles apply to the volumes
+// of every principal, only the local principal may write them.
+func (vd *volDriver) profileCreate(w http.ResponseWriter, r *http.Request) {
+	var p api.VolumeProfile
+	method := "profileCreate"
+
+	if principal(r) != localPrincipal {
+		vd.sendError(vd.name, method, w, volume.ErrPermission.Error(), http.StatusForbidden)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start := time.Now()
+	err := profile.Put(&p)
+	vd.observe(r, "profilecreate", "", start, &p, err)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(&p)
+}
+
+// profileDelete deletes a profile, only the local principal may.
+func (vd *volDriver) profileDelete(w http.ResponseWriter, r *http.Request) {
+	method := "profileDelete"
+	if principal(r) != localPrincipal {
+		vd.sendError(vd.name, method, w, volume.ErrPermission.Error(), http.StatusForbidden)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	start := time.Now()
+	err := profile.Delete(name)
+	vd.observe(r, "profiledelete", "", start, map[string]string{"name": name}, err)
+	if err != nil {
+		vd.profileError(method, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(nil))
+}
+
+func (vd *volDriver) quotaError(method string, w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if err == quota.ErrNotFound {
+		code = http.StatusNotFound
+	}
+	vd.sendError(vd.name, method, w, err.Error(), code)
+}
+
+func (vd *volDriver) quotas(w http.ResponseWriter, r *http.Request) {
+	quotas, err := quota.Enumerate()
+	if err != nil {
+		vd.quotaError("quotas", w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(quotas)
+}
+
+func (vd *volDriver) quotaInspect(w http.ResponseWriter, r *http.Request) {
+	q, err := quota.Get(mux.Vars(r)["tenant"])
+	if err != nil {
+		vd.quotaError("quotaInspect", w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(q)
+}
+
+func (vd *volDriver) quotaCreate(w http.ResponseWriter, r *http.Request) {
+	var q api.Quota
+	method := "quotaCreate"
+
+	if principal(r) != localPrincipal {
+		vd.sendError(vd.name, method, w, volume.ErrPermission.Error(), http.StatusForbidden)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := quota.Put(&q); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(&q)
+}
+
+func (vd *volDriver) quotaDelete(w http.ResponseWriter, r *http.Request) {
+	if principal(r) != localPrincipal {
+		vd.sendError(vd.name, "quotaDelete", w, volume.ErrPermission.Error(), http.StatusForbidden)
+		return
+	}
+	if err := quota.Delete(mux.Vars(r)["tenant"]); err != nil {
+		vd.quotaError("quotaDelete", w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(nil))
+}
+
+func (vd *volDriver) cloudSnapError(method string, w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch err {
+	case cloudsnap.ErrNotFound, volume.ErrEnoEnt:
+		code = http.StatusNotFound
+	case cloudsnap.ErrRunning, cloudsnap.ErrIncomplete:
+		code = http.StatusConflict
+	case volume.ErrNotSupported:
+		code = http.StatusNotImplemented
+	case volume.ErrPermission:
+		code = http.StatusForbidden
+	}
+	vd.sendError(vd.name, method, w, err.Error(), code)
+}
+
+// cloudSnapUpload starts uploading a snapshot to an object store.
+func (vd *volDriver) cloudSnapUpload(w http.ResponseWriter, r *http.Request) {
+	var req api.CloudSnapRequest
+	method := "cloudSnapUpload"
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	snaps, err := d.SnapInspect([]api.SnapID{req.SnapID})
+	if err != nil || len(snaps) == 0 {
+		vd.cloudSnapError(method, w, volume.ErrEnoEnt)
+		return
+	}
+	if vd.denied(method, w, r, d, snaps[0].VolumeID, api.AccessWrite) {
+		return
+	}
+	start := time.Now()
+	cs, err := cloudsnap.Upload(vd.name, &req)
+	vd.observe(r, "cloudsnap", snaps[0].VolumeID, start, &req, err)
+	if err != nil {
+		vd.cloudSnapError(method, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(cs)
+}
+
+// cloudSnaps lists the cloud snapshots, of the volume in the VolumeID query
+// option if set.
+func (vd *volDriver) cloudSnaps(w http.ResponseWriter, r *http.Request) {
+	volumeID := api.VolumeID(r.URL.Query().Get(string(api.OptVolumeID)))
+	snaps, err := cloudsnap.Enumerate(volumeID)
+	if err != nil {
+		vd.cloudSnapError("cloudSnaps", w, err)
+		return
+	}
+	allowed := make([]api.CloudSnap, 0, len(snaps))
+	for i := range snaps {
+		if authorizeCloudSnap(r, &snaps[i], api.AccessRead) == nil {
+			allowed = append(allowed, snaps[i])
+		}
+	}
+	json.NewEncoder(w).Encode(allowed)
+}
+
+// authorizedCloudSnap returns the cloud snapshot id, or sends an error and
+// returns nil if it does not exist or the principal of r lacks access to it.
+func (vd *volDriver) authorizedCloudSnap(method string,
+	w http.ResponseWriter,
+	r *http.Request,
+	id string,
+	access api.AccessType) *api.CloudSnap {
+	cs, err := cloudsnap.Inspect(id)
+	if err == nil {
+		err = authorizeCloudSnap(r, cs, access)
+	}
+	if err != nil {
+		vd.cloudSnapError(method, w, err)
+		return nil
+	}
+	return cs
+}
+
+func (vd *volDriver) cloudSnapInspect(w http.ResponseWriter, r *http.Request) {
+	cs := vd.authorizedCloudSnap("cloudSnapInspect", w, r, mux.Vars(r)["id"], api.AccessRead)
+	if cs == nil {
+		return
+	}
+	json.NewEncoder(w).Encode(cs)
+}
+
+// cloudSnapResume resumes a failed or interrupted upload on this node.
+func (vd *volDriver) cloudSnapResume(w http.ResponseWriter, r *http.Request) {
+	method := "cloudSnapResume"
+	id := mux.Vars(r)["id"]
+	if vd.authorizedCloudSnap(method, w, r, id, api.AccessWrite) == nil {
+		return
+	}
+	cs, err := cloudsnap.Resume(id)
+	if err != nil {
+		vd.cloudSnapError(method, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(cs)
+}
+
+// cloudSnapRestore creates a volume from a cloud snapshot.
+func (vd *volDriver) cloudSnapRestore(w http.ResponseWriter, r *http.Request) {
+	var req api.CloudSnapRestoreRequest
+	var res api.VolumeCreateResponse
+	method := "cloudSnapRestore"
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	// Restored volumes carry the data of the backup to their owner.
+	if vd.authorizedCloudSnap(method, w, r, mux.Vars(r)["id"], api.AccessRead) == nil {
+		return
+	}
+	start := time.Now()
+	ID, err := cloudsnap.Restore(r.Context(), d, mux.Vars(r)["id"], req.Locator)
+	if p := principal(r); err == nil && p != localPrincipal {
+		if err = volume.Transfer(d, ID, p); err == volume.ErrNotSupported {
+			err = nil
+		} else if err != nil {
+			if derr := volume.DeleteCtx(context.Background(), d, ID); derr != nil {
+				log.Warnf("Failed to delete volume %v not transferred to %s: %v", ID, p, derr)
+			}
+			ID = api.BadVolumeID
+		}
+	}
+	vd.observe(r, "cloudsnaprestore", ID, start, &req, err)
+	if verr, ok := err.(volume.ValidationError); ok {
+		res.FieldErrors = verr
+	}
+	res.VolumeResponse = api.VolumeResponse{Error: responseStatus(err)}
+	res.ID = ID
+	json.NewEncoder(w).Encode(&res)
+}
+
+// cloudSnapDelete deletes a cloud snapshot and its objects.
+func (vd *volDriver) cloudSnapDelete(w http.ResponseWriter, r *http.Request) {
+	method := "cloudSnapDelete"
+	id := mux.Vars(r)["id"]
+	cs := vd.authorizedCloudSnap(method, w, r, id, api.AccessOwner)
+	if cs == nil {
+		return
+	}
+	start := time.Now()
+	err := cloudsnap.Delete(id)
+	vd.observe(r, "cloudsnapdelete", cs.VolumeID, start, nil, err)
+	if err != nil {
+		vd.cloudSnapError(method, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(nil))
+}
+
+func (vd *volDriver) trashed(w http.ResponseWriter, r *http.Request) {
+	method := "trash"
+	trash, err := volume.GetTrash(vd.name)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	vols, err := trash.Trashed()
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(readable(r, vols))
+}
+
+// rebalance starts moving volumes between the backends of the driver.
+func (vd *volDriver) rebalance(w http.ResponseWriter, r *http.Request) {
+	var req api.RebalanceRequest
+
+	method := "rebalance"
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rb, err := volume.GetRebalancer(vd.name)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	job, err := rb.Start(req)
+	if err == volume.ErrRebalanceRunning {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(&job)
+}
+
+// rebalanceJob reports the progress of the running or last rebalance.
+func (vd *volDriver) rebalanceJob(w http.ResponseWriter, r *http.Request) {
+	method := "rebalanceJob"
+	rb, err := volume.GetRebalancer(vd.name)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	job, err := rb.Job()
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(&job)
+}
+
+func (vd *volDriver) rebalanceCancel(w http.ResponseWriter, r *http.Request) {
+	method := "rebalanceCancel"
+	rb, err := volume.GetRebalancer(vd.name)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(rb.Cancel()))
+}
+
+// orphans lists the storage of the driver that no volume references.
+func (vd *volDriver) orphans(w http.ResponseWriter, r *http.Request) {
+	method := "orphans"
+	gc, err := volume.GetGC(vd.name)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	orphans, err := gc.Orphans()
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(orphans)
+}
+
+// collectGarbage reports or reclaims the orphans of the driver. Only local
+// requests may reclaim orphans, which belong to no tenant.
+func (vd *volDriver) collectGarbage(w http.ResponseWriter, r *http.Request) {
+	var req api.GCRequest
+
+	method := "collectGarbage"
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gc, err := volume.GetGC(vd.name)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if principal(r) != localPrincipal && req.Policy != api.GCReport {
+		vd.sendError(vd.name, method, w, volume.ErrPermission.Error(), http.StatusForbidden)
+		return
+	}
+	start := time.Now()
+	orphans, err := gc.Collect(req.Policy)
+	vd.observe(r, "gc", "", start, &req, err)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(orphans)
+}
+
+func (vd *volDriver) auditQuery(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	method := "audit"
+	params := r.URL.Query()
+	f := api.AuditFilter{
+		Driver:    vd.name,
+		Op:        params.Get(string(api.OptOp)),
+		Principal: params.Get(string(api.OptPrincipal)),
+		VolumeID:  api.VolumeID(params.Get(string(api.OptVolumeID))),
+	}
+	if v := params.Get(string(api.OptSince)); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get(string(api.OptUntil)); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get(string(api.OptLimit)); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	records, err := audit.Query(&f)
+	switch err {
+	case nil:
+	case audit.ErrNoQuerier:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(records)
+}
+
+// logLevel returns the log level of the driver. Only the local principal
+// may read it.
+func (vd *volDriver) logLevel(w http.ResponseWriter, r *http.Request) {
+	method := "logLevel"
+	if principal(r) != localPrincipal {
+		vd.sendError(vd.name, method, w, volume.ErrPermission.Error(), http.StatusForbidden)
+		return
+	}
+	json.NewEncoder(w).Encode(&api.LogLevel{Driver: vd.name, Level: logging.Level(vd.name)})
+}
+
+// setLogLevel changes the log level of the driver. Only the local principal
+// may change it.
+func (vd *volDriver) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req api.LogLevel
+	method := "setLogLevel"
+	if principal(r) != localPrincipal {
+		vd.sendError(vd.name, method, w, volume.ErrPermission.Error(), http.StatusForbidden)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := logging.SetLevel(vd.name, req.Level); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vd.logReq(method, "").Infof("Log level set to %s", req.Level)
+	json.NewEncoder(w).Encode(&api.LogLevel{Driver: vd.name, Level: logging.Level(vd.name)})
+}
+
+// logs returns the latest log entries of the driver captured on this node,
+// which may name volumes of any owner. Only the local principal may read them.
+func (vd *volDriver) logs(w http.ResponseWriter, r *http.Request) {
+	var err error
+	method := "logs"
+	if principal(r) != localPrincipal {
+		vd.sendError(vd.name, method, w, volume.ErrPermission.Error(), http.StatusForbidden)
+		return
+	}
+	params := r.URL.Query()
+	limit := 0
+	if v := params.Get(string(api.OptLimit)); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	entries, err := logging.Entries(vd.name, params.Get(string(api.OptLevel)), limit)
+	if err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (vd *volDriver) export(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var req api.VolumeExportRequest
+	var res api.VolumeExportResponse
+	var err error
+
+	method := "export"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessWrite) {
+		return
+	}
+	start := time.Now()
+	res.Export, err = export.Export(d, volumeID, req.Protocol)
+	vd.observe(r, "export", volumeID, start, &req, err)
+	res.VolumeResponse = api.ResponseStatusNew(err)
+	json.NewEncoder(w).Encode(&res)
+}
+
+func (vd *volDriver) unexport(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
+
+	method := "unexport"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessWrite) {
+		return
+	}
+	protocol := api.ExportProtocol(r.URL.Query().Get(string(api.OptProtocol)))
+	start := time.Now()
+	err = export.Unexport(d, volumeID, protocol)
+	vd.observe(r, "unexport", volumeID, start, map[string]api.ExportProtocol{"protocol": protocol}, err)
+	res := api.ResponseStatusNew(err)
+	json.NewEncoder(w).Encode(res)
+}
+
+// transfer makes another principal the owner of a volume.
+func (vd *volDriver) transfer(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var req api.VolumeTransferRequest
+	var err error
+
+	method := "transfer"
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessOwner) {
+		return
+	}
+	start := time.Now()
+	err = volume.Transfer(d, volumeID, req.Owner)
+	vd.observe(r, "transfer", volumeID, start, &req, err)
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(err))
+}
+
+// share grants or revokes the access of another principal to a volume.
+func (vd *volDriver) share(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var req api.VolumeAccessRequest
+	var err error
+
+	method := "share"
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessOwner) {
+		return
+	}
+	start := time.Now()
+	err = volume.SetAccess(d, volumeID, req.Principal, req.Access)
+	vd.observe(r, "share", volumeID, start, &req, err)
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(err))
+}
+
+// updateLocator renames a volume or replaces its labels.
+func (vd *volDriver) updateLocator(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var req api.VolumeLocatorRequest
+	var err error
+
+	method := "updateLocator"
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessOwner) {
+		return
+	}
+	start := time.Now()
+	err = volume.UpdateLocator(d, volumeID, req.Locator)
+	vd.observe(r, "updateLocator", volumeID, start, &req, err)
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(err))
+}
+
+// stats reports the IO statistics and compression ratio of a volume.
+func (vd *volDriver) stats(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
+
+	method := "stats"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessRead) {
+		return
+	}
+	stats, err := volume.Stats(d, volumeID)
+	switch err {
+	case nil:
+	case volume.ErrEnoEnt:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	case volume.ErrNotSupported:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(&stats)
+}
+
+// history reports where and when a volume was last attached and mounted.
+func (vd *volDriver) history(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
+
+	method := "history"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessRead) {
+		return
+	}
+	events, err := volume.History(d, volumeID)
+	switch err {
+	case nil:
+	case volume.ErrEnoEnt:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(events)
+}
+
+// statsHistory reports the IO rates of a volume sampled since the Since
+// query option, or all the samples kept.
+func (vd *volDriver) statsHistory(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var since time.Time
+	var err error
+
+	method := "statsHistory"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := r.URL.Query().Get(string(api.OptSince)); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessRead) {
+		return
+	}
+	samples, err := volume.StatsHistory(d, volumeID, since)
+	switch err {
+	case nil:
+	case volume.ErrEnoEnt:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	case volume.ErrNotSupported:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotImplemented)
+		return
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(samples)
+}
+
+func (vd *volDriver) alerts(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
+
+	method := "alerts"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if vd.denied(method, w, r, d, volumeID, api.AccessRead) {
+		return
+	}
+	alerts, err := volume.Alerts(d, volumeID)
+	switch err {
+	case nil:
+	case volume.ErrEnoEnt:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(&alerts)
 }
 
+// version returns the path of route under any API version. startServer
+// refuses the versions the driver does not support.
 func version(route string) string {
-	return "/" + apiVersion + "/" + route
+	return "/{version:v[0-9]+}/" + route
 }
 
 func volPath(route string) string {
@@ -385,13 +2040,65 @@ func (vd *volDriver) Routes() []*Route {
 		&Route{verb: "GET", path: volPath(""), fn: vd.enumerate},
 		&Route{verb: "GET", path: volPath("/{id}"), fn: vd.inspect},
 		&Route{verb: "DELETE", path: volPath("/{id}"), fn: vd.delete},
+		&Route{verb: "POST", path: volPath("/bulk/delete"), fn: vd.bulkDelete},
+		&Route{verb: "POST", path: volPath("/bulk/inspect"), fn: vd.bulkInspect},
 		&Route{verb: "GET", path: volPath("/stats"), fn: vd.stats},
 		&Route{verb: "GET", path: volPath("/stats/{id}"), fn: vd.stats},
+		&Route{verb: "GET", path: volPath("/stats/history/{id}"), fn: vd.statsHistory},
+		&Route{verb: "GET", path: volPath("/history/{id}"), fn: vd.history},
 		&Route{verb: "GET", path: volPath("/alerts"), fn: vd.alerts},
 		&Route{verb: "GET", path: volPath("/alerts/{id}"), fn: vd.alerts},
+		&Route{verb: "GET", path: volPath("/graph/{id}"), fn: vd.graph},
+		&Route{verb: "GET", path: volPath("/fingerprint/{id}"), fn: vd.fingerprint},
+		&Route{verb: "GET", path: volPath("/catalog/{id}"), fn: vd.catalog},
+		&Route{verb: "GET", path: volPath("/mounts/{id}"), fn: vd.mounts},
+		&Route{verb: "POST", path: volPath("/restore/{id}"), fn: vd.restore},
+		&Route{verb: "GET", path: version("trash"), fn: vd.trashed},
+		&Route{verb: "POST", path: version("rebalance"), fn: vd.rebalance},
+		&Route{verb: "GET", path: version("rebalance"), fn: vd.rebalanceJob},
+		&Route{verb: "DELETE", path: version("rebalance"), fn: vd.rebalanceCancel},
+		&Route{verb: "GET", path: version("orphans"), fn: vd.orphans},
+		&Route{verb: "POST", path: version("gc"), fn: vd.collectGarbage},
+		&Route{verb: "POST", path: volPath("/resize/{id}"), fn: vd.resize},
+		&Route{verb: "POST", path: volPath("/export/{id}"), fn: vd.export},
+		&Route{verb: "DELETE", path: volPath("/export/{id}"), fn: vd.unexport},
+		&Route{verb: "PUT", path: volPath("/owner/{id}"), fn: vd.transfer},
+		&Route{verb: "PUT", path: volPath("/access/{id}"), fn: vd.share},
+		&Route{verb: "PUT", path: volPath("/locator/{id}"), fn: vd.updateLocator},
+		&Route{verb: "GET", path: "/metrics", fn: metrics.Handler(vd.name).ServeHTTP},
+		&Route{verb: "GET", path: "/health", fn: vd.healthAll},
+		&Route{verb: "GET", path: version("health"), fn: vd.health},
+		&Route{verb: "GET", path: version("status"), fn: vd.status},
+		&Route{verb: "GET", path: "/versions", fn: vd.versions},
+		&Route{verb: "GET", path: version("cluster/capacity"), fn: vd.clusterCapacity},
+		&Route{verb: "GET", path: version("audit"), fn: vd.auditQuery},
+		&Route{verb: "GET", path: version("loglevel"), fn: vd.logLevel},
+		&Route{verb: "PUT", path: version("loglevel"), fn: vd.setLogLevel},
+		&Route{verb: "GET", path: version("debug/logs"), fn: vd.logs},
+		&Route{verb: "GET", path: version("events"), fn: vd.events},
+		&Route{verb: "GET", path: version("profiles"), fn: vd.profiles},
+		&Route{verb: "POST", path: version("profiles"), fn: vd.profileCreate},
+		&Route{verb: "GET", path: version("profiles/{name}"), fn: vd.profileInspect},
+		&Route{verb: "DELETE", path: version("profiles/{name}"), fn: vd.profileDelete},
+		&Route{verb: "GET", path: version("quotas"), fn: vd.quotas},
+		&Route{verb: "POST", path: version("quotas"), fn: vd.quotaCreate},
+		&Route{verb: "GET", path: version("quotas/{tenant}"), fn: vd.quotaInspect},
+		&Route{verb: "DELETE", path: version("quotas/{tenant}"), fn: vd.quotaDelete},
+		&Route{verb: "POST", path: version("cloudsnaps"), fn: vd.cloudSnapUpload},
+		&Route{verb: "GET", path: version("cloudsnaps"), fn: vd.cloudSnaps},
+		&Route{verb: "GET", path: version("cloudsnaps/{id}"), fn: vd.cloudSnapInspect},
+		&Route{verb: "DELETE", path: version("cloudsnaps/{id}"), fn: vd.cloudSnapDelete},
+		&Route{verb: "POST", path: version("cloudsnaps/resume/{id}"), fn: vd.cloudSnapResume},
+		&Route{verb: "POST", path: version("cloudsnaps/restore/{id}"), fn: vd.cloudSnapRestore},
 		&Route{verb: "POST", path: snapPath(""), fn: vd.snap},
+		&Route{verb: "POST", path: snapPath("/group"), fn: vd.snapGroup},
+		&Route{verb: "POST", path: snapPath("/bulk"), fn: vd.bulkSnap},
 		&Route{verb: "GET", path: snapPath(""), fn: vd.snapEnumerate},
 		&Route{verb: "GET", path: snapPath("/{id}"), fn: vd.snapInspect},
+		&Route{verb: "GET", path: snapPath("/diff/{id}"), fn: vd.snapDiff},
+		&Route{verb: "POST", path: snapPath("/export/{id}"), fn: vd.snapExport},
+		&Route{verb: "POST", path: snapPath("/import"), fn: vd.snapImport},
+		&Route{verb: "PUT", path: snapPath("/protect/{id}"), fn: vd.snapProtect},
 		&Route{verb: "DELETE", path: snapPath("/{id}"), fn: vd.snapDelete},
 	}
 }
@@ -0,0 +1,125 @@
+// Package audit records who performed which volume operation, when, with
+// which parameters and with what result. Records are written to one or more
+// sinks, sinks that implement Querier can be searched.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+var (
+	// ErrNoQuerier is returned by Query if no sink can be searched.
+	ErrNoQuerier = errors.New("No queryable audit sink configured")
+)
+
+// Sink stores audit records.
+type Sink interface {
+	// String description of this sink.
+	String() string
+	// Write stores r.
+	Write(r *api.AuditRecord) error
+}
+
+// Querier is implemented by sinks that can be searched.
+type Querier interface {
+	// Query returns the records matching f, oldest first.
+	Query(f *api.AuditFilter) ([]api.AuditRecord, error)
+}
+
+var (
+	lock  sync.RWMutex
+	sinks []Sink
+)
+
+// AddSink adds s to the sinks records are written to.
+func AddSink(s Sink) {
+	lock.Lock()
+	defer lock.Unlock()
+	sinks = append(sinks, s)
+}
+
+// Record writes a record of op on volumeID to every sink. params are the
+// parameters of the request and may be nil. Failures to write a record are
+// logged, they do not fail the operation.
+func Record(principal, driver, op string, volumeID api.VolumeID, params interface{}, err error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	if len(sinks) == 0 {
+		return
+	}
+	r := &api.AuditRecord{
+		Time:      time.Now(),
+		Principal: principal,
+		Driver:    driver,
+		Op:        op,
+		VolumeID:  volumeID,
+	}
+	if params != nil {
+		if b, err := json.Marshal(params); err == nil {
+			r.Params = b
+		}
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	for _, s := range sinks {
+		if err := s.Write(r); err != nil {
+			log.Warnf("Failed to write audit record of %s %v to %v: %v", op, volumeID, s, err)
+		}
+	}
+}
+
+// Query searches the first sink that implements Querier.
+// Errors ErrNoQuerier may be returned.
+func Query(f *api.AuditFilter) ([]api.AuditRecord, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	for _, s := range sinks {
+		if q, ok := s.(Querier); ok {
+			return q.Query(f)
+		}
+	}
+	return nil, ErrNoQuerier
+}
+
+// Match returns true if r is selected by f, ignoring the limit.
+func Match(f *api.AuditFilter, r *api.AuditRecord) bool {
+	switch {
+	case f.Driver != "" && f.Driver != r.Driver:
+		return false
+	case f.Op != "" && f.Op != r.Op:
+		return false
+	case f.Principal != "" && f.Principal != r.Principal:
+		return false
+	case f.VolumeID != "" && f.VolumeID != r.VolumeID:
+		return false
+	case !f.Since.IsZero() && r.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && r.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+// Filter returns the records selected by f, oldest first.
+func Filter(f *api.AuditFilter, records []api.AuditRecord) []api.AuditRecord {
+	matched := make([]api.AuditRecord, 0, len(records))
+	for i := range records {
+		if Match(f, &records[i]) {
+			matched = append(matched, records[i])
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Time.Before(matched[j].Time) })
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[len(matched)-f.Limit:]
+	}
+	return matched
+}
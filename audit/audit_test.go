@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/portworx/kvdb/mem"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestRecordQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	kv, err := mem.New("audit_test", nil, nil)
+	assert.NoError(t, err)
+
+	_, err = Query(&api.AuditFilter{})
+	assert.Equal(t, ErrNoQuerier, err, "Query without sinks should fail")
+
+	AddSink(NewFileSink(path.Join(dir, "audit.log")))
+	AddSink(NewKVDBSink(kv, 0))
+	assert.Equal(t, DefaultRetention, sinks[len(sinks)-1].(*kvdbSink).ttl, "Records kept forever")
+	Record("alice", "nfs", "create", "v1", &api.VolumeLocator{Name: "v1"}, nil)
+	Record("bob", "nfs", "delete", "v1", nil, errors.New("Volume is attached"))
+	Record("alice", "btrfs", "create", "v2", nil, nil)
+
+	for _, s := range sinks {
+		q := s.(Querier)
+		records, err := q.Query(&api.AuditFilter{})
+		assert.NoError(t, err, "Failed to query %v", s)
+		assert.Equal(t, 3, len(records), "%v should hold every record", s)
+
+		records, err = q.Query(&api.AuditFilter{Driver: "nfs", Principal: "alice"})
+		assert.NoError(t, err, "Failed to query %v", s)
+		if assert.Equal(t, 1, len(records), "%v should filter records", s) {
+			assert.Equal(t, "create", records[0].Op)
+			assert.Equal(t, `{"Name":"v1","VolumeLabels":null}`, string(records[0].Params))
+		}
+
+		records, err = q.Query(&api.AuditFilter{VolumeID: "v1", Limit: 1})
+		assert.NoError(t, err, "Failed to query %v", s)
+		if assert.Equal(t, 1, len(records), "%v should limit records", s) {
+			assert.Equal(t, "delete", records[0].Op, "Limit should keep the latest records")
+			assert.Equal(t, "Volume is attached", records[0].Error)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// DefaultRetention of the records of the KVDB sink.
+	DefaultRetention = 90 * 24 * time.Hour
+
+	keyBase = "audit/"
+)
+
+type kvdbSink struct {
+	kv  kvdb.Kvdb
+	ttl time.Duration
+	mu  sync.Mutex
+	seq uint64
+}
+
+// NewKVDBSink returns a queryable Sink that stores records in kv. Records
+// expire after ttl, DefaultRetention if 0, so that the KVDB does not grow
+// without bounds.
+func NewKVDBSink(kv kvdb.Kvdb, ttl time.Duration) Sink {
+	if ttl <= 0 {
+		ttl = DefaultRetention
+	}
+	return &kvdbSink{kv: kv, ttl: ttl}
+}
+
+func (s *kvdbSink) String() string {
+	return "kvdb"
+}
+
+func (s *kvdbSink) Write(r *api.AuditRecord) error {
+	s.mu.Lock()
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+	key := fmt.Sprintf("%s%s/%020d-%d", keyBase, r.Driver, r.Time.UnixNano(), seq)
+	_, err := s.kv.Put(key, r, uint64(s.ttl/time.Second))
+	return err
+}
+
+func (s *kvdbSink) Query(f *api.AuditFilter) ([]api.AuditRecord, error) {
+	prefix := keyBase
+	if f.Driver != "" {
+		prefix += f.Driver + "/"
+	}
+	kvp, err := s.kv.Enumerate(prefix)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]api.AuditRecord, 0, len(kvp))
+	for _, v := range kvp {
+		var r api.AuditRecord
+		if err = json.Unmarshal(v.Value, &r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return Filter(f, records), nil
+}
+
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSink returns a queryable Sink that appends records to the file at
+// path, one JSON document per line.
+func NewFileSink(path string) Sink {
+	return &fileSink{path: path}
+}
+
+func (s *fileSink) String() string {
+	return "file " + s.path
+}
+
+func (s *fileSink) Write(r *api.AuditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *fileSink) Query(f *api.AuditFilter) ([]api.AuditRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var records []api.AuditRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r api.AuditRecord
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return Filter(f, records), nil
+}
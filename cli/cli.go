@@ -11,6 +11,8 @@ const (
 	DaemonFlag = "daemon"
 	// DriverFlag key for for the driver parameter.
 	DriverFlag = "driver"
+	// InstanceFlag key for the driver instance parameter.
+	InstanceFlag = "instance"
 )
 
 // DaemonMode returns true if we are running as daemon
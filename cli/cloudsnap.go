@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"github.com/codegangsta/cli"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/cloudsnap"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// cloudSnapper returns the client of the driver as a cloudsnap.Requester.
+func (v *volDriver) cloudSnapper(c *cli.Context, fn string) (cloudsnap.Requester, bool) {
+	v.volumeOptions(c)
+	r, ok := v.volDriver.(cloudsnap.Requester)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+	}
+	return r, ok
+}
+
+func (v *volDriver) cloudSnapUpload(c *cli.Context) {
+	fn := "cloudsnap upload"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "snapID", "Invalid number of arguments")
+		return
+	}
+	r, ok := v.cloudSnapper(c, fn)
+	if !ok {
+		return
+	}
+	cs, err := r.CloudSnapUpload(&api.CloudSnapRequest{
+		SnapID:        api.SnapID(c.Args()[0]),
+		Store:         c.String("store"),
+		Bucket:        c.String("bucket"),
+		NoCompression: c.Bool("no-compression"),
+	})
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, cs)
+}
+
+func (v *volDriver) cloudSnapList(c *cli.Context) {
+	fn := "cloudsnap list"
+	r, ok := v.cloudSnapper(c, fn)
+	if !ok {
+		return
+	}
+	snaps, err := r.CloudSnaps(api.VolumeID(c.String("volume")))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, snaps)
+}
+
+func (v *volDriver) cloudSnapInspect(c *cli.Context) {
+	fn := "cloudsnap inspect"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "cloudSnapID", "Invalid number of arguments")
+		return
+	}
+	r, ok := v.cloudSnapper(c, fn)
+	if !ok {
+		return
+	}
+	cs, err := r.CloudSnap(c.Args()[0])
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, cs)
+}
+
+func (v *volDriver) cloudSnapResume(c *cli.Context) {
+	fn := "cloudsnap resume"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "cloudSnapID", "Invalid number of arguments")
+		return
+	}
+	r, ok := v.cloudSnapper(c, fn)
+	if !ok {
+		return
+	}
+	cs, err := r.CloudSnapResume(c.Args()[0])
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, cs)
+}
+
+func (v *volDriver) cloudSnapRestore(c *cli.Context) {
+	fn := "cloudsnap restore"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "cloudSnapID", "Invalid number of arguments")
+		return
+	}
+	r, ok := v.cloudSnapper(c, fn)
+	if !ok {
+		return
+	}
+	id, err := r.CloudSnapRestore(c.Args()[0], api.VolumeLocator{Name: c.String("name")})
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{string(id)}})
+}
+
+func (v *volDriver) cloudSnapDelete(c *cli.Context) {
+	fn := "cloudsnap delete"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "cloudSnapID", "Invalid number of arguments")
+		return
+	}
+	r, ok := v.cloudSnapper(c, fn)
+	if !ok {
+		return
+	}
+	if err := r.CloudSnapDelete(c.Args()[0]); err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{c.Args()[0]}})
+}
+
+// cloudSnapCommands manage the snapshots uploaded to object stores.
+func cloudSnapCommands(v *volDriver) []cli.Command {
+	return []cli.Command{
+		{
+			Name:   "upload",
+			Usage:  "Upload a snapshot to an object store: upload snapID",
+			Action: v.cloudSnapUpload,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "store",
+					Usage: "object driver instance of the object store",
+				},
+				cli.StringFlag{
+					Name:  "bucket",
+					Usage: "bucket to upload to",
+				},
+				cli.BoolFlag{
+					Name:  "no-compression",
+					Usage: "do not compress the data, for data that does not compress",
+				},
+			},
+		},
+		{
+			Name:   "list",
+			Usage:  "List the cloud snapshots",
+			Action: v.cloudSnapList,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "volume",
+					Usage: "only list the cloud snapshots of this volume",
+				},
+			},
+		},
+		{
+			Name:   "inspect",
+			Usage:  "Show a cloud snapshot and the progress of its upload: inspect cloudSnapID",
+			Action: v.cloudSnapInspect,
+		},
+		{
+			Name:   "resume",
+			Usage:  "Resume a failed or interrupted upload on this node: resume cloudSnapID",
+			Action: v.cloudSnapResume,
+		},
+		{
+			Name:   "restore",
+			Usage:  "Create a volume from a cloud snapshot: restore cloudSnapID",
+			Action: v.cloudSnapRestore,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "name",
+					Usage: "name of the new volume, the name of the snapshotted volume if not set",
+				},
+			},
+		},
+		{
+			Name:   "delete",
+			Usage:  "Delete a cloud snapshot and its objects: delete cloudSnapID",
+			Action: v.cloudSnapDelete,
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"github.com/codegangsta/cli"
+)
+
+func clusterStatus(c *cli.Context) {
+	fn := "status"
+	status, err := managerClient().ClusterStatus()
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, status)
+}
+
+func clusterList(c *cli.Context) {
+	fn := "list"
+	nodes, err := managerClient().ClusterNodes()
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, nodes)
+}
+
+func clusterInspect(c *cli.Context) {
+	fn := "inspect"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "nodeID", "Invalid number of arguments")
+		return
+	}
+	node, err := managerClient().ClusterNode(c.Args()[0])
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, node)
+}
+
+func clusterRemove(c *cli.Context) {
+	fn := "remove"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "nodeID", "Invalid number of arguments")
+		return
+	}
+	nodeID := c.Args()[0]
+	if err := managerClient().RemoveClusterNode(nodeID, c.Bool("force")); err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{Result: nodeID})
+}
+
+// ClusterCommands exports the list of CLI cluster subcommands.
+func ClusterCommands() []cli.Command {
+	commands := []cli.Command{
+		{
+			Name:    "status",
+			Aliases: []string{"s"},
+			Usage:   "Show the state of the cluster",
+			Action:  clusterStatus,
+		},
+		{
+			Name:    "list",
+			Aliases: []string{"l"},
+			Usage:   "List the nodes of the cluster",
+			Action:  clusterList,
+		},
+		{
+			Name:    "inspect",
+			Aliases: []string{"i"},
+			Usage:   "Inspect a node: inspect nodeID",
+			Action:  clusterInspect,
+		},
+		{
+			Name:    "remove",
+			Aliases: []string{"r"},
+			Usage:   "Decommission a node, detaching its volumes: remove nodeID",
+			Action:  clusterRemove,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force,f",
+					Usage: "remove the node even if it holds the only in sync copy of volumes",
+				},
+			},
+		},
+	}
+	return commands
+}
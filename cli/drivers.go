@@ -1,13 +1,119 @@
 package cli
 
 import (
+	"fmt"
+	"os"
+	"strings"
+
 	"github.com/codegangsta/cli"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/client"
+	"github.com/libopenstorage/openstorage/pkg/spec"
 )
 
+func managerClient() *client.Client {
+	clnt, err := client.NewManagerClient()
+	if err != nil {
+		fmt.Printf("Failed to initialize client library: %v\n", err)
+		os.Exit(1)
+	}
+	return clnt
+}
+
+// processOptions parses comma separated name=value pairs.
+func processOptions(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	if s == "" {
+		return m, nil
+	}
+	for _, v := range strings.Split(s, ",") {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Malformed option: %s", v)
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m, nil
+}
+
 func driverList(c *cli.Context) {
+	fn := "list"
+	instances, err := managerClient().Drivers()
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, instances)
 }
 
 func driverAdd(c *cli.Context) {
+	fn := "add"
+	name := c.String("name")
+	if name == "" {
+		missingParameter(c, fn, "name", "Driver Name")
+		return
+	}
+	params, err := processOptions(c.String("options"))
+	if err != nil {
+		badParameter(c, fn, "options", err.Error())
+		return
+	}
+	if err = managerClient().AddDriver(name, params); err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{Result: name})
+}
+
+func driverRemove(c *cli.Context) {
+	fn := "remove"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "name", "Invalid number of arguments")
+		return
+	}
+	name := c.Args()[0]
+	if err := managerClient().RemoveDriver(name, c.Bool("force")); err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{Result: name})
+}
+
+// driverBandwidth lists the bandwidth limits of background data movement, or
+// changes those given as class=limit pairs such as migration=50M.
+func driverBandwidth(c *cli.Context) {
+	fn := "bandwidth"
+	clnt := managerClient()
+	if len(c.Args()) == 0 {
+		limits, err := clnt.Bandwidth()
+		if err != nil {
+			cmdError(c, fn, err)
+			return
+		}
+		cmdOutput(c, limits)
+		return
+	}
+	opts, err := processOptions(strings.Join(c.Args(), ","))
+	if err != nil {
+		badParameter(c, fn, "limits", err.Error())
+		return
+	}
+	limits := make(api.BandwidthLimits)
+	for class, v := range opts {
+		if limits[class], err = spec.ParseSize(v); err != nil {
+			badParameter(c, fn, class, err.Error())
+			return
+		}
+	}
+	if err = clnt.SetBandwidth(limits); err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+	cmdOutput(c, limits)
 }
 
 // DriverCommands exports the list of CLI driver subcommands.
@@ -21,7 +127,7 @@ func DriverCommands() []cli.Command {
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:  "name,n",
-					Usage: "Driver Name",
+					Usage: "Driver Name, or instance name with the instance_of option",
 				},
 				cli.StringFlag{
 					Name:  "options,o",
@@ -29,12 +135,29 @@ func DriverCommands() []cli.Command {
 				},
 			},
 		},
+		{
+			Name:    "remove",
+			Aliases: []string{"r"},
+			Usage:   "Shut down a running driver: remove name",
+			Action:  driverRemove,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force,f",
+					Usage: "remove the driver even if its volumes are attached or mounted",
+				},
+			},
+		},
 		{
 			Name:    "list",
 			Aliases: []string{"l"},
 			Usage:   "List drivers",
 			Action:  driverList,
 		},
+		{
+			Name:   "bandwidth",
+			Usage:  "Show or limit background data movement in bytes per second: bandwidth [class=limit ...], e.g. migration=50M",
+			Action: driverBandwidth,
+		},
 	}
 	return commands
 }
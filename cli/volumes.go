@@ -1,13 +1,19 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/audit"
 	"github.com/libopenstorage/openstorage/client"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/pkg/output"
+	"github.com/libopenstorage/openstorage/pkg/spec"
 	"github.com/libopenstorage/openstorage/volume"
 )
 
@@ -50,7 +56,12 @@ func processLabels(s string) (api.Labels, error) {
 }
 
 func (v *volDriver) volumeOptions(c *cli.Context) {
-	clnt, err := client.NewDriverClient(v.name)
+	name := v.name
+	// Instances not named after their driver are selected by name.
+	if instance := c.GlobalString(InstanceFlag); instance != "" {
+		name = instance
+	}
+	clnt, err := client.NewDriverClient(name)
 	if err != nil {
 		fmt.Printf("Failed to initialize client library: %v\n", err)
 		os.Exit(1)
@@ -80,8 +91,9 @@ func (v *volDriver) volumeCreate(c *cli.Context) {
 	locator = api.VolumeLocator{
 		Name:         c.Args()[0],
 		VolumeLabels: labels,
+		Group:        c.String("group"),
 	}
-	spec := &api.VolumeSpec{
+	volSpec := &api.VolumeSpec{
 		Size:             uint64(VolumeSzUnits(c.Int("s")) * MiB),
 		Format:           api.Filesystem(c.String("fs")),
 		BlockSize:        c.Int("b") * 1024,
@@ -89,7 +101,19 @@ func (v *volDriver) volumeCreate(c *cli.Context) {
 		Cos:              api.VolumeCos(c.Int("cos")),
 		SnapshotInterval: c.Int("si"),
 	}
-	if id, err = v.volDriver.Create(locator, nil, spec); err != nil {
+	var options *api.CreateOptions
+	if p := c.String("profile"); p != "" {
+		// The spec flags have defaults, only --opts override the profile.
+		options = &api.CreateOptions{Profile: p}
+		volSpec = &api.VolumeSpec{}
+	}
+	if o := c.String("opts"); o != "" {
+		if volSpec, err = spec.ParseString(o); err != nil {
+			cmdError(c, fn, err)
+			return
+		}
+	}
+	if id, err = v.volDriver.Create(locator, options, volSpec); err != nil {
 		cmdError(c, fn, err)
 		return
 	}
@@ -113,7 +137,12 @@ func (v *volDriver) volumeMount(c *cli.Context) {
 		return
 	}
 
-	err := v.volDriver.Mount(api.VolumeID(volumeID), path)
+	var err error
+	if options := mountOptions(c); options != nil {
+		err = volume.MountWithOptions(context.Background(), v.volDriver, api.VolumeID(volumeID), path, options)
+	} else {
+		err = v.volDriver.Mount(api.VolumeID(volumeID), path)
+	}
 	if err != nil {
 		cmdError(c, fn, err)
 		return
@@ -134,7 +163,12 @@ func (v *volDriver) volumeUnmount(c *cli.Context) {
 
 	path := c.String("path")
 
-	err := v.volDriver.Unmount(api.VolumeID(volumeID), path)
+	var err error
+	if options := detachOptions(c); options != nil {
+		err = volume.ForceUnmount(context.Background(), v.volDriver, api.VolumeID(volumeID), path, options)
+	} else {
+		err = v.volDriver.Unmount(api.VolumeID(volumeID), path)
+	}
 	if err != nil {
 		cmdError(c, fn, err)
 		return
@@ -170,7 +204,11 @@ func (v *volDriver) volumeAttach(c *cli.Context) {
 	v.volumeOptions(c)
 	volumeID := c.Args()[0]
 
-	devicePath, err := v.volDriver.Attach(api.VolumeID(volumeID))
+	options := &api.AttachOptions{
+		ReadOnly: c.Bool("readonly"),
+		Shared:   c.Bool("shared"),
+	}
+	devicePath, err := v.volDriver.Attach(api.VolumeID(volumeID), options)
 	if err != nil {
 		cmdError(c, fn, err)
 		return
@@ -187,7 +225,12 @@ func (v *volDriver) volumeDetach(c *cli.Context) {
 	}
 	volumeID := c.Args()[0]
 	v.volumeOptions(c)
-	err := v.volDriver.Detach(api.VolumeID(volumeID))
+	var err error
+	if options := detachOptions(c); options != nil {
+		err = volume.ForceDetach(context.Background(), v.volDriver, api.VolumeID(volumeID), options)
+	} else {
+		err = v.volDriver.Detach(api.VolumeID(volumeID))
+	}
 	if err != nil {
 		cmdError(c, fn, err)
 		return
@@ -196,6 +239,89 @@ func (v *volDriver) volumeDetach(c *cli.Context) {
 	fmtOutput(c, &Format{UUID: []string{c.Args()[0]}})
 }
 
+func (v *volDriver) volumeMaintenance(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "maintenance"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
+		return
+	}
+	volumeID := c.Args()[0]
+	err := volume.SetMaintenance(v.volDriver, api.VolumeID(volumeID), !c.Bool("end"))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{volumeID}})
+}
+
+func (v *volDriver) volumeStatus(c *cli.Context) {
+	v.volumeOptions(c)
+	status := v.volDriver.Status()
+	if c.GlobalBool("json") {
+		cmdOutput(c, status)
+		return
+	}
+	fmt.Print(status.String())
+}
+
+func (v *volDriver) volumeRebalance(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "rebalance"
+	r, ok := v.volDriver.(volume.RebalanceRequester)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+		return
+	}
+	var job *api.RebalanceJob
+	var err error
+	switch {
+	case c.Bool("cancel"):
+		if err = r.CancelRebalance(); err == nil {
+			job, err = r.RebalanceJob()
+		}
+	case c.Bool("status"):
+		job, err = r.RebalanceJob()
+	default:
+		job, err = r.Rebalance(&api.RebalanceRequest{
+			Threshold: c.Int("threshold"),
+			MaxMoves:  c.Int("max-moves"),
+			IO:        c.Bool("io"),
+			DryRun:    c.Bool("dry-run"),
+		})
+	}
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, job)
+}
+
+// detachOptions returns the options of the force and kill flags, nil if
+// neither is set.
+func mountOptions(c *cli.Context) *api.MountOptions {
+	options := &api.MountOptions{
+		ReadOnly:     c.Bool("readonly"),
+		Remount:      c.Bool("remount"),
+		SELinuxLabel: c.String("selinux-label"),
+		Propagation:  api.MountPropagation(c.String("propagation")),
+		SubPath:      c.String("subpath"),
+	}
+	if *options == (api.MountOptions{}) {
+		return nil
+	}
+	return options
+}
+
+func detachOptions(c *cli.Context) *api.DetachOptions {
+	if !c.Bool("force") && !c.Bool("kill") {
+		return nil
+	}
+	return &api.DetachOptions{Force: c.Bool("force"), Kill: c.Bool("kill")}
+}
+
 func (v *volDriver) volumeInspect(c *cli.Context) {
 
 	v.volumeOptions(c)
@@ -233,99 +359,644 @@ func (v *volDriver) volumeEnumerate(c *cli.Context) {
 		}
 	}
 
+	filter, err := output.ParseFilter(c.String("filter"))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+	format, err := output.ParseFormat(c.String("output"))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
 	v.volumeOptions(c)
 	volumes, err := v.volDriver.Enumerate(locator, nil)
 	if err != nil {
 		cmdError(c, fn, err)
 		return
 	}
-	cmdOutput(c, volumes)
+	volumes = filter.Apply(volumes)
+	if format == output.JSON {
+		cmdOutput(c, volumes)
+		return
+	}
+	if err = output.Write(os.Stdout, format, volumes); err != nil {
+		cmdError(c, fn, err)
+	}
 }
 
-func (v *volDriver) volumeDelete(c *cli.Context) {
-	fn := "delete"
+func (v *volDriver) volumeGraph(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "graph"
 	if len(c.Args()) < 1 {
 		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
 		return
 	}
-	volumeID := c.Args()[0]
+
+	graph, err := volume.Graph(v.volDriver, api.VolumeID(c.Args()[0]))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, graph)
+}
+
+func (v *volDriver) volumeMounts(c *cli.Context) {
 	v.volumeOptions(c)
-	err := v.volDriver.Delete(api.VolumeID(volumeID))
+	fn := "mounts"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
+		return
+	}
+
+	mounts, err := volume.Mounts(v.volDriver, api.VolumeID(c.Args()[0]))
 	if err != nil {
 		cmdError(c, fn, err)
 		return
 	}
 
-	fmtOutput(c, &Format{UUID: []string{c.Args()[0]}})
+	cmdOutput(c, mounts)
 }
 
-func (v *volDriver) snapCreate(c *cli.Context) {
+func (v *volDriver) volumeCatalog(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "catalog"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
+		return
+	}
+	p := "/"
+	if len(c.Args()) > 1 {
+		p = c.Args()[1]
+	}
+	entries, err := volume.Catalog(v.volDriver, api.VolumeID(c.Args()[0]), p)
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, entries)
 }
 
-func (v *volDriver) snapInspect(c *cli.Context) {
+func (v *volDriver) volumeFingerprint(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "fingerprint"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
+		return
+	}
+	base := api.SnapID(c.String("base"))
+	f, err := volume.Fingerprint(v.volDriver, api.VolumeID(c.Args()[0]), base)
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, f)
+}
 
+func (v *volDriver) volumeRestore(c *cli.Context) {
 	v.volumeOptions(c)
-	fn := "inspect"
+	fn := "restore"
 	if len(c.Args()) < 1 {
-		missingParameter(c, fn, "snapID", "Invalid number of arguments")
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
 		return
 	}
-	d := make([]api.SnapID, len(c.Args()))
-	for i, v := range c.Args() {
-		d[i] = api.SnapID(v)
+	r, ok := v.volDriver.(volume.Recycler)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+		return
+	}
+	volumeID := c.Args()[0]
+	if err := r.Restore(api.VolumeID(volumeID)); err != nil {
+		cmdError(c, fn, err)
+		return
 	}
 
-	snaps, err := v.volDriver.SnapInspect(d)
+	fmtOutput(c, &Format{UUID: []string{volumeID}})
+}
+
+func (v *volDriver) volumeResize(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "resize"
+	if len(c.Args()) < 2 {
+		missingParameter(c, fn, "volumeID size", "Invalid number of arguments")
+		return
+	}
+	r, ok := v.volDriver.(volume.Resizer)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+		return
+	}
+	volumeID := c.Args()[0]
+	size, err := spec.ParseSize(c.Args()[1])
 	if err != nil {
 		cmdError(c, fn, err)
 		return
 	}
+	if err = r.Resize(api.VolumeID(volumeID), size); err != nil {
+		cmdError(c, fn, err)
+		return
+	}
 
-	cmdOutput(c, snaps)
+	fmtOutput(c, &Format{UUID: []string{volumeID}})
 }
 
-func (v *volDriver) snapEnumerate(c *cli.Context) {
-	var locator api.VolumeLocator
+func (v *volDriver) volumeTransfer(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "transfer"
+	if len(c.Args()) < 2 {
+		missingParameter(c, fn, "volumeID owner", "Invalid number of arguments")
+		return
+	}
+	volumeID := c.Args()[0]
+	if err := volume.Transfer(v.volDriver, api.VolumeID(volumeID), c.Args()[1]); err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{volumeID}})
+}
+
+func (v *volDriver) volumeShare(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "share"
+	if len(c.Args()) < 2 {
+		missingParameter(c, fn, "volumeID principal", "Invalid number of arguments")
+		return
+	}
+	access := api.AccessType(c.String("access"))
+	if c.Bool("revoke") {
+		access = ""
+	}
+	volumeID := c.Args()[0]
+	err := volume.SetAccess(v.volDriver, api.VolumeID(volumeID), c.Args()[1], access)
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{volumeID}})
+}
+
+func (v *volDriver) volumeRename(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "rename"
+	if len(c.Args()) < 2 {
+		missingParameter(c, fn, "volumeID name", "Invalid number of arguments")
+		return
+	}
+	volumeID := api.VolumeID(c.Args()[0])
+	vols, err := v.volDriver.Inspect([]api.VolumeID{volumeID})
+	if err != nil || len(vols) == 0 {
+		cmdError(c, fn, volume.ErrEnoEnt)
+		return
+	}
+	locator := vols[0].Locator
+	locator.Name = c.Args()[1]
+	if err = volume.UpdateLocator(v.volDriver, volumeID, locator); err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{string(volumeID)}})
+}
+
+func (v *volDriver) volumeTrash(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "trash"
+	r, ok := v.volDriver.(volume.Recycler)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+		return
+	}
+	vols, err := r.Trashed()
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, vols)
+}
+
+func (v *volDriver) volumeOrphans(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "orphans"
+	g, ok := v.volDriver.(volume.GCRequester)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+		return
+	}
+	var orphans []api.Orphan
 	var err error
+	if c.Bool("reclaim") {
+		orphans, err = g.CollectGarbage(api.GCReclaim)
+	} else {
+		orphans, err = g.Orphans()
+	}
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
 
-	fn := "enumerate"
-	locator.Name = c.String("name")
-	if l := c.String("label"); l != "" {
-		locator.VolumeLabels, err = processLabels(l)
-		if err != nil {
+	cmdOutput(c, orphans)
+}
+
+func (v *volDriver) volumeAudit(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "audit"
+	q, ok := v.volDriver.(audit.Querier)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+		return
+	}
+	f := &api.AuditFilter{
+		Op:        c.String("op"),
+		Principal: c.String("principal"),
+		VolumeID:  api.VolumeID(c.String("volume")),
+		Limit:     c.Int("limit"),
+	}
+	if since := c.Duration("since"); since != 0 {
+		f.Since = time.Now().Add(-since)
+	}
+	records, err := q.Query(f)
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, records)
+}
+
+func (v *volDriver) volumeLogs(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "logs"
+	l, ok := v.volDriver.(logging.Requester)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+		return
+	}
+	entries, err := l.Logs(c.String("level"), c.Int("limit"))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, entries)
+}
+
+func (v *volDriver) volumeLogLevel(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "loglevel"
+	l, ok := v.volDriver.(logging.Requester)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+		return
+	}
+	if len(c.Args()) > 0 {
+		if err := l.SetLogLevel(c.Args()[0]); err != nil {
 			cmdError(c, fn, err)
 			return
 		}
 	}
+	level, err := l.LogLevel()
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, &api.LogLevel{Driver: v.name, Level: level})
+}
 
+func (v *volDriver) volumeHistory(c *cli.Context) {
 	v.volumeOptions(c)
-	snaps, err := v.volDriver.Enumerate(locator, nil)
+	fn := "history"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
+		return
+	}
+	events, err := volume.History(v.volDriver, api.VolumeID(c.Args()[0]))
 	if err != nil {
 		cmdError(c, fn, err)
 		return
 	}
-	if snaps == nil {
+
+	cmdOutput(c, events)
+}
+
+func (v *volDriver) volumeStatsHistory(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "iostats"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
+		return
+	}
+	var since time.Time
+	if d := c.Duration("since"); d != 0 {
+		since = time.Now().Add(-d)
+	}
+	samples, err := volume.StatsHistory(v.volDriver, api.VolumeID(c.Args()[0]), since)
+	if err != nil {
 		cmdError(c, fn, err)
 		return
 	}
-	cmdOutput(c, snaps)
+
+	cmdOutput(c, samples)
 }
 
-func (v *volDriver) snapDelete(c *cli.Context) {
-	fn := "delete"
+func (v *volDriver) volumeExport(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "export"
 	if len(c.Args()) < 1 {
-		missingParameter(c, fn, "snapID", "Invalid number of arguments")
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
 		return
 	}
-	v.volumeOptions(c)
-	snapID := c.Args()[0]
-	err := v.volDriver.SnapDelete(api.SnapID(snapID))
+	e, ok := v.volDriver.(volume.Exporter)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+		return
+	}
+	export, err := e.Export(api.VolumeID(c.Args()[0]), api.ExportProtocol(c.String("protocol")))
 	if err != nil {
 		cmdError(c, fn, err)
 		return
 	}
 
-	fmtOutput(c, &Format{UUID: []string{c.Args()[0]}})
+	cmdOutput(c, export)
+}
+
+func (v *volDriver) volumeUnexport(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "unexport"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
+		return
+	}
+	volumeID := c.Args()[0]
+	e, ok := v.volDriver.(volume.Exporter)
+	if !ok {
+		cmdError(c, fn, volume.ErrNotSupported)
+		return
+	}
+	err := e.Unexport(api.VolumeID(volumeID), api.ExportProtocol(c.String("protocol")))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{volumeID}})
+}
+
+func (v *volDriver) volumeDelete(c *cli.Context) {
+	fn := "delete"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
+		return
+	}
+	volumeID := c.Args()[0]
+	v.volumeOptions(c)
+	if len(c.Args()) > 1 && !c.Bool("force") {
+		v.volumeDeleteMany(c)
+		return
+	}
+	var err error
+	if c.Bool("force") {
+		err = volume.ForceDelete(v.volDriver, api.VolumeID(volumeID))
+	} else {
+		err = v.volDriver.Delete(api.VolumeID(volumeID))
+	}
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{c.Args()[0]}})
+}
+
+// volumeDeleteMany deletes the volumes of the arguments, in one request if
+// the driver is remote.
+func (v *volDriver) volumeDeleteMany(c *cli.Context) {
+	fn := "delete"
+	ids := make([]api.VolumeID, len(c.Args()))
+	for i, id := range c.Args() {
+		ids[i] = api.VolumeID(id)
+	}
+	var err error
+	if b, ok := v.volDriver.(volume.BulkRequester); ok {
+		err = b.DeleteMany(ids)
+	} else {
+		err = volume.DeleteMany(context.Background(), v.volDriver, ids)
+	}
+	failed, ok := err.(volume.BulkError)
+	if err != nil && !ok {
+		cmdError(c, fn, err)
+		return
+	}
+	out := &Format{Cmd: fn}
+	for _, id := range ids {
+		if _, ok := failed[id]; !ok {
+			out.UUID = append(out.UUID, string(id))
+		}
+	}
+	if err != nil {
+		out.Err = err.Error()
+	}
+	fmtOutput(c, out)
+}
+
+func (v *volDriver) snapCreate(c *cli.Context) {
+	var err error
+	var labels api.Labels
+	fn := "snapCreate"
+
+	if len(c.Args()) != 1 {
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
+		return
+	}
+	volumeID := api.VolumeID(c.Args()[0])
+
+	v.volumeOptions(c)
+	if l := c.String("label"); l != "" {
+		if labels, err = processLabels(l); err != nil {
+			cmdError(c, fn, err)
+			return
+		}
+	}
+	id, err := v.volDriver.Snapshot(volumeID, labels, c.Bool("writable"))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{string(id)}})
+}
+
+func (v *volDriver) snapGroup(c *cli.Context) {
+	var err error
+	var labels api.Labels
+	fn := "snapGroup"
+
+	if len(c.Args()) != 1 {
+		missingParameter(c, fn, "group", "Invalid number of arguments")
+		return
+	}
+
+	v.volumeOptions(c)
+	if l := c.String("label"); l != "" {
+		if labels, err = processLabels(l); err != nil {
+			cmdError(c, fn, err)
+			return
+		}
+	}
+	snaps, err := volume.SnapshotGroup(context.Background(), v.volDriver, c.Args()[0], labels)
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	ids := make([]string, 0, len(snaps))
+	for _, id := range snaps {
+		ids = append(ids, string(id))
+	}
+	fmtOutput(c, &Format{UUID: ids})
+}
+
+func (v *volDriver) snapInspect(c *cli.Context) {
+
+	v.volumeOptions(c)
+	fn := "inspect"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "snapID", "Invalid number of arguments")
+		return
+	}
+	d := make([]api.SnapID, len(c.Args()))
+	for i, v := range c.Args() {
+		d[i] = api.SnapID(v)
+	}
+
+	snaps, err := v.volDriver.SnapInspect(d)
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, snaps)
+}
+
+func (v *volDriver) snapEnumerate(c *cli.Context) {
+	var locator api.VolumeLocator
+	var err error
+
+	fn := "enumerate"
+	locator.Name = c.String("name")
+	if l := c.String("label"); l != "" {
+		locator.VolumeLabels, err = processLabels(l)
+		if err != nil {
+			cmdError(c, fn, err)
+			return
+		}
+	}
+
+	v.volumeOptions(c)
+	snaps, err := v.volDriver.Enumerate(locator, nil)
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+	if snaps == nil {
+		cmdError(c, fn, err)
+		return
+	}
+	cmdOutput(c, snaps)
+}
+
+func (v *volDriver) snapProtect(c *cli.Context) {
+	fn := "snapProtect"
+	if len(c.Args()) != 1 {
+		missingParameter(c, fn, "snapID", "Invalid number of arguments")
+		return
+	}
+	v.volumeOptions(c)
+	snapID := c.Args()[0]
+	if err := volume.ProtectSnap(v.volDriver, api.SnapID(snapID), !c.Bool("off")); err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{snapID}})
+}
+
+func (v *volDriver) snapDelete(c *cli.Context) {
+	fn := "delete"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "snapID", "Invalid number of arguments")
+		return
+	}
+	v.volumeOptions(c)
+	snapID := c.Args()[0]
+	err := v.volDriver.SnapDelete(api.SnapID(snapID))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{c.Args()[0]}})
+}
+
+// archiveFlags locate snapshots exported to object stores.
+var archiveFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "store",
+		Usage: "object driver instance of the object store",
+	},
+	cli.StringFlag{
+		Name:  "bucket",
+		Usage: "bucket of the export",
+	},
+	cli.StringFlag{
+		Name:  "prefix",
+		Usage: "key prefix of the export within the bucket",
+	},
+}
+
+func archiveLocation(c *cli.Context) api.SnapArchiveLocation {
+	return api.SnapArchiveLocation{
+		Store:  c.String("store"),
+		Bucket: c.String("bucket"),
+		Prefix: c.String("prefix"),
+	}
+}
+
+func (v *volDriver) snapExport(c *cli.Context) {
+	fn := "snapExport"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "snapID", "Invalid number of arguments")
+		return
+	}
+	v.volumeOptions(c)
+	archive, err := volume.ExportSnap(context.Background(), v.volDriver,
+		api.SnapID(c.Args()[0]), archiveLocation(c))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, archive)
+}
+
+func (v *volDriver) snapImport(c *cli.Context) {
+	fn := "snapImport"
+	v.volumeOptions(c)
+	locator := api.VolumeLocator{Name: c.String("name")}
+	id, err := volume.ImportSnap(context.Background(), v.volDriver, archiveLocation(c), locator)
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{string(id)}})
 }
 
 // BlockVolumeCommands exports CLI comamnds for a Block VolumeDriver.
@@ -374,6 +1045,21 @@ func BlockVolumeCommands(name string) []cli.Command {
 					Usage: "snapshot interval in minutes, 0 disables snaps",
 					Value: 0,
 				},
+				cli.StringFlag{
+					Name:  "opts,o",
+					Usage: "spec options, e.g size=10G,fs=ext4,ha=1,cos=high, overrides the other spec flags",
+					Value: "",
+				},
+				cli.StringFlag{
+					Name:  "profile,p",
+					Usage: "volume profile to create the volume from, --opts override the profile",
+					Value: "",
+				},
+				cli.StringFlag{
+					Name:  "group,g",
+					Usage: "group of volumes that are snapshotted together, e.g. the data and log volumes of a database",
+					Value: "",
+				},
 			},
 		},
 		{
@@ -392,6 +1078,14 @@ func BlockVolumeCommands(name string) []cli.Command {
 					Name:  "path,p",
 					Usage: "Path on local filesystem",
 				},
+				cli.BoolFlag{
+					Name:  "readonly,ro",
+					Usage: "attach read-only, allows attaching on multiple nodes",
+				},
+				cli.BoolFlag{
+					Name:  "shared",
+					Usage: "allow multiple nodes to attach read-write",
+				},
 			},
 		},
 		{
@@ -404,6 +1098,26 @@ func BlockVolumeCommands(name string) []cli.Command {
 					Name:  "path",
 					Usage: "destination path at which this volume must be mounted on",
 				},
+				cli.BoolFlag{
+					Name:  "readonly,r",
+					Usage: "mount the volume read-only",
+				},
+				cli.BoolFlag{
+					Name:  "remount",
+					Usage: "change the options of the mount at path instead of mounting again",
+				},
+				cli.StringFlag{
+					Name:  "selinux-label",
+					Usage: "relabel the files of the volume with this SELinux context",
+				},
+				cli.StringFlag{
+					Name:  "propagation",
+					Usage: "propagation of the mount: rprivate, rshared or rslave",
+				},
+				cli.StringFlag{
+					Name:  "subpath",
+					Usage: "mount only this directory of the volume, created if missing",
+				},
 			},
 		},
 		{
@@ -416,6 +1130,14 @@ func BlockVolumeCommands(name string) []cli.Command {
 					Name:  "path",
 					Usage: "destination path at which this volume must be mounted on",
 				},
+				cli.BoolFlag{
+					Name:  "force,f",
+					Usage: "lazily unmount even if the volume is busy",
+				},
+				cli.BoolFlag{
+					Name:  "kill,k",
+					Usage: "terminate the processes using the volume first",
+				},
 			},
 		},
 		{
@@ -423,12 +1145,28 @@ func BlockVolumeCommands(name string) []cli.Command {
 			Aliases: []string{"d"},
 			Usage:   "Detach specified volume",
 			Action:  v.volumeDetach,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force,f",
+					Usage: "unmount and detach even if the volume is in use",
+				},
+				cli.BoolFlag{
+					Name:  "kill,k",
+					Usage: "terminate the processes using the volume first",
+				},
+			},
 		},
 		{
 			Name:    "delete",
 			Aliases: []string{"rm"},
-			Usage:   "Detach specified volume",
+			Usage:   "Delete specified volumes",
 			Action:  v.volumeDelete,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force,f",
+					Usage: "delete the volume's snapshots first",
+				},
+			},
 		},
 		{
 			Name:    "enumerate",
@@ -444,6 +1182,15 @@ func BlockVolumeCommands(name string) []cli.Command {
 					Name:  "label,l",
 					Usage: "Comma separated name=value pairs, e.g name=sqlvolume,type=production",
 				},
+				cli.StringFlag{
+					Name:  "filter,f",
+					Usage: "Comma separated conditions, e.g state=attached,label.env=prod,status!=up",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "output format: json|yaml|csv|table",
+					Value: "json",
+				},
 			},
 		},
 		{
@@ -452,11 +1199,241 @@ func BlockVolumeCommands(name string) []cli.Command {
 			Usage:   "Inspect volume",
 			Action:  v.volumeInspect,
 		},
+		{
+			Name:    "graph",
+			Aliases: []string{"g"},
+			Usage:   "Show snapshots, clones and replicas that depend on a volume",
+			Action:  v.volumeGraph,
+		},
+		{
+			Name:   "catalog",
+			Usage:  "List files in a volume without mounting it: catalog volumeID [path]",
+			Action: v.volumeCatalog,
+		},
+		{
+			Name:   "fingerprint",
+			Usage:  "Hash the content of a volume to verify copies: fingerprint volumeID",
+			Action: v.volumeFingerprint,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "base,b",
+					Usage: "snapshot of the volume whose hashes are reused for unchanged files",
+				},
+			},
+		},
+		{
+			Name:   "mounts",
+			Usage:  "Show where a volume is mounted and the processes using it: mounts volumeID",
+			Action: v.volumeMounts,
+		},
+		{
+			Name:   "status",
+			Usage:  "Show the diagnostic status of the driver",
+			Action: v.volumeStatus,
+		},
+		{
+			Name:   "maintenance",
+			Usage:  "Freeze IO to specified volume for backend maintenance",
+			Action: v.volumeMaintenance,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "end,e",
+					Usage: "end the maintenance and make the volume writable again",
+				},
+			},
+		},
+		{
+			Name:   "restore",
+			Usage:  "Restore a deleted volume from the trash: restore volumeID",
+			Action: v.volumeRestore,
+		},
+		{
+			Name:   "resize",
+			Usage:  "Grow a volume and its filesystem: resize volumeID size, e.g. 20G",
+			Action: v.volumeResize,
+		},
+		{
+			Name:   "transfer",
+			Usage:  "Make another principal the owner of a volume: transfer volumeID owner",
+			Action: v.volumeTransfer,
+		},
+		{
+			Name:   "share",
+			Usage:  "Share a volume with another principal: share volumeID principal",
+			Action: v.volumeShare,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "access,a",
+					Usage: "access granted, read or write",
+					Value: string(api.AccessRead),
+				},
+				cli.BoolFlag{
+					Name:  "revoke",
+					Usage: "revoke the access of the principal",
+				},
+			},
+		},
+		{
+			Name:   "rename",
+			Usage:  "Rename a volume: rename volumeID name",
+			Action: v.volumeRename,
+		},
+		{
+			Name:   "trash",
+			Usage:  "List deleted volumes kept in the trash",
+			Action: v.volumeTrash,
+		},
+		{
+			Name:   "orphans",
+			Usage:  "List the storage of the driver that no volume references",
+			Action: v.volumeOrphans,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "reclaim",
+					Usage: "remove the orphans",
+				},
+			},
+		},
+		{
+			Name:   "rebalance",
+			Usage:  "Move volumes to even out the used space or IO of the backends of the driver",
+			Action: v.volumeRebalance,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "threshold,t",
+					Usage: "imbalance tolerated between backends, in percentage points",
+					Value: 10,
+				},
+				cli.IntFlag{
+					Name:  "max-moves,m",
+					Usage: "maximum number of volumes to move, 0 for no limit",
+				},
+				cli.BoolFlag{
+					Name:  "io",
+					Usage: "even out the IO of the backends instead of their used space",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run,n",
+					Usage: "only show the volumes that would be moved",
+				},
+				cli.BoolFlag{
+					Name:  "status,s",
+					Usage: "show the progress of the running or last rebalance",
+				},
+				cli.BoolFlag{
+					Name:  "cancel",
+					Usage: "cancel the running rebalance",
+				},
+			},
+		},
+		{
+			Name:   "audit",
+			Usage:  "Show the audit log of volume operations",
+			Action: v.volumeAudit,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "op",
+					Usage: "Only show operation, e.g. create, delete, attach, mount or snapshot",
+				},
+				cli.StringFlag{
+					Name:  "principal",
+					Usage: "Only show operations performed by principal",
+				},
+				cli.StringFlag{
+					Name:  "volume,v",
+					Usage: "Only show operations on volume ID",
+				},
+				cli.DurationFlag{
+					Name:  "since,s",
+					Usage: "Only show operations within this duration, e.g. 24h",
+				},
+				cli.IntFlag{
+					Name:  "limit,l",
+					Usage: "Show at most this many of the latest operations",
+				},
+			},
+		},
+		{
+			Name:   "logs",
+			Usage:  "Show the latest log entries of the driver",
+			Action: v.volumeLogs,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "level",
+					Usage: "Only show entries at or above level, e.g. warning",
+				},
+				cli.IntFlag{
+					Name:  "limit,l",
+					Usage: "Show at most this many of the latest entries",
+				},
+			},
+		},
+		{
+			Name:   "loglevel",
+			Usage:  "Show or change the log level of the driver: loglevel [debug|info|warning|error]",
+			Action: v.volumeLogLevel,
+		},
+		{
+			Name:   "history",
+			Usage:  "Show where and when a volume was last attached and mounted",
+			Action: v.volumeHistory,
+		},
+		{
+			Name:   "iostats",
+			Usage:  "Show the recent IO rates and latencies of a volume",
+			Action: v.volumeStatsHistory,
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "since",
+					Usage: "Only show samples taken in this duration, e.g. 15m",
+				},
+			},
+		},
+		{
+			Name:   "export",
+			Usage:  "Export a block volume to remote hosts",
+			Action: v.volumeExport,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "protocol,p",
+					Usage: "Export protocol, iscsi or nvmeof",
+					Value: string(api.ProtocolISCSI),
+				},
+			},
+		},
+		{
+			Name:   "unexport",
+			Usage:  "Remove the export of a volume",
+			Action: v.volumeUnexport,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "protocol,p",
+					Usage: "Export protocol, iscsi or nvmeof",
+					Value: string(api.ProtocolISCSI),
+				},
+			},
+		},
 		{
 			Name:    "snap",
 			Aliases: []string{"sc"},
 			Usage:   "create snap",
 			Action:  v.snapCreate,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "label,l",
+					Usage: "Comma separated name=value pairs, e.g name=sqlvolume,type=production",
+				},
+				cli.BoolFlag{
+					Name:  "writable,w",
+					Usage: "Create a writable clone that can be mounted",
+				},
+			},
+		},
+		{
+			Name:    "snapGroup",
+			Aliases: []string{"sg"},
+			Usage:   "create snaps of all volumes in a group",
+			Action:  v.snapGroup,
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:  "label,l",
@@ -492,6 +1469,39 @@ func BlockVolumeCommands(name string) []cli.Command {
 			Usage:   "Delete snap",
 			Action:  v.snapDelete,
 		},
+		{
+			Name:   "snapProtect",
+			Usage:  "Pin a snap so that retention policies never delete it",
+			Action: v.snapProtect,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "off",
+					Usage: "unpin the snap",
+				},
+			},
+		},
+		{
+			Name:        "cloudsnap",
+			Usage:       "Manage the snapshots uploaded to object stores",
+			Subcommands: cloudSnapCommands(v),
+		},
+		{
+			Name:   "snapExport",
+			Usage:  "Export a snapshot to an object store: snapExport snapID",
+			Action: v.snapExport,
+			Flags:  archiveFlags,
+		},
+		{
+			Name:   "snapImport",
+			Usage:  "Create a volume from a snapshot exported to an object store",
+			Action: v.snapImport,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "name",
+					Usage: "name of the new volume, the name of the exported volume if not set",
+				},
+			}, archiveFlags...),
+		},
 	}
 	return commands
 }
@@ -542,6 +1552,21 @@ func FileVolumeCommands(name string) []cli.Command {
 					Usage: "snapshot interval in minutes, 0 disables snaps",
 					Value: 0,
 				},
+				cli.StringFlag{
+					Name:  "opts,o",
+					Usage: "spec options, e.g size=10G,fs=ext4,ha=1,cos=high, overrides the other spec flags",
+					Value: "",
+				},
+				cli.StringFlag{
+					Name:  "profile,p",
+					Usage: "volume profile to create the volume from, --opts override the profile",
+					Value: "",
+				},
+				cli.StringFlag{
+					Name:  "group,g",
+					Usage: "group of volumes that are snapshotted together, e.g. the data and log volumes of a database",
+					Value: "",
+				},
 			},
 		},
 		{
@@ -554,6 +1579,26 @@ func FileVolumeCommands(name string) []cli.Command {
 					Name:  "path",
 					Usage: "destination path at which this volume must be mounted on",
 				},
+				cli.BoolFlag{
+					Name:  "readonly,r",
+					Usage: "mount the volume read-only",
+				},
+				cli.BoolFlag{
+					Name:  "remount",
+					Usage: "change the options of the mount at path instead of mounting again",
+				},
+				cli.StringFlag{
+					Name:  "selinux-label",
+					Usage: "relabel the files of the volume with this SELinux context",
+				},
+				cli.StringFlag{
+					Name:  "propagation",
+					Usage: "propagation of the mount: rprivate, rshared or rslave",
+				},
+				cli.StringFlag{
+					Name:  "subpath",
+					Usage: "mount only this directory of the volume, created if missing",
+				},
 			},
 		},
 		{
@@ -566,13 +1611,27 @@ func FileVolumeCommands(name string) []cli.Command {
 					Name:  "path",
 					Usage: "destination path at which this volume must be mounted on",
 				},
+				cli.BoolFlag{
+					Name:  "force,f",
+					Usage: "lazily unmount even if the volume is busy",
+				},
+				cli.BoolFlag{
+					Name:  "kill,k",
+					Usage: "terminate the processes using the volume first",
+				},
 			},
 		},
 		{
 			Name:    "delete",
 			Aliases: []string{"rm"},
-			Usage:   "Detach specified volume",
+			Usage:   "Delete specified volumes",
 			Action:  v.volumeDelete,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force,f",
+					Usage: "delete the volume's snapshots first",
+				},
+			},
 		},
 		{
 			Name:    "enumerate",
@@ -588,6 +1647,15 @@ func FileVolumeCommands(name string) []cli.Command {
 					Name:  "label,l",
 					Usage: "Comma separated name=value pairs, e.g name=sqlvolume,type=production",
 				},
+				cli.StringFlag{
+					Name:  "filter,f",
+					Usage: "Comma separated conditions, e.g state=attached,label.env=prod,status!=up",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "output format: json|yaml|csv|table",
+					Value: "json",
+				},
 			},
 		},
 		{
@@ -596,11 +1664,241 @@ func FileVolumeCommands(name string) []cli.Command {
 			Usage:   "Inspect volume",
 			Action:  v.volumeInspect,
 		},
+		{
+			Name:    "graph",
+			Aliases: []string{"g"},
+			Usage:   "Show snapshots, clones and replicas that depend on a volume",
+			Action:  v.volumeGraph,
+		},
+		{
+			Name:   "catalog",
+			Usage:  "List files in a volume without mounting it: catalog volumeID [path]",
+			Action: v.volumeCatalog,
+		},
+		{
+			Name:   "fingerprint",
+			Usage:  "Hash the content of a volume to verify copies: fingerprint volumeID",
+			Action: v.volumeFingerprint,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "base,b",
+					Usage: "snapshot of the volume whose hashes are reused for unchanged files",
+				},
+			},
+		},
+		{
+			Name:   "mounts",
+			Usage:  "Show where a volume is mounted and the processes using it: mounts volumeID",
+			Action: v.volumeMounts,
+		},
+		{
+			Name:   "status",
+			Usage:  "Show the diagnostic status of the driver",
+			Action: v.volumeStatus,
+		},
+		{
+			Name:   "maintenance",
+			Usage:  "Freeze IO to specified volume for backend maintenance",
+			Action: v.volumeMaintenance,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "end,e",
+					Usage: "end the maintenance and make the volume writable again",
+				},
+			},
+		},
+		{
+			Name:   "restore",
+			Usage:  "Restore a deleted volume from the trash: restore volumeID",
+			Action: v.volumeRestore,
+		},
+		{
+			Name:   "resize",
+			Usage:  "Grow a volume and its filesystem: resize volumeID size, e.g. 20G",
+			Action: v.volumeResize,
+		},
+		{
+			Name:   "transfer",
+			Usage:  "Make another principal the owner of a volume: transfer volumeID owner",
+			Action: v.volumeTransfer,
+		},
+		{
+			Name:   "share",
+			Usage:  "Share a volume with another principal: share volumeID principal",
+			Action: v.volumeShare,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "access,a",
+					Usage: "access granted, read or write",
+					Value: string(api.AccessRead),
+				},
+				cli.BoolFlag{
+					Name:  "revoke",
+					Usage: "revoke the access of the principal",
+				},
+			},
+		},
+		{
+			Name:   "rename",
+			Usage:  "Rename a volume: rename volumeID name",
+			Action: v.volumeRename,
+		},
+		{
+			Name:   "trash",
+			Usage:  "List deleted volumes kept in the trash",
+			Action: v.volumeTrash,
+		},
+		{
+			Name:   "orphans",
+			Usage:  "List the storage of the driver that no volume references",
+			Action: v.volumeOrphans,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "reclaim",
+					Usage: "remove the orphans",
+				},
+			},
+		},
+		{
+			Name:   "rebalance",
+			Usage:  "Move volumes to even out the used space or IO of the backends of the driver",
+			Action: v.volumeRebalance,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "threshold,t",
+					Usage: "imbalance tolerated between backends, in percentage points",
+					Value: 10,
+				},
+				cli.IntFlag{
+					Name:  "max-moves,m",
+					Usage: "maximum number of volumes to move, 0 for no limit",
+				},
+				cli.BoolFlag{
+					Name:  "io",
+					Usage: "even out the IO of the backends instead of their used space",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run,n",
+					Usage: "only show the volumes that would be moved",
+				},
+				cli.BoolFlag{
+					Name:  "status,s",
+					Usage: "show the progress of the running or last rebalance",
+				},
+				cli.BoolFlag{
+					Name:  "cancel",
+					Usage: "cancel the running rebalance",
+				},
+			},
+		},
+		{
+			Name:   "audit",
+			Usage:  "Show the audit log of volume operations",
+			Action: v.volumeAudit,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "op",
+					Usage: "Only show operation, e.g. create, delete, attach, mount or snapshot",
+				},
+				cli.StringFlag{
+					Name:  "principal",
+					Usage: "Only show operations performed by principal",
+				},
+				cli.StringFlag{
+					Name:  "volume,v",
+					Usage: "Only show operations on volume ID",
+				},
+				cli.DurationFlag{
+					Name:  "since,s",
+					Usage: "Only show operations within this duration, e.g. 24h",
+				},
+				cli.IntFlag{
+					Name:  "limit,l",
+					Usage: "Show at most this many of the latest operations",
+				},
+			},
+		},
+		{
+			Name:   "logs",
+			Usage:  "Show the latest log entries of the driver",
+			Action: v.volumeLogs,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "level",
+					Usage: "Only show entries at or above level, e.g. warning",
+				},
+				cli.IntFlag{
+					Name:  "limit,l",
+					Usage: "Show at most this many of the latest entries",
+				},
+			},
+		},
+		{
+			Name:   "loglevel",
+			Usage:  "Show or change the log level of the driver: loglevel [debug|info|warning|error]",
+			Action: v.volumeLogLevel,
+		},
+		{
+			Name:   "history",
+			Usage:  "Show where and when a volume was last attached and mounted",
+			Action: v.volumeHistory,
+		},
+		{
+			Name:   "iostats",
+			Usage:  "Show the recent IO rates and latencies of a volume",
+			Action: v.volumeStatsHistory,
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "since",
+					Usage: "Only show samples taken in this duration, e.g. 15m",
+				},
+			},
+		},
+		{
+			Name:   "export",
+			Usage:  "Export a block volume to remote hosts",
+			Action: v.volumeExport,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "protocol,p",
+					Usage: "Export protocol, iscsi or nvmeof",
+					Value: string(api.ProtocolISCSI),
+				},
+			},
+		},
+		{
+			Name:   "unexport",
+			Usage:  "Remove the export of a volume",
+			Action: v.volumeUnexport,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "protocol,p",
+					Usage: "Export protocol, iscsi or nvmeof",
+					Value: string(api.ProtocolISCSI),
+				},
+			},
+		},
 		{
 			Name:    "snap",
 			Aliases: []string{"sc"},
 			Usage:   "create snap",
 			Action:  v.snapCreate,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "label,l",
+					Usage: "Comma separated name=value pairs, e.g name=sqlvolume,type=production",
+				},
+				cli.BoolFlag{
+					Name:  "writable,w",
+					Usage: "Create a writable clone that can be mounted",
+				},
+			},
+		},
+		{
+			Name:    "snapGroup",
+			Aliases: []string{"sg"},
+			Usage:   "create snaps of all volumes in a group",
+			Action:  v.snapGroup,
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:  "label,l",
@@ -636,6 +1934,39 @@ func FileVolumeCommands(name string) []cli.Command {
 			Usage:   "Delete snap",
 			Action:  v.snapDelete,
 		},
+		{
+			Name:   "snapProtect",
+			Usage:  "Pin a snap so that retention policies never delete it",
+			Action: v.snapProtect,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "off",
+					Usage: "unpin the snap",
+				},
+			},
+		},
+		{
+			Name:        "cloudsnap",
+			Usage:       "Manage the snapshots uploaded to object stores",
+			Subcommands: cloudSnapCommands(v),
+		},
+		{
+			Name:   "snapExport",
+			Usage:  "Export a snapshot to an object store: snapExport snapID",
+			Action: v.snapExport,
+			Flags:  archiveFlags,
+		},
+		{
+			Name:   "snapImport",
+			Usage:  "Create a volume from a snapshot exported to an object store",
+			Action: v.snapImport,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "name",
+					Usage: "name of the new volume, the name of the exported volume if not set",
+				},
+			}, archiveFlags...),
+		},
 	}
 	return commands
 }
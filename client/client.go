@@ -2,11 +2,15 @@ package client
 
 import (
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/libopenstorage/openstorage/api"
 	"github.com/libopenstorage/openstorage/config"
 	"github.com/libopenstorage/openstorage/volume"
 )
@@ -17,6 +21,7 @@ type Client struct {
 	base       *url.URL
 	version    string
 	httpClient *http.Client
+	token      string
 }
 
 // VolumeDriver returns REST wrapper for the VolumeDriver interface.
@@ -31,24 +36,181 @@ func (c *Client) Status() (*Status, error) {
 	return &status, err
 }
 
+// ClusterCapacity returns the capacity of the drivers of all nodes of the
+// cluster the server belongs to.
+func (c *Client) ClusterCapacity() (*api.ClusterCapacity, error) {
+	var capacity api.ClusterCapacity
+	if err := c.Get().Resource("/cluster/capacity").Do().Unmarshal(&capacity); err != nil {
+		return nil, err
+	}
+	return &capacity, nil
+}
+
+// Drivers lists the driver instances running on a daemon. The client must
+// be one of NewManagerClient.
+func (c *Client) Drivers() ([]api.DriverInstance, error) {
+	var instances []api.DriverInstance
+	if err := c.Get().Resource("/drivers").Do().Unmarshal(&instances); err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// AddDriver starts driver instance name with params on a running daemon and
+// serves its API.
+func (c *Client) AddDriver(name string, params map[string]string) error {
+	var response api.VolumeResponse
+	req := &api.DriverCreateRequest{Name: name, Params: params}
+	if err := c.Post().Resource("/drivers").Body(req).Do().Unmarshal(&response); err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// RemoveDriver shuts down driver name on a running daemon. Drivers with
+// volumes in use are only removed if force is set.
+func (c *Client) RemoveDriver(name string, force bool) error {
+	var response api.VolumeResponse
+	err := c.Delete().Resource("/drivers").Instance(name).
+		QueryOption(string(api.OptForce), strconv.FormatBool(force)).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// Bandwidth returns the bandwidth limits of background data movement on a
+// daemon. The client must be one of NewManagerClient.
+func (c *Client) Bandwidth() (api.BandwidthLimits, error) {
+	var limits api.BandwidthLimits
+	if err := c.Get().Resource("/bandwidth").Do().Unmarshal(&limits); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// SetBandwidth changes the bandwidth limits of the classes in limits on a
+// running daemon, a limit of 0 removes the limit of a class.
+func (c *Client) SetBandwidth(limits api.BandwidthLimits) error {
+	var response api.VolumeResponse
+	if err := c.Put().Resource("/bandwidth").Body(limits).Do().Unmarshal(&response); err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// ClusterStatus returns the state of the cluster of a daemon. The client
+// must be one of NewManagerClient.
+func (c *Client) ClusterStatus() (*api.ClusterStatus, error) {
+	var status api.ClusterStatus
+	if err := c.Get().Resource("/cluster/status").Do().Unmarshal(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ClusterNodes returns the nodes of the cluster of a daemon. The client
+// must be one of NewManagerClient.
+func (c *Client) ClusterNodes() ([]api.ClusterNode, error) {
+	var nodes []api.ClusterNode
+	if err := c.Get().Resource("/cluster/nodes").Do().Unmarshal(&nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// ClusterNode returns the node nodeID of the cluster of a daemon.
+func (c *Client) ClusterNode(nodeID string) (*api.ClusterNode, error) {
+	var node api.ClusterNode
+	if err := c.Get().Resource("/cluster/nodes").Instance(nodeID).Do().Unmarshal(&node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// RemoveClusterNode decommissions the node nodeID. Nodes holding the only
+// in sync copy of volumes are only removed if force is set.
+func (c *Client) RemoveClusterNode(nodeID string, force bool) error {
+	var response api.VolumeResponse
+	err := c.Delete().Resource("/cluster/nodes").Instance(nodeID).
+		QueryOption(string(api.OptForce), strconv.FormatBool(force)).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// Negotiate switches the client to the newest API version supported by both
+// the client and the server. Servers that predate version negotiation only
+// serve v1.
+func (c *Client) Negotiate() error {
+	var server api.VersionRange
+	req := c.Get()
+	// The supported versions are served outside of any version.
+	req.version = ""
+	resp := req.Resource("/versions").Do()
+	if resp.StatusCode() == http.StatusNotFound {
+		server = api.VersionRange{Min: "v1", Max: "v1"}
+	} else if err := resp.Unmarshal(&server); err != nil {
+		return err
+	}
+	versions, ok := server.Intersect(api.VersionRange{Min: api.MinVersion, Max: api.Version})
+	if !ok {
+		return fmt.Errorf("No API version in common with the server, which supports %s to %s",
+			server.Min, server.Max)
+	}
+	c.version = versions.Max
+	return nil
+}
+
+// Version returns the API version of the requests of the client.
+func (c *Client) Version() string {
+	return c.version
+}
+
 // Get returns a Request object setup for GET call.
 func (c *Client) Get() *Request {
-	return NewRequest(c.httpClient, c.base, "GET", c.version)
+	return c.newRequest("GET")
 }
 
 // Post returns a Request object setup for POST call.
 func (c *Client) Post() *Request {
-	return NewRequest(c.httpClient, c.base, "POST", c.version)
+	return c.newRequest("POST")
 }
 
 // Put returns a Request object setup for PUT call.
 func (c *Client) Put() *Request {
-	return NewRequest(c.httpClient, c.base, "PUT", c.version)
+	return c.newRequest("PUT")
 }
 
 // Put returns a Request object setup for DELETE call.
 func (c *Client) Delete() *Request {
-	return NewRequest(c.httpClient, c.base, "DELETE", c.version)
+	return c.newRequest("DELETE")
+}
+
+func (c *Client) newRequest(verb string) *Request {
+	r := NewRequest(c.httpClient, c.base, verb, c.version)
+	if c.token != "" {
+		r.SetHeader("Authorization", "Bearer "+c.token)
+	}
+	return r
+}
+
+// SetToken sets the bearer token sent with every request.
+func (c *Client) SetToken(token string) {
+	c.token = token
 }
 
 func newHTTPClient(u *url.URL, tlsConfig *tls.Config, timeout time.Duration) *http.Client {
@@ -96,8 +258,39 @@ func NewClient(host string, version string) (*Client, error) {
 	return c, nil
 }
 
+// NewTLSClient returns a new REST client for a server that requires TLS.
+// tlsConfig may carry a client certificate.
+func NewTLSClient(host string, version string, tlsConfig *tls.Config) (*Client, error) {
+	baseURL, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	if baseURL.Path == "" {
+		baseURL.Path = "/"
+	}
+	c := &Client{
+		base:       baseURL,
+		version:    version,
+		httpClient: newHTTPClient(baseURL, tlsConfig, 10*time.Second),
+	}
+	return c, nil
+}
+
+// NewManagerClient returns a new REST client for the driver manager of the
+// local daemon.
+func NewManagerClient() (*Client, error) {
+	sockPath := "unix://" + config.DriverAPIBase + "osd.sock"
+	return NewClient(sockPath, config.Version)
+}
+
 // NewDriver returns a new REST client for specified driver.
 func NewDriverClient(driverName string) (*Client, error) {
 	sockPath := "unix://" + config.DriverAPIBase + driverName + ".sock"
-	return NewClient(sockPath, config.Version)
+	c, err := NewClient(sockPath, config.Version)
+	if err != nil {
+		return nil, err
+	}
+	// A server that cannot be reached fails the first request instead.
+	c.Negotiate()
+	return c, nil
 }
@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -11,6 +12,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/libopenstorage/openstorage/tracing"
 )
 
 // Request is contructed iteratively by the client and finally dispatched.
@@ -31,6 +34,7 @@ type Request struct {
 	req      *http.Request
 	resp     *http.Response
 	timeout  time.Duration
+	ctx      context.Context
 }
 
 // Response is a representation of HTTP response received from the server.
@@ -148,6 +152,16 @@ func (r *Request) Timeout(d time.Duration) *Request {
 	return r
 }
 
+// Context makes the request abort when ctx is cancelled or its deadline
+// expires.
+func (r *Request) Context(ctx context.Context) *Request {
+	if r.err != nil {
+		return r
+	}
+	r.ctx = ctx
+	return r
+}
+
 // Body sets the request Body.
 func (r *Request) Body(v interface{}) *Request {
 	var err error
@@ -252,11 +266,17 @@ func (r *Request) Do() *Response {
 	if err != nil {
 		goto done
 	}
+	if r.ctx != nil {
+		req = req.WithContext(r.ctx)
+	}
 	if r.headers == nil {
 		r.headers = http.Header{}
 	}
 	req.Header = r.headers
 	req.Header.Set("Content-Type", "application/json")
+	if r.ctx != nil {
+		tracing.Inject(r.ctx, req.Header)
+	}
 	resp, err = r.client.Do(req)
 	if err != nil {
 		goto done
@@ -279,7 +299,7 @@ func (r *Request) Do() *Response {
 
 done:
 	if err != nil {
-		return &Response{err: r.err}
+		return &Response{err: err}
 	}
 	return response
 }
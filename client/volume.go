@@ -1,8 +1,15 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+
 	"github.com/libopenstorage/openstorage/api"
 	"github.com/libopenstorage/openstorage/volume"
 )
@@ -26,8 +33,20 @@ func (v *volumeClient) Type() volume.DriverType {
 }
 
 const (
-	volumePath = "/volumes"
-	snapPath   = "/snapshot"
+	volumePath    = "/volumes"
+	snapPath      = "/snapshot"
+	auditPath     = "/audit"
+	trashPath     = "/trash"
+	healthPath    = "/health"
+	statusPath    = "/status"
+	profilePath   = "/profiles"
+	quotaPath     = "/quotas"
+	rebalancePath = "/rebalance"
+	orphansPath   = "/orphans"
+	gcPath        = "/gc"
+	cloudSnapPath = "/cloudsnaps"
+	logLevelPath  = "/loglevel"
+	logsPath      = "/debug/logs"
 )
 
 // Create a new Vol for the specific volume spev.c.
@@ -38,6 +57,13 @@ const (
 func (v *volumeClient) Create(locator api.VolumeLocator,
 	options *api.CreateOptions,
 	spec *api.VolumeSpec) (api.VolumeID, error) {
+	return v.CreateCtx(context.Background(), locator, options, spec)
+}
+
+// CreateCtx is Create bounded by ctx.
+func (v *volumeClient) CreateCtx(ctx context.Context, locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
 
 	var response api.VolumeCreateResponse
 	createReq := api.VolumeCreateRequest{
@@ -45,24 +71,65 @@ func (v *volumeClient) Create(locator api.VolumeLocator,
 		Options: options,
 		Spec:    spec,
 	}
-	err := v.c.Post().Resource(volumePath).Body(&createReq).Do().Unmarshal(&response)
+	err := v.c.Post().Resource(volumePath).Body(&createReq).Context(ctx).Do().Unmarshal(&response)
 	if err != nil {
 		return api.VolumeID(""), err
 	}
+	if len(response.FieldErrors) > 0 {
+		return api.VolumeID(""), volume.ValidationError(response.FieldErrors)
+	}
 	if response.Error != "" {
 		return api.VolumeID(""), errors.New(response.Error)
 	}
 	return response.ID, nil
 }
 
-// Status diagnostic information
-func (v *volumeClient) Status() [][2]string {
-	return [][2]string{}
+// Status diagnostic information of the driver on the server, empty if it
+// cannot be reached.
+func (v *volumeClient) Status() api.DriverStatus {
+	var status api.DriverStatus
+	if v.c.version == "v1" {
+		// v1 servers report the status as key value pairs.
+		if err := v.c.Get().Resource(statusPath).Do().Unmarshal(&status.Details); err != nil {
+			return api.DriverStatus{}
+		}
+		return status
+	}
+	if err := v.c.Get().Resource(statusPath).Do().Unmarshal(&status); err != nil {
+		return api.DriverStatus{}
+	}
+	return status
+}
+
+// HealthCheck returns the failed health checks of the driver on the server.
+func (v *volumeClient) HealthCheck() []api.HealthReason {
+	var h api.DriverHealth
+	if err := v.c.Get().Resource(healthPath).Do().Unmarshal(&h); err != nil {
+		return []api.HealthReason{{Check: "api", State: api.HealthDown, Message: err.Error()}}
+	}
+	return h.Reasons
 }
 
 // Inspect specified volumes.
 // Errors ErrEnoEnt may be returned.
 func (v *volumeClient) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
+	return v.inspect(context.Background(), ids, "")
+}
+
+// InspectAt inspects specified volumes at the requested read consistency.
+// Errors ErrEnoEnt may be returned.
+func (v *volumeClient) InspectAt(ids []api.VolumeID, c api.Consistency) ([]api.Volume, error) {
+	return v.inspect(context.Background(), ids, c)
+}
+
+// InspectCtx is Inspect bounded by ctx.
+func (v *volumeClient) InspectCtx(ctx context.Context, ids []api.VolumeID) ([]api.Volume, error) {
+	return v.inspect(ctx, ids, "")
+}
+
+func (v *volumeClient) inspect(ctx context.Context,
+	ids []api.VolumeID,
+	c api.Consistency) ([]api.Volume, error) {
 	var vols []api.Volume
 
 	if len(ids) == 0 {
@@ -73,7 +140,10 @@ func (v *volumeClient) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
 	for _, v := range ids {
 		req.QueryOption(string(api.OptVolumeID), string(v))
 	}
-	err := req.Do().Unmarshal(&vols)
+	if c != "" {
+		req.QueryOption(string(api.OptConsistency), string(c))
+	}
+	err := req.Context(ctx).Do().Unmarshal(&vols)
 	if err != nil {
 		return nil, err
 	}
@@ -83,10 +153,15 @@ func (v *volumeClient) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
 // Delete volume.
 // Errors ErrEnoEnt, ErrVolHasSnaps may be returned.
 func (v *volumeClient) Delete(volumeID api.VolumeID) error {
+	return v.DeleteCtx(context.Background(), volumeID)
+}
+
+// DeleteCtx is Delete bounded by ctx.
+func (v *volumeClient) DeleteCtx(ctx context.Context, volumeID api.VolumeID) error {
 
 	var response api.VolumeResponse
 
-	err := v.c.Delete().Resource(volumePath).Instance(string(volumeID)).Do().Unmarshal(&response)
+	err := v.c.Delete().Resource(volumePath).Instance(string(volumeID)).Context(ctx).Do().Unmarshal(&response)
 	if err != nil {
 		return err
 	}
@@ -99,14 +174,20 @@ func (v *volumeClient) Delete(volumeID api.VolumeID) error {
 // Snap specified volume. IO to the underlying volume should be quiesced before
 // calling this function.
 // Errors ErrEnoEnt may be returned
-func (v *volumeClient) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+func (v *volumeClient) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	return v.SnapshotCtx(context.Background(), volumeID, labels, writable)
+}
+
+// SnapshotCtx is Snapshot bounded by ctx.
+func (v *volumeClient) SnapshotCtx(ctx context.Context, volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
 
 	var response api.SnapCreateResponse
 	createReq := api.SnapCreateRequest{
-		ID:     volumeID,
-		Labels: labels,
+		ID:       volumeID,
+		Labels:   labels,
+		Writable: writable,
 	}
-	err := v.c.Post().Resource(snapPath).Body(&createReq).Do().Unmarshal(&response)
+	err := v.c.Post().Resource(snapPath).Body(&createReq).Context(ctx).Do().Unmarshal(&response)
 	if err != nil {
 		return api.SnapID(""), err
 	}
@@ -116,12 +197,106 @@ func (v *volumeClient) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.S
 	return response.ID, nil
 }
 
+// SnapshotGroup snapshots every volume in group with labels and returns the
+// snaps by volume.
+// Errors ErrEnoEnt may be returned
+func (v *volumeClient) SnapshotGroup(group string, labels api.Labels) (map[api.VolumeID]api.SnapID, error) {
+	var response api.GroupSnapCreateResponse
+	createReq := api.GroupSnapCreateRequest{
+		Group:  group,
+		Labels: labels,
+	}
+	err := v.c.Post().Resource(snapPath + "/group").Body(&createReq).Do().Unmarshal(&response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+	return response.Snaps, nil
+}
+
+// bulk posts a bulk request for volumeIDs to path.
+// Errors volume.BulkError may be returned.
+func (v *volumeClient) bulk(path string, req *api.VolumeBulkRequest) (*api.VolumeBulkResponse, error) {
+	var response api.VolumeBulkResponse
+	if err := v.c.Post().Resource(path).Body(req).Do().Unmarshal(&response); err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+	if len(response.Errors) != 0 {
+		failed := make(volume.BulkError, len(response.Errors))
+		for id, e := range response.Errors {
+			failed[id] = errors.New(e)
+		}
+		return &response, failed
+	}
+	return &response, nil
+}
+
+// DeleteMany deletes volumeIDs in one request.
+// Errors volume.BulkError may be returned.
+func (v *volumeClient) DeleteMany(volumeIDs []api.VolumeID) error {
+	_, err := v.bulk(volumePath+"/bulk/delete", &api.VolumeBulkRequest{IDs: volumeIDs})
+	return err
+}
+
+// SnapshotMany snapshots volumeIDs with labels in one request and returns
+// the snaps by volume.
+// Errors volume.BulkError may be returned.
+func (v *volumeClient) SnapshotMany(volumeIDs []api.VolumeID,
+	labels api.Labels,
+	writable bool) (map[api.VolumeID]api.SnapID, error) {
+	res, err := v.bulk(snapPath+"/bulk", &api.VolumeBulkRequest{
+		IDs:      volumeIDs,
+		Labels:   labels,
+		Writable: writable,
+	})
+	if res == nil {
+		return nil, err
+	}
+	return res.Snaps, err
+}
+
+// InspectMany inspects volumeIDs in one request.
+// Errors volume.BulkError may be returned.
+func (v *volumeClient) InspectMany(volumeIDs []api.VolumeID) ([]api.Volume, error) {
+	res, err := v.bulk(volumePath+"/bulk/inspect", &api.VolumeBulkRequest{IDs: volumeIDs})
+	if res == nil {
+		return nil, err
+	}
+	return res.Volumes, err
+}
+
 // SnapDelete snap specified by snapID.
 // Errors ErrEnoEnt may be returned
 func (v *volumeClient) SnapDelete(snapID api.SnapID) error {
+	return v.SnapDeleteCtx(context.Background(), snapID)
+}
+
+// SnapDeleteCtx is SnapDelete bounded by ctx.
+func (v *volumeClient) SnapDeleteCtx(ctx context.Context, snapID api.SnapID) error {
 	var response api.VolumeResponse
 
-	err := v.c.Delete().Resource(snapPath).Instance(string(snapID)).Do().Unmarshal(&response)
+	err := v.c.Delete().Resource(snapPath).Instance(string(snapID)).Context(ctx).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// ProtectSnap pins a snapshot so that retention policies never delete it, or
+// unpins it if protected is false.
+// Errors ErrEnoEnt, ErrNotSupported may be returned.
+func (v *volumeClient) ProtectSnap(snapID api.SnapID, protected bool) error {
+	var response api.VolumeResponse
+	req := &api.SnapProtectRequest{Protected: protected}
+	err := v.c.Put().Resource(snapPath + "/protect").Instance(string(snapID)).Body(req).Do().Unmarshal(&response)
 	if err != nil {
 		return err
 	}
@@ -131,6 +306,33 @@ func (v *volumeClient) SnapDelete(snapID api.SnapID) error {
 	return nil
 }
 
+// History returns the latest attaches, detaches, mounts and unmounts of
+// volumeID, oldest first.
+// Errors ErrEnoEnt may be returned.
+func (v *volumeClient) History(volumeID api.VolumeID) ([]api.UsageEvent, error) {
+	var events []api.UsageEvent
+	err := v.c.Get().Resource(volumePath + "/history").Instance(string(volumeID)).Do().Unmarshal(&events)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// StatsHistory returns the IO rates of volumeID sampled after since, oldest
+// first.
+// Errors ErrEnoEnt, ErrNotSupported may be returned.
+func (v *volumeClient) StatsHistory(volumeID api.VolumeID, since time.Time) ([]api.VolumeStatsSample, error) {
+	var samples []api.VolumeStatsSample
+	req := v.c.Get().Resource(volumePath + "/stats/history").Instance(string(volumeID))
+	if !since.IsZero() {
+		req.QueryOption(string(api.OptSince), since.Format(time.RFC3339))
+	}
+	if err := req.Do().Unmarshal(&samples); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
 // SnapInspect provides details on this snapshot.
 // Errors ErrEnoEnt may be returned
 func (v *volumeClient) SnapInspect(ids []api.SnapID) ([]api.VolumeSnap, error) {
@@ -151,6 +353,21 @@ func (v *volumeClient) SnapInspect(ids []api.SnapID) ([]api.VolumeSnap, error) {
 	return snaps, nil
 }
 
+// SnapDiff returns the changes from snapshot fromSnapID to snapshot toSnapID
+// in the pkg/diff format. The diff is read into memory before it is returned.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func (v *volumeClient) SnapDiff(fromSnapID, toSnapID api.SnapID) (io.ReadCloser, error) {
+	req := v.c.Get().Resource(snapPath + "/diff").Instance(string(toSnapID))
+	if fromSnapID != "" {
+		req.QueryOption(string(api.OptFromSnapID), string(fromSnapID))
+	}
+	b, err := req.Do().Body()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
 // Stats for specified volume.
 // Errors ErrEnoEnt may be returned
 func (v *volumeClient) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
@@ -173,6 +390,441 @@ func (v *volumeClient) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
 	return alerts, nil
 }
 
+// Graph returns the snapshots, clones and replicas that depend on a volume.
+// Errors ErrEnoEnt may be returned.
+func (v *volumeClient) Graph(volumeID api.VolumeID) (*api.VolumeGraph, error) {
+	var g api.VolumeGraph
+	err := v.c.Get().Resource(volumePath + "/graph").Instance(string(volumeID)).Do().Unmarshal(&g)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Fingerprint hashes the content of volumeID, reusing the hashes of snapshot
+// base if it is set.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func (v *volumeClient) Fingerprint(volumeID api.VolumeID, base api.SnapID) (*api.Fingerprint, error) {
+	var f api.Fingerprint
+	err := v.c.Get().Resource(volumePath+"/fingerprint").Instance(string(volumeID)).
+		QueryOption(string(api.OptBaseSnapID), string(base)).Do().Unmarshal(&f)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// ExportSnap exports snapID to an object store of the server.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func (v *volumeClient) ExportSnap(snapID api.SnapID, to api.SnapArchiveLocation) (*api.SnapArchive, error) {
+	var archive api.SnapArchive
+	req := api.SnapExportRequest{Location: to}
+	err := v.c.Post().Resource(snapPath + "/export").Instance(string(snapID)).
+		Body(&req).Do().Unmarshal(&archive)
+	if err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// ImportSnap creates a volume with locator from a snapshot exported to an
+// object store of the server.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func (v *volumeClient) ImportSnap(from api.SnapArchiveLocation, locator api.VolumeLocator) (api.VolumeID, error) {
+	var response api.VolumeCreateResponse
+	req := api.SnapImportRequest{Location: from, Locator: locator}
+	err := v.c.Post().Resource(snapPath + "/import").Body(&req).Do().Unmarshal(&response)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	if len(response.FieldErrors) > 0 {
+		return api.BadVolumeID, volume.ValidationError(response.FieldErrors)
+	}
+	if response.Error != "" {
+		return api.BadVolumeID, errors.New(response.Error)
+	}
+	return response.ID, nil
+}
+
+// Catalog lists path within a volume without mounting it.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func (v *volumeClient) Catalog(volumeID api.VolumeID, path string) ([]api.CatalogEntry, error) {
+	var entries []api.CatalogEntry
+	err := v.c.Get().Resource(volumePath+"/catalog").Instance(string(volumeID)).
+		QueryOption(string(api.OptPath), path).Do().Unmarshal(&entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Mounts returns the paths a volume is mounted at on the node of the server
+// and the processes using them.
+// Errors ErrEnoEnt may be returned.
+func (v *volumeClient) Mounts(volumeID api.VolumeID) ([]api.MountInfo, error) {
+	var mounts []api.MountInfo
+	err := v.c.Get().Resource(volumePath + "/mounts").Instance(string(volumeID)).Do().Unmarshal(&mounts)
+	if err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// Restore moves a volume out of the trash.
+// Errors ErrEnoEnt, ErrNotInTrash may be returned.
+func (v *volumeClient) Restore(volumeID api.VolumeID) error {
+	var response api.VolumeResponse
+	err := v.c.Post().Resource(volumePath + "/restore").Instance(string(volumeID)).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// Resize grows a volume to size bytes.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func (v *volumeClient) Resize(volumeID api.VolumeID, size uint64) error {
+	var response api.VolumeResponse
+	req := &api.VolumeResizeRequest{Size: size}
+	err := v.c.Post().Resource(volumePath + "/resize").Instance(string(volumeID)).
+		Body(req).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// Transfer makes owner the owner of volumeID.
+// Errors ErrEnoEnt may be returned.
+func (v *volumeClient) Transfer(volumeID api.VolumeID, owner string) error {
+	var response api.VolumeResponse
+	req := &api.VolumeTransferRequest{Owner: owner}
+	err := v.c.Put().Resource(volumePath + "/owner").Instance(string(volumeID)).
+		Body(req).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// SetAccess grants principal access to volumeID, an empty access revokes it.
+// Errors ErrEnoEnt, ErrEinval may be returned.
+func (v *volumeClient) SetAccess(volumeID api.VolumeID, principal string, access api.AccessType) error {
+	var response api.VolumeResponse
+	req := &api.VolumeAccessRequest{Principal: principal, Access: access}
+	err := v.c.Put().Resource(volumePath + "/access").Instance(string(volumeID)).
+		Body(req).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// UpdateLocator replaces the locator of volumeID.
+// Errors ErrEnoEnt, ErrEexist may be returned.
+func (v *volumeClient) UpdateLocator(volumeID api.VolumeID, locator api.VolumeLocator) error {
+	var response api.VolumeResponse
+	req := &api.VolumeLocatorRequest{Locator: locator}
+	err := v.c.Put().Resource(volumePath + "/locator").Instance(string(volumeID)).
+		Body(req).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	switch response.Error {
+	case "":
+		return nil
+	case volume.ErrEexist.Error():
+		return volume.ErrEexist
+	}
+	return errors.New(response.Error)
+}
+
+// Trashed lists the volumes in the trash.
+func (v *volumeClient) Trashed() ([]api.Volume, error) {
+	var vols []api.Volume
+	if err := v.c.Get().Resource(trashPath).Do().Unmarshal(&vols); err != nil {
+		return nil, err
+	}
+	return vols, nil
+}
+
+// Orphans returns the orphans of the driver without reclaiming them.
+func (v *volumeClient) Orphans() ([]api.Orphan, error) {
+	var orphans []api.Orphan
+	if err := v.c.Get().Resource(orphansPath).Do().Unmarshal(&orphans); err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// CollectGarbage scans the driver for orphans and reports or reclaims them
+// according to policy, the policy of the driver if empty.
+func (v *volumeClient) CollectGarbage(policy api.GCPolicy) ([]api.Orphan, error) {
+	var orphans []api.Orphan
+	req := &api.GCRequest{Policy: policy}
+	if err := v.c.Post().Resource(gcPath).Body(req).Do().Unmarshal(&orphans); err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// Rebalance starts moving volumes between the backends of the driver. The
+// job is returned as planned, use RebalanceJob to follow its progress.
+func (v *volumeClient) Rebalance(req *api.RebalanceRequest) (*api.RebalanceJob, error) {
+	var job api.RebalanceJob
+	if err := v.c.Post().Resource(rebalancePath).Body(req).Do().Unmarshal(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RebalanceJob returns the progress of the running or last rebalance.
+func (v *volumeClient) RebalanceJob() (*api.RebalanceJob, error) {
+	var job api.RebalanceJob
+	if err := v.c.Get().Resource(rebalancePath).Do().Unmarshal(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CancelRebalance stops the running rebalance after the current move.
+func (v *volumeClient) CancelRebalance() error {
+	var response api.VolumeResponse
+	if err := v.c.Delete().Resource(rebalancePath).Do().Unmarshal(&response); err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// Profiles lists the volume profiles.
+func (v *volumeClient) Profiles() ([]api.VolumeProfile, error) {
+	var profiles []api.VolumeProfile
+	if err := v.c.Get().Resource(profilePath).Do().Unmarshal(&profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// Profile returns the named volume profile.
+func (v *volumeClient) Profile(name string) (*api.VolumeProfile, error) {
+	var p api.VolumeProfile
+	if err := v.c.Get().Resource(profilePath).Instance(name).Do().Unmarshal(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PutProfile creates or replaces a volume profile.
+func (v *volumeClient) PutProfile(p *api.VolumeProfile) error {
+	return v.c.Post().Resource(profilePath).Body(p).Do().Error()
+}
+
+// DeleteProfile removes the named volume profile.
+func (v *volumeClient) DeleteProfile(name string) error {
+	return v.c.Delete().Resource(profilePath).Instance(name).Do().Error()
+}
+
+// Quotas lists the quotas of tenants and their usage.
+func (v *volumeClient) Quotas() ([]api.QuotaUsage, error) {
+	var quotas []api.QuotaUsage
+	if err := v.c.Get().Resource(quotaPath).Do().Unmarshal(&quotas); err != nil {
+		return nil, err
+	}
+	return quotas, nil
+}
+
+// Quota returns the quota of tenant and its usage.
+func (v *volumeClient) Quota(tenant string) (*api.QuotaUsage, error) {
+	var q api.QuotaUsage
+	if err := v.c.Get().Resource(quotaPath).Instance(tenant).Do().Unmarshal(&q); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// PutQuota creates or replaces the quota of a tenant.
+func (v *volumeClient) PutQuota(q *api.Quota) error {
+	return v.c.Post().Resource(quotaPath).Body(q).Do().Error()
+}
+
+// DeleteQuota removes the quota of tenant.
+func (v *volumeClient) DeleteQuota(tenant string) error {
+	return v.c.Delete().Resource(quotaPath).Instance(tenant).Do().Error()
+}
+
+// CloudSnapUpload starts uploading a snapshot to an object store.
+func (v *volumeClient) CloudSnapUpload(req *api.CloudSnapRequest) (*api.CloudSnap, error) {
+	var cs api.CloudSnap
+	if err := v.c.Post().Resource(cloudSnapPath).Body(req).Do().Unmarshal(&cs); err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// CloudSnaps lists the cloud snapshots of volumeID, of all volumes if empty.
+func (v *volumeClient) CloudSnaps(volumeID api.VolumeID) ([]api.CloudSnap, error) {
+	var snaps []api.CloudSnap
+	req := v.c.Get().Resource(cloudSnapPath)
+	if volumeID != "" {
+		req.QueryOption(string(api.OptVolumeID), string(volumeID))
+	}
+	if err := req.Do().Unmarshal(&snaps); err != nil {
+		return nil, err
+	}
+	return snaps, nil
+}
+
+// CloudSnap returns the cloud snapshot id.
+func (v *volumeClient) CloudSnap(id string) (*api.CloudSnap, error) {
+	var cs api.CloudSnap
+	if err := v.c.Get().Resource(cloudSnapPath).Instance(id).Do().Unmarshal(&cs); err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// CloudSnapResume resumes the failed or interrupted upload id on the server.
+func (v *volumeClient) CloudSnapResume(id string) (*api.CloudSnap, error) {
+	var cs api.CloudSnap
+	if err := v.c.Post().Resource(cloudSnapPath + "/resume").Instance(id).Do().Unmarshal(&cs); err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// CloudSnapRestore creates a volume with locator from the cloud snapshot id.
+func (v *volumeClient) CloudSnapRestore(id string, locator api.VolumeLocator) (api.VolumeID, error) {
+	var response api.VolumeCreateResponse
+	req := api.CloudSnapRestoreRequest{Locator: locator}
+	err := v.c.Post().Resource(cloudSnapPath + "/restore").Instance(id).Body(&req).Do().Unmarshal(&response)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	if len(response.FieldErrors) > 0 {
+		return api.BadVolumeID, volume.ValidationError(response.FieldErrors)
+	}
+	if response.Error != "" {
+		return api.BadVolumeID, errors.New(response.Error)
+	}
+	return response.ID, nil
+}
+
+// CloudSnapDelete deletes the cloud snapshot id and its objects.
+func (v *volumeClient) CloudSnapDelete(id string) error {
+	var response api.VolumeResponse
+	if err := v.c.Delete().Resource(cloudSnapPath).Instance(id).Do().Unmarshal(&response); err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// Query returns the audit records of this driver matching f, oldest first.
+func (v *volumeClient) Query(f *api.AuditFilter) ([]api.AuditRecord, error) {
+	var records []api.AuditRecord
+	req := v.c.Get().Resource(auditPath)
+	if f.Op != "" {
+		req.QueryOption(string(api.OptOp), f.Op)
+	}
+	if f.Principal != "" {
+		req.QueryOption(string(api.OptPrincipal), f.Principal)
+	}
+	if f.VolumeID != "" {
+		req.QueryOption(string(api.OptVolumeID), string(f.VolumeID))
+	}
+	if !f.Since.IsZero() {
+		req.QueryOption(string(api.OptSince), f.Since.Format(time.RFC3339))
+	}
+	if !f.Until.IsZero() {
+		req.QueryOption(string(api.OptUntil), f.Until.Format(time.RFC3339))
+	}
+	if f.Limit != 0 {
+		req.QueryOption(string(api.OptLimit), strconv.Itoa(f.Limit))
+	}
+	if err := req.Do().Unmarshal(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// LogLevel returns the log level of the driver.
+func (v *volumeClient) LogLevel() (string, error) {
+	var level api.LogLevel
+	if err := v.c.Get().Resource(logLevelPath).Do().Unmarshal(&level); err != nil {
+		return "", err
+	}
+	return level.Level, nil
+}
+
+// SetLogLevel changes the log level of the driver.
+func (v *volumeClient) SetLogLevel(level string) error {
+	req := api.LogLevel{Level: level}
+	return v.c.Put().Resource(logLevelPath).Body(&req).Do().Unmarshal(&req)
+}
+
+// Logs returns the latest log entries of the driver at or above level.
+func (v *volumeClient) Logs(level string, limit int) ([]api.LogEntry, error) {
+	var entries []api.LogEntry
+	req := v.c.Get().Resource(logsPath)
+	if level != "" {
+		req.QueryOption(string(api.OptLevel), level)
+	}
+	if limit != 0 {
+		req.QueryOption(string(api.OptLimit), strconv.Itoa(limit))
+	}
+	if err := req.Do().Unmarshal(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Export publishes a block volume over protocol from the driver's node.
+// Errors ErrEnoEnt, ErrNotSupported may be returned.
+func (v *volumeClient) Export(volumeID api.VolumeID, protocol api.ExportProtocol) (*api.VolumeExport, error) {
+	var response api.VolumeExportResponse
+	req := api.VolumeExportRequest{Protocol: protocol}
+	err := v.c.Post().Resource(volumePath + "/export").Instance(string(volumeID)).Body(&req).Do().Unmarshal(&response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+	return response.Export, nil
+}
+
+// Unexport removes the protocol export of a volume.
+// Errors ErrEnoEnt may be returned.
+func (v *volumeClient) Unexport(volumeID api.VolumeID, protocol api.ExportProtocol) error {
+	var response api.VolumeResponse
+	err := v.c.Delete().Resource(volumePath+"/export").Instance(string(volumeID)).
+		QueryOption(string(api.OptProtocol), string(protocol)).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
 // Shutdown and cleanup.
 func (v *volumeClient) Shutdown() {
 	return
@@ -181,18 +833,45 @@ func (v *volumeClient) Shutdown() {
 // Enumerate volumes that map to the volumeLocator. Locator fields may be regexp.
 // If locator fields are left blank, this will return all volumes.
 func (v *volumeClient) Enumerate(locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error) {
+	return v.enumerate(context.Background(), locator, labels, "")
+}
+
+// EnumerateAt enumerates volumes at the requested read consistency.
+func (v *volumeClient) EnumerateAt(locator api.VolumeLocator,
+	labels api.Labels,
+	c api.Consistency) ([]api.Volume, error) {
+	return v.enumerate(context.Background(), locator, labels, c)
+}
+
+// EnumerateCtx is Enumerate bounded by ctx.
+func (v *volumeClient) EnumerateCtx(ctx context.Context,
+	locator api.VolumeLocator,
+	labels api.Labels) ([]api.Volume, error) {
+	return v.enumerate(ctx, locator, labels, "")
+}
+
+func (v *volumeClient) enumerate(ctx context.Context,
+	locator api.VolumeLocator,
+	labels api.Labels,
+	c api.Consistency) ([]api.Volume, error) {
 	var vols []api.Volume
 	req := v.c.Get().Resource(volumePath)
 	if locator.Name != "" {
 		req.QueryOption(string(api.OptName), locator.Name)
 	}
+	if locator.Group != "" {
+		req.QueryOption(string(api.OptGroup), locator.Group)
+	}
 	if len(locator.VolumeLabels) != 0 {
 		req.QueryOptionLabel(string(api.OptLabel), locator.VolumeLabels)
 	}
 	if len(labels) != 0 {
 		req.QueryOptionLabel(string(api.OptConfigLabel), labels)
 	}
-	err := req.Do().Unmarshal(&vols)
+	if c != "" {
+		req.QueryOption(string(api.OptConsistency), string(c))
+	}
+	err := req.Context(ctx).Do().Unmarshal(&vols)
 	if err != nil {
 		return nil, err
 	}
@@ -218,16 +897,80 @@ func (v *volumeClient) SnapEnumerate(ids []api.VolumeID, snapLabels api.Labels)
 	return snaps, nil
 }
 
+// EnumeratePage enumerates the page of volumes selected by opts and returns
+// the token to the next page, empty on the last page.
+func (v *volumeClient) EnumeratePage(locator api.VolumeLocator,
+	labels api.Labels,
+	opts *api.EnumerateOptions) ([]api.Volume, string, error) {
+	var resp api.VolumeEnumerateResponse
+	req := v.c.Get().Resource(volumePath)
+	if locator.Name != "" {
+		req.QueryOption(string(api.OptName), locator.Name)
+	}
+	if locator.Group != "" {
+		req.QueryOption(string(api.OptGroup), locator.Group)
+	}
+	if len(locator.VolumeLabels) != 0 {
+		req.QueryOptionLabel(string(api.OptLabel), locator.VolumeLabels)
+	}
+	if len(labels) != 0 {
+		req.QueryOptionLabel(string(api.OptConfigLabel), labels)
+	}
+	pageOptions(req, opts)
+	if err := req.Do().Unmarshal(&resp); err != nil {
+		return nil, "", err
+	}
+	return resp.Volumes, resp.NextToken, nil
+}
+
+// SnapEnumeratePage enumerates the page of snaps selected by opts and
+// returns the token to the next page, empty on the last page.
+func (v *volumeClient) SnapEnumeratePage(ids []api.VolumeID,
+	snapLabels api.Labels,
+	opts *api.EnumerateOptions) ([]api.VolumeSnap, string, error) {
+	var resp api.SnapEnumerateResponse
+	req := v.c.Get().Resource(snapPath)
+	for _, v := range ids {
+		req.QueryOption(string(api.OptVolumeID), string(v))
+	}
+	if len(snapLabels) != 0 {
+		req.QueryOptionLabel(string(api.OptLabel), snapLabels)
+	}
+	pageOptions(req, opts)
+	if err := req.Do().Unmarshal(&resp); err != nil {
+		return nil, "", err
+	}
+	return resp.Snaps, resp.NextToken, nil
+}
+
+// pageOptions adds the query options of a paginated enumeration to req. A
+// limit is always sent so that the server returns a paginated response.
+func pageOptions(req *Request, opts *api.EnumerateOptions) {
+	req.QueryOption(string(api.OptLimit), strconv.Itoa(opts.Limit))
+	if opts.Token != "" {
+		req.QueryOption(string(api.OptToken), opts.Token)
+	}
+	if opts.SortBy != "" {
+		req.QueryOption(string(api.OptSort), string(opts.SortBy))
+	}
+}
+
 // Attach map device to the host.
 // On success the devicePath specifies location where the device is exported
 // Errors ErrEnoEnt, ErrVolAttached may be returned.
-func (v *volumeClient) Attach(volumeID api.VolumeID) (string, error) {
+func (v *volumeClient) Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	return v.AttachCtx(context.Background(), volumeID, options)
+}
+
+// AttachCtx is Attach bounded by ctx.
+func (v *volumeClient) AttachCtx(ctx context.Context, volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
 	var response api.VolumeStateResponse
 
 	req := api.VolumeStateAction{
-		Attach: api.ParamOn,
+		Attach:        api.ParamOn,
+		AttachOptions: options,
 	}
-	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Do().Unmarshal(&response)
+	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Context(ctx).Do().Unmarshal(&response)
 	if err != nil {
 		return "", err
 	}
@@ -240,11 +983,16 @@ func (v *volumeClient) Attach(volumeID api.VolumeID) (string, error) {
 // Format volume according to spec provided in Create
 // Errors ErrEnoEnt, ErrVolDetached may be returned.
 func (v *volumeClient) Format(volumeID api.VolumeID) error {
+	return v.FormatCtx(context.Background(), volumeID)
+}
+
+// FormatCtx is Format bounded by ctx.
+func (v *volumeClient) FormatCtx(ctx context.Context, volumeID api.VolumeID) error {
 	var response api.VolumeStateResponse
 	req := api.VolumeStateAction{
 		Format: api.ParamOn,
 	}
-	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Do().Unmarshal(&response)
+	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Context(ctx).Do().Unmarshal(&response)
 	if err != nil {
 		return err
 	}
@@ -257,10 +1005,51 @@ func (v *volumeClient) Format(volumeID api.VolumeID) error {
 // Detach device from the host.
 // Errors ErrEnoEnt, ErrVolDetached may be returned.
 func (v *volumeClient) Detach(volumeID api.VolumeID) error {
+	return v.DetachCtx(context.Background(), volumeID)
+}
+
+// DetachCtx is Detach bounded by ctx.
+func (v *volumeClient) DetachCtx(ctx context.Context, volumeID api.VolumeID) error {
 	var response api.VolumeStateResponse
 	req := api.VolumeStateAction{
 		Attach: api.ParamOff,
 	}
+	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Context(ctx).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// ForceDetach detaches a volume that may still be mounted as options allow.
+// Errors ErrEnoEnt may be returned.
+func (v *volumeClient) ForceDetach(volumeID api.VolumeID, options *api.DetachOptions) error {
+	var response api.VolumeStateResponse
+	req := api.VolumeStateAction{
+		Attach:        api.ParamOff,
+		DetachOptions: options,
+	}
+	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// SetMaintenance starts or ends the maintenance of a volume.
+// Errors ErrEnoEnt may be returned.
+func (v *volumeClient) SetMaintenance(volumeID api.VolumeID, on bool) error {
+	var response api.VolumeStateResponse
+	req := api.VolumeStateAction{Maintenance: api.ParamOff}
+	if on {
+		req.Maintenance = api.ParamOn
+	}
 	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Do().Unmarshal(&response)
 	if err != nil {
 		return err
@@ -274,11 +1063,35 @@ func (v *volumeClient) Detach(volumeID api.VolumeID) error {
 // Mount volume at specified path
 // Errors ErrEnoEnt, ErrVolDetached may be returned.
 func (v *volumeClient) Mount(volumeID api.VolumeID, mountpath string) error {
+	return v.MountCtx(context.Background(), volumeID, mountpath)
+}
+
+// MountCtx is Mount bounded by ctx.
+func (v *volumeClient) MountCtx(ctx context.Context, volumeID api.VolumeID, mountpath string) error {
 	var response api.VolumeStateResponse
 	req := api.VolumeStateAction{
 		Mount:     api.ParamOn,
 		MountPath: mountpath,
 	}
+	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Context(ctx).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// MountWithOptions mounts volume at specified path as options ask.
+// Errors ErrEnoEnt, ErrVolDetached may be returned.
+func (v *volumeClient) MountWithOptions(volumeID api.VolumeID, mountpath string, options *api.MountOptions) error {
+	var response api.VolumeStateResponse
+	req := api.VolumeStateAction{
+		Mount:        api.ParamOn,
+		MountPath:    mountpath,
+		MountOptions: options,
+	}
 	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Do().Unmarshal(&response)
 	if err != nil {
 		return err
@@ -292,11 +1105,35 @@ func (v *volumeClient) Mount(volumeID api.VolumeID, mountpath string) error {
 // Unmount volume at specified path
 // Errors ErrEnoEnt, ErrVolDetached may be returned.
 func (v *volumeClient) Unmount(volumeID api.VolumeID, mountpath string) error {
+	return v.UnmountCtx(context.Background(), volumeID, mountpath)
+}
+
+// UnmountCtx is Unmount bounded by ctx.
+func (v *volumeClient) UnmountCtx(ctx context.Context, volumeID api.VolumeID, mountpath string) error {
 	var response api.VolumeStateResponse
 	req := api.VolumeStateAction{
 		Mount:     api.ParamOff,
 		MountPath: mountpath,
 	}
+	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Context(ctx).Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// ForceUnmount unmounts a volume that may be busy as options allow.
+// Errors ErrEnoEnt may be returned.
+func (v *volumeClient) ForceUnmount(volumeID api.VolumeID, mountpath string, options *api.DetachOptions) error {
+	var response api.VolumeStateResponse
+	req := api.VolumeStateAction{
+		Mount:         api.ParamOff,
+		MountPath:     mountpath,
+		DetachOptions: options,
+	}
 	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Do().Unmarshal(&response)
 	if err != nil {
 		return err
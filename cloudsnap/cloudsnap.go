@@ -0,0 +1,330 @@
+// Package cloudsnap uploads snapshots to object stores, such as S3 or GCS
+// through its S3 interoperability endpoint, and restores them into new
+// volumes. Snapshots are uploaded in the portable format of
+// volume.ExportSnap, in compressed chunks, within the backup bandwidth.
+//
+// Uploads are recorded in a catalog in the KVDB along with the chunks stored
+// so far: any node can list and restore them, and interrupted uploads resume
+// at the first missing chunk.
+package cloudsnap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pborman/uuid"
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	keyBase = "cloudsnaps/"
+	// prefix of the objects of the uploads in their bucket.
+	prefix = "cloudsnaps"
+)
+
+var (
+	// ErrNotFound is returned for cloud snapshots that do not exist.
+	ErrNotFound = errors.New("Cloud snapshot not found")
+	// ErrRunning is returned when resuming or deleting an upload in
+	// progress on another node.
+	ErrRunning = errors.New("Cloud snapshot upload in progress")
+	// ErrIncomplete is returned when restoring an upload that did not
+	// complete.
+	ErrIncomplete = errors.New("Cloud snapshot upload is incomplete")
+)
+
+// Requester is implemented by clients that manage the cloud snapshots of a
+// remote driver.
+type Requester interface {
+	// CloudSnapUpload starts uploading a snapshot.
+	// Errors volume.ErrEnoEnt, volume.ErrEinval may be returned.
+	CloudSnapUpload(req *api.CloudSnapRequest) (*api.CloudSnap, error)
+
+	// CloudSnaps lists the cloud snapshots of volumeID, of all volumes if
+	// empty.
+	CloudSnaps(volumeID api.VolumeID) ([]api.CloudSnap, error)
+
+	// CloudSnap returns the cloud snapshot id.
+	// Errors ErrNotFound may be returned.
+	CloudSnap(id string) (*api.CloudSnap, error)
+
+	// CloudSnapResume resumes the failed or interrupted upload id.
+	// Errors ErrNotFound, ErrRunning may be returned.
+	CloudSnapResume(id string) (*api.CloudSnap, error)
+
+	// CloudSnapRestore creates a volume with locator from the cloud
+	// snapshot id.
+	// Errors ErrNotFound, ErrIncomplete may be returned.
+	CloudSnapRestore(id string, locator api.VolumeLocator) (api.VolumeID, error)
+
+	// CloudSnapDelete deletes the cloud snapshot id and its objects.
+	// Errors ErrNotFound, ErrRunning may be returned.
+	CloudSnapDelete(id string) error
+}
+
+var (
+	store kvdb.Kvdb
+
+	lock sync.Mutex
+	// uploads in progress on this node.
+	uploads = make(map[string]*running)
+)
+
+// running is an upload in progress, done is closed once it stopped.
+type running struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// SetStore sets the KVDB the catalog is kept in, the KVDB instance by
+// default.
+func SetStore(kv kvdb.Kvdb) {
+	store = kv
+}
+
+func kv() kvdb.Kvdb {
+	if store != nil {
+		return store
+	}
+	return kvdb.Instance()
+}
+
+func key(id string) string {
+	return keyBase + id
+}
+
+func put(cs *api.CloudSnap) error {
+	_, err := kv().Put(key(cs.ID), cs, 0)
+	return err
+}
+
+// Upload starts uploading a snapshot of the driver name. The upload runs in
+// the background, the cloud snapshot is returned as it starts.
+// Errors volume.ErrEnoEnt, volume.ErrEinval, volume.ErrNotSupported may be
+// returned.
+func Upload(name string, req *api.CloudSnapRequest) (*api.CloudSnap, error) {
+	d, err := volume.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if req.Store == "" || req.Bucket == "" {
+		return nil, fmt.Errorf("Store and bucket are required: %v", volume.ErrEinval)
+	}
+	snaps, err := d.SnapInspect([]api.SnapID{req.SnapID})
+	if err != nil || len(snaps) == 0 {
+		return nil, volume.ErrEnoEnt
+	}
+	vols, err := d.Inspect([]api.VolumeID{snaps[0].VolumeID})
+	if err != nil || len(vols) == 0 {
+		return nil, volume.ErrEnoEnt
+	}
+	id := uuid.New()
+	cs := &api.CloudSnap{
+		ID:       id,
+		Driver:   name,
+		VolumeID: snaps[0].VolumeID,
+		Owner:    vols[0].Ownership.Owner,
+		SnapID:   req.SnapID,
+		Location: api.SnapArchiveLocation{
+			Store:  req.Store,
+			Bucket: req.Bucket,
+			Prefix: path.Join(prefix, id),
+		},
+		Created: time.Now(),
+	}
+	if !req.NoCompression {
+		cs.Archive.Compression = api.SnapArchiveGzip
+	}
+	if err = start(d, cs); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// start records cs as uploading from this node and uploads it in the
+// background.
+func start(d volume.VolumeDriver, cs *api.CloudSnap) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := uploads[cs.ID]; ok {
+		return ErrRunning
+	}
+	cs.Node = volume.NodeID()
+	cs.State = api.JobRunning
+	cs.Error = ""
+	if err := put(cs); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &running{cancel: cancel, done: make(chan struct{})}
+	uploads[cs.ID] = r
+	c := *cs
+	go func() {
+		defer close(r.done)
+		upload(ctx, d, &c)
+	}()
+	return nil
+}
+
+// upload uploads cs, recording each chunk stored in the catalog.
+func upload(ctx context.Context, d volume.VolumeDriver, cs *api.CloudSnap) {
+	err := volume.ResumeExport(ctx, d, cs.SnapID, cs.Location, &cs.Archive,
+		func(*api.SnapArchive) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return put(cs)
+		})
+
+	lock.Lock()
+	defer lock.Unlock()
+	delete(uploads, cs.ID)
+	if ctx.Err() != nil {
+		// Deleted meanwhile.
+		return
+	}
+	if err != nil {
+		log.Warnf("Failed to upload snapshot %v to %s/%s: %v",
+			cs.SnapID, cs.Location.Bucket, cs.Location.Prefix, err)
+		cs.State = api.JobFailed
+		cs.Error = err.Error()
+	} else {
+		log.Infof("Snapshot %v uploaded to %s/%s", cs.SnapID, cs.Location.Bucket, cs.Location.Prefix)
+		cs.State = api.JobDone
+		cs.Completed = time.Now()
+	}
+	if err = put(cs); err != nil {
+		log.Warnf("Failed to record cloud snapshot %s: %v", cs.ID, err)
+	}
+}
+
+// Inspect returns the cloud snapshot id.
+// Errors ErrNotFound may be returned.
+func Inspect(id string) (*api.CloudSnap, error) {
+	var cs api.CloudSnap
+	if _, err := kv().GetVal(key(id), &cs); err != nil {
+		if err == kvdb.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// Enumerate returns the cloud snapshots of volumeID, of all volumes if it is
+// empty, oldest first.
+func Enumerate(volumeID api.VolumeID) ([]api.CloudSnap, error) {
+	kvp, err := kv().Enumerate(keyBase)
+	if err != nil {
+		return nil, err
+	}
+	snaps := make([]api.CloudSnap, 0, len(kvp))
+	for _, v := range kvp {
+		var cs api.CloudSnap
+		if err = json.Unmarshal(v.Value, &cs); err != nil {
+			return nil, err
+		}
+		if volumeID == "" || cs.VolumeID == volumeID {
+			snaps = append(snaps, cs)
+		}
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Created.Before(snaps[j].Created) })
+	return snaps, nil
+}
+
+// Resume resumes the upload id on this node, after it failed or its node
+// stopped. Uploads that are done are returned as is.
+// Errors ErrNotFound, ErrRunning may be returned.
+func Resume(id string) (*api.CloudSnap, error) {
+	cs, err := Inspect(id)
+	if err != nil {
+		return nil, err
+	}
+	if cs.State == api.JobDone {
+		return cs, nil
+	}
+	if cs.State == api.JobRunning && cs.Node != volume.NodeID() {
+		return nil, ErrRunning
+	}
+	d, err := volume.Get(cs.Driver)
+	if err != nil {
+		return nil, err
+	}
+	if err = start(d, cs); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// ResumeUploads resumes the uploads of the driver name that this node was
+// running when it stopped.
+func ResumeUploads(name string) error {
+	snaps, err := Enumerate("")
+	if err != nil {
+		return err
+	}
+	node := volume.NodeID()
+	for i := range snaps {
+		cs := &snaps[i]
+		if cs.Driver != name || cs.Node != node || cs.State != api.JobRunning {
+			continue
+		}
+		if _, err = Resume(cs.ID); err != nil && err != ErrRunning {
+			log.Warnf("Failed to resume the upload of cloud snapshot %s: %v", cs.ID, err)
+		}
+	}
+	return nil
+}
+
+// Restore creates a volume of d with locator from the cloud snapshot id.
+// Any node sharing the catalog and the object store may restore it.
+// Errors ErrNotFound, ErrIncomplete, volume.ErrNotSupported may be returned.
+func Restore(ctx context.Context,
+	d volume.VolumeDriver,
+	id string,
+	locator api.VolumeLocator) (api.VolumeID, error) {
+	cs, err := Inspect(id)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	if cs.State != api.JobDone {
+		return api.BadVolumeID, ErrIncomplete
+	}
+	return volume.ImportSnap(ctx, d, cs.Location, locator)
+}
+
+// Delete deletes the cloud snapshot id and its objects, cancelling its
+// upload if it runs on this node.
+// Errors ErrNotFound, ErrRunning may be returned.
+func Delete(id string) error {
+	cs, err := Inspect(id)
+	if err != nil {
+		return err
+	}
+	lock.Lock()
+	r, ok := uploads[id]
+	lock.Unlock()
+	if ok {
+		r.cancel()
+		<-r.done
+	} else if cs.State == api.JobRunning && cs.Node != volume.NodeID() {
+		return ErrRunning
+	}
+	if err = volume.DeleteSnapArchive(cs.Location, &cs.Archive); err != nil {
+		return err
+	}
+	if _, err = kv().Delete(key(id)); err != nil && err != kvdb.ErrNotFound {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	kv "github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/events"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const capacityKey = "cluster/capacity/"
+
+// capacityInterval is how often a node reports the capacity of its drivers.
+// Reports expire after three intervals so that nodes that are gone stop
+// counting.
+var capacityInterval = time.Minute
+
+// nodeCapacity returns the capacity of the drivers running on this node.
+func nodeCapacity(node api.MachineID) []api.DriverCapacity {
+	var caps []api.DriverCapacity
+	for _, name := range volume.Instances() {
+		d, err := volume.Get(name)
+		if err != nil {
+			continue
+		}
+		status := d.Status()
+		dc := api.DriverCapacity{
+			Node:     node,
+			Driver:   name,
+			Shared:   d.Type()&volume.Clustered != 0 || len(status.Endpoints) > 0,
+			Capacity: status.Capacity,
+			Free:     status.Free,
+			Pools:    status.Pools,
+			Time:     time.Now(),
+		}
+		vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+		if err != nil {
+			log.Warnf("Failed to enumerate the volumes of %s for capacity: %v", name, err)
+		}
+		locator, _ := d.(volume.PoolLocator)
+		pools := make(map[string]*api.PoolStatus)
+		for i := range dc.Pools {
+			pools[dc.Pools[i].Name] = &dc.Pools[i]
+		}
+		for i := range vols {
+			v := &vols[i]
+			var size uint64
+			if v.Spec != nil {
+				size = v.Spec.Size
+			}
+			dc.Provisioned += size
+			dc.Used += v.Usage
+			if locator == nil {
+				continue
+			}
+			if p, ok := pools[locator.VolumePool(v)]; ok {
+				p.Provisioned += size
+				p.Used += v.Usage
+			}
+		}
+		caps = append(caps, dc)
+	}
+	return caps
+}
+
+// reportCapacity periodically records the capacity of the drivers of this
+// node in the KVDB.
+func (c *ClusterManager) reportCapacity() {
+	node := api.MachineID(c.config.NodeId)
+	ttl := uint64(3 * capacityInterval / time.Second)
+	for {
+		_, err := kv.Instance().Put(capacityKey+c.config.NodeId, nodeCapacity(node), ttl)
+		if err != nil {
+			log.Warnf("Failed to report the capacity of node %s: %v", node, err)
+		}
+		time.Sleep(capacityInterval)
+	}
+}
+
+// Capacity returns the capacity of the drivers of all nodes and the space
+// provisioned to their volumes. The drivers of this node are measured now,
+// other nodes are counted from their last report.
+func (c *ClusterManager) Capacity() (*api.ClusterCapacity, error) {
+	kvp, err := kv.Instance().Enumerate(capacityKey)
+	if err != nil {
+		return nil, err
+	}
+	caps := nodeCapacity(api.MachineID(c.config.NodeId))
+	for _, p := range kvp {
+		var node []api.DriverCapacity
+		if err = json.Unmarshal(p.Value, &node); err != nil {
+			log.Warnf("Invalid capacity report %s: %v", p.Key, err)
+			continue
+		}
+		for _, dc := range node {
+			if dc.Node != api.MachineID(c.config.NodeId) {
+				caps = append(caps, dc)
+			}
+		}
+	}
+	total := sumCapacity(caps)
+	for i := range total.Pools {
+		total.Pools[i].Alerts = alerts(&c.config, &total.Pools[i])
+	}
+	return total, nil
+}
+
+// sumCapacity adds up the capacity reports of the drivers of all nodes.
+// Pools of shared drivers are counted once. Volumes are recorded cluster
+// wide, so the provisioned and used space of a driver is counted once, from
+// its most recent report.
+func sumCapacity(caps []api.DriverCapacity) *api.ClusterCapacity {
+	sort.Slice(caps, func(i, j int) bool {
+		if caps[i].Node != caps[j].Node {
+			return caps[i].Node < caps[j].Node
+		}
+		return caps[i].Driver < caps[j].Driver
+	})
+	total := &api.ClusterCapacity{Drivers: caps}
+	pools := make(map[string]bool)
+	latest := make(map[string]*api.DriverCapacity)
+	for i := range caps {
+		dc := &caps[i]
+		if l, ok := latest[dc.Driver]; !ok || dc.Time.After(l.Time) {
+			latest[dc.Driver] = dc
+		}
+		if !dc.Shared {
+			total.Capacity += dc.Capacity
+			total.Free += dc.Free
+			continue
+		}
+		if len(dc.Pools) == 0 {
+			if !pools[dc.Driver] {
+				pools[dc.Driver] = true
+				total.Capacity += dc.Capacity
+				total.Free += dc.Free
+			}
+			continue
+		}
+		for _, p := range dc.Pools {
+			if pools[dc.Driver+"/"+p.Name] {
+				continue
+			}
+			pools[dc.Driver+"/"+p.Name] = true
+			total.Capacity += p.Capacity
+			total.Free += p.Free
+		}
+	}
+	for _, dc := range latest {
+		total.Provisioned += dc.Provisioned
+		total.Used += dc.Used
+	}
+	if total.Capacity > 0 {
+		total.Overcommit = float64(total.Provisioned) / float64(total.Capacity)
+	}
+	total.Pools = sumPools(caps, latest)
+	return total
+}
+
+// sumPools lists the pools of the drivers of all nodes, the pools of shared
+// drivers once from their latest report. The volumes that drivers located
+// are counted in their pool, the space provisioned to and used by the other
+// volumes of a driver is split between its pools in proportion to their
+// capacity.
+func sumPools(caps []api.DriverCapacity, latest map[string]*api.DriverCapacity) []api.PoolCapacity {
+	var pools []api.PoolCapacity
+	for i := range caps {
+		dc := &caps[i]
+		node := dc.Node
+		if dc.Shared {
+			if latest[dc.Driver] != dc {
+				continue
+			}
+			node = ""
+		}
+		status := dc.Pools
+		if len(status) == 0 {
+			status = []api.PoolStatus{{Name: dc.Driver, Capacity: dc.Capacity, Free: dc.Free}}
+		}
+		for _, p := range status {
+			pools = append(pools, api.PoolCapacity{
+				Driver:      dc.Driver,
+				Node:        node,
+				Name:        p.Name,
+				Capacity:    p.Capacity,
+				Free:        p.Free,
+				Provisioned: p.Provisioned,
+				Used:        p.Used,
+			})
+		}
+	}
+	for driver, dc := range latest {
+		var capacity, provisioned, used uint64
+		for _, p := range pools {
+			if p.Driver == driver {
+				capacity += p.Capacity
+				provisioned += p.Provisioned
+				used += p.Used
+			}
+		}
+		if capacity == 0 {
+			continue
+		}
+		for i := range pools {
+			p := &pools[i]
+			if p.Driver != driver {
+				continue
+			}
+			share := float64(p.Capacity) / float64(capacity)
+			if dc.Provisioned > provisioned {
+				p.Provisioned += uint64(float64(dc.Provisioned-provisioned) * share)
+			}
+			if dc.Used > used {
+				p.Used += uint64(float64(dc.Used-used) * share)
+			}
+		}
+	}
+	for i := range pools {
+		if p := &pools[i]; p.Capacity > 0 {
+			p.Overcommit = float64(p.Provisioned) / float64(p.Capacity)
+		}
+	}
+	sort.SliceStable(pools, func(i, j int) bool {
+		if pools[i].Driver != pools[j].Driver {
+			return pools[i].Driver < pools[j].Driver
+		}
+		if pools[i].Node != pools[j].Node {
+			return pools[i].Node < pools[j].Node
+		}
+		return pools[i].Name < pools[j].Name
+	})
+	return pools
+}
+
+// alerts returns the capacity thresholds of cfg that p crossed.
+func alerts(cfg *Config, p *api.PoolCapacity) []api.EventType {
+	var crossed []api.EventType
+	if p.Capacity == 0 {
+		return nil
+	}
+	if cfg.OvercommitAlert > 0 && p.Overcommit > cfg.OvercommitAlert {
+		crossed = append(crossed, api.EventPoolOvercommitted)
+	}
+	if cfg.FreeAlertPercent > 0 && float64(p.Free) < float64(p.Capacity)*cfg.FreeAlertPercent/100 {
+		crossed = append(crossed, api.EventPoolLowSpace)
+	}
+	return crossed
+}
+
+// poolKey identifies a pool across capacity reports.
+func poolKey(p *api.PoolCapacity) string {
+	return p.Driver + "/" + string(p.Node) + "/" + p.Name
+}
+
+// watchCapacity publishes an event when a pool crosses a capacity threshold
+// and once it is back within them. It runs on one node of the cluster.
+func (c *ClusterManager) watchCapacity(stop <-chan struct{}) {
+	raised := make(map[string][]api.EventType)
+	t := time.NewTicker(capacityInterval)
+	defer t.Stop()
+	for {
+		total, err := c.Capacity()
+		if err != nil {
+			log.Warnf("Failed to check the capacity of the cluster: %v", err)
+		} else {
+			raised = raiseAlerts(total, raised)
+		}
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// raiseAlerts publishes the alerts of the pools of total that were not
+// raised yet and the recovery of the pools that were. It returns the alerts
+// now raised by pool.
+func raiseAlerts(total *api.ClusterCapacity,
+	raised map[string][]api.EventType) map[string][]api.EventType {
+	now := make(map[string][]api.EventType)
+	for i := range total.Pools {
+		p := &total.Pools[i]
+		key := poolKey(p)
+		if len(p.Alerts) == 0 {
+			if len(raised[key]) > 0 {
+				log.Infof("Pool %s of %s is back within the capacity thresholds", p.Name, p.Driver)
+				publishPool(api.EventPoolRecovered, p, "")
+			}
+			continue
+		}
+		now[key] = p.Alerts
+		for _, a := range p.Alerts {
+			if hasAlert(raised[key], a) {
+				continue
+			}
+			msg := fmt.Sprintf("%d of %d bytes free, %d bytes provisioned",
+				p.Free, p.Capacity, p.Provisioned)
+			log.Warnf("Pool %s of %s: %s: %s", p.Name, p.Driver, a, msg)
+			publishPool(a, p, msg)
+		}
+	}
+	return now
+}
+
+func hasAlert(alerts []api.EventType, a api.EventType) bool {
+	for _, r := range alerts {
+		if r == a {
+			return true
+		}
+	}
+	return false
+}
+
+func publishPool(t api.EventType, p *api.PoolCapacity, msg string) {
+	events.Publish(api.Event{
+		Type:    t,
+		Subject: p.Node,
+		Driver:  p.Driver,
+		Pool:    p.Name,
+		Message: msg,
+	})
+}
@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestSumCapacity(t *testing.T) {
+	now := time.Now()
+	nfsPools := []api.PoolStatus{{Name: "server:/export", Capacity: 1000, Free: 400}}
+	total := sumCapacity([]api.DriverCapacity{
+		{Node: "b", Driver: "dm", Capacity: 100, Free: 50, Provisioned: 300, Used: 40, Time: now},
+		{Node: "a", Driver: "dm", Capacity: 200, Free: 100, Provisioned: 250, Used: 30, Time: now.Add(-time.Minute)},
+		{Node: "a", Driver: "nfs", Shared: true, Capacity: 1000, Free: 400, Pools: nfsPools,
+			Provisioned: 350, Used: 100, Time: now},
+		{Node: "b", Driver: "nfs", Shared: true, Capacity: 1000, Free: 400, Pools: nfsPools,
+			Provisioned: 350, Used: 100, Time: now},
+	})
+	assert.Equal(t, uint64(1300), total.Capacity, "Shared pools should be counted once")
+	assert.Equal(t, uint64(550), total.Free)
+	assert.Equal(t, uint64(650), total.Provisioned, "Volumes should be counted from the latest report")
+	assert.Equal(t, uint64(140), total.Used)
+	assert.Equal(t, 0.5, total.Overcommit)
+	assert.Equal(t, api.MachineID("a"), total.Drivers[0].Node, "Drivers should be sorted by node")
+
+	total = sumCapacity(nil)
+	assert.Equal(t, 0.0, total.Overcommit, "Overcommit without capacity should be 0")
+}
+
+func TestSumPools(t *testing.T) {
+	now := time.Now()
+	total := sumCapacity([]api.DriverCapacity{
+		{Node: "a", Driver: "dm", Capacity: 300, Free: 100, Provisioned: 600, Used: 150, Time: now,
+			Pools: []api.PoolStatus{{Name: "/dev/sdb", Capacity: 100, Free: 50}, {Name: "/dev/sdc", Capacity: 200, Free: 50}}},
+		{Node: "b", Driver: "dm", Capacity: 300, Free: 300, Provisioned: 600, Used: 150, Time: now.Add(-time.Minute),
+			Pools: []api.PoolStatus{{Name: "/dev/sdb", Capacity: 300, Free: 300}}},
+		{Node: "a", Driver: "nfs", Shared: true, Capacity: 1000, Free: 400, Provisioned: 500, Used: 100, Time: now,
+			Pools: []api.PoolStatus{
+				{Name: "s1:/export", Capacity: 500, Free: 100, Provisioned: 400, Used: 80},
+				{Name: "s2:/export", Capacity: 500, Free: 300, Provisioned: 100, Used: 20},
+			}},
+		{Node: "b", Driver: "nfs", Shared: true, Capacity: 1000, Free: 400, Time: now.Add(-time.Minute),
+			Pools: []api.PoolStatus{{Name: "s1:/export", Capacity: 500, Free: 100}}},
+		{Node: "a", Driver: "vfile", Capacity: 100, Free: 10, Provisioned: 200, Time: now},
+	})
+	if !assert.Len(t, total.Pools, 6) {
+		return
+	}
+	// Unlocated volumes are split in proportion to the capacity of the pools.
+	assert.Equal(t, api.PoolCapacity{Driver: "dm", Node: "a", Name: "/dev/sdb", Capacity: 100, Free: 50,
+		Provisioned: 100, Used: 25, Overcommit: 1}, total.Pools[0])
+	assert.Equal(t, uint64(200), total.Pools[1].Provisioned)
+	assert.Equal(t, uint64(300), total.Pools[2].Provisioned)
+	// Shared pools are listed once, from the latest report.
+	assert.Equal(t, api.PoolCapacity{Driver: "nfs", Name: "s1:/export", Capacity: 500, Free: 100,
+		Provisioned: 400, Used: 80, Overcommit: 0.8}, total.Pools[3])
+	assert.Equal(t, uint64(100), total.Pools[4].Provisioned)
+	// Drivers without pools are one pool.
+	assert.Equal(t, api.PoolCapacity{Driver: "vfile", Node: "a", Name: "vfile", Capacity: 100, Free: 10,
+		Provisioned: 200, Overcommit: 2}, total.Pools[5])
+}
+
+func TestCapacityAlerts(t *testing.T) {
+	cfg := &Config{OvercommitAlert: 1.5, FreeAlertPercent: 20}
+	p := &api.PoolCapacity{Driver: "dm", Name: "/dev/sdb", Capacity: 100, Free: 50, Overcommit: 1}
+	assert.Empty(t, alerts(cfg, p))
+	p.Overcommit = 2
+	p.Free = 10
+	assert.Equal(t, []api.EventType{api.EventPoolOvercommitted, api.EventPoolLowSpace}, alerts(cfg, p))
+	assert.Empty(t, alerts(&Config{}, p), "Alerts should be disabled by default")
+
+	total := &api.ClusterCapacity{Pools: []api.PoolCapacity{*p}}
+	total.Pools[0].Alerts = []api.EventType{api.EventPoolLowSpace}
+	raised := raiseAlerts(total, nil)
+	assert.Equal(t, []api.EventType{api.EventPoolLowSpace}, raised[poolKey(p)])
+	total.Pools[0].Alerts = nil
+	assert.Empty(t, raiseAlerts(total, raised))
+}
@@ -1,11 +1,14 @@
 package cluster
 
 import (
+	"container/list"
 	"errors"
 	"time"
 
 	"github.com/portworx/kvdb"
 	"github.com/portworx/systemutils"
+
+	"github.com/libopenstorage/openstorage/api"
 )
 
 type Status int
@@ -24,6 +27,19 @@ var (
 type Config struct {
 	ClusterId string
 	NodeId    string
+	// OvercommitAlert raises EventPoolOvercommitted when the space
+	// provisioned to the volumes of a pool exceeds this ratio of its
+	// capacity. Disabled if 0.
+	OvercommitAlert float64
+	// FreeAlertPercent raises EventPoolLowSpace when the free space of a pool
+	// falls below this percentage of its capacity. Disabled if 0.
+	FreeAlertPercent float64
+	// Topology of this node, so that the replicas of volumes are spread
+	// across failure domains.
+	Topology Topology
+	// TopologyFromCloud fills the region and zone of Topology that are not
+	// set from the metadata service of the cloud the node runs in.
+	TopologyFromCloud bool
 }
 
 // NodeInfo describes the physical parameters of a node.
@@ -36,16 +52,25 @@ type NodeInfo struct {
 	Timestamp time.Time
 	Status    Status
 	Ip        string
+	Topology  Topology
+	// Maintenance the node takes no new volumes nor attaches.
+	Maintenance bool `json:",omitempty"`
 }
 
 type Node struct {
-	Ip     string
-	Status Status
+	Ip       string
+	Status   Status
+	Topology Topology
+	// Maintenance the node takes no new volumes nor attaches.
+	Maintenance bool `json:",omitempty"`
 }
 
 type Info struct {
 	Status    Status
 	ClusterId string
+	// Schema is the DatabaseSchema the database was initialized with, 0
+	// if it predates Init.
+	Schema int `json:",omitempty"`
 }
 
 type Database struct {
@@ -87,11 +112,43 @@ type ClusterListener interface {
 type Cluster interface {
 	AddEventListener(ClusterListener) error
 	Start() error
+
+	// Remove decommissions a node, draining its volumes first.
+	// Errors ErrNodeNotFound, ErrRemoveSelf, ErrDataLoss may be returned.
+	Remove(nodeID string, force bool) error
+
+	// Capacity returns the capacity of the drivers of all nodes.
+	Capacity() (*api.ClusterCapacity, error)
+
+	// Status returns the state of the cluster.
+	Status() (*api.ClusterStatus, error)
+
+	// Nodes returns the nodes of the cluster.
+	Nodes() ([]api.ClusterNode, error)
+
+	// Node returns a node of the cluster.
+	// Errors ErrNodeNotFound may be returned.
+	Node(nodeID string) (*api.ClusterNode, error)
+
+	// EnterMaintenance stops placing volumes on and attaching volumes to a
+	// node, detaching its volumes first if migrate is set.
+	// Errors ErrNodeNotFound may be returned.
+	EnterMaintenance(nodeID string, migrate bool) error
+
+	// ExitMaintenance puts a node in maintenance back in service.
+	// Errors ErrNodeNotFound may be returned.
+	ExitMaintenance(nodeID string) error
 }
 
 // New instantiates and starts a new cluster manager.
 func New(cfg Config, kv kvdb.Kvdb) (*ClusterManager, error) {
-	inst = &ClusterManager{config: cfg, kv: kv}
+	inst = &ClusterManager{
+		config:    cfg,
+		kv:        kv,
+		scheduler: NewDefaultScheduler(),
+		listeners: list.New(),
+		nodeInfo:  make(map[string]NodeInfo),
+	}
 
 	err := inst.Start()
 	if err != nil {
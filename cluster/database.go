@@ -10,14 +10,19 @@ import (
 	kv "github.com/portworx/kvdb"
 )
 
-func readDatabase() (Database, error) {
-	kvdb := kv.Instance()
+const (
+	// databaseKey is the key of the cluster database.
+	databaseKey = "cluster/database"
+	// lockKey is the key of the lock serializing changes to the database.
+	lockKey = "cluster/lock"
+)
 
+func readDatabase(kvdb kv.Kvdb) (Database, error) {
 	db := Database{Cluster: Info{Status: StatusInit},
 		Nodes: make(map[string]Node)}
 
-	kv, err := kvdb.Get("cluster/database")
-	if err != nil && !strings.Contains(err.Error(), "100: Key not found") {
+	kv, err := kvdb.Get(databaseKey)
+	if err != nil && !strings.Contains(err.Error(), "Key not found") {
 		log.Warn("Warning, Could not read cluster database")
 		goto done
 	}
@@ -38,15 +43,14 @@ done:
 	return db, err
 }
 
-func writeDatabase(db *Database) error {
-	kvdb := kv.Instance()
+func writeDatabase(kvdb kv.Kvdb, db *Database) error {
 	b, err := json.Marshal(db)
 	if err != nil {
 		log.Warn("Fatal, Could not marshal cluster database to JSON")
 		goto done
 	}
 
-	_, err = kvdb.Put("cluster/database", b, 0)
+	_, err = kvdb.Put(databaseKey, b, 0)
 	if err != nil {
 		log.Warn("Fatal, Could not marshal cluster database to JSON")
 		goto done
@@ -54,7 +58,7 @@ func writeDatabase(db *Database) error {
 
 done:
 	if err != nil {
-		log.Println(err)
+		log.Warn(err)
 	}
 	return err
 }
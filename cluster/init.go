@@ -0,0 +1,74 @@
+package cluster
+
+import (
+	"errors"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pborman/uuid"
+	"github.com/portworx/kvdb"
+)
+
+// DatabaseSchema is the version of the layout of the cluster database Init
+// writes.
+const DatabaseSchema = 1
+
+var (
+	// ErrInitialized is returned by Init if the cluster is initialized
+	// already, by this node or another.
+	ErrInitialized = errors.New("Cluster is already initialized")
+	// ErrNoNodeID is returned by Init if the config has no NodeId.
+	ErrNoNodeID = errors.New("Node ID is required to initialize a cluster")
+)
+
+// Init bootstraps a new cluster in kv with this node as its first member.
+// The cluster database is created with a cluster ID, the config ClusterId
+// or a new UUID if it is empty, and the entry of this node, and moves out
+// of StatusInit in a single write. The cluster lock is held while doing so,
+// so that of nodes bootstrapping concurrently only one succeeds, the others
+// get ErrInitialized along with the database to join instead.
+// Errors ErrInitialized, ErrNoNodeID may be returned.
+func Init(cfg Config, kv kvdb.Kvdb) (*Database, error) {
+	if cfg.NodeId == "" {
+		return nil, ErrNoNodeID
+	}
+	kvlock, err := kv.Lock(lockKey, 60)
+	if err != nil {
+		return nil, err
+	}
+	defer kv.Unlock(kvlock)
+
+	ip, err := externalIp()
+	if err != nil {
+		log.Warnf("Initializing cluster without the IP of node %s: %v", cfg.NodeId, err)
+	}
+	self := Node{Ip: ip, Status: StatusOk}
+	self.Topology = (&ClusterManager{config: cfg}).topology()
+	return initDatabase(kv, cfg, self)
+}
+
+// initDatabase is Init with the cluster lock held and self the entry of
+// this node.
+func initDatabase(kv kvdb.Kvdb, cfg Config, self Node) (*Database, error) {
+	db, err := readDatabase(kv)
+	if err != nil {
+		return nil, err
+	}
+	if db.Cluster.Status != StatusInit {
+		return &db, ErrInitialized
+	}
+
+	db.Cluster = Info{
+		Status:    StatusOk,
+		ClusterId: cfg.ClusterId,
+		Schema:    DatabaseSchema,
+	}
+	if db.Cluster.ClusterId == "" {
+		db.Cluster.ClusterId = uuid.New()
+	}
+	db.Nodes = map[string]Node{cfg.NodeId: self}
+	if err = writeDatabase(kv, &db); err != nil {
+		return nil, err
+	}
+	log.Infof("Initialized cluster %s with node %s", db.Cluster.ClusterId, cfg.NodeId)
+	return &db, nil
+}
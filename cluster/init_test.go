@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/portworx/kvdb/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInit(t *testing.T) {
+	kv, err := kvdb.New(mem.Name, "init_test", nil, nil)
+	assert.NoError(t, err, "Failed to create kvdb")
+
+	_, err = Init(Config{}, kv)
+	assert.Equal(t, ErrNoNodeID, err)
+
+	const nodes = 4
+	errs := make(chan error, nodes)
+	for i := 0; i < nodes; i++ {
+		go func(id string) {
+			_, err := Init(Config{NodeId: id}, kv)
+			errs <- err
+		}(fmt.Sprintf("node%d", i))
+	}
+	initialized := 0
+	for i := 0; i < nodes; i++ {
+		if err := <-errs; err == nil {
+			initialized++
+		} else {
+			assert.Equal(t, ErrInitialized, err)
+		}
+	}
+	assert.Equal(t, 1, initialized, "Only one node should bootstrap the cluster")
+
+	db, err := readDatabase(kv)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusOk, db.Cluster.Status)
+	assert.Equal(t, DatabaseSchema, db.Cluster.Schema)
+	assert.NotEqual(t, "", db.Cluster.ClusterId, "Cluster ID should be generated")
+	assert.Len(t, db.Nodes, 1)
+
+	existing, err := Init(Config{NodeId: "late", ClusterId: "other"}, kv)
+	assert.Equal(t, ErrInitialized, err)
+	assert.Equal(t, db.Cluster.ClusterId, existing.Cluster.ClusterId)
+}
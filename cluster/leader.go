@@ -0,0 +1,228 @@
+package cluster
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/portworx/kvdb"
+)
+
+const (
+	// DefaultLeaseTTL is how long a node leads a singleton service without
+	// renewing its lease. Another node takes over within this time once the
+	// leader stops or dies.
+	DefaultLeaseTTL = 15 * time.Second
+
+	leaderKey = "cluster/leader/"
+)
+
+var (
+	// ErrNotLeader is returned when the lease of a service is held by
+	// another node.
+	ErrNotLeader = errors.New("Node does not lead the service")
+)
+
+// SingletonService runs until stop is closed. It is run by a SingletonRunner
+// on the node leading the service and stopped when that node loses its
+// lease.
+type SingletonService func(stop <-chan struct{})
+
+// SingletonRunner runs a service on exactly one node of the cluster at a
+// time. Nodes compete for a lease in the KVDB, the node holding it runs the
+// service and renews the lease every third of its TTL. If the leader fails
+// to renew the lease it stops the service, and another node acquires the
+// lease once it expires.
+type SingletonRunner struct {
+	kv      kvdb.Kvdb
+	name    string
+	node    string
+	ttl     time.Duration
+	service SingletonService
+
+	lock    sync.Mutex
+	leading bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewSingletonRunner returns a runner of service, identified across the
+// cluster by name, on behalf of node.
+func NewSingletonRunner(
+	kv kvdb.Kvdb,
+	name string,
+	node string,
+	ttl time.Duration,
+	service SingletonService,
+) *SingletonRunner {
+	if ttl < 3*time.Second {
+		ttl = 3 * time.Second
+	}
+	return &SingletonRunner{
+		kv:      kv,
+		name:    name,
+		node:    node,
+		ttl:     ttl,
+		service: service,
+	}
+}
+
+// RunSingleton starts running service on one node of the cluster at a time.
+func (c *ClusterManager) RunSingleton(name string, service SingletonService) *SingletonRunner {
+	r := NewSingletonRunner(c.kv, name, c.config.NodeId, DefaultLeaseTTL, service)
+	r.Start()
+	return r
+}
+
+func (r *SingletonRunner) key() string {
+	return leaderKey + r.name
+}
+
+// Start competes for the lease of the service until Stop is called.
+func (r *SingletonRunner) Start() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.stop != nil {
+		return
+	}
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.run(r.stop, r.done)
+}
+
+// Stop stops the service if this node leads it and releases the lease so
+// that another node takes over right away.
+func (r *SingletonRunner) Stop() {
+	r.lock.Lock()
+	stop, done := r.stop, r.done
+	r.stop = nil
+	r.lock.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// IsLeader returns true if this node runs the service.
+func (r *SingletonRunner) IsLeader() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.leading
+}
+
+// Leader returns the node leading the service, "" if there is none.
+func (r *SingletonRunner) Leader() (string, error) {
+	kvp, err := r.kv.Get(r.key())
+	if err != nil {
+		if err == kvdb.ErrNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(kvp.Value), nil
+}
+
+func (r *SingletonRunner) run(stop, done chan struct{}) {
+	defer close(done)
+
+	var serviceStop, serviceDone chan struct{}
+	resign := func() {
+		if serviceStop == nil {
+			return
+		}
+		close(serviceStop)
+		<-serviceDone
+		serviceStop = nil
+		r.setLeading(false)
+	}
+
+	tick := time.NewTicker(r.ttl / 3)
+	defer tick.Stop()
+	for {
+		if serviceStop == nil {
+			if r.acquire() {
+				log.Infof("Node %s leads %s", r.node, r.name)
+				r.setLeading(true)
+				serviceStop = make(chan struct{})
+				serviceDone = make(chan struct{})
+				go func(stop, done chan struct{}) {
+					defer close(done)
+					r.service(stop)
+				}(serviceStop, serviceDone)
+			}
+		} else if err := r.renew(); err != nil {
+			log.Warnf("Node %s lost the lead of %s: %v", r.node, r.name, err)
+			resign()
+		}
+
+		select {
+		case <-tick.C:
+		case <-stop:
+			if serviceStop != nil {
+				resign()
+				r.release()
+			}
+			return
+		}
+	}
+}
+
+func (r *SingletonRunner) setLeading(leading bool) {
+	r.lock.Lock()
+	r.leading = leading
+	r.lock.Unlock()
+}
+
+func (r *SingletonRunner) ttlSeconds() uint64 {
+	return uint64(r.ttl / time.Second)
+}
+
+// acquire creates the lease, it fails while another node holds it.
+func (r *SingletonRunner) acquire() bool {
+	_, err := r.kv.Create(r.key(), r.node, r.ttlSeconds())
+	return err == nil
+}
+
+// renew extends the lease held by this node. The lease is only updated if
+// it is unchanged since it was read, so that a lease that expired and was
+// acquired by another node in between is not taken back.
+func (r *SingletonRunner) renew() error {
+	kvp, err := r.lease()
+	if err != nil {
+		return err
+	}
+	kvp.Value = []byte(r.node)
+	kvp.TTL = int64(r.ttlSeconds())
+	_, err = r.kv.CompareAndSet(kvp, kvdb.KVModifiedIndex, nil)
+	return err
+}
+
+// release deletes the lease if this node still holds it.
+func (r *SingletonRunner) release() {
+	kvp, err := r.lease()
+	if err != nil {
+		return
+	}
+	if _, err := r.kv.CompareAndDelete(kvp, kvdb.KVModifiedIndex); err != nil {
+		log.Warnf("Failed to release the lead of %s: %v", r.name, err)
+	}
+}
+
+// lease returns the lease of the service, ErrNotLeader if it is not held by
+// this node.
+func (r *SingletonRunner) lease() (*kvdb.KVPair, error) {
+	kvp, err := r.kv.Get(r.key())
+	if err != nil {
+		if err == kvdb.ErrNotFound {
+			return nil, ErrNotLeader
+		}
+		return nil, err
+	}
+	if string(kvp.Value) != r.node {
+		return nil, ErrNotLeader
+	}
+	return kvp, nil
+}
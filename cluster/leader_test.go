@@ -0,0 +1,69 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/portworx/kvdb"
+	"github.com/portworx/kvdb/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+func waitLeader(r *SingletonRunner) bool {
+	for i := 0; i < 30; i++ {
+		if r.IsLeader() {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSingletonRunner(t *testing.T) {
+	kv, err := kvdb.New(mem.Name, "leader_test", nil, nil)
+	assert.NoError(t, err, "Failed to create kvdb")
+
+	running := make(chan string, 2)
+	service := func(node string) SingletonService {
+		return func(stop <-chan struct{}) {
+			running <- node
+			<-stop
+		}
+	}
+	a := NewSingletonRunner(kv, "test", "a", 0, service("a"))
+	a.Start()
+	assert.True(t, waitLeader(a), "First node should lead")
+	assert.Equal(t, "a", <-running, "Leader should run the service")
+
+	b := NewSingletonRunner(kv, "test", "b", 0, service("b"))
+	b.Start()
+	defer b.Stop()
+	time.Sleep(1500 * time.Millisecond)
+	assert.False(t, b.IsLeader(), "Only one node should lead")
+	leader, err := b.Leader()
+	assert.NoError(t, err, "Failed in Leader")
+	assert.Equal(t, "a", leader, "Lease should be held by the leader")
+
+	a.Stop()
+	assert.False(t, a.IsLeader(), "Stopped node should not lead")
+	assert.True(t, waitLeader(b), "Service should fail over")
+	assert.Equal(t, "b", <-running, "New leader should run the service")
+}
+
+func TestSingletonRenew(t *testing.T) {
+	kv, err := kvdb.New(mem.Name, "leader_renew_test", nil, nil)
+	assert.NoError(t, err, "Failed to create kvdb")
+
+	a := NewSingletonRunner(kv, "test", "a", 0, nil)
+	assert.True(t, a.acquire(), "Failed to acquire the lease")
+	assert.NoError(t, a.renew(), "Failed to renew the lease")
+
+	// The lease expired and was acquired by another node.
+	_, err = kv.Put(a.key(), "b", 0)
+	assert.NoError(t, err, "Failed in Put")
+	assert.Equal(t, ErrNotLeader, a.renew(), "Lease of another node renewed")
+	a.release()
+	leader, err := a.Leader()
+	assert.NoError(t, err, "Failed in Leader")
+	assert.Equal(t, "b", leader, "Lease of another node released")
+}
@@ -0,0 +1,198 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/events"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// ErrVolumeMounted is returned when volumes mounted on a node in
+// maintenance cannot be detached from it.
+var ErrVolumeMounted = errors.New("Volume is mounted on the node")
+
+// EnterMaintenance puts a node in maintenance: no new volumes are placed on
+// it and no volumes are attached on it until ExitMaintenance. If migrate is
+// set the volumes attached on the node are detached from it, so that they
+// can be attached on other nodes. Volumes are unmounted first if the node is
+// this node, volumes mounted on other nodes are left attached. The state is
+// kept in the cluster database and published on the event bus.
+// Errors ErrNodeNotFound, ErrVolumeMounted may be returned.
+func (c *ClusterManager) EnterMaintenance(nodeID string, migrate bool) error {
+	if err := c.setMaintenance(nodeID, true); err != nil {
+		return err
+	}
+	if migrate {
+		return c.evacuate(api.MachineID(nodeID))
+	}
+	return nil
+}
+
+// ExitMaintenance puts a node in maintenance back in service.
+// Errors ErrNodeNotFound may be returned.
+func (c *ClusterManager) ExitMaintenance(nodeID string) error {
+	return c.setMaintenance(nodeID, false)
+}
+
+// InMaintenance returns true if nodeID is in maintenance.
+func (c *ClusterManager) InMaintenance(nodeID string) bool {
+	maintenance, err := c.maintenance()
+	if err != nil {
+		log.Warnf("Failed to read the maintenance of node %s: %v", nodeID, err)
+		return false
+	}
+	return maintenance[nodeID]
+}
+
+// maintenance returns the nodes in maintenance.
+func (c *ClusterManager) maintenance() (map[string]bool, error) {
+	db, err := readDatabase(c.kv)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]bool)
+	for id, n := range db.Nodes {
+		if n.Maintenance {
+			nodes[id] = true
+		}
+	}
+	return nodes, nil
+}
+
+func (c *ClusterManager) setMaintenance(nodeID string, on bool) error {
+	kvlock, err := c.kv.Lock(lockKey, 60)
+	if err != nil {
+		return err
+	}
+	db, err := readDatabase(c.kv)
+	if err != nil {
+		c.kv.Unlock(kvlock)
+		return err
+	}
+	n, ok := db.Nodes[nodeID]
+	if !ok {
+		c.kv.Unlock(kvlock)
+		return ErrNodeNotFound
+	}
+	if n.Maintenance == on {
+		c.kv.Unlock(kvlock)
+		return nil
+	}
+	n.Maintenance = on
+	db.Nodes[nodeID] = n
+	err = writeDatabase(c.kv, &db)
+	c.kv.Unlock(kvlock)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	info, ok := c.nodeInfo[nodeID]
+	if ok {
+		info.Maintenance = on
+		c.nodeInfo[nodeID] = info
+	}
+	c.lock.Unlock()
+	if !ok {
+		info = NodeInfo{NodeId: nodeID, Ip: n.Ip, Status: n.Status, Topology: n.Topology, Maintenance: on}
+	}
+
+	t := api.EventNodeMaintenanceEnd
+	if on {
+		t = api.EventNodeMaintenanceStart
+	}
+	log.Infof("Node %s %s in cluster %s", nodeID, t, c.config.ClusterId)
+	events.Publish(api.Event{
+		Type:    t,
+		Node:    api.MachineID(c.config.NodeId),
+		Subject: api.MachineID(nodeID),
+	})
+	for e := c.listeners.Front(); e != nil; e = e.Next() {
+		if err := e.Value.(ClusterListener).Update(&info); err != nil {
+			log.Warnf("Failed to notify %s: %v",
+				e.Value.(ClusterListener).String(), err)
+		}
+	}
+	return nil
+}
+
+// evacuate detaches the volumes of all drivers from node. It returns the
+// last error met, the other volumes are still evacuated.
+func (c *ClusterManager) evacuate(node api.MachineID) error {
+	var last error
+	for name, d := range stores() {
+		vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+		if err != nil {
+			log.Warnf("Failed to evacuate %s volumes from node %s: %v", name, node, err)
+			last = err
+			continue
+		}
+		for _, v := range vols {
+			if !attachedOn(&v, node) {
+				continue
+			}
+			if node == api.MachineID(c.config.NodeId) {
+				err = evacuateLocal(d, v.ID, node)
+			} else {
+				err = evacuateVolume(d.(volume.Store), v.ID, node)
+			}
+			if err != nil {
+				log.Warnf("Failed to evacuate volume %v from node %s: %v", v.ID, node, err)
+				last = err
+			}
+		}
+	}
+	return last
+}
+
+func attachedOn(v *api.Volume, node api.MachineID) bool {
+	for _, a := range v.Attachments {
+		if a.Node == node {
+			return true
+		}
+	}
+	return false
+}
+
+// evacuateLocal unmounts and detaches volumeID from node, this node.
+func evacuateLocal(d volume.VolumeDriver, volumeID api.VolumeID, node api.MachineID) error {
+	mounts, err := volume.Mounts(d, volumeID)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	for _, m := range mounts {
+		if err = volume.UnmountCtx(ctx, d, volumeID, m.Path); err != nil {
+			return err
+		}
+	}
+	if d.Type()&volume.Block != 0 {
+		return volume.DetachCtx(ctx, d, volumeID)
+	}
+	return evacuateVolume(d.(volume.Store), volumeID, node)
+}
+
+// evacuateVolume records volumeID of store detached from node, unless the
+// volume is mounted.
+func evacuateVolume(store volume.Store, volumeID api.VolumeID, node api.MachineID) error {
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer store.Unlock(token)
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath != "" {
+		return ErrVolumeMounted
+	}
+	if !detach(v, node) {
+		return nil
+	}
+	return store.UpdateVol(v)
+}
@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/portworx/kvdb/mem"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+func TestMaintenance(t *testing.T) {
+	kv, err := kvdb.New(mem.Name, "maintenance_test", nil, nil)
+	assert.NoError(t, err, "Failed to create kvdb")
+	cfg := Config{ClusterId: "maintenance_test", NodeId: "a"}
+	db, err := Init(cfg, kv)
+	assert.NoError(t, err, "Failed to initialize cluster")
+	db.Nodes["b"] = Node{Status: StatusOk}
+	assert.NoError(t, writeDatabase(kv, db))
+
+	c := &ClusterManager{
+		config:    cfg,
+		kv:        kv,
+		listeners: list.New(),
+		nodeInfo:  map[string]NodeInfo{"b": {NodeId: "b", Status: StatusOk}},
+	}
+	ids := func() []api.MachineID {
+		nodes, err := c.Candidates()
+		assert.NoError(t, err)
+		var ids []api.MachineID
+		for _, n := range nodes {
+			ids = append(ids, n.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []api.MachineID{"a", "b"}, ids())
+
+	assert.Equal(t, ErrNodeNotFound, c.EnterMaintenance("c", false))
+	assert.NoError(t, c.EnterMaintenance("b", true))
+	assert.True(t, c.InMaintenance("b"))
+	assert.Equal(t, StatusOk, c.nodeInfo["b"].Status, "Maintenance changed the status of the node")
+	assert.True(t, c.nodeInfo["b"].Maintenance)
+	assert.False(t, c.InMaintenance("a"))
+	assert.Equal(t, []api.MachineID{"a"}, ids(), "Node in maintenance should not be a candidate")
+	assert.NoError(t, c.EnterMaintenance("a", false))
+	assert.Empty(t, ids())
+
+	assert.NoError(t, c.ExitMaintenance("b"))
+	assert.False(t, c.InMaintenance("b"))
+	assert.False(t, c.nodeInfo["b"].Maintenance)
+	assert.Equal(t, []api.MachineID{"b"}, ids())
+
+	status, err := c.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, "maintenance_test", status.ID)
+	assert.Equal(t, api.MemberOnline, status.Status)
+	assert.Equal(t, map[api.MemberStatus]int{api.MemberOnline: 1, api.MemberMaintenance: 1}, status.Nodes)
+	node, err := c.Node("a")
+	assert.NoError(t, err)
+	assert.Equal(t, api.MemberMaintenance, node.Status)
+	_, err = c.Node("c")
+	assert.Equal(t, ErrNodeNotFound, err)
+}
+
+func TestEvacuateVolume(t *testing.T) {
+	kv, err := kvdb.New(mem.Name, "evacuate_test", nil, nil)
+	assert.NoError(t, err, "Failed to create kvdb")
+	store := volume.NewDefaultEnumerator("evacuate_test", kv)
+	vol := &api.Volume{
+		ID:          "evacuate_test_vol",
+		State:       api.VolumeAttached,
+		AttachedOn:  "b",
+		AttachPath:  "/mnt/evacuate_test",
+		Attachments: []api.Attachment{{Node: "b"}},
+	}
+	assert.NoError(t, store.CreateVol(vol))
+
+	assert.Equal(t, ErrVolumeMounted, evacuateVolume(store, vol.ID, "b"), "Mounted volume detached")
+	vol.AttachPath = ""
+	assert.NoError(t, store.UpdateVol(vol))
+	assert.NoError(t, evacuateVolume(store, vol.ID, "b"))
+	v, err := store.GetVol(vol.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, api.VolumeDetached, v.State)
+	assert.Empty(t, v.Attachments)
+}
@@ -6,13 +6,18 @@ package cluster
 import (
 	"container/list"
 	"errors"
+	"math"
 	"net"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 
 	kv "github.com/portworx/kvdb"
 	"github.com/portworx/systemutils"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/events"
 )
 
 type ClusterManager struct {
@@ -20,6 +25,13 @@ type ClusterManager struct {
 	config    Config
 	kv        kv.Kvdb
 	nodeInfo  map[string]NodeInfo // Info on the nodes in the cluster
+	scheduler Scheduler
+	lock      sync.Mutex // Protects nodeInfo
+
+	topologyOnce  sync.Once
+	cloudTopology Topology // Of this node, from the cloud metadata
+
+	nodeEvents *SingletonRunner // Leads the events of status changes
 }
 
 func externalIp() (string, error) {
@@ -61,11 +73,74 @@ func externalIp() (string, error) {
 }
 
 func (c *ClusterManager) AddEventListener(listener ClusterListener) error {
-	log.Printf("Adding cluster event listener: %s", listener.String())
+	log.Infof("Adding cluster event listener: %s", listener.String())
 	c.listeners.PushBack(listener)
 	return nil
 }
 
+// Scheduler returns the volume placement scheduler for this cluster.
+func (c *ClusterManager) Scheduler() Scheduler {
+	return c.scheduler
+}
+
+// Candidates returns this node and the nodes that are online as placement
+// candidates, except those in maintenance. Node capacity is not tracked by
+// the cluster, candidates are reported with unlimited free space and class
+// of service.
+func (c *ClusterManager) Candidates() ([]Candidate, error) {
+	maintenance, err := c.maintenance()
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	nodes := make([]Candidate, 0, len(c.nodeInfo)+1)
+	if !maintenance[c.config.NodeId] {
+		nodes = append(nodes, Candidate{
+			ID:       api.MachineID(c.config.NodeId),
+			Free:     math.MaxUint64,
+			MaxCos:   api.VolumeCosMax,
+			Topology: c.topology(),
+		})
+	}
+	for id, info := range c.nodeInfo {
+		if id == c.config.NodeId || info.Status != StatusOk || maintenance[id] {
+			continue
+		}
+		nodes = append(nodes, Candidate{
+			ID:       api.MachineID(id),
+			Free:     math.MaxUint64,
+			MaxCos:   api.VolumeCosMax,
+			Topology: info.Topology,
+		})
+	}
+	return nodes, nil
+}
+
+// observedNode publishes the event of a status change seen in heartbeats.
+// Every node sees them, only the node leading the node events publishes
+// them so that they are published once.
+func (c *ClusterManager) observedNode(info *NodeInfo) {
+	if c.nodeEvents != nil && !c.nodeEvents.IsLeader() {
+		return
+	}
+	c.publishNode(info)
+}
+
+// publishNode publishes a NodeUp or NodeDown event for a node whose status
+// changed.
+func (c *ClusterManager) publishNode(info *NodeInfo) {
+	t := api.EventNodeDown
+	if info.Status == StatusOk {
+		t = api.EventNodeUp
+	}
+	events.Publish(api.Event{
+		Type:    t,
+		Node:    api.MachineID(c.config.NodeId),
+		Subject: api.MachineID(info.NodeId),
+	})
+}
+
 func (c *ClusterManager) getInfo() *NodeInfo {
 	var info = NodeInfo{}
 	s := systemutils.New()
@@ -76,6 +151,7 @@ func (c *ClusterManager) getInfo() *NodeInfo {
 	info.NodeId = c.config.NodeId
 	info.Ip, _ = externalIp()
 	info.Status = StatusOk
+	info.Topology = c.topology()
 
 	return &info
 }
@@ -84,10 +160,14 @@ func (c *ClusterManager) initNode(db *Database) (*NodeInfo, bool) {
 	info := c.getInfo()
 
 	node := Node{
-		Ip:     info.Ip,
-		Status: info.Status}
+		Ip:       info.Ip,
+		Status:   info.Status,
+		Topology: info.Topology}
 
-	_, exists := db.Nodes[c.config.NodeId]
+	last, exists := db.Nodes[c.config.NodeId]
+	// Nodes stay in maintenance across restarts.
+	node.Maintenance = last.Maintenance
+	info.Maintenance = last.Maintenance
 
 	// Add us into the database.
 	db.Nodes[c.config.NodeId] = node
@@ -159,15 +239,15 @@ func (c *ClusterManager) initCluster(db *Database, self *NodeInfo, exist bool) e
 	for e := c.listeners.Front(); e != nil; e = e.Next() {
 		err = e.Value.(ClusterListener).ClusterInit(self, db)
 		if err != nil {
-			log.Printf("Failed to initialize %s\n",
-				e.Value.(ClusterListener).String())
+			log.Warnf("Failed to initialize %s: %v",
+				e.Value.(ClusterListener).String(), err)
 			goto done
 		}
 	}
 
 	err = c.joinCluster(db, self, exist)
 	if err != nil {
-		log.Printf("Failed to join new cluster\n")
+		log.Warnf("Failed to join new cluster: %v", err)
 		goto done
 	}
 
@@ -178,13 +258,18 @@ done:
 func (c *ClusterManager) processHeartbeat(err error, ip string, t interface{}) {
 	var info *NodeInfo = t.(*NodeInfo)
 
+	c.lock.Lock()
 	last, ok := c.nodeInfo[info.NodeId]
+	// Maintenance is set in the database, not by the heartbeats of nodes.
+	info.Maintenance = last.Maintenance
 	c.nodeInfo[info.NodeId] = *info
+	c.lock.Unlock()
 
 	// Allert listeners if status changed significantly...
 	if !ok || last.Status != info.Status {
 		log.Info("Node ", info.NodeId, " changed status\n\tIP: ",
 			info.Ip, "\n\tTime: ", info.Timestamp, "\n\tStatus: ", info.Status)
+		c.observedNode(info)
 
 		for e := c.listeners.Front(); e != nil; e = e.Next() {
 			err = e.Value.(ClusterListener).Update(info)
@@ -203,19 +288,26 @@ func (c *ClusterManager) heartBeat() {
 		// ubcast.Push(NodeUpdate, &myInfo)
 
 		// Process heartbeats from other nodes...
+		var offline []NodeInfo
+		c.lock.Lock()
 		for id, info := range c.nodeInfo {
 			if info.Status == StatusOk && time.Since(info.Timestamp) > 10000*time.Millisecond {
 				log.Warn("Detected node ", id, " to be offline.")
 
 				info.Status = StatusOffline
 				c.nodeInfo[id] = info
+				offline = append(offline, info)
+			}
+		}
+		c.lock.Unlock()
 
-				for e := c.listeners.Front(); e != nil; e = e.Next() {
-					err := e.Value.(ClusterListener).Leave(&info)
-					if err != nil {
-						log.Warn("Failed to notify ",
-							e.Value.(ClusterListener).String())
-					}
+		for i := range offline {
+			c.observedNode(&offline[i])
+			for e := c.listeners.Front(); e != nil; e = e.Next() {
+				err := e.Value.(ClusterListener).Leave(&offline[i])
+				if err != nil {
+					log.Warn("Failed to notify ",
+						e.Value.(ClusterListener).String())
 				}
 			}
 		}
@@ -224,14 +316,14 @@ func (c *ClusterManager) heartBeat() {
 
 func (c *ClusterManager) Start() error {
 	log.Info("Cluster manager starting...")
-	kvdb := kv.Instance()
+	kvdb := c.kv
 
-	kvlock, err := kvdb.Lock("cluster/lock", 60)
+	kvlock, err := kvdb.Lock(lockKey, 60)
 	if err != nil {
 		log.Panic("Fatal, Unable to obtain cluster lock.", err)
 	}
 
-	db, err := readDatabase()
+	db, err := readDatabase(kvdb)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -239,14 +331,17 @@ func (c *ClusterManager) Start() error {
 	if db.Cluster.Status == StatusInit {
 		log.Info("Will initialize a new cluster.")
 
-		db.Cluster.Status = StatusOk
-		self, _ := c.initNode(&db)
-
-		// Update the new state of the cluster in the KV Database
-		err = writeDatabase(&db)
+		self := c.getInfo()
+		idb, err := initDatabase(kvdb, c.config, Node{
+			Ip:       self.Ip,
+			Status:   self.Status,
+			Topology: self.Topology,
+		})
 		if err != nil {
 			log.Panic(err)
 		}
+		db = *idb
+		c.config.ClusterId = db.Cluster.ClusterId
 
 		err = kvdb.Unlock(kvlock)
 		if err != nil {
@@ -262,7 +357,7 @@ func (c *ClusterManager) Start() error {
 
 		self, exist := c.initNode(&db)
 
-		err = writeDatabase(&db)
+		err = writeDatabase(kvdb, &db)
 		if err != nil {
 			log.Panic(err)
 		}
@@ -283,7 +378,12 @@ func (c *ClusterManager) Start() error {
 	}
 
 	// Join the clusterwide heartbeat mesh.
+	c.nodeEvents = c.RunSingleton("nodeevents", func(stop <-chan struct{}) { <-stop })
 	go c.heartBeat()
+	go c.reportCapacity()
+	if c.config.OvercommitAlert > 0 || c.config.FreeAlertPercent > 0 {
+		c.RunSingleton("capacity", c.watchCapacity)
+	}
 
 	return nil
 }
@@ -0,0 +1,102 @@
+package cluster
+
+import (
+	"sort"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// memberStatus converts the status of a node or of the cluster.
+func memberStatus(s Status) api.MemberStatus {
+	switch {
+	case s&StatusError != 0:
+		return api.MemberError
+	case s&StatusOffline != 0:
+		return api.MemberOffline
+	case s&StatusOk != 0:
+		return api.MemberOnline
+	default:
+		return api.MemberInit
+	}
+}
+
+// Status returns the state of the cluster and the number of its nodes in
+// each state.
+func (c *ClusterManager) Status() (*api.ClusterStatus, error) {
+	db, err := readDatabase(c.kv)
+	if err != nil {
+		return nil, err
+	}
+	status := &api.ClusterStatus{
+		ID:     db.Cluster.ClusterId,
+		Status: memberStatus(db.Cluster.Status),
+		Node:   api.MachineID(c.config.NodeId),
+		Nodes:  make(map[api.MemberStatus]int),
+	}
+	for _, n := range c.nodes(&db) {
+		status.Nodes[n.Status]++
+	}
+	return status, nil
+}
+
+// Nodes returns the nodes of the cluster, ordered by ID.
+func (c *ClusterManager) Nodes() ([]api.ClusterNode, error) {
+	db, err := readDatabase(c.kv)
+	if err != nil {
+		return nil, err
+	}
+	return c.nodes(&db), nil
+}
+
+// Node returns the node nodeID of the cluster.
+// Errors ErrNodeNotFound may be returned.
+func (c *ClusterManager) Node(nodeID string) (*api.ClusterNode, error) {
+	db, err := readDatabase(c.kv)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := db.Nodes[nodeID]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	node := c.node(nodeID, n)
+	return &node, nil
+}
+
+// nodes returns the nodes of db with their latest heartbeats.
+func (c *ClusterManager) nodes(db *Database) []api.ClusterNode {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	nodes := make([]api.ClusterNode, 0, len(db.Nodes))
+	for id, n := range db.Nodes {
+		nodes = append(nodes, c.node(id, n))
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// node returns node id as stored in the database, with the status and usage
+// of its last heartbeat. The database has the final word on maintenance.
+// c.lock must be held.
+func (c *ClusterManager) node(id string, n Node) api.ClusterNode {
+	node := api.ClusterNode{
+		ID:     api.MachineID(id),
+		Ip:     n.Ip,
+		Status: memberStatus(n.Status),
+		Region: n.Topology.Region,
+		Zone:   n.Topology.Zone,
+		Rack:   n.Topology.Rack,
+	}
+	if info, ok := c.nodeInfo[id]; ok {
+		node.Cpu = info.Cpu
+		node.Memory = info.Memory
+		node.Heartbeat = info.Timestamp
+		node.Status = memberStatus(info.Status)
+	}
+	if n.Maintenance {
+		node.Status = api.MemberMaintenance
+	}
+	return node
+}
@@ -0,0 +1,214 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	kv "github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+var (
+	// ErrNodeNotFound is returned when removing a node that is not in the
+	// cluster.
+	ErrNodeNotFound = errors.New("Node is not in the cluster")
+	// ErrRemoveSelf is returned when a node is asked to remove itself.
+	ErrRemoveSelf = errors.New("Node cannot remove itself from the cluster")
+	// ErrDataLoss is returned when removing a node would lose the only in
+	// sync copy of volumes.
+	ErrDataLoss = errors.New("Node holds the only in sync copy of volumes")
+)
+
+// Remove decommissions a node. Volumes attached on the node are detached
+// from it and its replicas are marked failed so that the replication
+// engines rebuild them on the remaining nodes. The node is then removed from
+// the cluster database and listeners are told it is gone. Remove fails
+// without changing anything if the node holds the only in sync copy of a
+// volume, and leaves the node in the cluster if a volume fails to drain from
+// it, unless force is set.
+// Errors ErrNodeNotFound, ErrRemoveSelf, ErrDataLoss may be returned.
+func (c *ClusterManager) Remove(nodeID string, force bool) error {
+	if nodeID == c.config.NodeId {
+		return ErrRemoveSelf
+	}
+	kvdb := kv.Instance()
+	db, err := readDatabase(kvdb)
+	if err != nil {
+		return err
+	}
+	n, ok := db.Nodes[nodeID]
+	if !ok {
+		return ErrNodeNotFound
+	}
+
+	node := api.MachineID(nodeID)
+	if !force {
+		if err = checkDataLoss(node); err != nil {
+			return err
+		}
+	}
+	if err = drainNode(node, force); err != nil {
+		return err
+	}
+
+	kvlock, err := kvdb.Lock(lockKey, 60)
+	if err != nil {
+		return err
+	}
+	if db, err = readDatabase(kvdb); err == nil {
+		delete(db.Nodes, nodeID)
+		err = writeDatabase(kvdb, &db)
+	}
+	kvdb.Unlock(kvlock)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	info, ok := c.nodeInfo[nodeID]
+	delete(c.nodeInfo, nodeID)
+	c.lock.Unlock()
+	if !ok {
+		info = NodeInfo{NodeId: nodeID, Ip: n.Ip}
+	}
+	info.Status = StatusOffline
+
+	log.Infof("Node %s removed from cluster %s", nodeID, c.config.ClusterId)
+	c.publishNode(&info)
+	for e := c.listeners.Front(); e != nil; e = e.Next() {
+		if err := e.Value.(ClusterListener).Remove(&info); err != nil {
+			log.Warnf("Failed to notify %s: %v",
+				e.Value.(ClusterListener).String(), err)
+		}
+	}
+	return nil
+}
+
+// stores returns the running drivers that keep their volume metadata in a
+// volume.Store.
+func stores() map[string]volume.VolumeDriver {
+	drivers := make(map[string]volume.VolumeDriver)
+	for _, name := range volume.Instances() {
+		d, err := volume.Get(name)
+		if err != nil {
+			continue
+		}
+		if _, ok := d.(volume.Store); ok {
+			drivers[name] = d
+		}
+	}
+	return drivers
+}
+
+// checkDataLoss returns ErrDataLoss if removing node would lose a volume.
+func checkDataLoss(node api.MachineID) error {
+	var lost []api.VolumeID
+	for _, d := range stores() {
+		vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+		if err != nil {
+			return err
+		}
+		for i := range vols {
+			if onlyCopy(&vols[i], node) {
+				lost = append(lost, vols[i].ID)
+			}
+		}
+	}
+	if len(lost) > 0 {
+		return fmt.Errorf("%v: %v", ErrDataLoss, lost)
+	}
+	return nil
+}
+
+// drainNode detaches the volumes of all drivers from node and fails their
+// replicas on it. It stops at the first volume that fails to drain, unless
+// force is set, in which case failures are only logged.
+func drainNode(node api.MachineID, force bool) error {
+	for name, d := range stores() {
+		vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+		if err != nil {
+			if !force {
+				return err
+			}
+			log.Warnf("Failed to drain %s volumes from node %s: %v", name, node, err)
+			continue
+		}
+		for _, v := range vols {
+			if err = drainVolume(d.(volume.Store), v.ID, node, force); err != nil {
+				if !force {
+					return fmt.Errorf("Failed to drain volume %v from node %s: %v", v.ID, node, err)
+				}
+				log.Warnf("Failed to drain volume %v from node %s: %v", v.ID, node, err)
+			}
+		}
+	}
+	return nil
+}
+
+func drainVolume(store volume.Store, volumeID api.VolumeID, node api.MachineID, force bool) error {
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer store.Unlock(token)
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	changed, err := drain(v, node, force)
+	if err != nil || !changed {
+		return err
+	}
+	return store.UpdateVol(v)
+}
+
+// drain detaches v from node and marks its replica on node failed. It
+// returns true if v was changed.
+// Errors ErrDataLoss may be returned if node holds the only in sync copy
+// of v and force is not set.
+func drain(v *api.Volume, node api.MachineID, force bool) (bool, error) {
+	if !force && onlyCopy(v, node) {
+		return false, ErrDataLoss
+	}
+	changed := detach(v, node)
+	for i := range v.Replicas {
+		if v.Replicas[i].Node == node && v.Replicas[i].State != api.ReplicaFailed {
+			v.Replicas[i].State = api.ReplicaFailed
+			v.Replicas[i].Time = time.Now()
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// detach detaches v from node. It returns true if v was attached on node.
+func detach(v *api.Volume, node api.MachineID) bool {
+	for _, a := range v.Attachments {
+		if a.Node == node {
+			log.Infof("Detaching volume %v from node %s", v.ID, node)
+			volume.RecordDetach(v, node)
+			return true
+		}
+	}
+	return false
+}
+
+// onlyCopy returns true if node holds the only in sync replica of v.
+func onlyCopy(v *api.Volume, node api.MachineID) bool {
+	held := false
+	for _, r := range v.Replicas {
+		if r.State != api.ReplicaInSync {
+			continue
+		}
+		if r.Node != node {
+			return false
+		}
+		held = true
+	}
+	return held
+}
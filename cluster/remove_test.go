@@ -0,0 +1,40 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestDrain(t *testing.T) {
+	v := &api.Volume{
+		ID:          "drained",
+		State:       api.VolumeAttached,
+		AttachedOn:  "a",
+		Attachments: []api.Attachment{{Node: "a"}},
+		Replicas: []api.Replica{
+			{Node: "a", State: api.ReplicaInSync},
+			{Node: "b", State: api.ReplicaRebuilding},
+		},
+	}
+	changed, err := drain(v, "a", false)
+	assert.Equal(t, ErrDataLoss, err, "Only in sync copy should not be drained")
+	assert.False(t, changed, "Volume should not change")
+
+	v.Replicas[1].State = api.ReplicaInSync
+	changed, err = drain(v, "a", false)
+	assert.NoError(t, err, "Failed to drain volume")
+	assert.True(t, changed, "Volume should change")
+	assert.Equal(t, api.VolumeDetached, v.State, "Volume should be detached")
+	assert.Equal(t, api.ReplicaFailed, v.Replicas[0].State, "Replica should be failed")
+
+	changed, err = drain(v, "a", false)
+	assert.NoError(t, err, "Failed to drain volume")
+	assert.False(t, changed, "Drained volume should not change")
+
+	changed, err = drain(v, "b", true)
+	assert.NoError(t, err, "Forced drain should not fail")
+	assert.True(t, changed, "Volume should change")
+}
@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+var (
+	// ErrNoPlacement is returned when no set of nodes satisfies a volume spec.
+	ErrNoPlacement = errors.New("Insufficient nodes to place volume")
+)
+
+// Candidate describes a node that is eligible to host a volume replica.
+type Candidate struct {
+	// ID of the node.
+	ID api.MachineID
+	// Free capacity in bytes available for new volumes.
+	Free uint64
+	// MaxCos highest class of service this node can provide.
+	MaxCos api.VolumeCos
+	// Domain failure domain of this node within its zone, the rack of
+	// Topology if empty. Nodes with neither are treated as being in a
+	// failure domain of their own.
+	Domain string
+	// Topology region and zone of this node.
+	Topology Topology
+}
+
+// Scheduler picks the set of nodes a volume should be placed on.
+type Scheduler interface {
+	// Place returns the ReplicaSet for a volume with the specified spec.
+	// The number of nodes returned is spec.HALevel + 1.
+	// Errors ErrNoPlacement may be returned.
+	Place(spec *api.VolumeSpec, nodes []Candidate) ([]api.MachineID, error)
+}
+
+// DefaultScheduler places replicas on the nodes with the most free capacity
+// while spreading them across as many failure domains as possible: distinct
+// regions first, then zones, then racks.
+type DefaultScheduler struct {
+}
+
+// NewDefaultScheduler returns a scheduler that can be shared by clustered
+// drivers.
+func NewDefaultScheduler() *DefaultScheduler {
+	return &DefaultScheduler{}
+}
+
+type byFree []Candidate
+
+func (b byFree) Len() int           { return len(b) }
+func (b byFree) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byFree) Less(i, j int) bool { return b[i].Free > b[j].Free }
+
+// domains returns the region, zone and rack of c, empty if unknown. The
+// rack of a node with no rack is the node itself.
+func domains(c *Candidate) [3]string {
+	d := [3]string{}
+	if c.Topology.Region != "" {
+		d[0] = c.Topology.Region
+	}
+	if c.Topology.Zone != "" {
+		d[1] = c.Topology.Region + "/" + c.Topology.Zone
+	}
+	rack := c.Domain
+	if rack == "" {
+		rack = c.Topology.Rack
+	}
+	if rack == "" {
+		rack = "node:" + string(c.ID)
+	}
+	d[2] = d[1] + "/" + rack
+	return d
+}
+
+// Place implements Scheduler.
+func (s *DefaultScheduler) Place(
+	spec *api.VolumeSpec,
+	nodes []Candidate) ([]api.MachineID, error) {
+
+	if spec == nil || spec.HALevel < 0 {
+		return nil, ErrNoPlacement
+	}
+	replicas := spec.HALevel + 1
+
+	eligible := make([]Candidate, 0, len(nodes))
+	for _, n := range nodes {
+		if n.Free < spec.Size || n.MaxCos < spec.Cos {
+			continue
+		}
+		eligible = append(eligible, n)
+	}
+	if len(eligible) < replicas {
+		return nil, ErrNoPlacement
+	}
+	sort.Stable(byFree(eligible))
+
+	set := make([]api.MachineID, 0, replicas)
+	used := make([]bool, len(eligible))
+	// Replicas placed in each region, zone and rack.
+	placed := make(map[string]int)
+
+	// Each replica goes to the emptiest node sharing the fewest regions,
+	// then zones, then racks with the replicas placed already.
+	for len(set) < replicas {
+		best := -1
+		var bestShared [3]int
+		for i := range eligible {
+			if used[i] {
+				continue
+			}
+			var shared [3]int
+			for l, d := range domains(&eligible[i]) {
+				if d != "" {
+					shared[l] = placed[d]
+				}
+			}
+			if best < 0 || less(shared, bestShared) {
+				best, bestShared = i, shared
+			}
+		}
+		used[best] = true
+		for _, d := range domains(&eligible[best]) {
+			placed[d]++
+		}
+		set = append(set, eligible[best].ID)
+	}
+	return set, nil
+}
+
+// less orders shared domain counts, regions first.
+func less(a, b [3]int) bool {
+	for l := range a {
+		if a[l] != b[l] {
+			return a[l] < b[l]
+		}
+	}
+	return false
+}
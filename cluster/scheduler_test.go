@@ -0,0 +1,44 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestPlace(t *testing.T) {
+	s := NewDefaultScheduler()
+	nodes := []Candidate{
+		{ID: "a", Free: 100, MaxCos: api.VolumeCosMax, Domain: "rack1"},
+		{ID: "b", Free: 300, MaxCos: api.VolumeCosMax, Domain: "rack1"},
+		{ID: "c", Free: 200, MaxCos: api.VolumeCosNone, Domain: "rack2"},
+		{ID: "d", Free: 50, MaxCos: api.VolumeCosMax, Domain: "rack2"},
+	}
+
+	set, err := s.Place(&api.VolumeSpec{Size: 10, HALevel: 1}, nodes)
+	assert.NoError(t, err, "Failed in Place")
+	assert.Equal(t, []api.MachineID{"b", "c"}, set, "Replicas should span failure domains")
+
+	set, err = s.Place(&api.VolumeSpec{Size: 10, HALevel: 1, Cos: api.VolumeCosMedium}, nodes)
+	assert.NoError(t, err, "Failed in Place")
+	assert.Equal(t, []api.MachineID{"b", "d"}, set, "Nodes below the requested CoS should be skipped")
+
+	set, err = s.Place(&api.VolumeSpec{Size: 150, HALevel: 2}, nodes)
+	assert.Equal(t, ErrNoPlacement, err, "Place should fail without enough capacity")
+
+	zoned := []Candidate{
+		{ID: "a", Free: 400, MaxCos: api.VolumeCosMax, Topology: Topology{Region: "r1", Zone: "z1", Rack: "k1"}},
+		{ID: "b", Free: 300, MaxCos: api.VolumeCosMax, Topology: Topology{Region: "r1", Zone: "z1", Rack: "k2"}},
+		{ID: "c", Free: 200, MaxCos: api.VolumeCosMax, Topology: Topology{Region: "r1", Zone: "z2", Rack: "k1"}},
+		{ID: "d", Free: 100, MaxCos: api.VolumeCosMax, Topology: Topology{Region: "r1", Zone: "z1", Rack: "k1"}},
+	}
+	set, err = s.Place(&api.VolumeSpec{Size: 10, HALevel: 1}, zoned)
+	assert.NoError(t, err, "Failed in Place")
+	assert.Equal(t, []api.MachineID{"a", "c"}, set, "Replicas should span zones")
+
+	set, err = s.Place(&api.VolumeSpec{Size: 10, HALevel: 2}, zoned)
+	assert.NoError(t, err, "Failed in Place")
+	assert.Equal(t, []api.MachineID{"a", "c", "b"}, set, "Replicas should span racks within a zone")
+}
@@ -0,0 +1,84 @@
+package cluster
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/pkg/cloudprovider"
+)
+
+var (
+	// awsZoneURL is the availability zone of an EC2 instance.
+	awsZoneURL = "http://169.254.169.254/latest/meta-data/placement/availability-zone"
+	// gceZoneURL is the zone of a GCE instance, as projects/<n>/zones/<zone>.
+	gceZoneURL = "http://metadata.google.internal/computeMetadata/v1/instance/zone"
+)
+
+// Topology is where a node sits in the failure domains of the cluster. The
+// scheduler spreads the replicas of a volume across regions, then zones,
+// then racks. Empty labels are unknown and do not constrain placement.
+type Topology struct {
+	Region string `json:",omitempty" yaml:",omitempty"`
+	Zone   string `json:",omitempty" yaml:",omitempty"`
+	Rack   string `json:",omitempty" yaml:",omitempty"`
+}
+
+func (t Topology) String() string {
+	var labels []string
+	for _, l := range []struct{ k, v string }{
+		{"region", t.Region}, {"zone", t.Zone}, {"rack", t.Rack},
+	} {
+		if l.v != "" {
+			labels = append(labels, l.k+"="+l.v)
+		}
+	}
+	return strings.Join(labels, ",")
+}
+
+// cloudTopology returns the region and zone of this node from the metadata
+// service of the cloud it runs in, if any.
+func cloudTopology() (Topology, bool) {
+	if zone, err := cloudprovider.Metadata(awsZoneURL, nil); err == nil && len(zone) > 1 {
+		// Zones are the region followed by a letter, such as us-east-1a.
+		return Topology{Region: zone[:len(zone)-1], Zone: zone}, true
+	}
+	header := http.Header{"Metadata-Flavor": []string{"Google"}}
+	if zone, err := cloudprovider.Metadata(gceZoneURL, header); err == nil && zone != "" {
+		zone = path.Base(zone)
+		// Zones are the region followed by a suffix, such as us-central1-a.
+		region := zone
+		if i := strings.LastIndex(zone, "-"); i > 0 {
+			region = zone[:i]
+		}
+		return Topology{Region: region, Zone: zone}, true
+	}
+	return Topology{}, false
+}
+
+// topology returns the topology of this node: that of the config, with the
+// region and zone from the cloud metadata if TopologyFromCloud is set and
+// the config does not set them.
+func (c *ClusterManager) topology() Topology {
+	t := c.config.Topology
+	if !c.config.TopologyFromCloud || (t.Region != "" && t.Zone != "") {
+		return t
+	}
+	c.topologyOnce.Do(func() {
+		cloud, ok := cloudTopology()
+		if !ok {
+			log.Warn("Cloud metadata unavailable, node topology is ", t)
+			return
+		}
+		c.cloudTopology = cloud
+	})
+	if t.Region == "" {
+		t.Region = c.cloudTopology.Region
+	}
+	if t.Zone == "" {
+		t.Zone = c.cloudTopology.Zone
+	}
+	return t
+}
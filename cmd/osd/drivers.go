@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/libopenstorage/openstorage/drivers/aws"
+	"github.com/libopenstorage/openstorage/drivers/btrfs"
+	"github.com/libopenstorage/openstorage/drivers/chaos"
+	"github.com/libopenstorage/openstorage/drivers/cifs"
+	"github.com/libopenstorage/openstorage/drivers/digitalocean"
+	"github.com/libopenstorage/openstorage/drivers/dm"
+	"github.com/libopenstorage/openstorage/drivers/gce"
+	"github.com/libopenstorage/openstorage/drivers/gluster"
+	"github.com/libopenstorage/openstorage/drivers/nfs"
+	"github.com/libopenstorage/openstorage/drivers/pwx"
+	"github.com/libopenstorage/openstorage/drivers/s3"
+	"github.com/libopenstorage/openstorage/drivers/vfile"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// Driver is the description of a supported OST driver. New Drivers are added to
+// the drivers array
+type Driver struct {
+	driverType volume.DriverType
+	name       string
+}
+
+var (
+	drivers = []Driver{
+		// AWS driver provisions storage from EBS.
+		{driverType: aws.Type, name: aws.Name},
+		// GCE driver provisions storage from persistent disks.
+		{driverType: gce.Type, name: gce.Name},
+		// DigitalOcean driver provisions storage from block storage volumes.
+		{driverType: digitalocean.Type, name: digitalocean.Name},
+		// NFS driver provisions storage from an NFS server.
+		{driverType: nfs.Type, name: nfs.Name},
+		// CIFS driver provisions storage from an SMB share.
+		{driverType: cifs.Type, name: cifs.Name},
+		// Gluster driver provisions storage from a GlusterFS volume.
+		{driverType: gluster.Type, name: gluster.Name},
+		// BTRFS driver provisions storage from local btrfs.
+		{driverType: btrfs.Type, name: btrfs.Name},
+		// DM driver provisions storage from local disks with device mapper.
+		{driverType: dm.Type, name: dm.Name},
+		// VFILE driver provisions block volumes from image files.
+		{driverType: vfile.Type, name: vfile.Name},
+		// PWX driver provisions storage from PWX cluster.
+		{driverType: pwx.Type, name: pwx.Name},
+		// S3 driver provisions buckets from S3 or an S3 compatible store.
+		{driverType: s3.Type, name: s3.Name},
+		// Chaos driver injects faults into another driver for testing.
+		{driverType: chaos.Type, name: chaos.Name},
+	}
+)
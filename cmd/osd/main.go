@@ -0,0 +1,556 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"github.com/portworx/kvdb"
+	"github.com/portworx/kvdb/etcd"
+	"github.com/portworx/kvdb/mem"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/apiserver"
+	"github.com/libopenstorage/openstorage/audit"
+	osdcli "github.com/libopenstorage/openstorage/cli"
+	"github.com/libopenstorage/openstorage/cloudsnap"
+	"github.com/libopenstorage/openstorage/cluster"
+	"github.com/libopenstorage/openstorage/config"
+	"github.com/libopenstorage/openstorage/events"
+	"github.com/libopenstorage/openstorage/export"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/metrics"
+	"github.com/libopenstorage/openstorage/pkg/cache"
+	"github.com/libopenstorage/openstorage/quota"
+	"github.com/libopenstorage/openstorage/replication"
+	"github.com/libopenstorage/openstorage/report"
+	"github.com/libopenstorage/openstorage/secrets"
+	"github.com/libopenstorage/openstorage/tracing"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	version = "0.3"
+
+	// shutdownTimeout is how long requests in progress are given to
+	// complete once a signal is received.
+	shutdownTimeout = 30 * time.Second
+)
+
+func start(c *cli.Context) {
+	if !osdcli.DaemonMode(c) {
+		cli.ShowAppHelp(c)
+		return
+	}
+
+	datastores := []string{mem.Name, etcd.Name}
+
+	// We are in daemon mode.
+	file := c.String("file")
+	restore := c.Bool("restore")
+	cfg := &config.Config{}
+	var err error
+	if file != "" {
+		if cfg, err = config.Parse(file); err != nil {
+			fmt.Println(err)
+			return
+		}
+	} else if !restore {
+		fmt.Println("OSD configuration file not specified.  Visit openstorage.org for an example.")
+		return
+	}
+	if err = setupLogging(&cfg.Osd.Logging); err != nil {
+		fmt.Println("Unable to configure logging: ", err)
+		return
+	}
+	setupTracing(&cfg.Osd.Tracing)
+	if err = setupHooks(cfg.Osd.Hooks); err != nil {
+		fmt.Println("Unable to configure hooks: ", err)
+		return
+	}
+	if err = quota.Enable(); err != nil {
+		fmt.Println("Unable to enforce quotas: ", err)
+		return
+	}
+
+	kvdbURL := c.String("kvdb")
+	u, err := url.Parse(kvdbURL)
+	scheme := u.Scheme
+	u.Scheme = "http"
+
+	kv, err := kvdb.New(scheme, "openstorage", []string{u.String()}, nil)
+	if err != nil {
+		fmt.Println("Failed to initialize KVDB: ", u.Scheme, err)
+		fmt.Println("Supported datastores: ", datastores)
+		return
+	}
+	err = kvdb.SetInstance(kv)
+	if err != nil {
+		fmt.Println("Failed to initialize KVDB: ", err)
+		return
+	}
+
+	// Persist the params of started drivers, so --restore can bring them back.
+	if store := c.String("driver-store"); store != "" {
+		volume.SetConfigStore(config.NewFileStore(store))
+	} else {
+		node := cfg.Osd.ClusterConfig.NodeId
+		if node == "" {
+			node, _ = os.Hostname()
+		}
+		volume.SetConfigStore(volume.NewKVDBConfigStore(kv, node))
+	}
+
+	// Store the metadata of the drivers started below in this KVDB.
+	volume.SetKvdb(kv)
+
+	// Journal volume operations, so that those interrupted by a crash are
+	// recovered when their driver starts again.
+	volume.SetJournal(kv)
+
+	// List the cloud snapshots of volumes in their dependency graphs.
+	volume.SetBackups(cloudsnap.Enumerate)
+
+	// Record who did what to which volume.
+	if !cfg.Osd.Audit.Disabled {
+		ttl := time.Duration(cfg.Osd.Audit.RetentionDays) * 24 * time.Hour
+		audit.AddSink(audit.NewKVDBSink(kv, ttl))
+	}
+	if cfg.Osd.Audit.File != "" {
+		audit.AddSink(audit.NewFileSink(cfg.Osd.Audit.File))
+	}
+
+	if cfg.Osd.ClusterConfig.NodeId != "" {
+		volume.SetNodeID(api.MachineID(cfg.Osd.ClusterConfig.NodeId))
+	}
+	volume.SetClusterID(cfg.Osd.ClusterConfig.ClusterId)
+
+	// Start the cluster state machine, if enabled.
+	var cm *cluster.ClusterManager
+	if cfg.Osd.ClusterConfig.NodeId != "" && cfg.Osd.ClusterConfig.ClusterId != "" {
+		cm, err = cluster.New(cfg.Osd.ClusterConfig, kv)
+		if err != nil {
+			fmt.Println("Failed to initialize cluster: ", err)
+			return
+		}
+		// Share cluster and volume events with the other nodes.
+		nodeID := api.MachineID(cfg.Osd.ClusterConfig.NodeId)
+		if err = events.Share(kv, nodeID, events.DefaultTTL); err != nil {
+			fmt.Println("Failed to share events: ", err)
+			return
+		}
+		// Freeze the mounts of volumes put in maintenance on other nodes.
+		go volume.FollowMaintenance(nil)
+		// Run cluster wide services such as the trash reaper on one node.
+		volume.SetSingleton(func(name string, service func(stop <-chan struct{})) func() {
+			return cm.RunSingleton(name, service).Stop
+		})
+		// Refuse attaches while this node is in maintenance.
+		volume.SetNodeMaintenance(func() bool {
+			return cm.InMaintenance(cfg.Osd.ClusterConfig.NodeId)
+		})
+		// Refuse volumes with more replicas than the cluster has nodes.
+		volume.SetClusterSize(func() int {
+			nodes, _ := cm.Candidates()
+			return len(nodes)
+		})
+	}
+
+	// Secure the REST API on TCP ports, if enabled.
+	if err = setupAPISecurity(&cfg.Osd.API); err != nil {
+		fmt.Println("Unable to configure API security: ", err)
+		return
+	}
+	setupRateLimits(&cfg.Osd.API)
+
+	// Read the credentials of the drivers from secrets providers.
+	if err = setupSecrets(&cfg.Osd.Secrets); err != nil {
+		fmt.Println("Unable to configure secrets: ", err)
+		return
+	}
+
+	// Limit expensive operations across all drivers.
+	for op, n := range cfg.Osd.Concurrency {
+		volume.SetConcurrency(volume.Op(op), n)
+	}
+	for class, limit := range cfg.Osd.Bandwidth {
+		volume.SetBandwidth(volume.BandwidthClass(class), limit)
+	}
+	cache.SetDevices(cfg.Osd.Cache.Devices)
+	export.Register(export.NewISCSITarget(cfg.Osd.Export.ISCSI))
+	export.Register(export.NewNVMeoFTarget(cfg.Osd.Export.NVMeoF))
+
+	// Start the volume drivers.
+	for d, v := range cfg.Osd.Drivers {
+		fmt.Println("Starting volume driver: ", d)
+		if _, err := volume.New(d, v); err != nil {
+			fmt.Println("Unable to start volume driver: ", d, err)
+			return
+		}
+		if err = startDriverAPI(d, cfg, cm); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	// Bring back the drivers enabled before the last restart.
+	if restore {
+		names, err := volume.Restore()
+		if err != nil {
+			fmt.Println("Unable to restore volume drivers: ", err)
+		}
+		for _, d := range names {
+			if err = startDriverAPI(d, cfg, cm); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+	}
+
+	// Start and remove drivers on request while running.
+	added := func(d string) error { return startDriverAPI(d, cfg, cm) }
+	if err = apiserver.StartManagerAPI(0, config.DriverAPIBase, added, stopDriver); err != nil {
+		fmt.Println("Unable to start the driver manager: ", err)
+		return
+	}
+
+	// Start periodic reports, if enabled.
+	if cfg.Osd.Report.Sink != "" {
+		sink, err := report.NewSink(cfg.Osd.Report.Sink)
+		if err != nil {
+			fmt.Println("Unable to start reporting: ", err)
+			return
+		}
+		r, err := report.New(report.Config{
+			Drivers:     volume.Instances(),
+			Interval:    time.Duration(cfg.Osd.Report.Interval) * time.Minute,
+			Format:      report.Format(cfg.Osd.Report.Format),
+			TenantLabel: cfg.Osd.Report.TenantLabel,
+			Sink:        sink,
+		})
+		if err != nil {
+			fmt.Println("Unable to start reporting: ", err)
+			return
+		}
+		r.Start()
+		stoppers = append(stoppers, r.Stop)
+	}
+
+	// Push metrics, if enabled.
+	if len(cfg.Osd.Metrics.Sinks) > 0 {
+		p, err := newMetricsPusher(&cfg.Osd.Metrics)
+		if err != nil {
+			fmt.Println("Unable to push metrics: ", err)
+			return
+		}
+		p.Start()
+		stoppers = append(stoppers, p.Stop)
+	}
+
+	// Run until we are told to exit.
+	waitForSignal()
+}
+
+// stoppers stop the background services of the daemon on shutdown.
+var stoppers []func()
+
+var (
+	driverStoppersLock sync.Mutex
+	// driverStoppers stop the background services of each driver.
+	driverStoppers = make(map[string][]func())
+)
+
+// stopDriver stops the background services of driver d once it is removed.
+func stopDriver(d string) {
+	driverStoppersLock.Lock()
+	defer driverStoppersLock.Unlock()
+	for _, stop := range driverStoppers[d] {
+		stop()
+	}
+	delete(driverStoppers, d)
+}
+
+// waitForSignal blocks until SIGINT or SIGTERM, then stops serving requests,
+// once those in progress complete, and shuts down the volume drivers.
+func waitForSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	s := <-sig
+	log.Infof("Received %v, shutting down", s)
+
+	apiserver.Shutdown(shutdownTimeout)
+	for _, stop := range stoppers {
+		stop()
+	}
+	for _, d := range volume.Instances() {
+		stopDriver(d)
+	}
+	volume.Shutdown()
+	log.Info("OSD stopped")
+}
+
+// startDriverAPI serves the REST and plugin APIs of the running driver d and
+// starts replicating its volumes if it opts in.
+func startDriverAPI(d string, cfg *config.Config, cm *cluster.ClusterManager) error {
+	drv, err := volume.Get(d)
+	if err != nil {
+		return err
+	}
+
+	// Replicate volumes across the cluster for drivers that opt in.
+	if cm != nil {
+		if e, err := replication.New(drv, cm.Scheduler(), cm.Candidates); err == nil {
+			cm.AddEventListener(e)
+			e.Start(replication.DefaultInterval)
+			driverStoppersLock.Lock()
+			driverStoppers[d] = append(driverStoppers[d], e.Stop)
+			driverStoppersLock.Unlock()
+		}
+	}
+
+	if err = apiserver.StartDriverAPI(d, cfg.Osd.API.Ports[d], config.DriverAPIBase); err != nil {
+		return fmt.Errorf("Unable to start volume driver: %v", err)
+	}
+	if err = apiserver.StartPluginAPI(d, config.PluginAPIBase); err != nil {
+		return fmt.Errorf("Unable to start volume plugin: %v", err)
+	}
+	// Continue the cloud snapshot uploads interrupted by the last stop.
+	if err = cloudsnap.ResumeUploads(d); err != nil {
+		log.Warnf("Failed to resume the cloud snapshot uploads of %s: %v", d, err)
+	}
+	return nil
+}
+
+// setupRateLimits limits the rate of REST requests of each caller, if
+// enabled.
+func setupRateLimits(c *config.APIConfig) {
+	if c.RateLimit.Rate <= 0 && len(c.MethodRateLimits) == 0 {
+		return
+	}
+	l := apiserver.NewRateLimiter()
+	l.Limit("", c.RateLimit.Rate, c.RateLimit.Burst)
+	for method, r := range c.MethodRateLimits {
+		l.Limit(method, r.Rate, r.Burst)
+	}
+	apiserver.SetRateLimiter(l)
+}
+
+// setupLogging sets the log levels and the number of entries captured.
+func setupLogging(c *config.LoggingConfig) error {
+	if c.Level != "" {
+		if err := logging.SetLevel("", c.Level); err != nil {
+			return err
+		}
+	}
+	for d, level := range c.Drivers {
+		if err := logging.SetLevel(d, level); err != nil {
+			return err
+		}
+	}
+	if c.Capture > 0 {
+		logging.SetCapture(c.Capture)
+	}
+	return nil
+}
+
+// setupTracing exports spans to the configured collector.
+func setupTracing(c *config.TracingConfig) {
+	if c.Collector == "" {
+		return
+	}
+	if c.SampleRate > 0 {
+		tracing.SetSampleRate(c.SampleRate)
+	}
+	tracing.SetExporter(tracing.NewZipkin(c.Collector, "osd"))
+}
+
+// newMetricsPusher returns a pusher of the metrics of all running drivers to
+// the configured sinks.
+func newMetricsPusher(c *config.MetricsConfig) (*metrics.Pusher, error) {
+	emitters := make([]metrics.Emitter, 0, len(c.Sinks))
+	for _, sink := range c.Sinks {
+		e, err := metrics.NewEmitter(sink)
+		if err != nil {
+			return nil, err
+		}
+		emitters = append(emitters, e)
+	}
+	interval := time.Minute
+	if c.Interval > 0 {
+		interval = time.Duration(c.Interval) * time.Second
+	}
+	return metrics.NewPusher(emitters, interval, volume.Instances)
+}
+
+// setupHooks registers the configured webhooks.
+func setupHooks(hooks []config.HookConfig) error {
+	for i, h := range hooks {
+		timeout := 10 * time.Second
+		if h.Timeout > 0 {
+			timeout = time.Duration(h.Timeout) * time.Second
+		}
+		name := fmt.Sprintf("webhook-%d", i)
+		hook := volume.NewWebhook(h.URL, timeout)
+		if err := volume.RegisterHook(name, h.Driver, api.HookPhase(h.Phase), hook, h.Ops...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupSecrets registers the secrets providers that are configured. The
+// secrets passed in plaintext in driver params are kept by the last of them
+// when the params are persisted.
+func setupSecrets(c *config.SecretsConfig) error {
+	if c.Dir != "" {
+		f, err := secrets.NewFile(c.Dir)
+		if err != nil {
+			return err
+		}
+		secrets.Register(secrets.FileScheme, f)
+		volume.SetConfigSecrets(secrets.FileScheme)
+	}
+	if c.VaultAddress != "" {
+		token := os.Getenv("VAULT_TOKEN")
+		if token == "" {
+			return fmt.Errorf("VAULT_TOKEN environment variable must be set")
+		}
+		secrets.Register(secrets.VaultScheme, secrets.NewVault(c.VaultAddress, token, c.VaultMount))
+		volume.SetConfigSecrets(secrets.VaultScheme)
+	}
+	return nil
+}
+
+func setupAPISecurity(c *config.APIConfig) error {
+	var auth apiserver.MultiAuthenticator
+	if len(c.Tokens) != 0 {
+		auth = append(auth, apiserver.NewTokenAuthenticator(c.Tokens))
+	}
+	if c.CertFile == "" {
+		if c.ClientCAFile != "" {
+			return fmt.Errorf("Client certificates require a server certificate")
+		}
+		if len(auth) != 0 {
+			// Tokens sent in the clear would be exposed to the network.
+			return fmt.Errorf("Bearer tokens require TLS, set a server certificate")
+		}
+		return nil
+	}
+	tlsConfig, err := apiserver.NewServerTLSConfig(c.CertFile, c.KeyFile, c.ClientCAFile)
+	if err != nil {
+		return err
+	}
+	if c.ClientCAFile != "" {
+		auth = append(auth, apiserver.NewCertAuthenticator(c.AllowedCNs))
+	}
+	if len(auth) != 0 {
+		apiserver.SetNetworkSecurity(auth, tlsConfig)
+	}
+	return nil
+}
+
+func showVersion(c *cli.Context) {
+	fmt.Println("OSD Version:", version)
+	fmt.Println("Go Version:", runtime.Version())
+	fmt.Println("OS:", runtime.GOOS)
+	fmt.Println("Arch:", runtime.GOARCH)
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "osd"
+	app.Usage = "Open Storage CLI"
+	app.Version = version
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "json,j",
+			Usage: "output in json",
+		},
+		cli.BoolFlag{
+			Name:  osdcli.DaemonAlias,
+			Usage: "Start OSD in daemon mode",
+		},
+		cli.StringSliceFlag{
+			Name:  "driver",
+			Usage: "driver name and options: name=btrfs,root_vol=/var/openstorage/btrfs",
+			Value: new(cli.StringSlice),
+		},
+		cli.StringFlag{
+			Name:  osdcli.InstanceFlag,
+			Usage: "driver instance to manage volumes of, if not named after its driver",
+		},
+		cli.StringFlag{
+			Name:  "kvdb,k",
+			Usage: "uri to kvdb e.g. kv-mem://localhost, etcd://localhost:4001",
+			Value: "kv-mem://localhost",
+		},
+		cli.StringFlag{
+			Name:  "file,f",
+			Usage: "file to read the OSD configuration from.",
+			Value: "",
+		},
+		cli.BoolFlag{
+			Name:  "restore",
+			Usage: "restart the volume drivers that were enabled before the last shutdown",
+		},
+		cli.StringFlag{
+			Name:  "driver-store",
+			Usage: "file to persist enabled drivers to, defaults to the kvdb",
+			Value: "",
+		},
+	}
+	app.Action = start
+
+	app.Commands = []cli.Command{
+		{
+			Name:        "driver",
+			Aliases:     []string{"d"},
+			Usage:       "Manage drivers",
+			Subcommands: osdcli.DriverCommands(),
+		},
+		{
+			Name:        "cluster",
+			Aliases:     []string{"c"},
+			Usage:       "Manage the cluster",
+			Subcommands: osdcli.ClusterCommands(),
+		},
+		{
+			Name:   "version",
+			Usage:  "Display version",
+			Action: showVersion,
+		},
+	}
+
+	for _, v := range drivers {
+		if v.driverType&volume.Block != 0 {
+			c := cli.Command{
+				Name:        v.name,
+				Aliases:     []string{"v"},
+				Usage:       fmt.Sprintf("Manage %s volumes", v.name),
+				Subcommands: osdcli.BlockVolumeCommands(v.name),
+			}
+			app.Commands = append(app.Commands, c)
+		} else if v.driverType&(volume.File|volume.Object) != 0 {
+			c := cli.Command{
+				Name:        v.name,
+				Aliases:     []string{"v"},
+				Usage:       fmt.Sprintf("Manage %s volumes", v.name),
+				Subcommands: osdcli.FileVolumeCommands(v.name),
+			}
+			app.Commands = append(app.Commands, c)
+		} else {
+			fmt.Println("Unable to start volume plugin: ", errors.New("Unknown driver type."))
+			return
+		}
+	}
+	app.Run(os.Args)
+}
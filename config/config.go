@@ -7,13 +7,162 @@ import (
 
 	"gopkg.in/yaml.v2"
 
+	"github.com/libopenstorage/openstorage/api"
 	"github.com/libopenstorage/openstorage/cluster"
+	"github.com/libopenstorage/openstorage/export"
 	"github.com/libopenstorage/openstorage/volume"
 )
 
+// ReportConfig configures periodic cluster reports.
+type ReportConfig struct {
+	// Sink URL the reports are delivered to, reporting is disabled if empty.
+	Sink string
+	// Interval between reports in minutes.
+	Interval int
+	// Format of the reports, json or csv.
+	Format string
+	// TenantLabel volume label used to group capacity by tenant.
+	TenantLabel string
+}
+
+// APIConfig configures the driver REST API on TCP ports. The API is only
+// served over the network when an authentication method is configured.
+type APIConfig struct {
+	// Ports maps a driver name to the TCP port its REST API listens on.
+	Ports map[string]int
+	// Tokens maps bearer tokens to the principal they authenticate. They
+	// require TLS.
+	Tokens map[string]string
+	// CertFile and KeyFile enable TLS.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables client certificate authentication.
+	ClientCAFile string
+	// AllowedCNs restricts the client certificate common names accepted.
+	AllowedCNs []string
+	// RateLimit limits the requests of each caller to all REST servers.
+	RateLimit RateLimitConfig
+	// MethodRateLimits limits the requests of each caller to each operation
+	// with an HTTP method, such as POST to create volumes or GET to
+	// enumerate them, or to a single operation, such as
+	// "POST /volumes".
+	MethodRateLimits map[string]RateLimitConfig
+}
+
+// RateLimitConfig admits Rate requests per second with bursts of up to Burst
+// requests. Requests are not limited if Rate is 0.
+type RateLimitConfig struct {
+	Rate  float64
+	Burst int
+}
+
+// AuditConfig configures the audit log of volume operations. Records are kept
+// in the KVDB unless disabled.
+type AuditConfig struct {
+	// Disabled turns off the KVDB audit log.
+	Disabled bool
+	// RetentionDays records are kept in the KVDB, audit.DefaultRetention
+	// if 0.
+	RetentionDays int
+	// File also appends records to this file if set.
+	File string
+}
+
+// SecretsConfig configures the providers of the secrets that DriverParams
+// reference. Secrets in environment variables are always available.
+type SecretsConfig struct {
+	// Dir enables the file provider of the secrets kept in Dir.
+	Dir string
+	// VaultAddress enables the Vault provider, authenticated with the token
+	// in $VAULT_TOKEN.
+	VaultAddress string
+	// VaultMount path of the KV secrets engine, "secret" by default.
+	VaultMount string
+}
+
+// LoggingConfig configures the log levels and the capture of log entries.
+type LoggingConfig struct {
+	// Level of the components without a level of their own, info if empty.
+	Level string
+	// Drivers maps a driver name to its log level.
+	Drivers map[string]string
+	// Capture number of the latest entries kept for the debug endpoint,
+	// logging.DefaultCapture if 0.
+	Capture int
+}
+
+// TracingConfig configures the export of operation spans.
+type TracingConfig struct {
+	// Collector URL of the Zipkin compatible collector spans are sent to,
+	// such as http://jaeger:9411/api/v2/spans. Spans are not recorded if
+	// empty.
+	Collector string
+	// SampleRate fraction of the traces started by the daemon that are
+	// recorded, all of them if 0.
+	SampleRate float64
+}
+
+// MetricsConfig configures the push of metrics to stats backends that do
+// not scrape the metrics endpoint.
+type MetricsConfig struct {
+	// Sinks URLs metrics are pushed to, such as statsd://host:8125,
+	// graphite://host:2003 or influx+http://host:8086/write?db=osd.
+	Sinks []string
+	// Interval between pushes in seconds, 60 if 0.
+	Interval int
+}
+
+// HookConfig registers a webhook called around volume operations, see
+// volume.RegisterHook.
+type HookConfig struct {
+	// URL the api.HookRequest is POSTed to.
+	URL string
+	// Phase pre calls the hook before the operations, which fail unless
+	// the hook returns 2xx. Phase post calls it once they returned.
+	Phase string
+	// Ops hooked: create, delete, attach or snapshot, all if empty.
+	Ops []string
+	// Driver hooked, all if empty.
+	Driver string
+	// Timeout of the webhook in seconds, 10 if 0.
+	Timeout int
+}
+
+// CacheConfig configures the local caches of block volumes.
+type CacheConfig struct {
+	// Devices local devices of this node the CacheSpec of volumes may name,
+	// their contents are overwritten. Volumes are not cached if empty.
+	Devices []string
+}
+
+// ExportConfig configures the targets block volumes are exported with.
+type ExportConfig struct {
+	// ISCSI configures the iSCSI target, which exports no volume until
+	// its initiators and CHAP credentials are set.
+	ISCSI export.ISCSIConfig
+	// NVMeoF configures the NVMe over Fabrics target.
+	NVMeoF export.NVMeoFConfig
+}
+
 type osd struct {
 	ClusterConfig cluster.Config
 	Drivers       map[string]volume.DriverParams
+	Report        ReportConfig
+	API           APIConfig
+	Audit         AuditConfig
+	// Concurrency limits the format, snapshot and restore operations
+	// running at once across all drivers.
+	Concurrency map[string]int
+	// Bandwidth limits the background data movement across all drivers,
+	// in bytes per second by class such as migration or backup.
+	Bandwidth map[string]uint64
+	Secrets   SecretsConfig
+	Logging   LoggingConfig
+	Tracing   TracingConfig
+	Metrics   MetricsConfig
+	Hooks     []HookConfig
+	Cache     CacheConfig
+	Export    ExportConfig
 }
 
 type Config struct {
@@ -26,7 +175,7 @@ const (
 	UrlKey        = "url"
 	VersionKey    = "version"
 	MountBase     = "/var/lib/osd/mounts/"
-	Version       = "v1"
+	Version       = api.Version
 )
 
 var (
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// FileStore is a volume.ConfigStore that keeps the params of enabled drivers
+// in a YAML file, in the format of the drivers section of the OSD
+// configuration file.
+type FileStore struct {
+	sync.Mutex
+	file string
+}
+
+// NewFileStore returns a FileStore backed by file. The file is created on the
+// first Save.
+func NewFileStore(file string) *FileStore {
+	return &FileStore{file: file}
+}
+
+func (s *FileStore) load() (map[string]volume.DriverParams, error) {
+	drivers := make(map[string]volume.DriverParams)
+	b, err := ioutil.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return drivers, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(b, &drivers); err != nil {
+		return nil, err
+	}
+	return drivers, nil
+}
+
+// store writes drivers to a temporary file and renames it over the store, so
+// that a crash never leaves a partial file behind.
+func (s *FileStore) store(drivers map[string]volume.DriverParams) error {
+	b, err := yaml.Marshal(drivers)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(path.Dir(s.file), 0755); err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// Save implements volume.ConfigStore.
+func (s *FileStore) Save(name string, params volume.DriverParams) error {
+	s.Lock()
+	defer s.Unlock()
+	drivers, err := s.load()
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		params = volume.DriverParams{}
+	}
+	drivers[name] = params
+	return s.store(drivers)
+}
+
+// Remove implements volume.ConfigStore.
+func (s *FileStore) Remove(name string) error {
+	s.Lock()
+	defer s.Unlock()
+	drivers, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := drivers[name]; !ok {
+		return nil
+	}
+	delete(drivers, name)
+	return s.store(drivers)
+}
+
+// Load implements volume.ConfigStore.
+func (s *FileStore) Load() (map[string]volume.DriverParams, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.load()
+}
@@ -2,26 +2,24 @@ package aws
 
 import (
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"os"
-	"os/exec"
 	"strings"
 	"syscall"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
-
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/opsworks"
 
-	"github.com/portworx/kvdb"
-
 	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
 	"github.com/libopenstorage/openstorage/pkg/chaos"
+	"github.com/libopenstorage/openstorage/pkg/cloudprovider"
 	"github.com/libopenstorage/openstorage/pkg/device"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+	"github.com/libopenstorage/openstorage/pkg/mkfs"
+	"github.com/libopenstorage/openstorage/secrets"
 	"github.com/libopenstorage/openstorage/volume"
 )
 
@@ -31,6 +29,9 @@ const (
 	AwsDBKey = "OpenStorageAWSKey"
 )
 
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
 type Metadata struct {
 	zone     string
 	instance string
@@ -52,7 +53,8 @@ type Driver struct {
 }
 
 // Init aws volume driver metadata.
-func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
 	zone, err := metadata("placement/availability-zone")
 	if err != nil {
 		return nil, err
@@ -61,11 +63,17 @@ func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
 	if err != nil {
 		return nil, err
 	}
-	log.Infof("AWS instance %v zone %v", instance, zone)
+	logger.Infof("AWS instance %v zone %v", instance, zone)
 	if accessKey, ok := params["AWS_ACCESS_KEY_ID"]; ok {
 		os.Setenv("AWS_ACCESS_KEY_ID", accessKey)
 	}
-	if secretKey, ok := params["AWS_SECRET_ACCESS_KEY"]; ok {
+	// The secret key may be read from a secret with
+	// AWS_SECRET_ACCESS_KEY_secret.
+	secretKey, err := secrets.Param(params, "AWS_SECRET_ACCESS_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if secretKey != "" {
 		os.Setenv("AWS_SECRET_ACCESS_KEY", secretKey)
 	}
 	if accessKey := os.Getenv("AWS_ACCESS_KEY_ID"); accessKey == "" {
@@ -87,7 +95,7 @@ func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
 			instance: instance,
 		},
 		devices:           "abcdefghijklmnopqrstuvwxyz",
-		DefaultEnumerator: volume.NewDefaultEnumerator(Name, kvdb.Instance()),
+		DefaultEnumerator: c.NewEnumerator(),
 	}
 	return inst, nil
 }
@@ -152,30 +160,7 @@ func mapCos(cos api.VolumeCos) (*int64, *string) {
 
 // metadata retrieves instance metadata specified by key.
 func metadata(key string) (string, error) {
-
-	client := http.Client{Timeout: time.Second * 10}
-	url := "http://169.254.169.254/latest/meta-data/" + key
-
-	res, err := client.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		err = fmt.Errorf("Code %d returned for url %s", res.StatusCode, url)
-		return "", fmt.Errorf("Error querying AWS metadata for key %s: %v", key, err)
-	}
-
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return "", fmt.Errorf("Error querying AWS metadata for key %s: %v", key, err)
-	}
-	if len(body) == 0 {
-		return "", fmt.Errorf("Failed to retrieve AWS metadata for key %s: %v", key, err)
-	}
-
-	return string(body), nil
+	return cloudprovider.Metadata("http://169.254.169.254/latest/meta-data/"+key, nil)
 }
 
 // describe retrieves running instance desscription.
@@ -207,8 +192,22 @@ func (d *Driver) Type() volume.DriverType {
 }
 
 // Status diagnostic information
-func (v *Driver) Status() [][2]string {
-	return [][2]string{}
+func (v *Driver) Status() api.DriverStatus {
+	return api.DriverStatus{
+		Driver: Name,
+		Details: [][2]string{
+			{"Zone", v.md.zone},
+			{"Instance", v.md.instance},
+		},
+	}
+}
+
+// HealthCheck verifies that EC2 is reachable with the driver credentials.
+func (d *Driver) HealthCheck() []api.HealthReason {
+	if _, err := d.describe(); err != nil {
+		return []api.HealthReason{{Check: "ec2", State: api.HealthDown, Message: err.Error()}}
+	}
+	return nil
 }
 
 // Create aws volume from spec.
@@ -241,7 +240,7 @@ func (d *Driver) Create(
 
 	vol, err := d.ec2.CreateVolume(req)
 	if err != nil {
-		log.Warnf("Failed in CreateVolumeRequest :%v", err)
+		logger.Warnf("Failed in CreateVolumeRequest :%v", err)
 		return api.BadVolumeID, err
 	}
 	v := &api.Volume{
@@ -252,9 +251,10 @@ func (d *Driver) Create(
 		LastScan: time.Now(),
 		Format:   "none",
 		State:    api.VolumeAvailable,
+		Parent:   opt.CreateFromSnap,
 	}
 	err = d.UpdateVol(v)
-	log.Infof("Created volume %v", v.ID)
+	logger.Infof("Created volume %v", v.ID)
 	return v.ID, err
 }
 
@@ -388,6 +388,9 @@ func (d *Driver) Inspect(volumeIDs []api.VolumeID) ([]api.Volume, error) {
 }
 
 func (d *Driver) Delete(volumeID api.VolumeID) error {
+	if err := d.CanDelete(volumeID); err != nil {
+		return err
+	}
 	dryRun := false
 	id := string(volumeID)
 	req := &ec2.DeleteVolumeInput{
@@ -401,7 +404,12 @@ func (d *Driver) Delete(volumeID api.VolumeID) error {
 	return nil
 }
 
-func (d *Driver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+// Snapshot creates an EBS snapshot. EBS snapshots cannot be mounted, writable
+// snaps are not supported.
+func (d *Driver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	if writable {
+		return api.BadSnapID, volume.ErrNotSupported
+	}
 	dryRun := false
 	awsID := string(volumeID)
 	request := &ec2.CreateSnapshotInput{
@@ -448,7 +456,21 @@ func (d *Driver) SnapEnumerate(volIds []api.VolumeID, labels api.Labels) ([]api.
 	return nil, volume.ErrNotSupported
 }
 
-func (d *Driver) Attach(volumeID api.VolumeID) (path string, err error) {
+func (d *Driver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (path string, err error) {
+	// EBS volumes can only be attached to a single instance, and always
+	// read-write.
+	if options != nil && (options.Shared || options.ReadOnly ||
+		options.Reservation != api.ReservationNone) {
+		return "", volume.ErrNotSupported
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return "", err
+	}
+	node := api.MachineID(d.md.instance)
+	if err = volume.CheckAttach(v, node, options); err != nil {
+		return "", err
+	}
 	device, err := d.Assign()
 	if err != nil {
 		return "", err
@@ -463,6 +485,9 @@ func (d *Driver) Attach(volumeID api.VolumeID) (path string, err error) {
 	if err != nil {
 		return "", err
 	}
+	volume.RecordAttach(v, node, options)
+	v.DevicePath = *resp.Device
+	err = d.UpdateVol(v)
 	return *resp.Device, err
 }
 
@@ -478,7 +503,7 @@ func (d *Driver) volumeState(ec2VolState *string) api.VolumeState {
 	case ec2.VolumeAttachmentStateAttaching, ec2.VolumeAttachmentStateDetaching:
 		return api.VolumePending
 	default:
-		log.Warnf("Failed to translate EC2 volume status %v", ec2VolState)
+		logger.Warnf("Failed to translate EC2 volume status %v", ec2VolState)
 	}
 	return api.VolumeError
 }
@@ -494,9 +519,8 @@ func (d *Driver) Format(volumeID api.VolumeID) error {
 	if err != nil {
 		return err
 	}
-	cmd := "/sbin/mkfs." + string(v.Spec.Format)
-	_, err = exec.Command(cmd, devicePath).Output()
-	if err != nil {
+	devicePath = volume.TopDevice(d, volumeID, devicePath)
+	if err = mkfs.Format(devicePath, v.Spec); err != nil {
 		return err
 	}
 	v.Format = v.Spec.Format
@@ -516,7 +540,13 @@ func (d *Driver) Detach(volumeID api.VolumeID) error {
 	if err != nil {
 		return err
 	}
-	return err
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	volume.RecordDetach(v, api.MachineID(d.md.instance))
+	v.DevicePath = ""
+	return d.UpdateVol(v)
 }
 
 func (d *Driver) Mount(volumeID api.VolumeID, mountpath string) error {
@@ -524,11 +554,16 @@ func (d *Driver) Mount(volumeID api.VolumeID, mountpath string) error {
 	if err != nil {
 		return fmt.Errorf("Failed to locate volume %q", string(volumeID))
 	}
+	format, err := fs.MountFormat(v)
+	if err != nil {
+		return err
+	}
 	devicePath, err := d.devicePath(volumeID)
 	if err != nil {
 		return err
 	}
-	err = syscall.Mount(devicePath, mountpath, string(v.Spec.Format), 0, "")
+	devicePath = volume.TopDevice(d, volumeID, devicePath)
+	err = fs.MountDevice(devicePath, mountpath, format)
 	if err != nil {
 		return err
 	}
@@ -542,12 +577,13 @@ func (d *Driver) Unmount(volumeID api.VolumeID, mountpath string) error {
 }
 
 func (d *Driver) Shutdown() {
-	log.Printf("%s Shutting down", Name)
+	logger.Infof("%s Shutting down", Name)
 }
 
 func init() {
 	// Register ourselves as an openstorage volume driver.
 	volume.Register(Name, Init)
+	secrets.RegisterParam("AWS_SECRET_ACCESS_KEY")
 	koStrayCreate = chaos.Add("aws", "create", "create in driver before DB")
 	koStrayDelete = chaos.Add("aws", "delete", "create in driver before DB")
 }
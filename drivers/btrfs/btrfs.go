@@ -2,19 +2,19 @@ package btrfs
 
 import (
 	"fmt"
+	"io"
 	"path"
 	"syscall"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
 	graph "github.com/docker/docker/daemon/graphdriver"
 	"github.com/docker/docker/daemon/graphdriver/btrfs"
 	"github.com/pborman/uuid"
 
-	"github.com/portworx/kvdb"
-
 	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
 	"github.com/libopenstorage/openstorage/pkg/chaos"
+	"github.com/libopenstorage/openstorage/pkg/diff"
 	"github.com/libopenstorage/openstorage/volume"
 )
 
@@ -25,6 +25,9 @@ const (
 	Volumes   = "volumes"
 )
 
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
 var (
 	koStrayCreate chaos.ID
 	koStrayDelete chaos.ID
@@ -37,7 +40,8 @@ type driver struct {
 	root  string
 }
 
-func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
 	root, ok := params[RootParam]
 	if !ok {
 		return nil, fmt.Errorf("Root directory should be specified with key %q", RootParam)
@@ -47,7 +51,7 @@ func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
 	if err != nil {
 		return nil, err
 	}
-	s := volume.NewDefaultEnumerator(Name, kvdb.Instance())
+	s := c.NewEnumerator()
 	return &driver{btrfs: d, root: root, DefaultEnumerator: s}, nil
 }
 
@@ -56,15 +60,21 @@ func (d *driver) String() string {
 }
 
 // Status diagnostic information
-func (d *driver) Status() [][2]string {
-	return d.btrfs.Status()
+func (d *driver) Status() api.DriverStatus {
+	return api.DriverStatus{Driver: Name, Details: d.btrfs.Status()}
+}
+
+// HealthCheck verifies that the volumes directory is writable.
+func (d *driver) HealthCheck() []api.HealthReason {
+	return volume.CheckDir(path.Join(d.root, Volumes), false, api.HealthDown)
 }
 
 func (d *driver) Type() volume.DriverType {
 	return Type
 }
 
-// Create a new subvolume. The volume spec is not taken into account.
+// Create a new subvolume. Of the volume spec only the compression is taken
+// into account.
 func (d *driver) Create(locator api.VolumeLocator,
 	options *api.CreateOptions,
 	spec *api.VolumeSpec) (api.VolumeID, error) {
@@ -73,6 +83,10 @@ func (d *driver) Create(locator api.VolumeLocator,
 		return api.BadVolumeID, fmt.Errorf("Filesystem format (%v) must be %v",
 			spec.Format, "btrfs")
 	}
+	c, err := compression(spec)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
 
 	volumeID := uuid.New()
 
@@ -85,7 +99,7 @@ func (d *driver) Create(locator api.VolumeLocator,
 		Format:   "btrfs",
 		State:    api.VolumeAvailable,
 	}
-	err := d.CreateVol(v)
+	err = d.CreateVol(v)
 	if err != nil {
 		return api.BadVolumeID, err
 	}
@@ -97,6 +111,14 @@ func (d *driver) Create(locator api.VolumeLocator,
 	if err != nil {
 		return v.ID, err
 	}
+	if c != "" {
+		if err = setCompression(v.DevicePath, c); err != nil {
+			return v.ID, err
+		}
+	}
+	if err = volume.SetRootDir(v.DevicePath, spec); err != nil {
+		return v.ID, err
+	}
 	err = d.UpdateVol(v)
 	return v.ID, err
 }
@@ -105,7 +127,7 @@ func (d *driver) Create(locator api.VolumeLocator,
 func (d *driver) Delete(volumeID api.VolumeID) error {
 	err := d.DeleteVol(volumeID)
 	if err != nil {
-		log.Println(err)
+		logger.Warn(err)
 		return err
 	}
 
@@ -116,11 +138,16 @@ func (d *driver) Delete(volumeID api.VolumeID) error {
 	return err
 }
 
-// Mount bind mount btrfs subvolume
+// Mount bind mount btrfs subvolume. Writable snaps are mounted by snapID.
 func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
 	v, err := d.GetVol(volumeID)
 	if err != nil {
-		log.Println(err)
+		if snap, serr := d.GetWritableSnap(api.SnapID(volumeID)); serr == nil {
+			return d.mountSnap(snap, mountpath)
+		} else if serr == volume.ErrSnapReadOnly {
+			return serr
+		}
+		logger.Warn(err)
 		return err
 	}
 	err = syscall.Mount(v.DevicePath,
@@ -135,10 +162,25 @@ func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
 	return err
 }
 
+func (d *driver) mountSnap(snap *api.VolumeSnap, mountpath string) error {
+	devicePath, err := d.btrfs.Get(string(snap.ID), "")
+	if err != nil {
+		return err
+	}
+	err = syscall.Mount(devicePath, mountpath, "", syscall.MS_BIND, "")
+	if err != nil {
+		return fmt.Errorf("Failed to mount %v at %v: %v", devicePath, mountpath, err)
+	}
+	return nil
+}
+
 // Unmount btrfs subvolume
 func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
 	v, err := d.GetVol(volumeID)
 	if err != nil {
+		if _, serr := d.GetWritableSnap(api.SnapID(volumeID)); serr == nil {
+			return syscall.Unmount(mountpath, 0)
+		}
 		return err
 	}
 	if v.AttachPath == "" {
@@ -154,13 +196,14 @@ func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
 }
 
 // Snapshot create new subvolume from volume
-func (d *driver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+func (d *driver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
 	snapID := uuid.New()
 
 	snap := &api.VolumeSnap{
 		ID:         api.SnapID(snapID),
 		VolumeID:   volumeID,
 		SnapLabels: labels,
+		Writable:   writable,
 		Ctime:      time.Now(),
 	}
 	err := d.CreateSnap(snap)
@@ -185,6 +228,67 @@ func (d *driver) SnapDelete(snapID api.SnapID) error {
 	return err
 }
 
+// SnapDiff compares the snapshot subvolumes.
+func (d *driver) SnapDiff(fromSnapID, toSnapID api.SnapID) (io.ReadCloser, error) {
+	if _, err := volume.CheckSnapDiff(d, fromSnapID, toSnapID); err != nil {
+		return nil, err
+	}
+	to, err := d.btrfs.Get(string(toSnapID), "")
+	if err != nil {
+		return nil, err
+	}
+	from := ""
+	if fromSnapID != "" {
+		if from, err = d.btrfs.Get(string(fromSnapID), ""); err != nil {
+			return nil, err
+		}
+	}
+	return diff.Dirs(from, to), nil
+}
+
+// Fingerprint hashes the files of the volume subvolume.
+func (d *driver) Fingerprint(volumeID api.VolumeID, base api.SnapID) (*api.Fingerprint, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	baseDir := ""
+	if base != "" {
+		if baseDir, err = d.btrfs.Get(string(base), ""); err != nil {
+			return nil, err
+		}
+	}
+	return d.FingerprintTree(volumeID, v.DevicePath, base, baseDir)
+}
+
+// ApplyDiff writes the files of the diff stream r into the volume.
+func (d *driver) ApplyDiff(volumeID api.VolumeID, r io.Reader) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	return diff.Apply(r, v.DevicePath)
+}
+
+// UsedSize returns the number of bytes stored in the volume directory.
+func (d *driver) UsedSize(volumeID api.VolumeID) (uint64, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return 0, err
+	}
+	return volume.DirUsage(v.DevicePath)
+}
+
+// Scrub reads all the data of a volume, so that btrfs verifies its
+// checksums.
+func (d *driver) Scrub(volumeID api.VolumeID) ([]string, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	return volume.VerifyDir(v.DevicePath)
+}
+
 // Stats for specified volume.
 func (d *driver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
 	return api.VolumeStats{}, nil
@@ -0,0 +1,85 @@
+package btrfs
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// compressions btrfs compresses subvolumes with, the first is the default.
+var compressions = []api.Compression{api.CompressionZstd, api.CompressionZlib, api.CompressionLzo}
+
+// compression returns the algorithm to compress a volume of spec with, empty
+// if it is not compressed.
+func compression(spec *api.VolumeSpec) (api.Compression, error) {
+	if !spec.Compressed {
+		return "", nil
+	}
+	if spec.Compression == "" {
+		return compressions[0], nil
+	}
+	for _, c := range compressions {
+		if c == spec.Compression {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("Compression %q is not supported by %s: %v", spec.Compression, Name, volume.ErrEinval)
+}
+
+// setCompression compresses the data written to the subvolume at dir with c.
+func setCompression(dir string, c api.Compression) error {
+	out, err := exec.Command("btrfs", "property", "set", dir, "compression", string(c)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Failed to compress %s: %v: %s", dir, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// CompressionRatio of the subvolume of volumeID, measured with compsize. It
+// is 0 if compsize is not installed.
+func (d *driver) CompressionRatio(volumeID api.VolumeID) (float64, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = exec.LookPath("compsize"); err != nil {
+		return 0, nil
+	}
+	out, err := exec.Command("compsize", "-b", v.DevicePath).Output()
+	if err != nil {
+		// compsize fails on subvolumes without regular extents.
+		return 0, nil
+	}
+	return compsizeRatio(string(out))
+}
+
+// compsizeRatio returns the ratio of the uncompressed size to the disk usage
+// in the TOTAL line of the output of compsize -b.
+//
+//	Type       Perc     Disk Usage   Uncompressed Referenced
+//	TOTAL       40%          4096        10240        10240
+func compsizeRatio(out string) (float64, error) {
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 4 || f[0] != "TOTAL" {
+			continue
+		}
+		disk, err := strconv.ParseUint(f[2], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		data, err := strconv.ParseUint(f[3], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if disk == 0 {
+			return 0, nil
+		}
+		return float64(data) / float64(disk), nil
+	}
+	return 0, fmt.Errorf("No total in compsize output %q", out)
+}
@@ -0,0 +1,406 @@
+// Package chaos is a fault injection driver. It wraps another volume driver
+// and injects errors, latency and partial failures into its operations, so
+// that orchestration logic can be tested against a misbehaving backend.
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	Name = "chaos"
+	Type = volume.Block
+
+	// DriverParam name of the running driver to wrap.
+	DriverParam = "driver"
+	// ErrorRateParam probability, between 0 and 1, that an operation fails
+	// without reaching the wrapped driver.
+	ErrorRateParam = "error_rate"
+	// PartialRateParam probability that Attach, Mount, Detach or Unmount
+	// fails after the wrapped driver completed it.
+	PartialRateParam = "partial_rate"
+	// LatencyParam delay added to every operation, e.g. "200ms".
+	LatencyParam = "latency"
+	// JitterParam random delay of up to this duration added to the latency.
+	JitterParam = "jitter"
+	// OpsParam comma separated operations faults apply to, all if unset.
+	OpsParam = "ops"
+	// SeedParam seeds the random source, for reproducible runs.
+	SeedParam = "seed"
+)
+
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
+var (
+	// ErrInjected is returned by operations that were made to fail.
+	ErrInjected = errors.New("Injected fault")
+	// ErrPartial is returned by operations that completed on the wrapped
+	// driver but were made to report a failure.
+	ErrPartial = errors.New("Injected partial failure")
+)
+
+// Config describes the faults to inject.
+type Config struct {
+	ErrorRate   float64
+	PartialRate float64
+	Latency     time.Duration
+	Jitter      time.Duration
+	// Ops the faults apply to, such as "create" or "mount". All operations
+	// are affected if empty.
+	Ops  []string
+	Seed int64
+}
+
+// ParseConfig builds a Config from driver params.
+func ParseConfig(params volume.DriverParams) (Config, error) {
+	var err error
+	c := Config{Seed: time.Now().UnixNano()}
+
+	rate := func(key string) (float64, error) {
+		v, ok := params[key]
+		if !ok {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return 0, fmt.Errorf("Invalid value %q for %s, must be between 0 and 1", v, key)
+		}
+		return f, nil
+	}
+	duration := func(key string) (time.Duration, error) {
+		v, ok := params[key]
+		if !ok {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid value %q for %s: %v", v, key, err)
+		}
+		return d, nil
+	}
+
+	if c.ErrorRate, err = rate(ErrorRateParam); err != nil {
+		return c, err
+	}
+	if c.PartialRate, err = rate(PartialRateParam); err != nil {
+		return c, err
+	}
+	if c.Latency, err = duration(LatencyParam); err != nil {
+		return c, err
+	}
+	if c.Jitter, err = duration(JitterParam); err != nil {
+		return c, err
+	}
+	if ops, ok := params[OpsParam]; ok {
+		for _, op := range strings.Split(ops, ",") {
+			if op = strings.TrimSpace(op); op != "" {
+				c.Ops = append(c.Ops, strings.ToLower(op))
+			}
+		}
+	}
+	if seed, ok := params[SeedParam]; ok {
+		if c.Seed, err = strconv.ParseInt(seed, 10, 64); err != nil {
+			return c, fmt.Errorf("Invalid value %q for %s: %v", seed, SeedParam, err)
+		}
+	}
+	return c, nil
+}
+
+type driver struct {
+	cfg     Config
+	ops     map[string]bool
+	backend func() (volume.VolumeDriver, error)
+	owned   bool
+
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+func newDriver(cfg Config, backend func() (volume.VolumeDriver, error)) *driver {
+	d := &driver{
+		cfg:     cfg,
+		backend: backend,
+		rand:    rand.New(rand.NewSource(cfg.Seed)),
+	}
+	if len(cfg.Ops) != 0 {
+		d.ops = make(map[string]bool)
+		for _, op := range cfg.Ops {
+			d.ops[op] = true
+		}
+	}
+	return d
+}
+
+// Wrap returns a driver injecting the faults in cfg into the operations of
+// d. Shutting down the returned driver shuts down d.
+func Wrap(d volume.VolumeDriver, cfg Config) volume.VolumeDriver {
+	w := newDriver(cfg, func() (volume.VolumeDriver, error) { return d, nil })
+	w.owned = true
+	return w
+}
+
+// Init wraps the running driver named by DriverParam. The wrapped driver is
+// looked up on each call, so it may be started after this driver.
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
+	name, ok := params[DriverParam]
+	if !ok || name == "" {
+		return nil, errors.New("No driver to wrap provided")
+	}
+	if name == Name {
+		return nil, errors.New("Chaos driver cannot wrap itself")
+	}
+	cfg, err := ParseConfig(params)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Chaos driver wrapping %s with %+v", name, cfg)
+	return newDriver(cfg, func() (volume.VolumeDriver, error) { return volume.Get(name) }), nil
+}
+
+func (d *driver) float() float64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.rand.Float64()
+}
+
+func (d *driver) affects(op string) bool {
+	return d.ops == nil || d.ops[op]
+}
+
+// inject delays op and decides whether it fails before reaching the backend.
+func (d *driver) inject(op string) error {
+	if !d.affects(op) {
+		return nil
+	}
+	delay := d.cfg.Latency
+	if d.cfg.Jitter > 0 {
+		delay += time.Duration(d.float() * float64(d.cfg.Jitter))
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if d.cfg.ErrorRate > 0 && d.float() < d.cfg.ErrorRate {
+		logger.Debugf("Chaos driver failing %s", op)
+		return ErrInjected
+	}
+	return nil
+}
+
+// partial decides whether op, already completed by the backend, is reported
+// as failed.
+func (d *driver) partial(op string, err error) error {
+	if err != nil || !d.affects(op) {
+		return err
+	}
+	if d.cfg.PartialRate > 0 && d.float() < d.cfg.PartialRate {
+		logger.Debugf("Chaos driver partially failing %s", op)
+		return ErrPartial
+	}
+	return nil
+}
+
+// wrapped injects faults for op and returns the backend to call.
+func (d *driver) wrapped(op string) (volume.VolumeDriver, error) {
+	b, err := d.backend()
+	if err != nil {
+		return nil, err
+	}
+	if err = d.inject(op); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (d *driver) String() string {
+	return Name
+}
+
+func (d *driver) Type() volume.DriverType {
+	if b, err := d.backend(); err == nil {
+		return b.Type()
+	}
+	return Type
+}
+
+func (d *driver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+	b, err := d.wrapped("create")
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	return b.Create(locator, options, spec)
+}
+
+func (d *driver) Delete(volumeID api.VolumeID) error {
+	b, err := d.wrapped("delete")
+	if err != nil {
+		return err
+	}
+	return b.Delete(volumeID)
+}
+
+func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
+	b, err := d.wrapped("mount")
+	if err != nil {
+		return err
+	}
+	return d.partial("mount", b.Mount(volumeID, mountpath))
+}
+
+func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	b, err := d.wrapped("unmount")
+	if err != nil {
+		return err
+	}
+	return d.partial("unmount", b.Unmount(volumeID, mountpath))
+}
+
+func (d *driver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	b, err := d.wrapped("snapshot")
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	return b.Snapshot(volumeID, labels, writable)
+}
+
+func (d *driver) SnapDelete(snapID api.SnapID) error {
+	b, err := d.wrapped("snapdelete")
+	if err != nil {
+		return err
+	}
+	return b.SnapDelete(snapID)
+}
+
+func (d *driver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	b, err := d.wrapped("stats")
+	if err != nil {
+		return api.VolumeStats{}, err
+	}
+	return b.Stats(volumeID)
+}
+
+func (d *driver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	b, err := d.wrapped("alerts")
+	if err != nil {
+		return api.VolumeAlerts{}, err
+	}
+	return b.Alerts(volumeID)
+}
+
+func (d *driver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	b, err := d.wrapped("attach")
+	if err != nil {
+		return "", err
+	}
+	path, err := b.Attach(volumeID, options)
+	if err = d.partial("attach", err); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (d *driver) Format(volumeID api.VolumeID) error {
+	b, err := d.wrapped("format")
+	if err != nil {
+		return err
+	}
+	return b.Format(volumeID)
+}
+
+func (d *driver) Detach(volumeID api.VolumeID) error {
+	b, err := d.wrapped("detach")
+	if err != nil {
+		return err
+	}
+	return d.partial("detach", b.Detach(volumeID))
+}
+
+func (d *driver) Inspect(volumeIDs []api.VolumeID) ([]api.Volume, error) {
+	b, err := d.wrapped("inspect")
+	if err != nil {
+		return nil, err
+	}
+	return b.Inspect(volumeIDs)
+}
+
+func (d *driver) Enumerate(locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error) {
+	b, err := d.wrapped("enumerate")
+	if err != nil {
+		return nil, err
+	}
+	return b.Enumerate(locator, labels)
+}
+
+func (d *driver) SnapInspect(snapIDs []api.SnapID) ([]api.VolumeSnap, error) {
+	b, err := d.wrapped("snapinspect")
+	if err != nil {
+		return nil, err
+	}
+	return b.SnapInspect(snapIDs)
+}
+
+func (d *driver) SnapEnumerate(volIDs []api.VolumeID, snapLabels api.Labels) ([]api.VolumeSnap, error) {
+	b, err := d.wrapped("snapenumerate")
+	if err != nil {
+		return nil, err
+	}
+	return b.SnapEnumerate(volIDs, snapLabels)
+}
+
+// Status diagnostic information
+func (d *driver) Status() api.DriverStatus {
+	details := [][2]string{
+		{"ErrorRate", fmt.Sprint(d.cfg.ErrorRate)},
+		{"PartialRate", fmt.Sprint(d.cfg.PartialRate)},
+		{"Latency", d.cfg.Latency.String()},
+		{"Jitter", d.cfg.Jitter.String()},
+	}
+	b, err := d.backend()
+	if err != nil {
+		return api.DriverStatus{
+			Driver:  Name,
+			Details: append(details, [2]string{"Backend", err.Error()}),
+		}
+	}
+	status := b.Status()
+	status.Driver = Name
+	status.Details = append(details, status.Details...)
+	return status
+}
+
+// HealthCheck returns the health of the backend. Faults are not injected.
+func (d *driver) HealthCheck() []api.HealthReason {
+	b, err := d.backend()
+	if err != nil {
+		return []api.HealthReason{{Check: "backend", State: api.HealthDown, Message: err.Error()}}
+	}
+	return b.HealthCheck()
+}
+
+func (d *driver) Shutdown() {
+	logger.Infof("%s Shutting down", Name)
+	if !d.owned {
+		return
+	}
+	if b, err := d.backend(); err == nil {
+		b.Shutdown()
+	}
+}
+
+func init() {
+	// Register ourselves as an openstorage volume driver.
+	volume.Register(Name, Init)
+}
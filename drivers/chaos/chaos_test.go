@@ -0,0 +1,38 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig(volume.DriverParams{
+		ErrorRateParam: "0.5",
+		LatencyParam:   "10ms",
+		OpsParam:       "Attach, mount",
+		SeedParam:      "1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, cfg.ErrorRate)
+	assert.Equal(t, 10*time.Millisecond, cfg.Latency)
+	assert.Equal(t, []string{"attach", "mount"}, cfg.Ops)
+
+	_, err = ParseConfig(volume.DriverParams{ErrorRateParam: "2"})
+	assert.Error(t, err, "Error rates above 1 should be rejected")
+}
+
+func TestInject(t *testing.T) {
+	d := newDriver(Config{ErrorRate: 1, PartialRate: 1, Ops: []string{"attach"}}, nil)
+	assert.Equal(t, ErrInjected, d.inject("attach"))
+	assert.Equal(t, ErrPartial, d.partial("attach", nil))
+	assert.NoError(t, d.inject("create"), "Faults should only apply to listed ops")
+
+	d = newDriver(Config{Latency: 20 * time.Millisecond}, nil)
+	start := time.Now()
+	assert.NoError(t, d.inject("create"))
+	assert.True(t, time.Since(start) >= 20*time.Millisecond, "Latency should be injected")
+}
@@ -0,0 +1,316 @@
+package cifs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/secrets"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	Name = "cifs"
+	Type = volume.File
+
+	// ShareParam UNC path of the SMB share, e.g. "//server/share" or
+	// "//account.file.core.windows.net/share" for Azure Files.
+	ShareParam = "share"
+	// UsernameParam user to authenticate as. The share is mounted as guest
+	// if neither a user nor a credentials file is set.
+	UsernameParam = "username"
+	// PasswordParam password of the user. Set "password_secret" to a
+	// secret reference instead to keep it out of the driver params.
+	PasswordParam = "password"
+	// DomainParam domain or workgroup of the user.
+	DomainParam = "domain"
+	// CredentialsParam path of a mount.cifs credentials file holding the
+	// username, password and domain, so that they are kept out of the
+	// driver params.
+	CredentialsParam = "credentials"
+	// VersParam SMB protocol version, e.g. "3.0". Azure Files requires 3.0
+	// or later.
+	VersParam = "vers"
+	// MountOptionsParam comma separated options passed as is, e.g.
+	// "dir_mode=0777,file_mode=0777".
+	MountOptionsParam = "mount_options"
+)
+
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
+// share is an SMB share and the options it is mounted with.
+type share struct {
+	unc      string
+	opts     []string
+	password string
+	// mountPath the share is mounted at, under the mount root of the
+	// driver instance.
+	mountPath string
+}
+
+// parseShare builds the share and its mount options from the driver params.
+func parseShare(params volume.DriverParams) (*share, error) {
+	unc := strings.TrimSpace(params[ShareParam])
+	if unc == "" {
+		return nil, errors.New("No CIFS share provided")
+	}
+	unc = strings.Replace(unc, "\\", "/", -1)
+	parts := strings.Split(strings.TrimPrefix(unc, "//"), "/")
+	if !strings.HasPrefix(unc, "//") || len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("Invalid CIFS share %q, expected //server/share", unc)
+	}
+
+	root, err := volume.MountRoot(params, Name)
+	if err != nil {
+		return nil, err
+	}
+	s := &share{unc: unc, mountPath: root}
+	user, creds := params[UsernameParam], params[CredentialsParam]
+	switch {
+	case creds != "":
+		if _, err := os.Stat(creds); err != nil {
+			return nil, fmt.Errorf("Invalid CIFS credentials file: %v", err)
+		}
+		s.opts = append(s.opts, "credentials="+creds)
+	case user != "":
+		s.opts = append(s.opts, "username="+user)
+		if domain := params[DomainParam]; domain != "" {
+			s.opts = append(s.opts, "domain="+domain)
+		}
+		password, err := secrets.Param(params, PasswordParam)
+		if err != nil {
+			return nil, err
+		}
+		s.password = password
+	default:
+		s.opts = append(s.opts, "guest")
+	}
+	if vers := params[VersParam]; vers != "" {
+		s.opts = append(s.opts, "vers="+vers)
+	}
+	for _, o := range strings.Split(params[MountOptionsParam], ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			s.opts = append(s.opts, o)
+		}
+	}
+	return s, nil
+}
+
+// mount mounts the share at its mountPath. The password is handed to
+// mount.cifs in its environment so that it does not show in the process
+// list.
+func (s *share) mount() error {
+	if err := os.MkdirAll(s.mountPath, 0744); err != nil {
+		return err
+	}
+	syscall.Unmount(s.mountPath, 0)
+	cmd := exec.Command("mount", "-t", "cifs", s.unc, s.mountPath,
+		"-o", strings.Join(s.opts, ","))
+	if s.password != "" {
+		cmd.Env = append(os.Environ(), "PASSWD="+s.password)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Unable to mount %s at %s: %v: %s",
+			s.unc, s.mountPath, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Implements the open storage volume interface.
+type driver struct {
+	*volume.DefaultBlockDriver
+	*volume.DefaultEnumerator
+	share *share
+}
+
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
+	s, err := parseShare(params)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("CIFS driver initializing with %s", s.unc)
+
+	inst := &driver{
+		DefaultEnumerator: c.NewEnumerator(),
+		share:             s,
+	}
+	if err = s.mount(); err != nil {
+		logger.Warn(err)
+		return nil, err
+	}
+
+	logger.Infof("CIFS initialized and driver mounted at: %s", s.mountPath)
+	return inst, nil
+}
+
+func (d *driver) String() string {
+	return Name
+}
+
+func (d *driver) Type() volume.DriverType {
+	return Type
+}
+
+// HealthCheck verifies that the share is mounted and writable.
+func (d *driver) HealthCheck() []api.HealthReason {
+	return volume.CheckDir(d.share.mountPath, true, api.HealthDown)
+}
+
+// Status diagnostic information
+func (d *driver) Status() api.DriverStatus {
+	return api.DriverStatus{
+		Driver:    Name,
+		Endpoints: []string{d.share.unc},
+	}
+}
+
+func (d *driver) Create(locator api.VolumeLocator, opt *api.CreateOptions, spec *api.VolumeSpec) (api.VolumeID, error) {
+	if spec.Format != "cifs" && spec.Format != "" {
+		return api.BadVolumeID, errors.New("Unsupported filesystem format: " + string(spec.Format))
+	}
+
+	if spec.BlockSize != 0 {
+		logger.Info("CIFS driver will ignore the blocksize option.")
+	}
+
+	volumeID := strings.TrimSuffix(uuid.New(), "\n")
+
+	// Create a directory on the share with this UUID.
+	devicePath := path.Join(d.share.mountPath, volumeID)
+	err := os.MkdirAll(devicePath, 0744)
+	if err != nil {
+		logger.Warn(err)
+		return api.BadVolumeID, err
+	}
+
+	v := &api.Volume{
+		ID:         api.VolumeID(volumeID),
+		Locator:    locator,
+		Ctime:      time.Now(),
+		Spec:       spec,
+		LastScan:   time.Now(),
+		Format:     "cifs",
+		State:      api.VolumeAvailable,
+		DevicePath: devicePath,
+	}
+
+	err = d.CreateVol(v)
+	if err != nil {
+		os.RemoveAll(devicePath)
+		return api.BadVolumeID, err
+	}
+	return v.ID, nil
+}
+
+func (d *driver) Delete(volumeID api.VolumeID) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		logger.Warn(err)
+		return err
+	}
+
+	if err = d.CanDelete(volumeID); err != nil {
+		return err
+	}
+
+	// Delete the directory on the share.
+	os.RemoveAll(v.DevicePath)
+
+	err = d.DeleteVol(volumeID)
+	if err != nil {
+		logger.Warn(err)
+		return err
+	}
+	return nil
+}
+
+func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		logger.Warn(err)
+		return err
+	}
+
+	syscall.Unmount(mountpath, 0)
+	err = syscall.Mount(v.DevicePath, mountpath, "", syscall.MS_BIND, "")
+	if err != nil {
+		logger.Warnf("Cannot mount %s at %s because %+v", v.DevicePath, mountpath, err)
+		return err
+	}
+
+	v.AttachPath = mountpath
+	return d.UpdateVol(v)
+}
+
+func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath == "" {
+		return fmt.Errorf("Device %v not mounted", volumeID)
+	}
+	err = syscall.Unmount(v.AttachPath, 0)
+	if err != nil {
+		return err
+	}
+	v.AttachPath = ""
+	return d.UpdateVol(v)
+}
+
+// Snapshot is not supported, SMB shares do not expose snapshots to clients.
+func (d *driver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	return api.BadSnapID, volume.ErrNotSupported
+}
+
+func (d *driver) SnapDelete(snapID api.SnapID) error {
+	return volume.ErrNotSupported
+}
+
+// Catalog lists path within the volume directory on the share.
+func (d *driver) Catalog(volumeID api.VolumeID, p string) ([]api.CatalogEntry, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	return volume.CatalogDir(v.DevicePath, p)
+}
+
+// UsedSize returns the number of bytes stored in the volume directory.
+func (d *driver) UsedSize(volumeID api.VolumeID) (uint64, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return 0, err
+	}
+	return volume.DirUsage(v.DevicePath)
+}
+
+func (d *driver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	return api.VolumeStats{}, volume.ErrNotSupported
+}
+
+func (d *driver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	return api.VolumeAlerts{}, volume.ErrNotSupported
+}
+
+func (d *driver) Shutdown() {
+	logger.Infof("%s Shutting down", Name)
+	syscall.Unmount(d.share.mountPath, 0)
+}
+
+func init() {
+	// Register ourselves as an openstorage volume driver.
+	volume.Register(Name, Init)
+	secrets.RegisterParam(PasswordParam)
+}
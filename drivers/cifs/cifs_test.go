@@ -0,0 +1,50 @@
+package cifs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+func TestParseShare(t *testing.T) {
+	s, err := parseShare(volume.DriverParams{
+		ShareParam:        `\\files\vol`,
+		UsernameParam:     "osd",
+		PasswordParam:     "secret",
+		DomainParam:       "CORP",
+		VersParam:         "3.0",
+		MountOptionsParam: "dir_mode=0777, file_mode=0777",
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse share: %v", err)
+	}
+	if s.unc != "//files/vol" {
+		t.Fatalf("Unexpected share %q", s.unc)
+	}
+	opts := strings.Join(s.opts, ",")
+	if opts != "username=osd,domain=CORP,vers=3.0,dir_mode=0777,file_mode=0777" {
+		t.Fatalf("Unexpected mount options %q", opts)
+	}
+	if strings.Contains(opts, "secret") || s.password != "secret" {
+		t.Fatalf("Password must be kept out of the mount options")
+	}
+
+	s, err = parseShare(volume.DriverParams{ShareParam: "//files/vol"})
+	if err != nil {
+		t.Fatalf("Failed to parse share: %v", err)
+	}
+	if len(s.opts) != 1 || s.opts[0] != "guest" {
+		t.Fatalf("Share without credentials should be mounted as guest, got %v", s.opts)
+	}
+
+	for _, unc := range []string{"", "files/vol", "//files", "//files/"} {
+		if _, err = parseShare(volume.DriverParams{ShareParam: unc}); err == nil {
+			t.Fatalf("Parse should fail for share %q", unc)
+		}
+	}
+	if _, err = parseShare(volume.DriverParams{ShareParam: "//files/vol",
+		CredentialsParam: "/nonexistent"}); err == nil {
+		t.Fatalf("Parse should fail for a missing credentials file")
+	}
+}
@@ -0,0 +1,409 @@
+// Package digitalocean provisions block volumes from DigitalOcean block
+// storage in the region of the droplet.
+package digitalocean
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/pkg/cloudprovider"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+	"github.com/libopenstorage/openstorage/pkg/mkfs"
+	"github.com/libopenstorage/openstorage/secrets"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	Name = "digitalocean"
+	Type = volume.Block
+	// TokenParam API token with read and write scope. Set "token_secret" to
+	// a secret reference instead to keep it out of the driver params.
+	TokenParam = "token"
+
+	metadataURL = "http://169.254.169.254/metadata/v1/"
+	apiURL      = "https://api.digitalocean.com/v2/"
+	byIDPrefix  = "/dev/disk/by-id/scsi-0DO_Volume_"
+	namePrefix  = "osd-"
+
+	actionTimeout = 5 * time.Minute
+	attachTimeout = time.Minute
+)
+
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
+// metadata retrieves the droplet metadata at key.
+func metadata(key string) (string, error) {
+	return cloudprovider.Metadata(metadataURL+key, nil)
+}
+
+type doVolume struct {
+	ID            string `json:"id,omitempty"`
+	Name          string `json:"name"`
+	Region        string `json:"region,omitempty"`
+	SizeGigabytes int64  `json:"size_gigabytes,omitempty"`
+	SnapshotID    string `json:"snapshot_id,omitempty"`
+	Description   string `json:"description,omitempty"`
+}
+
+type action struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+}
+
+type driver struct {
+	*volume.DefaultEnumerator
+	api     *cloudprovider.Client
+	droplet string
+	// dropletID is droplet as the API expects it in actions.
+	dropletID int64
+	region    string
+}
+
+// Init digitalocean volume driver metadata.
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
+	token, err := secrets.Param(params, TokenParam)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, fmt.Errorf("API token should be specified with key %q", TokenParam)
+	}
+	droplet, err := metadata("id")
+	if err != nil {
+		return nil, err
+	}
+	dropletID, err := strconv.ParseInt(droplet, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid droplet ID %q: %v", droplet, err)
+	}
+	region, err := metadata("region")
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("DigitalOcean droplet %v region %v", droplet, region)
+
+	return &driver{
+		DefaultEnumerator: c.NewEnumerator(),
+		api:               cloudprovider.NewClient(apiURL, cloudprovider.StaticToken(token)),
+		droplet:           droplet,
+		dropletID:         dropletID,
+		region:            region,
+	}, nil
+}
+
+// act requests a volume action and waits for it to complete.
+func (d *driver) act(volumeID api.VolumeID, req map[string]interface{}) error {
+	var res struct {
+		Action action `json:"action"`
+	}
+	req["region"] = d.region
+	if err := d.api.Do("POST", "volumes/"+string(volumeID)+"/actions", req, &res); err != nil {
+		return err
+	}
+	a := res.Action
+	return cloudprovider.Poll(2*time.Second, actionTimeout, func() (bool, error) {
+		switch a.Status {
+		case "completed":
+			return true, nil
+		case "errored":
+			return false, fmt.Errorf("Volume %v action %v failed", volumeID, req["type"])
+		}
+		var res struct {
+			Action action `json:"action"`
+		}
+		if err := d.api.Do("GET", fmt.Sprintf("actions/%d", a.ID), nil, &res); err != nil {
+			return false, err
+		}
+		a = res.Action
+		return false, nil
+	})
+}
+
+// String is a description of this driver.
+func (d *driver) String() string {
+	return Name
+}
+
+// Type returns digitalocean as a Block driver.
+func (d *driver) Type() volume.DriverType {
+	return Type
+}
+
+// Status diagnostic information
+func (d *driver) Status() api.DriverStatus {
+	return api.DriverStatus{
+		Driver: Name,
+		Details: [][2]string{
+			{"Droplet", d.droplet},
+			{"Region", d.region},
+		},
+	}
+}
+
+// HealthCheck verifies that the API is reachable with the driver token.
+func (d *driver) HealthCheck() []api.HealthReason {
+	if err := d.api.Do("GET", "droplets/"+d.droplet, nil, nil); err != nil {
+		return []api.HealthReason{{Check: "api", State: api.HealthDown, Message: err.Error()}}
+	}
+	return nil
+}
+
+// Create a block storage volume from spec, or from the snapshot
+// options.CreateFromSnap.
+func (d *driver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+
+	req := &doVolume{
+		Name:          namePrefix + strings.TrimSuffix(uuid.New(), "\n"),
+		Region:        d.region,
+		SizeGigabytes: cloudprovider.GiB(spec.Size),
+		Description:   locator.Name,
+	}
+	if options != nil && options.CreateFromSnap != "" {
+		req.SnapshotID = string(options.CreateFromSnap)
+	}
+	var res struct {
+		Volume doVolume `json:"volume"`
+	}
+	if err := d.api.Do("POST", "volumes", req, &res); err != nil {
+		logger.Warnf("Failed to create volume: %v", err)
+		return api.BadVolumeID, err
+	}
+
+	v := &api.Volume{
+		ID:       api.VolumeID(res.Volume.ID),
+		Locator:  locator,
+		Ctime:    time.Now(),
+		Spec:     spec,
+		LastScan: time.Now(),
+		Format:   api.FsNone,
+		State:    api.VolumeAvailable,
+	}
+	if options != nil {
+		v.Parent = options.CreateFromSnap
+	}
+	if err := d.CreateVol(v); err != nil {
+		d.api.Do("DELETE", "volumes/"+res.Volume.ID, nil, nil)
+		return api.BadVolumeID, err
+	}
+	logger.Infof("Created volume %v", v.ID)
+	return v.ID, nil
+}
+
+// Delete deletes a detached volume.
+func (d *driver) Delete(volumeID api.VolumeID) error {
+	if err := d.CanDelete(volumeID); err != nil {
+		return err
+	}
+	err := d.api.Do("DELETE", "volumes/"+string(volumeID), nil, nil)
+	if err != nil && err != cloudprovider.ErrNotFound {
+		return err
+	}
+	return d.DeleteVol(volumeID)
+}
+
+// Attach attaches the volume to this droplet. Volumes are attached to one
+// droplet at a time.
+func (d *driver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	if options != nil && (options.Shared || options.ReadOnly || options.Reservation != api.ReservationNone) {
+		return "", volume.ErrNotSupported
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return "", err
+	}
+	node := api.MachineID(d.droplet)
+	if err = volume.CheckAttach(v, node, options); err != nil {
+		return "", err
+	}
+	var res struct {
+		Volume doVolume `json:"volume"`
+	}
+	if err = d.api.Do("GET", "volumes/"+string(volumeID), nil, &res); err != nil {
+		return "", err
+	}
+	link := byIDPrefix + res.Volume.Name
+	if _, err = cloudprovider.DevicePath(link, 0); err != nil {
+		err = d.act(volumeID, map[string]interface{}{
+			"type":       "attach",
+			"droplet_id": d.dropletID,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	dev, err := cloudprovider.DevicePath(link, attachTimeout)
+	if err != nil {
+		return "", err
+	}
+	volume.RecordAttach(v, node, options)
+	v.DevicePath = dev
+	return dev, d.UpdateVol(v)
+}
+
+// Detach detaches the volume from this droplet.
+func (d *driver) Detach(volumeID api.VolumeID) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	err = d.act(volumeID, map[string]interface{}{
+		"type":       "detach",
+		"droplet_id": d.dropletID,
+	})
+	if err != nil {
+		return err
+	}
+	volume.RecordDetach(v, api.MachineID(d.droplet))
+	v.DevicePath = ""
+	return d.UpdateVol(v)
+}
+
+// Format creates the filesystem of the volume spec on an attached volume.
+func (d *driver) Format(volumeID api.VolumeID) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	if v.Spec.Format == "" || v.Spec.Format == api.FsNone {
+		return fmt.Errorf("Volume %v has no filesystem to format: %v", volumeID, volume.ErrEinval)
+	}
+	device := volume.TopDevice(d, volumeID, v.DevicePath)
+	if err = mkfs.Format(device, v.Spec); err != nil {
+		return err
+	}
+	v.Format = v.Spec.Format
+	return d.UpdateVol(v)
+}
+
+// Mount mounts the filesystem of an attached volume at mountpath, or binds
+// the device of a raw volume there.
+func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	format, err := fs.MountFormat(v)
+	if err != nil {
+		return err
+	}
+	device := volume.TopDevice(d, volumeID, v.DevicePath)
+	if err = fs.MountDevice(device, mountpath, format); err != nil {
+		return fmt.Errorf("Failed to mount %v at %v: %v", device, mountpath, err)
+	}
+	v.AttachPath = mountpath
+	return d.UpdateVol(v)
+}
+
+// Unmount unmounts the filesystem of a volume.
+func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath == "" {
+		return fmt.Errorf("Device %v not mounted", volumeID)
+	}
+	if err = syscall.Unmount(v.AttachPath, 0); err != nil {
+		return err
+	}
+	v.AttachPath = ""
+	return d.UpdateVol(v)
+}
+
+// Snapshot creates a snapshot of the volume. Snapshots cannot be mounted,
+// writable snaps are not supported.
+func (d *driver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	if writable {
+		return api.BadSnapID, volume.ErrNotSupported
+	}
+	if _, err := d.GetVol(volumeID); err != nil {
+		return api.BadSnapID, err
+	}
+	var res struct {
+		Snapshot struct {
+			ID string `json:"id"`
+		} `json:"snapshot"`
+	}
+	req := map[string]string{"name": namePrefix + strings.TrimSuffix(uuid.New(), "\n")}
+	if err := d.api.Do("POST", "volumes/"+string(volumeID)+"/snapshots", req, &res); err != nil {
+		return api.BadSnapID, err
+	}
+	snap := &api.VolumeSnap{
+		ID:         api.SnapID(res.Snapshot.ID),
+		VolumeID:   volumeID,
+		SnapLabels: labels,
+		Ctime:      time.Now(),
+	}
+	if err := d.CreateSnap(snap); err != nil {
+		d.api.Do("DELETE", "snapshots/"+res.Snapshot.ID, nil, nil)
+		return api.BadSnapID, err
+	}
+	return snap.ID, nil
+}
+
+// SnapDelete deletes the snapshot and its record.
+func (d *driver) SnapDelete(snapID api.SnapID) error {
+	if _, err := d.GetSnap(snapID); err != nil {
+		return err
+	}
+	err := d.api.Do("DELETE", "snapshots/"+string(snapID), nil, nil)
+	if err != nil && err != cloudprovider.ErrNotFound {
+		return err
+	}
+	return d.DeleteSnap(snapID)
+}
+
+// Resize grows a volume. The filesystem is not grown.
+func (d *driver) Resize(volumeID api.VolumeID, size uint64) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if size < v.Spec.Size {
+		return fmt.Errorf("Cannot shrink volume %v: %v", volumeID, volume.ErrEinval)
+	}
+	err = d.act(volumeID, map[string]interface{}{
+		"type":           "resize",
+		"size_gigabytes": cloudprovider.GiB(size),
+	})
+	if err != nil {
+		return err
+	}
+	v.Spec.Size = size
+	return d.UpdateVol(v)
+}
+
+func (d *driver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	return api.VolumeStats{}, volume.ErrNotSupported
+}
+
+func (d *driver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	return api.VolumeAlerts{}, volume.ErrNotSupported
+}
+
+func (d *driver) Shutdown() {
+	logger.Infof("%s Shutting down", Name)
+}
+
+func init() {
+	// Register ourselves as an openstorage volume driver.
+	volume.Register(Name, Init)
+	secrets.RegisterParam(TokenParam)
+}
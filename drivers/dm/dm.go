@@ -0,0 +1,543 @@
+// Package dm provisions block volumes from local disks with the device
+// mapper. Volumes are concatenated (linear) or striped extents of the disks,
+// the layout of every volume on a node is kept in KVDB.
+package dm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+	"github.com/libopenstorage/openstorage/pkg/mkfs"
+	"github.com/libopenstorage/openstorage/pkg/spec"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	Name = "dm"
+	Type = volume.Block
+	// DevicesParam comma separated disks to carve volumes from. Their
+	// contents are overwritten.
+	DevicesParam = "devices"
+	// StripesParam number of disks a volume is striped across, 1 for linear
+	// volumes, which is the default.
+	StripesParam = "stripes"
+	// StripeSizeParam stripe chunk size, e.g. "64K", the default.
+	StripeSizeParam = "stripe_size"
+
+	defaultStripeSize = 64 << 10
+	poolKey           = "openstorage/" + Name + "/pool/"
+	devPrefix         = "osd-dm-"
+	mapperDir         = "/dev/mapper/"
+)
+
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
+type driver struct {
+	*volume.DefaultEnumerator
+	*volume.SnapshotNotSupported
+	lock    sync.Mutex
+	kv      kvdb.Kvdb
+	key     string
+	pool    *Pool
+	stripes int
+	chunk   uint64
+}
+
+// Init carves volumes from the disks listed in params. Disks may be added
+// across restarts, disks holding volumes may not be removed.
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
+	devices, ok := params[DevicesParam]
+	if !ok {
+		return nil, fmt.Errorf("Disks should be specified with key %q", DevicesParam)
+	}
+	d := &driver{
+		DefaultEnumerator: c.NewEnumerator(),
+		kv:                c.Kvdb,
+		key:               poolKey + string(volume.NodeID()),
+		stripes:           1,
+		chunk:             defaultStripeSize / sectorSize,
+	}
+	if s, ok := params[StripesParam]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("Invalid %s %q", StripesParam, s)
+		}
+		d.stripes = n
+	}
+	if s, ok := params[StripeSizeParam]; ok {
+		n, err := spec.ParseSize(s)
+		if err != nil {
+			return nil, err
+		}
+		d.chunk = n / sectorSize
+	}
+	pool := newPool()
+	if _, err := d.kv.GetVal(d.key, pool); err != nil && err != kvdb.ErrNotFound {
+		return nil, err
+	}
+	if pool.Volumes == nil {
+		pool.Volumes = make(map[api.VolumeID][]Segment)
+	}
+	var disks []Disk
+	for _, path := range strings.Split(devices, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		size, err := blockSectors(path)
+		if err != nil {
+			return nil, err
+		}
+		disks = append(disks, Disk{Path: path, Size: size})
+	}
+	for _, old := range pool.Disks {
+		if !hasDisk(disks, old.Path) && pool.inUse(old.Path) {
+			return nil, fmt.Errorf("Disk %s holds volumes and cannot be removed", old.Path)
+		}
+	}
+	pool.Disks = disks
+	d.pool = pool
+	if err := d.save(); err != nil {
+		return nil, err
+	}
+	logger.Infof("%s: %d disks, %d volumes", Name, len(disks), len(pool.Volumes))
+	return d, nil
+}
+
+func hasDisk(disks []Disk, path string) bool {
+	for _, d := range disks {
+		if d.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func blockSectors(dev string) (uint64, error) {
+	out, err := run(nil, "blockdev", "--getsz", dev)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+}
+
+func run(stdin []byte, cmd string, args ...string) (string, error) {
+	c := exec.Command(cmd, args...)
+	if stdin != nil {
+		c.Stdin = bytes.NewReader(stdin)
+	}
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %v: %s",
+			cmd, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func devName(volumeID api.VolumeID) string {
+	return devPrefix + string(volumeID)
+}
+
+func devPath(volumeID api.VolumeID) string {
+	return mapperDir + devName(volumeID)
+}
+
+func mapped(volumeID api.VolumeID) bool {
+	_, err := os.Stat(devPath(volumeID))
+	return err == nil
+}
+
+// save persists the pool. The caller holds the lock.
+func (d *driver) save() error {
+	_, err := d.kv.Put(d.key, d.pool, 0)
+	return err
+}
+
+// segments returns the layout of a volume on this node.
+func (d *driver) segments(volumeID api.VolumeID) ([]Segment, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	segs, ok := d.pool.Volumes[volumeID]
+	if !ok {
+		return nil, fmt.Errorf("Volume %v is not on this node", volumeID)
+	}
+	return segs, nil
+}
+
+func (d *driver) String() string {
+	return Name
+}
+
+func (d *driver) Type() volume.DriverType {
+	return Type
+}
+
+// Status diagnostic information
+func (d *driver) Status() api.DriverStatus {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	status := api.DriverStatus{Driver: Name}
+	for _, disk := range d.pool.Disks {
+		var free uint64
+		for _, e := range d.pool.free(disk) {
+			free += e.Len
+		}
+		status.Pools = append(status.Pools, api.PoolStatus{
+			Name:     disk.Path,
+			Capacity: disk.Size * sectorSize,
+			Free:     free * sectorSize,
+		})
+		status.Capacity += disk.Size * sectorSize
+		status.Free += free * sectorSize
+	}
+	return status
+}
+
+// HealthCheck verifies that the disks are present. The driver is unhealthy
+// if a disk holding volumes is missing.
+func (d *driver) HealthCheck() []api.HealthReason {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var reasons []api.HealthReason
+	for _, disk := range d.pool.Disks {
+		if _, err := os.Stat(disk.Path); err != nil {
+			state := api.HealthDegraded
+			if d.pool.inUse(disk.Path) {
+				state = api.HealthDown
+			}
+			reasons = append(reasons, api.HealthReason{Check: "disk", State: state, Message: err.Error()})
+		}
+	}
+	return reasons
+}
+
+// Create allocates spec.Size bytes from the disks.
+func (d *driver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+
+	if options != nil && options.CreateFromSnap != "" {
+		return api.BadVolumeID, volume.ErrNotSupported
+	}
+	if spec.Size == 0 {
+		return api.BadVolumeID, fmt.Errorf("Volume size must be greater than 0")
+	}
+	volumeID := api.VolumeID(uuid.New())
+
+	d.lock.Lock()
+	segs, err := d.pool.allocate(roundUp(spec.Size, sectorSize)/sectorSize, d.stripes, d.chunk)
+	if err == nil {
+		d.pool.Volumes[volumeID] = segs
+		if err = d.save(); err != nil {
+			delete(d.pool.Volumes, volumeID)
+		}
+	}
+	d.lock.Unlock()
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+
+	v := &api.Volume{
+		ID:       volumeID,
+		Locator:  locator,
+		Ctime:    time.Now(),
+		Spec:     spec,
+		LastScan: time.Now(),
+		Format:   api.FsNone,
+		State:    api.VolumeAvailable,
+	}
+	if err = d.CreateVol(v); err != nil {
+		d.release(volumeID)
+		return api.BadVolumeID, err
+	}
+	return v.ID, nil
+}
+
+// release returns the extents of a volume to the disks.
+func (d *driver) release(volumeID api.VolumeID) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.pool.Volumes, volumeID)
+	return d.save()
+}
+
+// Delete frees the extents of a detached volume. Volumes can only be
+// deleted on the node that holds their disks.
+func (d *driver) Delete(volumeID api.VolumeID) error {
+	if _, err := d.segments(volumeID); err != nil {
+		return err
+	}
+	if err := d.CanDelete(volumeID); err != nil {
+		return err
+	}
+	if err := d.DeleteVol(volumeID); err != nil {
+		return err
+	}
+	return d.release(volumeID)
+}
+
+// Attach maps the volume as /dev/mapper/osd-dm-<volumeID>. Volumes can only
+// be attached on the node that holds their disks.
+func (d *driver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	if options != nil && (options.Shared || options.Reservation != api.ReservationNone) {
+		return "", volume.ErrNotSupported
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return "", err
+	}
+	node := volume.NodeID()
+	if err = volume.CheckAttach(v, node, options); err != nil {
+		return "", err
+	}
+	segs, err := d.segments(volumeID)
+	if err != nil {
+		return "", err
+	}
+	if !mapped(volumeID) {
+		args := []string{"create", devName(volumeID)}
+		if options != nil && options.ReadOnly {
+			args = append(args, "--readonly")
+		}
+		if _, err = run([]byte(table(segs)), "dmsetup", args...); err != nil {
+			return "", err
+		}
+	}
+	volume.RecordAttach(v, node, options)
+	v.DevicePath = devPath(volumeID)
+	return v.DevicePath, d.UpdateVol(v)
+}
+
+// Detach removes the device mapping of the volume.
+func (d *driver) Detach(volumeID api.VolumeID) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if mapped(volumeID) {
+		if _, err = run(nil, "dmsetup", "remove", devName(volumeID)); err != nil {
+			return err
+		}
+	}
+	volume.RecordDetach(v, volume.NodeID())
+	v.DevicePath = ""
+	return d.UpdateVol(v)
+}
+
+// ForceDetach removes the device mapping of a volume that may still be
+// mounted. With options.Force the mapping is removed even if the device is
+// open, pending IO then fails.
+func (d *driver) ForceDetach(volumeID api.VolumeID, options *api.DetachOptions) error {
+	if err := volume.Release(d, volumeID, options); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath != "" {
+		if err = volume.UnmountPath(v.AttachPath, options); err != nil {
+			return err
+		}
+		v.AttachPath = ""
+	}
+	if mapped(volumeID) {
+		if options.Kill {
+			if err = volume.KillUsers(devPath(volumeID)); err != nil {
+				return err
+			}
+		}
+		args := []string{"remove"}
+		if options.Force {
+			args = append(args, "--force")
+		}
+		if _, err = run(nil, "dmsetup", append(args, devName(volumeID))...); err != nil {
+			d.UpdateVol(v)
+			return err
+		}
+	}
+	volume.RecordDetach(v, volume.NodeID())
+	v.DevicePath = ""
+	return d.UpdateVol(v)
+}
+
+// Format creates the filesystem of the volume spec on an attached volume.
+func (d *driver) Format(volumeID api.VolumeID) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	if v.Spec.Format == "" || v.Spec.Format == api.FsNone {
+		return fmt.Errorf("Volume %v has no filesystem to format: %v", volumeID, volume.ErrEinval)
+	}
+	device := volume.TopDevice(d, volumeID, v.DevicePath)
+	if err = mkfs.Format(device, v.Spec); err != nil {
+		return err
+	}
+	v.Format = v.Spec.Format
+	return d.UpdateVol(v)
+}
+
+// Mount mounts the filesystem of an attached volume at mountpath, or binds
+// the device of a raw volume there.
+func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	format, err := fs.MountFormat(v)
+	if err != nil {
+		return err
+	}
+	device := volume.TopDevice(d, volumeID, v.DevicePath)
+	if err = fs.MountDevice(device, mountpath, format); err != nil {
+		return fmt.Errorf("Failed to mount %v at %v: %v", device, mountpath, err)
+	}
+	v.AttachPath = mountpath
+	return d.UpdateVol(v)
+}
+
+// Unmount unmounts the filesystem of a volume.
+func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath == "" {
+		return fmt.Errorf("Device %v not mounted", volumeID)
+	}
+	if err = syscall.Unmount(v.AttachPath, 0); err != nil {
+		return err
+	}
+	v.AttachPath = ""
+	return d.UpdateVol(v)
+}
+
+// ForceUnmount unmounts the filesystem of a volume that may be busy.
+func (d *driver) ForceUnmount(volumeID api.VolumeID, mountpath string, options *api.DetachOptions) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath == "" {
+		return fmt.Errorf("Device %v not mounted", volumeID)
+	}
+	if err = volume.UnmountPath(v.AttachPath, options); err != nil {
+		return err
+	}
+	v.AttachPath = ""
+	return d.UpdateVol(v)
+}
+
+// Resize grows a volume with more extents. The mapping of an attached volume
+// is reloaded with the new table. Volumes may grow within the extents already
+// allocated to them, which are rounded up to whole extents and stripes.
+func (d *driver) Resize(volumeID api.VolumeID, size uint64) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	d.lock.Lock()
+	segs, ok := d.pool.Volumes[volumeID]
+	if !ok {
+		d.lock.Unlock()
+		return fmt.Errorf("Volume %v is not on this node", volumeID)
+	}
+	cur := sectors(segs)
+	want := roundUp(size, sectorSize) / sectorSize
+	if want < roundUp(v.Spec.Size, sectorSize)/sectorSize {
+		d.lock.Unlock()
+		return fmt.Errorf("Cannot shrink volume %v: %v", volumeID, volume.ErrEinval)
+	}
+	if want > cur {
+		more, err := d.pool.allocate(want-cur, d.stripes, d.chunk)
+		if err != nil {
+			d.lock.Unlock()
+			return err
+		}
+		segs = append(segs, more...)
+		d.pool.Volumes[volumeID] = segs
+		if err = d.save(); err != nil {
+			d.pool.Volumes[volumeID] = segs[:len(segs)-len(more)]
+			d.lock.Unlock()
+			return err
+		}
+	}
+	d.lock.Unlock()
+
+	if mapped(volumeID) {
+		if _, err = run([]byte(table(segs)), "dmsetup", "reload", devName(volumeID)); err != nil {
+			return err
+		}
+		if _, err = run(nil, "dmsetup", "resume", devName(volumeID)); err != nil {
+			return err
+		}
+	}
+	v.Spec.Size = size
+	return d.UpdateVol(v)
+}
+
+// Scrub checks the filesystem of a volume that is attached on this node but
+// not mounted.
+func (d *driver) Scrub(volumeID api.VolumeID) ([]string, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	if v.DevicePath == "" || !mapped(volumeID) {
+		return nil, volume.ErrVolDetached
+	}
+	if v.Format == "" || v.Format == api.FsNone {
+		return nil, nil
+	}
+	device := volume.TopDevice(d, volumeID, v.DevicePath)
+	if v.AttachPath != "" {
+		return nil, volume.ErrVolAttached
+	}
+	if mountpath, err := fs.Mountpoint(device); err != nil || mountpath != "" {
+		return nil, volume.ErrVolAttached
+	}
+	return fs.Check(v.Format, device)
+}
+
+// Alerts on this volume.
+func (d *driver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	return api.VolumeAlerts{}, nil
+}
+
+// Shutdown and cleanup.
+func (d *driver) Shutdown() {
+	logger.Infof("%s Shutting down", Name)
+}
+
+func init() {
+	volume.Register(Name, Init)
+	volume.RegisterConstraints(Name, volume.Constraints{
+		MinSize: 1,
+		Formats: []api.Filesystem{api.FsNone, api.FsExt4, api.FsXfs, api.FsBtrfs},
+		// Compressed volumes are attached through VDO.
+		Compressions: []api.Compression{api.CompressionLz4},
+	})
+}
@@ -0,0 +1,178 @@
+package dm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	sectorSize = 512
+	// extentSectors allocation unit, 1MiB.
+	extentSectors = 2048
+)
+
+var (
+	// ErrNoSpace is returned when the disks cannot fit a volume.
+	ErrNoSpace = errors.New("Not enough free space on the disks")
+)
+
+// Extent is a contiguous range of sectors on a disk.
+type Extent struct {
+	Disk  string `json:"disk"`
+	Start uint64 `json:"start"`
+	Len   uint64 `json:"len"`
+}
+
+// Segment maps a range of a volume linearly onto one extent, or striped
+// across extents of equal length on different disks.
+type Segment struct {
+	// Len of the range in sectors.
+	Len uint64 `json:"len"`
+	// Extents backing the range, one per stripe.
+	Extents []Extent `json:"extents"`
+	// Chunk stripe chunk size in sectors, 0 for linear segments.
+	Chunk uint64 `json:"chunk,omitempty"`
+}
+
+// Disk is a local disk volumes are carved from.
+type Disk struct {
+	Path string `json:"path"`
+	// Size in sectors.
+	Size uint64 `json:"size"`
+}
+
+// Pool is the on-node metadata of the driver: its disks and the segments
+// of each volume.
+type Pool struct {
+	Disks   []Disk                     `json:"disks"`
+	Volumes map[api.VolumeID][]Segment `json:"volumes"`
+}
+
+func newPool() *Pool {
+	return &Pool{Volumes: make(map[api.VolumeID][]Segment)}
+}
+
+// sectors returns the size of a volume.
+func sectors(segs []Segment) uint64 {
+	var n uint64
+	for _, s := range segs {
+		n += s.Len
+	}
+	return n
+}
+
+// used returns the allocated extents of disk.
+func (p *Pool) used(disk string) []Extent {
+	var used []Extent
+	for _, segs := range p.Volumes {
+		for _, s := range segs {
+			for _, e := range s.Extents {
+				if e.Disk == disk {
+					used = append(used, e)
+				}
+			}
+		}
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].Start < used[j].Start })
+	return used
+}
+
+// free returns the free extents of disk, in order.
+func (p *Pool) free(d Disk) []Extent {
+	var free []Extent
+	var next uint64
+	for _, e := range p.used(d.Path) {
+		if e.Start > next {
+			free = append(free, Extent{Disk: d.Path, Start: next, Len: e.Start - next})
+		}
+		next = e.Start + e.Len
+	}
+	if end := d.Size / extentSectors * extentSectors; end > next {
+		free = append(free, Extent{Disk: d.Path, Start: next, Len: end - next})
+	}
+	return free
+}
+
+// inUse returns true if volumes are allocated on disk.
+func (p *Pool) inUse(disk string) bool {
+	return len(p.used(disk)) > 0
+}
+
+func roundUp(n, unit uint64) uint64 {
+	return (n + unit - 1) / unit * unit
+}
+
+// allocate returns the segments for size more sectors of a volume, striped
+// over stripes disks in chunks of chunk sectors, or linear if stripes is 1.
+// The pool is not modified.
+func (p *Pool) allocate(size uint64, stripes int, chunk uint64) ([]Segment, error) {
+	if size == 0 {
+		return nil, fmt.Errorf("Volume size must be greater than 0")
+	}
+	if stripes > 1 {
+		return p.allocateStriped(size, stripes, chunk)
+	}
+	remaining := roundUp(size, extentSectors)
+	var segs []Segment
+	for _, d := range p.Disks {
+		for _, e := range p.free(d) {
+			if remaining == 0 {
+				return segs, nil
+			}
+			if e.Len > remaining {
+				e.Len = remaining
+			}
+			segs = append(segs, Segment{Len: e.Len, Extents: []Extent{e}})
+			remaining -= e.Len
+		}
+	}
+	if remaining != 0 {
+		return nil, ErrNoSpace
+	}
+	return segs, nil
+}
+
+func (p *Pool) allocateStriped(size uint64, stripes int, chunk uint64) ([]Segment, error) {
+	if chunk == 0 || extentSectors%chunk != 0 {
+		return nil, fmt.Errorf("Stripe size of %d sectors must divide %d", chunk, extentSectors)
+	}
+	stripe := roundUp(roundUp(size, uint64(stripes))/uint64(stripes), extentSectors)
+	seg := Segment{Len: stripe * uint64(stripes), Chunk: chunk}
+	for _, d := range p.Disks {
+		for _, e := range p.free(d) {
+			if e.Len >= stripe {
+				e.Len = stripe
+				seg.Extents = append(seg.Extents, e)
+				break
+			}
+		}
+		if len(seg.Extents) == stripes {
+			return []Segment{seg}, nil
+		}
+	}
+	return nil, ErrNoSpace
+}
+
+// table returns the device mapper table of a volume made of segs.
+func table(segs []Segment) string {
+	var b bytes.Buffer
+	var start uint64
+	for _, s := range segs {
+		if s.Chunk == 0 {
+			e := s.Extents[0]
+			fmt.Fprintf(&b, "%d %d linear %s %d\n", start, s.Len, e.Disk, e.Start)
+		} else {
+			fmt.Fprintf(&b, "%d %d striped %d %d", start, s.Len, len(s.Extents), s.Chunk)
+			for _, e := range s.Extents {
+				fmt.Fprintf(&b, " %s %d", e.Disk, e.Start)
+			}
+			b.WriteString("\n")
+		}
+		start += s.Len
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package dm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPool() *Pool {
+	p := newPool()
+	p.Disks = []Disk{
+		{Path: "/dev/sdb", Size: 10 * extentSectors},
+		{Path: "/dev/sdc", Size: 10*extentSectors + 100},
+	}
+	return p
+}
+
+func TestAllocateLinear(t *testing.T) {
+	p := testPool()
+	segs, err := p.allocate(4*extentSectors-1, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4*extentSectors), sectors(segs))
+	p.Volumes["v1"] = segs
+
+	// Spans both disks.
+	segs, err = p.allocate(8*extentSectors, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Segment{
+		{Len: 6 * extentSectors, Extents: []Extent{{Disk: "/dev/sdb", Start: 4 * extentSectors, Len: 6 * extentSectors}}},
+		{Len: 2 * extentSectors, Extents: []Extent{{Disk: "/dev/sdc", Start: 0, Len: 2 * extentSectors}}},
+	}, segs)
+	p.Volumes["v2"] = segs
+	assert.Equal(t, "0 12288 linear /dev/sdb 8192\n12288 4096 linear /dev/sdc 0\n", table(segs))
+
+	_, err = p.allocate(9*extentSectors, 1, 0)
+	assert.Equal(t, ErrNoSpace, err)
+
+	// Freed extents are reused.
+	delete(p.Volumes, "v1")
+	segs, err = p.allocate(12*extentSectors, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(12*extentSectors), sectors(segs))
+	assert.Equal(t, Extent{Disk: "/dev/sdb", Start: 0, Len: 4 * extentSectors}, segs[0].Extents[0])
+
+	delete(p.Volumes, "v2")
+	assert.False(t, p.inUse("/dev/sdc"))
+}
+
+func TestAllocateStriped(t *testing.T) {
+	p := testPool()
+	segs, err := p.allocate(3*extentSectors, 2, 128)
+	assert.NoError(t, err)
+	assert.Len(t, segs, 1)
+	assert.Equal(t, uint64(4*extentSectors), segs[0].Len)
+	assert.Equal(t, "0 8192 striped 2 128 /dev/sdb 0 /dev/sdc 0\n", table(segs))
+	p.Volumes["v1"] = segs
+
+	_, err = p.allocate(extentSectors, 3, 128)
+	assert.Equal(t, ErrNoSpace, err)
+	_, err = p.allocate(extentSectors, 2, 3000)
+	assert.Error(t, err)
+}
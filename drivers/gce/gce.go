@@ -0,0 +1,463 @@
+// Package gce provisions block volumes from GCE persistent disks in the zone
+// of the instance. The driver authenticates with the service account of the
+// instance.
+package gce
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/pkg/cloudprovider"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+	"github.com/libopenstorage/openstorage/pkg/mkfs"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	Name = "gce"
+	Type = volume.Block
+	// ProjectParam project to create disks in, defaults to the project of
+	// the instance.
+	ProjectParam = "project"
+	// DiskTypeParam disk type of volumes with a Cos below 5, pd-standard by
+	// default. Volumes with a higher Cos are pd-ssd.
+	DiskTypeParam = "disk_type"
+
+	metadataURL = "http://metadata.google.internal/computeMetadata/v1/"
+	computeURL  = "https://www.googleapis.com/compute/v1/projects/"
+	byIDPrefix  = "/dev/disk/by-id/google-"
+	diskPrefix  = "osd-"
+
+	opTimeout     = 5 * time.Minute
+	attachTimeout = time.Minute
+)
+
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
+// metadata retrieves the instance metadata at key.
+func metadata(key string) (string, error) {
+	return cloudprovider.Metadata(metadataURL+key,
+		http.Header{"Metadata-Flavor": []string{"Google"}})
+}
+
+// serviceAccount is a TokenSource of the access tokens of the service
+// account of the instance. Tokens are reused until shortly before they
+// expire.
+type serviceAccount struct {
+	lock    sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (s *serviceAccount) Token() (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+	body, err := metadata("instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+	var t struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = json.Unmarshal([]byte(body), &t); err != nil {
+		return "", fmt.Errorf("Invalid service account token: %v", err)
+	}
+	s.token = t.AccessToken
+	s.expires = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
+
+// operation is a long running compute API operation.
+type operation struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	SelfLink string `json:"selfLink"`
+	Error    *struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"error,omitempty"`
+}
+
+func (op *operation) err() error {
+	if op.Error == nil || len(op.Error.Errors) == 0 {
+		return nil
+	}
+	e := op.Error.Errors[0]
+	return fmt.Errorf("Operation %s failed: %s: %s", op.Name, e.Code, e.Message)
+}
+
+type disk struct {
+	Name           string `json:"name"`
+	SizeGb         string `json:"sizeGb,omitempty"`
+	Type           string `json:"type,omitempty"`
+	SourceSnapshot string `json:"sourceSnapshot,omitempty"`
+}
+
+type driver struct {
+	*volume.DefaultEnumerator
+	api      *cloudprovider.Client
+	project  string
+	zone     string
+	instance string
+	diskType string
+}
+
+// Init gce volume driver metadata.
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
+	zone, err := metadata("instance/zone")
+	if err != nil {
+		return nil, err
+	}
+	// The zone is returned as projects/<number>/zones/<zone>.
+	zone = zone[strings.LastIndex(zone, "/")+1:]
+	instance, err := metadata("instance/name")
+	if err != nil {
+		return nil, err
+	}
+	project := params[ProjectParam]
+	if project == "" {
+		if project, err = metadata("project/project-id"); err != nil {
+			return nil, err
+		}
+	}
+	diskType := params[DiskTypeParam]
+	if diskType == "" {
+		diskType = "pd-standard"
+	}
+	logger.Infof("GCE instance %v project %v zone %v", instance, project, zone)
+
+	sa := &serviceAccount{}
+	return &driver{
+		DefaultEnumerator: c.NewEnumerator(),
+		api:               cloudprovider.NewClient(computeURL+project, sa.Token),
+		project:           project,
+		zone:              zone,
+		instance:          instance,
+		diskType:          diskType,
+	}, nil
+}
+
+func (d *driver) zonal(format string, args ...interface{}) string {
+	return "zones/" + d.zone + "/" + fmt.Sprintf(format, args...)
+}
+
+// wait waits for a zonal or global operation to complete.
+func (d *driver) wait(op *operation) error {
+	if err := op.err(); err != nil {
+		return err
+	}
+	return cloudprovider.Poll(2*time.Second, opTimeout, func() (bool, error) {
+		if op.Status == "DONE" {
+			return true, op.err()
+		}
+		return false, d.api.Do("GET", op.SelfLink, nil, op)
+	})
+}
+
+// call issues a compute API request that returns an operation and waits for
+// the operation to complete.
+func (d *driver) call(method, path string, in interface{}) error {
+	var op operation
+	if err := d.api.Do(method, path, in, &op); err != nil {
+		return err
+	}
+	return d.wait(&op)
+}
+
+// mapCos translates a CoS specified in spec to a disk type.
+func (d *driver) mapCos(cos api.VolumeCos) string {
+	if cos < 5 {
+		return d.diskType
+	}
+	return "pd-ssd"
+}
+
+// String is a description of this driver.
+func (d *driver) String() string {
+	return Name
+}
+
+// Type returns gce as a Block driver.
+func (d *driver) Type() volume.DriverType {
+	return Type
+}
+
+// Status diagnostic information
+func (d *driver) Status() api.DriverStatus {
+	return api.DriverStatus{
+		Driver: Name,
+		Details: [][2]string{
+			{"Project", d.project},
+			{"Zone", d.zone},
+			{"Instance", d.instance},
+		},
+	}
+}
+
+// HealthCheck verifies that the compute API is reachable with the service
+// account of the instance.
+func (d *driver) HealthCheck() []api.HealthReason {
+	if err := d.api.Do("GET", d.zonal("instances/%s", d.instance), nil, nil); err != nil {
+		return []api.HealthReason{{Check: "compute", State: api.HealthDown, Message: err.Error()}}
+	}
+	return nil
+}
+
+// Create a persistent disk from spec, or from the snapshot
+// options.CreateFromSnap.
+func (d *driver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+
+	name := diskPrefix + strings.TrimSuffix(uuid.New(), "\n")
+	pd := &disk{
+		Name:   name,
+		SizeGb: fmt.Sprint(cloudprovider.GiB(spec.Size)),
+		Type:   d.zonal("diskTypes/%s", d.mapCos(spec.Cos)),
+	}
+	if options != nil && options.CreateFromSnap != "" {
+		pd.SourceSnapshot = "global/snapshots/" + string(options.CreateFromSnap)
+	}
+	if err := d.call("POST", d.zonal("disks"), pd); err != nil {
+		logger.Warnf("Failed to create disk: %v", err)
+		return api.BadVolumeID, err
+	}
+
+	v := &api.Volume{
+		ID:       api.VolumeID(name),
+		Locator:  locator,
+		Ctime:    time.Now(),
+		Spec:     spec,
+		LastScan: time.Now(),
+		Format:   api.FsNone,
+		State:    api.VolumeAvailable,
+	}
+	if options != nil {
+		v.Parent = options.CreateFromSnap
+	}
+	if err := d.CreateVol(v); err != nil {
+		d.call("DELETE", d.zonal("disks/%s", name), nil)
+		return api.BadVolumeID, err
+	}
+	logger.Infof("Created volume %v", v.ID)
+	return v.ID, nil
+}
+
+// Delete deletes the disk of a detached volume.
+func (d *driver) Delete(volumeID api.VolumeID) error {
+	if err := d.CanDelete(volumeID); err != nil {
+		return err
+	}
+	err := d.call("DELETE", d.zonal("disks/%s", volumeID), nil)
+	if err != nil && err != cloudprovider.ErrNotFound {
+		return err
+	}
+	return d.DeleteVol(volumeID)
+}
+
+// Attach attaches the disk to this instance. Disks attached read only may be
+// attached to several instances.
+func (d *driver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	if options != nil && options.Reservation != api.ReservationNone {
+		return "", volume.ErrNotSupported
+	}
+	readOnly := options != nil && options.ReadOnly
+	if options != nil && options.Shared && !readOnly {
+		return "", volume.ErrNotSupported
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return "", err
+	}
+	node := api.MachineID(d.instance)
+	if err = volume.CheckAttach(v, node, options); err != nil {
+		return "", err
+	}
+	mode := "READ_WRITE"
+	if readOnly {
+		mode = "READ_ONLY"
+	}
+	link := byIDPrefix + string(volumeID)
+	if _, err = cloudprovider.DevicePath(link, 0); err != nil {
+		err = d.call("POST", d.zonal("instances/%s/attachDisk", d.instance), map[string]string{
+			"source":     d.zonal("disks/%s", volumeID),
+			"deviceName": string(volumeID),
+			"mode":       mode,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	dev, err := cloudprovider.DevicePath(link, attachTimeout)
+	if err != nil {
+		return "", err
+	}
+	volume.RecordAttach(v, node, options)
+	v.DevicePath = dev
+	return dev, d.UpdateVol(v)
+}
+
+// Detach detaches the disk from this instance.
+func (d *driver) Detach(volumeID api.VolumeID) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	path := d.zonal("instances/%s/detachDisk?deviceName=%s", d.instance, url.QueryEscape(string(volumeID)))
+	if err = d.call("POST", path, nil); err != nil {
+		return err
+	}
+	volume.RecordDetach(v, api.MachineID(d.instance))
+	v.DevicePath = ""
+	return d.UpdateVol(v)
+}
+
+// Format creates the filesystem of the volume spec on an attached volume.
+func (d *driver) Format(volumeID api.VolumeID) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	if v.Spec.Format == "" || v.Spec.Format == api.FsNone {
+		return fmt.Errorf("Volume %v has no filesystem to format: %v", volumeID, volume.ErrEinval)
+	}
+	device := volume.TopDevice(d, volumeID, v.DevicePath)
+	if err = mkfs.Format(device, v.Spec); err != nil {
+		return err
+	}
+	v.Format = v.Spec.Format
+	return d.UpdateVol(v)
+}
+
+// Mount mounts the filesystem of an attached volume at mountpath, or binds
+// the device of a raw volume there.
+func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	format, err := fs.MountFormat(v)
+	if err != nil {
+		return err
+	}
+	device := volume.TopDevice(d, volumeID, v.DevicePath)
+	if err = fs.MountDevice(device, mountpath, format); err != nil {
+		return fmt.Errorf("Failed to mount %v at %v: %v", device, mountpath, err)
+	}
+	v.AttachPath = mountpath
+	return d.UpdateVol(v)
+}
+
+// Unmount unmounts the filesystem of a volume.
+func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath == "" {
+		return fmt.Errorf("Device %v not mounted", volumeID)
+	}
+	if err = syscall.Unmount(v.AttachPath, 0); err != nil {
+		return err
+	}
+	v.AttachPath = ""
+	return d.UpdateVol(v)
+}
+
+// Snapshot creates a global snapshot of the disk. Snapshots cannot be
+// mounted, writable snaps are not supported.
+func (d *driver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	if writable {
+		return api.BadSnapID, volume.ErrNotSupported
+	}
+	if _, err := d.GetVol(volumeID); err != nil {
+		return api.BadSnapID, err
+	}
+	name := diskPrefix + strings.TrimSuffix(uuid.New(), "\n")
+	err := d.call("POST", d.zonal("disks/%s/createSnapshot", volumeID), map[string]string{"name": name})
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	snap := &api.VolumeSnap{
+		ID:         api.SnapID(name),
+		VolumeID:   volumeID,
+		SnapLabels: labels,
+		Ctime:      time.Now(),
+	}
+	if err = d.CreateSnap(snap); err != nil {
+		d.call("DELETE", "global/snapshots/"+name, nil)
+		return api.BadSnapID, err
+	}
+	return snap.ID, nil
+}
+
+// SnapDelete deletes the snapshot and its record.
+func (d *driver) SnapDelete(snapID api.SnapID) error {
+	if _, err := d.GetSnap(snapID); err != nil {
+		return err
+	}
+	err := d.call("DELETE", "global/snapshots/"+string(snapID), nil)
+	if err != nil && err != cloudprovider.ErrNotFound {
+		return err
+	}
+	return d.DeleteSnap(snapID)
+}
+
+// Resize grows the disk of a volume. The filesystem is not grown.
+func (d *driver) Resize(volumeID api.VolumeID, size uint64) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if size < v.Spec.Size {
+		return fmt.Errorf("Cannot shrink volume %v: %v", volumeID, volume.ErrEinval)
+	}
+	err = d.call("POST", d.zonal("disks/%s/resize", volumeID),
+		map[string]string{"sizeGb": fmt.Sprint(cloudprovider.GiB(size))})
+	if err != nil {
+		return err
+	}
+	v.Spec.Size = size
+	return d.UpdateVol(v)
+}
+
+func (d *driver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	return api.VolumeStats{}, volume.ErrNotSupported
+}
+
+func (d *driver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	return api.VolumeAlerts{}, volume.ErrNotSupported
+}
+
+func (d *driver) Shutdown() {
+	logger.Infof("%s Shutting down", Name)
+}
+
+func init() {
+	// Register ourselves as an openstorage volume driver.
+	volume.Register(Name, Init)
+}
@@ -0,0 +1,275 @@
+package gluster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	Name          = "gluster"
+	Type          = volume.File
+	ServerParam   = "server"
+	VolumeParam   = "volume"
+	SnapshotParam = "snapshots"
+)
+
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
+// Implements the open storage volume interface.
+type driver struct {
+	*volume.DefaultBlockDriver
+	*volume.DefaultEnumerator
+	server    string
+	volume    string
+	snapshots bool
+	// mountPath the gluster volume is mounted at, under the mount root of
+	// the driver instance.
+	mountPath string
+}
+
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
+	server, ok := params[ServerParam]
+	if !ok {
+		return nil, errors.New("No Gluster server provided")
+	}
+	vol, ok := params[VolumeParam]
+	if !ok {
+		return nil, errors.New("No Gluster volume provided")
+	}
+	logger.Infof("Gluster driver initializing with %s:%s ", server, vol)
+	root, err := volume.MountRoot(params, Name)
+	if err != nil {
+		return nil, err
+	}
+
+	inst := &driver{
+		DefaultEnumerator: c.NewEnumerator(),
+		server:            server,
+		volume:            vol,
+		snapshots:         params[SnapshotParam] == "true",
+		mountPath:         root,
+	}
+
+	err = os.MkdirAll(inst.mountPath, 0744)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mount the gluster volume locally on a unique path. The glusterfs
+	// filesystem is implemented in FUSE, so go through the mount helper.
+	syscall.Unmount(inst.mountPath, 0)
+	out, err := exec.Command("mount", "-t", "glusterfs",
+		inst.server+":/"+inst.volume, inst.mountPath).CombinedOutput()
+	if err != nil {
+		logger.Warnf("Unable to mount %s:%s at %s (%+v): %s",
+			inst.server, inst.volume, inst.mountPath, err, string(out))
+		return nil, err
+	}
+
+	logger.Infof("Gluster initialized and driver mounted at: %s", inst.mountPath)
+	return inst, nil
+}
+
+func (d *driver) String() string {
+	return Name
+}
+
+// HealthCheck verifies that the gluster volume is mounted and writable.
+func (d *driver) HealthCheck() []api.HealthReason {
+	return volume.CheckDir(d.mountPath, true, api.HealthDown)
+}
+
+func (d *driver) Type() volume.DriverType {
+	return Type
+}
+
+// Status diagnostic information
+func (d *driver) Status() api.DriverStatus {
+	return api.DriverStatus{
+		Driver:    Name,
+		Endpoints: []string{d.server + ":" + d.volume},
+	}
+}
+
+func (d *driver) Create(locator api.VolumeLocator, opt *api.CreateOptions, spec *api.VolumeSpec) (api.VolumeID, error) {
+	if spec.Format != "glusterfs" && spec.Format != "" {
+		return api.BadVolumeID, errors.New("Unsupported filesystem format: " + string(spec.Format))
+	}
+
+	if spec.BlockSize != 0 {
+		logger.Info("Gluster driver will ignore the blocksize option.")
+	}
+
+	volumeID := strings.TrimSuffix(uuid.New(), "\n")
+
+	// Create a directory on the Gluster volume with this UUID.
+	err := os.MkdirAll(path.Join(d.mountPath, volumeID), 0744)
+	if err != nil {
+		logger.Warn(err)
+		return api.BadVolumeID, err
+	}
+
+	v := &api.Volume{
+		ID:         api.VolumeID(volumeID),
+		Locator:    locator,
+		Ctime:      time.Now(),
+		Spec:       spec,
+		LastScan:   time.Now(),
+		Format:     "glusterfs",
+		State:      api.VolumeAvailable,
+		DevicePath: path.Join(d.mountPath, volumeID),
+	}
+
+	err = d.CreateVol(v)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	return v.ID, nil
+}
+
+func (d *driver) Delete(volumeID api.VolumeID) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		logger.Warn(err)
+		return err
+	}
+
+	if err = d.CanDelete(volumeID); err != nil {
+		return err
+	}
+
+	// Delete the directory on the gluster volume.
+	os.RemoveAll(v.DevicePath)
+
+	err = d.DeleteVol(volumeID)
+	if err != nil {
+		logger.Warn(err)
+		return err
+	}
+	return nil
+}
+
+func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		logger.Warn(err)
+		return err
+	}
+
+	syscall.Unmount(mountpath, 0)
+	err = syscall.Mount(v.DevicePath, mountpath, "", syscall.MS_BIND, "")
+	if err != nil {
+		logger.Warnf("Cannot mount %s at %s because %+v", v.DevicePath, mountpath, err)
+		return err
+	}
+
+	v.AttachPath = mountpath
+	return d.UpdateVol(v)
+}
+
+func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath == "" {
+		return fmt.Errorf("Device %v not mounted", volumeID)
+	}
+	err = syscall.Unmount(v.AttachPath, 0)
+	if err != nil {
+		return err
+	}
+	v.AttachPath = ""
+	return d.UpdateVol(v)
+}
+
+func gluster(args ...string) error {
+	args = append([]string{"--mode=script"}, args...)
+	out, err := exec.Command("gluster", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("gluster %v failed: %v: %s", args, err, string(out))
+	}
+	return nil
+}
+
+// Snapshot uses gluster volume snapshots. Gluster snapshots are taken at the
+// granularity of the backing gluster volume, so the snap covers every
+// openstorage volume carved from it. Snapshots must be enabled with the
+// SnapshotParam driver parameter. Gluster snapshots are read-only.
+func (d *driver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	if !d.snapshots || writable {
+		return api.BadSnapID, volume.ErrNotSupported
+	}
+	if _, err := d.GetVol(volumeID); err != nil {
+		return api.BadSnapID, err
+	}
+	snapID := strings.TrimSuffix(uuid.New(), "\n")
+	snap := &api.VolumeSnap{
+		ID:         api.SnapID(snapID),
+		VolumeID:   volumeID,
+		SnapLabels: labels,
+		Ctime:      time.Now(),
+	}
+	err := d.CreateSnap(snap)
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	err = gluster("snapshot", "create", snapID, d.volume, "no-timestamp")
+	if err != nil {
+		d.DeleteSnap(snap.ID)
+		return api.BadSnapID, err
+	}
+	return snap.ID, nil
+}
+
+func (d *driver) SnapDelete(snapID api.SnapID) error {
+	if !d.snapshots {
+		return volume.ErrNotSupported
+	}
+	err := gluster("snapshot", "delete", string(snapID))
+	if err != nil {
+		return err
+	}
+	return d.DeleteSnap(snapID)
+}
+
+// UsedSize returns the number of bytes stored in the volume directory.
+func (d *driver) UsedSize(volumeID api.VolumeID) (uint64, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return 0, err
+	}
+	return volume.DirUsage(v.DevicePath)
+}
+
+func (d *driver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	return api.VolumeStats{}, volume.ErrNotSupported
+}
+
+func (d *driver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	return api.VolumeAlerts{}, volume.ErrNotSupported
+}
+
+func (d *driver) Shutdown() {
+	logger.Infof("%s Shutting down", Name)
+	syscall.Unmount(d.mountPath, 0)
+}
+
+func init() {
+	// Register ourselves as an openstorage volume driver.
+	volume.Register(Name, Init)
+}
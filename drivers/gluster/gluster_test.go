@@ -0,0 +1,30 @@
+package gluster
+
+import (
+	"os"
+	"testing"
+
+	"github.com/libopenstorage/openstorage/drivers/test"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+func TestAll(t *testing.T) {
+	server := os.Getenv("GLUSTER_SERVER")
+	vol := os.Getenv("GLUSTER_VOLUME")
+	if server == "" || vol == "" {
+		t.Skip("GLUSTER_SERVER and GLUSTER_VOLUME must be set to run the gluster tests")
+	}
+
+	_, err := volume.New(Name, volume.DriverParams{ServerParam: server, VolumeParam: vol})
+	if err != nil {
+		t.Fatalf("Failed to initialize Driver: %v", err)
+	}
+	d, err := volume.Get(Name)
+	if err != nil {
+		t.Fatalf("Failed to initialize Volume Driver: %v", err)
+	}
+	ctx := test.NewContext(d)
+	ctx.Filesystem = "glusterfs"
+
+	test.RunShort(t, ctx)
+}
@@ -1,77 +1,238 @@
 package nfs
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path"
 	"strings"
 	"syscall"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/pborman/uuid"
 
-	"github.com/portworx/kvdb"
-
 	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/pkg/diff"
+	"github.com/libopenstorage/openstorage/pkg/fs"
 	"github.com/libopenstorage/openstorage/volume"
 )
 
 const (
-	Name         = "nfs"
-	Type         = volume.File
-	NfsDBKey     = "OpenStorageNFSKey"
-	nfsMountPath = "/var/lib/openstorage/nfs/"
+	Name     = "nfs"
+	Type     = volume.File
+	NfsDBKey = "OpenStorageNFSKey"
 )
 
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
+// export is an NFS server:path (or a local path to bind mount) that volumes
+// are carved out of.
+type export struct {
+	server    string
+	path      string
+	mountPath string
+	// label SELinux context of the mount point.
+	label string
+	opts  *mountOptions
+}
+
+func (e *export) String() string {
+	if e.server == "" {
+		return e.path
+	}
+	return e.server + ":" + e.path
+}
+
+// space returns the size of the export and the number of bytes available
+// on it.
+func (e *export) space() (uint64, uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(e.mountPath, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize), nil
+}
+
+func (e *export) mount() error {
+	var err error
+	err = fs.MakeDir(e.mountPath, 0755, e.label)
+	if err != nil {
+		return err
+	}
+	syscall.Unmount(e.mountPath, 0)
+	if e.server != "" {
+		err = syscall.Mount(":"+e.path, e.mountPath, "nfs", 0, e.opts.data(e.server))
+	} else {
+		err = syscall.Mount(e.path, e.mountPath, "", syscall.MS_BIND, "")
+	}
+	if err != nil {
+		logger.Warnf("Unable to mount %s at %s (%+v)", e, e.mountPath, err)
+	}
+	return err
+}
+
 // Implements the open storage volume interface.
 type driver struct {
 	*volume.DefaultBlockDriver
 	*volume.DefaultEnumerator
-	*volume.SnapshotNotSupported
-	nfsServer string
-	nfsPath   string
+	exports []*export
+	// mountRoot directory the exports are mounted under.
+	mountRoot string
+	// label SELinux context of the directories of the driver.
+	label string
+	stop  chan struct{}
 }
 
-func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
-	path, ok := params["path"]
-	if !ok {
+// parseExports builds the list of exports from the driver params. Exports
+// may be specified as a comma separated list of server:path entries with the
+// "exports" key, or as a single export with the "server" and "path" keys.
+// Entries without a server are bind mounted from the local host. All exports
+// are mounted with the NFS options in params, under the mount root of
+// params.
+func parseExports(params volume.DriverParams) ([]*export, error) {
+	opts, err := parseMountOptions(params, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	root, err := volume.MountRoot(params, Name)
+	if err != nil {
+		return nil, err
+	}
+	exports := make([]*export, 0)
+	if list, ok := params["exports"]; ok {
+		for _, e := range strings.Split(list, ",") {
+			e = strings.TrimSpace(e)
+			if e == "" {
+				continue
+			}
+			if i := strings.Index(e, ":"); i >= 0 {
+				exports = append(exports, &export{server: e[:i], path: e[i+1:]})
+			} else {
+				exports = append(exports, &export{path: e})
+			}
+		}
+	} else if p, ok := params["path"]; ok {
+		// A single export is mounted at the mount root, as it was before
+		// the driver supported several, where the volumes created then
+		// expect it.
+		if p == "" {
+			return nil, errors.New("No NFS path provided")
+		}
+		e := &export{server: params["server"], path: p, mountPath: root}
+		exports = append(exports, e)
+	}
+	if len(exports) == 0 {
 		return nil, errors.New("No NFS path provided")
 	}
-
-	server, ok := params["server"]
-	if !ok {
-		log.Printf("No NFS server provided, will attempt to bind mount %s", path)
-	} else {
-		log.Printf("NFS driver initializing with %s:%s ", server, path)
+	for _, e := range exports {
+		if e.path == "" {
+			return nil, fmt.Errorf("No NFS path provided for export %q", e)
+		}
+		// Mount each export of a list at a path derived from the export,
+		// so that volume DevicePaths stay valid across restarts.
+		if e.mountPath == "" {
+			name := strings.Replace(strings.Trim(e.String(), "/"), "/", "_", -1)
+			e.mountPath = path.Join(root, name)
+		}
+		e.label = params[volume.MountLabelParam]
+		e.opts = opts
 	}
+	return exports, nil
+}
 
-	inst := &driver{
-		DefaultEnumerator: volume.NewDefaultEnumerator(Name, kvdb.Instance()),
-		nfsServer:         server,
-		nfsPath:           path}
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
+	exports, err := parseExports(params)
+	if err != nil {
+		return nil, err
+	}
 
-	err := os.MkdirAll(nfsMountPath, 0744)
+	interval, err := superviseInterval(params)
 	if err != nil {
 		return nil, err
 	}
 
-	// Mount the nfs server locally on a unique path.
-	syscall.Unmount(nfsMountPath, 0)
-	if server != "" {
-		err = syscall.Mount(":"+inst.nfsPath, nfsMountPath, "nfs", 0, "nolock,addr="+inst.nfsServer)
-	} else {
-		err = syscall.Mount(inst.nfsPath, nfsMountPath, "", syscall.MS_BIND, "")
+	root, err := volume.MountRoot(params, Name)
+	if err != nil {
+		return nil, err
 	}
+	inst := &driver{
+		DefaultEnumerator: c.NewEnumerator(),
+		exports:           exports,
+		mountRoot:         root,
+		label:             params[volume.MountLabelParam],
+		stop:              make(chan struct{}),
+	}
+
+	err = fs.MakeDir(inst.mountRoot, 0755, inst.label)
 	if err != nil {
-		log.Printf("Unable to mount %s:%s at %s (%+v)", inst.nfsServer, inst.nfsPath, nfsMountPath, err)
 		return nil, err
 	}
 
-	log.Println("NFS initialized and driver mounted at: ", nfsMountPath)
+	// Mount the nfs exports locally on unique paths.
+	for _, e := range inst.exports {
+		c.Log.Infof("NFS driver initializing with %s", e)
+		if err = e.mount(); err != nil {
+			return nil, err
+		}
+		c.Log.Infof("NFS export %s mounted at: %s", e, e.mountPath)
+	}
+	if interval > 0 {
+		go inst.supervise(interval)
+	}
 	return inst, nil
 }
 
+// pickExport returns the export with the most free space.
+func (d *driver) pickExport() (*export, error) {
+	var best *export
+	var bestFree uint64
+	for _, e := range d.exports {
+		_, free, err := e.space()
+		if err != nil {
+			logger.Warnf("Unable to stat NFS export %s: %v", e, err)
+			continue
+		}
+		if best == nil || free > bestFree {
+			best = e
+			bestFree = free
+		}
+	}
+	if best == nil {
+		return nil, errors.New("No NFS export available")
+	}
+	return best, nil
+}
+
+// exportOf returns the export backing v, recorded in its Pool, or found
+// from its DevicePath for volumes created before exports were recorded.
+func (d *driver) exportOf(v *api.Volume) (*export, error) {
+	if v.Pool != "" {
+		return d.exportByID(v.Pool)
+	}
+	for _, e := range d.exports {
+		if strings.HasPrefix(v.DevicePath, e.mountPath+"/") {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("No NFS export configured for volume %v at %v",
+		v.ID, v.DevicePath)
+}
+
+// VolumePool returns the export holding v.
+func (d *driver) VolumePool(v *api.Volume) string {
+	e, err := d.exportOf(v)
+	if err != nil {
+		return ""
+	}
+	return e.String()
+}
+
 func (d *driver) String() string {
 	return Name
 }
@@ -81,27 +242,84 @@ func (d *driver) Type() volume.DriverType {
 }
 
 // Status diagnostic information
-func (d *driver) Status() [][2]string {
-	return [][2]string{}
+func (d *driver) Status() api.DriverStatus {
+	status := api.DriverStatus{Driver: Name}
+	status.Details = append(status.Details, [2]string{"Mount root", d.mountRoot})
+	if d.label != "" {
+		status.Details = append(status.Details, [2]string{"SELinux label", d.label})
+	}
+	for _, e := range d.exports {
+		status.Endpoints = append(status.Endpoints, e.String())
+		size, free, err := e.space()
+		if err != nil {
+			status.Pools = append(status.Pools, api.PoolStatus{Name: e.String(), Error: err.Error()})
+			continue
+		}
+		status.Pools = append(status.Pools, api.PoolStatus{Name: e.String(), Capacity: size, Free: free})
+		status.Capacity += size
+		status.Free += free
+	}
+	return status
+}
+
+// HealthCheck verifies that every export is mounted and writable. The driver
+// is degraded while some exports remain usable.
+func (d *driver) HealthCheck() []api.HealthReason {
+	var reasons []api.HealthReason
+	for _, e := range d.exports {
+		for _, r := range volume.CheckDir(e.mountPath, e.server != "", api.HealthDegraded) {
+			r.Check = e.String() + ": " + r.Check
+			reasons = append(reasons, r)
+		}
+	}
+	if len(reasons) == len(d.exports) {
+		for i := range reasons {
+			reasons[i].State = api.HealthDown
+		}
+	}
+	return reasons
 }
 
 func (d *driver) Create(locator api.VolumeLocator, opt *api.CreateOptions, spec *api.VolumeSpec) (api.VolumeID, error) {
+	return d.CreateCtx(context.Background(), locator, opt, spec)
+}
+
+func (d *driver) CreateCtx(ctx context.Context, locator api.VolumeLocator, opt *api.CreateOptions, spec *api.VolumeSpec) (api.VolumeID, error) {
 	// Validate options.
 	if spec.Format != "nfs" && spec.Format != "" {
 		return api.BadVolumeID, errors.New("Unsupported filesystem format: " + string(spec.Format))
 	}
 
 	if spec.BlockSize != 0 {
-		log.Println("NFS driver will ignore the blocksize option.")
+		logger.Info("NFS driver will ignore the blocksize option.")
 	}
 
 	volumeID := uuid.New()
 	volumeID = strings.TrimSuffix(volumeID, "\n")
 
+	e, err := d.pickExport()
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	if _, err = volumeOptions(e, &api.Volume{Spec: spec}); err != nil {
+		return api.BadVolumeID, err
+	}
+
 	// Create a directory on the NFS server with this UUID.
-	err := os.MkdirAll(nfsMountPath+volumeID, 0744)
+	devicePath := path.Join(e.mountPath, volumeID)
+	err = volume.RunContext(ctx, func() error {
+		return os.MkdirAll(devicePath, 0744)
+	})
 	if err != nil {
-		log.Println(err)
+		logger.Warn(err)
+		return api.BadVolumeID, err
+	}
+	// Servers without labeled NFS ignore the label of the mount.
+	if err = fs.SetLabel(devicePath, d.label); err != nil {
+		logger.Warnf("Cannot label volume %s: %v", volumeID, err)
+	}
+	if err = volume.SetRootDir(devicePath, spec); err != nil {
+		os.RemoveAll(devicePath)
 		return api.BadVolumeID, err
 	}
 
@@ -113,32 +331,51 @@ func (d *driver) Create(locator api.VolumeLocator, opt *api.CreateOptions, spec
 		LastScan:   time.Now(),
 		Format:     "nfs",
 		State:      api.VolumeAvailable,
-		DevicePath: nfsMountPath + volumeID,
+		DevicePath: devicePath,
+		Pool:       e.String(),
 	}
 
-	err = d.CreateVol(v)
+	err = d.CreateVolCtx(ctx, v)
 	if err != nil {
+		os.RemoveAll(devicePath)
 		return api.BadVolumeID, err
 	}
 
-	err = d.UpdateVol(v)
+	err = d.UpdateVolCtx(ctx, v)
 
 	return v.ID, err
 }
 
 func (d *driver) Delete(volumeID api.VolumeID) error {
-	v, err := d.GetVol(volumeID)
+	return d.DeleteCtx(context.Background(), volumeID)
+}
+
+func (d *driver) DeleteCtx(ctx context.Context, volumeID api.VolumeID) error {
+	v, err := d.GetVolCtx(ctx, volumeID)
+	if err != nil {
+		logger.Warn(err)
+		return err
+	}
+
+	err = volume.WithContext(ctx, func() error {
+		return d.CanDelete(volumeID)
+	})
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
 	// Delete the directory on the nfs server.
-	os.Remove(v.DevicePath)
+	err = volume.RunContext(ctx, func() error {
+		os.Remove(v.DevicePath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-	err = d.DeleteVol(volumeID)
+	err = d.DeleteVolCtx(ctx, volumeID)
 	if err != nil {
-		log.Println(err)
+		logger.Warn(err)
 		return err
 	}
 
@@ -146,52 +383,507 @@ func (d *driver) Delete(volumeID api.VolumeID) error {
 }
 
 func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
-	v, err := d.GetVol(volumeID)
+	return d.MountCtx(context.Background(), volumeID, mountpath)
+}
+
+func (d *driver) MountCtx(ctx context.Context, volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVolCtx(ctx, volumeID)
+	if err != nil {
+		// Writable snaps are mounted by snapID.
+		if snap, serr := d.GetWritableSnap(api.SnapID(volumeID)); serr == nil {
+			return volume.RunContext(ctx, func() error {
+				return d.mountSnap(snap, mountpath)
+			})
+		} else if serr == volume.ErrSnapReadOnly {
+			return serr
+		}
+		logger.Warn(err)
+		return err
+	}
+	e, err := d.exportOf(v)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
-	syscall.Unmount(mountpath, 0)
-	err = syscall.Mount(v.DevicePath, mountpath, string(v.Spec.Format), syscall.MS_BIND, "")
+	err = volume.RunContext(ctx, func() error {
+		syscall.Unmount(mountpath, 0)
+		return mountVolume(e, v, mountpath, volume.LayerMountOptions(d, volumeID))
+	})
 	if err != nil {
-		log.Printf("Cannot mount %s at %s because %+v", v.DevicePath, mountpath, err)
+		logger.Warnf("Cannot mount %s at %s because %+v", v.DevicePath, mountpath, err)
 		return err
 	}
 
 	v.AttachPath = mountpath
-	err = d.UpdateVol(v)
+	err = d.UpdateVolCtx(ctx, v)
 
 	return err
 }
 
 func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
-	v, err := d.GetVol(volumeID)
+	return d.UnmountCtx(context.Background(), volumeID, mountpath)
+}
+
+// mountVolume bind mounts the directory of v from its export, or mounts it
+// from the server if the volume has NFS options of its own or the layers of
+// the driver add layerOpts, such as "fsc" to cache it with FS-Cache.
+func mountVolume(e *export, v *api.Volume, mountpath string, layerOpts []string) error {
+	opts, err := volumeOptions(e, v)
+	if err != nil {
+		return err
+	}
+	if len(layerOpts) > 0 {
+		if e.server == "" {
+			return fmt.Errorf("Cannot mount volume %v with options %v, export %s is local",
+				v.ID, layerOpts, e)
+		}
+		if opts == nil {
+			opts = e.opts
+		}
+		o := *opts
+		o.extra = append(append([]string(nil), opts.extra...), layerOpts...)
+		opts = &o
+	}
+	if opts == nil || e.server == "" {
+		return syscall.Mount(v.DevicePath, mountpath, "", syscall.MS_BIND, "")
+	}
+	return syscall.Mount(":"+path.Join(e.path, string(v.ID)), mountpath, "nfs", 0, opts.data(e.server))
+}
+
+// mountSnap bind mounts the directory of a writable snap.
+func (d *driver) mountSnap(snap *api.VolumeSnap, mountpath string) error {
+	for _, e := range d.exports {
+		snapPath := path.Join(e.mountPath, string(snap.ID))
+		if _, err := os.Stat(snapPath); err != nil {
+			continue
+		}
+		syscall.Unmount(mountpath, 0)
+		return syscall.Mount(snapPath, mountpath, "", syscall.MS_BIND, "")
+	}
+	return volume.ErrEnoEnt
+}
+
+func (d *driver) UnmountCtx(ctx context.Context, volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVolCtx(ctx, volumeID)
 	if err != nil {
+		if _, serr := d.GetWritableSnap(api.SnapID(volumeID)); serr == nil {
+			return volume.RunContext(ctx, func() error {
+				return syscall.Unmount(mountpath, 0)
+			})
+		}
 		return err
 	}
 	if v.AttachPath == "" {
 		return fmt.Errorf("Device %v not mounted", volumeID)
 	}
-	err = syscall.Unmount(v.AttachPath, 0)
+	err = volume.RunContext(ctx, func() error {
+		return syscall.Unmount(v.AttachPath, 0)
+	})
 	if err != nil {
 		return err
 	}
 	v.AttachPath = ""
-	err = d.UpdateVol(v)
+	err = d.UpdateVolCtx(ctx, v)
 	return err
 }
 
+// copyDir copies the contents of src into dst. Reflinks are used when the
+// backing filesystem supports them, otherwise the data is copied with rsync,
+// within bwlimit bytes per second if it is not 0.
+// The copy is killed if ctx is cancelled.
+func copyDir(ctx context.Context, src, dst string, bwlimit uint64) error {
+	out, err := exec.CommandContext(ctx, "cp", "-a", "--reflink=always", src+"/.", dst).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	logger.Debugf("Reflink copy of %s failed, falling back to rsync: %v: %s", src, err, string(out))
+	args := []string{"-a", "--delete"}
+	if bwlimit != 0 {
+		// rsync limits in KiB per second.
+		args = append(args, fmt.Sprintf("--bwlimit=%d", (bwlimit+1023)/1024))
+	}
+	args = append(args, src+"/", dst+"/")
+	out, err = exec.CommandContext(ctx, "rsync", args...).CombinedOutput()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to copy %s to %s: %v: %s", src, dst, err, string(out))
+	}
+	return nil
+}
+
+// Snapshot copies the volume directory to a snapshot directory on the same
+// export. IO to the volume should be quiesced, the copy is not atomic.
+func (d *driver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	return d.SnapshotCtx(context.Background(), volumeID, labels, writable)
+}
+
+func (d *driver) SnapshotCtx(ctx context.Context, volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	v, err := d.GetVolCtx(ctx, volumeID)
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	e, err := d.exportOf(v)
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	snapID := strings.TrimSuffix(uuid.New(), "\n")
+	snapPath := path.Join(e.mountPath, snapID)
+
+	err = os.MkdirAll(snapPath, 0744)
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	err = copyDir(ctx, v.DevicePath, snapPath, 0)
+	if err != nil {
+		os.RemoveAll(snapPath)
+		return api.BadSnapID, err
+	}
+	snap := &api.VolumeSnap{
+		ID:         api.SnapID(snapID),
+		VolumeID:   volumeID,
+		SnapLabels: labels,
+		Writable:   writable,
+		Ctime:      time.Now(),
+	}
+	err = d.CreateSnapCtx(ctx, snap)
+	if err != nil {
+		os.RemoveAll(snapPath)
+		return api.BadSnapID, err
+	}
+	return snap.ID, nil
+}
+
+// SnapDelete removes the snapshot directory and its record.
+func (d *driver) SnapDelete(snapID api.SnapID) error {
+	return d.SnapDeleteCtx(context.Background(), snapID)
+}
+
+func (d *driver) SnapDeleteCtx(ctx context.Context, snapID api.SnapID) error {
+	if _, err := d.GetSnapCtx(ctx, snapID); err != nil {
+		return err
+	}
+	err := volume.RunContext(ctx, func() error {
+		for _, e := range d.exports {
+			snapPath := path.Join(e.mountPath, string(snapID))
+			if _, err := os.Stat(snapPath); err == nil {
+				return os.RemoveAll(snapPath)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return d.DeleteSnapCtx(ctx, snapID)
+}
+
+// snapPath returns the directory of a snapshot.
+func (d *driver) snapPath(snapID api.SnapID) (string, error) {
+	for _, e := range d.exports {
+		p := path.Join(e.mountPath, string(snapID))
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", volume.ErrEnoEnt
+}
+
+// SnapDiff compares the snapshot directories on the nfs server.
+func (d *driver) SnapDiff(fromSnapID, toSnapID api.SnapID) (io.ReadCloser, error) {
+	if _, err := volume.CheckSnapDiff(d, fromSnapID, toSnapID); err != nil {
+		return nil, err
+	}
+	to, err := d.snapPath(toSnapID)
+	if err != nil {
+		return nil, err
+	}
+	from := ""
+	if fromSnapID != "" {
+		if from, err = d.snapPath(fromSnapID); err != nil {
+			return nil, err
+		}
+	}
+	return diff.Dirs(from, to), nil
+}
+
+// Fingerprint hashes the files of the volume directory on the nfs server.
+func (d *driver) Fingerprint(volumeID api.VolumeID, base api.SnapID) (*api.Fingerprint, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	baseDir := ""
+	if base != "" {
+		if baseDir, err = d.snapPath(base); err != nil {
+			return nil, err
+		}
+	}
+	return d.FingerprintTree(volumeID, v.DevicePath, base, baseDir)
+}
+
+// ApplyDiff writes the files of the diff stream r into the volume.
+func (d *driver) ApplyDiff(volumeID api.VolumeID, r io.Reader) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	return diff.Apply(r, v.DevicePath)
+}
+
+// Catalog lists path within the volume directory on the nfs server.
+func (d *driver) Catalog(volumeID api.VolumeID, p string) ([]api.CatalogEntry, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	return volume.CatalogDir(v.DevicePath, p)
+}
+
+// UsedSize returns the number of bytes stored in the volume directory.
+func (d *driver) UsedSize(volumeID api.VolumeID) (uint64, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return 0, err
+	}
+	return volume.DirUsage(v.DevicePath)
+}
+
+// Backends returns the exports with the volumes that are not mounted.
+func (d *driver) Backends() ([]api.Backend, error) {
+	vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var backends []api.Backend
+	for _, e := range d.exports {
+		size, free, err := e.space()
+		if err != nil {
+			logger.Warnf("Unable to stat NFS export %s: %v", e, err)
+			continue
+		}
+		b := api.Backend{
+			ID:       e.String(),
+			Capacity: size,
+			Used:     size - free,
+			Volumes:  make(map[api.VolumeID]uint64),
+		}
+		for _, v := range vols {
+			if v.AttachPath != "" {
+				continue
+			}
+			if ve, err := d.exportOf(&v); err != nil || ve != e {
+				continue
+			}
+			if used, err := volume.DirUsage(v.DevicePath); err == nil {
+				b.Volumes[v.ID] = used
+			}
+		}
+		backends = append(backends, b)
+	}
+	return backends, nil
+}
+
+// exportByID returns the export named id by Backends.
+func (d *driver) exportByID(id string) (*export, error) {
+	for _, e := range d.exports {
+		if e.String() == id {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("No NFS export %s", id)
+}
+
+// Move copies the directory of a volume that is not mounted to another
+// export and removes it from the old one. The volume is in maintenance for
+// the time of the copy, so that it is not mounted on any node nor moved
+// again until the copy is complete.
+func (d *driver) Move(volumeID api.VolumeID, from, to string) (err error) {
+	v, err := d.startMove(volumeID)
+	if err != nil {
+		return err
+	}
+	var dst *export
+	devicePath := ""
+	defer func() {
+		if merr := d.endMove(volumeID, dst, devicePath); merr != nil && err == nil {
+			err = merr
+		}
+	}()
+	src, err := d.exportOf(v)
+	if err != nil {
+		return err
+	}
+	if src.String() != from {
+		return fmt.Errorf("Volume %v is on NFS export %s, not %s", volumeID, src, from)
+	}
+	if dst, err = d.exportByID(to); err != nil {
+		return err
+	}
+	target := path.Join(dst.mountPath, string(volumeID))
+	if err = os.MkdirAll(target, 0744); err != nil {
+		return err
+	}
+	bwlimit := volume.Bandwidth(volume.BandwidthMigration)
+	if err = copyDir(context.Background(), v.DevicePath, target, bwlimit); err != nil {
+		os.RemoveAll(target)
+		return err
+	}
+	devicePath = target
+	logger.Infof("Moved volume %v from NFS export %s to %s", volumeID, from, to)
+	return nil
+}
+
+// startMove puts volumeID in maintenance for a move, unless it is mounted or
+// already in maintenance, as when it is being moved.
+func (d *driver) startMove(volumeID api.VolumeID) (*api.Volume, error) {
+	token, err := d.Lock(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Unlock(token)
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	if v.AttachPath != "" {
+		return nil, volume.ErrVolAttached
+	}
+	if v.Maintenance {
+		return nil, volume.ErrVolMaintenance
+	}
+	v.Maintenance = true
+	if err = d.UpdateVol(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// endMove ends the maintenance of volumeID and, if its directory was copied
+// to devicePath on dst, moves it there and removes the old one. The copy is
+// dropped if the volume was mounted while it was made.
+func (d *driver) endMove(volumeID api.VolumeID, dst *export, devicePath string) (err error) {
+	defer func() {
+		if err != nil && devicePath != "" {
+			os.RemoveAll(devicePath)
+		}
+	}()
+	token, err := d.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer d.Unlock(token)
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	v.Maintenance = false
+	oldPath := v.DevicePath
+	if devicePath != "" {
+		if v.AttachPath != "" {
+			err = volume.ErrVolAttached
+		} else {
+			v.DevicePath = devicePath
+			v.Pool = dst.String()
+		}
+	}
+	if uerr := d.UpdateVol(v); uerr != nil && err == nil {
+		err = uerr
+	}
+	if err == nil && devicePath != "" {
+		os.RemoveAll(oldPath)
+	}
+	return err
+}
+
+// referenced returns the directories on the exports that volumes, including
+// those in the trash, and snapshots use.
+func (d *driver) referenced() (map[string]bool, error) {
+	vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := d.EnumerateDeleted()
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := d.SnapEnumerate(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]bool)
+	for _, v := range append(vols, deleted...) {
+		refs[v.DevicePath] = true
+	}
+	for _, e := range d.exports {
+		for _, snap := range snaps {
+			refs[path.Join(e.mountPath, string(snap.ID))] = true
+		}
+	}
+	return refs, nil
+}
+
+// Orphans returns the directories on the exports that no volume or snapshot
+// uses.
+func (d *driver) Orphans() ([]api.Orphan, error) {
+	refs, err := d.referenced()
+	if err != nil {
+		return nil, err
+	}
+	var orphans []api.Orphan
+	for _, e := range d.exports {
+		found, err := volume.OrphansIn(e.mountPath, e.String(), func(name string) bool {
+			return refs[path.Join(e.mountPath, name)]
+		})
+		if err != nil {
+			logger.Warnf("Unable to scan NFS export %s for orphans: %v", e, err)
+			continue
+		}
+		orphans = append(orphans, found...)
+	}
+	return orphans, nil
+}
+
+// ReclaimOrphan removes an orphaned directory of an export.
+func (d *driver) ReclaimOrphan(o api.Orphan) error {
+	e, err := d.exportByID(o.Backend)
+	if err != nil || path.Dir(o.ID) != path.Clean(e.mountPath) {
+		return volume.ErrEinval
+	}
+	refs, err := d.referenced()
+	if err != nil {
+		return err
+	}
+	if refs[o.ID] {
+		return volume.ErrEinval
+	}
+	return os.RemoveAll(o.ID)
+}
+
+func (d *driver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	return api.VolumeStats{}, volume.ErrNotSupported
+}
+
 func (d *driver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
 	return api.VolumeAlerts{}, volume.ErrNotSupported
 }
 
 func (d *driver) Shutdown() {
-	log.Printf("%s Shutting down", Name)
-	syscall.Unmount(nfsMountPath, 0)
+	logger.Infof("%s Shutting down", Name)
+	close(d.stop)
+	for _, e := range d.exports {
+		syscall.Unmount(e.mountPath, 0)
+	}
 }
 
 func init() {
 	// Register ourselves as an openstorage volume driver.
 	volume.Register(Name, Init)
+	volume.RegisterConstraints(Name, volume.Constraints{
+		Formats: []api.Filesystem{api.FsNfs},
+	})
 }
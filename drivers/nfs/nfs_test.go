@@ -2,8 +2,10 @@ package nfs
 
 import (
 	"os"
+	"path"
 	"testing"
 
+	"github.com/libopenstorage/openstorage/api"
 	"github.com/libopenstorage/openstorage/drivers/test"
 	"github.com/libopenstorage/openstorage/volume"
 )
@@ -12,6 +14,82 @@ var (
 	testPath = string("/tmp/openstorage_driver_test")
 )
 
+func TestParseExports(t *testing.T) {
+	exports, err := parseExports(volume.DriverParams{"exports": "s1:/a, s2:/b/c,/local"})
+	if err != nil {
+		t.Fatalf("Failed to parse exports: %v", err)
+	}
+	if len(exports) != 3 {
+		t.Fatalf("Expected 3 exports, got %v", len(exports))
+	}
+	if exports[1].server != "s2" || exports[1].path != "/b/c" {
+		t.Fatalf("Unexpected export %v", exports[1])
+	}
+	if exports[2].server != "" || exports[2].path != "/local" {
+		t.Fatalf("Unexpected export %v", exports[2])
+	}
+	if exports[0].mountPath == exports[1].mountPath {
+		t.Fatalf("Exports must be mounted at unique paths")
+	}
+
+	_, err = parseExports(volume.DriverParams{})
+	if err == nil {
+		t.Fatalf("Parse should fail without any exports")
+	}
+
+	// A single export is mounted where volumes created before exports
+	// could be listed expect it.
+	exports, err = parseExports(volume.DriverParams{"server": "s1", "path": "/a"})
+	if err != nil {
+		t.Fatalf("Failed to parse export: %v", err)
+	}
+	root, _ := volume.MountRoot(volume.DriverParams{}, Name)
+	if len(exports) != 1 || exports[0].mountPath != root {
+		t.Fatalf("Single export should be mounted at %s: %v", root, exports[0].mountPath)
+	}
+	d := &driver{exports: exports}
+	legacy := &api.Volume{ID: "v1", DevicePath: path.Join(root, "v1")}
+	if e, err := d.exportOf(legacy); err != nil || e != exports[0] {
+		t.Fatalf("Volume without a pool should be found by its path: %v", err)
+	}
+	if _, err := d.exportOf(&api.Volume{ID: "v2", Pool: "s2:/b"}); err == nil {
+		t.Fatalf("Volume on an export that is not configured should fail")
+	}
+}
+
+func TestMountOptions(t *testing.T) {
+	exports, err := parseExports(volume.DriverParams{"exports": "10.0.0.1:/a",
+		"vers": "3", "proto": "tcp", "rsize": "65536", "mount_options": "hard, noatime"})
+	if err != nil {
+		t.Fatalf("Failed to parse exports: %v", err)
+	}
+	e := exports[0]
+	if data := e.opts.data(e.server); data != "nolock,vers=3,proto=tcp,rsize=65536,hard,noatime,addr=10.0.0.1" {
+		t.Fatalf("Unexpected export mount data %q", data)
+	}
+
+	v := &api.Volume{Spec: &api.VolumeSpec{ConfigLabels: api.Labels{"team": "db"}}}
+	if opts, err := volumeOptions(e, v); err != nil || opts != nil {
+		t.Fatalf("Volume without NFS labels should be bind mounted: %v %v", opts, err)
+	}
+	v.Spec.ConfigLabels["nfs.vers"] = "4.1"
+	opts, err := volumeOptions(e, v)
+	if err != nil || opts == nil {
+		t.Fatalf("Failed to parse volume options: %v", err)
+	}
+	if data := opts.data(e.server); data != "vers=4.1,proto=tcp,rsize=65536,hard,noatime,addr=10.0.0.1" {
+		t.Fatalf("Unexpected volume mount data %q", data)
+	}
+
+	v.Spec.ConfigLabels["nfs.wsize"] = "big"
+	if _, err = volumeOptions(e, v); err == nil {
+		t.Fatalf("Invalid wsize should fail")
+	}
+	if _, err = parseExports(volume.DriverParams{"path": "/a", "proto": "sctp"}); err == nil {
+		t.Fatalf("Invalid proto should fail")
+	}
+}
+
 func TestAll(t *testing.T) {
 	err := os.MkdirAll(testPath, 0744)
 	if err != nil {
@@ -29,5 +107,5 @@ func TestAll(t *testing.T) {
 	ctx := test.NewContext(d)
 	ctx.Filesystem = "nfs"
 
-	test.RunShort(t, ctx)
+	test.Run(t, ctx)
 }
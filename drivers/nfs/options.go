@@ -0,0 +1,116 @@
+package nfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// NFS mount options. They are set for the exports with DriverParams and may
+// be overridden per volume with ConfigLabels prefixed with "nfs.", such as
+// "nfs.rsize". A volume with NFS options is mounted from the server on its
+// own instead of being bind mounted from the export.
+const (
+	// VersOpt NFS version, e.g. "3" or "4.1".
+	VersOpt = "vers"
+	// ProtoOpt transport, tcp or udp.
+	ProtoOpt = "proto"
+	// RsizeOpt maximum read size in bytes.
+	RsizeOpt = "rsize"
+	// WsizeOpt maximum write size in bytes.
+	WsizeOpt = "wsize"
+	// TimeoOpt time in tenths of a second before retrying a request.
+	TimeoOpt = "timeo"
+	// MountOptionsOpt comma separated options passed as is, e.g.
+	// "hard,noatime".
+	MountOptionsOpt = "mount_options"
+
+	labelPrefix = "nfs."
+)
+
+var numericOpts = map[string]bool{RsizeOpt: true, WsizeOpt: true, TimeoOpt: true}
+
+// mountOptions are the NFS options of an export or a volume.
+type mountOptions struct {
+	opts  map[string]string
+	extra []string
+}
+
+// parseMountOptions returns base overridden by the options in params under
+// prefix. It returns base itself if params set no options.
+func parseMountOptions(params map[string]string, prefix string, base *mountOptions) (*mountOptions, error) {
+	o := &mountOptions{opts: make(map[string]string)}
+	if base != nil {
+		for k, v := range base.opts {
+			o.opts[k] = v
+		}
+		o.extra = base.extra
+	}
+	set := false
+	for _, k := range []string{VersOpt, ProtoOpt, RsizeOpt, WsizeOpt, TimeoOpt} {
+		v, ok := params[prefix+k]
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if numericOpts[k] {
+			if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+				return nil, fmt.Errorf("Invalid NFS option %s%s=%q", prefix, k, v)
+			}
+		}
+		if k == ProtoOpt && v != "tcp" && v != "udp" {
+			return nil, fmt.Errorf("Invalid NFS option %s%s=%q, must be tcp or udp", prefix, k, v)
+		}
+		o.opts[k] = v
+		set = true
+	}
+	if v, ok := params[prefix+MountOptionsOpt]; ok {
+		o.extra = nil
+		for _, opt := range strings.Split(v, ",") {
+			if opt = strings.TrimSpace(opt); opt != "" {
+				o.extra = append(o.extra, opt)
+			}
+		}
+		set = true
+	}
+	if !set && base != nil {
+		return base, nil
+	}
+	return o, nil
+}
+
+// v4 returns true for NFS version 4 and later, which have no lock manager.
+func (o *mountOptions) v4() bool {
+	return strings.HasPrefix(o.opts[VersOpt], "4")
+}
+
+// data returns the mount data to mount from server.
+func (o *mountOptions) data(server string) string {
+	var opts []string
+	if !o.v4() {
+		opts = append(opts, "nolock")
+	}
+	for _, k := range []string{VersOpt, ProtoOpt, RsizeOpt, WsizeOpt, TimeoOpt} {
+		if v, ok := o.opts[k]; ok {
+			opts = append(opts, k+"="+v)
+		}
+	}
+	opts = append(opts, o.extra...)
+	opts = append(opts, "addr="+server)
+	return strings.Join(opts, ",")
+}
+
+// volumeOptions returns the mount options of v on e, nil if v has none of
+// its own and is bind mounted from the export.
+func volumeOptions(e *export, v *api.Volume) (*mountOptions, error) {
+	if v.Spec == nil {
+		return nil, nil
+	}
+	o, err := parseMountOptions(v.Spec.ConfigLabels, labelPrefix, e.opts)
+	if err != nil || o == e.opts {
+		return nil, err
+	}
+	return o, nil
+}
@@ -0,0 +1,144 @@
+package nfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	// SuperviseParam DriverParams key for the number of seconds between
+	// checks of the exports. Exports are not supervised if 0.
+	SuperviseParam = "supervise_interval"
+
+	defaultSuperviseInterval = 30 * time.Second
+	probeTimeout             = 10 * time.Second
+)
+
+func superviseInterval(params volume.DriverParams) (time.Duration, error) {
+	s, ok := params[SuperviseParam]
+	if !ok {
+		return defaultSuperviseInterval, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid %s %q", SuperviseParam, s)
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+// probe returns an error if the export is not mounted, its handle is stale
+// or the server does not answer.
+func (e *export) probe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	return volume.WithContext(ctx, func() error {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(e.mountPath, &st); err != nil {
+			return err
+		}
+		if e.server == "" {
+			// Bind mounts share the device of their parent.
+			return nil
+		}
+		var mnt, parent syscall.Stat_t
+		if err := syscall.Stat(e.mountPath, &mnt); err != nil {
+			return err
+		}
+		if err := syscall.Stat(filepath.Dir(e.mountPath), &parent); err != nil {
+			return err
+		}
+		if mnt.Dev == parent.Dev {
+			return fmt.Errorf("%s is not mounted", e.mountPath)
+		}
+		return nil
+	})
+}
+
+// supervise checks the exports every interval until stop is closed. An
+// export that is lost, because of a stale handle or a server disconnect, is
+// remounted and the bind mounts of its volumes are re-established. Volumes
+// are Degraded while their export is lost.
+func (d *driver) supervise(interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			for _, e := range d.exports {
+				d.check(e)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *driver) check(e *export) {
+	err := e.probe()
+	if err == nil {
+		return
+	}
+	logger.Warnf("NFS export %s lost: %v", e, err)
+	d.setStatus(e, api.Degraded)
+
+	// Detach the stale mount lazily, a hung server would block a regular
+	// unmount.
+	syscall.Unmount(e.mountPath, syscall.MNT_DETACH)
+	if err = e.mount(); err != nil {
+		logger.Warnf("Failed to remount NFS export %s: %v", e, err)
+		return
+	}
+	if err = e.probe(); err != nil {
+		logger.Warnf("NFS export %s remounted but unusable: %v", e, err)
+		return
+	}
+	logger.Infof("NFS export %s remounted at %s", e, e.mountPath)
+	d.setStatus(e, api.Up)
+}
+
+// setStatus sets the status of the volumes on e. Bind mounts of volumes are
+// re-established when they come back Up.
+func (d *driver) setStatus(e *export, status api.VolumeStatus) {
+	vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		logger.Warnf("Failed to enumerate the volumes of NFS export %s: %v", e, err)
+		return
+	}
+	for i := range vols {
+		v := &vols[i]
+		if ve, err := d.exportOf(v); err != nil || ve != e {
+			continue
+		}
+		if status == api.Up && v.AttachPath != "" {
+			if err := remount(e, v, volume.LayerMountOptions(d, v.ID)); err != nil {
+				logger.Warnf("Failed to remount volume %v at %s: %v", v.ID, v.AttachPath, err)
+				continue
+			}
+		}
+		if v.Status == status {
+			continue
+		}
+		v.Status = status
+		if err := d.UpdateVol(v); err != nil {
+			logger.Warnf("Failed to set the status of volume %v: %v", v.ID, err)
+		}
+	}
+}
+
+// remount replaces the stale mount of v at its AttachPath, with the options
+// of the layers of the driver.
+func remount(e *export, v *api.Volume, layerOpts []string) error {
+	syscall.Unmount(v.AttachPath, syscall.MNT_DETACH)
+	if err := os.MkdirAll(v.AttachPath, 0755); err != nil {
+		return err
+	}
+	return mountVolume(e, v, v.AttachPath, layerOpts)
+}
@@ -19,7 +19,8 @@ type driver struct {
 
 // Portworx natively implements the openstorage.org API specification, so
 // we can directly point the VolumeDriver to the PWX API server.
-func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
 	url, ok := params[config.UrlKey]
 	if !ok {
 		url = DefaultUrl
@@ -28,12 +29,12 @@ func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
 	if !ok {
 		version = DefaultVersion
 	}
-	c, err := client.NewClient(url, version)
+	cl, err := client.NewClient(url, version)
 	if err != nil {
 		return nil, err
 	}
 
-	return &driver{VolumeDriver: c.VolumeDriver()}, nil
+	return &driver{VolumeDriver: cl.VolumeDriver()}, nil
 }
 
 func (d *driver) String() string {
@@ -0,0 +1,303 @@
+// Package s3 is an Object driver backed by Amazon S3 or an S3 compatible
+// store such as minio. Each volume is a bucket, objects are read and written
+// through the volume.ObjectDriver interface or with presigned URLs.
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/pkg/s3sign"
+	"github.com/libopenstorage/openstorage/secrets"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	Name = "s3"
+	Type = volume.Object
+
+	// EndpointParam URL of the S3 service, e.g. http://minio:9000.
+	EndpointParam = "endpoint"
+	// RegionParam region requests are signed for.
+	RegionParam = "region"
+	// AccessKeyParam access key ID, defaults to $AWS_ACCESS_KEY_ID.
+	AccessKeyParam = "access_key"
+	// SecretKeyParam secret access key, defaults to $AWS_SECRET_ACCESS_KEY.
+	// Set "secret_key_secret" to a secret reference instead to keep it out
+	// of the driver params.
+	SecretKeyParam = "secret_key"
+
+	defaultEndpoint = "https://s3.amazonaws.com"
+	defaultRegion   = "us-east-1"
+
+	// maxPresignExpiry longest validity of a presigned URL allowed by S3.
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
+// bucketName matches valid DNS compatible bucket names.
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+type driver struct {
+	*volume.DefaultBlockDriver
+	*volume.DefaultEnumerator
+	volume.SnapshotNotSupported
+	endpoint *url.URL
+	signer   *s3sign.Signer
+	client   *http.Client
+}
+
+// Init connects to the S3 endpoint in params.
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
+	endpoint := params[EndpointParam]
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Invalid S3 endpoint %q", endpoint)
+	}
+	region := params[RegionParam]
+	if region == "" {
+		region = defaultRegion
+	}
+	accessKey := params[AccessKeyParam]
+	if accessKey == "" {
+		accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	secretKey, err := secrets.Param(params, SecretKeyParam)
+	if err != nil {
+		return nil, err
+	}
+	if secretKey == "" {
+		secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.New("No S3 credentials provided")
+	}
+	logger.Infof("S3 driver initializing with %s in %s", u, region)
+
+	return &driver{
+		DefaultEnumerator: c.NewEnumerator(),
+		endpoint:          u,
+		signer:            &s3sign.Signer{AccessKey: accessKey, SecretKey: secretKey, Region: region},
+		client:            &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (d *driver) String() string {
+	return Name
+}
+
+func (d *driver) Type() volume.DriverType {
+	return Type
+}
+
+// Status diagnostic information
+func (d *driver) Status() api.DriverStatus {
+	return api.DriverStatus{
+		Driver:    Name,
+		Endpoints: []string{d.endpoint.String()},
+		Details:   [][2]string{{"Region", d.signer.Region}},
+	}
+}
+
+// HealthCheck verifies that the endpoint accepts the driver credentials by
+// listing the buckets.
+func (d *driver) HealthCheck() []api.HealthReason {
+	if err := d.send("GET", "", ""); err != nil {
+		return []api.HealthReason{{Check: "endpoint", State: api.HealthDown, Message: err.Error()}}
+	}
+	return nil
+}
+
+// newRequest builds a path style request for bucket and key, which works
+// with both S3 and minio.
+func (d *driver) newRequest(method, bucket, key string, body io.Reader) (*http.Request, error) {
+	u := *d.endpoint
+	u.Path = "/" + bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3sign.URIEncode(u.Path, false)
+	return http.NewRequest(method, u.String(), body)
+}
+
+// s3Error is the error document returned by S3.
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// do signs and sends r, returning an error for non 2xx responses.
+func (d *driver) do(r *http.Request, payload string) (*http.Response, error) {
+	d.signer.Sign(r, payload, time.Now())
+	resp, err := d.client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var e s3Error
+	b, _ := ioutil.ReadAll(resp.Body)
+	xml.Unmarshal(b, &e)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, volume.ErrEnoEnt
+	case e.Code != "":
+		return nil, fmt.Errorf("S3 %s %s failed: %s: %s", r.Method, r.URL.Path, e.Code, e.Message)
+	default:
+		return nil, fmt.Errorf("S3 %s %s failed: %s", r.Method, r.URL.Path, resp.Status)
+	}
+}
+
+func (d *driver) send(method, bucket, key string) error {
+	r, err := d.newRequest(method, bucket, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.do(r, s3sign.EmptySHA256)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (d *driver) CreateBucket(bucket string) error {
+	if !bucketName.MatchString(bucket) {
+		return fmt.Errorf("Invalid bucket name %q: %v", bucket, volume.ErrEinval)
+	}
+	return d.send("PUT", bucket, "")
+}
+
+func (d *driver) DeleteBucket(bucket string) error {
+	return d.send("DELETE", bucket, "")
+}
+
+func (d *driver) PutObject(bucket, key string, r io.Reader, size int64) error {
+	req, err := d.newRequest("PUT", bucket, key, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := d.do(req, s3sign.Unsigned)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (d *driver) GetObject(bucket, key string) (io.ReadCloser, error) {
+	r, err := d.newRequest("GET", bucket, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.do(r, s3sign.EmptySHA256)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (d *driver) DeleteObject(bucket, key string) error {
+	return d.send("DELETE", bucket, key)
+}
+
+func (d *driver) PresignedURL(method, bucket, key string, expiry time.Duration) (string, error) {
+	if method != "GET" && method != "PUT" {
+		return "", fmt.Errorf("Cannot presign %s requests: %v", method, volume.ErrEinval)
+	}
+	if expiry <= 0 || expiry > maxPresignExpiry {
+		return "", fmt.Errorf("Presigned URL expiry must be between 1s and %v: %v",
+			maxPresignExpiry, volume.ErrEinval)
+	}
+	r, err := d.newRequest(method, bucket, key, nil)
+	if err != nil {
+		return "", err
+	}
+	return d.signer.Presign(r, expiry, time.Now()), nil
+}
+
+// Create creates a bucket named after the locator, or with a generated name
+// if the locator name is not a valid bucket name. The bucket name is the
+// volume ID.
+func (d *driver) Create(locator api.VolumeLocator,
+	opt *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+	bucket := strings.ToLower(locator.Name)
+	if !bucketName.MatchString(bucket) {
+		bucket = "osd-" + strings.TrimSuffix(uuid.New(), "\n")
+	}
+	if err := d.CreateBucket(bucket); err != nil {
+		return api.BadVolumeID, err
+	}
+	v := &api.Volume{
+		ID:         api.VolumeID(bucket),
+		Locator:    locator,
+		Ctime:      time.Now(),
+		Spec:       spec,
+		LastScan:   time.Now(),
+		State:      api.VolumeAvailable,
+		DevicePath: d.endpoint.String() + "/" + bucket,
+	}
+	if err := d.CreateVol(v); err != nil {
+		d.DeleteBucket(bucket)
+		return api.BadVolumeID, err
+	}
+	return v.ID, nil
+}
+
+// Delete deletes the bucket of a volume, which must be empty.
+func (d *driver) Delete(volumeID api.VolumeID) error {
+	if _, err := d.GetVol(volumeID); err != nil {
+		return err
+	}
+	if err := d.DeleteBucket(string(volumeID)); err != nil && err != volume.ErrEnoEnt {
+		return err
+	}
+	return d.DeleteVol(volumeID)
+}
+
+// Mount is not supported, objects are accessed with the ObjectDriver
+// interface.
+func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
+	return volume.ErrNotSupported
+}
+
+func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	return volume.ErrNotSupported
+}
+
+func (d *driver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	return api.VolumeAlerts{}, volume.ErrNotSupported
+}
+
+func (d *driver) Shutdown() {
+	logger.Infof("%s Shutting down", Name)
+}
+
+func init() {
+	// Register ourselves as an openstorage volume driver.
+	volume.Register(Name, Init)
+	secrets.RegisterParam(SecretKeyParam)
+}
@@ -40,6 +40,11 @@ func NewContext(d volume.VolumeDriver) *Context {
 }
 
 func RunShort(t *testing.T, ctx *Context) {
+	runShort(t, ctx)
+	runEnd(t, ctx)
+}
+
+func runShort(t *testing.T, ctx *Context) {
 	create(t, ctx)
 	inspect(t, ctx)
 	enumerate(t, ctx)
@@ -50,11 +55,10 @@ func RunShort(t *testing.T, ctx *Context) {
 	unmount(t, ctx)
 	detach(t, ctx)
 	delete(t, ctx)
-	runEnd(t, ctx)
 }
 
 func Run(t *testing.T, ctx *Context) {
-	RunShort(t, ctx)
+	runShort(t, ctx)
 	RunSnap(t, ctx)
 	runEnd(t, ctx)
 }
@@ -132,13 +136,13 @@ func format(t *testing.T, ctx *Context) {
 
 func attach(t *testing.T, ctx *Context) {
 	fmt.Println("attach")
-	p, err := ctx.Attach(ctx.volID)
+	p, err := ctx.Attach(ctx.volID, nil)
 	if err != nil {
 		assert.Equal(t, err, volume.ErrNotSupported, "Error on attach %v", err)
 	}
 	ctx.devicePath = p
 
-	p, err = ctx.Attach(ctx.volID)
+	p, err = ctx.Attach(ctx.volID, nil)
 	if err == nil {
 		assert.Equal(t, p, ctx.devicePath, "Multiple calls to attach if not errored should return the same path")
 	}
@@ -223,7 +227,7 @@ func snap(t *testing.T, ctx *Context) {
 		create(t, ctx)
 	}
 	assert.NotEqual(t, ctx.volID, api.BadVolumeID, "invalid volume ID")
-	id, err := ctx.Snapshot(ctx.volID, api.Labels{"oh": "snap"})
+	id, err := ctx.Snapshot(ctx.volID, api.Labels{"oh": "snap"}, false)
 	assert.NoError(t, err, "Failed in creating a snapshot")
 	ctx.snapID = id
 }
@@ -0,0 +1,720 @@
+// Package vfile provisions block volumes backed by image files on any
+// mounted filesystem, such as an NFS or CIFS mount. Raw images are attached
+// with loop devices, qcow2 and vmdk images with qemu-nbd.
+package vfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+	"github.com/libopenstorage/openstorage/pkg/mkfs"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	Name = "vfile"
+	Type = volume.Block
+	// PathParam directory the images are kept in, typically the mount point
+	// of a file driver or of an NFS export shared by the nodes.
+	PathParam = "path"
+	// ImageFormatParam format of new images, raw (the default), qcow2 or
+	// vmdk. Existing images keep their format.
+	ImageFormatParam = "image_format"
+	// AttachParam how raw images are attached, loop (the default) or nbd.
+	// Other formats are always attached with qemu-nbd.
+	AttachParam = "attach"
+
+	snapDir = "snaps"
+)
+
+// logger logs with the level of the driver.
+var logger = logging.For(Name)
+
+// Image formats.
+const (
+	FormatRaw   = "raw"
+	FormatQcow2 = "qcow2"
+	FormatVmdk  = "vmdk"
+)
+
+// Attach methods.
+const (
+	AttachLoop = "loop"
+	AttachNBD  = "nbd"
+)
+
+// extensions of the image files by format. The format of an image is
+// recognized by its extension.
+var extensions = map[string]string{
+	FormatRaw:   ".img",
+	FormatQcow2: ".qcow2",
+	FormatVmdk:  ".vmdk",
+}
+
+// sysBlock is where the kernel lists block devices.
+var sysBlock = "/sys/block"
+
+type driver struct {
+	*volume.DefaultEnumerator
+	// lock serializes the allocation of nbd devices.
+	lock   sync.Mutex
+	root   string
+	format string
+	attach string
+}
+
+// Init keeps images in the directory set by PathParam.
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	params := c.Params
+	root, ok := params[PathParam]
+	if !ok {
+		return nil, fmt.Errorf("Image directory should be specified with key %q", PathParam)
+	}
+	d := &driver{
+		DefaultEnumerator: c.NewEnumerator(),
+		root:              root,
+		format:            FormatRaw,
+		attach:            AttachLoop,
+	}
+	if f, ok := params[ImageFormatParam]; ok {
+		if _, ok := extensions[f]; !ok {
+			return nil, fmt.Errorf("Invalid %s %q, expected raw, qcow2 or vmdk", ImageFormatParam, f)
+		}
+		d.format = f
+	}
+	if a, ok := params[AttachParam]; ok {
+		if a != AttachLoop && a != AttachNBD {
+			return nil, fmt.Errorf("Invalid %s %q, expected loop or nbd", AttachParam, a)
+		}
+		d.attach = a
+	}
+	if err := os.MkdirAll(path.Join(root, snapDir), 0744); err != nil {
+		return nil, err
+	}
+	if d.format != FormatRaw || d.attach == AttachNBD {
+		if _, err := exec.LookPath("qemu-nbd"); err != nil {
+			return nil, fmt.Errorf("%s images require qemu-nbd: %v", d.format, err)
+		}
+		if _, err := run("modprobe", "nbd", "max_part=0"); err != nil {
+			logger.Warnf("%s: %v", Name, err)
+		}
+	}
+	logger.Infof("%s: %s images in %s", Name, d.format, root)
+	return d, nil
+}
+
+func run(cmd string, args ...string) (string, error) {
+	out, err := exec.Command(cmd, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %v: %s",
+			cmd, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// image returns the image file of id in dir and its format.
+func (d *driver) image(dir string, id string) (string, string, error) {
+	for f, ext := range extensions {
+		p := path.Join(dir, id+ext)
+		if _, err := os.Stat(p); err == nil {
+			return p, f, nil
+		}
+	}
+	return "", "", fmt.Errorf("No image of %s in %s", id, dir)
+}
+
+func (d *driver) volImage(volumeID api.VolumeID) (string, string, error) {
+	return d.image(d.root, string(volumeID))
+}
+
+func (d *driver) snapImage(snapID api.SnapID) (string, string, error) {
+	return d.image(path.Join(d.root, snapDir), string(snapID))
+}
+
+// Fingerprint hashes the image of a volume. Images are hashed whole, base is
+// ignored.
+func (d *driver) Fingerprint(volumeID api.VolumeID, base api.SnapID) (*api.Fingerprint, error) {
+	if _, err := d.GetVol(volumeID); err != nil {
+		return nil, err
+	}
+	img, _, err := d.volImage(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	return volume.FingerprintFile(volumeID, img)
+}
+
+// copyImage copies an image, sharing its blocks if the filesystem supports
+// it and keeping it sparse otherwise.
+func copyImage(from, to string) error {
+	_, err := run("cp", "--reflink=auto", "--sparse=always", from, to)
+	return err
+}
+
+func (d *driver) String() string {
+	return Name
+}
+
+func (d *driver) Type() volume.DriverType {
+	return Type
+}
+
+// Status diagnostic information
+func (d *driver) Status() api.DriverStatus {
+	status := api.DriverStatus{
+		Driver: Name,
+		Details: [][2]string{
+			{"Path", d.root},
+			{"Image format", d.format},
+			{"Attach", d.attach},
+		},
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(d.root, &st); err == nil {
+		status.Capacity = st.Blocks * uint64(st.Bsize)
+		status.Free = st.Bavail * uint64(st.Bsize)
+	}
+	return status
+}
+
+// HealthCheck verifies that the image directory is writable.
+func (d *driver) HealthCheck() []api.HealthReason {
+	return volume.CheckDir(d.root, false, api.HealthDown)
+}
+
+// Create creates a sparse image of spec.Size bytes, or a copy of the image
+// of options.CreateFromSnap.
+func (d *driver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+
+	volumeID := strings.TrimSuffix(uuid.New(), "\n")
+	var img string
+	if options != nil && options.CreateFromSnap != "" {
+		snap, format, err := d.snapImage(options.CreateFromSnap)
+		if err != nil {
+			return api.BadVolumeID, err
+		}
+		img = path.Join(d.root, volumeID+extensions[format])
+		if err = copyImage(snap, img); err != nil {
+			return api.BadVolumeID, err
+		}
+	} else {
+		if spec.Size == 0 {
+			return api.BadVolumeID, fmt.Errorf("Volume size must be greater than 0")
+		}
+		img = path.Join(d.root, volumeID+extensions[d.format])
+		if err := d.createImage(img, spec.Size); err != nil {
+			return api.BadVolumeID, err
+		}
+	}
+
+	v := &api.Volume{
+		ID:       api.VolumeID(volumeID),
+		Locator:  locator,
+		Ctime:    time.Now(),
+		Spec:     spec,
+		LastScan: time.Now(),
+		Format:   api.FsNone,
+		State:    api.VolumeAvailable,
+	}
+	if options != nil && options.CreateFromSnap != "" {
+		v.Parent = options.CreateFromSnap
+		if snap, err := d.GetSnap(options.CreateFromSnap); err == nil {
+			if src, err := d.GetVol(snap.VolumeID); err == nil {
+				v.Format = src.Format
+			}
+		}
+	}
+	if err := d.CreateVol(v); err != nil {
+		os.Remove(img)
+		return api.BadVolumeID, err
+	}
+	return v.ID, nil
+}
+
+func (d *driver) createImage(img string, size uint64) error {
+	if d.format != FormatRaw {
+		_, err := run("qemu-img", "create", "-f", d.format, img, strconv.FormatUint(size, 10))
+		return err
+	}
+	f, err := os.OpenFile(img, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = f.Truncate(int64(size)); err != nil {
+		os.Remove(img)
+		return err
+	}
+	return nil
+}
+
+// Delete removes the image of a detached volume.
+func (d *driver) Delete(volumeID api.VolumeID) error {
+	if err := d.CanDelete(volumeID); err != nil {
+		return err
+	}
+	img, _, err := d.volImage(volumeID)
+	if err == nil {
+		if err = os.Remove(img); err != nil {
+			return err
+		}
+	}
+	return d.DeleteVol(volumeID)
+}
+
+// Attach attaches the image with a loop or nbd device. Images on a shared
+// filesystem can be attached on any node, but on one node at a time.
+func (d *driver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	if options != nil && (options.Shared || options.Reservation != api.ReservationNone) {
+		return "", volume.ErrNotSupported
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return "", err
+	}
+	node := volume.NodeID()
+	if err = volume.CheckAttach(v, node, options); err != nil {
+		return "", err
+	}
+	readOnly := options != nil && options.ReadOnly
+	if v.DevicePath == "" || !attached(v.DevicePath) {
+		img, format, err := d.volImage(volumeID)
+		if err != nil {
+			return "", err
+		}
+		if format == FormatRaw && d.attach == AttachLoop {
+			v.DevicePath, err = attachLoop(img, readOnly)
+		} else {
+			v.DevicePath, err = d.attachNBD(img, format, readOnly)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	volume.RecordAttach(v, node, options)
+	return v.DevicePath, d.UpdateVol(v)
+}
+
+func attachLoop(img string, readOnly bool) (string, error) {
+	args := []string{"--find", "--show"}
+	if readOnly {
+		args = append(args, "--read-only")
+	}
+	out, err := run("losetup", append(args, img)...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (d *driver) attachNBD(img, format string, readOnly bool) (string, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	dev, err := freeNBD()
+	if err != nil {
+		return "", err
+	}
+	args := []string{"--connect=" + dev, "--format=" + format, "--cache=none"}
+	if readOnly {
+		args = append(args, "--read-only")
+	}
+	if _, err = run("qemu-nbd", append(args, img)...); err != nil {
+		return "", err
+	}
+	return dev, nil
+}
+
+// freeNBD returns the first nbd device that is not connected.
+func freeNBD() (string, error) {
+	devs, err := filepath.Glob(path.Join(sysBlock, "nbd*"))
+	if err != nil {
+		return "", err
+	}
+	for _, dev := range devs {
+		if _, err := os.Stat(path.Join(dev, "pid")); os.IsNotExist(err) {
+			return "/dev/" + path.Base(dev), nil
+		}
+	}
+	return "", fmt.Errorf("No free nbd device, is the nbd module loaded?")
+}
+
+// attached returns whether device is still backed by an image.
+func attached(device string) bool {
+	name := path.Base(device)
+	if strings.HasPrefix(name, "nbd") {
+		_, err := os.Stat(path.Join(sysBlock, name, "pid"))
+		return err == nil
+	}
+	b, err := ioutil.ReadFile(path.Join(sysBlock, name, "loop", "backing_file"))
+	return err == nil && len(strings.TrimSpace(string(b))) > 0
+}
+
+func detachDevice(device string) error {
+	if strings.HasPrefix(path.Base(device), "nbd") {
+		_, err := run("qemu-nbd", "--disconnect", device)
+		return err
+	}
+	_, err := run("losetup", "--detach", device)
+	return err
+}
+
+// Detach releases the loop or nbd device of the volume.
+func (d *driver) Detach(volumeID api.VolumeID) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath != "" && attached(v.DevicePath) {
+		if err = detachDevice(v.DevicePath); err != nil {
+			return err
+		}
+	}
+	volume.RecordDetach(v, volume.NodeID())
+	v.DevicePath = ""
+	return d.UpdateVol(v)
+}
+
+// ForceDetach releases the device of a volume that may still be mounted.
+// Loop devices are released once they are closed, nbd devices are
+// disconnected at once.
+func (d *driver) ForceDetach(volumeID api.VolumeID, options *api.DetachOptions) error {
+	if err := volume.Release(d, volumeID, options); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath != "" {
+		if err = volume.UnmountPath(v.AttachPath, options); err != nil {
+			return err
+		}
+		v.AttachPath = ""
+	}
+	if v.DevicePath != "" && attached(v.DevicePath) {
+		if options.Kill {
+			if err = volume.KillUsers(v.DevicePath); err != nil {
+				return err
+			}
+		}
+		if err = detachDevice(v.DevicePath); err != nil {
+			d.UpdateVol(v)
+			return err
+		}
+	}
+	volume.RecordDetach(v, volume.NodeID())
+	v.DevicePath = ""
+	return d.UpdateVol(v)
+}
+
+// Format creates the filesystem of the volume spec on an attached volume.
+func (d *driver) Format(volumeID api.VolumeID) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	if v.Spec.Format == "" || v.Spec.Format == api.FsNone {
+		return fmt.Errorf("Volume %v has no filesystem to format: %v", volumeID, volume.ErrEinval)
+	}
+	device := volume.TopDevice(d, volumeID, v.DevicePath)
+	if err = mkfs.Format(device, v.Spec); err != nil {
+		return err
+	}
+	v.Format = v.Spec.Format
+	return d.UpdateVol(v)
+}
+
+// Mount mounts the filesystem of an attached volume at mountpath, or binds
+// the device of a raw volume there.
+func (d *driver) Mount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	format, err := fs.MountFormat(v)
+	if err != nil {
+		return err
+	}
+	device := volume.TopDevice(d, volumeID, v.DevicePath)
+	if err = fs.MountDevice(device, mountpath, format); err != nil {
+		return fmt.Errorf("Failed to mount %v at %v: %v", device, mountpath, err)
+	}
+	v.AttachPath = mountpath
+	return d.UpdateVol(v)
+}
+
+// Unmount unmounts the filesystem of a volume.
+func (d *driver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath == "" {
+		return fmt.Errorf("Device %v not mounted", volumeID)
+	}
+	if err = syscall.Unmount(v.AttachPath, 0); err != nil {
+		return err
+	}
+	v.AttachPath = ""
+	return d.UpdateVol(v)
+}
+
+// ForceUnmount unmounts the filesystem of a volume that may be busy.
+func (d *driver) ForceUnmount(volumeID api.VolumeID, mountpath string, options *api.DetachOptions) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath == "" {
+		return fmt.Errorf("Device %v not mounted", volumeID)
+	}
+	if err = volume.UnmountPath(v.AttachPath, options); err != nil {
+		return err
+	}
+	v.AttachPath = ""
+	return d.UpdateVol(v)
+}
+
+// Snapshot copies the image of the volume. IO to an attached volume should
+// be quiesced, the copy is not atomic.
+func (d *driver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	if _, err := d.GetVol(volumeID); err != nil {
+		return api.BadSnapID, err
+	}
+	img, format, err := d.volImage(volumeID)
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	snapID := strings.TrimSuffix(uuid.New(), "\n")
+	snapImg := path.Join(d.root, snapDir, snapID+extensions[format])
+	syscall.Sync()
+	if err = copyImage(img, snapImg); err != nil {
+		return api.BadSnapID, err
+	}
+	snap := &api.VolumeSnap{
+		ID:         api.SnapID(snapID),
+		VolumeID:   volumeID,
+		SnapLabels: labels,
+		Writable:   writable,
+		Ctime:      time.Now(),
+	}
+	if err = d.CreateSnap(snap); err != nil {
+		os.Remove(snapImg)
+		return api.BadSnapID, err
+	}
+	return snap.ID, nil
+}
+
+// SnapDelete removes the image of a snapshot and its record.
+func (d *driver) SnapDelete(snapID api.SnapID) error {
+	if _, err := d.GetSnap(snapID); err != nil {
+		return err
+	}
+	if img, _, err := d.snapImage(snapID); err == nil {
+		if err = os.Remove(img); err != nil {
+			return err
+		}
+	}
+	return d.DeleteSnap(snapID)
+}
+
+// Resize grows the image of a volume. Raw images attached with loop devices
+// are resized online, other images must be detached.
+func (d *driver) Resize(volumeID api.VolumeID, size uint64) error {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if size < v.Spec.Size {
+		return fmt.Errorf("Cannot shrink volume %v: %v", volumeID, volume.ErrEinval)
+	}
+	img, format, err := d.volImage(volumeID)
+	if err != nil {
+		return err
+	}
+	online := v.DevicePath != "" && attached(v.DevicePath)
+	if format != FormatRaw {
+		if online {
+			return volume.ErrVolAttached
+		}
+		if _, err = run("qemu-img", "resize", "-f", format, img, strconv.FormatUint(size, 10)); err != nil {
+			return err
+		}
+	} else {
+		if online && strings.HasPrefix(path.Base(v.DevicePath), "nbd") {
+			return volume.ErrVolAttached
+		}
+		if err = os.Truncate(img, int64(size)); err != nil {
+			return err
+		}
+		if online {
+			if _, err = run("losetup", "--set-capacity", v.DevicePath); err != nil {
+				return err
+			}
+		}
+	}
+	v.Spec.Size = size
+	return d.UpdateVol(v)
+}
+
+// UsedSize returns the number of bytes allocated to the image of a volume.
+func (d *driver) UsedSize(volumeID api.VolumeID) (uint64, error) {
+	img, _, err := d.volImage(volumeID)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(img)
+	if err != nil {
+		return 0, err
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Blocks) * 512, nil
+	}
+	return uint64(fi.Size()), nil
+}
+
+// Scrub checks the filesystem of a volume that is attached on this node but
+// not mounted.
+func (d *driver) Scrub(volumeID api.VolumeID) ([]string, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	if v.DevicePath == "" || !attached(v.DevicePath) {
+		return nil, volume.ErrVolDetached
+	}
+	if v.Format == "" || v.Format == api.FsNone {
+		return nil, nil
+	}
+	device := volume.TopDevice(d, volumeID, v.DevicePath)
+	if v.AttachPath != "" {
+		return nil, volume.ErrVolAttached
+	}
+	if mountpath, err := fs.Mountpoint(device); err != nil || mountpath != "" {
+		return nil, volume.ErrVolAttached
+	}
+	return fs.Check(v.Format, device)
+}
+
+// imageID returns the volume or snapshot ID of an image file name, empty if
+// name is not an image.
+func imageID(name string) string {
+	for _, ext := range extensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return ""
+}
+
+// referenced returns the IDs of the volumes, including those in the trash,
+// and of the snapshots.
+func (d *driver) referenced() (map[string]bool, error) {
+	vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := d.EnumerateDeleted()
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := d.SnapEnumerate(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]bool)
+	for _, v := range append(vols, deleted...) {
+		refs[string(v.ID)] = true
+	}
+	for _, snap := range snaps {
+		refs[string(snap.ID)] = true
+	}
+	return refs, nil
+}
+
+// Orphans returns the images of volumes and snapshots that do not exist.
+// Files that are not images are left alone.
+func (d *driver) Orphans() ([]api.Orphan, error) {
+	refs, err := d.referenced()
+	if err != nil {
+		return nil, err
+	}
+	keep := func(name string) bool {
+		id := imageID(name)
+		return id == "" || refs[id]
+	}
+	orphans, err := volume.OrphansIn(d.root, d.root, keep)
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := volume.OrphansIn(path.Join(d.root, snapDir), d.root, keep)
+	if err != nil {
+		return nil, err
+	}
+	return append(orphans, snaps...), nil
+}
+
+// ReclaimOrphan removes an orphaned image.
+func (d *driver) ReclaimOrphan(o api.Orphan) error {
+	dir, name := path.Split(o.ID)
+	dir = path.Clean(dir)
+	id := imageID(name)
+	if id == "" || (dir != path.Clean(d.root) && dir != path.Join(d.root, snapDir)) {
+		return volume.ErrEinval
+	}
+	refs, err := d.referenced()
+	if err != nil {
+		return err
+	}
+	if refs[id] {
+		return volume.ErrEinval
+	}
+	return os.Remove(o.ID)
+}
+
+// Stats are not collected for image files.
+func (d *driver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	return api.VolumeStats{}, volume.ErrNotSupported
+}
+
+// Alerts on this volume.
+func (d *driver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	return api.VolumeAlerts{}, nil
+}
+
+// Shutdown and cleanup.
+func (d *driver) Shutdown() {
+	logger.Infof("%s Shutting down", Name)
+}
+
+func init() {
+	volume.Register(Name, Init)
+	volume.RegisterConstraints(Name, volume.Constraints{
+		MinSize: 1,
+		Formats: []api.Filesystem{api.FsNone, api.FsExt4, api.FsXfs, api.FsBtrfs},
+		// Compressed volumes are attached through VDO.
+		Compressions: []api.Compression{api.CompressionLz4},
+	})
+}
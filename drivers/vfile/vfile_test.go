@@ -0,0 +1,142 @@
+package vfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/portworx/kvdb/mem"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+func TestNBD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfile")
+	assert.NoError(t, err, "Failed to create sysfs")
+	defer os.RemoveAll(dir)
+	sysBlock = dir
+
+	_, err = freeNBD()
+	assert.Error(t, err, "No nbd device should be found")
+
+	for _, dev := range []string{"nbd0", "nbd1"} {
+		assert.NoError(t, os.MkdirAll(path.Join(dir, dev), 0755), "Failed to create device")
+	}
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "nbd0", "pid"), []byte("42"), 0644),
+		"Failed to connect device")
+
+	dev, err := freeNBD()
+	assert.NoError(t, err, "Failed to find a free nbd device")
+	assert.Equal(t, "/dev/nbd1", dev, "Connected device should be skipped")
+	assert.True(t, attached("/dev/nbd0"), "Connected device should be attached")
+	assert.False(t, attached("/dev/nbd1"), "Free device should not be attached")
+
+	assert.NoError(t, os.MkdirAll(path.Join(dir, "loop0", "loop"), 0755), "Failed to create device")
+	assert.False(t, attached("/dev/loop0"), "Loop device without backing file should not be attached")
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "loop0", "loop", "backing_file"),
+		[]byte("/images/vol.img\n"), 0644), "Failed to set up loop device")
+	assert.True(t, attached("/dev/loop0"), "Loop device with backing file should be attached")
+}
+
+func TestImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfile")
+	assert.NoError(t, err, "Failed to create image directory")
+	defer os.RemoveAll(dir)
+	d := &driver{root: dir, format: FormatRaw}
+
+	_, _, err = d.volImage("vol")
+	assert.Error(t, err, "Missing image should not be found")
+
+	img := path.Join(dir, "vol.img")
+	assert.NoError(t, d.createImage(img, 1<<20), "Failed to create image")
+	fi, err := os.Stat(img)
+	assert.NoError(t, err, "Failed to stat image")
+	assert.Equal(t, int64(1<<20), fi.Size(), "Unexpected image size")
+	assert.Error(t, d.createImage(img, 1<<20), "Existing image should not be overwritten")
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "other.qcow2"), nil, 0600), "Failed to create image")
+	p, format, err := d.volImage("other")
+	assert.NoError(t, err, "Failed to find image")
+	assert.Equal(t, path.Join(dir, "other.qcow2"), p, "Unexpected image")
+	assert.Equal(t, FormatQcow2, format, "Format should follow the extension")
+}
+
+func TestOrphans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfile")
+	assert.NoError(t, err, "Failed to create image directory")
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(path.Join(dir, snapDir), 0755))
+	kv, err := kvdb.New(mem.Name, "vfile_test", []string{}, nil)
+	assert.NoError(t, err, "Failed to initialize KVDB")
+	d := &driver{
+		DefaultEnumerator: volume.NewDefaultEnumerator(Name, kv),
+		root:              dir,
+		format:            FormatRaw,
+	}
+	assert.NoError(t, d.CreateVol(&api.Volume{ID: "kept", Spec: &api.VolumeSpec{}}))
+
+	for _, f := range []string{"kept.img", "lost.img", "notes.txt", "snaps/lostsnap.qcow2"} {
+		assert.NoError(t, ioutil.WriteFile(path.Join(dir, f), nil, 0600))
+	}
+	orphans, err := d.Orphans()
+	assert.NoError(t, err)
+	if assert.Len(t, orphans, 2) {
+		assert.Equal(t, path.Join(dir, "lost.img"), orphans[0].ID)
+		assert.Equal(t, path.Join(dir, snapDir, "lostsnap.qcow2"), orphans[1].ID)
+	}
+
+	assert.Equal(t, volume.ErrEinval, d.ReclaimOrphan(api.Orphan{ID: path.Join(dir, "kept.img")}),
+		"Image of a volume reclaimed")
+	assert.Equal(t, volume.ErrEinval, d.ReclaimOrphan(api.Orphan{ID: "/etc/lost.img"}),
+		"File outside of the image directory reclaimed")
+	assert.NoError(t, d.ReclaimOrphan(orphans[0]))
+	_, err = os.Stat(orphans[0].ID)
+	assert.True(t, os.IsNotExist(err), "Orphan not removed")
+}
+
+func TestGraph(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfile")
+	assert.NoError(t, err, "Failed to create image directory")
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(path.Join(dir, snapDir), 0755))
+	kv, err := kvdb.New(mem.Name, "vfile_graph_test", []string{}, nil)
+	assert.NoError(t, err, "Failed to initialize KVDB")
+	d := &driver{
+		DefaultEnumerator: volume.NewDefaultEnumerator(Name, kv),
+		root:              dir,
+		format:            FormatRaw,
+	}
+	volume.SetBackups(func(volumeID api.VolumeID) ([]api.CloudSnap, error) {
+		return []api.CloudSnap{{ID: "backup", VolumeID: volumeID}}, nil
+	})
+	defer volume.SetBackups(nil)
+
+	src, err := d.Create(api.VolumeLocator{Name: "src"}, nil, &api.VolumeSpec{Size: 1 << 20})
+	assert.NoError(t, err, "Failed to create volume")
+	snap, err := d.Snapshot(src, nil, false)
+	assert.NoError(t, err, "Failed to snapshot volume")
+	clone, err := d.Create(api.VolumeLocator{Name: "clone"},
+		&api.CreateOptions{CreateFromSnap: snap}, &api.VolumeSpec{Size: 1 << 20})
+	assert.NoError(t, err, "Failed to clone snapshot")
+
+	vols, err := d.Inspect([]api.VolumeID{clone})
+	assert.NoError(t, err)
+	if assert.Len(t, vols, 1) {
+		assert.Equal(t, snap, vols[0].Parent, "Clone should record its snapshot")
+	}
+
+	g, err := volume.Graph(d, src)
+	assert.NoError(t, err, "Failed to build graph")
+	if assert.Len(t, g.Snaps, 1) && assert.Len(t, g.Snaps[0].Clones, 1) {
+		assert.Equal(t, clone, g.Snaps[0].Clones[0].Volume.ID, "Clone missing from graph")
+		assert.Len(t, g.Snaps[0].Clones[0].Backups, 1, "Backups of the clone missing")
+	}
+	if assert.Len(t, g.Backups, 1) {
+		assert.Equal(t, src, g.Backups[0].VolumeID)
+	}
+	assert.Empty(t, g.Exports, "Volume is not exported")
+}
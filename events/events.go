@@ -0,0 +1,95 @@
+// Package events is a publish/subscribe bus of cluster and volume events.
+// Events are delivered to the subscribers of the node they are published on
+// and, once Share is called, to the subscribers of the other nodes through
+// the KVDB.
+package events
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// subscriberBuffer events are queued for a subscriber before further events
+// are dropped.
+const subscriberBuffer = 128
+
+// Subscription receives the events it subscribed to on C until it is
+// closed. Events are dropped if the subscriber does not keep up.
+type Subscription struct {
+	C <-chan api.Event
+
+	c     chan api.Event
+	types map[api.EventType]bool
+}
+
+var (
+	lock   sync.RWMutex
+	subs   = make(map[*Subscription]bool)
+	shared *bridge
+)
+
+// Subscribe returns a subscription to events of types, or to all events if
+// no types are specified.
+func Subscribe(types ...api.EventType) *Subscription {
+	c := make(chan api.Event, subscriberBuffer)
+	s := &Subscription{C: c, c: c}
+	if len(types) > 0 {
+		s.types = make(map[api.EventType]bool)
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	subs[s] = true
+	return s
+}
+
+// Close ends the subscription and closes C.
+func (s *Subscription) Close() {
+	lock.Lock()
+	defer lock.Unlock()
+	if subs[s] {
+		delete(subs, s)
+		close(s.c)
+	}
+}
+
+// Publish delivers e to the subscribers of this node and, if events are
+// shared, of the other nodes. Time defaults to now and Node to this node if
+// events are shared.
+func Publish(e api.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	lock.RLock()
+	b := shared
+	lock.RUnlock()
+	if b != nil && e.Node == "" {
+		e.Node = b.node
+	}
+	deliver(&e)
+	if b != nil {
+		b.write(&e)
+	}
+}
+
+// deliver sends e to the subscribers of this node.
+func deliver(e *api.Event) {
+	lock.RLock()
+	defer lock.RUnlock()
+	for s := range subs {
+		if s.types != nil && !s.types[e.Type] {
+			continue
+		}
+		select {
+		case s.c <- *e:
+		default:
+			log.Warnf("Dropping %s event, subscriber is not keeping up", e.Type)
+		}
+	}
+}
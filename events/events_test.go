@@ -0,0 +1,68 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/portworx/kvdb"
+	"github.com/portworx/kvdb/mem"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func receive(s *Subscription) (api.Event, bool) {
+	select {
+	case e, ok := <-s.C:
+		return e, ok
+	case <-time.After(time.Second):
+		return api.Event{}, false
+	}
+}
+
+func TestPublish(t *testing.T) {
+	all := Subscribe()
+	defer all.Close()
+	nodes := Subscribe(api.EventNodeUp, api.EventNodeDown)
+	defer nodes.Close()
+
+	Publish(api.Event{Type: api.EventVolumeCreated, VolumeID: "vol"})
+	Publish(api.Event{Type: api.EventNodeDown, Subject: "node"})
+
+	e, ok := receive(all)
+	assert.True(t, ok, "Subscriber should receive events")
+	assert.Equal(t, api.EventVolumeCreated, e.Type, "Events should be received in order")
+	assert.False(t, e.Time.IsZero(), "Event time should be set")
+	e, _ = receive(all)
+	assert.Equal(t, api.EventNodeDown, e.Type, "Events should be received in order")
+
+	e, _ = receive(nodes)
+	assert.Equal(t, api.EventNodeDown, e.Type, "Subscriber should only receive its types")
+
+	nodes.Close()
+	_, ok = <-nodes.C
+	assert.False(t, ok, "Closed subscription should be closed")
+}
+
+func TestShare(t *testing.T) {
+	kv, err := kvdb.New(mem.Name, "events_test", nil, nil)
+	assert.NoError(t, err, "Failed to create kvdb")
+	assert.NoError(t, Share(kv, "a", time.Minute), "Failed to share events")
+	defer func() { shared = nil }()
+
+	s := Subscribe()
+	defer s.Close()
+
+	Publish(api.Event{Type: api.EventVolumeAttached, VolumeID: "vol"})
+	e, _ := receive(s)
+	assert.Equal(t, api.MachineID("a"), e.Node, "Event should be published by this node")
+
+	other := &bridge{kv: kv, node: "b", ttl: time.Minute}
+	other.write(&api.Event{Type: api.EventVolumeDetached, Node: "b", Time: time.Now()})
+	e, ok := receive(s)
+	assert.True(t, ok, "Events of other nodes should be delivered")
+	assert.Equal(t, api.EventVolumeDetached, e.Type, "Events of other nodes should be delivered")
+
+	_, ok = receive(s)
+	assert.False(t, ok, "Own events should not be delivered twice")
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// DefaultTTL events shared through the KVDB are kept for.
+	DefaultTTL = time.Minute
+
+	keyBase = "events/"
+)
+
+// bridge shares events between nodes through the KVDB.
+type bridge struct {
+	kv   kvdb.Kvdb
+	node api.MachineID
+	ttl  time.Duration
+	mu   sync.Mutex
+	seq  uint64
+}
+
+// Share publishes the events of this node, node, to the other nodes through
+// kv and delivers theirs to the subscribers of this node. Events are kept in
+// kv for ttl, it should be long enough for all nodes to see them.
+func Share(kv kvdb.Kvdb, node api.MachineID, ttl time.Duration) error {
+	b := &bridge{kv: kv, node: node, ttl: ttl}
+	if err := kv.WatchTree(keyBase, 0, nil, b.watch); err != nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	shared = b
+	return nil
+}
+
+func (b *bridge) write(e *api.Event) {
+	b.mu.Lock()
+	b.seq++
+	seq := b.seq
+	b.mu.Unlock()
+	key := fmt.Sprintf("%s%020d-%s-%d", keyBase, e.Time.UnixNano(), b.node, seq)
+	if _, err := b.kv.Put(key, e, uint64(b.ttl/time.Second)); err != nil {
+		log.Warnf("Failed to share %s event: %v", e.Type, err)
+	}
+}
+
+// watch delivers the events written by other nodes.
+func (b *bridge) watch(prefix string, opaque interface{}, kvp *kvdb.KVPair, err error) error {
+	if err != nil {
+		log.Warnf("Stopped receiving events from other nodes: %v", err)
+		return err
+	}
+	if kvp == nil || kvp.Action == kvdb.KVDelete || kvp.Action == kvdb.KVExpire {
+		return nil
+	}
+	var e api.Event
+	if err := json.Unmarshal(kvp.Value, &e); err != nil {
+		log.Warnf("Ignoring malformed event %s: %v", kvp.Key, err)
+		return nil
+	}
+	if e.Node != b.node {
+		deliver(&e)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Package export publishes block volumes to remote hosts over network storage
+// protocols, so that volumes created by local drivers can be attached from
+// other nodes.
+package export
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+var (
+	// ErrProtocolNotFound is returned for protocols without a registered
+	// Target.
+	ErrProtocolNotFound = errors.New("Export protocol not supported")
+	// ErrNotExported is returned when unexporting a volume that is not
+	// exported over the requested protocol.
+	ErrNotExported = errors.New("Volume is not exported")
+)
+
+// Target publishes local block devices over a network protocol.
+type Target interface {
+	// Protocol implemented by this target.
+	Protocol() api.ExportProtocol
+
+	// Publish exports devicePath as volumeID and returns how to reach it.
+	Publish(volumeID api.VolumeID, devicePath string) (*api.VolumeExport, error)
+
+	// Unpublish removes the export of volumeID.
+	Unpublish(volumeID api.VolumeID) error
+}
+
+var (
+	lock    sync.Mutex
+	targets = make(map[api.ExportProtocol]Target)
+)
+
+// Register makes a Target available for its protocol, replacing any
+// previously registered Target.
+func Register(t Target) {
+	lock.Lock()
+	defer lock.Unlock()
+	targets[t.Protocol()] = t
+}
+
+// Get returns the Target registered for protocol.
+func Get(protocol api.ExportProtocol) (Target, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	if t, ok := targets[protocol]; ok {
+		return t, nil
+	}
+	return nil, ErrProtocolNotFound
+}
+
+func inspect(d volume.VolumeDriver, volumeID api.VolumeID) (*api.Volume, error) {
+	vols, err := d.Inspect([]api.VolumeID{volumeID})
+	if err != nil {
+		return nil, err
+	}
+	if len(vols) != 1 {
+		return nil, volume.ErrEnoEnt
+	}
+	return &vols[0], nil
+}
+
+func find(v *api.Volume, protocol api.ExportProtocol) int {
+	for i, e := range v.Exports {
+		if e.Protocol == protocol && e.Node == volume.NodeID() {
+			return i
+		}
+	}
+	return -1
+}
+
+// update records the exports of a volume if the driver stores metadata with
+// the default volume Store.
+func update(d volume.VolumeDriver, volumeID api.VolumeID, fn func(v *api.Volume)) error {
+	store, ok := d.(volume.Store)
+	if !ok {
+		return nil
+	}
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer store.Unlock(token)
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	fn(v)
+	return store.UpdateVol(v)
+}
+
+// Export attaches a block volume on this node and publishes it over
+// protocol. Exporting a volume again returns the existing export.
+// Errors ErrEnoEnt, ErrNotSupported, ErrProtocolNotFound may be returned.
+func Export(d volume.VolumeDriver,
+	volumeID api.VolumeID,
+	protocol api.ExportProtocol) (*api.VolumeExport, error) {
+	if e, ok := d.(volume.Exporter); ok {
+		return e.Export(volumeID, protocol)
+	}
+	if d.Type()&volume.Block == 0 {
+		return nil, volume.ErrNotSupported
+	}
+	t, err := Get(protocol)
+	if err != nil {
+		return nil, err
+	}
+	v, err := inspect(d, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	if i := find(v, protocol); i >= 0 {
+		return &v.Exports[i], nil
+	}
+
+	devicePath, err := d.Attach(volumeID, nil)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := t.Publish(volumeID, devicePath)
+	if err != nil {
+		release(d, v)
+		return nil, err
+	}
+	exp.Protocol = protocol
+	exp.Node = volume.NodeID()
+	err = update(d, volumeID, func(v *api.Volume) {
+		v.Exports = append(v.Exports, *exp)
+	})
+	if err != nil {
+		t.Unpublish(volumeID)
+		release(d, v)
+		return nil, err
+	}
+	log.Infof("Exported volume %v over %v as %v", volumeID, protocol, exp.Target)
+	return exp, nil
+}
+
+// release detaches v, attached to be exported, unless it is exported over
+// another protocol or mounted on this node.
+func release(d volume.VolumeDriver, v *api.Volume) {
+	if len(v.Exports) != 0 || v.AttachPath != "" {
+		return
+	}
+	if err := d.Detach(v.ID); err != nil && err != volume.ErrNotSupported {
+		log.Warnf("Failed to detach volume %v not exported: %v", v.ID, err)
+	}
+}
+
+// Unexport removes the protocol export of a volume. The volume is detached
+// once it is neither exported nor mounted on this node.
+// Errors ErrEnoEnt, ErrNotExported, ErrProtocolNotFound may be returned.
+func Unexport(d volume.VolumeDriver, volumeID api.VolumeID, protocol api.ExportProtocol) error {
+	if e, ok := d.(volume.Exporter); ok {
+		return e.Unexport(volumeID, protocol)
+	}
+	t, err := Get(protocol)
+	if err != nil {
+		return err
+	}
+	v, err := inspect(d, volumeID)
+	if err != nil {
+		return err
+	}
+	if find(v, protocol) < 0 {
+		return ErrNotExported
+	}
+	if err = t.Unpublish(volumeID); err != nil {
+		return err
+	}
+	remaining := 0
+	err = update(d, volumeID, func(v *api.Volume) {
+		if i := find(v, protocol); i >= 0 {
+			v.Exports = append(v.Exports[:i], v.Exports[i+1:]...)
+		}
+		remaining = len(v.Exports)
+	})
+	if err != nil {
+		return err
+	}
+	if remaining == 0 && v.AttachPath == "" {
+		if err = d.Detach(volumeID); err != nil && err != volume.ErrNotSupported {
+			log.Warnf("Failed to detach unexported volume %v: %v", volumeID, err)
+		}
+	}
+	log.Infof("Unexported volume %v from %v", volumeID, protocol)
+	return nil
+}
+
+// portals returns the addresses a target listening on listen is reachable
+// on. Unspecified listen addresses are expanded to all non loopback
+// addresses of this host.
+func portals(listen string) []string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return []string{listen}
+	}
+	ip := net.ParseIP(host)
+	if host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return []string{listen}
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return []string{listen}
+	}
+	out := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok || n.IP.IsLoopback() || n.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		out = append(out, net.JoinHostPort(n.IP.String(), port))
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package export
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestPortals(t *testing.T) {
+	assert.Equal(t, []string{"10.0.0.1:3260"}, portals("10.0.0.1:3260"))
+	assert.Equal(t, []string{"bad"}, portals("bad"))
+	for _, p := range portals("0.0.0.0:3260") {
+		assert.NotEqual(t, "0.0.0.0:3260", p)
+		assert.Contains(t, p, ":3260")
+	}
+}
+
+func TestNames(t *testing.T) {
+	target := NewISCSITarget(ISCSIConfig{}).(*iscsiTarget)
+	iqn, name := target.names(api.VolumeID("Vol_1"))
+	assert.Equal(t, DefaultIQNPrefix+":vol-1", iqn)
+	assert.Equal(t, "osd-vol-1", name)
+	assert.Equal(t, api.ProtocolISCSI, target.Protocol())
+}
+
+func TestNQN(t *testing.T) {
+	target := NewNVMeoFTarget(NVMeoFConfig{}).(*nvmeofTarget)
+	assert.Equal(t, DefaultNQNPrefix+":vol-1", target.nqn(api.VolumeID("Vol_1")))
+	assert.Equal(t, api.ProtocolNVMeoF, target.Protocol())
+	assert.Equal(t, "/sys/kernel/config/nvmet/ports/1", target.portDir())
+	_, err := target.Publish(api.VolumeID("vol1"), "/dev/sdb")
+	assert.Error(t, err, "Volume exported to any host")
+}
+
+func TestISCSIAccess(t *testing.T) {
+	target := NewISCSITarget(ISCSIConfig{}).(*iscsiTarget)
+	_, err := target.Publish(api.VolumeID("vol1"), "/dev/sdb")
+	assert.Error(t, err, "Volume exported to any initiator")
+
+	os.Setenv("EXPORT_TEST_CHAP", "secret")
+	defer os.Unsetenv("EXPORT_TEST_CHAP")
+	target = NewISCSITarget(ISCSIConfig{
+		Initiators: []string{"iqn.1994-05.com.redhat:host1"},
+		CHAPUser:   "osd",
+	}).(*iscsiTarget)
+	_, err = target.access()
+	assert.Error(t, err, "Volume exported without CHAP")
+	target.cfg.CHAPSecret = "env:EXPORT_TEST_CHAP"
+	access, err := target.access()
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", access.password)
+}
@@ -0,0 +1,361 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/secrets"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	// DefaultIQNPrefix prefix of the target names of exported volumes.
+	DefaultIQNPrefix = "iqn.2015-11.org.openstorage"
+	// DefaultISCSIListen address iSCSI targets listen on.
+	DefaultISCSIListen = "0.0.0.0:3260"
+
+	lioBase = "/sys/kernel/config/target"
+)
+
+// ISCSIConfig configures the iSCSI target. Volumes are only exported to the
+// listed initiators, authenticated with CHAP.
+type ISCSIConfig struct {
+	// IQNPrefix target names are IQNPrefix:volumeID.
+	IQNPrefix string
+	// Listen address of the target portal.
+	Listen string
+	// Initiators IQNs of the initiators allowed to log in to the targets.
+	Initiators []string
+	// CHAPUser user name initiators authenticate with.
+	CHAPUser string
+	// CHAPSecret secret reference of the CHAP password of CHAPUser, such
+	// as "env:ISCSI_CHAP_SECRET", see secrets.Get.
+	CHAPSecret string
+}
+
+// iscsiAccess are the initiators allowed to log in to a target and their
+// CHAP credentials.
+type iscsiAccess struct {
+	initiators []string
+	user       string
+	password   string
+}
+
+// iscsiBackend is the kernel or userspace target implementation.
+type iscsiBackend interface {
+	// publish returns the LUN of the device within the target.
+	publish(iqn, name, devicePath, listen string, access *iscsiAccess) (int, error)
+	unpublish(iqn, name string) error
+}
+
+type iscsiTarget struct {
+	sync.Mutex
+	cfg ISCSIConfig
+}
+
+// NewISCSITarget returns a Target exporting volumes over iSCSI. The LIO
+// kernel target is configured through configfs when available, otherwise
+// the tgt userspace target is configured with tgtadm.
+func NewISCSITarget(cfg ISCSIConfig) Target {
+	if cfg.IQNPrefix == "" {
+		cfg.IQNPrefix = DefaultIQNPrefix
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = DefaultISCSIListen
+	}
+	return &iscsiTarget{cfg: cfg}
+}
+
+func (t *iscsiTarget) Protocol() api.ExportProtocol {
+	return api.ProtocolISCSI
+}
+
+func (t *iscsiTarget) backend() (iscsiBackend, error) {
+	if _, err := os.Stat(path.Join(lioBase, "iscsi")); err == nil {
+		return &lio{}, nil
+	}
+	if _, err := exec.LookPath("tgtadm"); err == nil {
+		return &tgt{}, nil
+	}
+	return nil, fmt.Errorf("No iSCSI target available, load target_core_mod and "+
+		"iscsi_target_mod or install tgt: %v", volume.ErrNotSupported)
+}
+
+var invalidName = regexp.MustCompile("[^a-z0-9.-]")
+
+func (t *iscsiTarget) names(volumeID api.VolumeID) (iqn, name string) {
+	id := invalidName.ReplaceAllString(strings.ToLower(string(volumeID)), "-")
+	return t.cfg.IQNPrefix + ":" + id, "osd-" + id
+}
+
+// access returns the initiators allowed to log in to the targets and their
+// credentials, targets are never published without them.
+func (t *iscsiTarget) access() (*iscsiAccess, error) {
+	if len(t.cfg.Initiators) == 0 {
+		return nil, fmt.Errorf("No iSCSI initiators configured to export volumes to")
+	}
+	if t.cfg.CHAPUser == "" || t.cfg.CHAPSecret == "" {
+		return nil, fmt.Errorf("No iSCSI CHAP credentials configured to export volumes with")
+	}
+	password, err := secrets.Get(t.cfg.CHAPSecret)
+	if err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return nil, fmt.Errorf("Empty iSCSI CHAP password in %s", t.cfg.CHAPSecret)
+	}
+	return &iscsiAccess{initiators: t.cfg.Initiators, user: t.cfg.CHAPUser, password: password}, nil
+}
+
+func (t *iscsiTarget) Publish(volumeID api.VolumeID, devicePath string) (*api.VolumeExport, error) {
+	t.Lock()
+	defer t.Unlock()
+	access, err := t.access()
+	if err != nil {
+		return nil, err
+	}
+	b, err := t.backend()
+	if err != nil {
+		return nil, err
+	}
+	iqn, name := t.names(volumeID)
+	lun, err := b.publish(iqn, name, devicePath, t.cfg.Listen, access)
+	if err != nil {
+		b.unpublish(iqn, name)
+		return nil, err
+	}
+	return &api.VolumeExport{
+		Target:  iqn,
+		Portals: portals(t.cfg.Listen),
+		LUN:     lun,
+		Time:    time.Now(),
+	}, nil
+}
+
+func (t *iscsiTarget) Unpublish(volumeID api.VolumeID) error {
+	t.Lock()
+	defer t.Unlock()
+	b, err := t.backend()
+	if err != nil {
+		return err
+	}
+	iqn, name := t.names(volumeID)
+	return b.unpublish(iqn, name)
+}
+
+// lio configures the LIO kernel target through configfs.
+type lio struct{}
+
+func write(p, val string) error {
+	if err := ioutil.WriteFile(p, []byte(val), 0644); err != nil {
+		return fmt.Errorf("Failed to write %q to %s: %v", val, p, err)
+	}
+	return nil
+}
+
+func (l *lio) publish(iqn, name, devicePath, listen string, access *iscsiAccess) (int, error) {
+	backstore := path.Join(lioBase, "core", "iblock_0", name)
+	tpg := path.Join(lioBase, "iscsi", iqn, "tpgt_1")
+	lun := path.Join(tpg, "lun", "lun_0")
+
+	for _, dir := range []string{backstore, lun, path.Join(tpg, "np", listen)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return 0, err
+		}
+	}
+	steps := [][2]string{
+		{path.Join(backstore, "control"), "udev_path=" + devicePath},
+		{path.Join(backstore, "enable"), "1"},
+		// Only the initiators with an ACL log in, with CHAP.
+		{path.Join(tpg, "attrib", "authentication"), "1"},
+		{path.Join(tpg, "attrib", "generate_node_acls"), "0"},
+	}
+	for _, s := range steps {
+		if err := write(s[0], s[1]); err != nil {
+			return 0, err
+		}
+	}
+	link := path.Join(lun, name)
+	if _, err := os.Lstat(link); os.IsNotExist(err) {
+		if err = os.Symlink(backstore, link); err != nil {
+			return 0, err
+		}
+	}
+	for _, initiator := range access.initiators {
+		acl := path.Join(tpg, "acls", initiator)
+		mapped := path.Join(acl, "lun_0")
+		if err := os.MkdirAll(mapped, 0755); err != nil {
+			return 0, err
+		}
+		link := path.Join(mapped, "lun_0")
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			if err = os.Symlink(lun, link); err != nil {
+				return 0, err
+			}
+		}
+		if err := write(path.Join(acl, "auth", "userid"), access.user); err != nil {
+			return 0, err
+		}
+		if err := write(path.Join(acl, "auth", "password"), access.password); err != nil {
+			return 0, err
+		}
+	}
+	return 0, write(path.Join(tpg, "enable"), "1")
+}
+
+func (l *lio) unpublish(iqn, name string) error {
+	target := path.Join(lioBase, "iscsi", iqn)
+	tpg := path.Join(target, "tpgt_1")
+	if _, err := os.Stat(tpg); err == nil {
+		write(path.Join(tpg, "enable"), "0")
+		if acls, err := ioutil.ReadDir(path.Join(tpg, "acls")); err == nil {
+			for _, acl := range acls {
+				mapped := path.Join(tpg, "acls", acl.Name(), "lun_0")
+				os.Remove(path.Join(mapped, "lun_0"))
+				os.Remove(mapped)
+				os.Remove(path.Join(tpg, "acls", acl.Name()))
+			}
+		}
+		os.Remove(path.Join(tpg, "lun", "lun_0", name))
+		os.Remove(path.Join(tpg, "lun", "lun_0"))
+		if nps, err := ioutil.ReadDir(path.Join(tpg, "np")); err == nil {
+			for _, np := range nps {
+				os.Remove(path.Join(tpg, "np", np.Name()))
+			}
+		}
+		os.Remove(tpg)
+	}
+	os.Remove(target)
+
+	// configfs directories are removed with rmdir, a remaining directory
+	// means the kernel refused to tear down the export.
+	backstore := path.Join(lioBase, "core", "iblock_0", name)
+	os.Remove(backstore)
+	for _, p := range []string{target, backstore} {
+		if _, err := os.Stat(p); err == nil {
+			return fmt.Errorf("Failed to remove iSCSI export %s", p)
+		}
+	}
+	return nil
+}
+
+// tgt configures the tgt userspace target with tgtadm.
+type tgt struct{}
+
+func tgtadm(args ...string) (string, error) {
+	args = append([]string{"--lld", "iscsi"}, args...)
+	out, err := exec.Command("tgtadm", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("tgtadm %s failed: %v: %s",
+			strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+var tgtTarget = regexp.MustCompile(`^Target (\d+): (\S+)`)
+
+// targets returns the tids of configured targets by name.
+func (g *tgt) targets() (map[string]int, error) {
+	out, err := tgtadm("--op", "show", "--mode", "target")
+	if err != nil {
+		return nil, err
+	}
+	tids := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewBufferString(out))
+	for scanner.Scan() {
+		if m := tgtTarget.FindStringSubmatch(scanner.Text()); m != nil {
+			tid, _ := strconv.Atoi(m[1])
+			tids[m[2]] = tid
+		}
+	}
+	return tids, nil
+}
+
+// account creates the CHAP account of access unless it exists.
+func (g *tgt) account(access *iscsiAccess) error {
+	out, err := tgtadm("--op", "show", "--mode", "account")
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewBufferString(out))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == access.user {
+			return nil
+		}
+	}
+	_, err = tgtadm("--op", "new", "--mode", "account", "--user", access.user, "--password", access.password)
+	return err
+}
+
+func (g *tgt) publish(iqn, name, devicePath, listen string, access *iscsiAccess) (int, error) {
+	// tgt reserves LUN 0 for the controller, the volume is LUN 1.
+	const lun = 1
+	tids, err := g.targets()
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := tids[iqn]; ok {
+		return lun, nil
+	}
+	used := make(map[int]bool)
+	for _, tid := range tids {
+		used[tid] = true
+	}
+	tid := 1
+	for used[tid] {
+		tid++
+	}
+	t := strconv.Itoa(tid)
+	if _, err = tgtadm("--op", "new", "--mode", "target", "--tid", t, "--targetname", iqn); err != nil {
+		return 0, err
+	}
+	_, err = tgtadm("--op", "new", "--mode", "logicalunit", "--tid", t, "--lun", strconv.Itoa(lun),
+		"--backing-store", devicePath)
+	if err != nil {
+		return 0, err
+	}
+	if err = g.account(access); err != nil {
+		return 0, err
+	}
+	if _, err = tgtadm("--op", "bind", "--mode", "account", "--tid", t, "--user", access.user); err != nil {
+		return 0, err
+	}
+	for _, initiator := range access.initiators {
+		_, err = tgtadm("--op", "bind", "--mode", "target", "--tid", t, "--initiator-name", initiator)
+		if err != nil {
+			return 0, err
+		}
+	}
+	log.Debugf("tgt target %s created with tid %d", iqn, tid)
+	return lun, nil
+}
+
+func (g *tgt) unpublish(iqn, name string) error {
+	tids, err := g.targets()
+	if err != nil {
+		return err
+	}
+	tid, ok := tids[iqn]
+	if !ok {
+		return nil
+	}
+	_, err = tgtadm("--op", "delete", "--mode", "target", "--force", "--tid", strconv.Itoa(tid))
+	return err
+}
+
+func init() {
+	Register(NewISCSITarget(ISCSIConfig{}))
+}
@@ -0,0 +1,219 @@
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	// DefaultNQNPrefix prefix of the subsystem names of exported volumes.
+	DefaultNQNPrefix = "nqn.2015-11.org.openstorage"
+	// DefaultNVMeoFListen address NVMe-oF subsystems listen on.
+	DefaultNVMeoFListen = "0.0.0.0:4420"
+	// DefaultNVMeoFPort nvmet port ID used for exports.
+	DefaultNVMeoFPort = 1
+
+	nvmetBase = "/sys/kernel/config/nvmet"
+
+	// nsid namespace ID of the volume within its subsystem.
+	nsid = 1
+)
+
+// NVMeoFConfig configures the NVMe over Fabrics target. Volumes are only
+// exported to the listed hosts.
+type NVMeoFConfig struct {
+	// NQNPrefix subsystem names are NQNPrefix:volumeID.
+	NQNPrefix string
+	// Listen address of the TCP port.
+	Listen string
+	// Port nvmet port ID, shared by all exported subsystems.
+	Port int
+	// Hosts NQNs of the hosts allowed to connect to the subsystems, such
+	// as the contents of /etc/nvme/hostnqn on each host.
+	Hosts []string
+}
+
+type nvmeofTarget struct {
+	sync.Mutex
+	cfg NVMeoFConfig
+}
+
+// NewNVMeoFTarget returns a Target exporting volumes over NVMe/TCP with the
+// kernel nvmet target, configured through configfs.
+func NewNVMeoFTarget(cfg NVMeoFConfig) Target {
+	if cfg.NQNPrefix == "" {
+		cfg.NQNPrefix = DefaultNQNPrefix
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = DefaultNVMeoFListen
+	}
+	if cfg.Port == 0 {
+		cfg.Port = DefaultNVMeoFPort
+	}
+	return &nvmeofTarget{cfg: cfg}
+}
+
+func (t *nvmeofTarget) Protocol() api.ExportProtocol {
+	return api.ProtocolNVMeoF
+}
+
+func (t *nvmeofTarget) nqn(volumeID api.VolumeID) string {
+	return t.cfg.NQNPrefix + ":" + invalidName.ReplaceAllString(strings.ToLower(string(volumeID)), "-")
+}
+
+func (t *nvmeofTarget) portDir() string {
+	return path.Join(nvmetBase, "ports", strconv.Itoa(t.cfg.Port))
+}
+
+func available() error {
+	if _, err := os.Stat(path.Join(nvmetBase, "subsystems")); err != nil {
+		return fmt.Errorf("No NVMe-oF target available, load nvmet and nvmet_tcp: %v",
+			volume.ErrNotSupported)
+	}
+	return nil
+}
+
+// setupPort configures the shared TCP port if it is not configured yet.
+func (t *nvmeofTarget) setupPort() error {
+	port := t.portDir()
+	if b, err := ioutil.ReadFile(path.Join(port, "addr_trtype")); err == nil &&
+		strings.TrimSpace(string(b)) != "" {
+		return nil
+	}
+	host, svc, err := net.SplitHostPort(t.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("Invalid NVMe-oF listen address %q: %v", t.cfg.Listen, err)
+	}
+	family := "ipv4"
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		family = "ipv6"
+	}
+	if err = os.MkdirAll(port, 0755); err != nil {
+		return err
+	}
+	steps := [][2]string{
+		{"addr_trtype", "tcp"},
+		{"addr_adrfam", family},
+		{"addr_traddr", host},
+		{"addr_trsvcid", svc},
+	}
+	for _, s := range steps {
+		if err = write(path.Join(port, s[0]), s[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *nvmeofTarget) Publish(volumeID api.VolumeID, devicePath string) (*api.VolumeExport, error) {
+	t.Lock()
+	defer t.Unlock()
+	if len(t.cfg.Hosts) == 0 {
+		return nil, fmt.Errorf("No NVMe-oF hosts configured to export volumes to")
+	}
+	if err := available(); err != nil {
+		return nil, err
+	}
+	nqn := t.nqn(volumeID)
+	if err := t.publish(nqn, devicePath); err != nil {
+		t.unpublish(nqn)
+		return nil, err
+	}
+	return &api.VolumeExport{
+		Target:  nqn,
+		Portals: portals(t.cfg.Listen),
+		LUN:     nsid,
+		Time:    time.Now(),
+	}, nil
+}
+
+func (t *nvmeofTarget) publish(nqn, devicePath string) error {
+	subsys := path.Join(nvmetBase, "subsystems", nqn)
+	ns := path.Join(subsys, "namespaces", strconv.Itoa(nsid))
+	if err := os.MkdirAll(ns, 0755); err != nil {
+		return err
+	}
+	// Only the hosts linked in allowed_hosts connect to the subsystem.
+	if err := write(path.Join(subsys, "attr_allow_any_host"), "0"); err != nil {
+		return err
+	}
+	for _, host := range t.cfg.Hosts {
+		dir := path.Join(nvmetBase, "hosts", host)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		link := path.Join(subsys, "allowed_hosts", host)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			if err = os.Symlink(dir, link); err != nil {
+				return err
+			}
+		}
+	}
+	steps := [][2]string{
+		{path.Join(ns, "device_path"), devicePath},
+		{path.Join(ns, "enable"), "1"},
+	}
+	for _, s := range steps {
+		if err := write(s[0], s[1]); err != nil {
+			return err
+		}
+	}
+	if err := t.setupPort(); err != nil {
+		return err
+	}
+	link := path.Join(t.portDir(), "subsystems", nqn)
+	if _, err := os.Lstat(link); os.IsNotExist(err) {
+		return os.Symlink(subsys, link)
+	}
+	return nil
+}
+
+func (t *nvmeofTarget) Unpublish(volumeID api.VolumeID) error {
+	t.Lock()
+	defer t.Unlock()
+	if err := available(); err != nil {
+		return err
+	}
+	return t.unpublish(t.nqn(volumeID))
+}
+
+func (t *nvmeofTarget) unpublish(nqn string) error {
+	port := t.portDir()
+	os.Remove(path.Join(port, "subsystems", nqn))
+
+	subsys := path.Join(nvmetBase, "subsystems", nqn)
+	ns := path.Join(subsys, "namespaces", strconv.Itoa(nsid))
+	if _, err := os.Stat(ns); err == nil {
+		write(path.Join(ns, "enable"), "0")
+		os.Remove(ns)
+	}
+	if hosts, err := ioutil.ReadDir(path.Join(subsys, "allowed_hosts")); err == nil {
+		for _, h := range hosts {
+			os.Remove(path.Join(subsys, "allowed_hosts", h.Name()))
+		}
+	}
+	os.Remove(subsys)
+
+	// The port is shared, remove it with the last subsystem using it.
+	if links, err := ioutil.ReadDir(path.Join(port, "subsystems")); err == nil && len(links) == 0 {
+		os.Remove(port)
+	}
+	if _, err := os.Stat(subsys); err == nil {
+		return fmt.Errorf("Failed to remove NVMe-oF export %s", subsys)
+	}
+	return nil
+}
+
+func init() {
+	Register(NewNVMeoFTarget(NVMeoFConfig{}))
+}
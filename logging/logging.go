@@ -0,0 +1,292 @@
+// Package logging gives each volume driver a logger whose level can be
+// changed at runtime, independently of the other drivers. Entries carry
+// structured fields such as the driver, volume, operation and duration.
+//
+// The latest entries of all loggers, including the standard logger, are
+// captured in a ring buffer so that they can be retrieved through the debug
+// endpoint of the REST API.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// DriverField key of the driver of an entry.
+	DriverField = "driver"
+	// VolumeField key of the volume an entry is about.
+	VolumeField = "volumeID"
+	// OpField key of the operation an entry is about.
+	OpField = "op"
+	// DurationField key of the duration of an operation.
+	DurationField = "duration"
+
+	// DefaultCapture number of entries kept in the ring buffer.
+	DefaultCapture = 1000
+)
+
+// Requester is implemented by clients that manage the logs of a remote
+// driver.
+type Requester interface {
+	// LogLevel returns the log level of the driver.
+	LogLevel() (string, error)
+
+	// SetLogLevel changes the log level of the driver.
+	SetLogLevel(level string) error
+
+	// Logs returns the latest log entries of the driver at or above level,
+	// oldest first, at most limit entries if limit is not 0.
+	Logs(level string, limit int) ([]api.LogEntry, error)
+}
+
+var (
+	lock sync.Mutex
+	// loggers of each driver, by driver name.
+	loggers = make(map[string]*log.Logger)
+	// gates of the loggers of each driver, by driver name.
+	gates = make(map[string]*gate)
+	// levels set explicitly for a driver, other drivers follow the level
+	// of the standard logger.
+	levels  = make(map[string]log.Level)
+	capture = newRing(DefaultCapture)
+	// outLock serializes the writes of the gates.
+	outLock sync.Mutex
+)
+
+func init() {
+	log.AddHook(capture)
+}
+
+// gate writes and captures the entries of the logger of a driver at or
+// above the level of the driver. Logrus reads the level of a logger without
+// a lock, so the loggers of drivers stay at the debug level and discard their
+// output while the gate filters their entries.
+type gate struct {
+	// level log.Level of the driver, accessed atomically.
+	level     uint32
+	out       io.Writer
+	formatter log.Formatter
+}
+
+func (g *gate) setLevel(l log.Level) {
+	atomic.StoreUint32(&g.level, uint32(l))
+}
+
+// Levels gates entries of all levels.
+func (g *gate) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire writes and captures e if the driver logs at its level.
+func (g *gate) Fire(e *log.Entry) error {
+	if log.Level(atomic.LoadUint32(&g.level)) < e.Level {
+		return nil
+	}
+	capture.Fire(e)
+	b, err := g.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	outLock.Lock()
+	defer outLock.Unlock()
+	_, err = g.out.Write(b)
+	return err
+}
+
+// logger returns the logger of driver, whose entries are written with the
+// output and format of the standard logger, at the level of the standard
+// logger unless one was set for driver.
+func logger(driver string) *log.Logger {
+	lock.Lock()
+	defer lock.Unlock()
+	if l, ok := loggers[driver]; ok {
+		return l
+	}
+	std := log.StandardLogger()
+	g := &gate{out: std.Out, formatter: std.Formatter}
+	g.setLevel(log.GetLevel())
+	if level, ok := levels[driver]; ok {
+		g.setLevel(level)
+	}
+	l := log.New()
+	l.Out = ioutil.Discard
+	l.Formatter = std.Formatter
+	l.Level = log.DebugLevel
+	l.Hooks.Add(g)
+	loggers[driver] = l
+	gates[driver] = g
+	return l
+}
+
+// For returns the logger of driver. Its entries are logged with the driver
+// field, at or above the level of the driver.
+func For(driver string) *log.Entry {
+	return logger(driver).WithField(DriverField, driver)
+}
+
+// Op logs the outcome of the operation op of driver on volumeID started at
+// start: failures as warnings, successes at the debug level.
+func Op(driver string, op string, volumeID api.VolumeID, start time.Time, err error) {
+	e := For(driver).WithFields(log.Fields{
+		OpField:       op,
+		DurationField: time.Since(start).String(),
+	})
+	if volumeID != "" && volumeID != api.BadVolumeID {
+		e = e.WithField(VolumeField, volumeID)
+	}
+	if err != nil {
+		e.Warnf("%s failed: %v", op, err)
+		return
+	}
+	e.Debugf("%s succeeded", op)
+}
+
+// SetLevel sets the level of driver to level, such as debug, info, warning
+// or error. An empty driver sets the level of the standard logger and of
+// the drivers whose level was not set.
+func SetLevel(driver string, level string) error {
+	l, err := log.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("Invalid log level %q", level)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if driver == "" {
+		log.SetLevel(l)
+		for name, g := range gates {
+			if _, ok := levels[name]; !ok {
+				g.setLevel(l)
+			}
+		}
+		return nil
+	}
+	levels[driver] = l
+	if g, ok := gates[driver]; ok {
+		g.setLevel(l)
+	}
+	return nil
+}
+
+// Level returns the level of driver, of the standard logger if driver is
+// empty.
+func Level(driver string) string {
+	lock.Lock()
+	defer lock.Unlock()
+	if l, ok := levels[driver]; ok {
+		return l.String()
+	}
+	return log.GetLevel().String()
+}
+
+// SetCapture keeps the latest n entries in the ring buffer, dropping those
+// captured so far. Entries are not captured if n is 0.
+func SetCapture(n int) {
+	capture.resize(n)
+}
+
+// Entries returns the latest captured entries of driver, of all loggers if
+// driver is empty, at or above level, oldest first. At most limit entries
+// are returned, all of them if limit is 0.
+// Errors if level is invalid.
+func Entries(driver string, level string, limit int) ([]api.LogEntry, error) {
+	min := log.DebugLevel
+	if level != "" {
+		var err error
+		if min, err = log.ParseLevel(level); err != nil {
+			return nil, fmt.Errorf("Invalid log level %q", level)
+		}
+	}
+	return capture.entries(func(e *api.LogEntry) bool {
+		if driver != "" && e.Driver != driver {
+			return false
+		}
+		l, err := log.ParseLevel(e.Level)
+		return err == nil && l <= min
+	}, limit), nil
+}
+
+// ring keeps the latest entries logged.
+type ring struct {
+	lock sync.Mutex
+	buf  []api.LogEntry
+	// next index written to.
+	next int
+	full bool
+}
+
+func newRing(n int) *ring {
+	return &ring{buf: make([]api.LogEntry, n)}
+}
+
+func (r *ring) resize(n int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.buf = make([]api.LogEntry, n)
+	r.next = 0
+	r.full = false
+}
+
+// Levels captures entries of all levels the loggers log.
+func (r *ring) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire captures e.
+func (r *ring) Fire(e *log.Entry) error {
+	entry := api.LogEntry{
+		Time:    e.Time,
+		Level:   e.Level.String(),
+		Message: e.Message,
+	}
+	for k, v := range e.Data {
+		if k == DriverField {
+			entry.Driver = fmt.Sprint(v)
+			continue
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[k] = fmt.Sprint(v)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.buf) == 0 {
+		return nil
+	}
+	r.buf[r.next] = entry
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+	return nil
+}
+
+// entries returns the last limit entries matching match, oldest first.
+func (r *ring) entries(match func(*api.LogEntry) bool, limit int) []api.LogEntry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var all []api.LogEntry
+	if r.full {
+		all = append(all, r.buf[r.next:]...)
+	}
+	all = append(all, r.buf[:r.next]...)
+	found := make([]api.LogEntry, 0)
+	for i := range all {
+		if match(&all[i]) {
+			found = append(found, all[i])
+		}
+	}
+	if limit > 0 && len(found) > limit {
+		found = found[len(found)-limit:]
+	}
+	return found
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// quiet discards the output of the logger of driver.
+func quiet(driver string) {
+	logger(driver)
+	lock.Lock()
+	defer lock.Unlock()
+	gates[driver].out = ioutil.Discard
+}
+
+func TestLevels(t *testing.T) {
+	SetCapture(10)
+	defer SetCapture(DefaultCapture)
+	quiet("a")
+	quiet("b")
+
+	assert.NoError(t, SetLevel("a", "debug"))
+	assert.Error(t, SetLevel("a", "verbose"))
+	assert.Equal(t, "debug", Level("a"))
+	assert.Equal(t, "info", Level("b"), "Drivers should follow the standard level")
+
+	For("a").Debug("a debug")
+	For("b").Debug("b debug")
+	For("b").Warn("b warning")
+	entries, err := Entries("", "", 0)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2, "Entries below the driver level captured") {
+		assert.Equal(t, "a debug", entries[0].Message)
+		assert.Equal(t, "a", entries[0].Driver)
+		assert.Equal(t, "warning", entries[1].Level)
+	}
+
+	entries, err = Entries("a", "", 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	entries, err = Entries("", "warning", 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	_, err = Entries("", "verbose", 0)
+	assert.Error(t, err)
+}
+
+func TestCapture(t *testing.T) {
+	SetCapture(3)
+	defer SetCapture(DefaultCapture)
+	quiet("op")
+
+	for i := 0; i < 4; i++ {
+		Op("op", "create", "vol1", time.Now(), errors.New("full"))
+	}
+	entries, err := Entries("op", "", 0)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3, "Ring buffer not bounded") {
+		assert.Equal(t, "create failed: full", entries[2].Message)
+		assert.Equal(t, "vol1", entries[2].Fields[VolumeField])
+		assert.Equal(t, "create", entries[2].Fields[OpField])
+		assert.NotEqual(t, "", entries[2].Fields[DurationField])
+	}
+	entries, err = Entries("op", "", 2)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestSetLevelWhileLogging(t *testing.T) {
+	quiet("c")
+	entry := For("c")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			entry.Debug("c debug")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, SetLevel("c", "debug"))
+		assert.NoError(t, SetLevel("c", "info"))
+	}
+	<-done
+}
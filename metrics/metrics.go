@@ -0,0 +1,322 @@
+// Package metrics records volume driver operations and exports them, together
+// with per volume statistics, in the Prometheus text exposition format. For
+// backends that do not scrape, a Pusher pushes the same metrics to the
+// statsd, graphite or InfluxDB emitters, or others added with Register.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	// Namespace prefixes all exported metric names.
+	Namespace = "osd"
+	// ContentType of the exposition format served by Handler.
+	ContentType = "text/plain; version=0.0.4"
+)
+
+// Buckets are the upper bounds in seconds of the latency histograms.
+var Buckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+type opKey struct {
+	driver string
+	op     string
+}
+
+type volKey struct {
+	driver string
+	volume api.VolumeID
+	op     string
+}
+
+type opStats struct {
+	calls  uint64
+	errors uint64
+	counts []uint64
+	sum    float64
+}
+
+type volStats struct {
+	calls  uint64
+	errors uint64
+}
+
+var (
+	lock sync.Mutex
+	ops  = make(map[opKey]*opStats)
+	vols = make(map[volKey]*volStats)
+)
+
+// Observe records an operation op on driver that started at start and
+// returned err. volumeID may be empty for operations that do not target a
+// volume.
+func Observe(driver, op string, volumeID api.VolumeID, start time.Time, err error) {
+	elapsed := time.Since(start).Seconds()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	o, ok := ops[opKey{driver, op}]
+	if !ok {
+		o = &opStats{counts: make([]uint64, len(Buckets))}
+		ops[opKey{driver, op}] = o
+	}
+	o.calls++
+	o.sum += elapsed
+	for i, b := range Buckets {
+		if elapsed <= b {
+			o.counts[i]++
+		}
+	}
+	if err != nil {
+		o.errors++
+	}
+
+	if volumeID == "" || volumeID == api.BadVolumeID {
+		return
+	}
+	v, ok := vols[volKey{driver, volumeID, op}]
+	if !ok {
+		v = &volStats{}
+		vols[volKey{driver, volumeID, op}] = v
+	}
+	v.calls++
+	if err != nil {
+		v.errors++
+	}
+}
+
+// Forget drops the per volume counters of a deleted volume.
+func Forget(driver string, volumeID api.VolumeID) {
+	lock.Lock()
+	defer lock.Unlock()
+	for k := range vols {
+		if k.driver == driver && k.volume == volumeID {
+			delete(vols, k)
+		}
+	}
+}
+
+// Errors returns the number of failed operations of driver by operation.
+func Errors(driver string) map[string]uint64 {
+	lock.Lock()
+	defer lock.Unlock()
+	errors := make(map[string]uint64)
+	for k, o := range ops {
+		if k.driver == driver && o.errors > 0 {
+			errors[k.op] = o.errors
+		}
+	}
+	return errors
+}
+
+func escape(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
+
+// labels formats name value pairs as a Prometheus label set.
+func labels(kv ...string) string {
+	pairs := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, kv[i], escape(kv[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type writer struct {
+	w   io.Writer
+	err error
+}
+
+func (w *writer) header(name, typ, help string) {
+	w.printf("# HELP %s_%s %s\n# TYPE %s_%s %s\n", Namespace, name, help, Namespace, name, typ)
+}
+
+func (w *writer) sample(name, labels string, v interface{}) {
+	w.printf("%s_%s%s %v\n", Namespace, name, labels, v)
+}
+
+func (w *writer) printf(format string, args ...interface{}) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, format, args...)
+	}
+}
+
+func (w *writer) operations(drivers map[string]bool) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	keys := make([]opKey, 0, len(ops))
+	for k := range ops {
+		if drivers[k.driver] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].driver != keys[j].driver {
+			return keys[i].driver < keys[j].driver
+		}
+		return keys[i].op < keys[j].op
+	})
+
+	w.header("operations_total", "counter", "Volume driver operations.")
+	for _, k := range keys {
+		w.sample("operations_total", labels("driver", k.driver, "op", k.op), ops[k].calls)
+	}
+	w.header("operation_errors_total", "counter", "Volume driver operations that failed.")
+	for _, k := range keys {
+		w.sample("operation_errors_total", labels("driver", k.driver, "op", k.op), ops[k].errors)
+	}
+	w.header("operation_duration_seconds", "histogram", "Volume driver operation latency.")
+	for _, k := range keys {
+		o := ops[k]
+		for i, b := range Buckets {
+			w.sample("operation_duration_seconds_bucket",
+				labels("driver", k.driver, "op", k.op, "le", fmt.Sprint(b)), o.counts[i])
+		}
+		w.sample("operation_duration_seconds_bucket",
+			labels("driver", k.driver, "op", k.op, "le", "+Inf"), o.calls)
+		w.sample("operation_duration_seconds_sum", labels("driver", k.driver, "op", k.op), o.sum)
+		w.sample("operation_duration_seconds_count", labels("driver", k.driver, "op", k.op), o.calls)
+	}
+
+	vkeys := make([]volKey, 0, len(vols))
+	for k := range vols {
+		if drivers[k.driver] {
+			vkeys = append(vkeys, k)
+		}
+	}
+	sort.Slice(vkeys, func(i, j int) bool {
+		if vkeys[i].driver != vkeys[j].driver {
+			return vkeys[i].driver < vkeys[j].driver
+		}
+		if vkeys[i].volume != vkeys[j].volume {
+			return vkeys[i].volume < vkeys[j].volume
+		}
+		return vkeys[i].op < vkeys[j].op
+	})
+	w.header("volume_operations_total", "counter", "Operations on a volume.")
+	for _, k := range vkeys {
+		w.sample("volume_operations_total",
+			labels("driver", k.driver, "volume", string(k.volume), "op", k.op), vols[k].calls)
+	}
+	w.header("volume_operation_errors_total", "counter", "Operations on a volume that failed.")
+	for _, k := range vkeys {
+		w.sample("volume_operation_errors_total",
+			labels("driver", k.driver, "volume", string(k.volume), "op", k.op), vols[k].errors)
+	}
+}
+
+// volumeMetric is a per volume gauge or counter derived from driver data.
+type volumeMetric struct {
+	name  string
+	typ   string
+	help  string
+	value func(v *api.Volume, s *api.VolumeStats) uint64
+}
+
+var volumeMetrics = []volumeMetric{
+	{"volume_size_bytes", "gauge", "Provisioned volume size.",
+		func(v *api.Volume, s *api.VolumeStats) uint64 { return v.Spec.Size }},
+	{"volume_used_bytes", "gauge", "Bytes used by the volume.",
+		func(v *api.Volume, s *api.VolumeStats) uint64 { return v.Usage }},
+	{"volume_reads_total", "counter", "Reads completed.",
+		func(v *api.Volume, s *api.VolumeStats) uint64 { return s.Reads }},
+	{"volume_read_bytes_total", "counter", "Bytes read.",
+		func(v *api.Volume, s *api.VolumeStats) uint64 { return s.ReadBytes }},
+	{"volume_read_ms_total", "counter", "Time spent reading.",
+		func(v *api.Volume, s *api.VolumeStats) uint64 { return s.ReadMs }},
+	{"volume_writes_total", "counter", "Writes completed.",
+		func(v *api.Volume, s *api.VolumeStats) uint64 { return s.Writes }},
+	{"volume_write_bytes_total", "counter", "Bytes written.",
+		func(v *api.Volume, s *api.VolumeStats) uint64 { return s.WriteBytes }},
+	{"volume_write_ms_total", "counter", "Time spent writing.",
+		func(v *api.Volume, s *api.VolumeStats) uint64 { return s.WriteMs }},
+	{"volume_io_in_progress", "gauge", "IOs currently in progress.",
+		func(v *api.Volume, s *api.VolumeStats) uint64 { return s.IOProgress }},
+}
+
+type volumeSample struct {
+	driver string
+	vol    api.Volume
+	stats  api.VolumeStats
+}
+
+// collect gathers volumes and their Stats from every running driver.
+// Drivers that do not support Stats report zero IO counters.
+func collect(drivers []string) []volumeSample {
+	samples := make([]volumeSample, 0)
+	for _, name := range drivers {
+		d, err := volume.Get(name)
+		if err != nil {
+			continue
+		}
+		vs, err := volume.EnumerateAt(d, api.VolumeLocator{}, nil, api.ConsistencyCached)
+		if err != nil {
+			log.Warnf("Unable to enumerate %s volumes for metrics: %v", name, err)
+			continue
+		}
+		for _, v := range vs {
+			s := volumeSample{driver: name, vol: v}
+			if stats, err := d.Stats(v.ID); err == nil {
+				s.stats = stats
+			}
+			if s.vol.Spec == nil {
+				s.vol.Spec = &api.VolumeSpec{}
+			}
+			samples = append(samples, s)
+		}
+	}
+	return samples
+}
+
+func (w *writer) volumes(samples []volumeSample) {
+	for _, m := range volumeMetrics {
+		w.header(m.name, m.typ, m.help)
+		for i := range samples {
+			s := &samples[i]
+			w.sample(m.name, labels("driver", s.driver, "volume", string(s.vol.ID)),
+				m.value(&s.vol, &s.stats))
+		}
+	}
+}
+
+// Write writes all metrics for drivers to out.
+func Write(out io.Writer, drivers []string) error {
+	w := &writer{w: out}
+	names := make(map[string]bool)
+	for _, d := range drivers {
+		names[d] = true
+	}
+	w.operations(names)
+	w.volumes(collect(drivers))
+	return w.err
+}
+
+// Handler returns an http.Handler serving the metrics of drivers, or of all
+// running drivers if none are specified.
+func Handler(drivers ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names := drivers
+		if len(names) == 0 {
+			names = volume.Instances()
+		}
+		w.Header().Set("Content-Type", ContentType)
+		if err := Write(w, names); err != nil {
+			log.Warnf("Failed to write metrics: %v", err)
+		}
+	})
+}
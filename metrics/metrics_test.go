@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	Observe("test", "create", "vol1", time.Now(), nil)
+	Observe("test", "create", "vol2", time.Now().Add(-time.Second), errors.New("failed"))
+	Observe("other", "create", "vol3", time.Now(), nil)
+
+	var b bytes.Buffer
+	err := Write(&b, []string{"test"})
+	assert.NoError(t, err)
+	out := b.String()
+
+	assert.Contains(t, out, `osd_operations_total{driver="test",op="create"} 2`)
+	assert.Contains(t, out, `osd_operation_errors_total{driver="test",op="create"} 1`)
+	assert.Contains(t, out, `osd_operation_duration_seconds_bucket{driver="test",op="create",le="0.5"} 1`)
+	assert.Contains(t, out, `osd_operation_duration_seconds_bucket{driver="test",op="create",le="+Inf"} 2`)
+	assert.Contains(t, out, `osd_volume_operation_errors_total{driver="test",volume="vol2",op="create"} 1`)
+	assert.False(t, strings.Contains(out, "other"), "metrics of other drivers exported")
+	assert.Equal(t, map[string]uint64{"create": 1}, Errors("test"))
+	assert.Equal(t, map[string]uint64{}, Errors("other"))
+
+	Forget("test", "vol2")
+	b.Reset()
+	assert.NoError(t, Write(&b, []string{"test"}))
+	assert.False(t, strings.Contains(b.String(), "vol2"), "forgotten volume exported")
+}
@@ -0,0 +1,303 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Tag is a name value pair identifying a Point, such as its driver.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Point is the value of a metric pushed to an Emitter. Counters are pushed
+// as their running total.
+type Point struct {
+	// Name of the metric, without Namespace.
+	Name  string
+	Tags  []Tag
+	Value float64
+}
+
+// Emitter pushes metrics to a stats backend that does not scrape them.
+type Emitter interface {
+	// String description of this emitter.
+	String() string
+	// Emit sends points sampled at at.
+	Emit(points []Point, at time.Time) error
+}
+
+// EmitterFunc returns an Emitter for a URL of the scheme it is registered
+// with.
+type EmitterFunc func(u *url.URL) (Emitter, error)
+
+var (
+	emittersLock sync.Mutex
+	emitters     = make(map[string]EmitterFunc)
+)
+
+// Register makes the emitters of URL scheme available to NewEmitter.
+func Register(scheme string, f EmitterFunc) {
+	emittersLock.Lock()
+	defer emittersLock.Unlock()
+	emitters[scheme] = f
+}
+
+// NewEmitter returns an emitter for the specified URL, by its scheme:
+// statsd://host:port sends gauges over UDP, graphite://host:port sends the
+// plaintext protocol over TCP and influx+http(s)://host:port/write?db=name
+// posts the InfluxDB line protocol.
+func NewEmitter(u string) (Emitter, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	emittersLock.Lock()
+	f, ok := emitters[parsed.Scheme]
+	emittersLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Unsupported metrics sink %q", u)
+	}
+	return f(parsed)
+}
+
+// Points returns the current value of all metrics for drivers, the same
+// metrics Write exports.
+func Points(drivers []string) []Point {
+	names := make(map[string]bool)
+	for _, d := range drivers {
+		names[d] = true
+	}
+	points := operationPoints(names)
+	samples := collect(drivers)
+	for _, m := range volumeMetrics {
+		for i := range samples {
+			s := &samples[i]
+			points = append(points, Point{
+				Name:  m.name,
+				Tags:  []Tag{{"driver", s.driver}, {"volume", string(s.vol.ID)}},
+				Value: float64(m.value(&s.vol, &s.stats)),
+			})
+		}
+	}
+	return points
+}
+
+func operationPoints(drivers map[string]bool) []Point {
+	lock.Lock()
+	defer lock.Unlock()
+
+	points := make([]Point, 0, 4*len(ops)+2*len(vols))
+	for k, o := range ops {
+		if !drivers[k.driver] {
+			continue
+		}
+		tags := []Tag{{"driver", k.driver}, {"op", k.op}}
+		points = append(points,
+			Point{"operations_total", tags, float64(o.calls)},
+			Point{"operation_errors_total", tags, float64(o.errors)},
+			Point{"operation_duration_seconds_sum", tags, o.sum},
+			Point{"operation_duration_seconds_count", tags, float64(o.calls)})
+	}
+	for k, v := range vols {
+		if !drivers[k.driver] {
+			continue
+		}
+		tags := []Tag{{"driver", k.driver}, {"volume", string(k.volume)}, {"op", k.op}}
+		points = append(points,
+			Point{"volume_operations_total", tags, float64(v.calls)},
+			Point{"volume_operation_errors_total", tags, float64(v.errors)})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Name < points[j].Name })
+	return points
+}
+
+// Pusher pushes the metrics of drivers to emitters on a schedule.
+type Pusher struct {
+	emitters []Emitter
+	interval time.Duration
+	drivers  func() []string
+	stop     chan struct{}
+}
+
+// NewPusher returns a pusher of the metrics of the drivers returned by
+// drivers to emitters every interval. Call Start to begin pushing.
+func NewPusher(emitters []Emitter, interval time.Duration, drivers func() []string) (*Pusher, error) {
+	if len(emitters) == 0 {
+		return nil, fmt.Errorf("No metrics sink configured")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("Invalid metrics push interval %v", interval)
+	}
+	return &Pusher{emitters: emitters, interval: interval, drivers: drivers}, nil
+}
+
+// Push sends the current metrics to all emitters once.
+func (p *Pusher) Push() error {
+	points, at := Points(p.drivers()), time.Now()
+	var failed []string
+	for _, e := range p.emitters {
+		if err := e.Emit(points, at); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", e, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to push metrics to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Start pushing in the background.
+func (p *Pusher) Start() {
+	p.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		t := time.NewTicker(p.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := p.Push(); err != nil {
+					log.Warn(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(p.stop)
+}
+
+// Stop pushing.
+func (p *Pusher) Stop() {
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
+// pathEscape replaces the separators of statsd and graphite in tag values.
+var pathEscape = strings.NewReplacer(".", "_", " ", "_", ":", "_", "|", "_", "/", "_")
+
+// path returns the dotted name of a point, with its tag values, as used by
+// statsd and graphite that do not support tags.
+func path(pt *Point) string {
+	parts := []string{Namespace, pt.Name}
+	for _, t := range pt.Tags {
+		parts = append(parts, pathEscape.Replace(t.Value))
+	}
+	return strings.Join(parts, ".")
+}
+
+type statsdEmitter struct {
+	addr string
+}
+
+func (e *statsdEmitter) String() string {
+	return "statsd://" + e.addr
+}
+
+// maxDatagram bytes sent in a UDP packet, to stay within common MTUs.
+const maxDatagram = 1432
+
+func (e *statsdEmitter) Emit(points []Point, at time.Time) error {
+	conn, err := net.Dial("udp", e.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var b bytes.Buffer
+	for i := range points {
+		line := fmt.Sprintf("%s:%v|g\n", path(&points[i]), points[i].Value)
+		if b.Len() > 0 && b.Len()+len(line) > maxDatagram {
+			if _, err = conn.Write(b.Bytes()); err != nil {
+				return err
+			}
+			b.Reset()
+		}
+		b.WriteString(line)
+	}
+	if b.Len() > 0 {
+		_, err = conn.Write(b.Bytes())
+	}
+	return err
+}
+
+type graphiteEmitter struct {
+	addr string
+}
+
+func (e *graphiteEmitter) String() string {
+	return "graphite://" + e.addr
+}
+
+func (e *graphiteEmitter) Emit(points []Point, at time.Time) error {
+	conn, err := net.DialTimeout("tcp", e.addr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	var b bytes.Buffer
+	for i := range points {
+		fmt.Fprintf(&b, "%s %v %d\n", path(&points[i]), points[i].Value, at.Unix())
+	}
+	_, err = conn.Write(b.Bytes())
+	return err
+}
+
+type influxEmitter struct {
+	url    string
+	client *http.Client
+}
+
+func (e *influxEmitter) String() string {
+	return "influx+" + e.url
+}
+
+// influxEscape escapes the commas, equal signs and spaces of tags.
+var influxEscape = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func (e *influxEmitter) Emit(points []Point, at time.Time) error {
+	var b bytes.Buffer
+	for _, pt := range points {
+		b.WriteString(Namespace + "_" + pt.Name)
+		for _, t := range pt.Tags {
+			fmt.Fprintf(&b, ",%s=%s", influxEscape.Replace(t.Key), influxEscape.Replace(t.Value))
+		}
+		fmt.Fprintf(&b, " value=%v %d\n", pt.Value, at.UnixNano())
+	}
+	resp, err := e.client.Post(e.url, "text/plain; charset=utf-8", &b)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", e.url, resp.Status)
+	}
+	return nil
+}
+
+func init() {
+	Register("statsd", func(u *url.URL) (Emitter, error) {
+		return &statsdEmitter{addr: u.Host}, nil
+	})
+	Register("graphite", func(u *url.URL) (Emitter, error) {
+		return &graphiteEmitter{addr: u.Host}, nil
+	})
+	influx := func(u *url.URL) (Emitter, error) {
+		target := *u
+		target.Scheme = strings.TrimPrefix(u.Scheme, "influx+")
+		return &influxEmitter{url: target.String(), client: &http.Client{Timeout: 30 * time.Second}}, nil
+	}
+	Register("influx+http", influx)
+	Register("influx+https", influx)
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPush(t *testing.T) {
+	_, err := NewEmitter("carbon://localhost:2003")
+	assert.Error(t, err, "Unknown scheme accepted")
+	_, err = NewPusher(nil, time.Minute, func() []string { return nil })
+	assert.Error(t, err, "Pusher without emitters created")
+
+	Observe("push", "create", "vol.1", time.Now(), nil)
+	drivers := func() []string { return []string{"push"} }
+
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		assert.Equal(t, "osd", r.URL.Query().Get("db"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	influx, err := NewEmitter("influx+" + srv.URL + "/write?db=osd")
+	assert.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	lines := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var got []string
+		for s := bufio.NewScanner(conn); s.Scan(); {
+			got = append(got, s.Text())
+		}
+		lines <- got
+	}()
+	graphite, err := NewEmitter("graphite://" + l.Addr().String())
+	assert.NoError(t, err)
+
+	p, err := NewPusher([]Emitter{influx, graphite}, time.Minute, drivers)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Push())
+
+	assert.Contains(t, body, "osd_operations_total,driver=push,op=create value=1 ")
+	assert.Contains(t, body, "osd_volume_operations_total,driver=push,volume=vol.1,op=create value=1 ")
+	got := strings.Join(<-lines, "\n")
+	assert.Contains(t, got, "osd.operations_total.push.create 1 ")
+	assert.Contains(t, got, "osd.volume_operations_total.push.vol_1.create 1 ")
+}
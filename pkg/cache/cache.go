@@ -0,0 +1,365 @@
+// Package cache fronts slow block devices with a fast local cache device
+// using the dm-cache device mapper target.
+//
+// The cache device is split into a metadata and a data device and the cached
+// device is created as /dev/mapper/osd-cache-<name> over the origin. bcache
+// is not supported, it must format the backing device and so cannot be
+// assembled over a volume that already holds data.
+package cache
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// DefaultBlockSize cache block size in bytes if the spec sets none.
+	DefaultBlockSize = 256 << 10
+	// FlushTimeout longest Teardown waits for a writeback cache to flush.
+	FlushTimeout = 10 * time.Minute
+
+	devPrefix    = "osd-cache-"
+	mapperDir    = "/dev/mapper/"
+	sectorSize   = 512
+	minBlockSize = 32 << 10
+	flushPoll    = time.Second
+)
+
+// dmsetup runs dmsetup with args. It is replaced in tests.
+var dmsetup = func(args ...string) (string, error) {
+	return run("dmsetup", args...)
+}
+
+// sectors returns the size of a block device in sectors. It is replaced in
+// tests.
+var sectors = func(dev string) (uint64, error) {
+	out, err := run("blockdev", "--getsz", dev)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+}
+
+func run(cmd string, args ...string) (string, error) {
+	out, err := exec.Command(cmd, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %v: %s",
+			cmd, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+var (
+	devicesLock sync.Mutex
+	// devices the caches may be assembled on, none until SetDevices.
+	devices []string
+)
+
+// SetDevices sets the local devices of this node volumes may be cached on,
+// from the node configuration. Their contents are overwritten by the caches.
+func SetDevices(devs []string) {
+	devicesLock.Lock()
+	defer devicesLock.Unlock()
+	devices = nil
+	for _, dev := range devs {
+		devices = append(devices, resolve(dev))
+	}
+}
+
+// Allowed returns true if dev is one of the cache devices of this node.
+func Allowed(dev string) bool {
+	dev = resolve(dev)
+	devicesLock.Lock()
+	defer devicesLock.Unlock()
+	for _, d := range devices {
+		if d == dev {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the path dev links to, such as the device of a
+// /dev/disk/by-id link.
+func resolve(dev string) string {
+	if p, err := filepath.EvalSymlinks(dev); err == nil {
+		return p
+	}
+	return filepath.Clean(dev)
+}
+
+func cacheName(name string) string { return devPrefix + name }
+func metaName(name string) string  { return devPrefix + name + "-meta" }
+func dataName(name string) string  { return devPrefix + name + "-data" }
+
+// DevicePath is the path of the cached device of name.
+func DevicePath(name string) string {
+	return mapperDir + cacheName(name)
+}
+
+// Assembled returns true if the cached device of name exists.
+func Assembled(name string) bool {
+	_, err := os.Stat(DevicePath(name))
+	return err == nil
+}
+
+// Path returns the cached device of name if it is assembled, origin
+// otherwise. Drivers mount and format the returned path.
+func Path(name, origin string) string {
+	if Assembled(name) {
+		return DevicePath(name)
+	}
+	return origin
+}
+
+// layout is the split of a cache device into metadata and data, in sectors.
+type layout struct {
+	block uint64
+	meta  uint64
+	data  uint64
+}
+
+// newLayout splits a cache device of size sectors into metadata and data
+// for cache blocks of blockSize bytes. dm-cache needs 4MiB plus 16 bytes per
+// cache block of metadata.
+func newLayout(size, blockSize uint64) (*layout, error) {
+	if blockSize == 0 {
+		blockSize = DefaultBlockSize
+	}
+	if blockSize%minBlockSize != 0 {
+		return nil, fmt.Errorf("Cache block size %d is not a multiple of %d", blockSize, minBlockSize)
+	}
+	l := &layout{block: blockSize / sectorSize}
+	blocks := size / l.block
+	l.meta = ((4 << 20) + 16*blocks + sectorSize - 1) / sectorSize
+	if l.meta >= size {
+		return nil, fmt.Errorf("Cache device of %d sectors is too small", size)
+	}
+	l.data = (size - l.meta) / l.block * l.block
+	if l.data == 0 {
+		return nil, fmt.Errorf("Cache device of %d sectors is too small", size)
+	}
+	return l, nil
+}
+
+func cacheTable(name, origin string, size uint64, l *layout, mode api.CacheMode) string {
+	if mode == "" {
+		mode = api.CacheWritethrough
+	}
+	return fmt.Sprintf("0 %d cache %s %s %s %d 1 %s default 0",
+		size, mapperDir+metaName(name), mapperDir+dataName(name), origin, l.block, mode)
+}
+
+// Assemble creates the cached device of name over origin on spec.Device and
+// returns its path. A writethrough cache starts cold. A writeback cache keeps
+// the blocks left dirty by a crash, so that they are not lost. The device
+// must be one of the cache devices of this node, see SetDevices.
+func Assemble(name, origin string, spec *api.CacheSpec) (string, error) {
+	if spec == nil || spec.Device == "" {
+		return "", fmt.Errorf("No cache device for %s", name)
+	}
+	if !Allowed(spec.Device) {
+		return "", fmt.Errorf("Device %s is not a cache device of this node", spec.Device)
+	}
+	if Assembled(name) {
+		return DevicePath(name), nil
+	}
+	size, err := sectors(spec.Device)
+	if err != nil {
+		return "", err
+	}
+	l, err := newLayout(size, spec.BlockSize)
+	if err != nil {
+		return "", err
+	}
+	originSize, err := sectors(origin)
+	if err != nil {
+		return "", err
+	}
+	if _, err = dmsetup("create", metaName(name), "--table",
+		fmt.Sprintf("0 %d linear %s 0", l.meta, spec.Device)); err != nil {
+		return "", err
+	}
+	if _, err = dmsetup("create", dataName(name), "--table",
+		fmt.Sprintf("0 %d linear %s %d", l.data, spec.Device, l.meta)); err != nil {
+		removeAll(metaName(name))
+		return "", err
+	}
+	table := cacheTable(name, origin, originSize, l, spec.Mode)
+	if spec.Mode != api.CacheWriteback {
+		err = zeroMeta(name)
+	}
+	if err == nil {
+		if _, err = dmsetup("create", cacheName(name), "--table", table); err != nil &&
+			spec.Mode == api.CacheWriteback {
+			// The metadata is not valid, this is a new cache.
+			if err = zeroMeta(name); err == nil {
+				_, err = dmsetup("create", cacheName(name), "--table", table)
+			}
+		}
+	}
+	if err != nil {
+		removeAll(dataName(name), metaName(name))
+		return "", err
+	}
+	return DevicePath(name), nil
+}
+
+// Teardown flushes the dirty blocks of the cached device of name to its
+// origin and removes it. The cache metadata is cleared so that the next
+// Assemble starts cold, the origin may change while it is not cached.
+func Teardown(name string) error {
+	if !Assembled(name) {
+		return nil
+	}
+	table, err := dmsetup("table", cacheName(name))
+	if err != nil {
+		return err
+	}
+	if strings.Contains(table, " "+string(api.CacheWriteback)+" ") {
+		if err = flush(name, table); err != nil {
+			return err
+		}
+	}
+	if _, err = dmsetup("remove", cacheName(name)); err != nil {
+		return err
+	}
+	if err = zeroMeta(name); err != nil {
+		return err
+	}
+	return removeAll(dataName(name), metaName(name))
+}
+
+// Flush writes the dirty blocks of the cached device of name to its origin
+// and keeps them written back until the returned function restores the
+// policy of the cache. Writethrough caches have no dirty blocks, the function
+// then does nothing.
+func Flush(name string) (func() error, error) {
+	done := func() error { return nil }
+	if !Assembled(name) {
+		return done, nil
+	}
+	table, err := dmsetup("table", cacheName(name))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(table, " "+string(api.CacheWriteback)+" ") {
+		return done, nil
+	}
+	restore := func() error {
+		for _, args := range [][]string{
+			{"reload", cacheName(name), "--table", strings.TrimSpace(table)},
+			{"suspend", cacheName(name)},
+			{"resume", cacheName(name)},
+		} {
+			if _, err := dmsetup(args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err = flush(name, table); err != nil {
+		if rerr := restore(); rerr != nil {
+			return nil, fmt.Errorf("%v, and failed to restore the cache policy: %v", err, rerr)
+		}
+		return nil, err
+	}
+	return restore, nil
+}
+
+// flush switches the cache of name to the cleaner policy and waits until it
+// has no dirty blocks.
+func flush(name, table string) error {
+	cleaner, err := cleanerTable(table)
+	if err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"reload", cacheName(name), "--table", cleaner},
+		{"suspend", cacheName(name)},
+		{"resume", cacheName(name)},
+	} {
+		if _, err = dmsetup(args...); err != nil {
+			return err
+		}
+	}
+	deadline := time.Now().Add(FlushTimeout)
+	for {
+		status, err := dmsetup("status", cacheName(name))
+		if err != nil {
+			return err
+		}
+		dirty, err := dirtyBlocks(status)
+		if err != nil {
+			return err
+		}
+		if dirty == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Cache of %s still has %d dirty blocks after %v", name, dirty, FlushTimeout)
+		}
+		time.Sleep(flushPoll)
+	}
+}
+
+// cleanerTable returns table, a cache target table, with its policy replaced
+// by cleaner.
+//
+//	<start> <len> cache <meta> <data> <origin> <block> <#features> <features>* <policy> <#args> <args>*
+func cleanerTable(table string) (string, error) {
+	f := strings.Fields(table)
+	if len(f) < 10 || f[2] != "cache" {
+		return "", fmt.Errorf("Not a cache table: %q", table)
+	}
+	n, err := strconv.Atoi(f[7])
+	if err != nil || len(f) < 10+n {
+		return "", fmt.Errorf("Not a cache table: %q", table)
+	}
+	return strings.Join(append(f[:8+n], "cleaner", "0"), " "), nil
+}
+
+// dirtyBlocks returns the number of dirty blocks in the status of a cache
+// target.
+//
+//	<start> <len> cache <meta block> <used>/<total> <cache block> <used>/<total>
+//	<read hits> <read misses> <write hits> <write misses> <demotions> <promotions> <dirty> ...
+func dirtyBlocks(status string) (uint64, error) {
+	f := strings.Fields(status)
+	if len(f) < 14 || f[2] != "cache" {
+		return 0, fmt.Errorf("Not a cache status: %q", status)
+	}
+	return strconv.ParseUint(f[13], 10, 64)
+}
+
+// zeroMeta clears the superblock of the cache metadata of name, so that
+// dm-cache formats it anew.
+func zeroMeta(name string) error {
+	f, err := os.OpenFile(mapperDir+metaName(name), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(make([]byte, 4096)); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func removeAll(devs ...string) error {
+	var first error
+	for _, dev := range devs {
+		if _, err := dmsetup("remove", dev); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
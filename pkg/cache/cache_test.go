@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestLayout(t *testing.T) {
+	// 10GiB of 256KiB blocks.
+	l, err := newLayout(10<<21, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(512), l.block)
+	assert.Equal(t, uint64(8192+1280), l.meta)
+	assert.Equal(t, uint64(0), l.data%l.block)
+	assert.True(t, l.meta+l.data <= 10<<21)
+
+	_, err = newLayout(10<<21, 4096)
+	assert.Error(t, err, "block size not a multiple of 32KiB")
+	_, err = newLayout(8192, 0)
+	assert.Error(t, err, "device smaller than metadata")
+
+	assert.Equal(t, "0 2048 cache /dev/mapper/osd-cache-v1-meta /dev/mapper/osd-cache-v1-data /dev/sdb 512 1 writethrough default 0",
+		cacheTable("v1", "/dev/sdb", 2048, l, ""))
+}
+
+func TestCleanerTable(t *testing.T) {
+	table, err := cleanerTable("0 2048 cache 253:0 253:1 8:16 512 1 writeback default 0\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "0 2048 cache 253:0 253:1 8:16 512 1 writeback cleaner 0", table)
+
+	table, err = cleanerTable("0 2048 cache 253:0 253:1 8:16 512 2 writeback metadata2 smq 2 migration_threshold 2048")
+	assert.NoError(t, err)
+	assert.Equal(t, "0 2048 cache 253:0 253:1 8:16 512 2 writeback metadata2 cleaner 0", table)
+
+	_, err = cleanerTable("0 2048 linear 8:16 0")
+	assert.Error(t, err)
+}
+
+func TestDirtyBlocks(t *testing.T) {
+	dirty, err := dirtyBlocks("0 2048 cache 8 27/2048 512 100/1000 50 20 30 10 0 100 42 1 writeback 2 " +
+		"migration_threshold 2048 smq 0 rw -")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), dirty)
+
+	_, err = dirtyBlocks("0 2048 linear")
+	assert.Error(t, err)
+}
+
+func TestAssembleNoDevice(t *testing.T) {
+	_, err := Assemble("v1", "/dev/sdb", &api.CacheSpec{})
+	assert.Error(t, err)
+	assert.Equal(t, "/dev/sdb", Path("v1", "/dev/sdb"))
+}
+
+func TestAssembleNotAllowed(t *testing.T) {
+	_, err := Assemble("v1", "/dev/sdb", &api.CacheSpec{Device: "/dev/sdc"})
+	assert.Error(t, err, "Cache assembled on a device not configured")
+	SetDevices([]string{"/dev/sdc"})
+	defer SetDevices(nil)
+	assert.True(t, Allowed("/dev/sdc"))
+	assert.False(t, Allowed("/dev/sdd"))
+}
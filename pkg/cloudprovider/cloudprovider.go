@@ -0,0 +1,171 @@
+// Package cloudprovider holds the helpers shared by the drivers of cloud
+// block storage: instance metadata, calls to JSON REST APIs and discovery of
+// the device path of attached disks.
+package cloudprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Client.Do when the resource does not exist.
+var ErrNotFound = errors.New("Resource not found")
+
+var metadataClient = &http.Client{Timeout: 10 * time.Second}
+
+// Metadata retrieves the instance metadata at url with the request headers
+// the metadata service requires.
+func Metadata(url string, header http.Header) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := metadataClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("Error querying metadata %s: code %d returned", url, res.StatusCode)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("Error querying metadata %s: %v", url, err)
+	}
+	if len(body) == 0 {
+		return "", fmt.Errorf("Failed to retrieve metadata %s: empty response", url)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// TokenSource returns the bearer token API requests are authorized with.
+type TokenSource func() (string, error)
+
+// StaticToken is a TokenSource that always returns token.
+func StaticToken(token string) TokenSource {
+	return func() (string, error) {
+		return token, nil
+	}
+}
+
+// Client calls the JSON REST API of a cloud provider.
+type Client struct {
+	base   string
+	token  TokenSource
+	client *http.Client
+}
+
+// NewClient returns a Client of the API at base, authorized by token.
+func NewClient(base string, token TokenSource) *Client {
+	return &Client{
+		base:   strings.TrimSuffix(base, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Do sends in as the JSON body of a method request to path, relative to the
+// base of the API unless it is a URL, and decodes the JSON response into out.
+// in and out may be nil.
+// Errors ErrNotFound may be returned.
+func (c *Client) Do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	url := path
+	if !strings.HasPrefix(path, "https://") && !strings.HasPrefix(path, "http://") {
+		url = c.base + "/" + strings.TrimPrefix(path, "/")
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	token, err := c.token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= 300:
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s failed: %s: %s",
+			method, path, resp.Status, strings.TrimSpace(string(b)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("%s %s returned an invalid response: %v", method, path, err)
+	}
+	return nil
+}
+
+// Poll calls done every interval until it returns true or an error, or
+// until timeout expires.
+func Poll(interval, timeout time.Duration, done func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := done()
+		if err != nil || ok {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out after %v", timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// DevicePath waits up to timeout for the link udev creates for an attached
+// disk, e.g. /dev/disk/by-id/google-<name>, and returns the device it points
+// to.
+func DevicePath(link string, timeout time.Duration) (string, error) {
+	var dev string
+	err := Poll(time.Second, timeout, func() (bool, error) {
+		var err error
+		if dev, err = filepath.EvalSymlinks(link); err == nil {
+			return true, nil
+		}
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("Device %s is not available: %v", link, err)
+	}
+	return dev, nil
+}
+
+// GiB returns size in GiB, rounded up.
+func GiB(size uint64) int64 {
+	return int64((size + (1 << 30) - 1) >> 30)
+}
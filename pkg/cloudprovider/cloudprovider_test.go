@@ -0,0 +1,89 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/volumes":
+			var in map[string]string
+			json.NewDecoder(r.Body).Decode(&in)
+			json.NewEncoder(w).Encode(map[string]string{"id": "v1", "name": in["name"]})
+		case "/v2/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL+"/v2/", StaticToken("secret"))
+	var out map[string]string
+	assert.NoError(t, c.Do("POST", "volumes", map[string]string{"name": "vol"}, &out), "Failed to call API")
+	assert.Equal(t, "v1", out["id"], "Unexpected response")
+	assert.Equal(t, "vol", out["name"], "Request body should be sent")
+	assert.NoError(t, c.Do("DELETE", srv.URL+"/v2/empty", nil, &out), "Failed to call API by URL")
+	assert.Equal(t, ErrNotFound, c.Do("GET", "missing", nil, nil), "Missing resource should not be found")
+
+	c = NewClient(srv.URL+"/v2", StaticToken("wrong"))
+	assert.Error(t, c.Do("GET", "volumes", nil, nil), "Unauthorized request should fail")
+}
+
+func TestMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("us-central1-a\n"))
+	}))
+	defer srv.Close()
+
+	zone, err := Metadata(srv.URL, http.Header{"Metadata-Flavor": []string{"Google"}})
+	assert.NoError(t, err, "Failed to query metadata")
+	assert.Equal(t, "us-central1-a", zone, "Unexpected metadata")
+	_, err = Metadata(srv.URL, nil)
+	assert.Error(t, err, "Metadata without the required header should fail")
+}
+
+func TestDevicePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudprovider")
+	assert.NoError(t, err, "Failed to create directory")
+	defer os.RemoveAll(dir)
+
+	dev := path.Join(dir, "sdb")
+	link := path.Join(dir, "google-osd-vol")
+	_, err = DevicePath(link, 0)
+	assert.Error(t, err, "Missing device should not be found")
+
+	assert.NoError(t, ioutil.WriteFile(dev, nil, 0600), "Failed to create device")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.Symlink(dev, link)
+	}()
+	p, err := DevicePath(link, 5*time.Second)
+	assert.NoError(t, err, "Failed to wait for device")
+	assert.Equal(t, dev, p, "Link should resolve to the device")
+}
+
+func TestGiB(t *testing.T) {
+	assert.Equal(t, int64(0), GiB(0))
+	assert.Equal(t, int64(1), GiB(1))
+	assert.Equal(t, int64(1), GiB(1<<30))
+	assert.Equal(t, int64(2), GiB(1<<30+1))
+}
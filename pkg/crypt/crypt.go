@@ -0,0 +1,120 @@
+// Package crypt encrypts block devices with LUKS and the dm-crypt device
+// mapper target, for block drivers whose backends do not encrypt.
+//
+// The encrypted device is created as /dev/mapper/osd-crypt-<name> over the
+// origin, which is formatted for LUKS on first use if the caller allows it.
+// Origins that hold data other than a LUKS header, or whose contents cannot
+// be probed, are never formatted, so that a volume written in the clear is
+// not wiped.
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+const (
+	devPrefix = "osd-crypt-"
+	mapperDir = "/dev/mapper/"
+)
+
+// ErrNotEncrypted is returned when the origin holds no LUKS header and may
+// not be formatted.
+var ErrNotEncrypted = errors.New("Device is not encrypted")
+
+// cryptsetup runs cryptsetup with args and the passphrase on its standard
+// input. It is replaced in tests.
+var cryptsetup = func(passphrase string, args ...string) (string, error) {
+	cmd := exec.Command("cryptsetup", args...)
+	cmd.Stdin = strings.NewReader(passphrase)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("cryptsetup %s failed: %v: %s",
+			strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// fsType returns the type of the data dev holds, empty if none is found. It
+// is replaced in tests.
+var fsType = func(dev string) (string, error) {
+	out, err := exec.Command("blkid", "-p", "-s", "TYPE", "-o", "value", dev).Output()
+	if err != nil {
+		// blkid exits with 2 if the device holds no known signature.
+		if e, ok := err.(*exec.ExitError); ok {
+			if status, ok := e.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 2 {
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("Failed to probe %s: %v", dev, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func cryptName(name string) string { return devPrefix + name }
+
+// DevicePath is the path of the encrypted device of name.
+func DevicePath(name string) string {
+	return mapperDir + cryptName(name)
+}
+
+// Assembled returns true if the encrypted device of name exists.
+func Assembled(name string) bool {
+	_, err := os.Stat(DevicePath(name))
+	return err == nil
+}
+
+// Path returns the encrypted device of name if it is assembled, origin
+// otherwise.
+func Path(name, origin string) string {
+	if Assembled(name) {
+		return DevicePath(name)
+	}
+	return origin
+}
+
+// Assemble opens the encrypted device of name over origin with passphrase
+// and returns its path. Empty origins are formatted for LUKS first if format
+// is set.
+// Errors ErrNotEncrypted may be returned.
+func Assemble(name, origin, passphrase string, format bool) (string, error) {
+	if Assembled(name) {
+		return DevicePath(name), nil
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("No passphrase to encrypt %s with", name)
+	}
+	typ, err := fsType(origin)
+	if err != nil {
+		return "", err
+	}
+	switch typ {
+	case "crypto_LUKS":
+	case "":
+		if !format {
+			return "", ErrNotEncrypted
+		}
+		if _, err := cryptsetup(passphrase, "luksFormat", "--batch-mode", "--key-file=-", origin); err != nil {
+			return "", err
+		}
+	default:
+		return "", ErrNotEncrypted
+	}
+	if _, err := cryptsetup(passphrase, "open", "--type", "luks", "--key-file=-", origin, cryptName(name)); err != nil {
+		return "", err
+	}
+	return DevicePath(name), nil
+}
+
+// Teardown closes the encrypted device of name.
+func Teardown(name string) error {
+	if !Assembled(name) {
+		return nil
+	}
+	_, err := cryptsetup("", "close", cryptName(name))
+	return err
+}
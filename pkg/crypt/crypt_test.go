@@ -0,0 +1,52 @@
+package crypt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssemble(t *testing.T) {
+	var calls [][]string
+	cryptsetup = func(passphrase string, args ...string) (string, error) {
+		assert.Equal(t, "secret", passphrase)
+		calls = append(calls, args)
+		return "", nil
+	}
+	origin := ""
+	var probeErr error
+	fsType = func(dev string) (string, error) { return origin, probeErr }
+
+	_, err := Assemble("v1", "/dev/sdb", "", true)
+	assert.Error(t, err, "Device encrypted without a passphrase")
+
+	_, err = Assemble("v1", "/dev/sdb", "secret", false)
+	assert.Equal(t, ErrNotEncrypted, err)
+	assert.Empty(t, calls, "Device not created with the layer formatted")
+
+	path, err := Assemble("v1", "/dev/sdb", "secret", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/mapper/osd-crypt-v1", path)
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, []string{"luksFormat", "--batch-mode", "--key-file=-", "/dev/sdb"}, calls[0])
+		assert.Equal(t, []string{"open", "--type", "luks", "--key-file=-", "/dev/sdb", "osd-crypt-v1"}, calls[1])
+	}
+
+	calls = nil
+	origin = "crypto_LUKS"
+	_, err = Assemble("v1", "/dev/sdb", "secret", false)
+	assert.NoError(t, err)
+	assert.Len(t, calls, 1, "LUKS device formatted again")
+
+	calls = nil
+	origin = "ext4"
+	_, err = Assemble("v1", "/dev/sdb", "secret", true)
+	assert.Equal(t, ErrNotEncrypted, err)
+	assert.Empty(t, calls, "Device holding data formatted")
+
+	origin, probeErr = "", errors.New("blkid failed")
+	_, err = Assemble("v1", "/dev/sdb", "secret", true)
+	assert.Error(t, err, "Device that could not be probed assembled")
+	assert.Empty(t, calls, "Device that could not be probed formatted")
+}
@@ -0,0 +1,167 @@
+// Package diff is the stream format of the changes between two snapshots of
+// a volume, as returned by SnapDiff. A stream starts with the Magic line and
+// is followed by records. Each record is a JSON encoded Header on a line of
+// its own followed by Header.Length bytes of data.
+//
+// File drivers describe changes to files: a Create record carries the whole
+// contents of a file, directory or symlink that is new or changed, and a
+// Delete record removes a path and everything below it. Block drivers
+// describe changed extents with Write records carrying the data at Offset.
+package diff
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Magic is the first line of a diff stream.
+const Magic = "osd-diff v1"
+
+// Op is the change a record makes.
+type Op string
+
+const (
+	// OpCreate creates or replaces Path with the record data.
+	OpCreate = Op("create")
+	// OpDelete removes Path and everything below it.
+	OpDelete = Op("delete")
+	// OpWrite writes the record data at Offset of a block volume.
+	OpWrite = Op("write")
+)
+
+// Kind is the type of file a Create record creates.
+type Kind string
+
+const (
+	KindFile    = Kind("file")
+	KindDir     = Kind("dir")
+	KindSymlink = Kind("symlink")
+)
+
+// Header describes a record of a diff stream.
+type Header struct {
+	Op Op
+	// Kind of file created by OpCreate.
+	Kind Kind `json:",omitempty"`
+	// Path of the file relative to the root of the volume, for file
+	// changes.
+	Path string `json:",omitempty"`
+	// Mode permission bits of the file created.
+	Mode os.FileMode `json:",omitempty"`
+	// Target of the symlink created.
+	Target string `json:",omitempty"`
+	// Offset in bytes of the extent written, for block changes.
+	Offset int64 `json:",omitempty"`
+	// Length number of data bytes that follow the header.
+	Length int64 `json:",omitempty"`
+}
+
+var (
+	// ErrFormat is returned for streams that are not in the diff format.
+	ErrFormat = errors.New("Invalid diff stream")
+)
+
+// Writer writes a diff stream.
+type Writer struct {
+	w      *bufio.Writer
+	header bool
+}
+
+// NewWriter returns a Writer of a diff stream to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write writes a record of h.Length bytes read from data, which may be nil
+// if h.Length is 0.
+func (w *Writer) Write(h *Header, data io.Reader) error {
+	if !w.header {
+		if _, err := w.w.WriteString(Magic + "\n"); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	if _, err = w.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if h.Length == 0 {
+		return nil
+	}
+	n, err := io.CopyN(w.w, data, h.Length)
+	if err == io.EOF {
+		return fmt.Errorf("Short data for %s %s: %d of %d bytes", h.Op, h.Path, n, h.Length)
+	}
+	return err
+}
+
+// Close flushes the stream. An empty stream is written as the Magic line.
+func (w *Writer) Close() error {
+	if !w.header {
+		if _, err := w.w.WriteString(Magic + "\n"); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	return w.w.Flush()
+}
+
+// Reader reads a diff stream. Next advances to the next record, whose data
+// is then read from the Reader itself.
+type Reader struct {
+	r      *bufio.Reader
+	header bool
+	data   io.Reader
+}
+
+// NewReader returns a Reader of the diff stream in r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next skips the data of the current record and returns the header of the
+// next one. It returns io.EOF at the end of the stream.
+// Errors ErrFormat may be returned.
+func (r *Reader) Next() (*Header, error) {
+	if !r.header {
+		line, err := r.r.ReadString('\n')
+		if err != nil || line != Magic+"\n" {
+			return nil, ErrFormat
+		}
+		r.header = true
+	}
+	if r.data != nil {
+		if _, err := io.Copy(ioutil.Discard, r.data); err != nil {
+			return nil, err
+		}
+	}
+	line, err := r.r.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, ErrFormat
+	}
+	var h Header
+	if err = json.Unmarshal(line, &h); err != nil || h.Length < 0 {
+		return nil, ErrFormat
+	}
+	r.data = io.LimitReader(r.r, h.Length)
+	return &h, nil
+}
+
+// Read reads the data of the current record.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.data == nil {
+		return 0, io.EOF
+	}
+	return r.data.Read(p)
+}
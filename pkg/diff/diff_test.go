@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func write(t *testing.T, root, rel, data string) {
+	p := filepath.Join(root, rel)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755), "Failed to create dir")
+	assert.NoError(t, ioutil.WriteFile(p, []byte(data), 0644), "Failed to write file")
+}
+
+func read(t *testing.T, root, rel string) string {
+	b, err := ioutil.ReadFile(filepath.Join(root, rel))
+	assert.NoError(t, err, "Failed to read %s", rel)
+	return string(b)
+}
+
+func TestDirs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "diff")
+	assert.NoError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(tmp)
+	from, to, backup := filepath.Join(tmp, "from"), filepath.Join(tmp, "to"), filepath.Join(tmp, "backup")
+
+	write(t, from, "keep", "same")
+	write(t, from, "change", "old")
+	write(t, from, "gone/file", "bye")
+	write(t, to, "keep", "same")
+	write(t, to, "change", "new contents")
+	write(t, to, "dir/added", "hello")
+	assert.NoError(t, os.Symlink("keep", filepath.Join(to, "link")), "Failed to symlink")
+	mtime := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(from, "keep"), mtime, mtime)
+	os.Chtimes(filepath.Join(to, "keep"), mtime, mtime)
+
+	// A full diff restores the from tree.
+	os.MkdirAll(backup, 0755)
+	assert.NoError(t, Apply(Dirs("", from), backup), "Failed to apply full diff")
+	assert.Equal(t, "bye", read(t, backup, "gone/file"), "Full diff should copy everything")
+
+	// An incremental diff carries only the changes.
+	r := Dirs(from, to)
+	b, err := ioutil.ReadAll(r)
+	assert.NoError(t, err, "Failed to read diff")
+	assert.False(t, strings.Contains(string(b), `"Path":"keep"`), "Unchanged file should not be in the diff")
+	assert.NoError(t, Apply(strings.NewReader(string(b)), backup), "Failed to apply diff")
+	assert.Equal(t, "new contents", read(t, backup, "change"), "Changed file should be updated")
+	assert.Equal(t, "hello", read(t, backup, "dir/added"), "Added file should be created")
+	_, err = os.Stat(filepath.Join(backup, "gone"))
+	assert.True(t, os.IsNotExist(err), "Deleted dir should be removed")
+	target, err := os.Readlink(filepath.Join(backup, "link"))
+	assert.NoError(t, err, "Symlink should be created")
+	assert.Equal(t, "keep", target, "Unexpected symlink target")
+
+	assert.Equal(t, ErrFormat, Apply(strings.NewReader("garbage\n"), backup), "Invalid stream should fail")
+}
+
+func TestApplyEscape(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "diff")
+	assert.NoError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(tmp)
+	root := filepath.Join(tmp, "root")
+	os.MkdirAll(root, 0755)
+
+	stream := Magic + "\n" +
+		`{"Op":"create","Kind":"symlink","Path":"out","Target":"` + tmp + `"}` + "\n" +
+		`{"Op":"create","Kind":"file","Path":"out/escaped","Length":1}` + "\nx"
+	assert.Equal(t, ErrFormat, Apply(strings.NewReader(stream), root), "Paths through symlinks out of root should fail")
+	_, err = os.Stat(filepath.Join(tmp, "escaped"))
+	assert.True(t, os.IsNotExist(err), "File should not be written out of root")
+}
+
+func TestFingerprint(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "fingerprint")
+	assert.NoError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(tmp)
+	src, restored := filepath.Join(tmp, "src"), filepath.Join(tmp, "restored")
+
+	write(t, src, "keep", "same")
+	write(t, src, "dir/change", "old")
+	os.MkdirAll(restored, 0755)
+	assert.NoError(t, Apply(Dirs("", src), restored), "Failed to apply full diff")
+
+	sum, _, stats, err := Fingerprint(src, "", nil)
+	assert.NoError(t, err, "Failed to fingerprint")
+	assert.Equal(t, 2, stats.Hashed)
+	restoredSum, _, _, err := Fingerprint(restored, "", nil)
+	assert.NoError(t, err, "Failed to fingerprint")
+	assert.Equal(t, sum, restoredSum, "Restored tree should have the same fingerprint")
+
+	write(t, restored, "dir/change", "new")
+	mtime := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(src, "keep"), mtime, mtime)
+	os.Chtimes(filepath.Join(restored, "keep"), mtime, mtime)
+	_, m, _, err := Fingerprint(src, "", nil)
+	assert.NoError(t, err, "Failed to fingerprint")
+	changedSum, _, stats, err := Fingerprint(restored, src, m)
+	assert.NoError(t, err, "Failed to fingerprint")
+	assert.NotEqual(t, sum, changedSum, "Changed tree should have another fingerprint")
+	assert.Equal(t, 1, stats.Hashed, "Changed file should be hashed")
+	assert.Equal(t, 1, stats.Reused, "Unchanged file should reuse its sum")
+}
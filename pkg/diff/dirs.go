@@ -0,0 +1,191 @@
+package diff
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dirs streams the changes that turn directory from into directory to,
+// comparing files by type, mode, size and modification time. Everything in
+// to is streamed if from is empty. The stream is produced as it is read,
+// closing it stops the walk.
+func Dirs(from, to string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeDirs(NewWriter(pw), from, to))
+	}()
+	return pr
+}
+
+func writeDirs(w *Writer, from, to string) error {
+	// Deleted paths first, so that a path replaced by one of another kind
+	// is removed before it is created again.
+	if from != "" {
+		err := filepath.Walk(from, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(from, p)
+			if err != nil || rel == "." {
+				return err
+			}
+			if _, err = os.Lstat(filepath.Join(to, rel)); os.IsNotExist(err) {
+				if err = w.Write(&Header{Op: OpDelete, Path: rel}, nil); err != nil {
+					return err
+				}
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err := filepath.Walk(to, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(to, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if from != "" {
+			if old, err := os.Lstat(filepath.Join(from, rel)); err == nil && same(old, info) {
+				return nil
+			}
+		}
+		return writeFile(w, p, rel, info)
+	})
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// same returns true if a and b are the same file in both trees.
+func same(a, b os.FileInfo) bool {
+	if a.Mode() != b.Mode() {
+		return false
+	}
+	if a.IsDir() {
+		return true
+	}
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+func writeFile(w *Writer, p, rel string, info os.FileInfo) error {
+	h := &Header{Op: OpCreate, Path: rel, Mode: info.Mode().Perm()}
+	switch {
+	case info.IsDir():
+		h.Kind = KindDir
+		return w.Write(h, nil)
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		h.Kind = KindSymlink
+		h.Target = target
+		return w.Write(h, nil)
+	case info.Mode().IsRegular():
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h.Kind = KindFile
+		h.Length = info.Size()
+		return w.Write(h, f)
+	}
+	// Devices, sockets and pipes are not part of volume data.
+	return nil
+}
+
+// Apply applies the file changes of the diff stream in r to directory root.
+// Paths may not lead out of root.
+// Errors ErrFormat may be returned.
+func Apply(r io.Reader, root string) error {
+	d := NewReader(r)
+	for {
+		h, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p, err := path(root, h.Path)
+		if err != nil {
+			return err
+		}
+		switch h.Op {
+		case OpDelete:
+			err = os.RemoveAll(p)
+		case OpCreate:
+			err = create(d, h, p)
+		default:
+			return ErrFormat
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// path returns the path of rel within root. The parent directory of the
+// path, including any symlinks leading to it, must be within root.
+func path(root, rel string) (string, error) {
+	clean := filepath.Clean("/" + rel)
+	if clean == "/" {
+		return "", ErrFormat
+	}
+	p := filepath.Join(root, clean)
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(p))
+	if err != nil {
+		return "", err
+	}
+	if parent != root && !strings.HasPrefix(parent, root+string(filepath.Separator)) {
+		return "", ErrFormat
+	}
+	return p, nil
+}
+
+func create(r io.Reader, h *Header, p string) error {
+	if h.Kind != KindDir {
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	switch h.Kind {
+	case KindDir:
+		if info, err := os.Lstat(p); err == nil && !info.IsDir() {
+			os.Remove(p)
+		}
+		if err := os.MkdirAll(p, h.Mode); err != nil {
+			return err
+		}
+		return os.Chmod(p, h.Mode)
+	case KindSymlink:
+		return os.Symlink(h.Target, p)
+	case KindFile:
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, h.Mode)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return ErrFormat
+}
@@ -0,0 +1,94 @@
+package diff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Manifest maps the paths of the regular files of a tree to the SHA-256 of
+// their data, as computed by Fingerprint.
+type Manifest map[string]string
+
+// FingerprintStats counts the files hashed by Fingerprint.
+type FingerprintStats struct {
+	// Hashed files whose data was read.
+	Hashed int
+	// Reused files whose sum was taken from the base manifest.
+	Reused int
+}
+
+// Fingerprint returns the SHA-256 of the tree at dir: the path, kind and
+// permissions of each entry and the data of regular files and the target
+// of symlinks. Trees with the same content have the same fingerprint,
+// whatever their ownership and modification times. Devices, sockets and
+// pipes are left out, as in diff streams.
+//
+// If baseDir is set, regular files unchanged since the tree at baseDir,
+// compared as Dirs does, reuse their sum in base, the manifest of baseDir.
+// It returns the manifest of dir.
+func Fingerprint(dir, baseDir string, base Manifest) (string, Manifest, FingerprintStats, error) {
+	var stats FingerprintStats
+	m := make(Manifest)
+	tree := sha256.New()
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		var kind Kind
+		var sum string
+		switch {
+		case info.IsDir():
+			kind = KindDir
+		case info.Mode()&os.ModeSymlink != 0:
+			kind = KindSymlink
+			if sum, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			kind = KindFile
+			if s, ok := base[rel]; ok && baseDir != "" {
+				if old, err := os.Lstat(filepath.Join(baseDir, rel)); err == nil && same(old, info) {
+					sum = s
+					stats.Reused++
+				}
+			}
+			if sum == "" {
+				if sum, err = fileSum(p); err != nil {
+					return err
+				}
+				stats.Hashed++
+			}
+			m[rel] = sum
+		default:
+			return nil
+		}
+		_, err = fmt.Fprintf(tree, "%s\x00%s\x00%o\x00%s\n", rel, kind, info.Mode().Perm(), sum)
+		return err
+	})
+	if err != nil {
+		return "", nil, stats, err
+	}
+	return hex.EncodeToString(tree.Sum(nil)), m, stats, nil
+}
+
+// fileSum returns the SHA-256 of the data of the file at p.
+func fileSum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,204 @@
+// Package fs manages the filesystems on block volumes.
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const procMounts = "/proc/self/mounts"
+
+// ResizeFS grows the filesystem of v, a mounted volume, to the size of
+// device, the top device of its layers. It does nothing if the volume is not
+// attached and mounted on this node, the filesystem is grown when it is next
+// resized while mounted.
+func ResizeFS(v *api.Volume, device string) error {
+	if v.DevicePath == "" {
+		return nil
+	}
+	mountpath := v.AttachPath
+	if mountpath == "" {
+		var err error
+		if mountpath, err = Mountpoint(device); err != nil || mountpath == "" {
+			return err
+		}
+	}
+	format := v.Format
+	if format == "" && v.Spec != nil {
+		format = v.Spec.Format
+	}
+	if format == api.FsNone {
+		// Raw volumes have no filesystem, the device is all there is.
+		return nil
+	}
+	return Grow(format, device, mountpath)
+}
+
+// MountFormat returns the filesystem drivers mount v with: FsNone for raw
+// volumes, the filesystem v was formatted with otherwise. It fails for
+// volumes whose spec asks for a filesystem they were not formatted with yet,
+// which would otherwise be mounted as whatever the device holds.
+func MountFormat(v *api.Volume) (api.Filesystem, error) {
+	if v.Spec != nil && v.Spec.Format == api.FsNone {
+		return api.FsNone, nil
+	}
+	if v.Format == "" || v.Format == api.FsNone {
+		want := api.Filesystem("")
+		if v.Spec != nil {
+			want = v.Spec.Format
+		}
+		return "", fmt.Errorf("Volume %v is not formatted with filesystem %q yet", v.ID, want)
+	}
+	return v.Format, nil
+}
+
+// MountDevice mounts the format filesystem on device at mountpath. Raw volumes,
+// of format FsNone, have no filesystem: the device node itself is bind
+// mounted at mountpath for applications that manage raw devices, such as
+// databases. The file it is bound to is created if mountpath does not exist
+// or is an empty directory.
+func MountDevice(device, mountpath string, format api.Filesystem) error {
+	if format != api.FsNone {
+		return syscall.Mount(device, mountpath, string(format), 0, "")
+	}
+	if fi, err := os.Stat(mountpath); err == nil && fi.IsDir() {
+		// Only removes empty directories.
+		if err = os.Remove(mountpath); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(mountpath, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return syscall.Mount(device, mountpath, "", syscall.MS_BIND, "")
+}
+
+// Grow grows the format filesystem on device, mounted at mountpath, to the
+// size of device.
+func Grow(format api.Filesystem, device, mountpath string) error {
+	var cmd string
+	var args []string
+	switch format {
+	case api.FsExt4:
+		cmd, args = "resize2fs", []string{device}
+	case api.FsXfs:
+		cmd, args = "xfs_growfs", []string{mountpath}
+	default:
+		return fmt.Errorf("Cannot grow a %q filesystem", format)
+	}
+	out, err := exec.Command(cmd, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %v: %s",
+			cmd, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Check verifies the format filesystem on device without repairing it and
+// returns the problems reported, none if the filesystem is clean. The
+// filesystem must not be mounted.
+func Check(format api.Filesystem, device string) ([]string, error) {
+	var cmd string
+	var args []string
+	// corrupt is the exit status of cmd when it finds problems.
+	var corrupt int
+	switch format {
+	case api.FsExt4:
+		cmd, args, corrupt = "e2fsck", []string{"-n", "-f", device}, 4
+	case api.FsXfs:
+		cmd, args, corrupt = "xfs_repair", []string{"-n", device}, 1
+	default:
+		return nil, fmt.Errorf("Cannot check a %q filesystem", format)
+	}
+	out, err := exec.Command(cmd, args...).CombinedOutput()
+	if err == nil {
+		return nil, nil
+	}
+	if e, ok := err.(*exec.ExitError); ok {
+		if status, ok := e.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == corrupt {
+			return problems(string(out)), nil
+		}
+	}
+	return nil, fmt.Errorf("%s %s failed: %v: %s",
+		cmd, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+}
+
+// problems returns the non empty lines of the output of a check.
+func problems(out string) []string {
+	var lines []string
+	for _, l := range strings.Split(out, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// Ioctls of linux/fs.h that freeze and thaw a filesystem.
+const (
+	fiFreeze = 0xC0045877
+	fiThaw   = 0xC0045878
+)
+
+// Freeze blocks writes to the filesystem mounted at mountpath and flushes it
+// to disk, so that snapshots of its device are consistent. Thaw must be
+// called to resume writes.
+func Freeze(mountpath string) error {
+	return ioctl(mountpath, fiFreeze)
+}
+
+// Thaw resumes writes to the filesystem mounted at mountpath.
+func Thaw(mountpath string) error {
+	return ioctl(mountpath, fiThaw)
+}
+
+func ioctl(mountpath string, req uintptr) error {
+	f, err := os.Open(mountpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, 0); errno != 0 {
+		return fmt.Errorf("Failed to freeze or thaw %s: %v", mountpath, errno)
+	}
+	return nil
+}
+
+// Mountpoint returns the first path device is mounted on, empty if it is not
+// mounted.
+func Mountpoint(device string) (string, error) {
+	f, err := os.Open(procMounts)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return mountpoint(f, resolve(device))
+}
+
+func mountpoint(r io.Reader, device string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && resolve(fields[0]) == device {
+			return fields[1], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+func resolve(device string) string {
+	if p, err := filepath.EvalSymlinks(device); err == nil {
+		return p
+	}
+	return device
+}
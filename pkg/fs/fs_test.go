@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestMountpoint(t *testing.T) {
+	mounts := "proc /proc proc rw 0 0\n" +
+		"/dev/xvdf /var/lib/osd/mounts/v1 ext4 rw,relatime 0 0\n" +
+		"/dev/xvdf /mnt/other ext4 rw,relatime 0 0\n"
+	path, err := mountpoint(strings.NewReader(mounts), "/dev/xvdf")
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/lib/osd/mounts/v1", path)
+
+	path, err = mountpoint(strings.NewReader(mounts), "/dev/xvdg")
+	assert.NoError(t, err)
+	assert.Equal(t, "", path)
+}
+
+func TestGrowUnsupported(t *testing.T) {
+	assert.Error(t, Grow(api.FsZfs, "/dev/xvdf", "/mnt"))
+}
+
+func TestMountsOf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	vol := filepath.Join(dir, "v1")
+	assert.NoError(t, os.Mkdir(vol, 0755))
+
+	mountinfo := "22 1 0:20 / /proc rw,nosuid shared:5 - proc proc rw\n" +
+		"40 1 202:80 / /var/lib/osd/mounts/v2 rw,relatime - ext4 /dev/xvdf rw\n" +
+		"41 1 202:80 / /mnt/my\\040data rw,relatime shared:9 master:1 - ext4 /dev/xvdf rw\n" +
+		"50 1 0:45 / " + dir + " rw - nfs server:/export rw\n" +
+		"51 1 0:45 /v1 /var/lib/docker/volumes/v1 rw - nfs server:/export rw\n" +
+		"52 1 0:45 /v10 /var/lib/docker/volumes/v10 rw - nfs server:/export rw\n" +
+		"bogus line\n"
+	table, err := parseMountinfo(strings.NewReader(mountinfo))
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(table), "Invalid lines should be skipped")
+	assert.Equal(t, "/mnt/my data", table[2].Path, "Escapes should be decoded")
+	assert.Equal(t, "rw,relatime", table[2].Options)
+	assert.Equal(t, "rw", table[2].SuperOptions)
+
+	mounts := MountsOf(table, "/dev/xvdf")
+	assert.Equal(t, 2, len(mounts), "Every mount of the device should be found")
+
+	mounts = MountsOf(table, vol)
+	if assert.Equal(t, 1, len(mounts), "Bind mounts of the directory should be found") {
+		assert.Equal(t, "/var/lib/docker/volumes/v1", mounts[0].Path)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	procDir = dir
+	defer func() { procDir = "/proc" }()
+
+	proc := filepath.Join(dir, "42")
+	assert.NoError(t, os.MkdirAll(filepath.Join(proc, "fd"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(proc, "comm"), []byte("postgres\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(proc, "cgroup"),
+		[]byte("0::/docker/"+strings.Repeat("ab", 32)+"\n"), 0644))
+	assert.NoError(t, os.Symlink("/mnt/data/base/1", filepath.Join(proc, "fd", "3")))
+	other := filepath.Join(dir, "43")
+	assert.NoError(t, os.MkdirAll(other, 0755))
+	assert.NoError(t, os.Symlink("/mnt/database", filepath.Join(other, "cwd")))
+
+	users, err := Users("/mnt/data")
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(users), "Only processes under the path should be found") {
+		assert.Equal(t, 42, users[0].Pid)
+		assert.Equal(t, "postgres", users[0].Command)
+		assert.Equal(t, strings.Repeat("ab", 32), users[0].Container)
+	}
+}
+
+func TestMountFormat(t *testing.T) {
+	format, err := MountFormat(&api.Volume{Spec: &api.VolumeSpec{Format: api.FsNone}})
+	assert.NoError(t, err)
+	assert.Equal(t, api.FsNone, format, "Raw volume mounted with a filesystem")
+	_, err = MountFormat(&api.Volume{Spec: &api.VolumeSpec{Format: api.FsExt4}})
+	assert.Error(t, err, "Volume mounted before its filesystem is created")
+	format, err = MountFormat(&api.Volume{Format: api.FsXfs, Spec: &api.VolumeSpec{Format: api.FsXfs}})
+	assert.NoError(t, err)
+	assert.Equal(t, api.FsXfs, format)
+}
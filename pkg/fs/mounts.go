@@ -0,0 +1,206 @@
+package fs
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const procMountinfo = "/proc/self/mountinfo"
+
+// procDir is where processes are listed.
+var procDir = "/proc"
+
+// containerID matches the container IDs of docker and containerd in cgroup
+// paths.
+var containerID = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// Mount is an entry of the mount table.
+type Mount struct {
+	// Dev major:minor of the mounted filesystem.
+	Dev string
+	// Root of the mount within the filesystem, "/" unless it is a bind
+	// mount of a directory.
+	Root string
+	// Path the filesystem is mounted at.
+	Path string
+	// Fstype type of the filesystem.
+	Fstype string
+	// Source device or server path of the filesystem.
+	Source string
+	// Options the filesystem is mounted with.
+	Options string
+	// SuperOptions the super block of the filesystem has, such as the
+	// options of network filesystems.
+	SuperOptions string
+}
+
+// MountTable returns the mounts of this node.
+func MountTable() ([]Mount, error) {
+	f, err := os.Open(procMountinfo)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMountinfo(f)
+}
+
+// parseMountinfo parses the format of /proc/<pid>/mountinfo.
+func parseMountinfo(r io.Reader) ([]Mount, error) {
+	var mounts []Mount
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Optional fields end with "-" and are followed by the type,
+		// source and super block options.
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		m := Mount{
+			Dev:     fields[2],
+			Root:    unescape(fields[3]),
+			Path:    unescape(fields[4]),
+			Options: fields[5],
+			Fstype:  fields[sep+1],
+			Source:  unescape(fields[sep+2]),
+		}
+		if sep+3 < len(fields) {
+			m.SuperOptions = fields[sep+3]
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, scanner.Err()
+}
+
+// unescape decodes the octal escapes of spaces and other characters in the
+// mount table.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b = append(b, byte(n))
+				i += 3
+				continue
+			}
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+// MountsOf returns the mounts of source, a block device or a directory.
+// Directories match their bind mounts, which are mounts of the same
+// directory of the same filesystem.
+func MountsOf(table []Mount, source string) []Mount {
+	source = resolve(source)
+	fi, err := os.Stat(source)
+	if err != nil || !fi.IsDir() {
+		var mounts []Mount
+		for _, m := range table {
+			if resolve(m.Source) == source {
+				mounts = append(mounts, m)
+			}
+		}
+		return mounts
+	}
+	return dirMounts(table, source)
+}
+
+func dirMounts(table []Mount, dir string) []Mount {
+	// The filesystem of dir is the last mount of the longest path holding
+	// it.
+	var fs *Mount
+	for i := range table {
+		m := &table[i]
+		if !within(dir, m.Path) {
+			continue
+		}
+		if fs == nil || len(m.Path) >= len(fs.Path) {
+			fs = m
+		}
+	}
+	if fs == nil {
+		return nil
+	}
+	rel := strings.TrimPrefix(dir, fs.Path)
+	root := filepath.Join(fs.Root, rel)
+	var mounts []Mount
+	for _, m := range table {
+		if m.Dev == fs.Dev && m.Root == root && m.Path != fs.Path {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts
+}
+
+// within returns whether p is dir or is under dir.
+func within(p, dir string) bool {
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// Users returns the processes with files open under path, or with their
+// working or root directory under path.
+func Users(path string) ([]api.ProcessInfo, error) {
+	dirs, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+	var users []api.ProcessInfo
+	for _, d := range dirs {
+		pid, err := strconv.Atoi(d.Name())
+		if err != nil {
+			continue
+		}
+		proc := filepath.Join(procDir, d.Name())
+		if !uses(proc, path) {
+			continue
+		}
+		p := api.ProcessInfo{Pid: pid}
+		if comm, err := ioutil.ReadFile(filepath.Join(proc, "comm")); err == nil {
+			p.Command = strings.TrimSpace(string(comm))
+		}
+		if cgroup, err := ioutil.ReadFile(filepath.Join(proc, "cgroup")); err == nil {
+			p.Container = containerID.FindString(string(cgroup))
+		}
+		users = append(users, p)
+	}
+	return users, nil
+}
+
+// uses returns whether the process at proc uses files under path. Processes
+// that cannot be inspected are skipped.
+func uses(proc, path string) bool {
+	for _, l := range []string{"cwd", "root", "exe"} {
+		if t, err := os.Readlink(filepath.Join(proc, l)); err == nil && within(t, path) {
+			return true
+		}
+	}
+	fds, err := ioutil.ReadDir(filepath.Join(proc, "fd"))
+	if err != nil {
+		return false
+	}
+	for _, fd := range fds {
+		if t, err := os.Readlink(filepath.Join(proc, "fd", fd.Name())); err == nil && within(t, path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// selinuxXattr is the extended attribute holding the SELinux context of a
+// file.
+const selinuxXattr = "security.selinux"
+
+// SetLabel sets the SELinux context of path, such as
+// system_u:object_r:container_file_t:s0. It is a no-op if label is empty.
+func SetLabel(path string, label string) error {
+	if label == "" {
+		return nil
+	}
+	if err := syscall.Setxattr(path, selinuxXattr, []byte(label), 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
+
+// MakeDir creates dir and its missing parents with perm, and labels dir
+// with the SELinux context label if not empty. The permissions of dir are
+// set even if it exists.
+func MakeDir(dir string, perm os.FileMode, label string) error {
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, perm); err != nil {
+		return err
+	}
+	return SetLabel(dir, label)
+}
+
+// Relabel sets the SELinux context of path and of the files under it.
+// Symbolic links are skipped, they are not followed. It is a no-op if label
+// is empty.
+func Relabel(path string, label string) error {
+	if label == "" {
+		return nil
+	}
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		return SetLabel(p, label)
+	})
+}
@@ -0,0 +1,240 @@
+// Package mkfs creates the filesystems of block volumes. Formatters for
+// ext4, xfs and btrfs are registered, others may be added with Register.
+//
+// Options are derived from the volume spec: BlockSize sets the filesystem
+// block size and ConfigLabels prefixed with "mkfs." set the others, such as
+// "mkfs.label". Filesystems that support it are created with the owner of
+// the RootDir of the spec. A device that already holds a filesystem is not
+// reformatted unless "mkfs.force" is set.
+package mkfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// ConfigLabels keys of the mkfs options, prefixed with LabelPrefix.
+const (
+	// LabelPrefix prefix of the ConfigLabels that set mkfs options.
+	LabelPrefix = "mkfs."
+	// LabelOpt filesystem label.
+	LabelOpt = "label"
+	// ArgsOpt space separated arguments passed to mkfs as is, e.g.
+	// "-m 0 -E lazy_itable_init=0".
+	ArgsOpt = "args"
+	// ForceOpt set to "true" to format a device that already holds a
+	// filesystem.
+	ForceOpt = "force"
+)
+
+var (
+	// ErrFormatted is returned if the device already holds a filesystem of
+	// another format.
+	ErrFormatted = errors.New("Device already holds a filesystem")
+	// ErrUnsupported is returned if no Formatter is registered for a format.
+	ErrUnsupported = errors.New("Unsupported filesystem format")
+)
+
+// Options of a filesystem.
+type Options struct {
+	// BlockSize in bytes, the mkfs default if 0.
+	BlockSize int
+	// Label of the filesystem.
+	Label string
+	// Args passed to mkfs as is.
+	Args []string
+	// Force format a device that already holds a filesystem.
+	Force bool
+	// RootOwner uid:gid owning the root directory of the filesystem, root
+	// if empty.
+	RootOwner string
+}
+
+// Formatter returns the command and arguments that create a filesystem with
+// opts on device.
+type Formatter func(device string, opts *Options) (string, []string)
+
+var (
+	lock       sync.Mutex
+	formatters = make(map[api.Filesystem]Formatter)
+)
+
+// Register sets the Formatter of format.
+func Register(format api.Filesystem, f Formatter) {
+	lock.Lock()
+	defer lock.Unlock()
+	formatters[format] = f
+}
+
+// Supported returns whether a Formatter is registered for format.
+func Supported(format api.Filesystem) bool {
+	lock.Lock()
+	defer lock.Unlock()
+	_, ok := formatters[format]
+	return ok
+}
+
+// ParseOptions returns the options of the filesystem of spec.
+func ParseOptions(spec *api.VolumeSpec) (*Options, error) {
+	opts := &Options{BlockSize: spec.BlockSize}
+	if opts.BlockSize < 0 {
+		return nil, fmt.Errorf("Invalid block size %d", spec.BlockSize)
+	}
+	if opts.BlockSize > os.Getpagesize() {
+		// Filesystems with blocks larger than a page cannot be mounted.
+		log.Warnf("Block size %d is larger than the page size, using the default",
+			opts.BlockSize)
+		opts.BlockSize = 0
+	}
+	opts.Label = spec.ConfigLabels[LabelPrefix+LabelOpt]
+	if r := spec.RootDir; r != nil && r.UID != nil && r.GID != nil {
+		opts.RootOwner = fmt.Sprintf("%d:%d", *r.UID, *r.GID)
+	}
+	opts.Args = strings.Fields(spec.ConfigLabels[LabelPrefix+ArgsOpt])
+	if v, ok := spec.ConfigLabels[LabelPrefix+ForceOpt]; ok {
+		force, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s%s %q", LabelPrefix, ForceOpt, v)
+		}
+		opts.Force = force
+	}
+	return opts, nil
+}
+
+// Format creates the filesystem of spec on device. A device that already
+// holds a filesystem of the same format is left as is, so that volumes
+// created from snapshots keep their data.
+// Errors ErrFormatted, ErrUnsupported may be returned.
+func Format(device string, spec *api.VolumeSpec) error {
+	opts, err := ParseOptions(spec)
+	if err != nil {
+		return err
+	}
+	return Make(spec.Format, device, opts)
+}
+
+// Make creates a format filesystem with opts on device, unless the device
+// already holds a filesystem and opts.Force is not set.
+// Errors ErrFormatted, ErrUnsupported may be returned.
+func Make(format api.Filesystem, device string, opts *Options) error {
+	lock.Lock()
+	f, ok := formatters[format]
+	lock.Unlock()
+	if !ok {
+		return fmt.Errorf("%v: %q", ErrUnsupported, format)
+	}
+	if !opts.Force {
+		existing, err := Detect(device)
+		if err != nil {
+			return err
+		}
+		if existing == format {
+			log.Infof("%s already holds a %s filesystem", device, format)
+			return nil
+		}
+		if existing != "" {
+			return fmt.Errorf("%v: %s holds %s", ErrFormatted, device, existing)
+		}
+	}
+	cmd, args := f(device, opts)
+	out, err := exec.Command(cmd, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %v: %s",
+			cmd, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Detect returns the format of the filesystem on device, empty if it holds
+// none.
+func Detect(device string) (api.Filesystem, error) {
+	out, err := exec.Command("blkid", "-p", "-s", "TYPE", "-o", "value", device).Output()
+	if err != nil {
+		// blkid exits with 2 if the device holds no known signature.
+		if e, ok := err.(*exec.ExitError); ok {
+			if status, ok := e.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 2 {
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("Failed to detect the filesystem on %s: %v", device, err)
+	}
+	return api.Filesystem(strings.TrimSpace(string(out))), nil
+}
+
+// UUID returns the UUID of the filesystem on device, empty if it holds none.
+func UUID(device string) (string, error) {
+	out, err := exec.Command("blkid", "-p", "-s", "UUID", "-o", "value", device).Output()
+	if err != nil {
+		if e, ok := err.(*exec.ExitError); ok {
+			if status, ok := e.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 2 {
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("Failed to read the filesystem UUID of %s: %v", device, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func ext4(device string, opts *Options) (string, []string) {
+	args := []string{"-t", "ext4"}
+	if opts.BlockSize != 0 {
+		args = append(args, "-b", strconv.Itoa(opts.BlockSize))
+	}
+	if opts.Label != "" {
+		args = append(args, "-L", opts.Label)
+	}
+	if opts.Force {
+		args = append(args, "-F")
+	}
+	if opts.RootOwner != "" {
+		args = append(args, "-E", "root_owner="+opts.RootOwner)
+	}
+	args = append(args, opts.Args...)
+	return "mkfs.ext4", append(args, device)
+}
+
+func xfs(device string, opts *Options) (string, []string) {
+	var args []string
+	if opts.BlockSize != 0 {
+		args = append(args, "-b", "size="+strconv.Itoa(opts.BlockSize))
+	}
+	if opts.Label != "" {
+		args = append(args, "-L", opts.Label)
+	}
+	if opts.Force {
+		args = append(args, "-f")
+	}
+	args = append(args, opts.Args...)
+	return "mkfs.xfs", append(args, device)
+}
+
+func btrfs(device string, opts *Options) (string, []string) {
+	var args []string
+	if opts.BlockSize != 0 {
+		args = append(args, "--sectorsize", strconv.Itoa(opts.BlockSize))
+	}
+	if opts.Label != "" {
+		args = append(args, "--label", opts.Label)
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	args = append(args, opts.Args...)
+	return "mkfs.btrfs", append(args, device)
+}
+
+func init() {
+	Register(api.FsExt4, ext4)
+	Register(api.FsXfs, xfs)
+	Register(api.FsBtrfs, btrfs)
+}
@@ -0,0 +1,66 @@
+package mkfs
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions(&api.VolumeSpec{
+		BlockSize: 4096,
+		ConfigLabels: api.Labels{
+			LabelPrefix + LabelOpt: "data",
+			LabelPrefix + ArgsOpt:  "-m 0  -E lazy_itable_init=0",
+			LabelPrefix + ForceOpt: "true",
+			"nfs." + LabelOpt:      "ignored",
+		},
+	})
+	assert.NoError(t, err, "Failed to parse options")
+	assert.Equal(t, 4096, opts.BlockSize)
+	assert.Equal(t, "data", opts.Label)
+	assert.Equal(t, []string{"-m", "0", "-E", "lazy_itable_init=0"}, opts.Args)
+	assert.True(t, opts.Force, "Force should be set")
+	assert.Equal(t, "", opts.RootOwner)
+
+	uid, gid := 1000, 100
+	opts, err = ParseOptions(&api.VolumeSpec{RootDir: &api.RootDirSpec{UID: &uid, GID: &gid}})
+	assert.NoError(t, err, "Failed to parse options")
+	assert.Equal(t, "1000:100", opts.RootOwner)
+
+	opts, err = ParseOptions(&api.VolumeSpec{BlockSize: 2 * os.Getpagesize()})
+	assert.NoError(t, err, "Failed to parse options")
+	assert.Equal(t, 0, opts.BlockSize, "Blocks larger than a page should use the default")
+
+	_, err = ParseOptions(&api.VolumeSpec{ConfigLabels: api.Labels{LabelPrefix + ForceOpt: "maybe"}})
+	assert.Error(t, err, "Invalid force option should fail")
+}
+
+func TestFormatters(t *testing.T) {
+	opts := &Options{BlockSize: 4096, Label: "data", Args: []string{"-m", "0"}, Force: true, RootOwner: "1000:100"}
+	for _, c := range []struct {
+		format api.Filesystem
+		cmd    string
+	}{
+		{api.FsExt4, "mkfs.ext4 -t ext4 -b 4096 -L data -F -E root_owner=1000:100 -m 0 /dev/sdb"},
+		{api.FsXfs, "mkfs.xfs -b size=4096 -L data -f -m 0 /dev/sdb"},
+		{api.FsBtrfs, "mkfs.btrfs --sectorsize 4096 --label data --force -m 0 /dev/sdb"},
+	} {
+		assert.True(t, Supported(c.format), "%s should be supported", c.format)
+		cmd, args := formatters[c.format]("/dev/sdb", opts)
+		assert.Equal(t, c.cmd, cmd+" "+strings.Join(args, " "), "Unexpected %s command", c.format)
+	}
+
+	cmd, args := formatters[api.FsExt4]("/dev/sdb", &Options{})
+	assert.Equal(t, "mkfs.ext4 -t ext4 /dev/sdb", cmd+" "+strings.Join(args, " "),
+		"Defaults should not be passed")
+
+	assert.False(t, Supported(api.FsZfs), "zfs should not be supported")
+	err := Make(api.FsZfs, "/dev/sdb", &Options{})
+	assert.Error(t, err, "Unsupported format should fail")
+	assert.True(t, strings.HasPrefix(err.Error(), ErrUnsupported.Error()), "Unexpected error %v", err)
+}
@@ -0,0 +1,111 @@
+package output
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// term is one condition of a Filter.
+type term struct {
+	key     string
+	pattern string
+	negate  bool
+}
+
+// Filter selects volumes. It is parsed from comma separated conditions,
+// all of which must hold, of the form key=pattern or key!=pattern. Keys are
+// id, name, state, status, fs, attached, label.<name> for volume labels and
+// config.<name> for configuration labels. Patterns may use shell wildcards
+// and match states and statuses case insensitively, e.g.
+// "state=attached,label.env=prod,status!=up".
+type Filter []term
+
+// ParseFilter parses expr, an empty expr selects all volumes.
+func ParseFilter(expr string) (Filter, error) {
+	var f Filter
+	for _, cond := range strings.Split(expr, ",") {
+		cond = strings.TrimSpace(cond)
+		if cond == "" {
+			continue
+		}
+		t := term{}
+		pair := strings.SplitN(cond, "!=", 2)
+		if len(pair) == 2 {
+			t.negate = true
+		} else {
+			pair = strings.SplitN(cond, "=", 2)
+		}
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("Malformed filter condition %q, must be key=value or key!=value", cond)
+		}
+		t.key = strings.ToLower(strings.TrimSpace(pair[0]))
+		t.pattern = strings.TrimSpace(pair[1])
+		if _, err := path.Match(t.pattern, ""); err != nil {
+			return nil, fmt.Errorf("Malformed filter pattern %q: %v", t.pattern, err)
+		}
+		if _, ok := field(&api.Volume{}, t.key); !ok {
+			return nil, fmt.Errorf("Unknown filter key %q", t.key)
+		}
+		f = append(f, t)
+	}
+	return f, nil
+}
+
+// field returns the value of key for v, false if key is unknown.
+func field(v *api.Volume, key string) (string, bool) {
+	switch {
+	case key == "id":
+		return string(v.ID), true
+	case key == "name":
+		return v.Locator.Name, true
+	case key == "state":
+		return strings.ToLower(v.State.String()), true
+	case key == "status":
+		return strings.ToLower(string(v.Status)), true
+	case key == "fs":
+		return string(v.Format), true
+	case key == "attached":
+		return string(v.AttachedOn), true
+	case strings.HasPrefix(key, "label."):
+		return v.Locator.VolumeLabels[strings.TrimPrefix(key, "label.")], true
+	case strings.HasPrefix(key, "config."):
+		if v.Spec == nil {
+			return "", true
+		}
+		return v.Spec.ConfigLabels[strings.TrimPrefix(key, "config.")], true
+	}
+	return "", false
+}
+
+// Match returns true if v meets all conditions of f.
+func (f Filter) Match(v *api.Volume) bool {
+	for _, t := range f {
+		value, _ := field(v, t.key)
+		pattern := t.pattern
+		if t.key == "state" || t.key == "status" {
+			pattern = strings.ToLower(pattern)
+		}
+		ok, _ := path.Match(pattern, value)
+		if ok == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the volumes of vols that f selects.
+func (f Filter) Apply(vols []api.Volume) []api.Volume {
+	if len(f) == 0 {
+		return vols
+	}
+	selected := make([]api.Volume, 0, len(vols))
+	for i := range vols {
+		if f.Match(&vols[i]) {
+			selected = append(selected, vols[i])
+		}
+	}
+	return selected
+}
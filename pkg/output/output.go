@@ -0,0 +1,143 @@
+// Package output renders volume lists as JSON, YAML, CSV or a compact table
+// and filters them with expressions over their labels and state, for
+// scripts and dashboards.
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// Format of a rendered volume list.
+type Format string
+
+const (
+	// JSON indented array of volumes.
+	JSON = Format("json")
+	// YAML sequence of volumes.
+	YAML = Format("yaml")
+	// CSV one volume per row after a header row.
+	CSV = Format("csv")
+	// Table aligned columns for terminals.
+	Table = Format("table")
+)
+
+// ContentTypes are the MIME types of the formats.
+var ContentTypes = map[Format]string{
+	JSON:  "application/json",
+	YAML:  "application/x-yaml",
+	CSV:   "text/csv",
+	Table: "text/plain",
+}
+
+// ParseFormat returns the format named s, JSON if s is empty.
+func ParseFormat(s string) (Format, error) {
+	if s == "" {
+		return JSON, nil
+	}
+	f := Format(strings.ToLower(s))
+	if _, ok := ContentTypes[f]; !ok {
+		return "", fmt.Errorf("Unknown output format %q, must be json, yaml, csv or table", s)
+	}
+	return f, nil
+}
+
+var columns = []string{"ID", "NAME", "SIZE", "FS", "HA", "STATE", "STATUS", "ATTACHED ON", "LABELS"}
+
+// Write renders vols to w in format f.
+func Write(w io.Writer, f Format, vols []api.Volume) error {
+	if vols == nil {
+		vols = []api.Volume{}
+	}
+	switch f {
+	case JSON:
+		b, err := json.MarshalIndent(vols, "", " ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	case YAML:
+		b, err := yaml.Marshal(vols)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	case CSV:
+		cw := csv.NewWriter(w)
+		cw.Write(columns)
+		for i := range vols {
+			cw.Write(row(&vols[i], false))
+		}
+		cw.Flush()
+		return cw.Error()
+	case Table:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(columns, "\t"))
+		for i := range vols {
+			fmt.Fprintln(tw, strings.Join(row(&vols[i], true), "\t"))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("Unknown output format %q", f)
+}
+
+// row returns the columns of v, with a human readable size if human is true.
+func row(v *api.Volume, human bool) []string {
+	var size uint64
+	ha := 0
+	if v.Spec != nil {
+		size = v.Spec.Size
+		ha = v.Spec.HALevel
+	}
+	sizeCol := strconv.FormatUint(size, 10)
+	if human {
+		sizeCol = humanSize(size)
+	}
+	return []string{
+		string(v.ID),
+		v.Locator.Name,
+		sizeCol,
+		string(v.Format),
+		strconv.Itoa(ha),
+		v.State.String(),
+		string(v.Status),
+		string(v.AttachedOn),
+		labels(v.Locator.VolumeLabels),
+	}
+}
+
+// labels returns l as sorted name=value pairs.
+func labels(l api.Labels) string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func humanSize(n uint64) string {
+	units := "BKMGTP"
+	i := 0
+	f := float64(n)
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if f == float64(uint64(f)) {
+		return fmt.Sprintf("%d%c", uint64(f), units[i])
+	}
+	return fmt.Sprintf("%.1f%c", f, units[i])
+}
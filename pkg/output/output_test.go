@@ -0,0 +1,69 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+var vols = []api.Volume{
+	{
+		ID:      "vol1",
+		Locator: api.VolumeLocator{Name: "pg-data", VolumeLabels: api.Labels{"env": "prod", "app": "pg"}},
+		Spec:    &api.VolumeSpec{Size: 10 << 30, HALevel: 1},
+		Format:  api.FsExt4,
+		State:   api.VolumeAttached,
+		Status:  api.Up,
+	},
+	{
+		ID:      "vol2",
+		Locator: api.VolumeLocator{Name: "scratch", VolumeLabels: api.Labels{"env": "dev"}},
+		Spec:    &api.VolumeSpec{Size: 1536 << 20},
+		Format:  api.FsXfs,
+		State:   api.VolumeDetached,
+		Status:  api.Down,
+	},
+}
+
+func TestFilter(t *testing.T) {
+	for expr, want := range map[string]int{
+		"":                        2,
+		"state=attached":          1,
+		"label.env=prod,status=*": 1,
+		"label.env!=prod":         1,
+		"name=pg-*":               1,
+		"label.missing=":          2,
+		"status!=up,fs=xfs":       1,
+	} {
+		f, err := ParseFilter(expr)
+		assert.NoError(t, err, "Failed to parse %q", expr)
+		assert.Equal(t, want, len(f.Apply(vols)), "Filter %q", expr)
+	}
+
+	for _, expr := range []string{"state", "color=red", "name=[", "=x"} {
+		_, err := ParseFilter(expr)
+		assert.Error(t, err, "Filter %q should be rejected", expr)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	_, err := ParseFormat("xml")
+	assert.Error(t, err, "Unknown format should be rejected")
+	f, err := ParseFormat("")
+	assert.NoError(t, err, "Failed to parse default format")
+	assert.Equal(t, JSON, f, "Default format should be JSON")
+
+	var b bytes.Buffer
+	assert.NoError(t, Write(&b, CSV, vols), "Failed to write CSV")
+	assert.Equal(t, "ID,NAME,SIZE,FS,HA,STATE,STATUS,ATTACHED ON,LABELS\n"+
+		"vol1,pg-data,10737418240,ext4,1,Attached,Up,,\"app=pg,env=prod\"\n"+
+		"vol2,scratch,1610612736,xfs,0,Detached,Down,,env=dev\n", b.String())
+
+	b.Reset()
+	assert.NoError(t, Write(&b, Table, vols), "Failed to write table")
+	assert.Contains(t, b.String(), "10G", "Table sizes should be human readable")
+	assert.Contains(t, b.String(), "1.5G", "Table sizes should be human readable")
+}
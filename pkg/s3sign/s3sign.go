@@ -0,0 +1,162 @@
+// Package s3sign signs requests to S3 compatible object stores with AWS
+// signature version 4, in the Authorization header or in presigned URLs.
+package s3sign
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm  = "AWS4-HMAC-SHA256"
+	timeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+	// Unsigned payload hash of requests whose body is not signed.
+	Unsigned = "UNSIGNED-PAYLOAD"
+	// EmptySHA256 payload hash of requests without a body.
+	EmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// Signer signs S3 requests with AWS signature version 4.
+type Signer struct {
+	AccessKey string
+	SecretKey string
+	Region    string
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(data string) string {
+	h := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(h[:])
+}
+
+// URIEncode encodes s as required by signature version 4, keeping only
+// unreserved characters.
+func URIEncode(s string, encodeSlash bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			pairs = append(pairs, URIEncode(k, true)+"="+URIEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// signedHeaders returns the sorted names of the headers of r that are signed
+// and their canonical form.
+func signedHeaders(r *http.Request) (string, string) {
+	headers := map[string]string{"host": r.URL.Host}
+	for k, v := range r.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") || k == "range" || k == "content-type" || k == "content-md5" {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical bytes.Buffer
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	return strings.Join(names, ";"), canonical.String()
+}
+
+func (s *Signer) scope(t time.Time) string {
+	return t.Format(dateFormat) + "/" + s.Region + "/s3/aws4_request"
+}
+
+func (s *Signer) signature(t time.Time, canonicalRequest string) string {
+	toSign := strings.Join([]string{
+		algorithm,
+		t.Format(timeFormat),
+		s.scope(t),
+		hashHex(canonicalRequest),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), t.Format(dateFormat))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func canonicalRequest(r *http.Request, query url.Values, names, headers, payload string) string {
+	return strings.Join([]string{
+		r.Method,
+		URIEncode(r.URL.Path, false),
+		canonicalQuery(query),
+		headers,
+		names,
+		payload,
+	}, "\n")
+}
+
+// Sign adds the Authorization header to r. payload is the hex SHA256 of the
+// body, or Unsigned.
+func (s *Signer) Sign(r *http.Request, payload string, t time.Time) {
+	t = t.UTC()
+	r.Header.Set("X-Amz-Date", t.Format(timeFormat))
+	r.Header.Set("X-Amz-Content-Sha256", payload)
+	names, headers := signedHeaders(r)
+	sig := s.signature(t, canonicalRequest(r, r.URL.Query(), names, headers, payload))
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, s.AccessKey, s.scope(t), names, sig))
+}
+
+// Presign returns the URL of r with the signature in the query string, valid
+// for expiry from t.
+func (s *Signer) Presign(r *http.Request, expiry time.Duration, t time.Time) string {
+	t = t.UTC()
+	q := r.URL.Query()
+	q.Set("X-Amz-Algorithm", algorithm)
+	q.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(t))
+	q.Set("X-Amz-Date", t.Format(timeFormat))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expiry/time.Second)))
+	q.Set("X-Amz-SignedHeaders", "host")
+	headers := "host:" + r.URL.Host + "\n"
+	sig := s.signature(t, canonicalRequest(r, q, "host", headers, Unsigned))
+	q.Set("X-Amz-Signature", sig)
+	u := *r.URL
+	u.RawQuery = canonicalQuery(q)
+	return u.String()
+}
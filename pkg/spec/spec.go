@@ -0,0 +1,300 @@
+// Package spec builds volume specs from string options, such as those passed
+// to the Docker volume plugin or on the command line.
+package spec
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// SizeOpt volume size, e.g. "10G". A bare number is in bytes.
+	SizeOpt = "size"
+	// FsOpt filesystem to format the volume with.
+	FsOpt = "fs"
+	// BlockSizeOpt filesystem block size, e.g. "4K".
+	BlockSizeOpt = "block_size"
+	// HALevelOpt number of nodes that may fail without losing data.
+	HALevelOpt = "ha"
+	// CosOpt class of service, low, medium, high or a number.
+	CosOpt = "cos"
+	// SnapIntervalOpt snapshot interval in minutes, 0 disables snapshots.
+	SnapIntervalOpt = "snap_interval"
+	// KeepLastOpt number of latest scheduled snapshots kept.
+	KeepLastOpt = "keep_last"
+	// KeepHourlyOpt number of hours whose last scheduled snapshot is kept.
+	KeepHourlyOpt = "keep_hourly"
+	// KeepDailyOpt number of days whose last scheduled snapshot is kept.
+	KeepDailyOpt = "keep_daily"
+	// KeepWeeklyOpt number of weeks whose last scheduled snapshot is kept.
+	KeepWeeklyOpt = "keep_weekly"
+	// KeepMonthlyOpt number of months whose last scheduled snapshot is
+	// kept.
+	KeepMonthlyOpt = "keep_monthly"
+	// DedupeOpt enables dedupe.
+	DedupeOpt = "dedupe"
+	// CompressedOpt compresses the volume with the default algorithm of the
+	// driver.
+	CompressedOpt = "compressed"
+	// CompressionOpt compresses the volume with an algorithm such as zstd.
+	CompressionOpt = "compression"
+	// EphemeralOpt marks the volume ephemeral.
+	EphemeralOpt = "ephemeral"
+	// CacheDeviceOpt local device to cache the volume on.
+	CacheDeviceOpt = "cache_device"
+	// CacheModeOpt cache write policy, writethrough or writeback.
+	CacheModeOpt = "cache_mode"
+	// UIDOpt user ID owning the root directory of the volume.
+	UIDOpt = "uid"
+	// GIDOpt group ID owning the root directory of the volume.
+	GIDOpt = "gid"
+	// ModeOpt octal permissions of the root directory of the volume, e.g.
+	// "0775".
+	ModeOpt = "mode"
+	// ProfileOpt names the volume profile the other options override. It
+	// is not part of the spec, callers resolve it with package profile.
+	ProfileOpt = "profile"
+	// GroupOpt group of volumes the volume is snapshotted with. It is not
+	// part of the spec, callers set it in the volume locator.
+	GroupOpt = "group"
+
+	// MaxHALevel highest accepted HA level.
+	MaxHALevel = 3
+)
+
+// aliases maps alternate option names to their canonical name.
+var aliases = map[string]string{
+	"format":  FsOpt,
+	"bs":      BlockSizeOpt,
+	"repl":    HALevelOpt,
+	"halevel": HALevelOpt,
+	"si":      SnapIntervalOpt,
+}
+
+var units = map[string]uint64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+	"p": 1 << 50,
+}
+
+var filesystems = map[api.Filesystem]bool{
+	api.FsNone:  true,
+	api.FsExt4:  true,
+	api.FsXfs:   true,
+	api.FsBtrfs: true,
+	api.FsZfs:   true,
+	api.FsNfs:   true,
+}
+
+var cosNames = map[string]api.VolumeCos{
+	"none":   api.VolumeCosNone,
+	"low":    api.VolumeCos(1),
+	"medium": api.VolumeCosMedium,
+	"high":   api.VolumeCosMax,
+}
+
+// ParseSize parses a size with an optional binary unit suffix such as "512",
+// "4K", "10GiB" or "1tb". Units are powers of 1024. Sizes must fit in 64
+// bits.
+func ParseSize(s string) (uint64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	num := strings.TrimRight(s, "kmgtpib")
+	suffix := strings.TrimSuffix(strings.TrimSuffix(s[len(num):], "b"), "i")
+	mult, ok := units[suffix]
+	if !ok || num == "" {
+		return 0, fmt.Errorf("Invalid size %q", s)
+	}
+	if n, err := strconv.ParseUint(num, 10, 64); err == nil {
+		if n > math.MaxUint64/mult {
+			return 0, fmt.Errorf("Size %q is too large", s)
+		}
+		return n * mult, nil
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || math.IsNaN(n) || n < 0 {
+		return 0, fmt.Errorf("Invalid size %q", s)
+	}
+	// Sizes of 2^64 bytes or more do not fit in a uint64.
+	if n*float64(mult) >= math.MaxUint64 {
+		return 0, fmt.Errorf("Size %q is too large", s)
+	}
+	return uint64(n * float64(mult)), nil
+}
+
+// ParseString parses comma separated name=value options, such as
+// "size=10G,fs=ext4,ha=2,cos=high", into a VolumeSpec.
+func ParseString(s string) (*api.VolumeSpec, error) {
+	opts := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("Malformed option: %s", kv)
+		}
+		opts[pair[0]] = pair[1]
+	}
+	return Parse(opts)
+}
+
+// Parse builds a VolumeSpec from opts. Option names are case insensitive.
+// Unset options are left at their zero value.
+func Parse(opts map[string]string) (*api.VolumeSpec, error) {
+	spec := &api.VolumeSpec{}
+	seen := make(map[string]bool)
+	for k, v := range opts {
+		k = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		if alias, ok := aliases[k]; ok {
+			k = alias
+		}
+		if seen[k] {
+			return nil, fmt.Errorf("Duplicate option: %s", k)
+		}
+		seen[k] = true
+		if err := set(spec, k, v); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Cache != nil && spec.Cache.Device == "" {
+		return nil, fmt.Errorf("Option %s requires %s", CacheModeOpt, CacheDeviceOpt)
+	}
+	return spec, nil
+}
+
+func cacheSpec(spec *api.VolumeSpec) *api.CacheSpec {
+	if spec.Cache == nil {
+		spec.Cache = &api.CacheSpec{}
+	}
+	return spec.Cache
+}
+
+func set(spec *api.VolumeSpec, k, v string) error {
+	var err error
+	switch k {
+	case SizeOpt:
+		spec.Size, err = ParseSize(v)
+		if err == nil && spec.Size == 0 {
+			err = fmt.Errorf("Size must be greater than 0")
+		}
+	case FsOpt:
+		spec.Format = api.Filesystem(strings.ToLower(v))
+		if !filesystems[spec.Format] {
+			err = fmt.Errorf("Unsupported filesystem %q", v)
+		}
+	case BlockSizeOpt:
+		var bs uint64
+		bs, err = ParseSize(v)
+		if err == nil && (bs == 0 || bs&(bs-1) != 0) {
+			err = fmt.Errorf("Block size %q must be a power of 2", v)
+		}
+		spec.BlockSize = int(bs)
+	case HALevelOpt:
+		spec.HALevel, err = strconv.Atoi(v)
+		if err != nil || spec.HALevel < 0 || spec.HALevel > MaxHALevel {
+			err = fmt.Errorf("HA level %q must be between 0 and %d", v, MaxHALevel)
+		}
+	case CosOpt:
+		if cos, ok := cosNames[strings.ToLower(v)]; ok {
+			spec.Cos = cos
+			break
+		}
+		var n int
+		n, err = strconv.Atoi(v)
+		if err != nil || api.VolumeCos(n) < api.VolumeCosNone || api.VolumeCos(n) > api.VolumeCosMax {
+			err = fmt.Errorf("Class of service %q must be low, medium, high or between %d and %d",
+				v, api.VolumeCosNone, api.VolumeCosMax)
+		}
+		spec.Cos = api.VolumeCos(n)
+	case SnapIntervalOpt:
+		spec.SnapshotInterval, err = strconv.Atoi(v)
+		if err != nil || spec.SnapshotInterval < 0 {
+			err = fmt.Errorf("Snapshot interval %q must be a number of minutes", v)
+		}
+	case KeepLastOpt:
+		err = keep(&retention(spec).KeepLast, k, v)
+	case KeepHourlyOpt:
+		err = keep(&retention(spec).Hourly, k, v)
+	case KeepDailyOpt:
+		err = keep(&retention(spec).Daily, k, v)
+	case KeepWeeklyOpt:
+		err = keep(&retention(spec).Weekly, k, v)
+	case KeepMonthlyOpt:
+		err = keep(&retention(spec).Monthly, k, v)
+	case DedupeOpt:
+		spec.Dedupe, err = strconv.ParseBool(v)
+	case CompressedOpt:
+		spec.Compressed, err = strconv.ParseBool(v)
+	case CompressionOpt:
+		spec.Compressed = true
+		spec.Compression = api.Compression(strings.ToLower(v))
+	case EphemeralOpt:
+		spec.Ephemeral, err = strconv.ParseBool(v)
+	case CacheDeviceOpt:
+		cacheSpec(spec).Device = v
+	case CacheModeOpt:
+		mode := api.CacheMode(strings.ToLower(v))
+		if mode != api.CacheWritethrough && mode != api.CacheWriteback {
+			err = fmt.Errorf("Cache mode %q must be writethrough or writeback", v)
+		}
+		cacheSpec(spec).Mode = mode
+	case UIDOpt:
+		rootDir(spec).UID, err = id(k, v)
+	case GIDOpt:
+		rootDir(spec).GID, err = id(k, v)
+	case ModeOpt:
+		var mode uint64
+		mode, err = strconv.ParseUint(v, 8, 32)
+		if err != nil || mode&^07777 != 0 {
+			err = fmt.Errorf("Mode %q must be octal permissions such as 0775", v)
+		}
+		rootDir(spec).Mode = uint32(mode)
+	default:
+		err = fmt.Errorf("Unknown option %q", k)
+	}
+	return err
+}
+
+// rootDir returns the root directory spec of spec, whose owner is left
+// unchanged until set.
+func rootDir(spec *api.VolumeSpec) *api.RootDirSpec {
+	if spec.RootDir == nil {
+		spec.RootDir = &api.RootDirSpec{}
+	}
+	return spec.RootDir
+}
+
+// id parses the user or group ID v of option k.
+func id(k, v string) (*int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("Option %s %q must be a numeric ID", k, v)
+	}
+	return &n, nil
+}
+
+func retention(spec *api.VolumeSpec) *api.RetentionPolicy {
+	if spec.Retention == nil {
+		spec.Retention = &api.RetentionPolicy{}
+	}
+	return spec.Retention
+}
+
+// keep parses the count v of the retention option k into n.
+func keep(n *int, k, v string) error {
+	var err error
+	*n, err = strconv.Atoi(v)
+	if err != nil || *n < 0 {
+		return fmt.Errorf("Option %s %q must be a number of snapshots", k, v)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]uint64{
+		"512":   512,
+		"4K":    4 << 10,
+		"10G":   10 << 30,
+		"10GiB": 10 << 30,
+		"1tb":   1 << 40,
+		"1.5M":  3 << 19,
+	} {
+		got, err := ParseSize(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "G", "-1G", "10X", "10GG", "nan", "inf",
+		"16384P", "18446744073709551616", "1e30"} {
+		_, err := ParseSize(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParse(t *testing.T) {
+	spec, err := ParseString("size=10G,fs=ext4,ha=2,cos=high,bs=4K,si=60")
+	assert.NoError(t, err)
+	assert.Equal(t, &api.VolumeSpec{
+		Size:             10 << 30,
+		Format:           api.FsExt4,
+		HALevel:          2,
+		Cos:              api.VolumeCosMax,
+		BlockSize:        4096,
+		SnapshotInterval: 60,
+	}, spec)
+
+	spec, err = ParseString("si=60,keep_last=3,keep_daily=7")
+	assert.NoError(t, err)
+	assert.Equal(t, &api.RetentionPolicy{KeepLast: 3, Daily: 7}, spec.Retention)
+
+	spec, err = ParseString("gid=1000,mode=2775")
+	assert.NoError(t, err)
+	if assert.NotNil(t, spec.RootDir) {
+		assert.Nil(t, spec.RootDir.UID, "Owner set by the group")
+		if assert.NotNil(t, spec.RootDir.GID) {
+			assert.Equal(t, 1000, *spec.RootDir.GID)
+		}
+		assert.Equal(t, uint32(02775), spec.RootDir.Mode)
+	}
+
+	for _, s := range []string{
+		"size=0",
+		"fs=ntfs",
+		"ha=9",
+		"cos=extreme",
+		"bs=3K",
+		"color=red",
+		"size",
+		"size=1G,SIZE=2G",
+		"keep_last=-1",
+		"uid=-1",
+		"mode=0778",
+		"mode=10000",
+	} {
+		_, err := ParseString(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,214 @@
+// Package vdo compresses and dedupes block devices with the dm-vdo device
+// mapper target, for block drivers whose backends cannot compress.
+//
+// The VDO device is created as /dev/mapper/osd-vdo-<name> over the origin,
+// which is formatted for VDO by Format once, when its volume is created, and
+// only assembled afterwards. The logical size of the VDO device
+// is the size of the origin: compression does not add capacity, it reduces
+// the space used on thin backends. VDO needs several GiB of metadata, origins
+// smaller than that cannot be formatted.
+package vdo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	devPrefix  = "osd-vdo-"
+	mapperDir  = "/dev/mapper/"
+	sectorSize = 512
+	blockSize  = 4096
+	// blockMapCache size of the block map cache in blocks, the minimum of
+	// 128MiB.
+	blockMapCache = 32768
+	// blockMapEra default era length of the block map.
+	blockMapEra = 16380
+)
+
+// ErrNotFormatted is returned when an origin does not hold a VDO volume.
+var ErrNotFormatted = errors.New("Device is not formatted for VDO")
+
+// dmsetup runs dmsetup with args. It is replaced in tests.
+var dmsetup = func(args ...string) (string, error) {
+	return run("dmsetup", args...)
+}
+
+// sectors returns the size of a block device in sectors. It is replaced in
+// tests.
+var sectors = func(dev string) (uint64, error) {
+	out, err := run("blockdev", "--getsz", dev)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+}
+
+// signature returns the type of the data dev holds, empty if none is found.
+// It is replaced in tests.
+var signature = func(dev string) (string, error) {
+	out, err := exec.Command("blkid", "-p", "-s", "TYPE", "-o", "value", dev).Output()
+	if err != nil {
+		// blkid exits with 2 if the device holds no known signature.
+		if e, ok := err.(*exec.ExitError); ok {
+			if status, ok := e.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 2 {
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("Failed to probe %s: %v", dev, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// format formats dev for VDO with a logical size of size bytes. It is
+// replaced in tests.
+var format = func(dev string, size uint64) error {
+	_, err := run("vdoformat", fmt.Sprintf("--logical-size=%dK", size>>10), dev)
+	return err
+}
+
+func run(cmd string, args ...string) (string, error) {
+	out, err := exec.Command(cmd, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %v: %s",
+			cmd, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func vdoName(name string) string { return devPrefix + name }
+
+// DevicePath is the path of the VDO device of name.
+func DevicePath(name string) string {
+	return mapperDir + vdoName(name)
+}
+
+// Assembled returns true if the VDO device of name exists.
+func Assembled(name string) bool {
+	_, err := os.Stat(DevicePath(name))
+	return err == nil
+}
+
+// Path returns the VDO device of name if it is assembled, origin otherwise.
+// Drivers mount and format the returned path.
+func Path(name, origin string) string {
+	if Assembled(name) {
+		return DevicePath(name)
+	}
+	return origin
+}
+
+// vdoTable returns the table of a VDO device over origin of size sectors.
+//
+//	<start> <logical sectors> vdo V4 <origin> <physical blocks> <min io> <block map cache> <era> [<key> <value>]*
+func vdoTable(origin string, size uint64, dedupe bool) string {
+	logical := size / (blockSize / sectorSize) * (blockSize / sectorSize)
+	dedup := "off"
+	if dedupe {
+		dedup = "on"
+	}
+	return fmt.Sprintf("0 %d vdo V4 %s %d %d %d %d compression on deduplication %s",
+		logical, origin, size/(blockSize/sectorSize), blockSize, blockMapCache, blockMapEra, dedup)
+}
+
+// Format formats origin for VDO. Only blank origins are formatted, origins
+// holding data of any type are refused.
+func Format(origin string) error {
+	typ, err := signature(origin)
+	if err != nil {
+		return err
+	}
+	if typ != "" {
+		return fmt.Errorf("Refusing to format %s for VDO, it holds %s", origin, typ)
+	}
+	size, err := sectors(origin)
+	if err != nil {
+		return err
+	}
+	return format(origin, size*sectorSize)
+}
+
+// Assemble creates the VDO device of name over origin and returns its path.
+// Origins are never formatted, see Format. Blocks are deduped if dedupe is
+// set.
+// Errors ErrNotFormatted may be returned.
+func Assemble(name, origin string, dedupe bool) (string, error) {
+	if Assembled(name) {
+		return DevicePath(name), nil
+	}
+	typ, err := signature(origin)
+	if err != nil {
+		return "", err
+	}
+	if typ != "vdo" {
+		return "", ErrNotFormatted
+	}
+	size, err := sectors(origin)
+	if err != nil {
+		return "", err
+	}
+	if _, err = dmsetup("create", vdoName(name), "--table", vdoTable(origin, size, dedupe)); err != nil {
+		return "", err
+	}
+	return DevicePath(name), nil
+}
+
+// Teardown removes the VDO device of name, once VDO wrote its pending data
+// to the origin.
+func Teardown(name string) error {
+	if !Assembled(name) {
+		return nil
+	}
+	_, err := dmsetup("remove", vdoName(name))
+	return err
+}
+
+var statsField = regexp.MustCompile(`(\w+)\s*:\s*(\d+)`)
+
+// ratio returns the ratio of the logical blocks used to the data blocks used
+// in the output of the stats message of a VDO device, 0 if no data is
+// stored.
+func ratio(stats string) (float64, error) {
+	var logical, data uint64
+	found := 0
+	for _, m := range statsField.FindAllStringSubmatch(stats, -1) {
+		var p *uint64
+		switch m[1] {
+		case "logicalBlocksUsed":
+			p = &logical
+		case "dataBlocksUsed":
+			p = &data
+		default:
+			continue
+		}
+		v, err := strconv.ParseUint(m[2], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		*p = v
+		found++
+	}
+	if found != 2 {
+		return 0, fmt.Errorf("Not VDO stats: %q", stats)
+	}
+	if data == 0 {
+		return 0, nil
+	}
+	return float64(logical) / float64(data), nil
+}
+
+// Ratio returns the size of the data written to the VDO device of name over
+// the space it uses on the origin, 0 if it holds no data.
+func Ratio(name string) (float64, error) {
+	stats, err := dmsetup("message", vdoName(name), "0", "stats")
+	if err != nil {
+		return 0, err
+	}
+	return ratio(stats)
+}
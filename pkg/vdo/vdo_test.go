@@ -0,0 +1,66 @@
+package vdo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVdoTable(t *testing.T) {
+	assert.Equal(t, "0 20971520 vdo V4 /dev/sdb 2621440 4096 32768 16380 compression on deduplication off",
+		vdoTable("/dev/sdb", 10<<21, false))
+	// The logical size is whole blocks.
+	assert.Equal(t, "0 2048 vdo V4 /dev/sdb 256 4096 32768 16380 compression on deduplication on",
+		vdoTable("/dev/sdb", 2050, true))
+}
+
+func TestRatio(t *testing.T) {
+	r, err := ratio("{ version : 36, dataBlocksUsed : 250, overheadBlocksUsed : 10, " +
+		"logicalBlocksUsed : 1000, physicalBlocks : 4096 }")
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, r)
+
+	r, err = ratio("dataBlocksUsed : 0, logicalBlocksUsed : 0")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, r)
+
+	_, err = ratio("0 2048 linear")
+	assert.Error(t, err)
+}
+
+func TestAssemble(t *testing.T) {
+	var calls [][]string
+	var formattedSize uint64
+	typ := ""
+	dmsetup = func(args ...string) (string, error) {
+		calls = append(calls, args)
+		return "", nil
+	}
+	sectors = func(dev string) (uint64, error) { return 1 << 21, nil }
+	signature = func(dev string) (string, error) { return typ, nil }
+	format = func(dev string, size uint64) error {
+		formattedSize = size
+		typ = "vdo"
+		return nil
+	}
+
+	_, err := Assemble("v1", "/dev/sdb", false)
+	assert.Equal(t, ErrNotFormatted, err, "Blank origin assembled")
+	assert.Empty(t, calls)
+	assert.Equal(t, uint64(0), formattedSize, "Origin formatted on assemble")
+
+	assert.NoError(t, Format("/dev/sdb"))
+	assert.Equal(t, uint64(1<<30), formattedSize)
+	assert.Error(t, Format("/dev/sdb"), "Formatted origin formatted again")
+
+	path, err := Assemble("v1", "/dev/sdb", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/mapper/osd-vdo-v1", path)
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, []string{"create", "osd-vdo-v1", "--table", vdoTable("/dev/sdb", 1<<21, false)}, calls[0])
+	}
+	assert.Equal(t, "/dev/sdb", Path("v1", "/dev/sdb"))
+
+	typ = "ext4"
+	assert.Error(t, Format("/dev/sdc"), "Origin with a filesystem formatted")
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultConcurrency number of workers in a pool if none is specified.
+	DefaultConcurrency = 4
+	// DefaultQueueDepth number of jobs that may be queued if none is specified.
+	DefaultQueueDepth = 64
+)
+
+var (
+	// ErrFull is returned when the pool queue is saturated. Callers should
+	// back off and retry later.
+	ErrFull = errors.New("Worker queue is full")
+	// ErrShutdown is returned when submitting to a pool that has shut down.
+	ErrShutdown = errors.New("Worker pool is shut down")
+	// ErrEinval is returned for invalid pool parameters.
+	ErrEinval = errors.New("Invalid worker pool parameters")
+)
+
+// Job is a unit of background work.
+type Job func()
+
+// Stats on the jobs processed by a pool.
+type Stats struct {
+	// Name of the pool.
+	Name string
+	// Concurrency number of workers.
+	Concurrency int
+	// QueueDepth maximum number of queued jobs.
+	QueueDepth int
+	// Queued number of jobs currently waiting for a worker.
+	Queued int
+	// Submitted number of jobs accepted.
+	Submitted uint64
+	// Rejected number of jobs rejected because the queue was full.
+	Rejected uint64
+	// Completed number of jobs that have run to completion.
+	Completed uint64
+	// AvgWait average time a job spent queued before it started.
+	AvgWait time.Duration
+	// MaxWait longest time a job spent queued before it started.
+	MaxWait time.Duration
+}
+
+type item struct {
+	job      Job
+	enqueued time.Time
+}
+
+// Pool runs jobs on a fixed number of workers fed by a bounded queue.
+type Pool struct {
+	sync.Mutex
+	name      string
+	jobs      chan item
+	wg        sync.WaitGroup
+	closed    bool
+	stats     Stats
+	totalWait time.Duration
+}
+
+// New starts a pool with the specified number of workers and queue depth.
+func New(name string, concurrency int, depth int) (*Pool, error) {
+	if concurrency <= 0 || depth < 0 {
+		return nil, ErrEinval
+	}
+	p := &Pool{
+		name: name,
+		jobs: make(chan item, depth),
+		stats: Stats{
+			Name:        name,
+			Concurrency: concurrency,
+			QueueDepth:  depth,
+		},
+	}
+	for i := 0; i < concurrency; i++ {
+		p.wg.Add(1)
+		go p.run()
+	}
+	return p, nil
+}
+
+func (p *Pool) run() {
+	defer p.wg.Done()
+	for it := range p.jobs {
+		wait := time.Since(it.enqueued)
+		p.Lock()
+		p.totalWait += wait
+		if wait > p.stats.MaxWait {
+			p.stats.MaxWait = wait
+		}
+		p.Unlock()
+
+		it.job()
+
+		p.Lock()
+		p.stats.Completed++
+		p.Unlock()
+	}
+}
+
+// Submit queues job for execution. It does not block, ErrFull is returned
+// if the queue is saturated.
+func (p *Pool) Submit(job Job) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return ErrShutdown
+	}
+	select {
+	case p.jobs <- item{job: job, enqueued: time.Now()}:
+		p.stats.Submitted++
+		return nil
+	default:
+		p.stats.Rejected++
+		return ErrFull
+	}
+}
+
+// Stats returns a snapshot of the pool statistics.
+func (p *Pool) Stats() Stats {
+	p.Lock()
+	defer p.Unlock()
+	s := p.stats
+	s.Queued = len(p.jobs)
+	started := s.Submitted - uint64(s.Queued)
+	if started > 0 {
+		s.AvgWait = p.totalWait / time.Duration(started)
+	}
+	return s
+}
+
+// Shutdown stops accepting jobs and waits for queued jobs to complete.
+func (p *Pool) Shutdown() {
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.jobs)
+	p.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackpressure(t *testing.T) {
+	p, err := New("test", 1, 1)
+	assert.NoError(t, err, "Failed in New")
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	err = p.Submit(func() {
+		close(started)
+		<-block
+	})
+	assert.NoError(t, err, "Failed to submit first job")
+	<-started
+
+	err = p.Submit(func() {})
+	assert.NoError(t, err, "Failed to queue second job")
+	err = p.Submit(func() {})
+	assert.Equal(t, ErrFull, err, "Saturated pool should reject jobs")
+
+	close(block)
+	p.Shutdown()
+
+	s := p.Stats()
+	assert.Equal(t, uint64(2), s.Submitted, "Unexpected submitted count")
+	assert.Equal(t, uint64(2), s.Completed, "Unexpected completed count")
+	assert.Equal(t, uint64(1), s.Rejected, "Unexpected rejected count")
+	assert.Equal(t, ErrShutdown, p.Submit(func() {}), "Submit after shutdown should fail")
+}
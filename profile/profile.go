@@ -0,0 +1,186 @@
+// Package profile keeps named volume specs, such as "db-fast", in the KVDB.
+// Volumes of any driver can be created from a profile name instead of a full
+// spec, with the fields of the spec of the request overriding the profile,
+// much like a storage class.
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const keyBase = "profiles/"
+
+var (
+	// ErrNotFound is returned for profiles that do not exist.
+	ErrNotFound = errors.New("Profile not found")
+)
+
+var store kvdb.Kvdb
+
+// SetStore sets the KVDB profiles are kept in, the KVDB instance by default.
+func SetStore(kv kvdb.Kvdb) {
+	store = kv
+}
+
+func kv() kvdb.Kvdb {
+	if store != nil {
+		return store
+	}
+	return kvdb.Instance()
+}
+
+func key(name string) string {
+	return keyBase + name
+}
+
+// Put creates or replaces profile p.
+func Put(p *api.VolumeProfile) error {
+	if p.Name == "" || strings.ContainsAny(p.Name, "/ ") {
+		return fmt.Errorf("Invalid profile name %q", p.Name)
+	}
+	_, err := kv().Put(key(p.Name), p, 0)
+	return err
+}
+
+// Get returns the named profile.
+// Errors ErrNotFound may be returned.
+func Get(name string) (*api.VolumeProfile, error) {
+	var p api.VolumeProfile
+	if _, err := kv().GetVal(key(name), &p); err != nil {
+		if err == kvdb.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Delete removes the named profile. Volumes created from it are not
+// affected.
+// Errors ErrNotFound may be returned.
+func Delete(name string) error {
+	if _, err := kv().Delete(key(name)); err != nil {
+		if err == kvdb.ErrNotFound {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Enumerate returns all profiles sorted by name.
+func Enumerate() ([]api.VolumeProfile, error) {
+	kvp, err := kv().Enumerate(keyBase)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]api.VolumeProfile, 0, len(kvp))
+	for _, v := range kvp {
+		var p api.VolumeProfile
+		if err = json.Unmarshal(v.Value, &p); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+// Resolve returns the spec to create a volume with. If options name a
+// profile, it is the spec of the profile overridden by the fields set in
+// spec, otherwise it is spec.
+// Errors ErrNotFound may be returned.
+func Resolve(options *api.CreateOptions, spec *api.VolumeSpec) (*api.VolumeSpec, error) {
+	if options == nil || options.Profile == "" {
+		return spec, nil
+	}
+	p, err := Get(options.Profile)
+	if err != nil {
+		return nil, err
+	}
+	return Merge(&p.Spec, spec), nil
+}
+
+// Merge returns a copy of base with the fields set in overrides replaced.
+// Fields at their zero value, such as a false Dedupe, do not override base.
+// ConfigLabels are merged.
+func Merge(base, overrides *api.VolumeSpec) *api.VolumeSpec {
+	spec := *base
+	if base.Cache != nil {
+		c := *base.Cache
+		spec.Cache = &c
+	}
+	if base.RootDir != nil {
+		r := *base.RootDir
+		spec.RootDir = &r
+	}
+	if len(base.ConfigLabels) > 0 {
+		spec.ConfigLabels = make(api.Labels)
+		for k, v := range base.ConfigLabels {
+			spec.ConfigLabels[k] = v
+		}
+	}
+	if overrides == nil {
+		return &spec
+	}
+	o := overrides
+	if o.Ephemeral {
+		spec.Ephemeral = true
+	}
+	if o.Size != 0 {
+		spec.Size = o.Size
+	}
+	if o.Format != "" {
+		spec.Format = o.Format
+	}
+	if o.BlockSize != 0 {
+		spec.BlockSize = o.BlockSize
+	}
+	if o.HALevel != 0 {
+		spec.HALevel = o.HALevel
+	}
+	if o.Cos != 0 {
+		spec.Cos = o.Cos
+	}
+	if o.Dedupe {
+		spec.Dedupe = true
+	}
+	if o.Compressed {
+		spec.Compressed = true
+	}
+	if o.Compression != "" {
+		spec.Compression = o.Compression
+	}
+	if o.SnapshotInterval != 0 {
+		spec.SnapshotInterval = o.SnapshotInterval
+	}
+	if o.Retention != nil {
+		r := *o.Retention
+		spec.Retention = &r
+	}
+	if len(o.ConfigLabels) > 0 {
+		if spec.ConfigLabels == nil {
+			spec.ConfigLabels = make(api.Labels)
+		}
+		for k, v := range o.ConfigLabels {
+			spec.ConfigLabels[k] = v
+		}
+	}
+	if o.Cache != nil {
+		c := *o.Cache
+		spec.Cache = &c
+	}
+	if o.RootDir != nil {
+		r := *o.RootDir
+		spec.RootDir = &r
+	}
+	return &spec
+}
@@ -0,0 +1,60 @@
+package profile
+
+import (
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/portworx/kvdb/mem"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestProfiles(t *testing.T) {
+	kv, err := kvdb.New(mem.Name, "profile_test", nil, nil)
+	assert.NoError(t, err, "Failed to create kvdb")
+	SetStore(kv)
+
+	fast := &api.VolumeProfile{
+		Name: "db-fast",
+		Spec: api.VolumeSpec{
+			Size:         10 << 30,
+			Format:       api.FsXfs,
+			HALevel:      2,
+			Cos:          api.VolumeCosMax,
+			ConfigLabels: api.Labels{"tier": "ssd"},
+		},
+	}
+	assert.NoError(t, Put(fast), "Failed to create profile")
+	assert.Error(t, Put(&api.VolumeProfile{Name: "a/b"}), "Invalid name should be rejected")
+
+	profiles, err := Enumerate()
+	assert.NoError(t, err, "Failed to enumerate profiles")
+	assert.Equal(t, 1, len(profiles), "Profile should be listed")
+
+	spec, err := Resolve(&api.CreateOptions{Profile: "db-fast"},
+		&api.VolumeSpec{Size: 20 << 30, ConfigLabels: api.Labels{"app": "pg"}})
+	assert.NoError(t, err, "Failed to resolve profile")
+	assert.Equal(t, uint64(20<<30), spec.Size, "Spec should override the profile")
+	assert.Equal(t, api.FsXfs, spec.Format, "Profile should fill unset fields")
+	assert.Equal(t, 2, spec.HALevel, "Profile should fill unset fields")
+	assert.Equal(t, api.Labels{"tier": "ssd", "app": "pg"}, spec.ConfigLabels, "Labels should be merged")
+	assert.Equal(t, 1, len(fast.Spec.ConfigLabels), "Profile should not be modified")
+
+	owner := 999
+	spec, err = Resolve(&api.CreateOptions{Profile: "db-fast"},
+		&api.VolumeSpec{RootDir: &api.RootDirSpec{UID: &owner, GID: &owner}})
+	assert.NoError(t, err, "Failed to resolve profile")
+	assert.Equal(t, &api.RootDirSpec{UID: &owner, GID: &owner}, spec.RootDir, "Spec should set the root directory")
+
+	spec = &api.VolumeSpec{Size: 1}
+	resolved, err := Resolve(nil, spec)
+	assert.NoError(t, err, "Failed to resolve without profile")
+	assert.Equal(t, spec, resolved, "Spec should be used without profile")
+
+	_, err = Resolve(&api.CreateOptions{Profile: "missing"}, nil)
+	assert.Equal(t, ErrNotFound, err, "Missing profile should not resolve")
+
+	assert.NoError(t, Delete("db-fast"), "Failed to delete profile")
+	assert.Equal(t, ErrNotFound, Delete("db-fast"), "Deleted profile should not exist")
+}
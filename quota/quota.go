@@ -0,0 +1,273 @@
+// Package quota keeps the quotas of tenants in the KVDB and enforces them on
+// the creates, resizes and transfers of volumes. The tenant of a volume is
+// its owner, the authenticated principal that created it or that it was
+// transferred to, and the usage of a tenant is the number of its volumes and
+// the bytes provisioned to them across all drivers. Volumes of local callers
+// have no owner and are not limited.
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	keyBase = "quotas/"
+	// HookName name of the hook enforcing quotas.
+	HookName = "quota"
+)
+
+var (
+	// ErrNotFound is returned for quotas that do not exist.
+	ErrNotFound = errors.New("Quota not found")
+)
+
+var store kvdb.Kvdb
+
+// SetStore sets the KVDB quotas are kept in, the KVDB instance by default.
+func SetStore(kv kvdb.Kvdb) {
+	store = kv
+}
+
+func kv() kvdb.Kvdb {
+	if store != nil {
+		return store
+	}
+	return kvdb.Instance()
+}
+
+func key(tenant string) string {
+	return keyBase + tenant
+}
+
+// Put creates or replaces quota q.
+func Put(q *api.Quota) error {
+	if q.Tenant == "" || strings.ContainsAny(q.Tenant, "/ ") {
+		return fmt.Errorf("Invalid tenant %q", q.Tenant)
+	}
+	if q.MaxVolumes < 0 {
+		return fmt.Errorf("Invalid volume count %d of the quota of %s", q.MaxVolumes, q.Tenant)
+	}
+	_, err := kv().Put(key(q.Tenant), q, 0)
+	return err
+}
+
+// Get returns the quota of tenant and its usage.
+// Errors ErrNotFound may be returned.
+func Get(tenant string) (*api.QuotaUsage, error) {
+	var q api.Quota
+	if _, err := kv().GetVal(key(tenant), &q); err != nil {
+		if err == kvdb.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return usage(&q)
+}
+
+// Delete removes the quota of tenant, whose volumes are no longer limited.
+// Errors ErrNotFound may be returned.
+func Delete(tenant string) error {
+	if _, err := kv().Delete(key(tenant)); err != nil {
+		if err == kvdb.ErrNotFound {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func quotas() ([]api.Quota, error) {
+	kvp, err := kv().Enumerate(keyBase)
+	if err != nil {
+		return nil, err
+	}
+	quotas := make([]api.Quota, 0, len(kvp))
+	for _, v := range kvp {
+		var q api.Quota
+		if err = json.Unmarshal(v.Value, &q); err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, q)
+	}
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].Tenant < quotas[j].Tenant })
+	return quotas, nil
+}
+
+// Enumerate returns all quotas and their usage sorted by tenant.
+func Enumerate() ([]api.QuotaUsage, error) {
+	quotas, err := quotas()
+	if err != nil {
+		return nil, err
+	}
+	usages := make([]api.QuotaUsage, 0, len(quotas))
+	for i := range quotas {
+		u, err := usage(&quotas[i])
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, *u)
+	}
+	return usages, nil
+}
+
+// usage counts the volumes of the tenant of q on all drivers.
+func usage(q *api.Quota) (*api.QuotaUsage, error) {
+	u := &api.QuotaUsage{Quota: *q}
+	for _, name := range volume.Instances() {
+		d, err := volume.Get(name)
+		if err != nil {
+			continue
+		}
+		vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list the volumes of %s on %s: %v", q.Tenant, name, err)
+		}
+		for _, v := range vols {
+			if v.Ownership.Owner != q.Tenant {
+				continue
+			}
+			u.Volumes++
+			if v.Spec != nil {
+				u.Bytes += v.Spec.Size
+			}
+		}
+	}
+	return u, nil
+}
+
+// reservation of the volumes and bytes of an operation for the quota of a
+// tenant.
+type reservation struct {
+	tenant  string
+	volumes int
+	bytes   uint64
+}
+
+var (
+	lock sync.Mutex
+	// reserved operations admitted on this node that have not returned yet,
+	// so that concurrent operations do not exceed a quota together.
+	reserved = make(map[*api.HookRequest]*reservation)
+)
+
+// Enable enforces quotas on the creates, resizes and transfers of all
+// drivers.
+func Enable() error {
+	ops := []string{volume.HookCreate, volume.HookResize, volume.HookTransfer}
+	if err := volume.RegisterHook(HookName, "", api.HookPre, admit, ops...); err != nil {
+		return err
+	}
+	return volume.RegisterHook(HookName+"-release", "", api.HookPost, release, ops...)
+}
+
+// Disable stops enforcing quotas.
+func Disable() {
+	volume.UnregisterHook(HookName)
+	volume.UnregisterHook(HookName + "-release")
+}
+
+// inspect returns the volume an operation is made on.
+func inspect(req *api.HookRequest) (*api.Volume, error) {
+	d, err := volume.Get(req.Driver)
+	if err != nil {
+		return nil, err
+	}
+	vols, err := d.Inspect([]api.VolumeID{req.VolumeID})
+	if err != nil {
+		return nil, err
+	}
+	if len(vols) != 1 {
+		return nil, volume.ErrEnoEnt
+	}
+	return &vols[0], nil
+}
+
+// demand returns the tenant an operation adds volumes or bytes to and how
+// many, an empty tenant if it adds none.
+func demand(req *api.HookRequest) (*reservation, error) {
+	switch req.Op {
+	case volume.HookCreate:
+		r := &reservation{tenant: req.Principal, volumes: 1}
+		if req.Spec != nil {
+			r.bytes = req.Spec.Size
+		}
+		return r, nil
+	case volume.HookResize:
+		v, err := inspect(req)
+		if err != nil {
+			return nil, err
+		}
+		r := &reservation{tenant: v.Ownership.Owner}
+		if v.Spec != nil && req.Spec != nil && req.Spec.Size > v.Spec.Size {
+			r.bytes = req.Spec.Size - v.Spec.Size
+		}
+		return r, nil
+	case volume.HookTransfer:
+		v, err := inspect(req)
+		if err != nil {
+			return nil, err
+		}
+		if v.Ownership.Owner == req.Owner {
+			return &reservation{}, nil
+		}
+		r := &reservation{tenant: req.Owner, volumes: 1}
+		if v.Spec != nil {
+			r.bytes = v.Spec.Size
+		}
+		return r, nil
+	}
+	return &reservation{}, nil
+}
+
+// admit fails operations that would take the volumes of a tenant over its
+// quota, and reserves what those admitted add until they return.
+func admit(ctx context.Context, req *api.HookRequest) error {
+	r, err := demand(req)
+	if err != nil || r.tenant == "" || (r.volumes == 0 && r.bytes == 0) {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	u, err := Get(r.tenant)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, other := range reserved {
+		if other.tenant == r.tenant {
+			u.Volumes += other.volumes
+			u.Bytes += other.bytes
+		}
+	}
+	if u.MaxVolumes > 0 && u.Volumes+r.volumes > u.MaxVolumes {
+		return fmt.Errorf("Tenant %s has %d of its %d volumes", r.tenant, u.Volumes, u.MaxVolumes)
+	}
+	if u.MaxBytes > 0 && u.Bytes+r.bytes > u.MaxBytes {
+		return fmt.Errorf("Tenant %s has %d of its %d bytes, %d requested",
+			r.tenant, u.Bytes, u.MaxBytes, r.bytes)
+	}
+	reserved[req] = r
+	return nil
+}
+
+// release drops the reservation of an operation once it returned, what it
+// added is then counted if it succeeded.
+func release(ctx context.Context, req *api.HookRequest) error {
+	lock.Lock()
+	defer lock.Unlock()
+	delete(reserved, req)
+	return nil
+}
@@ -0,0 +1,115 @@
+package quota
+
+import (
+	"context"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/portworx/kvdb/mem"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+type quotaDriver struct {
+	volume.VolumeDriver
+	e volume.Enumerator
+}
+
+func (d *quotaDriver) String() string          { return "quota_test" }
+func (d *quotaDriver) Type() volume.DriverType { return volume.File }
+func (d *quotaDriver) Shutdown()               {}
+
+func (d *quotaDriver) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
+	return d.e.Inspect(ids)
+}
+
+func (d *quotaDriver) Enumerate(locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error) {
+	return d.e.Enumerate(locator, labels)
+}
+
+func TestQuotas(t *testing.T) {
+	kv, err := kvdb.New(mem.Name, "quota_test", nil, nil)
+	assert.NoError(t, err, "Failed to create kvdb")
+	SetStore(kv)
+	defer SetStore(nil)
+
+	assert.Error(t, Put(&api.Quota{Tenant: "a/b"}), "Invalid tenant accepted")
+	assert.NoError(t, Put(&api.Quota{Tenant: "acme", MaxVolumes: 2, MaxBytes: 3 << 30}))
+	assert.NoError(t, Put(&api.Quota{Tenant: "initech", MaxVolumes: 1}))
+	quotas, err := Enumerate()
+	assert.NoError(t, err)
+	if assert.Len(t, quotas, 2) {
+		assert.Equal(t, "acme", quotas[0].Tenant)
+		assert.Equal(t, 0, quotas[0].Volumes)
+	}
+
+	ctx := context.Background()
+	create := func(principal string, size uint64) *api.HookRequest {
+		return &api.HookRequest{
+			Op:        volume.HookCreate,
+			Principal: principal,
+			Locator:   &api.VolumeLocator{VolumeLabels: api.Labels{"tenant": "initech"}},
+			Spec:      &api.VolumeSpec{Size: size},
+		}
+	}
+	first, second := create("acme", 1<<30), create("acme", 1<<30)
+	assert.NoError(t, admit(ctx, first))
+	assert.NoError(t, admit(ctx, second))
+	assert.Error(t, admit(ctx, create("acme", 1<<30)), "Creates over the volume quota admitted")
+	assert.NoError(t, admit(ctx, create("", 1<<30)), "Quota applied to local callers")
+
+	release(ctx, first)
+	assert.Error(t, admit(ctx, create("acme", 3<<30)), "Creates over the bytes quota admitted")
+	third := create("acme", 2<<30)
+	assert.NoError(t, admit(ctx, third))
+	release(ctx, second)
+	release(ctx, third)
+
+	assert.NoError(t, Delete("initech"))
+	_, err = Get("initech")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, Delete("initech"))
+}
+
+func TestResizeAndTransfer(t *testing.T) {
+	kv, err := kvdb.New(mem.Name, "quota_test", nil, nil)
+	assert.NoError(t, err, "Failed to create kvdb")
+	SetStore(kv)
+	defer SetStore(nil)
+
+	enumerator := volume.NewDefaultEnumerator("quota_test", kv)
+	err = volume.Register("quota_test", func(c *volume.DriverContext) (volume.VolumeDriver, error) {
+		return &quotaDriver{e: enumerator}, nil
+	})
+	assert.NoError(t, err, "Failed to register driver")
+	defer volume.Deregister("quota_test")
+	_, err = volume.NewWithKvdb("quota_test", nil, kv)
+	assert.NoError(t, err, "Failed to start driver")
+	defer volume.Remove("quota_test", true)
+
+	vol := &api.Volume{ID: "quota_test_vol", Spec: &api.VolumeSpec{Size: 1 << 30}}
+	vol.Ownership.Owner = "acme"
+	assert.NoError(t, enumerator.CreateVol(vol))
+	assert.NoError(t, Put(&api.Quota{Tenant: "acme", MaxBytes: 2 << 30}))
+	assert.NoError(t, Put(&api.Quota{Tenant: "initech", MaxVolumes: 1}))
+
+	ctx := context.Background()
+	resize := func(size uint64) *api.HookRequest {
+		return &api.HookRequest{Op: volume.HookResize, Driver: "quota_test",
+			VolumeID: vol.ID, Spec: &api.VolumeSpec{Size: size}}
+	}
+	assert.NoError(t, admit(ctx, resize(2<<30)))
+	assert.Error(t, admit(ctx, resize(3<<30)), "Resize over the bytes quota admitted")
+
+	transfer := func(owner string) *api.HookRequest {
+		return &api.HookRequest{Op: volume.HookTransfer, Driver: "quota_test",
+			VolumeID: vol.ID, Owner: owner}
+	}
+	assert.NoError(t, admit(ctx, transfer("acme")), "Transfer to the owner counted")
+	req := transfer("initech")
+	assert.NoError(t, admit(ctx, req))
+	assert.Error(t, admit(ctx, transfer("initech")), "Transfer over the volume quota admitted")
+	release(ctx, req)
+}
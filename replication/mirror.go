@@ -0,0 +1,152 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// rebuildChunk bytes are copied at a time by CopyReplica.
+const rebuildChunk = 1 << 20
+
+var (
+	// ErrNoReplicas is returned by Mirror writes when there is no replica to
+	// write to.
+	ErrNoReplicas = errors.New("No replica to write to")
+	// ErrNotAcknowledged is returned by Mirror writes that a replica failed.
+	ErrNotAcknowledged = errors.New("Write not acknowledged by every replica")
+)
+
+// Mirror synchronously mirrors writes to the replicas of a volume, for
+// drivers that replicate block data themselves. A write completes once every
+// replica acknowledged it. Replicas that fail a write are dropped from the
+// mirror and reported to the failure callback, typically
+// Engine.ReplicaFailed, so that they get rebuilt.
+type Mirror struct {
+	lock      sync.RWMutex
+	replicas  map[api.MachineID]io.WriterAt
+	onFailure func(node api.MachineID, err error)
+}
+
+// NewMirror returns a Mirror writing to replicas. onFailure may be nil.
+func NewMirror(replicas map[api.MachineID]io.WriterAt,
+	onFailure func(node api.MachineID, err error)) *Mirror {
+	m := &Mirror{
+		replicas:  make(map[api.MachineID]io.WriterAt),
+		onFailure: onFailure,
+	}
+	for node, w := range replicas {
+		m.replicas[node] = w
+	}
+	return m
+}
+
+// Add starts mirroring writes to the replica on node. The caller must have
+// synchronized the replica with the others, see CopyReplica.
+func (m *Mirror) Add(node api.MachineID, w io.WriterAt) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.replicas[node] = w
+}
+
+// Remove stops mirroring writes to the replica on node.
+func (m *Mirror) Remove(node api.MachineID) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.replicas, node)
+}
+
+// Nodes returns the nodes writes are mirrored to, sorted.
+func (m *Mirror) Nodes() []api.MachineID {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	nodes := make([]api.MachineID, 0, len(m.replicas))
+	for node := range m.replicas {
+		nodes = append(nodes, node)
+	}
+	sort.Sort(machineIDs(nodes))
+	return nodes
+}
+
+type machineIDs []api.MachineID
+
+func (s machineIDs) Len() int           { return len(s) }
+func (s machineIDs) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s machineIDs) Less(i, j int) bool { return s[i] < s[j] }
+
+// WriteAt writes p to all replicas in parallel. It fails if any replica
+// failed the write, the replicas that failed are dropped from the mirror.
+// Errors ErrNoReplicas, ErrNotAcknowledged may be returned.
+func (m *Mirror) WriteAt(p []byte, off int64) (int, error) {
+	type result struct {
+		node api.MachineID
+		err  error
+	}
+	m.lock.RLock()
+	results := make(chan result, len(m.replicas))
+	for node, w := range m.replicas {
+		go func(node api.MachineID, w io.WriterAt) {
+			n, err := w.WriteAt(p, off)
+			if err == nil && n != len(p) {
+				err = io.ErrShortWrite
+			}
+			results <- result{node, err}
+		}(node, w)
+	}
+	count := len(m.replicas)
+	m.lock.RUnlock()
+	if count == 0 {
+		return 0, ErrNoReplicas
+	}
+
+	var failed []result
+	for i := 0; i < count; i++ {
+		if r := <-results; r.err != nil {
+			failed = append(failed, r)
+		}
+	}
+	for _, r := range failed {
+		m.Remove(r.node)
+		if m.onFailure != nil {
+			m.onFailure(r.node, r.err)
+		}
+	}
+	if len(failed) > 0 {
+		return 0, ErrNotAcknowledged
+	}
+	return len(p), nil
+}
+
+// CopyReplica copies the first size bytes of src, an in sync replica, to
+// dst, a replica being rebuilt, within the bandwidth of
+// volume.BandwidthRebuild. Replicators copy the data of new replicas with it
+// in AddReplica, so that rebuilds do not starve the IO of applications.
+func CopyReplica(ctx context.Context, dst io.WriterAt, src io.ReaderAt, size int64) error {
+	buf := make([]byte, rebuildChunk)
+	for off := int64(0); off < size; {
+		n := len(buf)
+		if left := size - off; left < int64(n) {
+			n = int(left)
+		}
+		if err := volume.Throttle(ctx, volume.BandwidthRebuild, n); err != nil {
+			return err
+		}
+		n, err := src.ReadAt(buf[:n], off)
+		if err != nil && (err != io.EOF || n == 0) {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if _, err = dst.WriteAt(buf[:n], off); err != nil {
+			return err
+		}
+		off += int64(n)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type replica struct {
+	data []byte
+	err  error
+}
+
+func (r *replica) WriteAt(p []byte, off int64) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if n := int(off) + len(p); n > len(r.data) {
+		r.data = append(r.data, make([]byte, n-len(r.data))...)
+	}
+	return copy(r.data[off:], p), nil
+}
+
+func TestMirror(t *testing.T) {
+	a, b, c := &replica{}, &replica{}, &replica{err: errors.New("down")}
+	var failed []api.MachineID
+	m := NewMirror(nil, func(node api.MachineID, err error) {
+		failed = append(failed, node)
+	})
+	m.Add("a", a)
+	m.Add("b", b)
+	m.Add("c", c)
+
+	_, err := m.WriteAt([]byte("hello"), 2)
+	assert.Equal(t, ErrNotAcknowledged, err, "Write missed by a replica")
+	assert.Equal(t, []api.MachineID{"c"}, failed)
+	assert.Equal(t, []api.MachineID{"a", "b"}, m.Nodes())
+
+	n, err := m.WriteAt([]byte("hello"), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "\x00\x00hello", string(a.data))
+	assert.Equal(t, a.data, b.data)
+
+	a.err, b.err = errors.New("down"), errors.New("down")
+	_, err = m.WriteAt([]byte("x"), 0)
+	assert.Equal(t, ErrNotAcknowledged, err)
+	assert.Equal(t, 0, len(m.Nodes()))
+	_, err = m.WriteAt([]byte("x"), 0)
+	assert.Equal(t, ErrNoReplicas, err)
+}
+
+func TestCopyReplica(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), rebuildChunk/8+1)
+	dst := &replica{}
+	assert.NoError(t, CopyReplica(context.Background(), dst, bytes.NewReader(data), int64(len(data))))
+	assert.Equal(t, data, dst.data)
+
+	err := CopyReplica(context.Background(), &replica{}, bytes.NewReader(data), int64(len(data))+1)
+	assert.Equal(t, io.ErrUnexpectedEOF, err, "Short source copied")
+}
+
+func TestReplicaState(t *testing.T) {
+	v := &api.Volume{Spec: &api.VolumeSpec{HALevel: 1}}
+	assert.True(t, Degraded(v))
+	assert.Equal(t, api.MachineNone, primary(v))
+
+	setReplica(v, "a", api.ReplicaInSync)
+	setReplica(v, "b", api.ReplicaRebuilding)
+	assert.True(t, Degraded(v))
+	assert.Equal(t, []api.MachineID{"a", "b"}, v.ReplicaSet)
+
+	setReplica(v, "b", api.ReplicaInSync)
+	assert.False(t, Degraded(v))
+	assert.Equal(t, api.MachineID("a"), primary(v))
+
+	setReplica(v, "a", api.ReplicaFailed)
+	assert.True(t, Degraded(v))
+	assert.Equal(t, api.MachineID("b"), primary(v))
+
+	removeReplica(v, "a")
+	assert.Equal(t, []api.MachineID{"b"}, v.ReplicaSet)
+	assert.Equal(t, 1, len(v.Replicas))
+
+	assert.False(t, Degraded(&api.Volume{Spec: &api.VolumeSpec{}}))
+}
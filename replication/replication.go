@@ -0,0 +1,428 @@
+// Package replication keeps volumes with an HALevel above 0 on HALevel + 1
+// nodes. Drivers opt in by implementing volume.Replicator, the Engine places
+// replicas with the cluster scheduler, tracks their health in the volume
+// metadata and rebuilds replicas lost to node failures.
+package replication
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/cluster"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// DefaultInterval between reconciliations of replicas.
+const DefaultInterval = time.Minute
+
+var (
+	// ErrNotReplicated is returned for volumes with an HALevel of 0.
+	ErrNotReplicated = errors.New("Volume is not replicated")
+)
+
+// Nodes returns the nodes replicas may currently be placed on.
+type Nodes func() ([]cluster.Candidate, error)
+
+// Engine manages the replicas of the volumes of one driver. Every node runs
+// an Engine, the first in sync node of a ReplicaSet drives the rebuilds of
+// that volume so that nodes do not race each other.
+type Engine struct {
+	d         volume.VolumeDriver
+	r         volume.Replicator
+	store     volume.Store
+	scheduler cluster.Scheduler
+	nodes     Nodes
+
+	lock       sync.Mutex
+	rebuilding map[api.VolumeID]bool
+	stop       chan struct{}
+}
+
+// New returns an Engine for d, which must implement volume.Replicator and
+// store its metadata in a volume.Store.
+// Errors ErrNotSupported may be returned.
+func New(d volume.VolumeDriver, scheduler cluster.Scheduler, nodes Nodes) (*Engine, error) {
+	r, ok := d.(volume.Replicator)
+	if !ok {
+		return nil, volume.ErrNotSupported
+	}
+	store, ok := d.(volume.Store)
+	if !ok {
+		return nil, volume.ErrNotSupported
+	}
+	return &Engine{
+		d:          d,
+		r:          r,
+		store:      store,
+		scheduler:  scheduler,
+		nodes:      nodes,
+		rebuilding: make(map[api.VolumeID]bool),
+	}, nil
+}
+
+// Start reconciles the replicas of all volumes every interval, replicating
+// new volumes and retrying failed rebuilds.
+func (e *Engine) Start(interval time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.stop != nil {
+		return
+	}
+	e.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				e.reconcile()
+			case <-stop:
+				return
+			}
+		}
+	}(e.stop)
+}
+
+// Stop ends reconciliation started with Start.
+func (e *Engine) Stop() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.stop != nil {
+		close(e.stop)
+		e.stop = nil
+	}
+}
+
+func (e *Engine) reconcile() {
+	vols, err := e.d.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		log.Warnf("Replication of %s cannot enumerate volumes: %v", e.d, err)
+		return
+	}
+	for i := range vols {
+		if Degraded(&vols[i]) {
+			if err = e.Rebuild(vols[i].ID); err != nil {
+				log.Warnf("Failed to rebuild replicas of %v: %v", vols[i].ID, err)
+			}
+		}
+	}
+}
+
+// Degraded returns true if v has fewer in sync replicas than its HALevel
+// requires.
+func Degraded(v *api.Volume) bool {
+	if v.Spec == nil || v.Spec.HALevel <= 0 || v.State == api.VolumeDeleted {
+		return false
+	}
+	return len(inSync(v)) < v.Spec.HALevel+1
+}
+
+func inSync(v *api.Volume) []api.MachineID {
+	nodes := make([]api.MachineID, 0, len(v.Replicas))
+	for _, r := range v.Replicas {
+		if r.State == api.ReplicaInSync {
+			nodes = append(nodes, r.Node)
+		}
+	}
+	return nodes
+}
+
+// primary returns the node responsible for rebuilding v.
+func primary(v *api.Volume) api.MachineID {
+	for _, node := range v.ReplicaSet {
+		for _, r := range v.Replicas {
+			if r.Node == node && r.State == api.ReplicaInSync {
+				return node
+			}
+		}
+	}
+	return api.MachineNone
+}
+
+// setReplica records the state of the replica on node, adding it to the
+// ReplicaSet if needed.
+func setReplica(v *api.Volume, node api.MachineID, state api.ReplicaState) {
+	found := false
+	for _, n := range v.ReplicaSet {
+		if n == node {
+			found = true
+			break
+		}
+	}
+	if !found {
+		v.ReplicaSet = append(v.ReplicaSet, node)
+	}
+	for i := range v.Replicas {
+		if v.Replicas[i].Node == node {
+			if v.Replicas[i].State != state {
+				v.Replicas[i].State = state
+				v.Replicas[i].Time = time.Now()
+			}
+			return
+		}
+	}
+	v.Replicas = append(v.Replicas, api.Replica{Node: node, State: state, Time: time.Now()})
+}
+
+// removeReplica drops node from the ReplicaSet and replicas of v.
+func removeReplica(v *api.Volume, node api.MachineID) {
+	for i, n := range v.ReplicaSet {
+		if n == node {
+			v.ReplicaSet = append(v.ReplicaSet[:i], v.ReplicaSet[i+1:]...)
+			break
+		}
+	}
+	for i, r := range v.Replicas {
+		if r.Node == node {
+			v.Replicas = append(v.Replicas[:i], v.Replicas[i+1:]...)
+			break
+		}
+	}
+}
+
+// update applies fn to the stored volume under the volume lock.
+func (e *Engine) update(volumeID api.VolumeID, fn func(v *api.Volume) error) (*api.Volume, error) {
+	token, err := e.store.Lock(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer e.store.Unlock(token)
+	v, err := e.store.GetVol(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	if err = fn(v); err != nil {
+		return nil, err
+	}
+	return v, e.store.UpdateVol(v)
+}
+
+// Health returns the state of the replicas of a volume.
+// Errors ErrEnoEnt may be returned.
+func (e *Engine) Health(volumeID api.VolumeID) ([]api.Replica, error) {
+	vols, err := e.d.Inspect([]api.VolumeID{volumeID})
+	if err != nil {
+		return nil, err
+	}
+	if len(vols) != 1 {
+		return nil, volume.ErrEnoEnt
+	}
+	return vols[0].Replicas, nil
+}
+
+// ReplicaFailed marks the replica of a volume on node as failed and rebuilds
+// it in the background. Drivers call it when a replica misses a write.
+func (e *Engine) ReplicaFailed(volumeID api.VolumeID, node api.MachineID) error {
+	_, err := e.update(volumeID, func(v *api.Volume) error {
+		setReplica(v, node, api.ReplicaFailed)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Warnf("Replica of %v on %v failed", volumeID, node)
+	go func() {
+		if err := e.Rebuild(volumeID); err != nil {
+			log.Warnf("Failed to rebuild replicas of %v: %v", volumeID, err)
+		}
+	}()
+	return nil
+}
+
+// NodeFailed marks all replicas on node as failed and rebuilds the affected
+// volumes in the background.
+func (e *Engine) NodeFailed(node api.MachineID) error {
+	vols, err := e.d.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		return err
+	}
+	for _, v := range vols {
+		for _, n := range v.ReplicaSet {
+			if n == node {
+				if err = e.ReplicaFailed(v.ID, node); err != nil {
+					log.Warnf("Failed to mark replica of %v on %v failed: %v", v.ID, node, err)
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Engine) begin(volumeID api.VolumeID) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.rebuilding[volumeID] {
+		return false
+	}
+	e.rebuilding[volumeID] = true
+	return true
+}
+
+func (e *Engine) end(volumeID api.VolumeID) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.rebuilding, volumeID)
+}
+
+// Rebuild replaces the failed replicas of a volume with new replicas on
+// healthy nodes until it has HALevel + 1 in sync replicas. A volume without
+// replicas is seeded with this node, which is in sync once the driver
+// synchronized its copy. Rebuilds only run on the primary node of the
+// volume, Rebuild is a no-op on other nodes.
+// Errors ErrEnoEnt, ErrNotReplicated, ErrNoPlacement may be returned.
+func (e *Engine) Rebuild(volumeID api.VolumeID) error {
+	if !e.begin(volumeID) {
+		return nil
+	}
+	defer e.end(volumeID)
+
+	self := volume.NodeID()
+	seed := false
+	v, err := e.update(volumeID, func(v *api.Volume) error {
+		if v.Spec == nil || v.Spec.HALevel <= 0 {
+			return ErrNotReplicated
+		}
+		if len(v.Replicas) == 0 {
+			setReplica(v, self, api.ReplicaRebuilding)
+			seed = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if seed {
+		if err = e.addReplica(volumeID, self); err != nil {
+			return err
+		}
+		if v, err = e.store.GetVol(volumeID); err != nil {
+			return err
+		}
+	}
+	if primary(v) != self {
+		return nil
+	}
+
+	// Drop failed replicas, their nodes may be gone for good.
+	var failed []api.MachineID
+	for _, r := range v.Replicas {
+		if r.State == api.ReplicaFailed {
+			failed = append(failed, r.Node)
+		}
+	}
+	for _, node := range failed {
+		if err = e.r.RemoveReplica(volumeID, node); err != nil {
+			log.Warnf("Failed to remove replica of %v on %v: %v", volumeID, node, err)
+		}
+		node := node
+		if v, err = e.update(volumeID, func(v *api.Volume) error {
+			removeReplica(v, node)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	need := v.Spec.HALevel + 1 - len(v.Replicas)
+	if need <= 0 {
+		return nil
+	}
+	nodes, err := e.nodes()
+	if err != nil {
+		return err
+	}
+	candidates := make([]cluster.Candidate, 0, len(nodes))
+	for _, c := range nodes {
+		used := false
+		for _, n := range v.ReplicaSet {
+			used = used || n == c.ID
+		}
+		if !used {
+			candidates = append(candidates, c)
+		}
+	}
+	spec := *v.Spec
+	spec.HALevel = need - 1
+	set, err := e.scheduler.Place(&spec, candidates)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range set {
+		if err = e.addReplica(volumeID, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) addReplica(volumeID api.VolumeID, node api.MachineID) error {
+	state := func(state api.ReplicaState) error {
+		_, err := e.update(volumeID, func(v *api.Volume) error {
+			setReplica(v, node, state)
+			return nil
+		})
+		return err
+	}
+	if err := state(api.ReplicaRebuilding); err != nil {
+		return err
+	}
+	log.Infof("Rebuilding replica of %v on %v", volumeID, node)
+	if err := e.r.AddReplica(volumeID, node); err != nil {
+		log.Warnf("Failed to rebuild replica of %v on %v: %v", volumeID, node, err)
+		state(api.ReplicaFailed)
+		return err
+	}
+	log.Infof("Replica of %v on %v is in sync", volumeID, node)
+	return state(api.ReplicaInSync)
+}
+
+// String implements cluster.ClusterListener.
+func (e *Engine) String() string {
+	return "replication/" + e.d.String()
+}
+
+// ClusterInit implements cluster.ClusterListener.
+func (e *Engine) ClusterInit(self *cluster.NodeInfo, db *cluster.Database) error {
+	return nil
+}
+
+// Init implements cluster.ClusterListener.
+func (e *Engine) Init(self *cluster.NodeInfo, db *cluster.Database) error {
+	return nil
+}
+
+// Join implements cluster.ClusterListener.
+func (e *Engine) Join(self *cluster.NodeInfo, db *cluster.Database) error {
+	return nil
+}
+
+// Add implements cluster.ClusterListener.
+func (e *Engine) Add(info *cluster.NodeInfo) error {
+	return nil
+}
+
+// Remove implements cluster.ClusterListener, the replicas of a removed node
+// are rebuilt elsewhere.
+func (e *Engine) Remove(info *cluster.NodeInfo) error {
+	return e.NodeFailed(api.MachineID(info.NodeId))
+}
+
+// Update implements cluster.ClusterListener, the replicas of nodes going
+// offline or into error are rebuilt elsewhere.
+func (e *Engine) Update(info *cluster.NodeInfo) error {
+	if info.Status&(cluster.StatusOffline|cluster.StatusError) == 0 {
+		return nil
+	}
+	return e.NodeFailed(api.MachineID(info.NodeId))
+}
+
+// Leave implements cluster.ClusterListener.
+func (e *Engine) Leave(info *cluster.NodeInfo) error {
+	return e.NodeFailed(api.MachineID(info.NodeId))
+}
@@ -0,0 +1,222 @@
+// Package report periodically generates cluster wide capacity, health and
+// compliance reports and delivers them to a configured sink.
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// Format of a generated report.
+type Format string
+
+const (
+	// JSON report format.
+	JSON = Format("json")
+	// CSV report format.
+	CSV = Format("csv")
+	// DefaultTenantLabel volume label used to group capacity by tenant.
+	DefaultTenantLabel = "tenant"
+)
+
+// Capacity is the provisioned and used capacity for a driver and tenant.
+type Capacity struct {
+	Driver      string
+	Tenant      string
+	Volumes     int
+	Provisioned uint64
+	Used        uint64
+}
+
+// Unhealthy is a volume that is not Up.
+type Unhealthy struct {
+	Driver string
+	ID     api.VolumeID
+	Name   string
+	Status api.VolumeStatus
+	Error  string
+}
+
+// Violation is a volume that does not comply with a policy.
+type Violation struct {
+	Driver string
+	ID     api.VolumeID
+	Name   string
+	Policy string
+	Desc   string
+}
+
+// Coverage is the backup coverage for a driver.
+type Coverage struct {
+	Driver string
+	// Volumes total number of volumes.
+	Volumes int
+	// Protected number of volumes with at least one snapshot.
+	Protected int
+}
+
+// Report is a point in time view of the cluster.
+type Report struct {
+	Generated  time.Time
+	Capacity   []Capacity
+	Unhealthy  []Unhealthy
+	Violations []Violation
+	Coverage   []Coverage
+}
+
+// Policy checks a volume for compliance. It returns a description of the
+// violation or "" if the volume complies.
+type Policy struct {
+	Name  string
+	Check func(v *api.Volume, snaps []api.VolumeSnap) string
+}
+
+var (
+	// DefaultPolicies are applied if no policies are configured.
+	DefaultPolicies = []Policy{
+		{
+			Name: "snapshots",
+			Check: func(v *api.Volume, snaps []api.VolumeSnap) string {
+				if len(snaps) == 0 && (v.Spec == nil || v.Spec.SnapshotInterval == 0) {
+					return "volume has no snapshots and no snapshot schedule"
+				}
+				return ""
+			},
+		},
+	}
+)
+
+// Generate builds a report for the named drivers.
+func Generate(drivers []string, tenantLabel string, policies []Policy) (*Report, error) {
+	if tenantLabel == "" {
+		tenantLabel = DefaultTenantLabel
+	}
+	if policies == nil {
+		policies = DefaultPolicies
+	}
+	r := &Report{
+		Generated:  time.Now(),
+		Capacity:   make([]Capacity, 0),
+		Unhealthy:  make([]Unhealthy, 0),
+		Violations: make([]Violation, 0),
+		Coverage:   make([]Coverage, 0),
+	}
+	for _, name := range drivers {
+		d, err := volume.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot locate volume driver %s: %v", name, err)
+		}
+		vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to enumerate %s volumes: %v", name, err)
+		}
+		snaps, err := d.SnapEnumerate(nil, nil)
+		if err != nil && err != volume.ErrNotSupported {
+			return nil, fmt.Errorf("Failed to enumerate %s snaps: %v", name, err)
+		}
+		volSnaps := make(map[api.VolumeID][]api.VolumeSnap)
+		for _, s := range snaps {
+			volSnaps[s.VolumeID] = append(volSnaps[s.VolumeID], s)
+		}
+
+		tenants := make(map[string]*Capacity)
+		coverage := Coverage{Driver: name, Volumes: len(vols)}
+		for i := range vols {
+			v := &vols[i]
+			tenant := v.Locator.VolumeLabels[tenantLabel]
+			c, ok := tenants[tenant]
+			if !ok {
+				c = &Capacity{Driver: name, Tenant: tenant}
+				tenants[tenant] = c
+			}
+			c.Volumes++
+			if v.Spec != nil {
+				c.Provisioned += v.Spec.Size
+			}
+			c.Used += v.Usage
+
+			if v.Status != "" && v.Status != api.Up {
+				r.Unhealthy = append(r.Unhealthy, Unhealthy{
+					Driver: name,
+					ID:     v.ID,
+					Name:   v.Locator.Name,
+					Status: v.Status,
+					Error:  v.Error,
+				})
+			}
+			if len(volSnaps[v.ID]) > 0 {
+				coverage.Protected++
+			}
+			for _, p := range policies {
+				if desc := p.Check(v, volSnaps[v.ID]); desc != "" {
+					r.Violations = append(r.Violations, Violation{
+						Driver: name,
+						ID:     v.ID,
+						Name:   v.Locator.Name,
+						Policy: p.Name,
+						Desc:   desc,
+					})
+				}
+			}
+		}
+		keys := make([]string, 0, len(tenants))
+		for k := range tenants {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			r.Capacity = append(r.Capacity, *tenants[k])
+		}
+		r.Coverage = append(r.Coverage, coverage)
+	}
+	return r, nil
+}
+
+// Encode r in the specified format.
+func (r *Report) Encode(f Format) ([]byte, error) {
+	switch f {
+	case JSON, "":
+		return json.MarshalIndent(r, "", " ")
+	case CSV:
+		return r.csv()
+	}
+	return nil, fmt.Errorf("Unsupported report format %q", f)
+}
+
+// csv flattens the report into rows. The first column names the section
+// each row belongs to.
+func (r *Report) csv() ([]byte, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+
+	w.Write([]string{"section", "driver", "id", "name", "tenant", "volumes",
+		"provisioned", "used", "status", "policy", "desc"})
+	for _, c := range r.Capacity {
+		w.Write([]string{"capacity", c.Driver, "", "", c.Tenant,
+			strconv.Itoa(c.Volumes), u(c.Provisioned), u(c.Used), "", "", ""})
+	}
+	for _, h := range r.Unhealthy {
+		w.Write([]string{"unhealthy", h.Driver, string(h.ID), h.Name, "",
+			"", "", "", string(h.Status), "", h.Error})
+	}
+	for _, v := range r.Violations {
+		w.Write([]string{"violation", v.Driver, string(v.ID), v.Name, "",
+			"", "", "", "", v.Policy, v.Desc})
+	}
+	for _, c := range r.Coverage {
+		w.Write([]string{"coverage", c.Driver, "", "", "",
+			strconv.Itoa(c.Volumes), "", "", "", "",
+			fmt.Sprintf("%d/%d volumes protected", c.Protected, c.Volumes)})
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
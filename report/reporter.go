@@ -0,0 +1,90 @@
+package report
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Config for the periodic reporter.
+type Config struct {
+	// Drivers to report on.
+	Drivers []string
+	// Interval between reports.
+	Interval time.Duration
+	// Format of the delivered report.
+	Format Format
+	// TenantLabel volume label that identifies the owning tenant.
+	TenantLabel string
+	// Policies checked for compliance. DefaultPolicies if nil.
+	Policies []Policy
+	// Sink the report is delivered to.
+	Sink Sink
+}
+
+// Reporter generates and delivers reports on a schedule.
+type Reporter struct {
+	cfg  Config
+	stop chan struct{}
+}
+
+// New returns a reporter for cfg. Call Start to begin reporting.
+func New(cfg Config) (*Reporter, error) {
+	if cfg.Sink == nil {
+		return nil, fmt.Errorf("No report sink configured")
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("Invalid report interval %v", cfg.Interval)
+	}
+	if cfg.Format == "" {
+		cfg.Format = JSON
+	}
+	return &Reporter{cfg: cfg}, nil
+}
+
+// Run generates and delivers a single report.
+func (r *Reporter) Run() error {
+	rep, err := Generate(r.cfg.Drivers, r.cfg.TenantLabel, r.cfg.Policies)
+	if err != nil {
+		return err
+	}
+	data, err := rep.Encode(r.cfg.Format)
+	if err != nil {
+		return err
+	}
+	contentType := "application/json"
+	if r.cfg.Format == CSV {
+		contentType = "text/csv"
+	}
+	name := fmt.Sprintf("openstorage-report-%s.%s",
+		rep.Generated.UTC().Format("20060102T150405Z"), r.cfg.Format)
+	return r.cfg.Sink.Deliver(name, contentType, data)
+}
+
+// Start reporting in the background.
+func (r *Reporter) Start() {
+	r.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		t := time.NewTicker(r.cfg.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := r.Run(); err != nil {
+					log.Warnf("Failed to deliver report to %s: %v", r.cfg.Sink, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(r.stop)
+}
+
+// Stop reporting.
+func (r *Reporter) Stop() {
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
@@ -0,0 +1,35 @@
+package secrets
+
+import "os"
+
+// EnvScheme references secrets in the environment of the daemon, e.g.
+// "env:AWS_SECRET_ACCESS_KEY".
+const EnvScheme = "env"
+
+// Env is a Provider of the environment variables of the daemon. Secrets put
+// are only visible to the daemon and lost when it exits.
+type Env struct{}
+
+// Get returns environment variable name.
+// Errors ErrNotFound may be returned.
+func (Env) Get(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// Put sets environment variable name.
+func (Env) Put(name, value string) error {
+	return os.Setenv(name, value)
+}
+
+// Delete unsets environment variable name.
+// Errors ErrNotFound may be returned.
+func (Env) Delete(name string) error {
+	if _, ok := os.LookupEnv(name); !ok {
+		return ErrNotFound
+	}
+	return os.Unsetenv(name)
+}
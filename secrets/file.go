@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileScheme references secrets in the directory of the File provider, e.g.
+// "file:aws".
+const FileScheme = "file"
+
+// File is a Provider that keeps each secret in a file of its own, readable
+// only by the daemon. Trailing newlines are stripped from secrets read, so
+// that files may be written with an editor.
+type File struct {
+	dir string
+}
+
+// NewFile returns a Provider of the secrets in dir, which is created if it
+// does not exist.
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir}, nil
+}
+
+func (f *File) path(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		return "", fmt.Errorf("Invalid secret name %q", name)
+	}
+	return filepath.Join(f.dir, name), nil
+}
+
+// Get returns the contents of file name.
+// Errors ErrNotFound may be returned.
+func (f *File) Get(name string) (string, error) {
+	p, err := f.path(name)
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// Put writes value to file name.
+func (f *File) Put(name, value string) error {
+	p, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, []byte(value), 0600)
+}
+
+// Delete removes file name.
+// Errors ErrNotFound may be returned.
+func (f *File) Delete(name string) error {
+	p, err := f.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
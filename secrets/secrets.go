@@ -0,0 +1,128 @@
+// Package secrets keeps credentials out of DriverParams. Instead of a
+// password or key, a param holds a reference such as "vault:osd/aws" or
+// "env:AWS_SECRET_ACCESS_KEY", and the secret is read from the provider
+// registered for the scheme of the reference when the driver starts.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// RefSuffix is appended to a DriverParams key to set it from a secret, e.g.
+// "password_secret: vault:osd/cifs" instead of "password: ...".
+const RefSuffix = "_secret"
+
+var (
+	// ErrNotFound is returned for secrets that do not exist.
+	ErrNotFound = errors.New("Secret not found")
+	// ErrNoProvider is returned for references to schemes without a
+	// registered provider.
+	ErrNoProvider = errors.New("No secrets provider for reference")
+)
+
+// Provider stores secrets by name.
+type Provider interface {
+	// Get returns the named secret.
+	// Errors ErrNotFound may be returned.
+	Get(name string) (string, error)
+	// Put creates or replaces the named secret.
+	Put(name, value string) error
+	// Delete removes the named secret.
+	// Errors ErrNotFound may be returned.
+	Delete(name string) error
+}
+
+var (
+	lock      sync.Mutex
+	providers = make(map[string]Provider)
+	params    = make(map[string]bool)
+)
+
+// Register makes provider p serve references with scheme, replacing any
+// previous provider.
+func Register(scheme string, p Provider) {
+	lock.Lock()
+	defer lock.Unlock()
+	providers[scheme] = p
+}
+
+// resolve returns the provider and name of the secret ref refers to.
+func resolve(ref string) (Provider, string, error) {
+	i := strings.Index(ref, ":")
+	if i <= 0 || i == len(ref)-1 {
+		return nil, "", fmt.Errorf("Invalid secret reference %q, expected scheme:name", ref)
+	}
+	lock.Lock()
+	p, ok := providers[ref[:i]]
+	lock.Unlock()
+	if !ok {
+		return nil, "", fmt.Errorf("%v: %q", ErrNoProvider, ref)
+	}
+	return p, ref[i+1:], nil
+}
+
+// Get returns the secret ref refers to.
+// Errors ErrNotFound, ErrNoProvider may be returned.
+func Get(ref string) (string, error) {
+	p, name, err := resolve(ref)
+	if err != nil {
+		return "", err
+	}
+	return p.Get(name)
+}
+
+// Put creates or replaces the secret ref refers to.
+// Errors ErrNoProvider may be returned.
+func Put(ref, value string) error {
+	p, name, err := resolve(ref)
+	if err != nil {
+		return err
+	}
+	return p.Put(name, value)
+}
+
+// Delete removes the secret ref refers to.
+// Errors ErrNotFound, ErrNoProvider may be returned.
+func Delete(ref string) error {
+	p, name, err := resolve(ref)
+	if err != nil {
+		return err
+	}
+	return p.Delete(name)
+}
+
+// Param returns the value of key in params. If key+RefSuffix is set, the
+// value is read from the secret it references instead.
+func Param(params map[string]string, key string) (string, error) {
+	ref, ok := params[key+RefSuffix]
+	if !ok {
+		return params[key], nil
+	}
+	v, err := Get(ref)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read %s: %v", key, err)
+	}
+	return v, nil
+}
+
+// RegisterParam marks DriverParams key as holding a secret, read with Param,
+// so that it is not persisted in plaintext with the params of a driver.
+func RegisterParam(key string) {
+	lock.Lock()
+	defer lock.Unlock()
+	params[key] = true
+}
+
+// IsParam returns true if DriverParams key holds a secret.
+func IsParam(key string) bool {
+	lock.Lock()
+	defer lock.Unlock()
+	return params[key]
+}
+
+func init() {
+	Register(EnvScheme, Env{})
+}
@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParam(t *testing.T) {
+	os.Setenv("OSD_TEST_SECRET", "s3cr3t")
+	defer os.Unsetenv("OSD_TEST_SECRET")
+
+	params := map[string]string{
+		"user":            "osd",
+		"password_secret": "env:OSD_TEST_SECRET",
+		"key_secret":      "none:key",
+	}
+	v, err := Param(params, "user")
+	assert.NoError(t, err, "Failed to read plain param")
+	assert.Equal(t, "osd", v, "Unexpected plain param")
+	v, err = Param(params, "password")
+	assert.NoError(t, err, "Failed to read secret param")
+	assert.Equal(t, "s3cr3t", v, "Unexpected secret param")
+	_, err = Param(params, "key")
+	assert.Error(t, err, "Unknown scheme should fail")
+
+	_, err = Get("env:OSD_TEST_MISSING")
+	assert.Equal(t, ErrNotFound, err, "Missing variable should not be found")
+	_, err = Get("OSD_TEST_SECRET")
+	assert.Error(t, err, "Reference without a scheme should fail")
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(dir)
+	f, err := NewFile(dir)
+	assert.NoError(t, err, "Failed to create file provider")
+	Register(FileScheme, f)
+
+	assert.NoError(t, Put("file:aws", "key\n"), "Failed to put secret")
+	v, err := Get("file:aws")
+	assert.NoError(t, err, "Failed to get secret")
+	assert.Equal(t, "key", v, "Trailing newline should be stripped")
+	assert.Error(t, Put("file:../aws", "key"), "Names must not escape the directory")
+	assert.NoError(t, Delete("file:aws"), "Failed to delete secret")
+	_, err = Get("file:aws")
+	assert.Equal(t, ErrNotFound, err, "Deleted secret should not be found")
+}
+
+func TestVault(t *testing.T) {
+	var lock sync.Mutex
+	kv := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/v1/secret/")
+		lock.Lock()
+		defer lock.Unlock()
+		switch r.Method {
+		case "GET":
+			v, ok := kv[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"value": v},
+			})
+		case "PUT":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			kv[name] = body["value"]
+			w.WriteHeader(http.StatusNoContent)
+		case "DELETE":
+			delete(kv, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	v := NewVault(srv.URL, "token", "")
+	assert.NoError(t, v.Put("osd/cifs", "pass"), "Failed to put secret")
+	s, err := v.Get("osd/cifs")
+	assert.NoError(t, err, "Failed to get secret")
+	assert.Equal(t, "pass", s, "Unexpected secret")
+	assert.NoError(t, v.Delete("osd/cifs"), "Failed to delete secret")
+	_, err = v.Get("osd/cifs")
+	assert.Equal(t, ErrNotFound, err, "Deleted secret should not be found")
+
+	_, err = NewVault(srv.URL, "bad", "").Get("osd/cifs")
+	assert.Error(t, err, "Bad token should fail")
+}
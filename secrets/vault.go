@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultScheme references secrets in HashiCorp Vault, e.g. "vault:osd/aws".
+const VaultScheme = "vault"
+
+// DefaultVaultMount is the path the KV secrets engine is mounted at by
+// default.
+const DefaultVaultMount = "secret"
+
+// Vault is a Provider of the secrets in a version 1 KV secrets engine of
+// HashiCorp Vault. Each secret is kept in the "value" field of its path.
+type Vault struct {
+	address string
+	token   string
+	mount   string
+	client  *http.Client
+}
+
+// NewVault returns a Provider of the secrets in the KV engine mounted at
+// mount on the Vault server at address, authenticated with token.
+func NewVault(address, token, mount string) *Vault {
+	if mount == "" {
+		mount = DefaultVaultMount
+	}
+	return &Vault{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type vaultSecret struct {
+	Data struct {
+		Value string `json:"value"`
+	} `json:"data"`
+}
+
+func (v *Vault) do(method, name string, body io.Reader) (*http.Response, error) {
+	url := fmt.Sprintf("%s/v1/%s/%s", v.address, v.mount, strings.Trim(name, "/"))
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	case resp.StatusCode >= 300:
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Vault %s %s failed: %s: %s",
+			method, name, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+// Get returns the value of secret name.
+// Errors ErrNotFound may be returned.
+func (v *Vault) Get(name string) (string, error) {
+	resp, err := v.do("GET", name, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var s vaultSecret
+	if err = json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return "", err
+	}
+	return s.Data.Value, nil
+}
+
+// Put writes value to secret name.
+func (v *Vault) Put(name, value string) error {
+	b, err := json.Marshal(map[string]string{"value": value})
+	if err != nil {
+		return err
+	}
+	resp, err := v.do("PUT", name, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Delete removes secret name.
+// Errors ErrNotFound may be returned.
+func (v *Vault) Delete(name string) error {
+	resp, err := v.do("DELETE", name, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,262 @@
+// Package tracing records spans of the operations of the daemon, such as
+// REST requests, volume operations and KVDB calls, so that their latency can
+// be analyzed across the daemon, the KVDB and the driver backends.
+//
+// Spans are carried in contexts and propagated over HTTP in the W3C
+// traceparent header. Finished spans are handed to the Exporter set with
+// SetExporter, such as a Zipkin collector, which Jaeger also accepts. Spans
+// are not recorded until an exporter is set.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Header is the HTTP header spans are propagated in.
+	Header = "traceparent"
+
+	// ErrorTag is set on the spans of failed operations.
+	ErrorTag = "error"
+	// DriverTag driver of a volume operation.
+	DriverTag = "driver"
+	// VolumeTag volume of a volume operation.
+	VolumeTag = "volumeID"
+	// NameTag name of the volume created.
+	NameTag = "name"
+)
+
+// Span is a timed operation within a trace.
+type Span struct {
+	// TraceID identifies the trace, the tree of spans of a request.
+	TraceID string
+	// ID of the span.
+	ID string
+	// ParentID of the span that started this span, empty for root spans.
+	ParentID string
+	// Name of the operation.
+	Name string
+	// Start time of the operation.
+	Start time.Time
+	// Duration of the operation, once finished.
+	Duration time.Duration
+	// Tags describe the operation, such as its driver or volume.
+	Tags map[string]string
+	// Kind is "SERVER" for the spans of requests served, empty for local
+	// operations.
+	Kind string
+
+	lock     sync.Mutex
+	finished bool
+}
+
+// Exporter sends finished spans to a tracing backend.
+type Exporter interface {
+	// Export sends span, which must not be modified afterwards.
+	Export(span *Span)
+}
+
+type spanKey struct{}
+
+// unsampledKey is the context key of the ID of a trace that is not
+// recorded, so that none of its spans are.
+type unsampledKey struct{}
+
+var (
+	lock     sync.RWMutex
+	exporter Exporter
+	// sampleRate fraction of the traces started here that are recorded.
+	sampleRate = 1.0
+)
+
+// SetExporter sets the exporter of finished spans, spans are not recorded
+// if e is nil.
+func SetExporter(e Exporter) {
+	lock.Lock()
+	defer lock.Unlock()
+	exporter = e
+}
+
+// SetSampleRate records rate, between 0 and 1, of the traces started on this
+// node. Traces started by a remote caller are recorded if the caller
+// recorded them.
+func SetSampleRate(rate float64) {
+	lock.Lock()
+	defer lock.Unlock()
+	sampleRate = math.Max(0, math.Min(1, rate))
+}
+
+func enabled() (Exporter, float64) {
+	lock.RLock()
+	defer lock.RUnlock()
+	return exporter, sampleRate
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// sampled returns true for a fraction rate of the trace IDs.
+func sampled(traceID string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	var v uint32
+	fmt.Sscanf(traceID[len(traceID)-8:], "%08x", &v)
+	return float64(v) < rate*float64(math.MaxUint32)
+}
+
+// Start starts the span name, a child of the span of ctx or the root of a
+// new trace. The returned context carries the new span. The span is nil,
+// and all its methods no-ops, when spans are not recorded. Traces are
+// sampled once at their root, the spans of a trace that is not recorded are
+// not recorded either.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	e, rate := enabled()
+	if e == nil {
+		return ctx, nil
+	}
+	s := &Span{ID: newID(8), Name: name, Start: time.Now()}
+	if parent := FromContext(ctx); parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.ID
+	} else if _, ok := ctx.Value(unsampledKey{}).(string); ok {
+		return ctx, nil
+	} else {
+		s.TraceID = newID(16)
+		if !sampled(s.TraceID, rate) {
+			return context.WithValue(ctx, unsampledKey{}, s.TraceID), nil
+		}
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// FromContext returns the span of ctx, nil if it has none.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetTag sets the tag key of s to value.
+func (s *Span) SetTag(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.Tags == nil {
+		s.Tags = make(map[string]string)
+	}
+	s.Tags[key] = value
+}
+
+// Finish ends s, failed if err is not nil, and exports it. Spans are
+// exported once.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.SetTag(ErrorTag, err.Error())
+	}
+	s.lock.Lock()
+	if s.finished {
+		s.lock.Unlock()
+		return
+	}
+	s.finished = true
+	s.Duration = time.Since(s.Start)
+	s.lock.Unlock()
+	if e, _ := enabled(); e != nil {
+		e.Export(s)
+	}
+}
+
+// Inject adds the span of ctx to the headers h of an outgoing request, or
+// the trace of ctx flagged as not recorded.
+func Inject(ctx context.Context, h http.Header) {
+	if s := FromContext(ctx); s != nil {
+		h.Set(Header, fmt.Sprintf("00-%s-%s-01", s.TraceID, s.ID))
+	} else if traceID, ok := ctx.Value(unsampledKey{}).(string); ok {
+		h.Set(Header, fmt.Sprintf("00-%s-%s-00", traceID, newID(8)))
+	}
+}
+
+// extract returns the span of the caller of a request with headers h, nil
+// if the request carries none, and whether the caller recorded it.
+func extract(h http.Header) (*Span, bool) {
+	parts := strings.Split(h.Get(Header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return nil, false
+	}
+	if _, err := hex.DecodeString(parts[1] + parts[2]); err != nil {
+		return nil, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return nil, false
+	}
+	return &Span{TraceID: parts[1], ID: parts[2]}, flags[0]&1 != 0
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Flush flushes streamed responses.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Handler wraps h so that each request is served within the span name, a
+// child of the span of the caller if the request carries one. Requests of
+// callers that do not record their trace are not recorded.
+func Handler(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e, _ := enabled(); e == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if parent, sampled := extract(r.Header); parent != nil && sampled {
+			ctx = context.WithValue(ctx, spanKey{}, parent)
+		} else if parent != nil {
+			ctx = context.WithValue(ctx, unsampledKey{}, parent.TraceID)
+		}
+		ctx, span := Start(ctx, name)
+		if span == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		span.Kind = "SERVER"
+		span.SetTag("http.method", r.Method)
+		span.SetTag("http.path", r.URL.Path)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetTag("http.status_code", fmt.Sprint(sw.status))
+		var err error
+		if sw.status >= http.StatusInternalServerError {
+			err = fmt.Errorf("HTTP error %d", sw.status)
+		}
+		span.Finish(err)
+	})
+}
@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder keeps the spans exported.
+type recorder struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+func (r *recorder) Export(span *Span) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+func TestSpans(t *testing.T) {
+	_, span := Start(context.Background(), "disabled")
+	assert.Nil(t, span, "Span recorded without exporter")
+	span.SetTag("key", "value")
+	span.Finish(nil)
+
+	r := &recorder{}
+	SetExporter(r)
+	defer SetExporter(nil)
+
+	ctx, root := Start(context.Background(), "root")
+	_, child := Start(ctx, "child")
+	child.SetTag(VolumeTag, "v1")
+	child.Finish(errors.New("failed"))
+	child.Finish(nil)
+	root.Finish(nil)
+
+	if assert.Len(t, r.spans, 2, "Spans exported more than once") {
+		assert.Equal(t, root.TraceID, r.spans[0].TraceID)
+		assert.Equal(t, root.ID, r.spans[0].ParentID)
+		assert.Equal(t, "failed", r.spans[0].Tags[ErrorTag])
+		assert.Equal(t, "v1", r.spans[0].Tags[VolumeTag])
+		assert.Equal(t, "", r.spans[1].ParentID)
+	}
+
+	SetSampleRate(0)
+	defer SetSampleRate(1)
+	unsampled, span := Start(context.Background(), "unsampled")
+	assert.Nil(t, span, "Unsampled trace recorded")
+	_, span = Start(ctx, "sampled")
+	assert.NotNil(t, span, "Child of a recorded trace not recorded")
+	SetSampleRate(1)
+	_, span = Start(unsampled, "child")
+	assert.Nil(t, span, "Child of an unsampled trace recorded")
+}
+
+func TestPropagation(t *testing.T) {
+	h := http.Header{}
+	h.Set(Header, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	parent, sampled := extract(h)
+	if assert.NotNil(t, parent) {
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", parent.TraceID)
+		assert.Equal(t, "b7ad6b7169203331", parent.ID)
+		assert.True(t, sampled)
+	}
+	h.Set(Header, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+	_, sampled = extract(h)
+	assert.False(t, sampled, "Unsampled caller sampled")
+	h.Set(Header, "00-trace-span-01")
+	parent, _ = extract(h)
+	assert.Nil(t, parent)
+
+	r := &recorder{}
+	SetExporter(r)
+	defer SetExporter(nil)
+	ctx, span := Start(context.Background(), "client")
+	out := http.Header{}
+	Inject(ctx, out)
+
+	var served *Span
+	handler := Handler("GET /volumes", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		served = FromContext(req.Context())
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	req := httptest.NewRequest("GET", "/volumes", nil)
+	req.Header = out
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if assert.NotNil(t, served) && assert.Len(t, r.spans, 1) {
+		assert.Equal(t, span.TraceID, served.TraceID)
+		assert.Equal(t, span.ID, served.ParentID)
+		assert.Equal(t, "SERVER", served.Kind)
+		assert.Equal(t, "500", served.Tags["http.status_code"])
+		assert.NotEqual(t, "", served.Tags[ErrorTag])
+	}
+
+	req = httptest.NewRequest("GET", "/volumes", nil)
+	req.Header.Set(Header, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Nil(t, served, "Request of an unsampled caller recorded")
+	assert.Len(t, r.spans, 1)
+}
@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// zipkinInterval between exports of the spans queued.
+	zipkinInterval = time.Second
+	// zipkinQueue spans queued before further spans are dropped.
+	zipkinQueue = 10000
+)
+
+// Zipkin exports spans in batches to the v2 HTTP API of a Zipkin collector,
+// such as http://zipkin:9411/api/v2/spans, or to the Zipkin endpoint of a
+// Jaeger collector.
+type Zipkin struct {
+	url     string
+	service string
+	client  *http.Client
+
+	lock    sync.Mutex
+	queue   []*Span
+	dropped int
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// zipkinSpan is a span in the Zipkin v2 JSON format.
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind,omitempty"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// NewZipkin returns an exporter of the spans of service to the collector at
+// url. Spans are sent every second until Stop is called.
+func NewZipkin(url string, service string) *Zipkin {
+	z := &Zipkin{
+		url:     url,
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go z.run()
+	return z
+}
+
+// Export queues span to be sent.
+func (z *Zipkin) Export(span *Span) {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	if len(z.queue) >= zipkinQueue {
+		z.dropped++
+		return
+	}
+	z.queue = append(z.queue, span)
+}
+
+func (z *Zipkin) run() {
+	defer close(z.done)
+	t := time.NewTicker(zipkinInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-z.stop:
+			z.Flush()
+			return
+		}
+		if err := z.Flush(); err != nil {
+			log.Warnf("Failed to export spans to %s: %v", z.url, err)
+		}
+	}
+}
+
+// Flush sends the spans queued. Spans that failed to be sent are dropped.
+func (z *Zipkin) Flush() error {
+	z.lock.Lock()
+	spans := z.queue
+	dropped := z.dropped
+	z.queue = nil
+	z.dropped = 0
+	z.lock.Unlock()
+	if dropped > 0 {
+		log.Warnf("Dropped %d spans, the collector at %s does not keep up", dropped, z.url)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	batch := make([]zipkinSpan, 0, len(spans))
+	for _, s := range spans {
+		batch = append(batch, zipkinSpan{
+			TraceID:       s.TraceID,
+			ID:            s.ID,
+			ParentID:      s.ParentID,
+			Name:          s.Name,
+			Kind:          s.Kind,
+			Timestamp:     s.Start.UnixNano() / int64(time.Microsecond),
+			Duration:      int64(s.Duration / time.Microsecond),
+			LocalEndpoint: zipkinEndpoint{ServiceName: z.service},
+			Tags:          s.Tags,
+		})
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	resp, err := z.client.Post(z.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP error %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Stop sends the spans queued and stops the exporter.
+func (z *Zipkin) Stop() {
+	close(z.stop)
+	<-z.done
+}
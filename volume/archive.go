@@ -0,0 +1,328 @@
+package volume
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// snapArchiveVersion version of the archives written by ExportSnap.
+	// Archives of newer versions are refused by ImportSnap.
+	snapArchiveVersion = 1
+	// snapArchiveChunk bytes of data per object of an archive.
+	snapArchiveChunk = 16 << 20
+	// snapArchiveMetadata key of the SnapArchive within the prefix of an
+	// archive. It is written last, so that incomplete exports cannot be
+	// imported.
+	snapArchiveMetadata = "snapshot.json"
+)
+
+// SnapArchiver is implemented by clients that export and import snapshots
+// through a remote daemon. Use ExportSnap and ImportSnap to archive the
+// snapshots of any driver.
+type SnapArchiver interface {
+	// ExportSnap exports snapID to an object store.
+	// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+	ExportSnap(snapID api.SnapID, to api.SnapArchiveLocation) (*api.SnapArchive, error)
+
+	// ImportSnap creates a volume with locator from an exported snapshot.
+	// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+	ImportSnap(from api.SnapArchiveLocation, locator api.VolumeLocator) (api.VolumeID, error)
+}
+
+// DiffApplier is implemented by drivers that can write the files of a diff
+// stream into a volume, such as File drivers that keep volumes as
+// directories. Snapshots can only be imported into such drivers.
+type DiffApplier interface {
+	// ApplyDiff applies the pkg/diff stream r to volumeID.
+	// Errors ErrEnoEnt may be returned.
+	ApplyDiff(volumeID api.VolumeID, r io.Reader) error
+}
+
+// objectStore returns the running Object driver name.
+func objectStore(name string) (ObjectDriver, error) {
+	d, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+	o, ok := d.(ObjectDriver)
+	if !ok {
+		return nil, fmt.Errorf("Driver %s is not an object store: %v", name, ErrEinval)
+	}
+	return o, nil
+}
+
+func chunkKey(prefix string, i int) string {
+	return path.Join(prefix, fmt.Sprintf("data.%06d", i))
+}
+
+// ExportSnap exports a snapshot of d to an object store: the files of the
+// snapshot as a diff stream split into chunks, then the SnapArchive that
+// describes it. Data is sent within the backup bandwidth. The bucket must
+// exist.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func ExportSnap(ctx context.Context,
+	d VolumeDriver,
+	snapID api.SnapID,
+	to api.SnapArchiveLocation) (*api.SnapArchive, error) {
+	if a, ok := d.(SnapArchiver); ok {
+		return a.ExportSnap(snapID, to)
+	}
+	archive := &api.SnapArchive{}
+	if err := ResumeExport(ctx, d, snapID, to, archive, nil); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// ResumeExport exports a snapshot of d as ExportSnap does into archive,
+// skipping the chunks archive already lists so that interrupted exports
+// continue where they stopped. Snapshots do not change, their diff stream is
+// the same on each attempt. Chunks are compressed as archive.Compression
+// says. progress, if set, is called once each chunk is stored, so that
+// callers can record it.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func ResumeExport(ctx context.Context,
+	d VolumeDriver,
+	snapID api.SnapID,
+	to api.SnapArchiveLocation,
+	archive *api.SnapArchive,
+	progress func(*api.SnapArchive) error) error {
+	store, err := objectStore(to.Store)
+	if err != nil {
+		return err
+	}
+	if archive.Compression != "" && archive.Compression != api.SnapArchiveGzip {
+		return fmt.Errorf("Compression %q is not supported: %v", archive.Compression, ErrEinval)
+	}
+	snaps, err := d.SnapInspect([]api.SnapID{snapID})
+	if err != nil || len(snaps) == 0 {
+		return ErrEnoEnt
+	}
+	archive.Version = snapArchiveVersion
+	archive.Snap = snaps[0]
+	archive.Driver = d.String()
+	if vols, err := d.Inspect([]api.VolumeID{snaps[0].VolumeID}); err == nil && len(vols) == 1 {
+		archive.Locator = vols[0].Locator
+		archive.Spec = vols[0].Spec
+	}
+	data, err := SnapDiff(d, "", snapID)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	// All chunks but the last hold snapArchiveChunk bytes of the stream,
+	// the stream ended already if the last chunk stored is partial.
+	skip := int64(len(archive.Chunks)) * snapArchiveChunk
+	_, err = io.CopyN(ioutil.Discard, data, skip)
+	complete := err == io.EOF
+	if err != nil && !complete {
+		return err
+	}
+	r := ThrottleReader(ctx, BandwidthBackup, data)
+	var buf bytes.Buffer
+	for i := len(archive.Chunks); !complete; i++ {
+		buf.Reset()
+		n, err := copyChunk(&buf, r, archive.Compression)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		size := int64(buf.Len())
+		if err = store.PutObject(to.Bucket, chunkKey(to.Prefix, i), bytes.NewReader(buf.Bytes()), size); err != nil {
+			return err
+		}
+		archive.Chunks = append(archive.Chunks, api.SnapArchiveChunk{
+			Size: size,
+			Sum:  hex.EncodeToString(sum[:]),
+		})
+		if progress != nil {
+			if err = progress(archive); err != nil {
+				return err
+			}
+		}
+		complete = n < snapArchiveChunk
+	}
+	archive.Exported = time.Now()
+	meta, err := json.Marshal(archive)
+	if err != nil {
+		return err
+	}
+	key := path.Join(to.Prefix, snapArchiveMetadata)
+	if err = store.PutObject(to.Bucket, key, bytes.NewReader(meta), int64(len(meta))); err != nil {
+		return err
+	}
+	log.Infof("Snapshot %v exported to %s/%s in %d chunks", snapID, to.Bucket, to.Prefix, len(archive.Chunks))
+	return nil
+}
+
+// copyChunk copies the next chunk of r to w, compressed with compression. It
+// returns the number of bytes read from r.
+func copyChunk(w io.Writer, r io.Reader, compression string) (int64, error) {
+	if compression != api.SnapArchiveGzip {
+		n, err := io.CopyN(w, r, snapArchiveChunk)
+		if err == io.EOF {
+			err = nil
+		}
+		return n, err
+	}
+	z := gzip.NewWriter(w)
+	n, err := io.CopyN(z, r, snapArchiveChunk)
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	return n, z.Close()
+}
+
+// ReadSnapArchive returns the description of the snapshot exported at from.
+// Errors ErrEnoEnt, ErrEinval may be returned.
+func ReadSnapArchive(from api.SnapArchiveLocation) (*api.SnapArchive, error) {
+	store, err := objectStore(from.Store)
+	if err != nil {
+		return nil, err
+	}
+	r, err := store.GetObject(from.Bucket, path.Join(from.Prefix, snapArchiveMetadata))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var archive api.SnapArchive
+	if err = json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, err
+	}
+	if archive.Version > snapArchiveVersion {
+		return nil, fmt.Errorf("Archive version %d is not supported: %v", archive.Version, ErrEinval)
+	}
+	if archive.Compression != "" && archive.Compression != api.SnapArchiveGzip {
+		return nil, fmt.Errorf("Compression %q is not supported: %v", archive.Compression, ErrEinval)
+	}
+	return &archive, nil
+}
+
+// ImportSnap creates a volume of d from the snapshot exported at from,
+// possibly by another cluster. The volume takes the spec of the exported
+// volume and locator, or the exported locator if locator has no name. The
+// volume is deleted if the data cannot be imported.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func ImportSnap(ctx context.Context,
+	d VolumeDriver,
+	from api.SnapArchiveLocation,
+	locator api.VolumeLocator) (api.VolumeID, error) {
+	if a, ok := d.(SnapArchiver); ok {
+		return a.ImportSnap(from, locator)
+	}
+	applier, ok := d.(DiffApplier)
+	if !ok {
+		return api.BadVolumeID, ErrNotSupported
+	}
+	archive, err := ReadSnapArchive(from)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	store, err := objectStore(from.Store)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	if locator.Name == "" {
+		locator = archive.Locator
+	}
+	spec := &api.VolumeSpec{}
+	if archive.Spec != nil {
+		*spec = *archive.Spec
+	}
+	// The archive holds files, the filesystem is the choice of d.
+	spec.Format = ""
+	id, err := CreateCtx(ctx, d, locator, nil, spec)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(readChunks(pw, store, from, archive))
+	}()
+	err = applier.ApplyDiff(id, ThrottleReader(ctx, BandwidthBackup, pr))
+	pr.Close()
+	if err != nil {
+		if derr := d.Delete(id); derr != nil {
+			log.Warnf("Failed to delete volume %v of failed import: %v", id, derr)
+		}
+		return api.BadVolumeID, err
+	}
+	log.Infof("Snapshot %v imported from %s/%s as volume %v", archive.Snap.ID, from.Bucket, from.Prefix, id)
+	return id, nil
+}
+
+// readChunks writes the data of the chunks of archive to w in order, once
+// each is verified.
+func readChunks(w io.Writer,
+	store ObjectDriver,
+	from api.SnapArchiveLocation,
+	archive *api.SnapArchive) error {
+	for i, c := range archive.Chunks {
+		r, err := store.GetObject(from.Bucket, chunkKey(from.Prefix, i))
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(r, c.Size+1))
+		r.Close()
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != c.Size || hex.EncodeToString(sum[:]) != c.Sum {
+			return fmt.Errorf("Chunk %d of %s/%s is corrupt", i, from.Bucket, from.Prefix)
+		}
+		if archive.Compression != api.SnapArchiveGzip {
+			if _, err = w.Write(data); err != nil {
+				return err
+			}
+			continue
+		}
+		z, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(w, z); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteSnapArchive deletes the objects of archive, possibly an interrupted
+// export, at location.
+func DeleteSnapArchive(at api.SnapArchiveLocation, archive *api.SnapArchive) error {
+	store, err := objectStore(at.Store)
+	if err != nil {
+		return err
+	}
+	// The metadata goes first, so that no import starts meanwhile.
+	keys := []string{path.Join(at.Prefix, snapArchiveMetadata)}
+	for i := range archive.Chunks {
+		keys = append(keys, chunkKey(at.Prefix, i))
+	}
+	for _, key := range keys {
+		if err = store.DeleteObject(at.Bucket, key); err != nil && err != ErrEnoEnt {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package volume
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// memoryStore is an object store in memory.
+type memoryStore struct {
+	objectDriver
+	objects map[string][]byte
+}
+
+func (d *memoryStore) Shutdown() {}
+
+func (d *memoryStore) PutObject(b, k string, r io.Reader, n int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	d.objects[b+"/"+k] = data
+	return nil
+}
+
+func (d *memoryStore) DeleteObject(b, k string) error {
+	delete(d.objects, b+"/"+k)
+	return nil
+}
+
+func (d *memoryStore) GetObject(b, k string) (io.ReadCloser, error) {
+	data, ok := d.objects[b+"/"+k]
+	if !ok {
+		return nil, ErrEnoEnt
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// archiveDriver has one snapshot whose diff is data, imports record the
+// diffs applied.
+type archiveDriver struct {
+	capabilityDriver
+	data    []byte
+	created api.VolumeLocator
+	applied []byte
+	deleted bool
+}
+
+func (d *archiveDriver) String() string { return "archive_test" }
+
+func (d *archiveDriver) SnapInspect(ids []api.SnapID) ([]api.VolumeSnap, error) {
+	return []api.VolumeSnap{{ID: ids[0], VolumeID: "archive_vol"}}, nil
+}
+
+func (d *archiveDriver) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
+	return []api.Volume{{
+		ID:      ids[0],
+		Locator: api.VolumeLocator{Name: "archived"},
+		Spec:    &api.VolumeSpec{Size: 1 << 20, Format: api.FsExt4},
+	}}, nil
+}
+
+func (d *archiveDriver) SnapDiff(from, to api.SnapID) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(d.data)), nil
+}
+
+func (d *archiveDriver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+	d.created = locator
+	return "imported", nil
+}
+
+func (d *archiveDriver) Delete(volumeID api.VolumeID) error {
+	d.deleted = true
+	return nil
+}
+
+func (d *archiveDriver) ApplyDiff(volumeID api.VolumeID, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	d.applied = data
+	return err
+}
+
+func TestSnapArchive(t *testing.T) {
+	store := &memoryStore{
+		objectDriver: objectDriver{capabilityDriver{t: Object}},
+		objects:      make(map[string][]byte),
+	}
+	err := Register("archive_store", func(c *DriverContext) (VolumeDriver, error) {
+		return store, nil
+	})
+	assert.NoError(t, err, "Failed to register driver")
+	_, err = New("archive_store", nil)
+	assert.NoError(t, err, "Failed to start driver")
+	defer Remove("archive_store", true)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), snapArchiveChunk/16+100)
+	d := &archiveDriver{data: data}
+	to := api.SnapArchiveLocation{Store: "archive_store", Bucket: "dr", Prefix: "snaps/1"}
+	archive, err := ExportSnap(context.Background(), d, "snap", to)
+	assert.NoError(t, err)
+	if assert.Len(t, archive.Chunks, 2) {
+		assert.Equal(t, int64(snapArchiveChunk), archive.Chunks[0].Size)
+		assert.Equal(t, int64(1600), archive.Chunks[1].Size)
+	}
+	assert.Equal(t, "archived", archive.Locator.Name)
+
+	read, err := ReadSnapArchive(to)
+	assert.NoError(t, err)
+	assert.Equal(t, archive.Chunks, read.Chunks)
+
+	id, err := ImportSnap(context.Background(), d, to, api.VolumeLocator{})
+	assert.NoError(t, err)
+	assert.Equal(t, api.VolumeID("imported"), id)
+	assert.Equal(t, "archived", d.created.Name, "Exported locator not used")
+	assert.True(t, bytes.Equal(data, d.applied), "Imported data differs")
+
+	// Corrupt chunks fail the import, the volume is deleted.
+	store.objects["dr/"+chunkKey(to.Prefix, 1)][0] ^= 1
+	_, err = ImportSnap(context.Background(), d, to, api.VolumeLocator{Name: "copy"})
+	assert.Error(t, err)
+	assert.True(t, d.deleted, "Volume of failed import not deleted")
+
+	_, err = ImportSnap(context.Background(), &capabilityDriver{t: File}, to, api.VolumeLocator{})
+	assert.Equal(t, ErrNotSupported, err)
+	_, err = ExportSnap(context.Background(), d, "snap", api.SnapArchiveLocation{Store: "missing"})
+	assert.Error(t, err)
+}
+
+func TestResumeExport(t *testing.T) {
+	store := &memoryStore{
+		objectDriver: objectDriver{capabilityDriver{t: Object}},
+		objects:      make(map[string][]byte),
+	}
+	err := Register("resume_store", func(c *DriverContext) (VolumeDriver, error) {
+		return store, nil
+	})
+	assert.NoError(t, err, "Failed to register driver")
+	_, err = New("resume_store", nil)
+	assert.NoError(t, err, "Failed to start driver")
+	defer Remove("resume_store", true)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), snapArchiveChunk/8+100)
+	d := &archiveDriver{data: data}
+	to := api.SnapArchiveLocation{Store: "resume_store", Bucket: "dr", Prefix: "snaps/2"}
+	archive := &api.SnapArchive{Compression: api.SnapArchiveGzip}
+	interrupted := errors.New("interrupted")
+	err = ResumeExport(context.Background(), d, "snap", to, archive, func(a *api.SnapArchive) error {
+		return interrupted
+	})
+	assert.Equal(t, interrupted, err)
+	assert.Len(t, archive.Chunks, 1)
+	_, err = ReadSnapArchive(to)
+	assert.Error(t, err, "Interrupted export readable")
+
+	first := store.objects["dr/"+chunkKey(to.Prefix, 0)]
+	delete(store.objects, "dr/"+chunkKey(to.Prefix, 0))
+	assert.NoError(t, ResumeExport(context.Background(), d, "snap", to, archive, nil))
+	assert.Len(t, archive.Chunks, 3)
+	assert.True(t, archive.Chunks[0].Size < snapArchiveChunk/100, "Chunk not compressed")
+	_, ok := store.objects["dr/"+chunkKey(to.Prefix, 0)]
+	assert.False(t, ok, "Stored chunk uploaded again")
+
+	store.objects["dr/"+chunkKey(to.Prefix, 0)] = first
+	_, err = ImportSnap(context.Background(), d, to, api.VolumeLocator{})
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, d.applied), "Imported data differs")
+
+	assert.NoError(t, DeleteSnapArchive(to, archive))
+	assert.Empty(t, store.objects)
+}
@@ -0,0 +1,91 @@
+package volume
+
+import (
+	"os"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+var (
+	nodeID api.MachineID
+)
+
+// SetNodeID sets the identity of this node as recorded in volume attachments.
+func SetNodeID(id api.MachineID) {
+	nodeID = id
+}
+
+// NodeID returns the identity of this node. It defaults to the hostname.
+func NodeID() api.MachineID {
+	if nodeID != api.MachineNone {
+		return nodeID
+	}
+	host, _ := os.Hostname()
+	return api.MachineID(host)
+}
+
+// CheckAttach validates that vol may be attached on node with the specified
+// options given its current attachments. Attaching again on the same node is
+// allowed. Volumes in maintenance may not be attached.
+// Errors ErrVolAttached, ErrVolMaintenance, ErrInvalidTransition may be
+// returned.
+func CheckAttach(vol *api.Volume, node api.MachineID, options *api.AttachOptions) error {
+	if options == nil {
+		options = &api.AttachOptions{}
+	}
+	if vol.Maintenance {
+		return ErrVolMaintenance
+	}
+	if err := CheckTransition(vol.State, api.VolumeAttached); err != nil {
+		return err
+	}
+	for _, a := range vol.Attachments {
+		if a.Node == node {
+			continue
+		}
+		if a.Options.ReadOnly && options.ReadOnly {
+			continue
+		}
+		if a.Options.Shared && options.Shared {
+			continue
+		}
+		return ErrVolAttached
+	}
+	return nil
+}
+
+// RecordAttach adds an attachment for node to vol.
+func RecordAttach(vol *api.Volume, node api.MachineID, options *api.AttachOptions) {
+	a := api.Attachment{Node: node, Time: time.Now()}
+	if options != nil {
+		a.Options = *options
+	}
+	for i := range vol.Attachments {
+		if vol.Attachments[i].Node == node {
+			vol.Attachments[i] = a
+			return
+		}
+	}
+	vol.Attachments = append(vol.Attachments, a)
+	if len(vol.Attachments) == 1 {
+		vol.AttachedOn = node
+	}
+	vol.State = api.VolumeAttached
+}
+
+// RecordDetach removes the attachment for node from vol.
+func RecordDetach(vol *api.Volume, node api.MachineID) {
+	for i := range vol.Attachments {
+		if vol.Attachments[i].Node == node {
+			vol.Attachments = append(vol.Attachments[:i], vol.Attachments[i+1:]...)
+			break
+		}
+	}
+	if len(vol.Attachments) == 0 {
+		vol.AttachedOn = api.MachineNone
+		vol.State = api.VolumeDetached
+	} else {
+		vol.AttachedOn = vol.Attachments[0].Node
+	}
+}
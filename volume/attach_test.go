@@ -0,0 +1,34 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestCheckAttach(t *testing.T) {
+	ro := &api.AttachOptions{ReadOnly: true}
+	vol := &api.Volume{ID: "attach"}
+
+	assert.NoError(t, CheckAttach(vol, "n1", ro), "First attach should succeed")
+	RecordAttach(vol, "n1", ro)
+	assert.Equal(t, api.MachineID("n1"), vol.AttachedOn, "AttachedOn should be the first node")
+
+	assert.NoError(t, CheckAttach(vol, "n2", ro), "Read-only attach on a second node should succeed")
+	RecordAttach(vol, "n2", ro)
+	assert.Equal(t, ErrVolAttached, CheckAttach(vol, "n3", nil),
+		"Read-write attach should fail while attached read-only elsewhere")
+	assert.NoError(t, CheckAttach(vol, "n1", ro), "Re-attach on the same node should succeed")
+
+	RecordDetach(vol, "n1")
+	assert.Equal(t, api.MachineID("n2"), vol.AttachedOn, "AttachedOn should move to remaining node")
+	RecordDetach(vol, "n2")
+	assert.Equal(t, api.VolumeDetached, vol.State, "Volume should be detached")
+	assert.NoError(t, CheckAttach(vol, "n3", nil), "Attach on a detached volume should succeed")
+
+	vol.Maintenance = true
+	assert.Equal(t, ErrVolMaintenance, CheckAttach(vol, "n3", nil),
+		"Attach should fail while the volume is in maintenance")
+}
@@ -0,0 +1,181 @@
+package volume
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// BandwidthClass is a class of background data movement whose bandwidth may
+// be limited, so that it does not starve the IO of applications.
+type BandwidthClass string
+
+const (
+	// BandwidthRebuild rebuilds the replicas of volumes.
+	BandwidthRebuild = BandwidthClass("rebuild")
+	// BandwidthMigration moves volumes between backends.
+	BandwidthMigration = BandwidthClass("migration")
+	// BandwidthBackup streams volumes and snapshots to backups.
+	BandwidthBackup = BandwidthClass("backup")
+	// BandwidthScrub reads volumes to verify their integrity.
+	BandwidthScrub = BandwidthClass("scrub")
+	// BandwidthTotal limits all classes together, on top of the limit of
+	// each class.
+	BandwidthTotal = BandwidthClass("total")
+)
+
+var (
+	bandwidthLock sync.Mutex
+	// buckets of the limited classes. Buckets are kept once created so
+	// that transfers in progress see changes of their limit.
+	buckets = make(map[BandwidthClass]*bucket)
+)
+
+// bucket is a token bucket refilled at rate bytes per second. It holds up to
+// one second of tokens, so idle classes cannot burst for long.
+type bucket struct {
+	lock   sync.Mutex
+	rate   uint64
+	tokens float64
+	last   time.Time
+}
+
+// take takes up to n tokens, at most one second worth. It returns the number
+// taken, or how long to wait for them if none are available.
+func (b *bucket) take(n int) (int, time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.rate == 0 {
+		return n, 0
+	}
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+	b.last = now
+	if b.tokens > float64(b.rate) {
+		b.tokens = float64(b.rate)
+	}
+	if uint64(n) > b.rate {
+		n = int(b.rate)
+	}
+	if b.tokens < float64(n) {
+		missing := float64(n) - b.tokens
+		return 0, time.Duration(missing / float64(b.rate) * float64(time.Second))
+	}
+	b.tokens -= float64(n)
+	return n, 0
+}
+
+func (b *bucket) setRate(rate uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.rate = rate
+	b.tokens = 0
+	b.last = time.Now()
+}
+
+func getBucket(class BandwidthClass) *bucket {
+	bandwidthLock.Lock()
+	defer bandwidthLock.Unlock()
+	b, ok := buckets[class]
+	if !ok {
+		b = &bucket{last: time.Now()}
+		buckets[class] = b
+	}
+	return b
+}
+
+// SetBandwidth limits the bandwidth of class across all drivers to
+// bytesPerSec. The class is not limited if bytesPerSec is 0. Limits may be
+// changed at any time and apply to the transfers in progress.
+func SetBandwidth(class BandwidthClass, bytesPerSec uint64) {
+	getBucket(class).setRate(bytesPerSec)
+}
+
+// Bandwidths returns the limited classes and their limit in bytes per second.
+func Bandwidths() map[BandwidthClass]uint64 {
+	bandwidthLock.Lock()
+	defer bandwidthLock.Unlock()
+	limits := make(map[BandwidthClass]uint64)
+	for class, b := range buckets {
+		b.lock.Lock()
+		if b.rate != 0 {
+			limits[class] = b.rate
+		}
+		b.lock.Unlock()
+	}
+	return limits
+}
+
+// Bandwidth returns the bandwidth available to class in bytes per second,
+// the lower of its limit and the total limit, 0 if it is not limited. Drivers
+// that move data with external tools pass it on to them.
+func Bandwidth(class BandwidthClass) uint64 {
+	limits := Bandwidths()
+	limit := limits[class]
+	if total := limits[BandwidthTotal]; total != 0 && (limit == 0 || total < limit) {
+		limit = total
+	}
+	return limit
+}
+
+// Throttle waits until n bytes of class may be transferred, or until ctx is
+// done.
+func Throttle(ctx context.Context, class BandwidthClass, n int) error {
+	for _, b := range []*bucket{getBucket(class), getBucket(BandwidthTotal)} {
+		for left := n; left > 0; {
+			taken, wait := b.take(left)
+			if taken > 0 {
+				left -= taken
+				continue
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// ThrottleReader returns a reader that reads r within the bandwidth of
+// class.
+func ThrottleReader(ctx context.Context, class BandwidthClass, r io.Reader) io.Reader {
+	return &throttledReader{ctx: ctx, class: class, r: r}
+}
+
+type throttledReader struct {
+	ctx   context.Context
+	class BandwidthClass
+	r     io.Reader
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := Throttle(t.ctx, t.class, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// ThrottleWriter returns a writer that writes to w within the bandwidth of
+// class.
+func ThrottleWriter(ctx context.Context, class BandwidthClass, w io.Writer) io.Writer {
+	return &throttledWriter{ctx: ctx, class: class, w: w}
+}
+
+type throttledWriter struct {
+	ctx   context.Context
+	class BandwidthClass
+	w     io.Writer
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	if err := Throttle(t.ctx, t.class, len(p)); err != nil {
+		return 0, err
+	}
+	return t.w.Write(p)
+}
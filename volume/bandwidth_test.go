@@ -0,0 +1,41 @@
+package volume
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBandwidth(t *testing.T) {
+	SetBandwidth(BandwidthBackup, 10000)
+	defer SetBandwidth(BandwidthBackup, 0)
+	assert.Equal(t, uint64(10000), Bandwidth(BandwidthBackup))
+	assert.Equal(t, uint64(0), Bandwidth(BandwidthScrub), "Class limited without a limit")
+
+	SetBandwidth(BandwidthTotal, 5000)
+	assert.Equal(t, uint64(5000), Bandwidth(BandwidthBackup), "Total limit ignored")
+	assert.Equal(t, uint64(5000), Bandwidth(BandwidthScrub), "Total limit ignored")
+	SetBandwidth(BandwidthTotal, 0)
+	assert.Equal(t, uint64(10000), Bandwidth(BandwidthBackup))
+
+	// The bucket starts empty, 2000 bytes take 200ms.
+	start := time.Now()
+	r := ThrottleReader(context.Background(), BandwidthBackup, bytes.NewReader(make([]byte, 2000)))
+	n, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, 2000, len(n))
+	assert.True(t, time.Since(start) >= 150*time.Millisecond, "Read not throttled")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, Throttle(ctx, BandwidthBackup, 100000))
+
+	SetBandwidth(BandwidthBackup, 0)
+	start = time.Now()
+	assert.NoError(t, Throttle(context.Background(), BandwidthBackup, 100000))
+	assert.True(t, time.Since(start) < 50*time.Millisecond, "Unlimited class throttled")
+}
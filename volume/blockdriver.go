@@ -1,16 +1,20 @@
 package volume
 
 import (
+	"context"
+
 	"github.com/libopenstorage/openstorage/api"
 )
 
 // DefaultBlockDriver is a default (null) block driver implementation.  This can be
 // used by drivers that do not want to (or care about) implement the attach,
-// format and detach interfaces.
+// format and detach interfaces. It is equivalent to NotSupportedBlockDriver.
 type DefaultBlockDriver struct {
 }
 
-func (d *DefaultBlockDriver) Attach(volumeID api.VolumeID) (path string, err error) {
+func (d *DefaultBlockDriver) blockNotSupported() {}
+
+func (d *DefaultBlockDriver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (path string, err error) {
 	return "", ErrNotSupported
 }
 
@@ -21,3 +25,47 @@ func (d *DefaultBlockDriver) Format(volumeID api.VolumeID) error {
 func (d *DefaultBlockDriver) Detach(volumeID api.VolumeID) error {
 	return ErrNotSupported
 }
+
+func (d *DefaultBlockDriver) AttachCtx(ctx context.Context, volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (d *DefaultBlockDriver) FormatCtx(ctx context.Context, volumeID api.VolumeID) error {
+	return ErrNotSupported
+}
+
+func (d *DefaultBlockDriver) DetachCtx(ctx context.Context, volumeID api.VolumeID) error {
+	return ErrNotSupported
+}
+
+// NotSupportedBlockDriver is embedded by File and Object drivers that do not
+// attach volumes. All BlockDriver operations fail with ErrNotSupported. Block
+// drivers may not embed it, New rejects them.
+type NotSupportedBlockDriver struct {
+}
+
+func (d *NotSupportedBlockDriver) blockNotSupported() {}
+
+func (d *NotSupportedBlockDriver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (d *NotSupportedBlockDriver) Format(volumeID api.VolumeID) error {
+	return ErrNotSupported
+}
+
+func (d *NotSupportedBlockDriver) Detach(volumeID api.VolumeID) error {
+	return ErrNotSupported
+}
+
+func (d *NotSupportedBlockDriver) AttachCtx(ctx context.Context, volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (d *NotSupportedBlockDriver) FormatCtx(ctx context.Context, volumeID api.VolumeID) error {
+	return ErrNotSupported
+}
+
+func (d *NotSupportedBlockDriver) DetachCtx(ctx context.Context, volumeID api.VolumeID) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,175 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// BulkConcurrency number of volumes a bulk operation works on at once.
+var BulkConcurrency = 16
+
+// BulkError is returned by bulk operations that failed on some of their
+// volumes. It holds the error of each of these volumes, the operation
+// succeeded on the others.
+type BulkError map[api.VolumeID]error
+
+func (e BulkError) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	problems := make([]string, len(ids))
+	for i, id := range ids {
+		problems[i] = fmt.Sprintf("%s: %v", id, e[api.VolumeID(id)])
+	}
+	return fmt.Sprintf("Failed on %d volumes: %s", len(ids), strings.Join(problems, "; "))
+}
+
+// BulkRequester is implemented by clients that operate on many volumes of a
+// remote driver in one request.
+type BulkRequester interface {
+	// DeleteMany deletes volumeIDs.
+	// Errors BulkError may be returned.
+	DeleteMany(volumeIDs []api.VolumeID) error
+
+	// SnapshotMany snapshots volumeIDs with labels and returns the snaps
+	// by volume.
+	// Errors BulkError may be returned.
+	SnapshotMany(volumeIDs []api.VolumeID,
+		labels api.Labels,
+		writable bool) (map[api.VolumeID]api.SnapID, error)
+
+	// InspectMany inspects volumeIDs.
+	// Errors BulkError may be returned.
+	InspectMany(volumeIDs []api.VolumeID) ([]api.Volume, error)
+}
+
+// Bulk runs op on each of volumeIDs, at most BulkConcurrency at once.
+// Volumes op was not started on when ctx is done fail with the error of ctx.
+// Errors BulkError may be returned.
+func Bulk(ctx context.Context,
+	volumeIDs []api.VolumeID,
+	op func(ctx context.Context, volumeID api.VolumeID) error) error {
+	var lock sync.Mutex
+	failed := make(BulkError)
+	fail := func(volumeID api.VolumeID, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		failed[volumeID] = err
+	}
+
+	n := BulkConcurrency
+	if n < 1 {
+		n = 1
+	}
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for _, id := range volumeIDs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			fail(id, ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func(id api.VolumeID) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := op(ctx, id); err != nil {
+				fail(id, err)
+			}
+		}(id)
+	}
+	wg.Wait()
+	if len(failed) != 0 {
+		return failed
+	}
+	return nil
+}
+
+// DeleteMany deletes volumeIDs of d.
+// Errors BulkError may be returned.
+func DeleteMany(ctx context.Context, d VolumeDriver, volumeIDs []api.VolumeID) error {
+	return Bulk(ctx, volumeIDs, func(ctx context.Context, id api.VolumeID) error {
+		return DeleteCtx(ctx, d, id)
+	})
+}
+
+// SnapshotMany snapshots volumeIDs of d with labels and returns the snaps
+// of the volumes that were snapshotted. Snaps are not deleted if some
+// volumes fail to snapshot, use SnapshotGroup for all-or-nothing snapshots.
+// Errors BulkError may be returned.
+func SnapshotMany(ctx context.Context,
+	d VolumeDriver,
+	volumeIDs []api.VolumeID,
+	labels api.Labels,
+	writable bool) (map[api.VolumeID]api.SnapID, error) {
+	var lock sync.Mutex
+	snaps := make(map[api.VolumeID]api.SnapID, len(volumeIDs))
+	err := Bulk(ctx, volumeIDs, func(ctx context.Context, id api.VolumeID) error {
+		snapID, err := SnapshotCtx(ctx, d, id, labels, writable)
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		snaps[id] = snapID
+		return nil
+	})
+	return snaps, err
+}
+
+// InspectMany inspects volumeIDs of d in one call to the driver. If the
+// call fails, the volumes are inspected one by one to find those that fail.
+// Missing volumes fail with ErrEnoEnt.
+// Errors BulkError may be returned.
+func InspectMany(ctx context.Context, d VolumeDriver, volumeIDs []api.VolumeID) ([]api.Volume, error) {
+	vols, err := InspectCtx(ctx, d, volumeIDs)
+	if err != nil {
+		var lock sync.Mutex
+		found := make(map[api.VolumeID]api.Volume, len(volumeIDs))
+		err = Bulk(ctx, volumeIDs, func(ctx context.Context, id api.VolumeID) error {
+			v, err := InspectCtx(ctx, d, []api.VolumeID{id})
+			if err != nil {
+				return err
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			for i := range v {
+				found[v[i].ID] = v[i]
+			}
+			return nil
+		})
+		vols = make([]api.Volume, 0, len(found))
+		for _, id := range volumeIDs {
+			if v, ok := found[id]; ok {
+				vols = append(vols, v)
+			}
+		}
+	}
+	failed, _ := err.(BulkError)
+	found := make(map[api.VolumeID]bool, len(vols))
+	for i := range vols {
+		found[vols[i].ID] = true
+	}
+	for _, id := range volumeIDs {
+		if _, ok := failed[id]; !ok && !found[id] {
+			if failed == nil {
+				failed = make(BulkError)
+			}
+			failed[id] = ErrEnoEnt
+		}
+	}
+	if len(failed) != 0 {
+		return vols, failed
+	}
+	return vols, nil
+}
@@ -0,0 +1,93 @@
+package volume
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// bulkDriver fails the operations on "bad", its Inspect fails if any
+// volume is bad.
+type bulkDriver struct {
+	capabilityDriver
+	lock    sync.Mutex
+	deleted []api.VolumeID
+}
+
+var errBad = errors.New("bad volume")
+
+func (d *bulkDriver) String() string { return "bulk_test" }
+
+func (d *bulkDriver) Delete(volumeID api.VolumeID) error {
+	if volumeID == "bad" {
+		return errBad
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.deleted = append(d.deleted, volumeID)
+	return nil
+}
+
+func (d *bulkDriver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	if volumeID == "bad" {
+		return api.BadSnapID, errBad
+	}
+	return api.SnapID("snap-" + volumeID), nil
+}
+
+func (d *bulkDriver) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
+	vols := make([]api.Volume, 0)
+	for _, id := range ids {
+		switch id {
+		case "bad":
+			return nil, errBad
+		case "missing":
+		default:
+			vols = append(vols, api.Volume{ID: id})
+		}
+	}
+	return vols, nil
+}
+
+func TestBulk(t *testing.T) {
+	d := &bulkDriver{capabilityDriver: capabilityDriver{t: File}}
+	ctx := context.Background()
+
+	err := DeleteMany(ctx, d, []api.VolumeID{"v1", "bad", "v2"})
+	if assert.Error(t, err) {
+		assert.Equal(t, BulkError{"bad": errBad}, err)
+		assert.Equal(t, "Failed on 1 volumes: bad: bad volume", err.Error())
+	}
+	assert.Len(t, d.deleted, 2)
+
+	snaps, err := SnapshotMany(ctx, d, []api.VolumeID{"v1", "bad"}, nil, false)
+	assert.Equal(t, BulkError{"bad": errBad}, err)
+	assert.Equal(t, map[api.VolumeID]api.SnapID{"v1": "snap-v1"}, snaps)
+
+	vols, err := InspectMany(ctx, d, []api.VolumeID{"v1", "v2"})
+	assert.NoError(t, err)
+	assert.Len(t, vols, 2)
+	vols, err = InspectMany(ctx, d, []api.VolumeID{"v1", "bad", "missing"})
+	assert.Equal(t, BulkError{"bad": errBad, "missing": ErrEnoEnt}, err)
+	if assert.Len(t, vols, 1) {
+		assert.Equal(t, api.VolumeID("v1"), vols[0].ID)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	BulkConcurrency = 1
+	defer func() { BulkConcurrency = 16 }()
+	err = Bulk(cancelled, []api.VolumeID{"v1", "v2", "v3"}, func(ctx context.Context, id api.VolumeID) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	failed, ok := err.(BulkError)
+	if assert.True(t, ok) {
+		assert.Len(t, failed, 3)
+	}
+}
@@ -0,0 +1,49 @@
+package volume
+
+import (
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/cache"
+)
+
+// CacheLayer built in layer fronting the block volumes with a CacheSpec
+// with their cache.
+const CacheLayer = "cache"
+
+// cacheLayer fronts the devices of cached volumes with their cache.
+type cacheLayer struct{}
+
+func (cacheLayer) String() string {
+	return CacheLayer
+}
+
+func (cacheLayer) Assemble(v *api.Volume, device string) (string, error) {
+	if v.Spec == nil || v.Spec.Cache == nil {
+		return device, nil
+	}
+	return cache.Assemble(string(v.ID), device, v.Spec.Cache)
+}
+
+func (cacheLayer) Path(volumeID api.VolumeID, device string) string {
+	return cache.Path(string(volumeID), device)
+}
+
+// Teardown flushes and removes the cache of a volume before it is detached.
+func (cacheLayer) Teardown(volumeID api.VolumeID) error {
+	return cache.Teardown(string(volumeID))
+}
+
+// Quiesce writes the dirty blocks of a writeback cache back to the volume
+// and keeps them written back until the snapshot is taken.
+func (cacheLayer) Quiesce(volumeID api.VolumeID) (func(), error) {
+	restore, err := cache.Flush(string(volumeID))
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := restore(); err != nil {
+			log.Warnf("Failed to restore the cache policy of volume %v: %v", volumeID, err)
+		}
+	}, nil
+}
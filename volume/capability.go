@@ -0,0 +1,76 @@
+package volume
+
+import (
+	"fmt"
+	"strings"
+)
+
+var driverTypeNames = []struct {
+	t    DriverType
+	name string
+}{
+	{File, "File"},
+	{Block, "Block"},
+	{Object, "Object"},
+	{Clustered, "Clustered"},
+}
+
+func (t DriverType) String() string {
+	var names []string
+	for _, n := range driverTypeNames {
+		if t&n.t != 0 {
+			names = append(names, n.name)
+			t &^= n.t
+		}
+	}
+	if t != 0 {
+		names = append(names, fmt.Sprintf("DriverType(%d)", int(t)))
+	}
+	if len(names) == 0 {
+		return "None"
+	}
+	return strings.Join(names, "|")
+}
+
+// CapabilityError is returned by New for drivers that do not implement the
+// interfaces their DriverType claims.
+type CapabilityError struct {
+	// Driver name.
+	Driver string
+	// Type claimed by the driver.
+	Type DriverType
+	// Missing interface.
+	Missing string
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("Driver %s of type %v does not implement %s", e.Driver, e.Type, e.Missing)
+}
+
+// blockStub is implemented by the null BlockDriver embeddings.
+type blockStub interface {
+	blockNotSupported()
+}
+
+// CheckCapabilities verifies that d implements the interfaces its Type
+// claims: Block drivers implement BlockDriver without embedding
+// NotSupportedBlockDriver, Object drivers implement ObjectDriver and every
+// driver is at least one of File, Block or Object.
+// Errors *CapabilityError may be returned.
+func CheckCapabilities(name string, d VolumeDriver) error {
+	t := d.Type()
+	if t&(File|Block|Object) == 0 {
+		return &CapabilityError{Driver: name, Type: t, Missing: "a File, Block or Object type"}
+	}
+	if t&Block != 0 {
+		if _, ok := d.(blockStub); ok {
+			return &CapabilityError{Driver: name, Type: t, Missing: "BlockDriver"}
+		}
+	}
+	if t&Object != 0 {
+		if _, ok := d.(ObjectDriver); !ok {
+			return &CapabilityError{Driver: name, Type: t, Missing: "ObjectDriver"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package volume
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type capabilityDriver struct {
+	ProtoDriver
+	Enumerator
+	NotSupportedBlockDriver
+	t DriverType
+}
+
+func (d *capabilityDriver) Type() DriverType {
+	return d.t
+}
+
+type objectDriver struct {
+	capabilityDriver
+}
+
+func (d *objectDriver) CreateBucket(bucket string) error                  { return nil }
+func (d *objectDriver) DeleteBucket(bucket string) error                  { return nil }
+func (d *objectDriver) PutObject(b, k string, r io.Reader, n int64) error { return nil }
+func (d *objectDriver) GetObject(b, k string) (io.ReadCloser, error)      { return nil, nil }
+func (d *objectDriver) DeleteObject(b, k string) error                    { return nil }
+func (d *objectDriver) PresignedURL(m, b, k string, e time.Duration) (string, error) {
+	return "", nil
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	assert.NoError(t, CheckCapabilities("file", &capabilityDriver{t: File}))
+
+	err := CheckCapabilities("block", &capabilityDriver{t: Block})
+	if assert.Error(t, err, "Block driver with a null BlockDriver should be rejected") {
+		assert.Equal(t, "BlockDriver", err.(*CapabilityError).Missing)
+	}
+	err = CheckCapabilities("object", &capabilityDriver{t: Object})
+	if assert.Error(t, err, "Object driver without ObjectDriver should be rejected") {
+		assert.Equal(t, "ObjectDriver", err.(*CapabilityError).Missing)
+	}
+	assert.NoError(t, CheckCapabilities("object", &objectDriver{capabilityDriver{t: Object}}))
+	assert.Error(t, CheckCapabilities("none", &capabilityDriver{t: Clustered}))
+
+	assert.Equal(t, "File|Clustered", (File | Clustered).String())
+	assert.Equal(t, "None", DriverType(0).String())
+}
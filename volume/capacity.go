@@ -0,0 +1,96 @@
+package volume
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// FreeReserveParam DriverParams key for the percentage of the capacity
+	// of the pools kept free: volumes are not created while no pool of the
+	// driver has more free space. Not enforced if 0.
+	FreeReserveParam = "free_reserve_percent"
+)
+
+// PoolLocator is implemented by drivers with several pools, such as disks or
+// exports, that know the pool holding each volume. The space provisioned to
+// the pools of other drivers is estimated in proportion to their capacity.
+type PoolLocator interface {
+	// VolumePool returns the name of the pool holding v, as reported in
+	// the Pools of the driver status, or "" if it is not known.
+	VolumePool(v *api.Volume) string
+}
+
+var (
+	reserveLock sync.Mutex
+	// reserves percentage of the pools kept free, by driver name.
+	reserves = make(map[string]float64)
+)
+
+// freeReserve reads FreeReserveParam from params.
+func freeReserve(params DriverParams) (float64, error) {
+	v, ok := params[FreeReserveParam]
+	if !ok {
+		return 0, nil
+	}
+	pct, err := strconv.ParseFloat(v, 64)
+	if err != nil || pct < 0 || pct >= 100 {
+		return 0, fmt.Errorf("Invalid value %q for %s", v, FreeReserveParam)
+	}
+	return pct, nil
+}
+
+func setFreeReserve(name string, pct float64) {
+	reserveLock.Lock()
+	defer reserveLock.Unlock()
+	if pct == 0 {
+		delete(reserves, name)
+		return
+	}
+	reserves[name] = pct
+}
+
+// LowSpace returns the pools of status whose free space is below pct percent
+// of their capacity. A driver that reports no pools is one pool. Pools of
+// unknown capacity are never low.
+func LowSpace(status api.DriverStatus, pct float64) []api.PoolStatus {
+	pools := status.Pools
+	if len(pools) == 0 {
+		pools = []api.PoolStatus{{Name: status.Driver, Capacity: status.Capacity, Free: status.Free}}
+	}
+	var low []api.PoolStatus
+	for _, p := range pools {
+		if p.Error == "" && p.Capacity != 0 && float64(p.Free) < float64(p.Capacity)*pct/100 {
+			low = append(low, p)
+		}
+	}
+	return low
+}
+
+// checkFreeSpace fails a create on the driver name while none of its pools
+// has more free space than its reserve, before the driver allocates storage.
+// Errors ErrNoSpace may be returned.
+func checkFreeSpace(d ProtoDriver, name string) error {
+	reserveLock.Lock()
+	pct, ok := reserves[name]
+	reserveLock.Unlock()
+	if !ok {
+		return nil
+	}
+	status := d.Status()
+	pools := len(status.Pools)
+	if pools == 0 {
+		pools = 1
+	}
+	if low := LowSpace(status, pct); len(low) == pools {
+		log.Warnf("Refusing to create a volume of %s, less than %v%% of its capacity is free",
+			name, pct)
+		return ErrNoSpace
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// spaceDriver reports the pools of its status.
+type spaceDriver struct {
+	capabilityDriver
+	pools []api.PoolStatus
+}
+
+func (d *spaceDriver) Shutdown() {}
+
+func (d *spaceDriver) Status() api.DriverStatus {
+	return api.DriverStatus{Driver: "space_test", Pools: d.pools}
+}
+
+func TestLowSpace(t *testing.T) {
+	status := api.DriverStatus{Driver: "dm", Capacity: 100, Free: 5}
+	assert.Len(t, LowSpace(status, 10), 1, "Drivers without pools should be one pool")
+	status.Pools = []api.PoolStatus{
+		{Name: "/dev/sdb", Capacity: 100, Free: 5},
+		{Name: "/dev/sdc", Capacity: 100, Free: 50},
+		{Name: "/dev/sdd", Error: "missing"},
+	}
+	low := LowSpace(status, 10)
+	if assert.Len(t, low, 1) {
+		assert.Equal(t, "/dev/sdb", low[0].Name)
+	}
+}
+
+func TestFreeReserve(t *testing.T) {
+	d := &spaceDriver{capabilityDriver: capabilityDriver{t: File}}
+	err := Register("space_test", func(c *DriverContext) (VolumeDriver, error) {
+		return d, nil
+	})
+	assert.NoError(t, err, "Failed to register driver")
+	_, err = New("space_test", DriverParams{FreeReserveParam: "200"})
+	assert.Error(t, err, "Invalid reserve accepted")
+	_, err = New("space_test", DriverParams{FreeReserveParam: "10"})
+	assert.NoError(t, err, "Failed to start driver")
+	defer Remove("space_test", true)
+
+	d.pools = []api.PoolStatus{
+		{Name: "/dev/sdb", Capacity: 100, Free: 5},
+		{Name: "/dev/sdc", Capacity: 100, Free: 50},
+	}
+	assert.NoError(t, checkFreeSpace(d, "space_test"), "Create refused while a pool has space")
+	d.pools[1].Free = 9
+	assert.Equal(t, ErrNoSpace, checkFreeSpace(d, "space_test"))
+	assert.NoError(t, checkFreeSpace(d, "other"), "Drivers without reserve should not be checked")
+}
@@ -0,0 +1,78 @@
+package volume
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// Catalog lists path within a volume of d.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func Catalog(d ProtoDriver, volumeID api.VolumeID, path string) ([]api.CatalogEntry, error) {
+	if c, ok := d.(Cataloger); ok {
+		return c.Catalog(volumeID, path)
+	}
+	return nil, ErrNotSupported
+}
+
+// CatalogDir lists path within the directory root, for drivers that keep
+// volumes in a directory. Paths, including symlinks, may not lead out of
+// root.
+// Errors ErrEnoEnt, ErrEinval may be returned.
+func CatalogDir(root, path string) ([]api.CatalogEntry, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	full, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+path)))
+	if os.IsNotExist(err) {
+		return nil, ErrEnoEnt
+	}
+	if err != nil {
+		return nil, err
+	}
+	if full != root && !strings.HasPrefix(full, root+string(filepath.Separator)) {
+		return nil, ErrEinval
+	}
+
+	fi, err := os.Stat(full)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []api.CatalogEntry{catalogEntry(fi)}, nil
+	}
+	dir, err := os.Open(full)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]api.CatalogEntry, 0, len(infos))
+	for _, fi := range infos {
+		entries = append(entries, catalogEntry(fi))
+	}
+	sort.Sort(byName(entries))
+	return entries, nil
+}
+
+func catalogEntry(fi os.FileInfo) api.CatalogEntry {
+	return api.CatalogEntry{
+		Name:    fi.Name(),
+		Dir:     fi.IsDir(),
+		Size:    uint64(fi.Size()),
+		ModTime: fi.ModTime(),
+	}
+}
+
+type byName []api.CatalogEntry
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byName) Less(i, j int) bool { return b[i].Name < b[j].Name }
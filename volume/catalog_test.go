@@ -0,0 +1,43 @@
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalogDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "catalog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	assert.NoError(t, os.Mkdir(path.Join(root, "dir"), 0755))
+	assert.NoError(t, ioutil.WriteFile(path.Join(root, "dir", "file"), []byte("data"), 0644))
+	assert.NoError(t, os.Symlink("/", path.Join(root, "escape")))
+
+	entries, err := CatalogDir(root, "/")
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(entries)) {
+		assert.Equal(t, "dir", entries[0].Name)
+		assert.True(t, entries[0].Dir)
+		assert.Equal(t, "escape", entries[1].Name)
+	}
+
+	entries, err = CatalogDir(root, "dir/file")
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(entries)) {
+		assert.Equal(t, "file", entries[0].Name)
+		assert.Equal(t, uint64(4), entries[0].Size)
+		assert.False(t, entries[0].Dir)
+	}
+
+	_, err = CatalogDir(root, "../../..")
+	assert.NoError(t, err, "Paths are relative to the root")
+	_, err = CatalogDir(root, "escape/etc")
+	assert.Equal(t, ErrEinval, err)
+	_, err = CatalogDir(root, "missing")
+	assert.Equal(t, ErrEnoEnt, err)
+}
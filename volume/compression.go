@@ -0,0 +1,139 @@
+package volume
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/vdo"
+)
+
+// Compressor is implemented by drivers that compress volumes natively, such
+// as btrfs. Compressed block volumes of other drivers are attached through
+// VDO.
+type Compressor interface {
+	// CompressionRatio returns the size of the data written to volumeID
+	// over the space it uses, 0 if unknown.
+	// Errors ErrEnoEnt may be returned.
+	CompressionRatio(volumeID api.VolumeID) (float64, error)
+}
+
+// VDOLayer built in layer compressing the block volumes whose spec is
+// Compressed with VDO, unless their driver compresses natively. It is
+// recorded last in the Layers of the volumes whose device was formatted for
+// VDO when they were created, only those are assembled.
+const VDOLayer = "vdo"
+
+// vdoLayer stacks VDO over the devices of compressed volumes.
+type vdoLayer struct{}
+
+func (vdoLayer) String() string {
+	return VDOLayer
+}
+
+// Assemble never formats device, see formatVDO.
+func (vdoLayer) Assemble(v *api.Volume, device string) (string, error) {
+	if v.Spec == nil || !v.Spec.Compressed {
+		return device, nil
+	}
+	if !hasLayer(v, VDOLayer) {
+		return "", vdo.ErrNotFormatted
+	}
+	return vdo.Assemble(string(v.ID), device, v.Spec.Dedupe)
+}
+
+func (vdoLayer) Path(volumeID api.VolumeID, device string) string {
+	return vdo.Path(string(volumeID), device)
+}
+
+func (vdoLayer) Teardown(volumeID api.VolumeID) error {
+	return vdo.Teardown(string(volumeID))
+}
+
+// formatVDO formats the device of volumeID of d for VDO once it is created,
+// if it is compressed and d does not compress natively, and records
+// VDOLayer in the Layers of the volume along with the UUID of its origin.
+// The device is attached with the layers of d below VDO for the time of the
+// format. Volumes are only formatted here, never on attach.
+func formatVDO(d interface{}, volumeID api.VolumeID) (err error) {
+	if _, ok := d.(Compressor); ok {
+		return nil
+	}
+	vd, ok := d.(VolumeDriver)
+	if !ok {
+		return nil
+	}
+	v := layerVolume(vd, volumeID)
+	if v.Spec == nil || !v.Spec.Compressed || vd.Type()&Block == 0 {
+		return nil
+	}
+	store, ok := d.(Store)
+	if !ok {
+		return fmt.Errorf("Driver %s cannot record the VDO format of volume %v", vd, volumeID)
+	}
+	stack, err := volumeLayers(d, v)
+	if err != nil {
+		return err
+	}
+	// The layers below VDO.
+	stack = stack[:len(stack)-len(builtinLayers(d))]
+	origin, err := vd.Attach(volumeID, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if derr := vd.Detach(volumeID); derr != nil && err == nil {
+			err = derr
+		}
+	}()
+	path, err := assembleLayers(stack, v, origin)
+	if err != nil {
+		return err
+	}
+	err = vdo.Format(path)
+	if derr := teardownLayers(stack, volumeID); derr != nil && err == nil {
+		err = derr
+	}
+	if err != nil {
+		return err
+	}
+	uuid, err := fsUUID(origin)
+	if err != nil {
+		return err
+	}
+
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer store.Unlock(token)
+	if v, err = store.GetVol(volumeID); err != nil {
+		return err
+	}
+	v.Layers = append(v.Layers, VDOLayer)
+	v.OriginUUID = uuid
+	return store.UpdateVol(v)
+}
+
+// Stats returns the IO statistics of a volume of d along with its
+// compression ratio, if the driver did not report it.
+// Errors ErrEnoEnt may be returned.
+func Stats(d VolumeDriver, volumeID api.VolumeID) (api.VolumeStats, error) {
+	stats, err := d.Stats(volumeID)
+	if err != nil || stats.CompressionRatio != 0 {
+		return stats, err
+	}
+	var ratio float64
+	if c, ok := d.(Compressor); ok {
+		ratio, err = c.CompressionRatio(volumeID)
+	} else if vdo.Assembled(string(volumeID)) {
+		ratio, err = vdo.Ratio(string(volumeID))
+	}
+	if err != nil {
+		log.Warnf("Failed to get the compression ratio of volume %v: %v", volumeID, err)
+		return stats, nil
+	}
+	stats.CompressionRatio = ratio
+	return stats, nil
+}
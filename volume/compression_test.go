@@ -0,0 +1,29 @@
+package volume
+
+import (
+	"context"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/vdo"
+)
+
+func TestAttachVDO(t *testing.T) {
+	d := &fsDriver{historyDriver: historyDriver{
+		DefaultEnumerator: NewDefaultEnumerator("compression_test", kvdb.Instance()),
+	}}
+	vol := &api.Volume{ID: "compression_test_vol", Spec: &api.VolumeSpec{Compressed: true}}
+	assert.NoError(t, d.CreateVol(vol))
+	defer d.DeleteVol(vol.ID)
+
+	// Volumes not formatted for VDO when created are not formatted on
+	// attach.
+	_, err := AttachCtx(context.Background(), d, vol.ID, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), vdo.ErrNotFormatted.Error())
+	}
+	assert.Equal(t, 1, d.detached, "Volume not formatted for VDO left attached")
+}
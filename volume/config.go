@@ -0,0 +1,221 @@
+package volume
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/secrets"
+)
+
+// ConfigStore persists the params of started drivers, so that a restarted
+// daemon can bring the same drivers back with Restore.
+type ConfigStore interface {
+	// Save records that driver name is enabled with params.
+	Save(name string, params DriverParams) error
+
+	// Remove forgets driver name.
+	Remove(name string) error
+
+	// Load returns the params of the enabled drivers by name.
+	Load() (map[string]DriverParams, error)
+}
+
+var (
+	configStore   ConfigStore
+	configSecrets string
+)
+
+// SetConfigStore sets the store New records driver params in. Params are
+// not persisted if no store is set.
+func SetConfigStore(s ConfigStore) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	configStore = s
+}
+
+// SetConfigSecrets sets the scheme of the secrets provider that keeps the
+// secrets passed in plaintext in driver params, such as secrets.VaultScheme.
+// The config store then records a reference to the secret in their place.
+// If no scheme is set, such secrets are not persisted and must be passed
+// again, or set from a secret, for the driver to be restored.
+func SetConfigSecrets(scheme string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	configSecrets = scheme
+}
+
+// storedParams returns params of driver name as they are persisted, with
+// the secrets registered by secrets.RegisterParam replaced by references.
+// Must be called with mutex held.
+func storedParams(name string, params DriverParams) DriverParams {
+	stored := make(DriverParams, len(params))
+	for k, v := range params {
+		stored[k] = v
+	}
+	for k, v := range params {
+		if !secrets.IsParam(k) {
+			continue
+		}
+		delete(stored, k)
+		if _, ok := params[k+secrets.RefSuffix]; ok {
+			continue
+		}
+		if configSecrets == "" {
+			log.Warnf("Not persisting %s of driver %s, set it from a secret with %s",
+				k, name, k+secrets.RefSuffix)
+			continue
+		}
+		ref := fmt.Sprintf("%s:osd-driver-%s-%s", configSecrets, name, k)
+		if err := secrets.Put(ref, v); err != nil {
+			log.Warnf("Not persisting %s of driver %s: %v", k, name, err)
+			continue
+		}
+		stored[k+secrets.RefSuffix] = ref
+	}
+	return stored
+}
+
+const configKeyPrefix = "config/drivers/"
+
+type kvdbConfigStore struct {
+	kv     kvdb.Kvdb
+	prefix string
+}
+
+// NewKVDBConfigStore returns a ConfigStore that keeps the driver params of
+// node in kv. Each node restores only the drivers it started.
+func NewKVDBConfigStore(kv kvdb.Kvdb, node string) ConfigStore {
+	return &kvdbConfigStore{kv: kv, prefix: configKeyPrefix + node + "/"}
+}
+
+func (s *kvdbConfigStore) Save(name string, params DriverParams) error {
+	if params == nil {
+		params = DriverParams{}
+	}
+	_, err := s.kv.Put(s.prefix+name, params, 0)
+	return err
+}
+
+func (s *kvdbConfigStore) Remove(name string) error {
+	_, err := s.kv.Delete(s.prefix + name)
+	return err
+}
+
+func (s *kvdbConfigStore) Load() (map[string]DriverParams, error) {
+	kvp, err := s.kv.Enumerate(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]DriverParams, len(kvp))
+	for _, v := range kvp {
+		name := v.Key[strings.LastIndex(v.Key, "/")+1:]
+		var params DriverParams
+		if err = json.Unmarshal(v.Value, &params); err != nil {
+			return nil, err
+		}
+		all[name] = params
+	}
+	return all, nil
+}
+
+// Restore starts the drivers recorded in the config store that are not
+// running yet. It returns the names of the drivers it started. Drivers that
+// fail to start are skipped, the first error is returned.
+func Restore() ([]string, error) {
+	mutex.Lock()
+	s := configStore
+	mutex.Unlock()
+	if s == nil {
+		return nil, nil
+	}
+	saved, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	var started []string
+	var first error
+	for name, params := range saved {
+		if _, err := Get(name); err == nil {
+			continue
+		}
+		log.Infof("Restoring volume driver %s", name)
+		if _, err := New(name, params); err != nil {
+			log.Warnf("Failed to restore volume driver %s: %v", name, err)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		started = append(started, name)
+	}
+	return started, first
+}
+
+// Disable shuts down driver name and removes it from the config store, so
+// that Restore does not start it again.
+// Errors ErrDriverNotFound may be returned.
+func Disable(name string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	d, ok := instances[name]
+	if !ok {
+		return ErrDriverNotFound
+	}
+	if c, ok := collectors[name]; ok {
+		c.shutdown()
+		delete(collectors, name)
+	}
+	if t, ok := trashes[name]; ok {
+		t.shutdown()
+		delete(trashes, name)
+	}
+	if s, ok := scrubbers[name]; ok {
+		s.shutdown()
+		delete(scrubbers, name)
+	}
+	if s, ok := snapSchedulers[name]; ok {
+		s.shutdown()
+		delete(snapSchedulers, name)
+	}
+	if h, ok := histories[name]; ok {
+		h.shutdown()
+		delete(histories, name)
+	}
+	if r, ok := rebalancers[name]; ok {
+		r.shutdown()
+		delete(rebalancers, name)
+	}
+	if g, ok := gcs[name]; ok {
+		g.shutdown()
+		delete(gcs, name)
+	}
+	if r, ok := reapers[name]; ok {
+		r.shutdown()
+		delete(reapers, name)
+	}
+	if w, ok := warmPools[name]; ok {
+		w.shutdown()
+		delete(warmPools, name)
+	}
+	d.Shutdown()
+	stopCache(d)
+	delete(instances, name)
+	delete(instanceDrivers, name)
+	if p, ok := pools[name]; ok {
+		p.Shutdown()
+		delete(pools, name)
+	}
+	setLimiters(name, nil)
+	setUniqueNames(name, true)
+	setFreeReserve(name, 0)
+	setLayers(name, nil)
+	if configStore != nil {
+		return configStore.Remove(name)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package volume
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/secrets"
+)
+
+func TestStoredParams(t *testing.T) {
+	secrets.RegisterParam("config_test_password")
+	params := DriverParams{"path": "/mnt", "config_test_password": "hunter2"}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, DriverParams{"path": "/mnt"}, storedParams("test", params),
+		"Secret persisted without a provider")
+
+	configSecrets = secrets.EnvScheme
+	defer func() { configSecrets = "" }()
+	stored := storedParams("test", params)
+	ref := "env:osd-driver-test-config_test_password"
+	defer os.Unsetenv("osd-driver-test-config_test_password")
+	assert.Equal(t, DriverParams{"path": "/mnt", "config_test_password_secret": ref}, stored)
+	password, err := secrets.Param(stored, "config_test_password")
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", password)
+
+	params = DriverParams{"config_test_password_secret": "env:PASSWORD"}
+	assert.Equal(t, params, storedParams("test", params), "Reference not kept")
+}
@@ -0,0 +1,436 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/tracing"
+)
+
+// ContextDriver is implemented by drivers that honor deadlines and
+// cancellation on long running operations. Each method behaves like its
+// VolumeDriver counterpart. Use the package level XxxCtx helpers to call any
+// VolumeDriver with a context.
+type ContextDriver interface {
+	CreateCtx(ctx context.Context,
+		locator api.VolumeLocator,
+		options *api.CreateOptions,
+		spec *api.VolumeSpec) (api.VolumeID, error)
+	DeleteCtx(ctx context.Context, volumeID api.VolumeID) error
+	MountCtx(ctx context.Context, volumeID api.VolumeID, mountpath string) error
+	UnmountCtx(ctx context.Context, volumeID api.VolumeID, mountpath string) error
+	SnapshotCtx(ctx context.Context, volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error)
+	SnapDeleteCtx(ctx context.Context, snapID api.SnapID) error
+	AttachCtx(ctx context.Context, volumeID api.VolumeID, options *api.AttachOptions) (string, error)
+	FormatCtx(ctx context.Context, volumeID api.VolumeID) error
+	DetachCtx(ctx context.Context, volumeID api.VolumeID) error
+	InspectCtx(ctx context.Context, volumeIDs []api.VolumeID) ([]api.Volume, error)
+	EnumerateCtx(ctx context.Context, locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error)
+}
+
+// WithContext calls fn and waits for it to return or for ctx to be done,
+// whichever happens first. If ctx is done first ctx.Err() is returned and fn
+// continues to run to completion in the background. Use it only to bound
+// read-only calls that cannot be interrupted, such as KVDB reads: a caller
+// must never see an error for a change that may still be made.
+func WithContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunContext calls fn unless ctx is already done, and returns its error.
+// Unlike WithContext it waits for fn to return even if ctx is done in the
+// meantime, so that changes such as creates, attaches and mounts are not
+// reported as failed while they complete in the background.
+func RunContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// CreateCtx calls Create on d with ctx once spec is validated and the pre
+// hooks admit it, unless a volume of the warm pool of d matches the request
+// and is claimed. Volumes created from snapshots wait for the OpRestore
+// limits, no volume is created while the pools of d are below their
+// FreeReserveParam. The create is recorded in the journal until it returns,
+// the volume labelled with its entry, and the layers of d in the volume once
+// it is created. Compressed volumes of block drivers that do not compress
+// natively are then formatted for VDO, and deleted if that fails.
+// Errors ValidationError, HookVetoError, ErrNoSpace may be returned.
+func CreateCtx(ctx context.Context,
+	d ProtoDriver,
+	locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (created api.VolumeID, err error) {
+	name := instanceName(d)
+	ctx, span := startSpan(ctx, "create", d, api.BadVolumeID)
+	span.SetTag(tracing.NameTag, locator.Name)
+	defer func() { span.Finish(err) }()
+	if err := Validate(name, options, spec); err != nil {
+		return api.BadVolumeID, err
+	}
+	if err := checkName(d, name, locator, options); err != nil {
+		return api.BadVolumeID, err
+	}
+	req := &api.HookRequest{Op: HookCreate, Locator: &locator, Options: options, Spec: spec}
+	if err := preHooks(ctx, d, req); err != nil {
+		return api.BadVolumeID, err
+	}
+	defer func() {
+		req.VolumeID = created
+		postHooks(ctx, d, req, err)
+	}()
+	if id, ok := claimWarm(name, locator, options, spec); ok {
+		return id, nil
+	}
+	if err := checkFreeSpace(d, name); err != nil {
+		return api.BadVolumeID, err
+	}
+	if options != nil && options.CreateFromSnap != "" {
+		done, err := limit(ctx, d, OpRestore)
+		if err != nil {
+			return api.BadVolumeID, err
+		}
+		defer done()
+	}
+	locator = journalLocator(d, locator)
+	end, err := journalBegin(d, JournalCreate, api.BadVolumeID, locator)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	if cd, ok := d.(ContextDriver); ok {
+		defer end()
+		id, err := cd.CreateCtx(ctx, locator, options, spec)
+		if err != nil {
+			return api.BadVolumeID, err
+		}
+		if err = initVolume(d, id); err != nil {
+			return api.BadVolumeID, err
+		}
+		return id, nil
+	}
+	id := api.BadVolumeID
+	err = RunContext(ctx, func() error {
+		defer end()
+		var err error
+		id, err = d.Create(locator, options, spec)
+		return err
+	})
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	if err = initVolume(d, id); err != nil {
+		return api.BadVolumeID, err
+	}
+	return id, nil
+}
+
+// initVolume records the layers of d in volumeID once it is created and
+// formats it for VDO if needed, then removes its journal label. The volume
+// is deleted if it cannot be formatted.
+func initVolume(d ProtoDriver, volumeID api.VolumeID) error {
+	recordLayers(d, volumeID)
+	if err := formatVDO(d, volumeID); err != nil {
+		if derr := d.Delete(volumeID); derr != nil {
+			log.Warnf("Failed to delete volume %v not formatted for VDO: %v", volumeID, derr)
+		}
+		return fmt.Errorf("Failed to format volume %v for VDO: %v", volumeID, err)
+	}
+	clearJournalLabel(d, volumeID)
+	return nil
+}
+
+// DeleteCtx calls Delete on d with ctx, once the pre hooks admit it. The
+// delete is recorded in the journal until it returns.
+// Errors HookVetoError may be returned.
+func DeleteCtx(ctx context.Context, d ProtoDriver, volumeID api.VolumeID) (err error) {
+	ctx, span := startSpan(ctx, "delete", d, volumeID)
+	defer func() { span.Finish(err) }()
+	req := &api.HookRequest{Op: HookDelete, VolumeID: volumeID}
+	if err := preHooks(ctx, d, req); err != nil {
+		return err
+	}
+	defer func() { postHooks(ctx, d, req, err) }()
+	end, err := journalBegin(d, JournalDelete, volumeID, api.VolumeLocator{})
+	if err != nil {
+		return err
+	}
+	if cd, ok := d.(ContextDriver); ok {
+		defer end()
+		return cd.DeleteCtx(ctx, volumeID)
+	}
+	return RunContext(ctx, func() error {
+		defer end()
+		return d.Delete(volumeID)
+	})
+}
+
+// MountCtx calls Mount on d with ctx, tells the layers of the volume, and
+// records the mount in the usage history of the volume. The root directory
+// of the volume is given the owner and permissions of its spec. Volumes in
+// maintenance are not mounted.
+// Errors ErrVolMaintenance may be returned.
+func MountCtx(ctx context.Context, d ProtoDriver, volumeID api.VolumeID, mountpath string) (err error) {
+	ctx, span := startSpan(ctx, "mount", d, volumeID)
+	defer func() { span.Finish(err) }()
+	if err := checkMaintenance(d, volumeID); err != nil {
+		return err
+	}
+	if cd, ok := d.(ContextDriver); ok {
+		err = cd.MountCtx(ctx, volumeID, mountpath)
+	} else {
+		err = RunContext(ctx, func() error { return d.Mount(volumeID, mountpath) })
+	}
+	if err == nil {
+		err = mountLayers(d, volumeID, mountpath)
+	}
+	if err == nil {
+		recordUsage(d, volumeID, api.UsageMount, mountpath)
+		setMountRootDir(d, volumeID, mountpath)
+	}
+	return err
+}
+
+// UnmountCtx calls Unmount on d with ctx, once the layers of the volume are
+// told, and records the unmount in the usage history of the volume.
+// Subdirectories of the volume mounted by
+// MountWithOptions are unmounted without calling the driver.
+func UnmountCtx(ctx context.Context, d ProtoDriver, volumeID api.VolumeID, mountpath string) (err error) {
+	ctx, span := startSpan(ctx, "unmount", d, volumeID)
+	defer func() { span.Finish(err) }()
+	if sub, err := unmountSubpath(ctx, d, volumeID, mountpath); sub {
+		if err == nil {
+			recordUsage(d, volumeID, api.UsageUnmount, mountpath)
+			ephemeralReleased(d, volumeID)
+		}
+		return err
+	}
+	if err := unmountLayers(layersOfVolume(d, volumeID), volumeID, mountpath); err != nil {
+		return err
+	}
+	if cd, ok := d.(ContextDriver); ok {
+		err = cd.UnmountCtx(ctx, volumeID, mountpath)
+	} else {
+		err = RunContext(ctx, func() error { return d.Unmount(volumeID, mountpath) })
+	}
+	if err == nil {
+		recordUsage(d, volumeID, api.UsageUnmount, mountpath)
+		ephemeralReleased(d, volumeID)
+	}
+	return err
+}
+
+// SnapshotCtx calls Snapshot on d with ctx, once the pre hooks and the
+// OpSnapshot limits admit it and the layers of the volume are quiesced.
+// Errors HookVetoError may be returned.
+func SnapshotCtx(ctx context.Context, d ProtoDriver, volumeID api.VolumeID, labels api.Labels, writable bool) (snapID api.SnapID, err error) {
+	ctx, span := startSpan(ctx, "snapshot", d, volumeID)
+	defer func() { span.Finish(err) }()
+	req := &api.HookRequest{Op: HookSnapshot, VolumeID: volumeID, Labels: labels}
+	if err := preHooks(ctx, d, req); err != nil {
+		return api.BadSnapID, err
+	}
+	defer func() {
+		req.SnapID = snapID
+		postHooks(ctx, d, req, err)
+	}()
+	done, err := limit(ctx, d, OpSnapshot)
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	defer done()
+	resume, err := quiesceLayers(d, volumeID)
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	defer resume()
+	if cd, ok := d.(ContextDriver); ok {
+		return cd.SnapshotCtx(ctx, volumeID, labels, writable)
+	}
+	id := api.BadSnapID
+	err = RunContext(ctx, func() error {
+		var err error
+		id, err = d.Snapshot(volumeID, labels, writable)
+		return err
+	})
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	return id, nil
+}
+
+// SnapDeleteCtx calls SnapDelete on d with ctx.
+func SnapDeleteCtx(ctx context.Context, d ProtoDriver, snapID api.SnapID) error {
+	if cd, ok := d.(ContextDriver); ok {
+		return cd.SnapDeleteCtx(ctx, snapID)
+	}
+	return RunContext(ctx, func() error { return d.SnapDelete(snapID) })
+}
+
+// AttachCtx calls Attach on d with ctx. The devices of the layers of the
+// volume are stacked over its device, those of the layers of d it was
+// created under, then VDO if it is compressed unless d compresses natively,
+// then its cache if it has a CacheSpec, and the top device path is returned.
+// Volumes in maintenance are not attached, nor are volumes on a node in
+// maintenance, nor volumes the pre hooks do not admit. Volumes are detached
+// if their device does not hold the origin recorded for them, before any
+// layer is assembled over it, or if the top device does not hold the
+// filesystem recorded when they were formatted. The attach is recorded in the
+// journal until it returns, then in the usage history of the volume.
+// Errors ErrVolMaintenance, ErrNodeMaintenance, HookVetoError,
+// ErrWrongDevice may be returned.
+func AttachCtx(ctx context.Context, d BlockDriver, volumeID api.VolumeID, options *api.AttachOptions) (_ string, err error) {
+	ctx, span := startSpan(ctx, "attach", d, volumeID)
+	defer func() { span.Finish(err) }()
+	if err := checkNodeMaintenance(); err != nil {
+		return "", err
+	}
+	if err := checkMaintenance(d, volumeID); err != nil {
+		return "", err
+	}
+	req := &api.HookRequest{Op: HookAttach, VolumeID: volumeID, AttachOptions: options}
+	if err := preHooks(ctx, d, req); err != nil {
+		return "", err
+	}
+	defer func() { postHooks(ctx, d, req, err) }()
+	end, err := journalBegin(d, JournalAttach, volumeID, api.VolumeLocator{})
+	if err != nil {
+		return "", err
+	}
+	path := ""
+	if cd, ok := d.(ContextDriver); ok {
+		path, err = cd.AttachCtx(ctx, volumeID, options)
+		end()
+	} else {
+		err = RunContext(ctx, func() error {
+			defer end()
+			var err error
+			path, err = d.Attach(volumeID, options)
+			return err
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+	if err = checkOrigin(d, volumeID, path); err != nil {
+		return "", err
+	}
+	if path, err = attachLayers(d, volumeID, path); err != nil {
+		return "", err
+	}
+	if err = checkFsUUID(d, volumeID, path); err != nil {
+		return "", err
+	}
+	recordUsage(d, volumeID, api.UsageAttach, path)
+	return path, nil
+}
+
+// FormatCtx calls Format on d with ctx, once the OpFormat limits admit it.
+// The UUID of the filesystem is then recorded in the volume if d implements
+// Store, for AttachCtx to check.
+func FormatCtx(ctx context.Context, d BlockDriver, volumeID api.VolumeID) (err error) {
+	ctx, span := startSpan(ctx, "format", d, volumeID)
+	defer func() { span.Finish(err) }()
+	if pd, ok := d.(ProtoDriver); ok {
+		done, err := limit(ctx, pd, OpFormat)
+		if err != nil {
+			return err
+		}
+		defer done()
+	}
+	if cd, ok := d.(ContextDriver); ok {
+		err = cd.FormatCtx(ctx, volumeID)
+	} else {
+		err = RunContext(ctx, func() error { return d.Format(volumeID) })
+	}
+	if err != nil {
+		return err
+	}
+	recordFsUUID(d, volumeID)
+	return nil
+}
+
+// DetachCtx calls Detach on d with ctx, after removing the devices of the
+// layers of the volume, which flushes its cache, and records the detach in
+// the usage history of the volume.
+func DetachCtx(ctx context.Context, d BlockDriver, volumeID api.VolumeID) (err error) {
+	ctx, span := startSpan(ctx, "detach", d, volumeID)
+	defer func() { span.Finish(err) }()
+	if err := detachLayers(d, volumeID); err != nil {
+		return err
+	}
+	if cd, ok := d.(ContextDriver); ok {
+		err = cd.DetachCtx(ctx, volumeID)
+	} else {
+		err = RunContext(ctx, func() error { return d.Detach(volumeID) })
+	}
+	if err == nil {
+		recordUsage(d, volumeID, api.UsageDetach, "")
+		ephemeralReleased(d, volumeID)
+	}
+	return err
+}
+
+// InspectCtx calls Inspect on e with ctx.
+func InspectCtx(ctx context.Context, e Enumerator, volumeIDs []api.VolumeID) ([]api.Volume, error) {
+	if cd, ok := e.(ContextDriver); ok {
+		return cd.InspectCtx(ctx, volumeIDs)
+	}
+	var vols []api.Volume
+	err := WithContext(ctx, func() error {
+		var err error
+		vols, err = e.Inspect(volumeIDs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vols, nil
+}
+
+// EnumerateCtx calls Enumerate on e with ctx.
+func EnumerateCtx(ctx context.Context, e Enumerator, locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error) {
+	if cd, ok := e.(ContextDriver); ok {
+		return cd.EnumerateCtx(ctx, locator, labels)
+	}
+	var vols []api.Volume
+	err := WithContext(ctx, func() error {
+		var err error
+		vols, err = e.Enumerate(locator, labels)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vols, nil
+}
+
+// startSpan starts the span of the operation op of d on volumeID.
+func startSpan(ctx context.Context,
+	op string,
+	d interface{},
+	volumeID api.VolumeID) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, "volume."+op)
+	if span != nil {
+		span.SetTag(tracing.DriverTag, instanceName(d))
+		if volumeID != api.BadVolumeID {
+			span.SetTag(tracing.VolumeTag, string(volumeID))
+		}
+	}
+	return ctx, span
+}
@@ -0,0 +1,30 @@
+package volume
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := false
+	err := RunContext(ctx, func() error {
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		done = true
+		return nil
+	})
+	assert.NoError(t, err, "Change reported as failed while it completed")
+	assert.True(t, done, "RunContext returned before fn")
+
+	called := false
+	err = RunContext(ctx, func() error {
+		called = true
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, called, "Change started with a cancelled context")
+}
@@ -0,0 +1,58 @@
+package volume
+
+import (
+	"fmt"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/crypt"
+	"github.com/libopenstorage/openstorage/secrets"
+)
+
+const (
+	// CryptLayer layer encrypting the devices of block drivers with LUKS,
+	// such as "layers: crypt" over the EBS volumes of the aws driver.
+	CryptLayer = "crypt"
+	// CryptPassphraseParam DriverParams key for the passphrase of the
+	// volumes of the crypt layer, preferably set from a secret with
+	// CryptPassphraseParam+secrets.RefSuffix.
+	CryptPassphraseParam = "crypt_passphrase"
+)
+
+// cryptLayer encrypts the devices of volumes with dm-crypt.
+type cryptLayer struct {
+	passphrase string
+}
+
+func newCryptLayer(params DriverParams) (Layer, error) {
+	passphrase, err := secrets.Param(params, CryptPassphraseParam)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("No passphrase provided with %s", CryptPassphraseParam)
+	}
+	return &cryptLayer{passphrase: passphrase}, nil
+}
+
+func (l *cryptLayer) String() string {
+	return CryptLayer
+}
+
+// Assemble formats device for LUKS only if v was created under the layer,
+// volumes that predate it are never wiped.
+func (l *cryptLayer) Assemble(v *api.Volume, device string) (string, error) {
+	return crypt.Assemble(string(v.ID), device, l.passphrase, hasLayer(v, CryptLayer))
+}
+
+func (l *cryptLayer) Path(volumeID api.VolumeID, device string) string {
+	return crypt.Path(string(volumeID), device)
+}
+
+func (l *cryptLayer) Teardown(volumeID api.VolumeID) error {
+	return crypt.Teardown(string(volumeID))
+}
+
+func init() {
+	RegisterLayer(CryptLayer, newCryptLayer)
+	secrets.RegisterParam(CryptPassphraseParam)
+}
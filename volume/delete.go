@@ -0,0 +1,22 @@
+package volume
+
+import (
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// ForceDelete deletes the snapshots of a volume and then the volume itself.
+// Deletion stops at the first error, leaving the remaining snapshots and the
+// volume in place.
+// Errors ErrEnoEnt, ErrVolAttached may be returned.
+func ForceDelete(d VolumeDriver, volumeID api.VolumeID) error {
+	snaps, err := d.SnapEnumerate([]api.VolumeID{volumeID}, nil)
+	if err != nil {
+		return err
+	}
+	for _, s := range snaps {
+		if err := d.SnapDelete(s.ID); err != nil {
+			return err
+		}
+	}
+	return d.Delete(volumeID)
+}
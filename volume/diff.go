@@ -0,0 +1,58 @@
+package volume
+
+import (
+	"io"
+
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// SnapDiffer is implemented by drivers that can stream the changes between
+// two snapshots of a volume, so that backups can be incremental.
+type SnapDiffer interface {
+	// SnapDiff returns the changes from snapshot fromSnapID to snapshot
+	// toSnapID in the pkg/diff stream format. All of toSnapID is returned
+	// if fromSnapID is empty. The caller must close the stream.
+	// Errors ErrEnoEnt, ErrEinval may be returned if the snapshots are of
+	// different volumes.
+	SnapDiff(fromSnapID, toSnapID api.SnapID) (io.ReadCloser, error)
+}
+
+// SnapDiff returns the changes between two snapshots of a volume of d.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func SnapDiff(d ProtoDriver, fromSnapID, toSnapID api.SnapID) (io.ReadCloser, error) {
+	if sd, ok := d.(SnapDiffer); ok {
+		return sd.SnapDiff(fromSnapID, toSnapID)
+	}
+	return nil, ErrNotSupported
+}
+
+// CheckSnapDiff verifies that both snapshots exist and are of the same
+// volume, fromSnapID may be empty. It returns the snapshot toSnapID.
+// Errors ErrEnoEnt, ErrEinval may be returned.
+func CheckSnapDiff(s Store, fromSnapID, toSnapID api.SnapID) (*api.VolumeSnap, error) {
+	to, err := getSnap(s, toSnapID)
+	if err != nil {
+		return nil, err
+	}
+	if fromSnapID == "" {
+		return to, nil
+	}
+	from, err := getSnap(s, fromSnapID)
+	if err != nil {
+		return nil, err
+	}
+	if from.VolumeID != to.VolumeID {
+		return nil, ErrEinval
+	}
+	return to, nil
+}
+
+func getSnap(s Store, snapID api.SnapID) (*api.VolumeSnap, error) {
+	snap, err := s.GetSnap(snapID)
+	if err == kvdb.ErrNotFound {
+		return nil, ErrEnoEnt
+	}
+	return snap, err
+}
@@ -0,0 +1,78 @@
+package volume
+
+import (
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/logging"
+)
+
+// DriverContext is what a driver is initialized with: its parameters and the
+// services it depends on, so that drivers do not reach for globals such as
+// kvdb.Instance().
+type DriverContext struct {
+	// Name of the instance being initialized.
+	Name string
+	// Params of the instance, InstanceNameParam is set to Name.
+	Params DriverParams
+	// Kvdb stores the metadata of the instance.
+	Kvdb kvdb.Kvdb
+	// Log logs with the level of the instance.
+	Log *log.Entry
+	// Node is the identity of this node.
+	Node api.MachineID
+	// ClusterID is the cluster this node belongs to, empty if not
+	// clustered.
+	ClusterID string
+}
+
+// NewEnumerator returns a DefaultEnumerator storing the volumes of the
+// instance in its KVDB.
+func (c *DriverContext) NewEnumerator() *DefaultEnumerator {
+	return NewDefaultEnumerator(c.Name, c.Kvdb)
+}
+
+var (
+	ctxLock     sync.Mutex
+	defaultKvdb kvdb.Kvdb
+	clusterID   string
+)
+
+// SetKvdb sets the KVDB given to the instances started by New afterwards,
+// kvdb.Instance() if kv is nil.
+func SetKvdb(kv kvdb.Kvdb) {
+	ctxLock.Lock()
+	defer ctxLock.Unlock()
+	defaultKvdb = kv
+}
+
+// SetClusterID sets the cluster given to the instances started afterwards.
+func SetClusterID(id string) {
+	ctxLock.Lock()
+	defer ctxLock.Unlock()
+	clusterID = id
+}
+
+// newDriverContext returns the context of instance name, with the KVDB set
+// by SetKvdb if kv is nil.
+func newDriverContext(name string, params DriverParams, kv kvdb.Kvdb) *DriverContext {
+	ctxLock.Lock()
+	defer ctxLock.Unlock()
+	if kv == nil {
+		kv = defaultKvdb
+	}
+	if kv == nil {
+		kv = kvdb.Instance()
+	}
+	return &DriverContext{
+		Name:      name,
+		Params:    params,
+		Kvdb:      kv,
+		Log:       logging.For(name),
+		Node:      NodeID(),
+		ClusterID: clusterID,
+	}
+}
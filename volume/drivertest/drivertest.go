@@ -0,0 +1,336 @@
+// Package drivertest is a conformance test suite for VolumeDriver
+// implementations. Out of tree drivers can verify that they follow the
+// semantics and error contracts of the volume package by calling
+// RunVolumeDriverTests from a test:
+//
+//	func TestConformance(t *testing.T) {
+//		d, err := Init(&volume.DriverContext{Name: "test", Params: params, Kvdb: kv})
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		drivertest.RunVolumeDriverTests(t, d)
+//	}
+//
+// The driver must be empty when the suite starts, it is not shut down when
+// the suite ends.
+package drivertest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// Options tune the suite to the capabilities of a driver.
+type Options struct {
+	// Spec used to create test volumes. Defaults to a 1GiB volume.
+	Spec *api.VolumeSpec
+	// MountBase directory under which test mount points are created.
+	// Defaults to a temporary directory.
+	MountBase string
+	// SkipMount skips the tests that mount volumes, for drivers tested
+	// without the privileges to mount.
+	SkipMount bool
+}
+
+type suite struct {
+	volume.VolumeDriver
+	opts    Options
+	name    string
+	labels  api.Labels
+	volID   api.VolumeID
+	snapID  api.SnapID
+	mounted string
+}
+
+// RunVolumeDriverTests runs the conformance suite against d with default
+// options.
+func RunVolumeDriverTests(t *testing.T, d volume.VolumeDriver) {
+	RunVolumeDriverTestsWithOptions(t, d, Options{})
+}
+
+// RunVolumeDriverTestsWithOptions runs the conformance suite against d.
+func RunVolumeDriverTestsWithOptions(t *testing.T, d volume.VolumeDriver, opts Options) {
+	if opts.Spec == nil {
+		opts.Spec = &api.VolumeSpec{
+			Size:    1 << 30,
+			HALevel: 1,
+			Format:  api.FsNone,
+		}
+	}
+	s := &suite{
+		VolumeDriver: d,
+		opts:         opts,
+		name:         fmt.Sprintf("drivertest-%d", time.Now().UnixNano()),
+		labels:       api.Labels{"drivertest": "true"},
+		volID:        api.BadVolumeID,
+		snapID:       api.BadSnapID,
+	}
+	defer s.cleanup(t)
+
+	if !t.Run("Create", s.create) {
+		t.Fatalf("Cannot create a volume with %s, skipping remaining tests", d)
+	}
+	t.Run("Inspect", s.inspect)
+	t.Run("Enumerate", s.enumerate)
+	t.Run("Missing", s.missing)
+	t.Run("Attach", s.attach)
+	if !opts.SkipMount {
+		t.Run("Mount", s.mount)
+		t.Run("Unmount", s.unmount)
+	}
+	t.Run("Detach", s.detach)
+	t.Run("Snapshot", s.snapshot)
+	t.Run("SnapDelete", s.snapDelete)
+	t.Run("WritableSnapshot", s.writableSnapshot)
+	t.Run("Delete", s.delete)
+}
+
+func (s *suite) create(t *testing.T) {
+	id, err := s.Create(
+		api.VolumeLocator{Name: s.name, VolumeLabels: s.labels},
+		&api.CreateOptions{},
+		s.opts.Spec)
+	if !assert.NoError(t, err, "Create failed") {
+		return
+	}
+	if !assert.NotEqual(t, api.BadVolumeID, id, "Create returned an empty volume ID") {
+		t.FailNow()
+	}
+	s.volID = id
+}
+
+func (s *suite) inspect(t *testing.T) {
+	vols, err := s.Inspect([]api.VolumeID{s.volID})
+	assert.NoError(t, err, "Inspect failed")
+	if !assert.Equal(t, 1, len(vols), "Inspect should return the created volume") {
+		return
+	}
+	v := vols[0]
+	assert.Equal(t, s.volID, v.ID, "Inspect returned the wrong volume")
+	assert.Equal(t, s.name, v.Locator.Name, "Volume locator name not preserved")
+	if assert.NotNil(t, v.Spec, "Volume spec not preserved") {
+		assert.Equal(t, s.opts.Spec.Size, v.Spec.Size, "Volume size not preserved")
+	}
+	assert.False(t, v.Ctime.IsZero(), "Volume creation time not set")
+}
+
+func (s *suite) enumerate(t *testing.T) {
+	vols, err := s.Enumerate(api.VolumeLocator{Name: s.name}, nil)
+	assert.NoError(t, err, "Enumerate by name failed")
+	if assert.Equal(t, 1, len(vols), "Enumerate by name should return the created volume") {
+		assert.Equal(t, s.volID, vols[0].ID, "Enumerate returned the wrong volume")
+	}
+
+	vols, err = s.Enumerate(api.VolumeLocator{VolumeLabels: s.labels}, nil)
+	assert.NoError(t, err, "Enumerate by label failed")
+	assert.True(t, contains(vols, s.volID), "Enumerate by label should return the created volume")
+
+	vols, err = s.Enumerate(api.VolumeLocator{}, nil)
+	assert.NoError(t, err, "Enumerate all failed")
+	assert.True(t, contains(vols, s.volID), "Enumerate all should return the created volume")
+
+	vols, _ = s.Enumerate(api.VolumeLocator{Name: s.name + "-missing"}, nil)
+	assert.Equal(t, 0, len(vols), "Enumerate of a missing name should return nothing")
+}
+
+// missing checks operations on volumes that do not exist fail.
+func (s *suite) missing(t *testing.T) {
+	missing := api.VolumeID(s.name + "-missing")
+
+	vols, _ := s.Inspect([]api.VolumeID{missing})
+	assert.Equal(t, 0, len(vols), "Inspect of a missing volume should return nothing")
+	assert.Error(t, s.Delete(missing), "Delete of a missing volume should fail")
+	assert.Error(t, s.Mount(missing, s.mountPath(t, "missing")),
+		"Mount of a missing volume should fail")
+	_, err := s.Snapshot(missing, nil, false)
+	assert.Error(t, err, "Snapshot of a missing volume should fail")
+	assert.Error(t, s.SnapDelete(api.SnapID(s.name+"-missing")),
+		"SnapDelete of a missing snapshot should fail")
+	snaps, _ := s.SnapInspect([]api.SnapID{api.SnapID(s.name + "-missing")})
+	assert.Equal(t, 0, len(snaps), "SnapInspect of a missing snapshot should return nothing")
+}
+
+func (s *suite) attach(t *testing.T) {
+	p, err := s.Attach(s.volID, nil)
+	if err == volume.ErrNotSupported {
+		t.Skip("Attach not supported")
+	}
+	if !assert.NoError(t, err, "Attach failed") {
+		return
+	}
+	again, err := s.Attach(s.volID, nil)
+	if assert.NoError(t, err, "Attach should be idempotent on the same node") {
+		assert.Equal(t, p, again, "Repeated attach should return the same path")
+	}
+	assert.Error(t, s.Delete(s.volID), "Delete of an attached volume should fail")
+}
+
+func (s *suite) mount(t *testing.T) {
+	p := s.mountPath(t, "mount")
+	if !assert.NoError(t, s.Mount(s.volID, p), "Mount failed") {
+		return
+	}
+	s.mounted = p
+
+	vols, err := s.Inspect([]api.VolumeID{s.volID})
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(vols)) {
+		assert.Equal(t, p, vols[0].AttachPath, "Inspect should report the mount path")
+	}
+	f := path.Join(p, "drivertest")
+	if assert.NoError(t, ioutil.WriteFile(f, []byte(s.name), 0644), "Volume not writable") {
+		b, err := ioutil.ReadFile(f)
+		assert.NoError(t, err, "Volume not readable")
+		assert.Equal(t, s.name, string(b), "Data mismatch")
+	}
+}
+
+func (s *suite) unmount(t *testing.T) {
+	if s.mounted == "" {
+		t.Skip("Volume not mounted")
+	}
+	assert.NoError(t, s.Unmount(s.volID, s.mounted), "Unmount failed")
+	s.mounted = ""
+	assert.Error(t, s.Unmount(s.volID, s.mountPath(t, "mount")),
+		"Unmount of an unmounted volume should fail")
+}
+
+func (s *suite) detach(t *testing.T) {
+	err := s.Detach(s.volID)
+	if err == volume.ErrNotSupported {
+		t.Skip("Detach not supported")
+	}
+	assert.NoError(t, err, "Detach failed")
+}
+
+func (s *suite) snapshot(t *testing.T) {
+	labels := api.Labels{"drivertest": s.name}
+	id, err := s.Snapshot(s.volID, labels, false)
+	if err == volume.ErrNotSupported {
+		t.Skip("Snapshots not supported")
+	}
+	if !assert.NoError(t, err, "Snapshot failed") {
+		return
+	}
+	s.snapID = id
+
+	snaps, err := s.SnapInspect([]api.SnapID{id})
+	assert.NoError(t, err, "SnapInspect failed")
+	if assert.Equal(t, 1, len(snaps), "SnapInspect should return the snapshot") {
+		assert.Equal(t, s.volID, snaps[0].VolumeID, "Snapshot has the wrong parent volume")
+		assert.False(t, snaps[0].Writable, "Snapshot should be read-only")
+	}
+	if !s.opts.SkipMount {
+		assert.Error(t, s.Mount(api.VolumeID(id), s.mountPath(t, "snap")),
+			"Mount of a read-only snapshot should fail")
+	}
+	snaps, err = s.SnapEnumerate([]api.VolumeID{s.volID}, nil)
+	assert.NoError(t, err, "SnapEnumerate by volume failed")
+	assert.Equal(t, 1, len(snaps), "SnapEnumerate by volume should return the snapshot")
+	snaps, err = s.SnapEnumerate(nil, labels)
+	assert.NoError(t, err, "SnapEnumerate by label failed")
+	assert.Equal(t, 1, len(snaps), "SnapEnumerate by label should return the snapshot")
+
+	assert.Equal(t, volume.ErrVolHasSnaps, s.Delete(s.volID),
+		"Delete of a volume with snapshots should fail")
+}
+
+func (s *suite) snapDelete(t *testing.T) {
+	if s.snapID == api.BadSnapID {
+		t.Skip("No snapshot")
+	}
+	if !assert.NoError(t, s.SnapDelete(s.snapID), "SnapDelete failed") {
+		return
+	}
+	snaps, _ := s.SnapInspect([]api.SnapID{s.snapID})
+	assert.Equal(t, 0, len(snaps), "SnapInspect should not return a deleted snapshot")
+	s.snapID = api.BadSnapID
+}
+
+func (s *suite) writableSnapshot(t *testing.T) {
+	id, err := s.Snapshot(s.volID, nil, true)
+	if err == volume.ErrNotSupported {
+		t.Skip("Writable snapshots not supported")
+	}
+	if !assert.NoError(t, err, "Writable snapshot failed") {
+		return
+	}
+	s.snapID = id
+
+	snaps, err := s.SnapInspect([]api.SnapID{id})
+	assert.NoError(t, err, "SnapInspect failed")
+	if assert.Equal(t, 1, len(snaps), "SnapInspect should return the snapshot") {
+		assert.True(t, snaps[0].Writable, "Snapshot should be writable")
+	}
+	if !s.opts.SkipMount {
+		p := s.mountPath(t, "clone")
+		if assert.NoError(t, s.Mount(api.VolumeID(id), p), "Mount of a writable snapshot failed") {
+			assert.NoError(t, ioutil.WriteFile(path.Join(p, "clone"), []byte(s.name), 0644),
+				"Writable snapshot not writable")
+			assert.NoError(t, s.Unmount(api.VolumeID(id), p), "Unmount of a writable snapshot failed")
+		}
+	}
+	if assert.NoError(t, s.SnapDelete(id), "SnapDelete failed") {
+		s.snapID = api.BadSnapID
+	}
+}
+
+func (s *suite) delete(t *testing.T) {
+	if !assert.NoError(t, s.Delete(s.volID), "Delete failed") {
+		return
+	}
+	vols, _ := s.Inspect([]api.VolumeID{s.volID})
+	assert.Equal(t, 0, len(vols), "Inspect should not return a deleted volume")
+	vols, _ = s.Enumerate(api.VolumeLocator{Name: s.name}, nil)
+	assert.Equal(t, 0, len(vols), "Enumerate should not return a deleted volume")
+	s.volID = api.BadVolumeID
+}
+
+// cleanup removes whatever a failed run left behind.
+func (s *suite) cleanup(t *testing.T) {
+	if s.mounted != "" {
+		s.Unmount(s.volID, s.mounted)
+	}
+	if s.snapID != api.BadSnapID {
+		s.SnapDelete(s.snapID)
+	}
+	if s.volID != api.BadVolumeID {
+		s.Detach(s.volID)
+		if err := s.Delete(s.volID); err != nil {
+			t.Logf("Failed to clean up volume %v: %v", s.volID, err)
+		}
+	}
+	os.RemoveAll(s.mountBase())
+}
+
+func (s *suite) mountBase() string {
+	if s.opts.MountBase != "" {
+		return path.Join(s.opts.MountBase, s.name)
+	}
+	return path.Join(os.TempDir(), "drivertest", s.name)
+}
+
+func (s *suite) mountPath(t *testing.T, name string) string {
+	p := path.Join(s.mountBase(), name)
+	if err := os.MkdirAll(p, 0755); err != nil {
+		t.Fatalf("Cannot create mount path %s: %v", p, err)
+	}
+	return p
+}
+
+func contains(vols []api.Volume, id api.VolumeID) bool {
+	for _, v := range vols {
+		if v.ID == id {
+			return true
+		}
+	}
+	return false
+}
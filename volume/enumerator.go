@@ -1,13 +1,16 @@
 package volume
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	_ "sync"
+	"sync"
+	"time"
 
 	"github.com/portworx/kvdb"
 
 	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/tracing"
 )
 
 const (
@@ -56,10 +59,38 @@ type DefaultEnumerator struct {
 	lockKeyPrefix string
 	volKeyPrefix  string
 	snapKeyPrefix string
+	cacheLock     sync.RWMutex
+	cache         map[api.VolumeID]cachedVol
+	// cacheWarm is set once the cache holds every volume for this driver,
+	// at cacheWarmAt.
+	cacheWarm   bool
+	cacheWarmAt time.Time
+	// cacheTTL is how long cached volumes are served, see SetCacheTTL.
+	cacheTTL time.Duration
+	// cacheWatched is set once the volumes are watched to keep the cache
+	// up to date.
+	cacheWatched bool
+	// cacheStopped is set once the driver is shut down, see stopCache.
+	cacheStopped   bool
+	labelKeyPrefix string
+	labelReadyKey  string
+	nameKeyPrefix  string
+	// namesReadyKey is set once the names of existing volumes are reserved.
+	namesReadyKey string
+	// manifestKeyPrefix of the file hashes of snapshots, see
+	// FingerprintTree.
+	manifestKeyPrefix string
+	// txnKeyPrefix of the logs of transactions, see Txn.
+	txnKeyPrefix string
+	indexLock    sync.Mutex
+	// indexed is set once the labels of existing volumes are indexed.
+	indexed bool
+	// namesReserved is set once the names of existing volumes are reserved.
+	namesReserved bool
 }
 
 func (e *DefaultEnumerator) lockKey(volID api.VolumeID) string {
-	return e.volKeyPrefix + string(volID) + ".lock"
+	return e.lockKeyPrefix + string(volID) + ".lock"
 }
 
 func (e *DefaultEnumerator) snapKey(snapID api.SnapID) string {
@@ -70,6 +101,39 @@ func (e *DefaultEnumerator) volKey(volID api.VolumeID) string {
 	return e.volKeyPrefix + string(volID)
 }
 
+func (e *DefaultEnumerator) cachePut(vol *api.Volume) {
+	e.cacheLock.Lock()
+	defer e.cacheLock.Unlock()
+	e.cache[vol.ID] = cachedVol{vol: copyVol(vol), at: time.Now()}
+}
+
+func (e *DefaultEnumerator) cacheDelete(volID api.VolumeID) {
+	e.cacheLock.Lock()
+	defer e.cacheLock.Unlock()
+	e.cache[volID] = cachedVol{at: time.Now(), deleted: true}
+}
+
+func (e *DefaultEnumerator) cacheGet(volID api.VolumeID) (*api.Volume, bool) {
+	e.cacheLock.RLock()
+	defer e.cacheLock.RUnlock()
+	c, ok := e.cache[volID]
+	if !ok || c.deleted || time.Since(c.at) >= e.cacheTTL {
+		return nil, false
+	}
+	v := copyVol(&c.vol)
+	return &v, true
+}
+
+// copyVol returns a copy of vol that does not share the spec with the caller.
+func copyVol(vol *api.Volume) api.Volume {
+	v := *vol
+	if vol.Spec != nil {
+		spec := *vol.Spec
+		v.Spec = &spec
+	}
+	return v
+}
+
 func hasSubset(set api.Labels, subset api.Labels) bool {
 	if subset == nil {
 		return true
@@ -95,9 +159,15 @@ func contains(volID api.VolumeID, set []api.VolumeID) bool {
 }
 
 func match(v *api.Volume, locator api.VolumeLocator, configLabels api.Labels) bool {
+	if v.State == api.VolumeDeleted {
+		return false
+	}
 	if locator.Name != "" && v.Locator.Name != locator.Name {
 		return false
 	}
+	if locator.Group != "" && v.Locator.Group != locator.Group {
+		return false
+	}
 	if !hasSubset(v.Locator.VolumeLabels, locator.VolumeLabels) {
 		return false
 	}
@@ -107,11 +177,19 @@ func match(v *api.Volume, locator api.VolumeLocator, configLabels api.Labels) bo
 // NewDefaultEnumerator initializes store with specified kvdb.
 func NewDefaultEnumerator(driver string, kvdb kvdb.Kvdb) *DefaultEnumerator {
 	return &DefaultEnumerator{
-		kvdb:          kvdb,
-		driver:        driver,
-		lockKeyPrefix: keyBase + driver + locks,
-		volKeyPrefix:  keyBase + driver + volumes,
-		snapKeyPrefix: keyBase + driver + snapshots,
+		kvdb:              kvdb,
+		driver:            driver,
+		lockKeyPrefix:     keyBase + driver + locks,
+		volKeyPrefix:      keyBase + driver + volumes,
+		snapKeyPrefix:     keyBase + driver + snapshots,
+		labelKeyPrefix:    keyBase + driver + labelIndex,
+		labelReadyKey:     keyBase + driver + labelIndexReady,
+		nameKeyPrefix:     keyBase + driver + names,
+		namesReadyKey:     keyBase + driver + namesReady,
+		manifestKeyPrefix: keyBase + driver + manifests,
+		txnKeyPrefix:      keyBase + driver + txns,
+		cache:             make(map[api.VolumeID]cachedVol),
+		cacheTTL:          DefaultCacheTTL * time.Second,
 	}
 }
 
@@ -129,30 +207,115 @@ func (e *DefaultEnumerator) Unlock(token interface{}) error {
 	return e.kvdb.Unlock(v)
 }
 
-// CreateVol returns error if volume with the same ID already existe.
+// CreateVol returns error if volume with the same ID already existe. The
+// volume and its index entries are stored in one transaction.
+// Errors ErrEexist may be returned if the name of vol is taken.
 func (e *DefaultEnumerator) CreateVol(vol *api.Volume) error {
-	_, err := e.kvdb.Create(e.volKey(vol.ID), vol, 0)
-	return err
+	if err := e.reserveName(vol); err != nil {
+		return err
+	}
+	txn := e.Txn()
+	txn.Create(e.volKey(vol.ID), vol)
+	e.indexLabels(txn, vol.ID, nil, vol)
+	if err := txn.Commit(); err != nil {
+		// The name may belong to the volume that exists with this ID.
+		if err != kvdb.ErrExist {
+			e.releaseName(vol.Locator.Name, vol.ID)
+		}
+		return err
+	}
+	e.cachePut(vol)
+	return nil
 }
 
 // GetVol from volID.
 func (e *DefaultEnumerator) GetVol(volID api.VolumeID) (*api.Volume, error) {
 	var v api.Volume
 	_, err := e.kvdb.GetVal(e.volKey(volID), &v)
-
+	if err == nil {
+		e.cachePut(&v)
+	}
 	return &v, err
 }
 
-// UpdateVol with vol
+// UpdateVol with vol. A change of state is validated against the stored
+// volume and recorded in the volume's StateHistory.
+// A new name is reserved before the volume is updated. The volume and its
+// index entries are updated in one transaction.
+// Errors ErrVolAttached, ErrInvalidTransition, ErrEexist may be returned.
 func (e *DefaultEnumerator) UpdateVol(vol *api.Volume) error {
-	_, err := e.kvdb.Put(e.volKey(vol.ID), vol, 0)
-	return err
+	var old *api.Volume
+	var cur api.Volume
+	if _, err := e.kvdb.GetVal(e.volKey(vol.ID), &cur); err == nil {
+		if err = CheckTransition(cur.State, vol.State); err != nil {
+			return err
+		}
+		recordTransition(vol, cur.State, vol.State, "")
+		old = &cur
+	}
+	renamed := old != nil && old.Locator.Name != vol.Locator.Name
+	if renamed {
+		if err := e.reserveName(vol); err != nil {
+			return err
+		}
+	}
+	txn := e.Txn()
+	txn.Put(e.volKey(vol.ID), vol)
+	e.indexLabels(txn, vol.ID, old, vol)
+	if err := txn.Commit(); err != nil {
+		if renamed {
+			e.releaseName(vol.Locator.Name, vol.ID)
+		}
+		return err
+	}
+	if renamed {
+		e.releaseName(old.Locator.Name, vol.ID)
+	}
+	e.cachePut(vol)
+	return nil
+}
+
+// CanDelete returns an error if volID is attached or has snapshots. Drivers
+// should call it before reclaiming the resources of a volume.
+// Errors ErrVolAttached, ErrVolHasSnaps may be returned.
+func (e *DefaultEnumerator) CanDelete(volID api.VolumeID) error {
+	var cur api.Volume
+	if _, err := e.kvdb.GetVal(e.volKey(volID), &cur); err == nil {
+		if err = CheckTransition(cur.State, api.VolumeDeleted); err != nil {
+			return err
+		}
+	}
+	snaps, err := e.SnapEnumerate([]api.VolumeID{volID}, nil)
+	if err != nil {
+		return err
+	}
+	if len(snaps) != 0 {
+		return ErrVolHasSnaps
+	}
+	return nil
 }
 
-// DeleteVol. Returns error if volume does not exist.
+// DeleteVol. Returns error if volume does not exist, is attached or has
+// snapshots. The volume and its index entries are deleted in one
+// transaction.
 func (e *DefaultEnumerator) DeleteVol(volID api.VolumeID) error {
-	_, err := e.kvdb.Delete(e.volKey(volID))
-	return err
+	if err := e.CanDelete(volID); err != nil {
+		return err
+	}
+	var cur api.Volume
+	if _, err := e.kvdb.GetVal(e.volKey(volID), &cur); err != nil {
+		e.cacheDelete(volID)
+		return err
+	}
+	txn := e.Txn()
+	txn.Delete(e.volKey(volID))
+	e.indexLabels(txn, volID, &cur, nil)
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+	e.cacheDelete(volID)
+	e.releaseName(cur.Locator.Name, volID)
+	return nil
 }
 
 // GetSnap from snapID
@@ -163,6 +326,20 @@ func (e *DefaultEnumerator) GetSnap(snapID api.SnapID) (*api.VolumeSnap, error)
 	return &snap, err
 }
 
+// GetWritableSnap returns the snap snapID if it is writable, and so may be
+// mounted like a volume.
+// Errors ErrSnapReadOnly may be returned.
+func (e *DefaultEnumerator) GetWritableSnap(snapID api.SnapID) (*api.VolumeSnap, error) {
+	snap, err := e.GetSnap(snapID)
+	if err != nil {
+		return nil, err
+	}
+	if !snap.Writable {
+		return nil, ErrSnapReadOnly
+	}
+	return snap, nil
+}
+
 // Update snap with snap
 func (e *DefaultEnumerator) UpdateSnap(snap *api.VolumeSnap) error {
 	_, err := e.kvdb.Put(e.snapKey(snap.ID), snap, 0)
@@ -178,17 +355,136 @@ func (e *DefaultEnumerator) CreateSnap(snap *api.VolumeSnap) error {
 // DeleteSnap with new snap
 func (e *DefaultEnumerator) DeleteSnap(snapID api.SnapID) error {
 	_, err := e.kvdb.Delete(e.snapKey(snapID))
+	if err == nil {
+		e.deleteManifest(snapID)
+	}
 	return err
 }
 
+// kvdbCall runs the KVDB call op within a span. Reads are bounded by ctx,
+// writes are waited for once started.
+func kvdbCall(ctx context.Context, op string, write bool, f func() error) error {
+	ctx, span := tracing.Start(ctx, "kvdb."+op)
+	var err error
+	if write {
+		err = RunContext(ctx, f)
+	} else {
+		err = WithContext(ctx, f)
+	}
+	span.Finish(err)
+	return err
+}
+
+// GetVolCtx is GetVol bounded by ctx.
+func (e *DefaultEnumerator) GetVolCtx(ctx context.Context, volID api.VolumeID) (*api.Volume, error) {
+	var v *api.Volume
+	err := kvdbCall(ctx, "GetVol", false, func() error {
+		var err error
+		v, err = e.GetVol(volID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// CreateVolCtx is CreateVol bounded by ctx.
+func (e *DefaultEnumerator) CreateVolCtx(ctx context.Context, vol *api.Volume) error {
+	return kvdbCall(ctx, "CreateVol", true, func() error { return e.CreateVol(vol) })
+}
+
+// UpdateVolCtx is UpdateVol bounded by ctx.
+func (e *DefaultEnumerator) UpdateVolCtx(ctx context.Context, vol *api.Volume) error {
+	return kvdbCall(ctx, "UpdateVol", true, func() error { return e.UpdateVol(vol) })
+}
+
+// DeleteVolCtx is DeleteVol bounded by ctx.
+func (e *DefaultEnumerator) DeleteVolCtx(ctx context.Context, volID api.VolumeID) error {
+	return kvdbCall(ctx, "DeleteVol", true, func() error { return e.DeleteVol(volID) })
+}
+
+// GetSnapCtx is GetSnap bounded by ctx.
+func (e *DefaultEnumerator) GetSnapCtx(ctx context.Context, snapID api.SnapID) (*api.VolumeSnap, error) {
+	var snap *api.VolumeSnap
+	err := kvdbCall(ctx, "GetSnap", false, func() error {
+		var err error
+		snap, err = e.GetSnap(snapID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// CreateSnapCtx is CreateSnap bounded by ctx.
+func (e *DefaultEnumerator) CreateSnapCtx(ctx context.Context, snap *api.VolumeSnap) error {
+	return kvdbCall(ctx, "CreateSnap", true, func() error { return e.CreateSnap(snap) })
+}
+
+// DeleteSnapCtx is DeleteSnap bounded by ctx.
+func (e *DefaultEnumerator) DeleteSnapCtx(ctx context.Context, snapID api.SnapID) error {
+	return kvdbCall(ctx, "DeleteSnap", true, func() error { return e.DeleteSnap(snapID) })
+}
+
+// InspectCtx is Inspect bounded by ctx.
+func (e *DefaultEnumerator) InspectCtx(ctx context.Context, ids []api.VolumeID) ([]api.Volume, error) {
+	var vols []api.Volume
+	err := kvdbCall(ctx, "Inspect", false, func() error {
+		var err error
+		vols, err = e.Inspect(ids)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vols, nil
+}
+
+// EnumerateCtx is Enumerate bounded by ctx.
+func (e *DefaultEnumerator) EnumerateCtx(ctx context.Context,
+	locator api.VolumeLocator,
+	labels api.Labels) ([]api.Volume, error) {
+	var vols []api.Volume
+	err := kvdbCall(ctx, "Enumerate", false, func() error {
+		var err error
+		vols, err = e.Enumerate(locator, labels)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vols, nil
+}
+
 // Inspect specified volumee.
 // Errors ErrEnoEnt may be returned.
 func (e *DefaultEnumerator) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
+	return e.InspectAt(ids, api.ConsistencyStrong)
+}
+
+// InspectAt inspects specified volumes at the requested consistency. Cached
+// reads fall back to the KVDB for volumes not present in the cache or
+// cached for longer than the cache TTL.
+func (e *DefaultEnumerator) InspectAt(
+	ids []api.VolumeID,
+	c api.Consistency) ([]api.Volume, error) {
+
 	var err error
 	var vol *api.Volume
 	vols := make([]api.Volume, 0, len(ids))
+	if c == api.ConsistencyCached {
+		e.watchCache()
+	}
 
 	for _, v := range ids {
+		if c == api.ConsistencyCached {
+			if cached, ok := e.cacheGet(v); ok {
+				vols = append(vols, *cached)
+				continue
+			}
+		}
 		vol, err = e.GetVol(v)
 		if err != nil {
 			break
@@ -202,11 +498,68 @@ func (e *DefaultEnumerator) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
 // If locator fields are left blank, this will return all volumee.
 func (e *DefaultEnumerator) Enumerate(locator api.VolumeLocator,
 	labels api.Labels) ([]api.Volume, error) {
+	return e.EnumerateAt(locator, labels, api.ConsistencyStrong)
+}
 
+// EnumerateAt enumerates volumes at the requested consistency. Cached reads
+// are served from the KVDB until the cache has been fully populated, and
+// again every cache TTL.
+func (e *DefaultEnumerator) EnumerateAt(locator api.VolumeLocator,
+	labels api.Labels,
+	c api.Consistency) ([]api.Volume, error) {
+
+	if c == api.ConsistencyCached {
+		e.watchCache()
+		e.cacheLock.RLock()
+		if e.cacheWarm && time.Since(e.cacheWarmAt) < e.cacheTTL {
+			vols := make([]api.Volume, 0, len(e.cache))
+			for _, c := range e.cache {
+				if !c.deleted && match(&c.vol, locator, labels) {
+					vols = append(vols, copyVol(&c.vol))
+				}
+			}
+			e.cacheLock.RUnlock()
+			return vols, nil
+		}
+		e.cacheLock.RUnlock()
+	}
+
+	// Only read the volumes with the requested name, or else those
+	// carrying the requested labels.
+	var ids []api.VolumeID
+	var ok bool
+	var err error
+	if locator.Name != "" {
+		ids, ok, err = e.lookupName(locator.Name)
+	} else {
+		ids, ok, err = e.lookupLabels(locator.VolumeLabels, labels)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		vols := make([]api.Volume, 0, len(ids))
+		for _, id := range ids {
+			var elem api.Volume
+			if _, err := e.kvdb.GetVal(e.volKey(id), &elem); err != nil {
+				// Deleted since it was looked up.
+				continue
+			}
+			e.cachePut(&elem)
+			if match(&elem, locator, labels) {
+				vols = append(vols, elem)
+			}
+		}
+		return vols, nil
+	}
+
+	start := time.Now()
 	kvp, err := e.kvdb.Enumerate(e.volKeyPrefix)
 	if err != nil {
 		return nil, err
 	}
+	now := time.Now()
+	all := make(map[api.VolumeID]cachedVol, len(kvp))
 	vols := make([]api.Volume, 0, len(kvp))
 	for _, v := range kvp {
 		var elem api.Volume
@@ -214,10 +567,32 @@ func (e *DefaultEnumerator) Enumerate(locator api.VolumeLocator,
 		if err != nil {
 			return nil, err
 		}
+		all[elem.ID] = cachedVol{vol: copyVol(&elem), at: now, index: v.ModifiedIndex}
 		if match(&elem, locator, labels) {
 			vols = append(vols, elem)
 		}
 	}
+	e.fillCache(all, start)
+
+	return vols, nil
+}
+
+// EnumerateDeleted returns the volumes in the trash, which Enumerate omits.
+func (e *DefaultEnumerator) EnumerateDeleted() ([]api.Volume, error) {
+	kvp, err := e.kvdb.Enumerate(e.volKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var vols []api.Volume
+	for _, v := range kvp {
+		var elem api.Volume
+		if err = json.Unmarshal(v.Value, &elem); err != nil {
+			return nil, err
+		}
+		if elem.State == api.VolumeDeleted {
+			vols = append(vols, elem)
+		}
+	}
 	return vols, nil
 }
 
@@ -263,3 +638,24 @@ func (e *DefaultEnumerator) SnapEnumerate(
 	}
 	return snaps, nil
 }
+
+// InspectAt inspects volumes through e at the requested consistency if e
+// supports it, otherwise it falls back to a strongly consistent Inspect.
+func InspectAt(e Enumerator, ids []api.VolumeID, c api.Consistency) ([]api.Volume, error) {
+	if ce, ok := e.(ConsistentEnumerator); ok && c == api.ConsistencyCached {
+		return ce.InspectAt(ids, c)
+	}
+	return e.Inspect(ids)
+}
+
+// EnumerateAt enumerates volumes through e at the requested consistency if e
+// supports it, otherwise it falls back to a strongly consistent Enumerate.
+func EnumerateAt(e Enumerator,
+	locator api.VolumeLocator,
+	labels api.Labels,
+	c api.Consistency) ([]api.Volume, error) {
+	if ce, ok := e.(ConsistentEnumerator); ok && c == api.ConsistencyCached {
+		return ce.EnumerateAt(locator, labels, c)
+	}
+	return e.Enumerate(locator, labels)
+}
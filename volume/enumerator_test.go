@@ -1,7 +1,11 @@
 package volume
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -10,6 +14,7 @@ import (
 	"github.com/portworx/kvdb/mem"
 
 	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/diff"
 )
 
 var (
@@ -75,6 +80,249 @@ func TestEnumerate(t *testing.T) {
 	assert.Equal(t, len(vols), 0, "Number of volumes returned in enumerate should be 0")
 }
 
+func TestLabelIndex(t *testing.T) {
+	id := api.VolumeID("TestLabelledVolume")
+	vol := api.Volume{
+		ID:      id,
+		Locator: api.VolumeLocator{Name: string(id), VolumeLabels: api.Labels{"tier": "gold"}},
+		State:   api.VolumeAvailable,
+		Spec:    &api.VolumeSpec{ConfigLabels: api.Labels{"app": "db"}},
+	}
+	err := e.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+
+	vols, err := e.Enumerate(api.VolumeLocator{VolumeLabels: api.Labels{"tier": ""}}, api.Labels{"app": ""})
+	assert.NoError(t, err, "Failed in Enumerate")
+	assert.Equal(t, 1, len(vols), "Volume should be found by its labels")
+	vols, err = e.Enumerate(api.VolumeLocator{VolumeLabels: api.Labels{"zone": ""}}, nil)
+	assert.NoError(t, err, "Failed in Enumerate")
+	assert.Equal(t, 0, len(vols), "Volume without the label should not be found")
+
+	vol.Locator.VolumeLabels = api.Labels{"zone": "a"}
+	err = e.UpdateVol(&vol)
+	assert.NoError(t, err, "Failed in UpdateVol")
+	vols, err = e.Enumerate(api.VolumeLocator{VolumeLabels: api.Labels{"tier": ""}}, nil)
+	assert.NoError(t, err, "Failed in Enumerate")
+	assert.Equal(t, 0, len(vols), "Removed label should be unindexed")
+	vols, err = e.Enumerate(api.VolumeLocator{VolumeLabels: api.Labels{"zone": ""}}, nil)
+	assert.NoError(t, err, "Failed in Enumerate")
+	assert.Equal(t, 1, len(vols), "Added label should be indexed")
+
+	err = e.DeleteVol(id)
+	assert.NoError(t, err, "Failed in Delete")
+	kvp, err := e.kvdb.Enumerate(e.labelKeyPrefix)
+	assert.NoError(t, err, "Failed in Enumerate")
+	assert.Equal(t, 0, len(kvp), "Deleted volume should be unindexed")
+}
+
+func TestNameIndex(t *testing.T) {
+	id := api.VolumeID("TestNamedVolume")
+	vol := api.Volume{
+		ID:      id,
+		Locator: api.VolumeLocator{Name: "before"},
+		State:   api.VolumeAvailable,
+		Spec:    &api.VolumeSpec{},
+	}
+	err := e.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+	ids, ok, err := e.lookupName("before")
+	assert.NoError(t, err, "Failed in lookupName")
+	assert.True(t, ok, "Names should be reserved")
+	assert.Equal(t, []api.VolumeID{id}, ids, "Volume should be found by its name")
+
+	vol.Locator.Name = "after"
+	err = e.UpdateVol(&vol)
+	assert.NoError(t, err, "Failed in UpdateVol")
+	vols, err := e.Enumerate(api.VolumeLocator{Name: "before"}, nil)
+	assert.NoError(t, err, "Failed in Enumerate")
+	assert.Equal(t, 0, len(vols), "Old name should be unindexed")
+	vols, err = e.Enumerate(api.VolumeLocator{Name: "after"}, nil)
+	assert.NoError(t, err, "Failed in Enumerate")
+	assert.Equal(t, 1, len(vols), "New name should be indexed")
+
+	err = e.DeleteVol(id)
+	assert.NoError(t, err, "Failed in Delete")
+	_, err = e.kvdb.Get(e.nameKey("after"))
+	assert.Equal(t, kvdb.ErrNotFound, err, "Name of deleted volume should be released")
+
+	// Names of volumes stored before names were reserved are reserved on
+	// the first lookup.
+	old := api.Volume{ID: "TestUnreservedVolume", Locator: api.VolumeLocator{Name: "old"}, Spec: &api.VolumeSpec{}}
+	_, err = e.kvdb.Put(e.volKey(old.ID), &old, 0)
+	assert.NoError(t, err, "Failed in Put")
+	defer e.DeleteVol(old.ID)
+	_, err = e.kvdb.Delete(e.namesReadyKey)
+	assert.NoError(t, err, "Failed in Delete")
+	e.namesReserved = false
+	vols, err = e.Enumerate(api.VolumeLocator{Name: "old"}, nil)
+	assert.NoError(t, err, "Failed in Enumerate")
+	assert.Equal(t, 1, len(vols), "Unreserved name should be found")
+}
+
+func TestConsistency(t *testing.T) {
+	id := api.VolumeID(volName)
+	vol := api.Volume{
+		ID:      id,
+		Locator: api.VolumeLocator{Name: volName, VolumeLabels: labels},
+		State:   api.VolumeAvailable,
+		Spec:    &api.VolumeSpec{},
+	}
+	err := e.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+
+	vols, err := e.EnumerateAt(api.VolumeLocator{Name: volName}, nil, api.ConsistencyStrong)
+	assert.NoError(t, err, "Failed in EnumerateAt")
+	assert.Equal(t, 1, len(vols), "Number of volumes returned in enumerate should be 1")
+
+	vols, err = e.InspectAt([]api.VolumeID{id}, api.ConsistencyCached)
+	assert.NoError(t, err, "Failed in InspectAt")
+	assert.Equal(t, 1, len(vols), "Number of volumes returned in inspect should be 1")
+
+	// Update the volume behind the enumerator's back, the watch updates
+	// the cache.
+	vol.State = api.VolumeAttached
+	_, err = e.kvdb.Put(e.volKey(id), &vol, 0)
+	assert.NoError(t, err, "Failed in Put")
+	state := api.VolumeAvailable
+	for i := 0; i < 100 && state != api.VolumeAttached; i++ {
+		time.Sleep(10 * time.Millisecond)
+		vols, err = e.InspectAt([]api.VolumeID{id}, api.ConsistencyCached)
+		assert.NoError(t, err, "Failed in InspectAt")
+		if len(vols) == 1 {
+			state = vols[0].State
+		}
+	}
+	assert.Equal(t, api.VolumeAttached, state, "Cache not updated by the watch")
+	vols, err = e.InspectAt([]api.VolumeID{id}, api.ConsistencyStrong)
+	assert.NoError(t, err, "Failed in InspectAt")
+	if len(vols) == 1 {
+		assert.Equal(t, api.VolumeAttached, vols[0].State, "Strong inspect should return latest state")
+	}
+
+	vol.State = api.VolumeDetached
+	err = e.UpdateVol(&vol)
+	assert.NoError(t, err, "Failed in UpdateVol")
+	err = e.DeleteVol(id)
+	assert.NoError(t, err, "Failed in Delete")
+	vols, err = e.EnumerateAt(api.VolumeLocator{Name: volName}, nil, api.ConsistencyCached)
+	assert.NoError(t, err, "Failed in EnumerateAt")
+	assert.Equal(t, 0, len(vols), "Number of volumes returned in enumerate should be 0")
+}
+
+func TestCacheTTL(t *testing.T) {
+	// The enumerator is not watching, changes are only seen after the TTL.
+	te := NewDefaultEnumerator("cache_test", e.kvdb)
+	te.cacheWatched = true
+	te.SetCacheTTL(50 * time.Millisecond)
+	vol := api.Volume{ID: "cache_test_vol", State: api.VolumeAvailable, Spec: &api.VolumeSpec{}}
+	assert.NoError(t, te.CreateVol(&vol))
+	defer te.DeleteVol(vol.ID)
+
+	vols, err := te.EnumerateAt(api.VolumeLocator{}, nil, api.ConsistencyCached)
+	assert.NoError(t, err)
+	assert.Len(t, vols, 1)
+	vol.State = api.VolumeDetached
+	_, err = te.kvdb.Put(te.volKey(vol.ID), &vol, 0)
+	assert.NoError(t, err)
+	vols, _ = te.InspectAt([]api.VolumeID{vol.ID}, api.ConsistencyCached)
+	assert.Equal(t, api.VolumeAvailable, vols[0].State, "Cached inspect should return cached state")
+
+	time.Sleep(50 * time.Millisecond)
+	vols, _ = te.InspectAt([]api.VolumeID{vol.ID}, api.ConsistencyCached)
+	assert.Equal(t, api.VolumeDetached, vols[0].State, "Cached volume served after the TTL")
+	vols, _ = te.EnumerateAt(api.VolumeLocator{}, nil, api.ConsistencyCached)
+	assert.Equal(t, api.VolumeDetached, vols[0].State, "Cached enumerate served after the TTL")
+}
+
+func TestFillCache(t *testing.T) {
+	te := NewDefaultEnumerator("fill_test", e.kvdb)
+	te.SetCacheTTL(time.Minute)
+	start := time.Now()
+	read := map[api.VolumeID]cachedVol{
+		"a": {vol: api.Volume{ID: "a", State: api.VolumeAvailable, Spec: &api.VolumeSpec{}}, at: start, index: 1},
+		"b": {vol: api.Volume{ID: "b", Spec: &api.VolumeSpec{}}, at: start, index: 1},
+	}
+	// Changes received by the watch while the volumes were read.
+	attached, _ := json.Marshal(&api.Volume{ID: "a", State: api.VolumeAttached, Spec: &api.VolumeSpec{}})
+	assert.NoError(t, te.cacheWatch("", nil,
+		&kvdb.KVPair{Key: te.volKey("a"), Value: attached, ModifiedIndex: 2}, nil))
+	assert.NoError(t, te.cacheWatch("", nil,
+		&kvdb.KVPair{Key: te.volKey("b"), Action: kvdb.KVDelete, ModifiedIndex: 2}, nil))
+	te.fillCache(read, start)
+
+	vols, err := te.EnumerateAt(api.VolumeLocator{}, nil, api.ConsistencyCached)
+	assert.NoError(t, err)
+	if assert.Len(t, vols, 1, "Deleted volume added back") {
+		assert.Equal(t, api.VolumeAttached, vols[0].State, "Watched change overwritten")
+	}
+
+	te.stopCache()
+	assert.Equal(t, errCacheStopped, te.cacheWatch("", nil,
+		&kvdb.KVPair{Key: te.volKey("a"), Value: attached, ModifiedIndex: 3}, nil),
+		"Watch not stopped")
+	assert.Empty(t, te.cache)
+}
+
+func TestStateTransitions(t *testing.T) {
+	id := api.VolumeID("TestStateVolume")
+	vol := api.Volume{
+		ID:      id,
+		Locator: api.VolumeLocator{Name: string(id)},
+		State:   api.VolumeAvailable,
+		Spec:    &api.VolumeSpec{},
+	}
+	err := e.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+
+	err = SetState(&vol, api.VolumeAttached, "attach")
+	assert.NoError(t, err, "Available volume should attach")
+	err = e.UpdateVol(&vol)
+	assert.NoError(t, err, "Failed in UpdateVol")
+	assert.Equal(t, 1, len(vol.StateHistory), "Transition should be recorded once")
+
+	assert.Equal(t, ErrVolAttached, e.DeleteVol(id), "Attached volume should not be deleted")
+	vol.State = api.VolumeDeleted
+	assert.Equal(t, ErrVolAttached, e.UpdateVol(&vol), "Attached volume should not be deleted")
+
+	vol.State = api.VolumeDetached
+	err = e.UpdateVol(&vol)
+	assert.NoError(t, err, "Failed in UpdateVol")
+	assert.Equal(t, 2, len(vol.StateHistory), "UpdateVol should record the transition")
+	assert.Equal(t, api.VolumeAttached, vol.StateHistory[1].From)
+	assert.Equal(t, api.VolumeDetached, vol.StateHistory[1].To)
+
+	err = e.DeleteVol(id)
+	assert.NoError(t, err, "Detached volume should be deleted")
+
+	vol.State = api.VolumeDeleted
+	assert.Equal(t, ErrInvalidTransition, SetState(&vol, api.VolumeAttached, ""),
+		"Deleted volumes cannot be attached")
+	assert.NoError(t, SetState(&vol, api.VolumeAvailable, ""),
+		"Deleted volumes can be restored from the trash")
+}
+
+func TestDeleteWithSnaps(t *testing.T) {
+	id := api.VolumeID("TestSnappedVolume")
+	vol := api.Volume{
+		ID:      id,
+		Locator: api.VolumeLocator{Name: string(id)},
+		State:   api.VolumeAvailable,
+		Spec:    &api.VolumeSpec{},
+	}
+	err := e.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+	snap := api.VolumeSnap{ID: api.SnapID("TestSnappedVolumeSnap"), VolumeID: id}
+	err = e.CreateSnap(&snap)
+	assert.NoError(t, err, "Failed in CreateSnap")
+
+	assert.Equal(t, ErrVolHasSnaps, e.DeleteVol(id), "Volume with snaps should not be deleted")
+
+	err = e.DeleteSnap(snap.ID)
+	assert.NoError(t, err, "Failed in DeleteSnap")
+	err = e.DeleteVol(id)
+	assert.NoError(t, err, "Volume without snaps should be deleted")
+}
+
 func TestSnapInspect(t *testing.T) {
 	snapID := api.SnapID(snapName)
 	id := api.VolumeID(volName)
@@ -155,6 +403,27 @@ func TestSnapEnumerate(t *testing.T) {
 	assert.NoError(t, err, "Failed in Delete")
 }
 
+func TestManifestChunks(t *testing.T) {
+	snapID := api.SnapID("ManifestSnap")
+	m := make(diff.Manifest)
+	for i := 0; i < 10000; i++ {
+		m[fmt.Sprintf("dir/file%d", i)] = strings.Repeat("0", 64)
+	}
+	err := e.putManifest(snapID, m)
+	assert.NoError(t, err, "Failed in putManifest")
+	var chunks int
+	_, err = e.kvdb.GetVal(e.manifestChunksKey(snapID), &chunks)
+	assert.NoError(t, err, "Failed to get the number of chunks")
+	assert.True(t, chunks > 1, "Manifest should be split in chunks")
+	got, err := e.getManifest(snapID)
+	assert.NoError(t, err, "Failed in getManifest")
+	assert.Equal(t, m, got, "Manifest should round trip")
+
+	e.deleteManifest(snapID)
+	_, err = e.getManifest(snapID)
+	assert.Equal(t, kvdb.ErrNotFound, err, "Manifest should be deleted")
+}
+
 func init() {
 	kv, err := kvdb.New(mem.Name, "driver_test", []string{}, nil)
 	if err != nil {
@@ -0,0 +1,221 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/events"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+	"github.com/libopenstorage/openstorage/pkg/worker"
+)
+
+const (
+	// EphemeralGraceParam DriverParams key for the number of seconds an
+	// ephemeral volume is kept once it is no longer attached or mounted,
+	// 60 by default. Volumes used again within the grace period are kept.
+	EphemeralGraceParam = "ephemeral_grace"
+	// defaultEphemeralGrace seconds released ephemeral volumes are kept.
+	defaultEphemeralGrace = 60
+	// ephemeralScanInterval time between scans for released and leaked
+	// ephemeral volumes.
+	ephemeralScanInterval = time.Minute
+)
+
+// ephemeralReaper deletes the ephemeral volumes of a driver once they have
+// been released, detached and unmounted, for the grace period. Deletion is
+// scheduled when a volume is released and volumes whose deletion was missed,
+// such as across a restart, are found by periodic scans. The scans also find
+// the ephemeral volumes of this node whose mount is gone, because the
+// container using them went away without unmounting them, and release them.
+type ephemeralReaper struct {
+	name   string
+	driver VolumeDriver
+	pool   *worker.Pool
+	grace  time.Duration
+	stop   chan struct{}
+}
+
+func newEphemeralReaper(name string,
+	d VolumeDriver,
+	pool *worker.Pool,
+	params DriverParams) (*ephemeralReaper, error) {
+
+	seconds, err := intParam(params, EphemeralGraceParam, defaultEphemeralGrace)
+	if err != nil {
+		return nil, err
+	}
+	if seconds < 0 {
+		return nil, fmt.Errorf("Invalid value %d for %s", seconds, EphemeralGraceParam)
+	}
+	// The metadata of drivers that are not stores is not kept by this node.
+	if _, ok := d.(Store); !ok || d.Type()&(Block|File) == 0 {
+		return nil, nil
+	}
+	return &ephemeralReaper{
+		name:   name,
+		driver: d,
+		pool:   pool,
+		grace:  time.Duration(seconds) * time.Second,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+func (r *ephemeralReaper) start() {
+	go func() {
+		tick := time.NewTicker(ephemeralScanInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				if err := r.pool.Submit(r.scan); err != nil {
+					log.Warnf("%s: skipping scan of ephemeral volumes: %v", r.name, err)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *ephemeralReaper) shutdown() {
+	close(r.stop)
+}
+
+// released schedules the deletion of volumeID, if it is ephemeral and still
+// released once the grace period expires.
+func (r *ephemeralReaper) released(volumeID api.VolumeID) {
+	time.AfterFunc(r.grace, func() {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		vols, err := r.driver.Inspect([]api.VolumeID{volumeID})
+		if err != nil || len(vols) != 1 {
+			return
+		}
+		r.reap(&vols[0])
+	})
+}
+
+// scan releases the leaked ephemeral volumes of this node and deletes the
+// ephemeral volumes released for the grace period.
+func (r *ephemeralReaper) scan() {
+	vols, err := r.driver.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		log.Warnf("%s: failed to list ephemeral volumes: %v", r.name, err)
+		return
+	}
+	var table []fs.Mount
+	for i := range vols {
+		v := &vols[i]
+		if v.Spec == nil || !v.Spec.Ephemeral {
+			continue
+		}
+		if !inUse(v) {
+			r.reap(v)
+			continue
+		}
+		if v.AttachPath == "" || attachmentOn(v, NodeID()) == nil {
+			continue
+		}
+		if table == nil {
+			if table, err = fs.MountTable(); err != nil {
+				log.Warnf("%s: failed to read the mount table: %v", r.name, err)
+				return
+			}
+		}
+		if !mountedAt(table, v.AttachPath) {
+			r.release(v)
+		}
+	}
+}
+
+// reap deletes v if it is an ephemeral volume released for the grace
+// period. Volumes are deleted by the node that last used them.
+func (r *ephemeralReaper) reap(v *api.Volume) {
+	if v.Spec == nil || !v.Spec.Ephemeral || inUse(v) {
+		return
+	}
+	// Volumes of the warm pool are waiting to be used.
+	if _, ok := v.Locator.VolumeLabels[api.WarmPoolLabel]; ok {
+		return
+	}
+	at, node := v.Ctime, api.MachineID("")
+	if n := len(v.UsageHistory); n > 0 {
+		at, node = v.UsageHistory[n-1].Time, v.UsageHistory[n-1].Node
+	}
+	if time.Since(at) < r.grace || (node != "" && node != NodeID()) {
+		return
+	}
+	log.Infof("%s: deleting ephemeral volume %v released at %v", r.name, v.ID, at)
+	if err := DeleteCtx(withInternal(context.Background()), r.driver, v.ID); err != nil && err != ErrEnoEnt {
+		log.Warnf("%s: failed to delete ephemeral volume %v: %v", r.name, v.ID, err)
+	}
+}
+
+// release unmounts and detaches a leaked ephemeral volume, whose mount is
+// gone from this node. The mount is forgotten if the driver fails to
+// unmount it.
+func (r *ephemeralReaper) release(v *api.Volume) {
+	log.Warnf("%s: mount of ephemeral volume %v at %s is gone, releasing it", r.name, v.ID, v.AttachPath)
+	events.Publish(api.Event{
+		Type:     api.EventEphemeralLeaked,
+		Driver:   r.name,
+		VolumeID: v.ID,
+		Message:  v.AttachPath,
+	})
+	ctx := withInternal(context.Background())
+	if err := UnmountCtx(ctx, r.driver, v.ID, v.AttachPath); err != nil {
+		log.Warnf("%s: failed to unmount ephemeral volume %v, forgetting its mount: %v", r.name, v.ID, err)
+		if err = forgetMount(r.driver.(Store), v.ID); err != nil {
+			log.Warnf("%s: failed to release ephemeral volume %v: %v", r.name, v.ID, err)
+			return
+		}
+	}
+	if r.driver.Type()&Block == 0 {
+		return
+	}
+	if err := DetachCtx(ctx, r.driver, v.ID); err != nil {
+		log.Warnf("%s: failed to detach ephemeral volume %v: %v", r.name, v.ID, err)
+	}
+}
+
+// forgetMount clears the mount recorded in volumeID.
+func forgetMount(store Store, volumeID api.VolumeID) error {
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer store.Unlock(token)
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	v.AttachPath = ""
+	return store.UpdateVol(v)
+}
+
+// inUse returns true if v is attached or mounted on any node.
+func inUse(v *api.Volume) bool {
+	return v.AttachPath != "" ||
+		len(v.SubpathMounts) > 0 ||
+		len(v.Attachments) > 0 ||
+		v.State == api.VolumeAttached
+}
+
+// ephemeralReleased schedules the deletion of volumeID once d detached or
+// unmounted it, if it is an ephemeral volume.
+func ephemeralReleased(d interface{}, volumeID api.VolumeID) {
+	name := instanceName(d)
+	mutex.Lock()
+	r, ok := reapers[name]
+	mutex.Unlock()
+	if ok {
+		r.released(volumeID)
+	}
+}
@@ -0,0 +1,91 @@
+package volume
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type ephemeralDriver struct {
+	ProtoDriver
+	*DefaultEnumerator
+	NotSupportedBlockDriver
+}
+
+func (d *ephemeralDriver) String() string   { return "ephemeral_test" }
+func (d *ephemeralDriver) Type() DriverType { return File }
+
+func (d *ephemeralDriver) Delete(volumeID api.VolumeID) error {
+	return d.DeleteVol(volumeID)
+}
+
+func (d *ephemeralDriver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	return errors.New("not mounted")
+}
+
+func TestEphemeralReaper(t *testing.T) {
+	d := &ephemeralDriver{DefaultEnumerator: NewDefaultEnumerator("ephemeral_test", kvdb.Instance())}
+	r, err := newEphemeralReaper("ephemeral_test", d, nil, nil)
+	assert.NoError(t, err)
+	defer r.shutdown()
+	_, err = newEphemeralReaper("ephemeral_test", d, nil, DriverParams{EphemeralGraceParam: "-1"})
+	assert.Error(t, err, "Negative grace accepted")
+
+	create := func(id api.VolumeID, ephemeral bool, released time.Duration, node api.MachineID) *api.Volume {
+		v := &api.Volume{ID: id, Spec: &api.VolumeSpec{Ephemeral: ephemeral}, Ctime: time.Now()}
+		if released != 0 {
+			v.UsageHistory = []api.UsageEvent{{
+				Op:   api.UsageUnmount,
+				Node: node,
+				Time: time.Now().Add(-released),
+			}}
+		}
+		assert.NoError(t, d.CreateVol(v))
+		return v
+	}
+	old := create("ephemeral_test_old", true, 2*time.Minute, NodeID())
+	defer d.DeleteVol(old.ID)
+	recent := create("ephemeral_test_recent", true, 10*time.Second, NodeID())
+	defer d.DeleteVol(recent.ID)
+	other := create("ephemeral_test_other", true, 2*time.Minute, "ephemeral_test_node")
+	defer d.DeleteVol(other.ID)
+	persistent := create("ephemeral_test_persistent", false, 2*time.Minute, NodeID())
+	defer d.DeleteVol(persistent.ID)
+	leaked := &api.Volume{
+		ID:         "ephemeral_test_leaked",
+		Spec:       &api.VolumeSpec{Ephemeral: true},
+		AttachPath: "/ephemeral_test/gone",
+	}
+	RecordAttach(leaked, NodeID(), nil)
+	assert.NoError(t, d.CreateVol(leaked))
+	defer d.DeleteVol(leaked.ID)
+
+	r.scan()
+
+	_, err = d.GetVol(old.ID)
+	assert.Error(t, err, "Released ephemeral volume should be deleted")
+	for _, id := range []api.VolumeID{recent.ID, other.ID, persistent.ID} {
+		_, err = d.GetVol(id)
+		assert.NoError(t, err, "Volume %v should be kept", id)
+	}
+	v, err := d.GetVol(leaked.ID)
+	if assert.NoError(t, err, "Leaked volume still attached should be kept") {
+		assert.Equal(t, "", v.AttachPath, "Mount of leaked volume should be released")
+	}
+
+	r, err = newEphemeralReaper("ephemeral_test", d, nil, DriverParams{EphemeralGraceParam: "0"})
+	assert.NoError(t, err)
+	defer r.shutdown()
+	r.released(recent.ID)
+	r.released(persistent.ID)
+	time.Sleep(100 * time.Millisecond)
+	_, err = d.GetVol(recent.ID)
+	assert.Error(t, err, "Ephemeral volume should be deleted once released")
+	_, err = d.GetVol(persistent.ID)
+	assert.NoError(t, err)
+}
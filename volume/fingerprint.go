@@ -0,0 +1,192 @@
+package volume
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/diff"
+)
+
+const (
+	manifests = "/manifests/"
+	// manifestChunk bytes of file hashes are kept per KVDB value, well
+	// within the value size limits of etcd and consul.
+	manifestChunk = 256 << 10
+)
+
+// Fingerprinter is implemented by drivers that can hash the content of their
+// volumes. IO to the volume should be quiesced while it is hashed.
+type Fingerprinter interface {
+	// Fingerprint hashes the content of volumeID. If base, a snapshot of
+	// the volume, is set the hashes recorded for the snapshot are reused
+	// for data unchanged since, drivers that cannot tell ignore it.
+	// Errors ErrEnoEnt, ErrEinval may be returned.
+	Fingerprint(volumeID api.VolumeID, base api.SnapID) (*api.Fingerprint, error)
+}
+
+// Fingerprint hashes the content of a volume of d, reusing the hashes of
+// snapshot base if it is set.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func Fingerprint(d ProtoDriver, volumeID api.VolumeID, base api.SnapID) (*api.Fingerprint, error) {
+	if f, ok := d.(Fingerprinter); ok {
+		return f.Fingerprint(volumeID, base)
+	}
+	return nil, ErrNotSupported
+}
+
+// The manifest of a snapshot is split in chunks of up to manifestChunk bytes
+// under manifestKey/<n>. The number of chunks is stored at manifestKey/chunks
+// once they are all written, manifests without it are incomplete.
+func (e *DefaultEnumerator) manifestKey(snapID api.SnapID) string {
+	return e.manifestKeyPrefix + string(snapID)
+}
+
+func (e *DefaultEnumerator) manifestChunkKey(snapID api.SnapID, n int) string {
+	return fmt.Sprintf("%s/%d", e.manifestKey(snapID), n)
+}
+
+func (e *DefaultEnumerator) manifestChunksKey(snapID api.SnapID) string {
+	return e.manifestKey(snapID) + "/chunks"
+}
+
+// getManifest returns the manifest recorded for snapID.
+// Errors kvdb.ErrNotFound may be returned.
+func (e *DefaultEnumerator) getManifest(snapID api.SnapID) (diff.Manifest, error) {
+	var chunks int
+	if _, err := e.kvdb.GetVal(e.manifestChunksKey(snapID), &chunks); err != nil {
+		return nil, err
+	}
+	m := make(diff.Manifest)
+	for n := 0; n < chunks; n++ {
+		var chunk diff.Manifest
+		if _, err := e.kvdb.GetVal(e.manifestChunkKey(snapID, n), &chunk); err != nil {
+			return nil, err
+		}
+		for path, sum := range chunk {
+			m[path] = sum
+		}
+	}
+	return m, nil
+}
+
+// putManifest records m for snapID.
+func (e *DefaultEnumerator) putManifest(snapID api.SnapID, m diff.Manifest) error {
+	// Earlier versions kept the manifest in a single value at manifestKey.
+	e.kvdb.Delete(e.manifestKey(snapID))
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	chunks := 0
+	chunk := make(diff.Manifest)
+	size := 0
+	flush := func() error {
+		if _, err := e.kvdb.Put(e.manifestChunkKey(snapID, chunks), chunk, 0); err != nil {
+			return err
+		}
+		chunks++
+		chunk = make(diff.Manifest)
+		size = 0
+		return nil
+	}
+	for _, path := range paths {
+		// The JSON encoding of an entry, quotes and separators included.
+		n := len(path) + len(m[path]) + 6
+		if size+n > manifestChunk && len(chunk) > 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		chunk[path] = m[path]
+		size += n
+	}
+	if len(chunk) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	_, err := e.kvdb.Put(e.manifestChunksKey(snapID), chunks, 0)
+	return err
+}
+
+// deleteManifest removes the manifest recorded for snapID, including those
+// recorded in a single value by earlier versions.
+func (e *DefaultEnumerator) deleteManifest(snapID api.SnapID) {
+	e.kvdb.DeleteTree(e.manifestKey(snapID) + "/")
+	e.kvdb.Delete(e.manifestKey(snapID))
+}
+
+// FingerprintTree fingerprints volumeID, whose files are the tree at dir,
+// for drivers that keep volumes and snapshots as directories. If base is set
+// baseDir is the tree of snapshot base: files unchanged since reuse the
+// hashes recorded for the snapshot, which are computed on first use.
+// Errors ErrEinval may be returned if base is not a snapshot of volumeID.
+func (e *DefaultEnumerator) FingerprintTree(volumeID api.VolumeID,
+	dir string,
+	base api.SnapID,
+	baseDir string) (*api.Fingerprint, error) {
+	var m diff.Manifest
+	if base != "" {
+		snap, err := getSnap(e, base)
+		if err != nil {
+			return nil, err
+		}
+		if snap.VolumeID != volumeID {
+			return nil, ErrEinval
+		}
+		// Snapshots do not change, their manifest is kept until they
+		// are deleted.
+		if m, err = e.getManifest(base); err == kvdb.ErrNotFound {
+			if _, m, _, err = diff.Fingerprint(baseDir, "", nil); err != nil {
+				return nil, err
+			}
+			err = e.putManifest(base, m)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	sum, _, stats, err := diff.Fingerprint(dir, baseDir, m)
+	if err != nil {
+		return nil, err
+	}
+	return &api.Fingerprint{
+		VolumeID:  volumeID,
+		Algorithm: api.FingerprintTree,
+		Sum:       sum,
+		Base:      base,
+		Hashed:    stats.Hashed,
+		Reused:    stats.Reused,
+		Computed:  time.Now(),
+	}, nil
+}
+
+// FingerprintFile fingerprints volumeID, whose data is the image file or
+// device at path, for block drivers.
+func FingerprintFile(volumeID api.VolumeID, path string) (*api.Fingerprint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return &api.Fingerprint{
+		VolumeID:  volumeID,
+		Algorithm: api.FingerprintSHA256,
+		Sum:       hex.EncodeToString(h.Sum(nil)),
+		Hashed:    1,
+		Computed:  time.Now(),
+	}, nil
+}
@@ -0,0 +1,186 @@
+package volume
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+)
+
+// killGrace is how long processes are given to exit after SIGTERM before
+// they are sent SIGKILL.
+var killGrace = 10 * time.Second
+
+// ForceDetacher is implemented by drivers that can release a volume that is
+// still in use, such as block drivers that remove their devices while they
+// are open. Use ForceUnmount and ForceDetach to release a volume of any
+// driver.
+type ForceDetacher interface {
+	// ForceUnmount unmounts volumeID from mountpath as options allow.
+	// Errors ErrEnoEnt may be returned.
+	ForceUnmount(volumeID api.VolumeID, mountpath string, options *api.DetachOptions) error
+	// ForceDetach detaches volumeID as options allow.
+	// Errors ErrEnoEnt may be returned.
+	ForceDetach(volumeID api.VolumeID, options *api.DetachOptions) error
+}
+
+// ForceUnmount unmounts a volume of d from mountpath, first terminating the
+// processes using it if options.Kill is set and mountpath is a mount of the
+// volume. Drivers that do not implement ForceDetacher unmount as usual,
+// options.Force only applies to drivers that implement it.
+// Errors ErrEnoEnt, ErrNotMounted may be returned.
+func ForceUnmount(ctx context.Context,
+	d VolumeDriver,
+	volumeID api.VolumeID,
+	mountpath string,
+	options *api.DetachOptions) error {
+	if options == nil {
+		options = &api.DetachOptions{}
+	}
+	if fd, ok := d.(ForceDetacher); ok {
+		return RunContext(ctx, func() error { return fd.ForceUnmount(volumeID, mountpath, options) })
+	}
+	if options.Kill {
+		if err := checkMounted(d, volumeID, mountpath); err != nil {
+			return err
+		}
+		if err := KillUsers(mountpath); err != nil {
+			return err
+		}
+	}
+	return UnmountCtx(ctx, d, volumeID, mountpath)
+}
+
+// ForceDetach detaches a volume of d that may still be mounted. The mounts
+// of the volume are released as Release does and the mount recorded by the
+// driver is unmounted before the volume is detached.
+// Errors ErrEnoEnt may be returned.
+func ForceDetach(ctx context.Context,
+	d VolumeDriver,
+	volumeID api.VolumeID,
+	options *api.DetachOptions) error {
+	if options == nil {
+		options = &api.DetachOptions{}
+	}
+	if fd, ok := d.(ForceDetacher); ok {
+		return RunContext(ctx, func() error { return fd.ForceDetach(volumeID, options) })
+	}
+	if err := Release(d, volumeID, options); err != nil {
+		return err
+	}
+	vols, err := d.Inspect([]api.VolumeID{volumeID})
+	if err != nil {
+		return err
+	}
+	if len(vols) != 1 {
+		return ErrEnoEnt
+	}
+	if vols[0].AttachPath != "" {
+		if err = UnmountCtx(ctx, d, volumeID, vols[0].AttachPath); err != nil {
+			return err
+		}
+	}
+	return DetachCtx(ctx, d, volumeID)
+}
+
+// Release frees the mounts of a volume of d so that it can be detached. The
+// processes using the volume are terminated if options.Kill is set and the
+// mounts the driver did not record, such as bind mounts made by container
+// runtimes, are lazily unmounted if options.Force is set. The mount recorded
+// by the driver is left for the driver to unmount.
+// Errors ErrEnoEnt may be returned.
+func Release(d VolumeDriver, volumeID api.VolumeID, options *api.DetachOptions) error {
+	mounts, err := Mounts(d, volumeID)
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		if options.Kill {
+			if err = KillUsers(m.Path); err != nil {
+				return err
+			}
+		}
+		if options.Force && !m.Recorded {
+			if err = LazyUnmount(m.Path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UnmountPath unmounts the filesystem mounted at path, first terminating the
+// processes using it if options.Kill is set and lazily if options.Force is
+// set. Drivers use it to implement ForceUnmount.
+func UnmountPath(path string, options *api.DetachOptions) error {
+	if options.Kill {
+		if err := KillUsers(path); err != nil {
+			return err
+		}
+	}
+	if options.Force {
+		return LazyUnmount(path)
+	}
+	return syscall.Unmount(path, 0)
+}
+
+// LazyUnmount detaches the filesystem mounted at path from the mount table.
+// The filesystem is released once it is no longer in use. It is not an error
+// if nothing is mounted at path.
+func LazyUnmount(path string) error {
+	err := syscall.Unmount(path, syscall.MNT_DETACH)
+	if err == syscall.EINVAL || err == syscall.ENOENT {
+		return nil
+	}
+	return err
+}
+
+// KillUsers terminates the processes using files under path, a mount point
+// or a device. Processes are sent SIGTERM and then SIGKILL if they have not
+// exited after a grace period.
+func KillUsers(path string) error {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		path = p
+	}
+	users, err := fs.Users(path)
+	if err != nil {
+		return err
+	}
+	var pids []int
+	for _, p := range users {
+		if p.Pid == os.Getpid() {
+			continue
+		}
+		log.Warnf("Terminating process %d (%s) using %s", p.Pid, p.Command, path)
+		if err = syscall.Kill(p.Pid, syscall.SIGTERM); err == nil {
+			pids = append(pids, p.Pid)
+		}
+	}
+	deadline := time.Now().Add(killGrace)
+	for len(pids) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		pids = alive(pids)
+	}
+	for _, pid := range pids {
+		log.Warnf("Killing process %d using %s", pid, path)
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+	return nil
+}
+
+// alive returns the processes of pids that have not exited.
+func alive(pids []int) []int {
+	var left []int
+	for _, pid := range pids {
+		if syscall.Kill(pid, 0) != syscall.ESRCH {
+			left = append(left, pid)
+		}
+	}
+	return left
+}
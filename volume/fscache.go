@@ -0,0 +1,64 @@
+package volume
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+)
+
+// FscacheLayer layer caching the volumes of network drivers on local disks
+// with FS-Cache, such as "layers: fscache" over the nfs driver. The cache is
+// served by cachefilesd, which must be running on the node.
+const FscacheLayer = "fscache"
+
+// procFscache exists once the kernel supports FS-Cache.
+var procFscache = "/proc/fs/fscache"
+
+// fscacheLayer mounts volumes with the "fsc" option.
+type fscacheLayer struct{}
+
+func newFscacheLayer(params DriverParams) (Layer, error) {
+	if _, err := os.Stat(procFscache); err != nil {
+		return nil, fmt.Errorf("FS-Cache is not supported on this node: %v", err)
+	}
+	return fscacheLayer{}, nil
+}
+
+func (fscacheLayer) String() string {
+	return FscacheLayer
+}
+
+func (fscacheLayer) MountOptions(v *api.Volume) []string {
+	return []string{"fsc"}
+}
+
+// Mounted fails if the mount of v at mountpath is not cached, which the
+// drivers that ignore the mount options of layers do not.
+func (fscacheLayer) Mounted(v *api.Volume, mountpath string) error {
+	table, err := fs.MountTable()
+	if err != nil {
+		return err
+	}
+	for _, m := range table {
+		if m.Path != mountpath {
+			continue
+		}
+		for _, o := range strings.Split(m.Options+","+m.SuperOptions, ",") {
+			if o == "fsc" {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("Volume %v is not mounted with FS-Cache at %s", v.ID, mountpath)
+}
+
+func (fscacheLayer) Unmounting(volumeID api.VolumeID, mountpath string) error {
+	return nil
+}
+
+func init() {
+	RegisterLayer(FscacheLayer, newFscacheLayer)
+}
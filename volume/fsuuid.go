@@ -0,0 +1,119 @@
+package volume
+
+import (
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/mkfs"
+)
+
+// fsUUID returns the UUID of the filesystem on a device. It is replaced in
+// tests.
+var fsUUID = mkfs.UUID
+
+// recordFsUUID records the UUID of the filesystem formatted on volumeID in
+// the FsUUID of the volume, and that of the device of the driver in its
+// OriginUUID, if d implements Store, so that attaches may check they present
+// the device of the volume. Failures are logged: the format itself
+// succeeded.
+func recordFsUUID(d interface{}, volumeID api.VolumeID) {
+	store, ok := d.(Store)
+	if !ok {
+		return
+	}
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		log.Warnf("Failed to record the filesystem of volume %v: %v", volumeID, err)
+		return
+	}
+	defer store.Unlock(token)
+
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		log.Warnf("Failed to record the filesystem of volume %v: %v", volumeID, err)
+		return
+	}
+	if v.DevicePath == "" {
+		return
+	}
+	uuid, err := fsUUID(TopDevice(d, volumeID, v.DevicePath))
+	if err != nil || uuid == "" {
+		log.Warnf("Failed to record the filesystem of volume %v: %v", volumeID, err)
+		return
+	}
+	origin, err := fsUUID(v.DevicePath)
+	if err != nil || origin == "" {
+		log.Warnf("Failed to record the origin of volume %v: %v", volumeID, err)
+		origin = v.OriginUUID
+	}
+	if v.FsUUID == uuid && v.OriginUUID == origin {
+		return
+	}
+	v.FsUUID, v.OriginUUID = uuid, origin
+	if err = store.UpdateVol(v); err != nil {
+		log.Warnf("Failed to record the filesystem of volume %v: %v", volumeID, err)
+	}
+}
+
+// checkOrigin fails with ErrWrongDevice if device, attached by d for
+// volumeID, does not hold the signature recorded for the volume, and detaches
+// it. It runs before the layers are assembled over the device, which may
+// write to it. Volumes formatted before their origin was recorded are checked
+// against their filesystem if no layer of theirs changes the signature of the
+// device.
+func checkOrigin(d BlockDriver, volumeID api.VolumeID, device string) error {
+	v := layerVolume(d, volumeID)
+	want := v.OriginUUID
+	if want == "" {
+		for _, l := range v.Layers {
+			if l != CacheLayer {
+				return nil
+			}
+		}
+		want = v.FsUUID
+	}
+	if want == "" {
+		return nil
+	}
+	uuid, err := fsUUID(device)
+	if err == nil && uuid == want {
+		return nil
+	}
+	if err != nil {
+		log.Warnf("Failed to check the origin of volume %v on %s: %v", volumeID, device, err)
+	} else {
+		log.Warnf("Volume %v attached at %s holds %q, not %q", volumeID, device, uuid, want)
+	}
+	if derr := d.Detach(volumeID); derr != nil {
+		log.Warnf("Failed to detach volume %v: %v", volumeID, derr)
+	}
+	return ErrWrongDevice
+}
+
+// checkFsUUID fails with ErrWrongDevice if the device attached at path does
+// not hold the filesystem recorded for volumeID, as when device names are
+// reshuffled on reboot, and detaches it. Volumes without a recorded
+// filesystem are not checked.
+func checkFsUUID(d BlockDriver, volumeID api.VolumeID, path string) error {
+	v := layerVolume(d, volumeID)
+	if v.FsUUID == "" {
+		return nil
+	}
+	uuid, err := fsUUID(path)
+	if err == nil && uuid == v.FsUUID {
+		return nil
+	}
+	if err != nil {
+		log.Warnf("Failed to check the filesystem of volume %v on %s: %v", volumeID, path, err)
+	} else {
+		log.Warnf("Volume %v attached at %s holds filesystem %q, not %q",
+			volumeID, path, uuid, v.FsUUID)
+	}
+	if derr := detachLayers(d, volumeID); derr != nil {
+		log.Warnf("Failed to remove the layers of volume %v: %v", volumeID, derr)
+	}
+	if derr := d.Detach(volumeID); derr != nil {
+		log.Warnf("Failed to detach volume %v: %v", volumeID, derr)
+	}
+	return ErrWrongDevice
+}
@@ -0,0 +1,69 @@
+package volume
+
+import (
+	"context"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// fsDriver attaches its volumes at /dev/fs, formatting them is a no-op.
+type fsDriver struct {
+	historyDriver
+	detached int
+}
+
+func (d *fsDriver) String() string { return "fsuuid_test" }
+
+func (d *fsDriver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return "", err
+	}
+	v.DevicePath = "/dev/fs"
+	return v.DevicePath, d.UpdateVol(v)
+}
+
+func (d *fsDriver) Detach(volumeID api.VolumeID) error {
+	d.detached++
+	return nil
+}
+
+func (d *fsDriver) Format(volumeID api.VolumeID) error { return nil }
+
+func TestFsUUID(t *testing.T) {
+	d := &fsDriver{historyDriver: historyDriver{
+		DefaultEnumerator: NewDefaultEnumerator("fsuuid_test", kvdb.Instance()),
+	}}
+	vol := &api.Volume{ID: "fsuuid_test_vol", Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(vol))
+	defer d.DeleteVol(vol.ID)
+	ctx := context.Background()
+
+	uuids := map[string]string{"/dev/fs": "1111"}
+	defer func(f func(string) (string, error)) { fsUUID = f }(fsUUID)
+	fsUUID = func(dev string) (string, error) { return uuids[dev], nil }
+
+	_, err := AttachCtx(ctx, d, vol.ID, nil)
+	assert.NoError(t, err, "Volume without a filesystem checked")
+	assert.NoError(t, FormatCtx(ctx, d, vol.ID))
+	v, err := d.GetVol(vol.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "1111", v.FsUUID)
+
+	_, err = AttachCtx(ctx, d, vol.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, d.detached)
+
+	uuids["/dev/fs"] = "2222"
+	_, err = AttachCtx(ctx, d, vol.ID, nil)
+	assert.Equal(t, ErrWrongDevice, err)
+	assert.Equal(t, 1, d.detached, "Wrong device not detached")
+
+	delete(uuids, "/dev/fs")
+	_, err = AttachCtx(ctx, d, vol.ID, nil)
+	assert.Equal(t, ErrWrongDevice, err, "Device without a filesystem attached")
+}
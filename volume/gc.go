@@ -0,0 +1,227 @@
+package volume
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/events"
+	"github.com/libopenstorage/openstorage/pkg/worker"
+)
+
+const (
+	// GCIntervalParam DriverParams key for the number of hours between
+	// scans for orphaned storage. Orphans are only collected on request if
+	// 0, the default.
+	GCIntervalParam = "gc_interval"
+	// GCPolicyParam DriverParams key for what scans do with orphans, report
+	// (the default) or reclaim.
+	GCPolicyParam = "gc_policy"
+	// GCGraceParam DriverParams key for the number of hours storage must
+	// be left unmodified before it is considered orphaned, 24 by default.
+	// It keeps the garbage collector away from volumes being created.
+	GCGraceParam = "gc_grace"
+	// defaultGCGrace hours storage must be left unmodified.
+	defaultGCGrace = 24
+)
+
+// OrphanFinder is implemented by drivers that can list the storage on their
+// backends that no volume or snapshot references, such as directories in an
+// NFS export or image files. Use GetGC to collect the orphans of a driver.
+type OrphanFinder interface {
+	// Orphans returns the storage no volume or snapshot references.
+	Orphans() ([]api.Orphan, error)
+
+	// ReclaimOrphan removes storage returned by Orphans, unless a volume
+	// or snapshot references it by now.
+	// Errors ErrEinval may be returned if o is not an orphan.
+	ReclaimOrphan(o api.Orphan) error
+}
+
+// GCRequester is implemented by clients that collect the orphans of a remote
+// driver.
+type GCRequester interface {
+	// Orphans returns the orphans of the driver without reclaiming them.
+	// Errors ErrNotSupported may be returned.
+	Orphans() ([]api.Orphan, error)
+
+	// CollectGarbage scans the driver for orphans and reports or reclaims
+	// them according to policy, the policy of the driver if empty.
+	// Errors ErrNotSupported may be returned.
+	CollectGarbage(policy api.GCPolicy) ([]api.Orphan, error)
+}
+
+// GC finds the storage of a driver that no volume references and reports or
+// reclaims it. Reported orphans are logged and published as
+// EventOrphanFound.
+type GC struct {
+	name     string
+	finder   OrphanFinder
+	pool     *worker.Pool
+	interval time.Duration
+	grace    time.Duration
+	policy   api.GCPolicy
+	stop     func()
+}
+
+func newGC(name string,
+	d VolumeDriver,
+	pool *worker.Pool,
+	params DriverParams) (*GC, error) {
+
+	finder, ok := d.(OrphanFinder)
+	if !ok {
+		return nil, nil
+	}
+	hours, err := intParam(params, GCIntervalParam, 0)
+	if err != nil {
+		return nil, err
+	}
+	grace, err := intParam(params, GCGraceParam, defaultGCGrace)
+	if err != nil {
+		return nil, err
+	}
+	policy := api.GCPolicy(params[GCPolicyParam])
+	switch policy {
+	case "":
+		policy = api.GCReport
+	case api.GCReport, api.GCReclaim:
+	default:
+		return nil, fmt.Errorf("Invalid value %q for %s", policy, GCPolicyParam)
+	}
+	return &GC{
+		name:     name,
+		finder:   finder,
+		pool:     pool,
+		interval: time.Duration(hours) * time.Hour,
+		grace:    time.Duration(grace) * time.Hour,
+		policy:   policy,
+	}, nil
+}
+
+// GetGC returns the garbage collector of the named driver.
+// Errors ErrNotSupported may be returned if the driver cannot find orphans.
+func GetGC(name string) (*GC, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if g, ok := gcs[name]; ok {
+		return g, nil
+	}
+	return nil, ErrNotSupported
+}
+
+// Orphans returns the orphans of the driver that have been left unmodified
+// for the grace period.
+func (g *GC) Orphans() ([]api.Orphan, error) {
+	found, err := g.finder.Orphans()
+	if err != nil {
+		return nil, err
+	}
+	orphans := make([]api.Orphan, 0, len(found))
+	for _, o := range found {
+		if time.Since(o.Mtime) >= g.grace {
+			orphans = append(orphans, o)
+		}
+	}
+	return orphans, nil
+}
+
+// Collect reports or reclaims the orphans of the driver according to
+// policy, the policy of the driver if empty. Orphans that fail to be
+// reclaimed are returned with Reclaimed unset.
+func (g *GC) Collect(policy api.GCPolicy) ([]api.Orphan, error) {
+	if policy == "" {
+		policy = g.policy
+	}
+	orphans, err := g.Orphans()
+	if err != nil {
+		return nil, err
+	}
+	for i := range orphans {
+		o := &orphans[i]
+		if policy == api.GCReclaim {
+			if err = g.finder.ReclaimOrphan(*o); err == nil {
+				log.Infof("%s: reclaimed orphan %s (%d bytes)", g.name, o.ID, o.Size)
+				o.Reclaimed = true
+				continue
+			}
+			log.Warnf("%s: failed to reclaim orphan %s: %v", g.name, o.ID, err)
+		}
+		log.Warnf("%s: found orphan %s (%d bytes) last modified at %v", g.name, o.ID, o.Size, o.Mtime)
+		events.Publish(api.Event{
+			Type:    api.EventOrphanFound,
+			Driver:  g.name,
+			Message: o.ID,
+		})
+	}
+	return orphans, nil
+}
+
+// start scans for orphans periodically. Drivers may share their backends
+// across nodes, only one node scans the backends of a driver.
+func (g *GC) start() {
+	if g.interval <= 0 {
+		return
+	}
+	g.stop = singleton("gc/"+g.name, func(stop <-chan struct{}) {
+		tick := time.NewTicker(g.interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				err := g.pool.Submit(func() {
+					if _, err := g.Collect(""); err != nil {
+						log.Warnf("%s: failed to scan for orphans: %v", g.name, err)
+					}
+				})
+				if err != nil {
+					log.Warnf("%s: skipping scan for orphans: %v", g.name, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	})
+}
+
+func (g *GC) shutdown() {
+	if g.stop != nil {
+		g.stop()
+	}
+}
+
+// OrphansIn returns the entries of dir that referenced does not keep, for
+// drivers that keep each volume in an entry of a directory. Hidden entries
+// and lost+found are skipped.
+func OrphansIn(dir string, backend string, referenced func(name string) bool) ([]api.Orphan, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []api.Orphan
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") || name == "lost+found" || referenced(name) {
+			continue
+		}
+		p := path.Join(dir, name)
+		size := uint64(e.Size())
+		if e.IsDir() {
+			if size, err = DirUsage(p); err != nil {
+				log.Warnf("Unable to size orphan %s: %v", p, err)
+			}
+		}
+		orphans = append(orphans, api.Orphan{
+			ID:      p,
+			Backend: backend,
+			Size:    size,
+			Mtime:   e.ModTime(),
+		})
+	}
+	return orphans, nil
+}
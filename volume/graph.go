@@ -0,0 +1,98 @@
+package volume
+
+import (
+	"sync"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+var (
+	backupsLock sync.Mutex
+	backups     func(volumeID api.VolumeID) ([]api.CloudSnap, error)
+)
+
+// SetBackups sets the function returning the cloud snapshots of a volume.
+// Graphs do not list backups if it is not set.
+func SetBackups(list func(volumeID api.VolumeID) ([]api.CloudSnap, error)) {
+	backupsLock.Lock()
+	defer backupsLock.Unlock()
+	backups = list
+}
+
+// Graph returns the dependency graph for volumeID. If e implements Grapher
+// it is used, otherwise the graph is built from e's snapshot and volume
+// enumeration.
+// Errors ErrEnoEnt may be returned.
+func Graph(e Enumerator, volumeID api.VolumeID) (*api.VolumeGraph, error) {
+	if g, ok := e.(Grapher); ok {
+		return g.Graph(volumeID)
+	}
+	vols, err := e.Inspect([]api.VolumeID{volumeID})
+	if err != nil {
+		return nil, err
+	}
+	if len(vols) != 1 {
+		return nil, ErrEnoEnt
+	}
+	all, err := e.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	clones := make(map[api.SnapID][]api.Volume)
+	for _, v := range all {
+		if v.Parent != api.BadSnapID {
+			clones[v.Parent] = append(clones[v.Parent], v)
+		}
+	}
+	visited := make(map[api.VolumeID]bool)
+	return buildGraph(e, &vols[0], clones, visited)
+}
+
+func buildGraph(e Enumerator,
+	vol *api.Volume,
+	clones map[api.SnapID][]api.Volume,
+	visited map[api.VolumeID]bool) (*api.VolumeGraph, error) {
+
+	visited[vol.ID] = true
+	g := &api.VolumeGraph{
+		Volume:     *vol,
+		ReplicaSet: vol.ReplicaSet,
+		Snaps:      make([]api.SnapGraph, 0),
+		Backups:    make([]api.CloudSnap, 0),
+		Exports:    vol.Exports,
+	}
+	if g.Exports == nil {
+		g.Exports = make([]api.VolumeExport, 0)
+	}
+	backupsLock.Lock()
+	list := backups
+	backupsLock.Unlock()
+	if list != nil {
+		b, err := list(vol.ID)
+		if err != nil {
+			return nil, err
+		}
+		g.Backups = append(g.Backups, b...)
+	}
+	snaps, err := e.SnapEnumerate([]api.VolumeID{vol.ID}, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snaps {
+		sg := api.SnapGraph{Snap: s, Clones: make([]api.VolumeGraph, 0)}
+		for i := range clones[s.ID] {
+			clone := &clones[s.ID][i]
+			// Guard against cycles in corrupt metadata.
+			if visited[clone.ID] {
+				continue
+			}
+			cg, err := buildGraph(e, clone, clones, visited)
+			if err != nil {
+				return nil, err
+			}
+			sg.Clones = append(sg.Clones, *cg)
+		}
+		g.Snaps = append(g.Snaps, sg)
+	}
+	return g, nil
+}
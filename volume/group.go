@@ -0,0 +1,124 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pborman/uuid"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+)
+
+// GroupFreezeTimeout bounds how long the filesystems of a group stay frozen
+// while its volumes are snapshotted.
+var GroupFreezeTimeout = 30 * time.Second
+
+// GroupSnapshotter is implemented by drivers that snapshot the volumes of a
+// group atomically. Use SnapshotGroup to snapshot the group of any driver.
+type GroupSnapshotter interface {
+	// SnapshotGroup snapshots every volume in group with labels and
+	// returns the snaps by volume.
+	// Errors ErrEnoEnt may be returned if the group has no volumes.
+	SnapshotGroup(group string, labels api.Labels) (map[api.VolumeID]api.SnapID, error)
+}
+
+// SnapshotGroup snapshots every volume of d in group. The snaps share
+// labels with GroupLabel set to group and GroupSnapLabel set to an ID
+// unique to this group snapshot. Drivers that implement GroupSnapshotter
+// snapshot the group atomically. For other drivers the filesystems of
+// mounted block volumes are frozen while their volumes are snapshotted one
+// after the other, which is crash consistent across the group. Snaps
+// already taken are deleted if a volume fails to snapshot.
+// Errors ErrEnoEnt, ErrEinval may be returned.
+func SnapshotGroup(ctx context.Context,
+	d VolumeDriver,
+	group string,
+	labels api.Labels) (map[api.VolumeID]api.SnapID, error) {
+
+	if group == "" {
+		return nil, ErrEinval
+	}
+	snapLabels := api.Labels{
+		api.GroupLabel:     group,
+		api.GroupSnapLabel: strings.TrimSuffix(uuid.New(), "\n"),
+	}
+	for k, v := range labels {
+		snapLabels[k] = v
+	}
+	if gs, ok := d.(GroupSnapshotter); ok {
+		return gs.SnapshotGroup(group, snapLabels)
+	}
+
+	vols, err := EnumerateCtx(ctx, d, api.VolumeLocator{Group: group}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(vols) == 0 {
+		return nil, ErrEnoEnt
+	}
+
+	frozen := quiesce(d, vols)
+	defer thaw(frozen)
+	if len(frozen) > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, GroupFreezeTimeout)
+		defer cancel()
+	}
+
+	snaps := make(map[api.VolumeID]api.SnapID, len(vols))
+	for _, v := range vols {
+		id, err := SnapshotCtx(ctx, d, v.ID, snapLabels, false)
+		if err == nil {
+			snaps[v.ID] = id
+			continue
+		}
+		for volID, snapID := range snaps {
+			if derr := d.SnapDelete(snapID); derr != nil {
+				log.Warnf("Failed to delete snap %v of volume %v of group %s: %v",
+					snapID, volID, group, derr)
+			}
+		}
+		return nil, fmt.Errorf("Failed to snapshot volume %v of group %s: %v", v.ID, group, err)
+	}
+	return snaps, nil
+}
+
+// quiesce flushes the filesystems of vols to disk. The filesystems of block
+// volumes mounted on this node are frozen, it returns their mount paths.
+// The filesystems of file volumes are not frozen, the driver snapshots them
+// by writing to the same filesystem.
+func quiesce(d ProtoDriver, vols []api.Volume) []string {
+	syscall.Sync()
+	if d.Type()&Block == 0 {
+		return nil
+	}
+	var frozen []string
+	for _, v := range vols {
+		if v.AttachPath == "" {
+			continue
+		}
+		if _, err := os.Stat(v.AttachPath); err != nil {
+			continue
+		}
+		if err := fs.Freeze(v.AttachPath); err != nil {
+			log.Warnf("Snapshot of volume %v may not be consistent: %v", v.ID, err)
+			continue
+		}
+		frozen = append(frozen, v.AttachPath)
+	}
+	return frozen
+}
+
+func thaw(frozen []string) {
+	for i := len(frozen) - 1; i >= 0; i-- {
+		if err := fs.Thaw(frozen[i]); err != nil {
+			log.Errorf("Failed to thaw %s: %v", frozen[i], err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package volume
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type groupDriver struct {
+	ProtoDriver
+	*DefaultEnumerator
+	NotSupportedBlockDriver
+	snaps  map[api.SnapID]api.Labels
+	failOn api.VolumeID
+}
+
+func (d *groupDriver) String() string {
+	return "group_test"
+}
+
+func (d *groupDriver) Type() DriverType {
+	return File
+}
+
+func (d *groupDriver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	if volumeID == d.failOn {
+		return api.BadSnapID, errors.New("snapshot failed")
+	}
+	id := api.SnapID("snap-" + string(volumeID))
+	d.snaps[id] = labels
+	return id, nil
+}
+
+func (d *groupDriver) SnapDelete(snapID api.SnapID) error {
+	delete(d.snaps, snapID)
+	return nil
+}
+
+func TestSnapshotGroup(t *testing.T) {
+	d := &groupDriver{DefaultEnumerator: e, snaps: make(map[api.SnapID]api.Labels)}
+	for _, id := range []api.VolumeID{"TestGroupData", "TestGroupLog"} {
+		err := e.CreateVol(&api.Volume{
+			ID:      id,
+			Locator: api.VolumeLocator{Name: string(id), Group: "TestGroup"},
+			State:   api.VolumeAvailable,
+			Spec:    &api.VolumeSpec{},
+		})
+		assert.NoError(t, err, "Failed in CreateVol")
+	}
+
+	_, err := SnapshotGroup(context.Background(), d, "TestEmptyGroup", nil)
+	assert.Equal(t, ErrEnoEnt, err, "Empty group should not be snapshotted")
+
+	snaps, err := SnapshotGroup(context.Background(), d, "TestGroup", api.Labels{"app": "db"})
+	assert.NoError(t, err, "Failed to snapshot group")
+	assert.Equal(t, 2, len(snaps), "Every volume of the group should be snapshotted")
+	groupSnap := d.snaps[snaps["TestGroupData"]][api.GroupSnapLabel]
+	assert.NotEqual(t, "", groupSnap, "Snaps should be labelled with the group snapshot")
+	for _, id := range snaps {
+		labels := d.snaps[id]
+		assert.Equal(t, "TestGroup", labels[api.GroupLabel], "Snaps should be labelled with the group")
+		assert.Equal(t, groupSnap, labels[api.GroupSnapLabel], "Snaps should share the group snapshot")
+		assert.Equal(t, "db", labels["app"], "Snaps should carry the requested labels")
+		d.SnapDelete(id)
+	}
+
+	// A failed snapshot rolls back the snaps of the other volumes.
+	d.failOn = "TestGroupLog"
+	_, err = SnapshotGroup(context.Background(), d, "TestGroup", nil)
+	assert.Error(t, err, "Group snapshot should fail")
+	assert.Equal(t, 0, len(d.snaps), "Snaps of a failed group snapshot should be deleted")
+}
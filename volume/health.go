@@ -0,0 +1,123 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// HealthTimeout bounds the health check of a driver. Drivers that do not
+// answer in time, such as those stuck on a hung NFS mount, are down.
+const HealthTimeout = 10 * time.Second
+
+var healthRank = map[api.HealthState]int{
+	api.HealthOK:       0,
+	api.HealthDegraded: 1,
+	api.HealthDown:     2,
+}
+
+// WorstHealth returns the worst of states, HealthOK if there are none.
+func WorstHealth(states ...api.HealthState) api.HealthState {
+	worst := api.HealthOK
+	for _, s := range states {
+		if healthRank[s] > healthRank[worst] {
+			worst = s
+		}
+	}
+	return worst
+}
+
+// CheckHealth runs the health checks of d, registered as name.
+func CheckHealth(ctx context.Context, name string, d ProtoDriver) api.DriverHealth {
+	ctx, cancel := context.WithTimeout(ctx, HealthTimeout)
+	defer cancel()
+	h := api.DriverHealth{Driver: name, Time: time.Now()}
+	done := make(chan []api.HealthReason, 1)
+	go func() {
+		done <- d.HealthCheck()
+	}()
+	select {
+	case h.Reasons = <-done:
+	case <-ctx.Done():
+		h.Reasons = []api.HealthReason{{
+			Check:   "timeout",
+			State:   api.HealthDown,
+			Message: fmt.Sprintf("Health check did not complete: %v", ctx.Err()),
+		}}
+	}
+	states := make([]api.HealthState, len(h.Reasons))
+	for i, r := range h.Reasons {
+		states[i] = r.State
+	}
+	h.State = WorstHealth(states...)
+	return h
+}
+
+// Health runs the health checks of all started drivers concurrently.
+func Health(ctx context.Context) api.HealthResponse {
+	names := Instances()
+	resp := api.HealthResponse{Drivers: make([]api.DriverHealth, len(names))}
+	var wg sync.WaitGroup
+	for i, name := range names {
+		d, err := Get(name)
+		if err != nil {
+			resp.Drivers[i] = api.DriverHealth{Driver: name, State: api.HealthDown, Time: time.Now(),
+				Reasons: []api.HealthReason{{Check: "driver", State: api.HealthDown, Message: err.Error()}}}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string, d ProtoDriver) {
+			defer wg.Done()
+			resp.Drivers[i] = CheckHealth(ctx, name, d)
+		}(i, name, d)
+	}
+	wg.Wait()
+	states := make([]api.HealthState, len(resp.Drivers))
+	for i, h := range resp.Drivers {
+		states[i] = h.State
+	}
+	resp.State = WorstHealth(states...)
+	return resp
+}
+
+// CheckDir verifies that dir, a directory volumes are kept in, exists and is
+// writable and, if mountpoint is true, that a filesystem is mounted on it.
+// Failures are reported with state.
+func CheckDir(dir string, mountpoint bool, state api.HealthState) []api.HealthReason {
+	fail := func(check string, err error) []api.HealthReason {
+		return []api.HealthReason{{Check: check, State: state, Message: err.Error()}}
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return fail("exists", err)
+	}
+	if mountpoint {
+		parent, err := os.Stat(filepath.Dir(dir))
+		if err != nil {
+			return fail("mount", err)
+		}
+		if fi.Sys().(*syscall.Stat_t).Dev == parent.Sys().(*syscall.Stat_t).Dev {
+			return fail("mount", fmt.Errorf("%s is not mounted", dir))
+		}
+	}
+	f, err := ioutil.TempFile(dir, ".osd-health-")
+	if err != nil {
+		return fail("writable", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write([]byte("ok"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fail("writable", err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestWorstHealth(t *testing.T) {
+	assert.Equal(t, api.HealthOK, WorstHealth())
+	assert.Equal(t, api.HealthDegraded, WorstHealth(api.HealthOK, api.HealthDegraded))
+	assert.Equal(t, api.HealthDown, WorstHealth(api.HealthDown, api.HealthDegraded))
+}
+
+func TestCheckDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "health")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Empty(t, CheckDir(dir, false, api.HealthDown))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files, "probe file removed")
+
+	reasons := CheckDir(dir, true, api.HealthDegraded)
+	assert.Len(t, reasons, 1)
+	assert.Equal(t, "mount", reasons[0].Check)
+	assert.Equal(t, api.HealthDegraded, reasons[0].State)
+
+	reasons = CheckDir(filepath.Join(dir, "missing"), false, api.HealthDown)
+	assert.Len(t, reasons, 1)
+	assert.Equal(t, "exists", reasons[0].Check)
+}
@@ -0,0 +1,80 @@
+package volume
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// MaxUsageHistory is the number of usage events retained per volume.
+const MaxUsageHistory = 16
+
+// Historian is implemented by drivers that keep the usage history of their
+// volumes natively, and by clients of remote drivers. Use History to get
+// the usage history of the volumes of any driver.
+type Historian interface {
+	// History returns the latest attaches, detaches, mounts and unmounts
+	// of volumeID, oldest first.
+	// Errors ErrEnoEnt may be returned.
+	History(volumeID api.VolumeID) ([]api.UsageEvent, error)
+}
+
+// History returns the latest attaches, detaches, mounts and unmounts of
+// volumeID of d, oldest first, to find where the volume was last used.
+// Only the operations that went through AttachCtx, DetachCtx, MountCtx and
+// UnmountCtx on drivers that implement Store are recorded.
+// Errors ErrEnoEnt may be returned.
+func History(d VolumeDriver, volumeID api.VolumeID) ([]api.UsageEvent, error) {
+	if h, ok := d.(Historian); ok {
+		return h.History(volumeID)
+	}
+	vols, err := d.Inspect([]api.VolumeID{volumeID})
+	if err != nil {
+		return nil, err
+	}
+	if len(vols) != 1 {
+		return nil, ErrEnoEnt
+	}
+	if vols[0].UsageHistory == nil {
+		return []api.UsageEvent{}, nil
+	}
+	return vols[0].UsageHistory, nil
+}
+
+// recordUsage appends op on this node to the usage history of volumeID if
+// d implements Store. Failures are logged: the operation itself succeeded.
+func recordUsage(d interface{}, volumeID api.VolumeID, op api.UsageOp, path string) {
+	store, ok := d.(Store)
+	if !ok {
+		return
+	}
+	if _, ok := d.(Historian); ok {
+		return
+	}
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		log.Warnf("Failed to record %s of volume %v: %v", op, volumeID, err)
+		return
+	}
+	defer store.Unlock(token)
+
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		log.Warnf("Failed to record %s of volume %v: %v", op, volumeID, err)
+		return
+	}
+	v.UsageHistory = append(v.UsageHistory, api.UsageEvent{
+		Op:   op,
+		Node: NodeID(),
+		Path: path,
+		Time: time.Now(),
+	})
+	if n := len(v.UsageHistory); n > MaxUsageHistory {
+		v.UsageHistory = v.UsageHistory[n-MaxUsageHistory:]
+	}
+	if err = store.UpdateVol(v); err != nil {
+		log.Warnf("Failed to record %s of volume %v: %v", op, volumeID, err)
+	}
+}
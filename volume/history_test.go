@@ -0,0 +1,65 @@
+package volume
+
+import (
+	"context"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type historyDriver struct {
+	ProtoDriver
+	*DefaultEnumerator
+	NotSupportedBlockDriver
+}
+
+func (d *historyDriver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	return "/dev/history", nil
+}
+
+func (d *historyDriver) Detach(volumeID api.VolumeID) error                    { return nil }
+func (d *historyDriver) Mount(volumeID api.VolumeID, mountpath string) error   { return nil }
+func (d *historyDriver) Unmount(volumeID api.VolumeID, mountpath string) error { return nil }
+
+func TestHistory(t *testing.T) {
+	d := &historyDriver{DefaultEnumerator: NewDefaultEnumerator("history_test", kvdb.Instance())}
+	vol := &api.Volume{ID: "history_test_vol", Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(vol))
+	defer d.DeleteVol(vol.ID)
+	ctx := context.Background()
+
+	events, err := History(d, vol.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	_, err = History(d, "history_test_missing")
+	assert.Error(t, err)
+
+	_, err = AttachCtx(ctx, d, vol.ID, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, MountCtx(ctx, d, vol.ID, "/mnt/history"))
+	assert.NoError(t, UnmountCtx(ctx, d, vol.ID, "/mnt/history"))
+	assert.NoError(t, DetachCtx(ctx, d, vol.ID))
+
+	events, err = History(d, vol.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, api.UsageEvent{
+			Op:   api.UsageAttach,
+			Node: NodeID(),
+			Path: "/dev/history",
+			Time: events[0].Time,
+		}, events[0])
+		assert.Equal(t, api.UsageMount, events[1].Op)
+		assert.Equal(t, "/mnt/history", events[1].Path)
+		assert.Equal(t, api.UsageDetach, events[3].Op)
+	}
+
+	for i := 0; i < MaxUsageHistory; i++ {
+		assert.NoError(t, MountCtx(ctx, d, vol.ID, "/mnt/history"))
+	}
+	events, _ = History(d, vol.ID)
+	assert.Len(t, events, MaxUsageHistory, "History not bounded")
+}
@@ -0,0 +1,212 @@
+package volume
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// Operations that may be hooked.
+const (
+	HookCreate   = "create"
+	HookDelete   = "delete"
+	HookAttach   = "attach"
+	HookSnapshot = "snapshot"
+	HookResize   = "resize"
+	HookTransfer = "transfer"
+)
+
+// Hook is called around the volume operations it is registered for with
+// RegisterHook. Pre hooks veto the operation by returning an error, the
+// errors of post hooks are logged. The same request is given to the pre and
+// post hooks of an operation, post hooks are also called for vetoed
+// operations. Hooks are not called for the operations osd makes on its own,
+// such as filling warm pools.
+type Hook func(ctx context.Context, req *api.HookRequest) error
+
+// HookVetoError is returned by operations a pre hook vetoed.
+type HookVetoError struct {
+	// Hook name.
+	Hook string
+	// Reason the hook gave.
+	Reason string
+}
+
+func (e *HookVetoError) Error() string {
+	return fmt.Sprintf("Vetoed by hook %s: %s", e.Hook, e.Reason)
+}
+
+type registeredHook struct {
+	name   string
+	driver string
+	phase  api.HookPhase
+	ops    map[string]bool
+	hook   Hook
+}
+
+var (
+	hooksLock sync.RWMutex
+	// hooks in the order they are called.
+	hooks []*registeredHook
+)
+
+// RegisterHook registers hook under name, replacing the hook of that name,
+// to be called in phase of ops on the named driver. Hooks apply to all
+// drivers if driver is empty and to all operations if no ops are specified.
+// Hooks are called in the order they are registered.
+func RegisterHook(name string, driver string, phase api.HookPhase, hook Hook, ops ...string) error {
+	if phase != api.HookPre && phase != api.HookPost {
+		return fmt.Errorf("Invalid phase %q of hook %s", phase, name)
+	}
+	h := &registeredHook{name: name, driver: driver, phase: phase, hook: hook}
+	if len(ops) > 0 {
+		h.ops = make(map[string]bool)
+	}
+	for _, op := range ops {
+		switch op {
+		case HookCreate, HookDelete, HookAttach, HookSnapshot:
+			h.ops[op] = true
+		default:
+			return fmt.Errorf("Operation %q of hook %s cannot be hooked", op, name)
+		}
+	}
+	hooksLock.Lock()
+	defer hooksLock.Unlock()
+	for i, r := range hooks {
+		if r.name == name {
+			hooks[i] = h
+			return nil
+		}
+	}
+	hooks = append(hooks, h)
+	return nil
+}
+
+// UnregisterHook removes the hook registered under name.
+func UnregisterHook(name string) {
+	hooksLock.Lock()
+	defer hooksLock.Unlock()
+	for i, r := range hooks {
+		if r.name == name {
+			hooks = append(hooks[:i], hooks[i+1:]...)
+			return
+		}
+	}
+}
+
+// hooksFor returns the hooks of phase of req.
+func hooksFor(phase api.HookPhase, req *api.HookRequest) []*registeredHook {
+	hooksLock.RLock()
+	defer hooksLock.RUnlock()
+	var found []*registeredHook
+	for _, h := range hooks {
+		if h.phase == phase &&
+			(h.driver == "" || h.driver == req.Driver) &&
+			(h.ops == nil || h.ops[req.Op]) {
+			found = append(found, h)
+		}
+	}
+	return found
+}
+
+// internalKey is the context key marking the operations osd makes on its
+// own.
+type internalKey struct{}
+
+// withInternal returns a copy of ctx for the operations osd makes on its own,
+// such as filling warm pools, retention and reaping ephemeral volumes. Hooks
+// are not called for them: a hook being down must not stop osd from
+// maintaining its volumes.
+func withInternal(ctx context.Context) context.Context {
+	return context.WithValue(ctx, internalKey{}, true)
+}
+
+// internal returns whether ctx is that of an operation osd makes on its own.
+func internal(ctx context.Context) bool {
+	i, _ := ctx.Value(internalKey{}).(bool)
+	return i
+}
+
+// preHooks calls the pre hooks of req on d and returns a HookVetoError if
+// one of them fails. The post hooks are called with the veto, so that hooks
+// may release what they reserved for the operation. No hooks are called for
+// internal operations.
+func preHooks(ctx context.Context, d interface{}, req *api.HookRequest) error {
+	if internal(ctx) {
+		return nil
+	}
+	req.Driver, req.Phase = instanceName(d), api.HookPre
+	req.Principal = Principal(ctx)
+	for _, h := range hooksFor(api.HookPre, req) {
+		if err := h.hook(ctx, req); err != nil {
+			log.Infof("Hook %s vetoed %s on %s: %v", h.name, req.Op, req.Driver, err)
+			veto := &HookVetoError{Hook: h.name, Reason: err.Error()}
+			postHooks(ctx, d, req, veto)
+			return veto
+		}
+	}
+	return nil
+}
+
+// postHooks calls the post hooks of req on d once it returned err.
+func postHooks(ctx context.Context, d interface{}, req *api.HookRequest, err error) {
+	if internal(ctx) {
+		return
+	}
+	req.Driver, req.Phase = instanceName(d), api.HookPost
+	if err != nil {
+		req.Error = err.Error()
+	}
+	for _, h := range hooksFor(api.HookPost, req) {
+		if err := h.hook(ctx, req); err != nil {
+			log.Warnf("Hook %s failed after %s on %s: %v", h.name, req.Op, req.Driver, err)
+		}
+	}
+}
+
+// maxVetoReason bytes of the response of a webhook kept as the reason of a
+// veto.
+const maxVetoReason = 1024
+
+// NewWebhook returns a hook that POSTs the api.HookRequest as JSON to url,
+// and fails if the response status is not 2xx, with the response body as the
+// reason, or after timeout.
+func NewWebhook(url string, timeout time.Duration) Hook {
+	client := &http.Client{Timeout: timeout}
+	return func(ctx context.Context, req *api.HookRequest) error {
+		body, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		r, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		r.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(r.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		reason, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxVetoReason))
+		if msg := strings.TrimSpace(string(reason)); msg != "" {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+}
@@ -0,0 +1,91 @@
+package volume
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestHooks(t *testing.T) {
+	noop := func(ctx context.Context, req *api.HookRequest) error { return nil }
+	assert.Error(t, RegisterHook("hooks_test", "", api.HookPre, noop, "mount"), "Mount hooked")
+	assert.Error(t, RegisterHook("hooks_test", "", "during", noop), "Invalid phase accepted")
+
+	var posted []api.HookRequest
+	assert.NoError(t, RegisterHook("hooks_test_pre", "warm_test", api.HookPre,
+		func(ctx context.Context, req *api.HookRequest) error {
+			if strings.HasPrefix(req.Locator.Name, "bad") {
+				return errors.New("bad name")
+			}
+			return nil
+		}, HookCreate))
+	defer UnregisterHook("hooks_test_pre")
+	assert.NoError(t, RegisterHook("hooks_test_post", "", api.HookPost,
+		func(ctx context.Context, req *api.HookRequest) error {
+			posted = append(posted, *req)
+			return errors.New("ignored")
+		}))
+	defer UnregisterHook("hooks_test_post")
+
+	d := &warmDriver{DefaultEnumerator: NewDefaultEnumerator("hooks_test", kvdb.Instance())}
+	mutex.Lock()
+	instances["warm_test"] = d
+	mutex.Unlock()
+	defer func() {
+		mutex.Lock()
+		delete(instances, "warm_test")
+		mutex.Unlock()
+	}()
+	ctx := context.Background()
+	spec := &api.VolumeSpec{Size: 1 << 30}
+	_, err := CreateCtx(ctx, d, api.VolumeLocator{Name: "bad_vol"}, nil, spec)
+	if assert.Error(t, err, "Vetoed create succeeded") {
+		assert.Equal(t, &HookVetoError{Hook: "hooks_test_pre", Reason: "bad name"}, err)
+	}
+	assert.Equal(t, 0, d.created, "Vetoed volume created")
+	if assert.Len(t, posted, 1, "Post hooks should be called for a vetoed create") {
+		assert.Equal(t, err.Error(), posted[0].Error)
+	}
+	posted = nil
+
+	id, err := CreateCtx(ctx, d, api.VolumeLocator{Name: "good_vol"}, nil, spec)
+	assert.NoError(t, err, "Post hooks should not fail a create")
+	assert.NoError(t, DeleteCtx(ctx, d, id))
+	if assert.Len(t, posted, 2) {
+		assert.Equal(t, HookCreate, posted[0].Op)
+		assert.Equal(t, id, posted[0].VolumeID)
+		assert.Equal(t, "warm_test", posted[0].Driver)
+		assert.Equal(t, api.HookPost, posted[0].Phase)
+		assert.Equal(t, HookDelete, posted[1].Op)
+	}
+	posted = nil
+
+	id, err = CreateCtx(withInternal(ctx), d, api.VolumeLocator{Name: "bad_internal"}, nil, spec)
+	assert.NoError(t, err, "Hooks should not be called for internal operations")
+	assert.NoError(t, DeleteCtx(withInternal(ctx), d, id))
+	assert.Len(t, posted, 0, "Post hooks called for internal operations")
+}
+
+func TestWebhook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "deny") {
+			http.Error(w, "quota exceeded", http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+	req := &api.HookRequest{Op: HookCreate, Phase: api.HookPre}
+	assert.NoError(t, NewWebhook(srv.URL+"/allow", time.Second)(context.Background(), req))
+	err := NewWebhook(srv.URL+"/deny", time.Second)(context.Background(), req)
+	if assert.Error(t, err) {
+		assert.Equal(t, "quota exceeded", err.Error())
+	}
+}
@@ -0,0 +1,287 @@
+package volume
+
+import (
+	"encoding/json"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pborman/uuid"
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const journalKeyPrefix = "journal/"
+
+// JournalOp is an operation recorded in the journal.
+type JournalOp string
+
+const (
+	// JournalCreate a volume is being created.
+	JournalCreate = JournalOp("create")
+	// JournalDelete a volume is being deleted.
+	JournalDelete = JournalOp("delete")
+	// JournalAttach a volume is being attached.
+	JournalAttach = JournalOp("attach")
+)
+
+// JournalEntry records an operation in flight on a volume of a driver.
+type JournalEntry struct {
+	// ID of the entry.
+	ID string
+	// Driver instance the operation runs on.
+	Driver string
+	// Node the operation runs on.
+	Node api.MachineID
+	// Op operation in flight.
+	Op JournalOp
+	// VolumeID volume of the operation, empty for creates.
+	VolumeID api.VolumeID
+	// Locator of the volume being created.
+	Locator api.VolumeLocator
+	// Started time the operation started.
+	Started time.Time
+}
+
+// Recoverer is implemented by drivers that complete or roll back the
+// operations interrupted by a crash themselves. The operations of other
+// drivers are recovered by the journal: creates are rolled back by deleting
+// the volume labelled with the api.JournalLabel of the operation, deletes
+// are completed and attaches rolled back by detaching the volume.
+type Recoverer interface {
+	// Recover completes or rolls back the interrupted operation e.
+	Recover(e *JournalEntry) error
+}
+
+// Journal is a write-ahead log of the Create, Delete and Attach operations in
+// flight on this node, kept in the KVDB. When a driver starts the operations
+// it left behind in a crash are recovered, so that half-done operations do
+// not leak storage.
+type Journal struct {
+	kv kvdb.Kvdb
+}
+
+var journal *Journal
+
+// SetJournal sets the KVDB operations are journaled in. Operations are not
+// journaled if kv is nil, the default.
+func SetJournal(kv kvdb.Kvdb) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if kv == nil {
+		journal = nil
+		return
+	}
+	journal = &Journal{kv: kv}
+}
+
+// PendingOperations returns the operations in flight on this node on the
+// named driver instance, including those interrupted by a crash and not
+// recovered yet.
+func PendingOperations(name string) ([]JournalEntry, error) {
+	mutex.Lock()
+	j := journal
+	mutex.Unlock()
+	if j == nil {
+		return nil, nil
+	}
+	return j.pending(name)
+}
+
+func (j *Journal) prefix(name string) string {
+	return journalKeyPrefix + name + "/" + string(NodeID()) + "/"
+}
+
+func (j *Journal) pending(name string) ([]JournalEntry, error) {
+	kvp, err := j.kv.Enumerate(j.prefix(name))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]JournalEntry, 0, len(kvp))
+	for _, v := range kvp {
+		var e JournalEntry
+		if err = json.Unmarshal(v.Value, &e); err != nil {
+			log.Warnf("Skipping malformed journal entry %s: %v", v.Key, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// begin records that op is starting on d. It returns a function to call once
+// the operation is done. Operations of drivers that were not started with New
+// are not journaled.
+func (j *Journal) begin(d interface{},
+	op JournalOp,
+	volumeID api.VolumeID,
+	locator api.VolumeLocator) (func(), error) {
+	name := instanceName(d)
+	if name == "" {
+		return func() {}, nil
+	}
+	e := &JournalEntry{
+		ID:       uuid.New(),
+		Driver:   name,
+		Node:     NodeID(),
+		Op:       op,
+		VolumeID: volumeID,
+		Locator:  locator,
+		Started:  time.Now(),
+	}
+	key := j.prefix(name) + e.ID
+	if _, err := j.kv.Put(key, e, 0); err != nil {
+		return nil, err
+	}
+	return func() {
+		if _, err := j.kv.Delete(key); err != nil {
+			log.Warnf("Failed to remove journal entry %s: %v", key, err)
+		}
+	}, nil
+}
+
+// recover completes or rolls back the operations of d interrupted by a crash.
+// Entries that cannot be recovered are kept for the next start.
+func (j *Journal) recover(name string, d VolumeDriver) {
+	entries, err := j.pending(name)
+	if err != nil {
+		log.Warnf("%s: failed to read the journal: %v", name, err)
+		return
+	}
+	for i := range entries {
+		e := &entries[i]
+		log.Infof("%s: recovering interrupted %s of %q started at %v",
+			name, e.Op, journalTarget(e), e.Started)
+		if r, ok := d.(Recoverer); ok {
+			err = r.Recover(e)
+		} else {
+			err = recoverEntry(d, e)
+		}
+		if err != nil {
+			log.Warnf("%s: failed to recover %s of %q: %v", name, e.Op, journalTarget(e), err)
+			continue
+		}
+		if _, err = j.kv.Delete(j.prefix(name) + e.ID); err != nil {
+			log.Warnf("%s: failed to remove journal entry %s: %v", name, e.ID, err)
+		}
+	}
+}
+
+// journalTarget names the volume of e in log messages.
+func journalTarget(e *JournalEntry) string {
+	if e.VolumeID != "" {
+		return string(e.VolumeID)
+	}
+	return e.Locator.Name
+}
+
+// recoverEntry recovers e on a driver that is not a Recoverer.
+func recoverEntry(d VolumeDriver, e *JournalEntry) error {
+	switch e.Op {
+	case JournalCreate:
+		// Only the volume labelled by the entry is its own, volumes of
+		// the same name may have been created by other nodes.
+		tag := e.Locator.VolumeLabels[api.JournalLabel]
+		if tag == "" {
+			log.Warnf("Cannot roll back the create of %q started at %v, its volume is not labelled",
+				e.Locator.Name, e.Started)
+			return nil
+		}
+		vols, err := d.Enumerate(api.VolumeLocator{VolumeLabels: api.Labels{api.JournalLabel: tag}}, nil)
+		if err != nil {
+			return err
+		}
+		for _, v := range vols {
+			if v.State == api.VolumeAttached {
+				continue
+			}
+			if err = d.Delete(v.ID); err != nil && err != ErrEnoEnt {
+				return err
+			}
+		}
+	case JournalDelete:
+		if err := d.Delete(e.VolumeID); err != nil && err != ErrEnoEnt {
+			return err
+		}
+	case JournalAttach:
+		err := d.Detach(e.VolumeID)
+		if err != nil && err != ErrEnoEnt && err != ErrVolDetached && err != ErrNotSupported {
+			return err
+		}
+	}
+	return nil
+}
+
+// instanceName returns the name d was started as with New, empty if it was
+// not.
+func instanceName(d interface{}) string {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for name, v := range instances {
+		if interface{}(v) == d {
+			return name
+		}
+	}
+	return ""
+}
+
+// journalLocator returns locator labelled for a create journaled on d, see
+// api.JournalLabel, locator itself if creates on d are not journaled.
+func journalLocator(d interface{}, locator api.VolumeLocator) api.VolumeLocator {
+	mutex.Lock()
+	j := journal
+	mutex.Unlock()
+	if j == nil || instanceName(d) == "" {
+		return locator
+	}
+	labels := make(api.Labels, len(locator.VolumeLabels)+1)
+	for k, v := range locator.VolumeLabels {
+		labels[k] = v
+	}
+	labels[api.JournalLabel] = uuid.New()
+	locator.VolumeLabels = labels
+	return locator
+}
+
+// clearJournalLabel removes the api.JournalLabel of volumeID once it is
+// created, if d implements Store. Failures are logged: the label only
+// matters to the rollback of the create.
+func clearJournalLabel(d interface{}, volumeID api.VolumeID) {
+	store, ok := d.(Store)
+	if !ok {
+		return
+	}
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		log.Warnf("Failed to remove the journal label of volume %v: %v", volumeID, err)
+		return
+	}
+	defer store.Unlock(token)
+
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		log.Warnf("Failed to remove the journal label of volume %v: %v", volumeID, err)
+		return
+	}
+	if _, ok := v.Locator.VolumeLabels[api.JournalLabel]; !ok {
+		return
+	}
+	delete(v.Locator.VolumeLabels, api.JournalLabel)
+	if err = store.UpdateVol(v); err != nil {
+		log.Warnf("Failed to remove the journal label of volume %v: %v", volumeID, err)
+	}
+}
+
+// journalBegin records op in the journal if one is set.
+func journalBegin(d interface{},
+	op JournalOp,
+	volumeID api.VolumeID,
+	locator api.VolumeLocator) (func(), error) {
+	mutex.Lock()
+	j := journal
+	mutex.Unlock()
+	if j == nil {
+		return func() {}, nil
+	}
+	return j.begin(d, op, volumeID, locator)
+}
@@ -0,0 +1,76 @@
+package volume
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type journalDriver struct {
+	removeDriver
+	deleted []api.VolumeID
+	pending int
+}
+
+func (d *journalDriver) Delete(volumeID api.VolumeID) error {
+	ops, _ := PendingOperations("journal_test")
+	d.pending = len(ops)
+	d.deleted = append(d.deleted, volumeID)
+	return nil
+}
+
+func TestJournal(t *testing.T) {
+	kv := kvdb.Instance()
+	SetJournal(kv)
+	defer SetJournal(nil)
+
+	// An interrupted delete left behind by a crash.
+	key := journalKeyPrefix + "journal_test/" + string(NodeID()) + "/crashed"
+	_, err := kv.Put(key, &JournalEntry{ID: "crashed", Op: JournalDelete, VolumeID: "journal_vol", Started: time.Now()}, 0)
+	assert.NoError(t, err)
+
+	// An interrupted create, whose name another node took since.
+	key = journalKeyPrefix + "journal_test/" + string(NodeID()) + "/crashed_create"
+	_, err = kv.Put(key, &JournalEntry{ID: "crashed_create", Op: JournalCreate, Started: time.Now(),
+		Locator: api.VolumeLocator{Name: "journal_name", VolumeLabels: api.Labels{api.JournalLabel: "tag"}}}, 0)
+	assert.NoError(t, err)
+	enumerator := NewDefaultEnumerator("journal_test", kv)
+	for _, v := range []*api.Volume{
+		{ID: "journal_mine", Locator: api.VolumeLocator{
+			VolumeLabels: api.Labels{api.JournalLabel: "tag"}}, Spec: &api.VolumeSpec{}},
+		{ID: "journal_other", Locator: api.VolumeLocator{Name: "journal_name"}, Spec: &api.VolumeSpec{}},
+	} {
+		assert.NoError(t, enumerator.CreateVol(v))
+		defer enumerator.DeleteVol(v.ID)
+	}
+
+	d := &journalDriver{removeDriver: removeDriver{capabilityDriver{Enumerator: enumerator, t: File}}}
+	err = Register("journal_test", func(c *DriverContext) (VolumeDriver, error) {
+		return d, nil
+	})
+	assert.NoError(t, err, "Failed to register driver")
+	_, err = New("journal_test", nil)
+	assert.NoError(t, err, "Failed to start driver")
+	defer Remove("journal_test", true)
+
+	deleted := make(map[api.VolumeID]bool)
+	for _, id := range d.deleted {
+		deleted[id] = true
+	}
+	assert.Equal(t, map[api.VolumeID]bool{"journal_vol": true, "journal_mine": true}, deleted,
+		"Interrupted operations not recovered, or the volume of another create deleted")
+	ops, err := PendingOperations("journal_test")
+	assert.NoError(t, err)
+	assert.Empty(t, ops, "Recovered operation kept in the journal")
+
+	assert.NoError(t, DeleteCtx(context.Background(), d, "other_vol"))
+	assert.Equal(t, 1, d.pending, "Delete not journaled while in flight")
+	ops, err = PendingOperations("journal_test")
+	assert.NoError(t, err)
+	assert.Empty(t, ops, "Completed operation kept in the journal")
+}
@@ -0,0 +1,171 @@
+package volume
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// The label index keeps a key per volume label under
+//
+//	openstorage/<driver>/labels/<kind>/<label>/<value>/<volID>
+//
+// so that Enumerate with labels only reads the volumes carrying those labels
+// instead of every volume of the driver. Labels match on their key, as in
+// hasSubset, so lookups enumerate all values under a label.
+const (
+	labelIndex      = "/labels/"
+	labelIndexReady = "/labels.indexed"
+
+	locatorLabels = "locator"
+	configLabels  = "config"
+)
+
+func (e *DefaultEnumerator) labelPrefix(kind, label string) string {
+	return e.labelKeyPrefix + kind + "/" + url.QueryEscape(label) + "/"
+}
+
+func (e *DefaultEnumerator) labelKey(kind, label, value string, volID api.VolumeID) string {
+	return e.labelPrefix(kind, label) + url.QueryEscape(value) + "/" +
+		url.QueryEscape(string(volID))
+}
+
+// volLabels returns the indexed labels of vol by kind.
+func volLabels(vol *api.Volume) map[string]api.Labels {
+	l := map[string]api.Labels{locatorLabels: vol.Locator.VolumeLabels}
+	if vol.Spec != nil {
+		l[configLabels] = vol.Spec.ConfigLabels
+	}
+	return l
+}
+
+// indexLabels adds to txn the updates of the label index of vol from the
+// labels of old, which is nil for new volumes, to those of vol, which is nil
+// for deleted volumes.
+func (e *DefaultEnumerator) indexLabels(txn *Txn, volID api.VolumeID, old, vol *api.Volume) {
+	var from, to map[string]api.Labels
+	if old != nil {
+		from = volLabels(old)
+	}
+	if vol != nil {
+		to = volLabels(vol)
+	}
+	for kind, labels := range from {
+		for k, v := range labels {
+			if nv, ok := to[kind][k]; ok && nv == v {
+				continue
+			}
+			txn.Delete(e.labelKey(kind, k, v, volID))
+		}
+	}
+	for kind, labels := range to {
+		for k, v := range labels {
+			if ov, ok := from[kind][k]; ok && ov == v {
+				continue
+			}
+			txn.Put(e.labelKey(kind, k, v, volID), volID)
+		}
+	}
+}
+
+// labelled returns the IDs of the volumes with label of kind.
+func (e *DefaultEnumerator) labelled(kind, label string) (map[api.VolumeID]bool, error) {
+	kvp, err := e.kvdb.Enumerate(e.labelPrefix(kind, label))
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[api.VolumeID]bool, len(kvp))
+	for _, v := range kvp {
+		id, err := url.QueryUnescape(v.Key[strings.LastIndex(v.Key, "/")+1:])
+		if err != nil {
+			return nil, err
+		}
+		ids[api.VolumeID(id)] = true
+	}
+	return ids, nil
+}
+
+// lookupLabels returns the IDs of the volumes with all locator and config
+// labels. It returns false if there are no labels to look up.
+func (e *DefaultEnumerator) lookupLabels(locator, config api.Labels) ([]api.VolumeID, bool, error) {
+	if len(locator) == 0 && len(config) == 0 {
+		return nil, false, nil
+	}
+	if err := e.buildLabelIndex(); err != nil {
+		return nil, false, err
+	}
+	var found map[api.VolumeID]bool
+	for kind, labels := range map[string]api.Labels{locatorLabels: locator, configLabels: config} {
+		for k := range labels {
+			ids, err := e.labelled(kind, k)
+			if err != nil {
+				return nil, false, err
+			}
+			if found == nil {
+				found = ids
+				continue
+			}
+			for id := range found {
+				if !ids[id] {
+					delete(found, id)
+				}
+			}
+		}
+	}
+	vols := make([]api.VolumeID, 0, len(found))
+	for id := range found {
+		vols = append(vols, id)
+	}
+	return vols, true, nil
+}
+
+// buildLabelIndex indexes the labels of the volumes created before the label
+// index existed. It runs once per driver.
+func (e *DefaultEnumerator) buildLabelIndex() error {
+	return e.buildIndex("labels", e.labelReadyKey, &e.indexed, func(txn *Txn, vol *api.Volume) {
+		e.indexLabels(txn, vol.ID, nil, vol)
+	})
+}
+
+// buildIndex calls index on the volumes created before the index marked by
+// readyKey existed, unless ready is set or the index has been built by
+// another node.
+func (e *DefaultEnumerator) buildIndex(what string,
+	readyKey string,
+	ready *bool,
+	index func(txn *Txn, vol *api.Volume)) error {
+	e.indexLock.Lock()
+	defer e.indexLock.Unlock()
+	if *ready {
+		return nil
+	}
+	if _, err := e.kvdb.Get(readyKey); err == nil {
+		*ready = true
+		return nil
+	}
+	kvp, err := e.kvdb.Enumerate(e.volKeyPrefix)
+	if err != nil {
+		return err
+	}
+	log.Infof("Indexing the %s of %d %s volumes", what, len(kvp), e.driver)
+	for _, v := range kvp {
+		var vol api.Volume
+		if err = json.Unmarshal(v.Value, &vol); err != nil {
+			return err
+		}
+		txn := e.Txn()
+		index(txn, &vol)
+		if err = txn.Commit(); err != nil {
+			return err
+		}
+	}
+	if _, err = e.kvdb.Put(readyKey, true, 0); err != nil {
+		return err
+	}
+	*ready = true
+	return nil
+}
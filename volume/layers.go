@@ -0,0 +1,424 @@
+package volume
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// LayersParam DriverParams key for the comma separated names of the layers
+// stacked over the volumes of a driver, from the bottom up, such as "crypt"
+// to encrypt the devices of a block driver or "fscache" to cache the volumes
+// of the nfs driver. Layers are configured by the other params of the driver.
+const LayersParam = "layers"
+
+// Layer adds a function, such as encryption or caching, to the volumes of
+// the drivers it is stacked on. Layers take part in the operations on the
+// volumes by implementing DeviceLayer, MountLayer or SnapshotLayer. Volumes
+// are served by the layers of their driver recorded in their Layers when
+// they were created, so that layers added to a driver later do not change
+// the volumes that predate them.
+type Layer interface {
+	// String name of the layer.
+	String() string
+}
+
+// DeviceLayer stacks a device over the devices of the volumes of block
+// drivers. The devices of layers are stacked over the device of the driver,
+// under the built in VDOLayer and CacheLayer.
+type DeviceLayer interface {
+	Layer
+	// Assemble stacks the device of the layer over device, the top device
+	// of the layers below, once v is attached and returns its path.
+	Assemble(v *api.Volume, device string) (string, error)
+	// Path returns the device of the layer if it is assembled over the
+	// volume, device otherwise.
+	Path(volumeID api.VolumeID, device string) string
+	// Teardown removes the device of the layer before the volume is
+	// detached, once the layers above are removed.
+	Teardown(volumeID api.VolumeID) error
+}
+
+// MountLayer takes part in the mounts of volumes.
+type MountLayer interface {
+	Layer
+	// MountOptions returns the options drivers add to the mounts of v, see
+	// LayerMountOptions.
+	MountOptions(v *api.Volume) []string
+	// Mounted is called once v is mounted at mountpath. The volume is
+	// unmounted if it fails.
+	Mounted(v *api.Volume, mountpath string) error
+	// Unmounting is called before volumeID is unmounted from mountpath,
+	// which is kept if it fails.
+	Unmounting(volumeID api.VolumeID, mountpath string) error
+}
+
+// SnapshotLayer takes part in the snapshots of volumes.
+type SnapshotLayer interface {
+	Layer
+	// Quiesce makes the data the layer holds for volumeID durable on the
+	// layers below before it is snapshotted. The returned function is called
+	// once the snapshot is taken.
+	Quiesce(volumeID api.VolumeID) (func(), error)
+}
+
+// LayerInit returns a layer configured by the params of the driver it is
+// stacked on.
+type LayerInit func(params DriverParams) (Layer, error)
+
+var (
+	layersLock sync.Mutex
+	// layerInits registered layers by name.
+	layerInits = make(map[string]LayerInit)
+	// layers stacked on each driver instance, from the bottom up.
+	layers = make(map[string][]Layer)
+)
+
+// RegisterLayer makes the layer name available to LayersParam.
+func RegisterLayer(name string, init LayerInit) error {
+	layersLock.Lock()
+	defer layersLock.Unlock()
+	if _, ok := layerInits[name]; ok {
+		return ErrExist
+	}
+	layerInits[name] = init
+	return nil
+}
+
+// newLayers returns the layers named by LayersParam in params.
+func newLayers(params DriverParams) ([]Layer, error) {
+	var stack []Layer
+	for _, name := range strings.Split(params[LayersParam], ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if name == VDOLayer || name == CacheLayer {
+			return nil, fmt.Errorf("Layer %s is stacked over the volumes whose spec needs it, not in %s",
+				name, LayersParam)
+		}
+		layersLock.Lock()
+		init, ok := layerInits[name]
+		layersLock.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("Unknown layer %q in %s", name, LayersParam)
+		}
+		l, err := init(params)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to configure layer %s: %v", name, err)
+		}
+		stack = append(stack, l)
+	}
+	return stack, nil
+}
+
+// checkLayers fails if a layer of stack cannot be stacked on d.
+func checkLayers(d VolumeDriver, stack []Layer) error {
+	for _, l := range stack {
+		if _, ok := l.(DeviceLayer); ok && d.Type()&Block == 0 {
+			return fmt.Errorf("Layer %s stacks devices, %s is not a block driver", l, d)
+		}
+	}
+	return nil
+}
+
+func setLayers(name string, stack []Layer) {
+	layersLock.Lock()
+	defer layersLock.Unlock()
+	if len(stack) == 0 {
+		delete(layers, name)
+		return
+	}
+	layers[name] = stack
+}
+
+// layersOf returns the layers stacked on d, from the bottom up.
+func layersOf(d interface{}) []Layer {
+	name := instanceName(d)
+	layersLock.Lock()
+	defer layersLock.Unlock()
+	return layers[name]
+}
+
+// Layers returns the names of the layers stacked on the named driver, from
+// the bottom up.
+func Layers(name string) []string {
+	layersLock.Lock()
+	defer layersLock.Unlock()
+	names := make([]string, 0, len(layers[name]))
+	for _, l := range layers[name] {
+		names = append(names, l.String())
+	}
+	return names
+}
+
+// builtinLayers returns the layers stacked over the device layers of all
+// block volumes of d, which assemble their device only for the volumes whose
+// spec needs it.
+func builtinLayers(d interface{}) []Layer {
+	if _, ok := d.(Compressor); ok {
+		return []Layer{cacheLayer{}}
+	}
+	return []Layer{vdoLayer{}, cacheLayer{}}
+}
+
+// volumeLayers returns the layers of v, a volume of d, from the bottom up:
+// the layers of d recorded in v, then the built in layers. Volumes of drivers
+// that cannot record their layers are served by all the layers of d.
+func volumeLayers(d interface{}, v *api.Volume) ([]Layer, error) {
+	stack := layersOf(d)
+	if _, ok := d.(Store); !ok {
+		return append(append([]Layer(nil), stack...), builtinLayers(d)...), nil
+	}
+	var layers []Layer
+	for _, name := range v.Layers {
+		if name == VDOLayer || name == CacheLayer {
+			continue
+		}
+		var found Layer
+		for _, l := range stack {
+			if l.String() == name {
+				found = l
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("Volume %v was created under layer %s, which %s no longer has",
+				v.ID, name, instanceName(d))
+		}
+		layers = append(layers, found)
+	}
+	return append(layers, builtinLayers(d)...), nil
+}
+
+// layersOfVolume returns the layers of volumeID of d, or all the layers d
+// may stack if they cannot be told, so that their devices are found.
+func layersOfVolume(d interface{}, volumeID api.VolumeID) []Layer {
+	if len(layersOf(d)) == 0 {
+		return builtinLayers(d)
+	}
+	stack, err := volumeLayers(d, layerVolume(d, volumeID))
+	if err != nil {
+		log.Warnf("Failed to find the layers of volume %v: %v", volumeID, err)
+		return append(append([]Layer(nil), layersOf(d)...), builtinLayers(d)...)
+	}
+	return stack
+}
+
+// TopDevice returns the top device of the stack over origin, the device of
+// volumeID attached by d: that of its top layer if assembled, origin
+// otherwise. Drivers mount and format the returned path.
+func TopDevice(d interface{}, volumeID api.VolumeID, origin string) string {
+	device := origin
+	for _, l := range layersOfVolume(d, volumeID) {
+		if dl, ok := l.(DeviceLayer); ok {
+			device = dl.Path(volumeID, device)
+		}
+	}
+	return device
+}
+
+// LayerMountOptions returns the options the layers of volumeID of d add to
+// its mounts. Drivers that mount volumes with options, such as nfs, pass
+// them to the mount.
+func LayerMountOptions(d interface{}, volumeID api.VolumeID) []string {
+	if len(layersOf(d)) == 0 {
+		return nil
+	}
+	v := layerVolume(d, volumeID)
+	stack, err := volumeLayers(d, v)
+	if err != nil {
+		// The mount fails in mountLayers.
+		return nil
+	}
+	var opts []string
+	for _, l := range stack {
+		if ml, ok := l.(MountLayer); ok {
+			opts = append(opts, ml.MountOptions(v)...)
+		}
+	}
+	return opts
+}
+
+// recordLayers records the layers of d in the Layers of volumeID once it is
+// created, if d implements Store, so that the layers initialize its devices.
+// Failures are logged: the create itself succeeded.
+func recordLayers(d interface{}, volumeID api.VolumeID) {
+	stack := layersOf(d)
+	store, ok := d.(Store)
+	if len(stack) == 0 || !ok {
+		return
+	}
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		log.Warnf("Failed to record the layers of volume %v: %v", volumeID, err)
+		return
+	}
+	defer store.Unlock(token)
+
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		log.Warnf("Failed to record the layers of volume %v: %v", volumeID, err)
+		return
+	}
+	v.Layers = v.Layers[:0]
+	for _, l := range stack {
+		v.Layers = append(v.Layers, l.String())
+	}
+	if err = store.UpdateVol(v); err != nil {
+		log.Warnf("Failed to record the layers of volume %v: %v", volumeID, err)
+	}
+}
+
+// hasLayer returns true if v was created under the layer name.
+func hasLayer(v *api.Volume, name string) bool {
+	for _, l := range v.Layers {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+// layerVolume returns volumeID of d as given to layers, with only its ID if
+// d cannot inspect it.
+func layerVolume(d interface{}, volumeID api.VolumeID) *api.Volume {
+	if e, ok := d.(Enumerator); ok {
+		if vols, err := e.Inspect([]api.VolumeID{volumeID}); err == nil && len(vols) == 1 {
+			return &vols[0]
+		}
+	}
+	return &api.Volume{ID: volumeID}
+}
+
+// attachLayers assembles the devices of the layers of volumeID over its
+// device and returns the top one. Volumes are detached if a layer fails.
+func attachLayers(d BlockDriver, volumeID api.VolumeID, devicePath string) (string, error) {
+	v := layerVolume(d, volumeID)
+	stack, err := volumeLayers(d, v)
+	if err != nil {
+		if derr := d.Detach(volumeID); derr != nil {
+			log.Warnf("Failed to detach volume %v: %v", volumeID, derr)
+		}
+		return "", err
+	}
+	path, err := assembleLayers(stack, v, devicePath)
+	if err != nil {
+		if derr := d.Detach(volumeID); derr != nil {
+			log.Warnf("Failed to detach volume %v: %v", volumeID, derr)
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// assembleLayers assembles the devices of stack over device, from the bottom
+// up, and returns the top one. The devices assembled are removed if a layer
+// fails.
+func assembleLayers(stack []Layer, v *api.Volume, device string) (string, error) {
+	for i, l := range stack {
+		dl, ok := l.(DeviceLayer)
+		if !ok {
+			continue
+		}
+		path, err := dl.Assemble(v, device)
+		if err != nil {
+			if derr := teardownLayers(stack[:i], v.ID); derr != nil {
+				log.Warnf("Failed to remove the layers of volume %v: %v", v.ID, derr)
+			}
+			return "", fmt.Errorf("Layer %s failed: %v", l, err)
+		}
+		device = path
+	}
+	return device, nil
+}
+
+// detachLayers removes the devices of the layers of volumeID, from the top
+// down, before it is detached.
+func detachLayers(d interface{}, volumeID api.VolumeID) error {
+	return teardownLayers(layersOfVolume(d, volumeID), volumeID)
+}
+
+// teardownLayers removes the devices of stack from volumeID, from the top
+// down.
+func teardownLayers(stack []Layer, volumeID api.VolumeID) error {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if dl, ok := stack[i].(DeviceLayer); ok {
+			if err := dl.Teardown(volumeID); err != nil {
+				return fmt.Errorf("Layer %s failed: %v", dl, err)
+			}
+		}
+	}
+	return nil
+}
+
+// mountLayers tells the layers of volumeID that it is mounted at mountpath,
+// and unmounts it if one of them fails.
+func mountLayers(d ProtoDriver, volumeID api.VolumeID, mountpath string) error {
+	if len(layersOf(d)) == 0 {
+		// The built in layers do not take part in mounts.
+		return nil
+	}
+	v := layerVolume(d, volumeID)
+	stack, err := volumeLayers(d, v)
+	if err == nil {
+		for i, l := range stack {
+			ml, ok := l.(MountLayer)
+			if !ok {
+				continue
+			}
+			if err = ml.Mounted(v, mountpath); err != nil {
+				unmountLayers(stack[:i], volumeID, mountpath)
+				err = fmt.Errorf("Layer %s failed: %v", l, err)
+				break
+			}
+		}
+	}
+	if err != nil {
+		if uerr := d.Unmount(volumeID, mountpath); uerr != nil {
+			log.Warnf("Failed to unmount volume %v: %v", volumeID, uerr)
+		}
+	}
+	return err
+}
+
+// unmountLayers tells stack, from the top down, that volumeID is about to
+// be unmounted from mountpath.
+func unmountLayers(stack []Layer, volumeID api.VolumeID, mountpath string) error {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if ml, ok := stack[i].(MountLayer); ok {
+			if err := ml.Unmounting(volumeID, mountpath); err != nil {
+				return fmt.Errorf("Layer %s failed: %v", ml, err)
+			}
+		}
+	}
+	return nil
+}
+
+// quiesceLayers quiesces the layers of volumeID before a snapshot, from the
+// top down. The returned function resumes them.
+func quiesceLayers(d interface{}, volumeID api.VolumeID) (func(), error) {
+	stack := layersOfVolume(d, volumeID)
+	var resumes []func()
+	resume := func() {
+		for i := len(resumes) - 1; i >= 0; i-- {
+			resumes[i]()
+		}
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		sl, ok := stack[i].(SnapshotLayer)
+		if !ok {
+			continue
+		}
+		r, err := sl.Quiesce(volumeID)
+		if err != nil {
+			resume()
+			return nil, fmt.Errorf("Layer %s failed: %v", sl, err)
+		}
+		resumes = append(resumes, r)
+	}
+	return resume, nil
+}
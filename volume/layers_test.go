@@ -0,0 +1,168 @@
+package volume
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type layeredDriver struct {
+	historyDriver
+	typ DriverType
+}
+
+func (d *layeredDriver) String() string   { return "layers_test" }
+func (d *layeredDriver) Type() DriverType { return d.typ }
+
+func (d *layeredDriver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	return "layers_test_snap", nil
+}
+
+// testLayer records the calls made to it.
+type testLayer struct {
+	calls     []string
+	assembled bool
+	fail      bool
+}
+
+func (l *testLayer) String() string { return "test" }
+
+func (l *testLayer) Assemble(v *api.Volume, device string) (string, error) {
+	l.calls = append(l.calls, "assemble "+device)
+	if l.fail {
+		return "", errors.New("failed")
+	}
+	l.assembled = true
+	return "/dev/mapper/test", nil
+}
+
+func (l *testLayer) Path(volumeID api.VolumeID, device string) string {
+	if l.assembled {
+		return "/dev/mapper/test"
+	}
+	return device
+}
+
+func (l *testLayer) Teardown(volumeID api.VolumeID) error {
+	l.calls = append(l.calls, "teardown")
+	l.assembled = false
+	return nil
+}
+
+func (l *testLayer) MountOptions(v *api.Volume) []string {
+	return []string{"test"}
+}
+
+func (l *testLayer) Mounted(v *api.Volume, mountpath string) error {
+	l.calls = append(l.calls, "mounted "+mountpath)
+	return nil
+}
+
+func (l *testLayer) Unmounting(volumeID api.VolumeID, mountpath string) error {
+	l.calls = append(l.calls, "unmounting "+mountpath)
+	return nil
+}
+
+func (l *testLayer) Quiesce(volumeID api.VolumeID) (func(), error) {
+	l.calls = append(l.calls, "quiesce")
+	return func() { l.calls = append(l.calls, "resume") }, nil
+}
+
+func TestLayers(t *testing.T) {
+	layer := &testLayer{}
+	assert.NoError(t, RegisterLayer("layers_test", func(params DriverParams) (Layer, error) {
+		return layer, nil
+	}))
+	assert.Equal(t, ErrExist, RegisterLayer("layers_test", nil))
+	_, err := newLayers(DriverParams{LayersParam: "layers_test,missing"})
+	assert.Error(t, err, "Unknown layer accepted")
+	_, err = newLayers(DriverParams{LayersParam: CryptLayer})
+	assert.Error(t, err, "Crypt layer without a passphrase accepted")
+	stack, err := newLayers(DriverParams{LayersParam: " layers_test "})
+	assert.NoError(t, err)
+
+	d := &layeredDriver{typ: File}
+	d.DefaultEnumerator = NewDefaultEnumerator("layers_test", kvdb.Instance())
+	assert.Error(t, checkLayers(d, stack), "Device layer stacked on a file driver")
+	d.typ = Block
+	assert.NoError(t, checkLayers(d, stack))
+
+	mutex.Lock()
+	instances["layers_test"] = d
+	mutex.Unlock()
+	setLayers("layers_test", stack)
+	defer func() {
+		setLayers("layers_test", nil)
+		mutex.Lock()
+		delete(instances, "layers_test")
+		mutex.Unlock()
+	}()
+	assert.Equal(t, []string{"test"}, Layers("layers_test"))
+
+	ctx := context.Background()
+	old := &api.Volume{ID: "layers_test_old", Spec: &api.VolumeSpec{}, Layers: []string{}}
+	assert.NoError(t, d.CreateVol(old))
+	defer d.DeleteVol(old.ID)
+	path, err := AttachCtx(ctx, d, old.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/history", path, "Layer stacked over a volume that predates it")
+	assert.Nil(t, LayerMountOptions(d, old.ID))
+	assert.NoError(t, DetachCtx(ctx, d, old.ID))
+	assert.Nil(t, layer.calls)
+
+	gone := &api.Volume{ID: "layers_test_gone", Spec: &api.VolumeSpec{}, Layers: []string{"removed"}}
+	assert.NoError(t, d.CreateVol(gone))
+	defer d.DeleteVol(gone.ID)
+	_, err = AttachCtx(ctx, d, gone.ID, nil)
+	assert.Error(t, err, "Attach succeeded without a layer the volume was created under")
+
+	vol := &api.Volume{ID: "layers_test_vol", Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(vol))
+	defer d.DeleteVol(vol.ID)
+
+	assert.False(t, hasLayer(vol, "test"), "Volume created before its layer")
+	recordLayers(d, vol.ID)
+	vol, err = d.GetVol(vol.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test"}, vol.Layers)
+	assert.True(t, hasLayer(vol, "test"), "Layers of the driver not recorded")
+
+	assert.Equal(t, []string{"test"}, LayerMountOptions(d, vol.ID))
+	path, err = AttachCtx(ctx, d, vol.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/mapper/test", path)
+	assert.Equal(t, "/dev/mapper/test", TopDevice(d, vol.ID, "/dev/history"))
+	assert.NoError(t, MountCtx(ctx, d, vol.ID, "/mnt/layers"))
+	_, err = SnapshotCtx(ctx, d, vol.ID, nil, false)
+	assert.NoError(t, err)
+	assert.NoError(t, UnmountCtx(ctx, d, vol.ID, "/mnt/layers"))
+	assert.NoError(t, DetachCtx(ctx, d, vol.ID))
+	assert.Equal(t, "/dev/history", TopDevice(d, vol.ID, "/dev/history"))
+	assert.Equal(t, []string{
+		"assemble /dev/history",
+		"mounted /mnt/layers",
+		"quiesce",
+		"resume",
+		"unmounting /mnt/layers",
+		"teardown",
+	}, layer.calls)
+
+	layer.calls, layer.fail = nil, true
+	_, err = AttachCtx(ctx, d, vol.ID, nil)
+	assert.Error(t, err, "Attach succeeded without its layer")
+	assert.Equal(t, []string{"assemble /dev/history"}, layer.calls)
+
+	layer.calls, layer.fail = nil, false
+	vol.OriginUUID = "1111"
+	assert.NoError(t, d.UpdateVol(vol))
+	defer func(f func(string) (string, error)) { fsUUID = f }(fsUUID)
+	fsUUID = func(dev string) (string, error) { return "2222", nil }
+	_, err = AttachCtx(ctx, d, vol.ID, nil)
+	assert.Equal(t, ErrWrongDevice, err)
+	assert.Nil(t, layer.calls, "Layer assembled over the wrong device")
+}
@@ -0,0 +1,224 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// Op is a class of expensive operations whose concurrency may be limited.
+type Op string
+
+const (
+	// OpFormat formats volumes.
+	OpFormat = Op("format")
+	// OpSnapshot snapshots volumes.
+	OpSnapshot = Op("snapshot")
+	// OpRestore creates volumes from snapshots.
+	OpRestore = Op("restore")
+)
+
+const (
+	// FormatConcurrencyParam DriverParams key for the number of volumes of a
+	// driver that may be formatted at once. Not limited if 0.
+	FormatConcurrencyParam = "format_concurrency"
+	// SnapshotConcurrencyParam DriverParams key for the number of snapshots
+	// of a driver that may be taken at once. Not limited if 0.
+	SnapshotConcurrencyParam = "snapshot_concurrency"
+	// RestoreConcurrencyParam DriverParams key for the number of volumes of a
+	// driver that may be created from snapshots at once. Not limited if 0.
+	RestoreConcurrencyParam = "restore_concurrency"
+)
+
+// limitedOps maps the limited operations to their DriverParams key.
+var limitedOps = []struct {
+	op    Op
+	param string
+}{
+	{OpFormat, FormatConcurrencyParam},
+	{OpSnapshot, SnapshotConcurrencyParam},
+	{OpRestore, RestoreConcurrencyParam},
+}
+
+var (
+	limitLock sync.Mutex
+	// limiters of each driver, by driver name.
+	limiters = make(map[string]map[Op]*limiter)
+	// global limiters shared by all drivers.
+	global = make(map[Op]*limiter)
+)
+
+// limiter runs up to limit operations at once. Excess operations wait in
+// FIFO order, so that a steady stream of requests cannot starve earlier
+// ones.
+type limiter struct {
+	lock    sync.Mutex
+	limit   int
+	running int
+	waiting []chan struct{}
+}
+
+func newLimiter(limit int) *limiter {
+	return &limiter{limit: limit}
+}
+
+// acquire waits for a slot or for ctx to be done.
+func (l *limiter) acquire(ctx context.Context) error {
+	l.lock.Lock()
+	if l.running < l.limit && len(l.waiting) == 0 {
+		l.running++
+		l.lock.Unlock()
+		return nil
+	}
+	w := make(chan struct{})
+	l.waiting = append(l.waiting, w)
+	l.lock.Unlock()
+
+	select {
+	case <-w:
+		return nil
+	case <-ctx.Done():
+	}
+	l.lock.Lock()
+	for i, q := range l.waiting {
+		if q == w {
+			l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+			l.lock.Unlock()
+			return ctx.Err()
+		}
+	}
+	l.lock.Unlock()
+	// The slot was handed over as ctx was done, pass it on.
+	l.release()
+	return ctx.Err()
+}
+
+// release hands the slot to the longest waiting operation.
+func (l *limiter) release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.waiting) > 0 {
+		close(l.waiting[0])
+		l.waiting = l.waiting[1:]
+		return
+	}
+	l.running--
+}
+
+func (l *limiter) depth() (running int, waiting int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.running, len(l.waiting)
+}
+
+func newLimiters(params DriverParams) (map[Op]*limiter, error) {
+	lims := make(map[Op]*limiter)
+	for _, o := range limitedOps {
+		n, err := intParam(params, o.param, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("Invalid value %d for %s", n, o.param)
+		}
+		if n > 0 {
+			lims[o.op] = newLimiter(n)
+		}
+	}
+	return lims, nil
+}
+
+// SetConcurrency limits the number of op operations running at once across
+// all drivers to n, on top of the limits of each driver. Operations are not
+// limited globally if n is 0.
+func SetConcurrency(op Op, n int) {
+	limitLock.Lock()
+	defer limitLock.Unlock()
+	if n <= 0 {
+		delete(global, op)
+		return
+	}
+	global[op] = newLimiter(n)
+}
+
+func setLimiters(name string, lims map[Op]*limiter) {
+	limitLock.Lock()
+	defer limitLock.Unlock()
+	if len(lims) == 0 {
+		delete(limiters, name)
+		return
+	}
+	limiters[name] = lims
+}
+
+// limit waits for the driver and global limits of op to admit an operation
+// of driver d. It returns a function that must be called once the operation
+// completes.
+func limit(ctx context.Context, d ProtoDriver, op Op) (func(), error) {
+	name := instanceName(d)
+	limitLock.Lock()
+	var held []*limiter
+	if l, ok := limiters[name][op]; ok {
+		held = append(held, l)
+	}
+	if l, ok := global[op]; ok {
+		held = append(held, l)
+	}
+	limitLock.Unlock()
+
+	// Always take the driver limit first, so waiters cannot deadlock.
+	for i, l := range held {
+		if err := l.acquire(ctx); err != nil {
+			for _, a := range held[:i] {
+				a.release()
+			}
+			return nil, err
+		}
+	}
+	return func() {
+		for _, l := range held {
+			l.release()
+		}
+	}, nil
+}
+
+// Status returns the diagnostic status of driver d with the number of
+// limited operations running and queued, for the driver and globally, added
+// to its Details.
+func Status(d ProtoDriver) api.DriverStatus {
+	status := d.Status()
+	if status.Driver == "" {
+		status.Driver = d.String()
+	}
+	name := instanceName(d)
+	limitLock.Lock()
+	lims := limiters[name]
+	limitLock.Unlock()
+	status.Details = appendDepth(status.Details, "", lims)
+	limitLock.Lock()
+	lims = make(map[Op]*limiter, len(global))
+	for op, l := range global {
+		lims[op] = l
+	}
+	limitLock.Unlock()
+	status.Details = appendDepth(status.Details, "global ", lims)
+	return status
+}
+
+func appendDepth(status [][2]string, prefix string, lims map[Op]*limiter) [][2]string {
+	for _, o := range limitedOps {
+		l, ok := lims[o.op]
+		if !ok {
+			continue
+		}
+		running, waiting := l.depth()
+		status = append(status,
+			[2]string{prefix + string(o.op) + " running", strconv.Itoa(running)},
+			[2]string{prefix + string(o.op) + " queued", strconv.Itoa(waiting)},
+		)
+	}
+	return status
+}
@@ -0,0 +1,46 @@
+package volume
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(1)
+	assert.NoError(t, l.acquire(context.Background()), "Failed to acquire a free slot")
+
+	// Waiters are admitted in the order they queued.
+	order := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			l.acquire(context.Background())
+			order <- i
+		}(i)
+		for {
+			if _, waiting := l.depth(); waiting == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// A cancelled waiter leaves the queue.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, l.acquire(ctx), "Cancelled acquire should fail")
+	running, waiting := l.depth()
+	assert.Equal(t, 1, running, "Unexpected running operations")
+	assert.Equal(t, 2, waiting, "Cancelled waiter should leave the queue")
+
+	l.release()
+	assert.Equal(t, 0, <-order, "First waiter should be admitted first")
+	l.release()
+	assert.Equal(t, 1, <-order, "Second waiter should be admitted second")
+	l.release()
+	running, waiting = l.depth()
+	assert.Equal(t, 0, running, "All slots should be free")
+	assert.Equal(t, 0, waiting, "Queue should be empty")
+}
@@ -0,0 +1,207 @@
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/events"
+)
+
+// MaintenanceSetter is implemented by drivers that track the maintenance of
+// their volumes themselves, such as clients of a remote node. Use
+// SetMaintenance to change the maintenance of a volume of any driver.
+type MaintenanceSetter interface {
+	// SetMaintenance starts or ends the maintenance of volumeID.
+	// Errors ErrEnoEnt may be returned.
+	SetMaintenance(volumeID api.VolumeID, on bool) error
+}
+
+// SetMaintenance starts or ends the maintenance of a volume of d. While in
+// maintenance IO to the volume is frozen: its mounts are remounted read-only
+// and it cannot be attached or mounted again, so that its backend can be
+// serviced. Ending the maintenance makes the mounts writable again. The
+// mounts of this node are changed before SetMaintenance returns, those of
+// other nodes once they receive the maintenance event, see
+// FollowMaintenance. If a mount of this node cannot be changed, the
+// maintenance of the volume is left as it was.
+// Errors ErrEnoEnt, ErrNotSupported may be returned.
+func SetMaintenance(d VolumeDriver, volumeID api.VolumeID, on bool) error {
+	if ms, ok := d.(MaintenanceSetter); ok {
+		return ms.SetMaintenance(volumeID, on)
+	}
+	store, ok := d.(Store)
+	if !ok {
+		return ErrNotSupported
+	}
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer store.Unlock(token)
+
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.Maintenance == on {
+		return nil
+	}
+	mounts, err := Mounts(d, volumeID)
+	if err != nil {
+		return err
+	}
+	if on {
+		// Refuse new attaches before the current mounts are frozen.
+		v.Maintenance = true
+		if err = store.UpdateVol(v); err != nil {
+			return err
+		}
+		syscall.Sync()
+		if err = remountAll(mounts, true); err != nil {
+			v.Maintenance = false
+			if uerr := store.UpdateVol(v); uerr != nil {
+				log.Warnf("Failed to end the maintenance of volume %v: %v", volumeID, uerr)
+			}
+			return err
+		}
+	} else {
+		if err = remountAll(mounts, false); err != nil {
+			return err
+		}
+		v.Maintenance = false
+		if err = store.UpdateVol(v); err != nil {
+			if rerr := remountAll(mounts, true); rerr != nil {
+				log.Warnf("Failed to freeze the mounts of volume %v again: %v", volumeID, rerr)
+			}
+			return err
+		}
+	}
+	log.Infof("Volume %v maintenance %v", volumeID, on)
+	typ := api.EventVolumeMaintenanceEnd
+	if on {
+		typ = api.EventVolumeMaintenanceStart
+	}
+	events.Publish(api.Event{Type: typ, Driver: instanceName(d), VolumeID: volumeID})
+	return nil
+}
+
+// FollowMaintenance applies the maintenance of volumes set on other nodes to
+// the mounts of the volumes on this node, until stop is closed. Events must
+// be shared between the nodes, see events.Share.
+func FollowMaintenance(stop <-chan struct{}) {
+	sub := events.Subscribe(api.EventVolumeMaintenanceStart, api.EventVolumeMaintenanceEnd)
+	defer sub.Close()
+	for {
+		select {
+		case e := <-sub.C:
+			followMaintenance(&e)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func followMaintenance(e *api.Event) {
+	// SetMaintenance changed the mounts of the node it ran on.
+	if e.Node == "" || e.Node == NodeID() {
+		return
+	}
+	d, err := Get(e.Driver)
+	if err != nil {
+		return
+	}
+	on := e.Type == api.EventVolumeMaintenanceStart
+	mounts, err := Mounts(d, e.VolumeID)
+	if err == nil {
+		if on {
+			syscall.Sync()
+		}
+		err = remountAll(mounts, on)
+	}
+	if err != nil {
+		log.Warnf("Failed to apply the maintenance %v of volume %v from node %v: %v",
+			on, e.VolumeID, e.Node, err)
+	}
+}
+
+// remountAll makes mounts read-only or writable again. If a mount fails to
+// change, the mounts changed before it are changed back.
+func remountAll(mounts []api.MountInfo, readOnly bool) error {
+	for i, m := range mounts {
+		if err := remount(m.Path, readOnly); err != nil {
+			for _, done := range mounts[:i] {
+				if rerr := remount(done.Path, !readOnly); rerr != nil {
+					log.Warnf("%v", rerr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// remount makes the mount at path read-only or writable again. Only the mount
+// at path is changed, other mounts of the same filesystem are not.
+func remount(path string, readOnly bool) error {
+	flags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND)
+	if readOnly {
+		flags |= syscall.MS_RDONLY
+	}
+	if err := syscall.Mount("", path, "", flags, ""); err != nil {
+		return fmt.Errorf("Failed to remount %v: %v", path, err)
+	}
+	return nil
+}
+
+// checkMaintenance returns ErrVolMaintenance if a volume of d is in
+// maintenance. Volumes that cannot be inspected are left for the driver to
+// report.
+func checkMaintenance(d interface{}, volumeID api.VolumeID) error {
+	e, ok := d.(Enumerator)
+	if !ok {
+		return nil
+	}
+	vols, err := e.Inspect([]api.VolumeID{volumeID})
+	if err != nil || len(vols) != 1 {
+		return nil
+	}
+	if vols[0].Maintenance {
+		return ErrVolMaintenance
+	}
+	return nil
+}
+
+// ErrNodeMaintenance is returned when attaching volumes on a node in
+// maintenance.
+var ErrNodeMaintenance = errors.New("Node is in maintenance")
+
+var (
+	nodeMaintenanceLock sync.Mutex
+	nodeMaintenance     func() bool
+)
+
+// SetNodeMaintenance sets the function reporting whether this node is in
+// maintenance. Volumes are not attached on a node in maintenance. Nodes are
+// never in maintenance if it is not set.
+func SetNodeMaintenance(inMaintenance func() bool) {
+	nodeMaintenanceLock.Lock()
+	defer nodeMaintenanceLock.Unlock()
+	nodeMaintenance = inMaintenance
+}
+
+// checkNodeMaintenance returns ErrNodeMaintenance if this node is in
+// maintenance.
+func checkNodeMaintenance() error {
+	nodeMaintenanceLock.Lock()
+	inMaintenance := nodeMaintenance
+	nodeMaintenanceLock.Unlock()
+	if inMaintenance != nil && inMaintenance() {
+		return ErrNodeMaintenance
+	}
+	return nil
+}
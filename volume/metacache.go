@@ -0,0 +1,169 @@
+package volume
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// CacheTTLParam DriverParams key for the number of seconds volume
+	// metadata is served from the cache of the driver for reads at
+	// ConsistencyCached, 0 disables the cache.
+	CacheTTLParam = "cache_ttl"
+	// DefaultCacheTTL number of seconds volume metadata is cached.
+	DefaultCacheTTL = 30
+)
+
+// CacheConfigurer is implemented by drivers that cache volume metadata,
+// such as those embedding DefaultEnumerator.
+type CacheConfigurer interface {
+	// SetCacheTTL sets how long volumes are served from the cache, ttl <= 0
+	// disables the cache.
+	SetCacheTTL(ttl time.Duration)
+}
+
+// cachedVol is a volume in the cache of a DefaultEnumerator.
+type cachedVol struct {
+	vol api.Volume
+	// at time the volume was read from the KVDB or received from the watch.
+	at time.Time
+	// index KVDB index of the volume, 0 after a local update.
+	index uint64
+	// deleted marks volumes deleted since the cache was filled, so that
+	// fillCache does not add them back from an older read.
+	deleted bool
+}
+
+// errCacheStopped stops the watch of the cache of a driver shut down.
+var errCacheStopped = errors.New("Volume cache stopped")
+
+// cacheStopper is implemented by drivers embedding DefaultEnumerator.
+type cacheStopper interface {
+	stopCache()
+}
+
+// stopCache stops the cache of d if it has one.
+func stopCache(d interface{}) {
+	if c, ok := d.(cacheStopper); ok {
+		c.stopCache()
+	}
+}
+
+// setCacheTTL applies CacheTTLParam of params to d.
+func setCacheTTL(d VolumeDriver, params DriverParams) error {
+	c, ok := d.(CacheConfigurer)
+	if !ok {
+		return nil
+	}
+	ttl, err := intParam(params, CacheTTLParam, DefaultCacheTTL)
+	if err != nil {
+		return err
+	}
+	c.SetCacheTTL(time.Duration(ttl) * time.Second)
+	return nil
+}
+
+// SetCacheTTL sets how long volumes are served from the cache for reads at
+// ConsistencyCached. The cache is kept up to date by watching the KVDB, the
+// TTL bounds how stale it gets if changes are missed.
+func (e *DefaultEnumerator) SetCacheTTL(ttl time.Duration) {
+	e.cacheLock.Lock()
+	defer e.cacheLock.Unlock()
+	e.cacheTTL = ttl
+}
+
+// watchCache starts watching the volumes of e to update the cache, unless
+// they are watched already. Without a watch the cache is only refreshed
+// every TTL.
+func (e *DefaultEnumerator) watchCache() {
+	e.cacheLock.Lock()
+	if e.cacheWatched || e.cacheStopped || e.cacheTTL <= 0 {
+		e.cacheLock.Unlock()
+		return
+	}
+	e.cacheWatched = true
+	e.cacheLock.Unlock()
+	if err := e.kvdb.WatchTree(e.volKeyPrefix, 0, nil, e.cacheWatch); err != nil {
+		log.Warnf("%s: cannot watch volumes, the cache is refreshed every %v: %v",
+			e.driver, e.cacheTTL, err)
+	}
+}
+
+// cacheWatch applies the changes of volumes to the cache. If the watch
+// fails the cache is dropped, the next cached read starts a new watch.
+func (e *DefaultEnumerator) cacheWatch(prefix string,
+	opaque interface{},
+	kvp *kvdb.KVPair,
+	err error) error {
+	e.cacheLock.Lock()
+	defer e.cacheLock.Unlock()
+	if e.cacheStopped {
+		return errCacheStopped
+	}
+	if err != nil {
+		log.Warnf("%s: stopped watching volumes, dropping the cache: %v", e.driver, err)
+		e.cache = make(map[api.VolumeID]cachedVol)
+		e.cacheWarm = false
+		e.cacheWatched = false
+		return err
+	}
+	if kvp == nil {
+		return nil
+	}
+	id := api.VolumeID(strings.TrimPrefix(kvp.Key, e.volKeyPrefix))
+	if c, ok := e.cache[id]; ok && c.index > kvp.ModifiedIndex {
+		return nil
+	}
+	switch kvp.Action {
+	case kvdb.KVDelete, kvdb.KVExpire:
+		e.cache[id] = cachedVol{at: time.Now(), index: kvp.ModifiedIndex, deleted: true}
+	default:
+		var vol api.Volume
+		if err := json.Unmarshal(kvp.Value, &vol); err != nil {
+			log.Warnf("%s: dropping malformed volume %s from the cache: %v", e.driver, kvp.Key, err)
+			delete(e.cache, id)
+			e.cacheWarm = false
+			return nil
+		}
+		e.cache[id] = cachedVol{vol: vol, at: time.Now(), index: kvp.ModifiedIndex}
+	}
+	return nil
+}
+
+// fillCache replaces the cache with the volumes read from the KVDB from
+// start. Changes the cache received since start, from the watch or local
+// updates, are newer than those read and are kept.
+func (e *DefaultEnumerator) fillCache(read map[api.VolumeID]cachedVol, start time.Time) {
+	e.cacheLock.Lock()
+	defer e.cacheLock.Unlock()
+	for id, c := range e.cache {
+		r, ok := read[id]
+		newer := !c.at.Before(start)
+		if ok && c.index != 0 {
+			newer = c.index > r.index
+		}
+		if newer {
+			read[id] = c
+		}
+	}
+	e.cache = read
+	e.cacheWarm = true
+	e.cacheWarmAt = time.Now()
+}
+
+// stopCache stops watching the volumes of e and drops the cache once the
+// driver is shut down. The watch ends on the next change it receives.
+func (e *DefaultEnumerator) stopCache() {
+	e.cacheLock.Lock()
+	defer e.cacheLock.Unlock()
+	e.cacheStopped = true
+	e.cache = make(map[api.VolumeID]cachedVol)
+	e.cacheWarm = false
+}
@@ -0,0 +1,552 @@
+// Package mock provides a VolumeDriver that keeps its volumes and snapshots
+// in memory, for unit-testing orchestrators that consume the VolumeDriver
+// interface without any real storage.
+//
+// The responses and latencies of each method can be scripted:
+//
+//	d := mock.New()
+//	d.On("Attach", mock.Behavior{Latency: time.Second})
+//	d.On("Create", mock.Behavior{Err: volume.ErrNoSpace, Times: 1})
+//
+// Calls without a script follow the semantics and errors of the volume
+// package, and every call is recorded so that tests can verify what the
+// orchestrator did.
+package mock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	Name = "mock"
+	Type = volume.Block | volume.File
+
+	// devicePrefix of the device paths of attached volumes.
+	devicePrefix = "/dev/mock/"
+)
+
+// Behavior scripts the calls of a method.
+type Behavior struct {
+	// Latency delays the calls.
+	Latency time.Duration
+	// Err fails the calls, the state of the driver is not changed.
+	Err error
+	// Results replace the results of the calls other than the error, in
+	// the order of the method signature, such as []interface{}{"/dev/sdb"}
+	// for Attach. The state of the driver is not changed.
+	Results []interface{}
+	// Times number of calls the behavior applies to, all calls if 0.
+	Times int
+}
+
+// result returns the i-th scripted result, nil if none.
+func (b *Behavior) result(i int) interface{} {
+	if i < len(b.Results) {
+		return b.Results[i]
+	}
+	return nil
+}
+
+// Call is a recorded call of the driver.
+type Call struct {
+	// Method called, such as "Create".
+	Method string
+	// Args of the call, in the order of the method signature.
+	Args []interface{}
+	// Time of the call.
+	Time time.Time
+}
+
+// Driver is an in-memory VolumeDriver whose behavior can be scripted.
+type Driver struct {
+	lock    sync.Mutex
+	next    int
+	vols    map[api.VolumeID]*api.Volume
+	snaps   map[api.SnapID]*api.VolumeSnap
+	stats   map[api.VolumeID]api.VolumeStats
+	mounts  map[api.VolumeID]string
+	scripts map[string][]*Behavior
+	calls   []Call
+}
+
+// New returns an empty driver.
+func New() *Driver {
+	d := &Driver{}
+	d.Reset()
+	return d
+}
+
+// Init starts an empty driver, params are ignored.
+func Init(c *volume.DriverContext) (volume.VolumeDriver, error) {
+	return New(), nil
+}
+
+// Reset drops the volumes, snapshots, scripts and calls of d.
+func (d *Driver) Reset() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.next = 0
+	d.vols = make(map[api.VolumeID]*api.Volume)
+	d.snaps = make(map[api.SnapID]*api.VolumeSnap)
+	d.stats = make(map[api.VolumeID]api.VolumeStats)
+	d.mounts = make(map[api.VolumeID]string)
+	d.scripts = make(map[string][]*Behavior)
+	d.calls = nil
+}
+
+// On scripts the calls of method, the name of a VolumeDriver method such as
+// "Create". Behaviors of a method apply in the order they were added: a
+// behavior with Times applies to that many calls, then the next one applies.
+func (d *Driver) On(method string, b Behavior) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.scripts[method] = append(d.scripts[method], &b)
+}
+
+// SetStats sets the stats returned for volumeID.
+func (d *Driver) SetStats(volumeID api.VolumeID, stats api.VolumeStats) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.stats[volumeID] = stats
+}
+
+// Calls returns the calls of method, of all methods if method is empty,
+// oldest first.
+func (d *Driver) Calls(method string) []Call {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	calls := make([]Call, 0)
+	for _, c := range d.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// call records a call of method and applies its script. It returns the
+// behavior if the call is scripted to fail or to return results, nil if
+// the call is to be served.
+func (d *Driver) call(method string, args ...interface{}) *Behavior {
+	d.lock.Lock()
+	d.calls = append(d.calls, Call{Method: method, Args: args, Time: time.Now()})
+	var b *Behavior
+	if script := d.scripts[method]; len(script) != 0 {
+		b = script[0]
+		if b.Times > 0 {
+			if b.Times--; b.Times == 0 {
+				d.scripts[method] = script[1:]
+			}
+		}
+	}
+	d.lock.Unlock()
+	if b == nil {
+		return nil
+	}
+	if b.Latency > 0 {
+		time.Sleep(b.Latency)
+	}
+	if b.Err != nil || b.Results != nil {
+		return b
+	}
+	return nil
+}
+
+func copyVol(v *api.Volume) api.Volume {
+	c := *v
+	if v.Spec != nil {
+		spec := *v.Spec
+		c.Spec = &spec
+	}
+	return c
+}
+
+func hasLabels(set api.Labels, subset api.Labels) bool {
+	for k, v := range subset {
+		if set[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Driver) hasSnaps(volumeID api.VolumeID) bool {
+	for _, s := range d.snaps {
+		if s.VolumeID == volumeID {
+			return true
+		}
+	}
+	return false
+}
+
+// mountable returns ErrEnoEnt if volumeID is neither a volume nor a
+// writable snapshot.
+func (d *Driver) mountable(volumeID api.VolumeID) error {
+	if _, ok := d.vols[volumeID]; ok {
+		return nil
+	}
+	s, ok := d.snaps[api.SnapID(volumeID)]
+	if !ok {
+		return volume.ErrEnoEnt
+	}
+	if !s.Writable {
+		return volume.ErrSnapReadOnly
+	}
+	return nil
+}
+
+func (d *Driver) String() string {
+	return Name
+}
+
+func (d *Driver) Type() volume.DriverType {
+	return Type
+}
+
+func (d *Driver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+	if b := d.call("Create", locator, options, spec); b != nil {
+		id, _ := b.result(0).(api.VolumeID)
+		return id, b.Err
+	}
+	if spec == nil {
+		return api.BadVolumeID, volume.ErrEinval
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if locator.Name != "" {
+		for _, v := range d.vols {
+			if v.Locator.Name != locator.Name {
+				continue
+			}
+			if options != nil && options.FailIfExists {
+				return api.BadVolumeID, volume.ErrEexist
+			}
+			return v.ID, nil
+		}
+	}
+	d.next++
+	s := *spec
+	v := &api.Volume{
+		ID:      api.VolumeID(fmt.Sprintf("%s-%d", Name, d.next)),
+		Locator: locator,
+		Ctime:   time.Now(),
+		Spec:    &s,
+		Status:  api.Up,
+		State:   api.VolumeAvailable,
+		Parent:  api.BadSnapID,
+	}
+	if options != nil && options.CreateFromSnap != api.BadSnapID {
+		if _, ok := d.snaps[options.CreateFromSnap]; !ok {
+			return api.BadVolumeID, volume.ErrEnoEnt
+		}
+		v.Parent = options.CreateFromSnap
+	}
+	d.vols[v.ID] = v
+	return v.ID, nil
+}
+
+func (d *Driver) Delete(volumeID api.VolumeID) error {
+	if b := d.call("Delete", volumeID); b != nil {
+		return b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	v, ok := d.vols[volumeID]
+	if !ok {
+		return volume.ErrEnoEnt
+	}
+	if v.DevicePath != "" || d.mounts[volumeID] != "" {
+		return volume.ErrVolAttached
+	}
+	if d.hasSnaps(volumeID) {
+		return volume.ErrVolHasSnaps
+	}
+	delete(d.vols, volumeID)
+	delete(d.stats, volumeID)
+	return nil
+}
+
+func (d *Driver) Mount(volumeID api.VolumeID, mountpath string) error {
+	if b := d.call("Mount", volumeID, mountpath); b != nil {
+		return b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.mountable(volumeID); err != nil {
+		return err
+	}
+	if p := d.mounts[volumeID]; p != "" && p != mountpath {
+		return volume.ErrVolAttached
+	}
+	d.mounts[volumeID] = mountpath
+	if v, ok := d.vols[volumeID]; ok {
+		v.AttachPath = mountpath
+	}
+	return nil
+}
+
+func (d *Driver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	if b := d.call("Unmount", volumeID, mountpath); b != nil {
+		return b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.mountable(volumeID); err != nil {
+		return err
+	}
+	if p := d.mounts[volumeID]; p == "" || p != mountpath {
+		return volume.ErrVolDetached
+	}
+	delete(d.mounts, volumeID)
+	if v, ok := d.vols[volumeID]; ok {
+		v.AttachPath = ""
+	}
+	return nil
+}
+
+func (d *Driver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	if b := d.call("Snapshot", volumeID, labels, writable); b != nil {
+		id, _ := b.result(0).(api.SnapID)
+		return id, b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	v, ok := d.vols[volumeID]
+	if !ok {
+		return api.BadSnapID, volume.ErrEnoEnt
+	}
+	d.next++
+	s := &api.VolumeSnap{
+		ID:         api.SnapID(fmt.Sprintf("%s-snap-%d", Name, d.next)),
+		VolumeID:   volumeID,
+		Ctime:      time.Now(),
+		SnapLabels: labels,
+		Writable:   writable,
+		Usage:      v.Usage,
+	}
+	d.snaps[s.ID] = s
+	return s.ID, nil
+}
+
+func (d *Driver) SnapDelete(snapID api.SnapID) error {
+	if b := d.call("SnapDelete", snapID); b != nil {
+		return b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.snaps[snapID]; !ok {
+		return volume.ErrEnoEnt
+	}
+	if d.mounts[api.VolumeID(snapID)] != "" {
+		return volume.ErrVolAttached
+	}
+	delete(d.snaps, snapID)
+	return nil
+}
+
+func (d *Driver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	if b := d.call("Stats", volumeID); b != nil {
+		stats, _ := b.result(0).(api.VolumeStats)
+		return stats, b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.vols[volumeID]; !ok {
+		return api.VolumeStats{}, volume.ErrEnoEnt
+	}
+	return d.stats[volumeID], nil
+}
+
+func (d *Driver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	if b := d.call("Alerts", volumeID); b != nil {
+		alerts, _ := b.result(0).(api.VolumeAlerts)
+		return alerts, b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.vols[volumeID]; !ok {
+		return api.VolumeAlerts{}, volume.ErrEnoEnt
+	}
+	return api.VolumeAlerts{}, nil
+}
+
+func (d *Driver) Status() api.DriverStatus {
+	if b := d.call("Status"); b != nil {
+		status, _ := b.result(0).(api.DriverStatus)
+		return status
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return api.DriverStatus{
+		Driver: Name,
+		Details: [][2]string{
+			{"Volumes", fmt.Sprint(len(d.vols))},
+			{"Snapshots", fmt.Sprint(len(d.snaps))},
+		},
+	}
+}
+
+func (d *Driver) HealthCheck() []api.HealthReason {
+	if b := d.call("HealthCheck"); b != nil {
+		reasons, _ := b.result(0).([]api.HealthReason)
+		return reasons
+	}
+	return nil
+}
+
+func (d *Driver) Shutdown() {
+	d.call("Shutdown")
+}
+
+func (d *Driver) Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error) {
+	if b := d.call("Attach", volumeID, options); b != nil {
+		path, _ := b.result(0).(string)
+		return path, b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	v, ok := d.vols[volumeID]
+	if !ok {
+		return "", volume.ErrEnoEnt
+	}
+	if v.DevicePath == "" {
+		v.DevicePath = devicePrefix + string(volumeID)
+		v.State = api.VolumeAttached
+	}
+	return v.DevicePath, nil
+}
+
+func (d *Driver) Format(volumeID api.VolumeID) error {
+	if b := d.call("Format", volumeID); b != nil {
+		return b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	v, ok := d.vols[volumeID]
+	if !ok {
+		return volume.ErrEnoEnt
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	v.Format = v.Spec.Format
+	return nil
+}
+
+func (d *Driver) Detach(volumeID api.VolumeID) error {
+	if b := d.call("Detach", volumeID); b != nil {
+		return b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	v, ok := d.vols[volumeID]
+	if !ok {
+		return volume.ErrEnoEnt
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	if d.mounts[volumeID] != "" {
+		return volume.ErrVolAttached
+	}
+	v.DevicePath = ""
+	v.State = api.VolumeDetached
+	return nil
+}
+
+func (d *Driver) Inspect(volumeIDs []api.VolumeID) ([]api.Volume, error) {
+	if b := d.call("Inspect", volumeIDs); b != nil {
+		vols, _ := b.result(0).([]api.Volume)
+		return vols, b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	vols := make([]api.Volume, 0, len(volumeIDs))
+	for _, id := range volumeIDs {
+		if v, ok := d.vols[id]; ok {
+			vols = append(vols, copyVol(v))
+		}
+	}
+	return vols, nil
+}
+
+func (d *Driver) Enumerate(locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error) {
+	if b := d.call("Enumerate", locator, labels); b != nil {
+		vols, _ := b.result(0).([]api.Volume)
+		return vols, b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	vols := make([]api.Volume, 0)
+	for _, v := range d.vols {
+		if locator.Name != "" && v.Locator.Name != locator.Name {
+			continue
+		}
+		if locator.Group != "" && v.Locator.Group != locator.Group {
+			continue
+		}
+		if !hasLabels(v.Locator.VolumeLabels, locator.VolumeLabels) ||
+			!hasLabels(v.Spec.ConfigLabels, labels) {
+			continue
+		}
+		vols = append(vols, copyVol(v))
+	}
+	return vols, nil
+}
+
+func (d *Driver) SnapInspect(snapIDs []api.SnapID) ([]api.VolumeSnap, error) {
+	if b := d.call("SnapInspect", snapIDs); b != nil {
+		snaps, _ := b.result(0).([]api.VolumeSnap)
+		return snaps, b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	snaps := make([]api.VolumeSnap, 0, len(snapIDs))
+	for _, id := range snapIDs {
+		if s, ok := d.snaps[id]; ok {
+			snaps = append(snaps, *s)
+		}
+	}
+	return snaps, nil
+}
+
+func (d *Driver) SnapEnumerate(volumeIDs []api.VolumeID, snapLabels api.Labels) ([]api.VolumeSnap, error) {
+	if b := d.call("SnapEnumerate", volumeIDs, snapLabels); b != nil {
+		snaps, _ := b.result(0).([]api.VolumeSnap)
+		return snaps, b.Err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	snaps := make([]api.VolumeSnap, 0)
+	for _, s := range d.snaps {
+		if !hasLabels(s.SnapLabels, snapLabels) {
+			continue
+		}
+		if len(volumeIDs) != 0 && !containsVol(volumeIDs, s.VolumeID) {
+			continue
+		}
+		snaps = append(snaps, *s)
+	}
+	return snaps, nil
+}
+
+func containsVol(ids []api.VolumeID, id api.VolumeID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	// Register ourselves as an openstorage volume driver.
+	volume.Register(Name, Init)
+}
@@ -0,0 +1,52 @@
+package mock
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+	"github.com/libopenstorage/openstorage/volume/drivertest"
+)
+
+func TestConformance(t *testing.T) {
+	drivertest.RunVolumeDriverTests(t, New())
+}
+
+func TestScript(t *testing.T) {
+	d := New()
+	failed := errors.New("backend down")
+	d.On("Create", Behavior{Err: failed, Times: 1})
+	d.On("Create", Behavior{Latency: 20 * time.Millisecond})
+	d.On("Attach", Behavior{Results: []interface{}{"/dev/sdz"}})
+
+	spec := &api.VolumeSpec{Size: 1 << 30}
+	_, err := d.Create(api.VolumeLocator{Name: "v"}, nil, spec)
+	assert.Equal(t, failed, err)
+	vols, _ := d.Enumerate(api.VolumeLocator{}, nil)
+	assert.Empty(t, vols, "Failed create changed the driver")
+
+	start := time.Now()
+	id, err := d.Create(api.VolumeLocator{Name: "v"}, nil, spec)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond, "Latency not applied")
+
+	path, err := d.Attach(id, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/sdz", path)
+	assert.Equal(t, volume.ErrVolDetached, d.Detach(id), "Scripted attach changed the driver")
+
+	calls := d.Calls("Create")
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "v", calls[1].Args[0].(api.VolumeLocator).Name)
+	}
+	assert.Len(t, d.Calls(""), 5)
+
+	d.Reset()
+	assert.Empty(t, d.Calls(""))
+	_, err = d.Create(api.VolumeLocator{Name: "v"}, nil, spec)
+	assert.NoError(t, err, "Script not reset")
+}
@@ -0,0 +1,115 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+)
+
+// propagationFlags are the mount flags of each propagation.
+var propagationFlags = map[api.MountPropagation]uintptr{
+	api.PropagationPrivate: syscall.MS_PRIVATE | syscall.MS_REC,
+	api.PropagationShared:  syscall.MS_SHARED | syscall.MS_REC,
+	api.PropagationSlave:   syscall.MS_SLAVE | syscall.MS_REC,
+}
+
+// OptionsMounter is implemented by drivers that apply MountOptions
+// themselves, such as clients of a remote node. Use MountWithOptions to
+// mount a volume of any driver with options.
+type OptionsMounter interface {
+	// MountWithOptions mounts volumeID at mountpath as options ask.
+	// Errors ErrEnoEnt, ErrVolDetached may be returned.
+	MountWithOptions(volumeID api.VolumeID, mountpath string, options *api.MountOptions) error
+}
+
+// MountWithOptions mounts a volume of d at mountpath as MountCtx does and
+// applies options to the mount, so that container runtimes get a mount with
+// the right labels and propagation. The files of the volume are relabeled,
+// then the mount is made read-only and its propagation set. The volume is
+// unmounted again if the options cannot be applied. If options.SubPath is
+// set, only that directory of the volume is bind mounted at mountpath, which
+// drivers that do not implement Store do not support. If options.Remount is
+// set, the options of the mount at mountpath, which must be a mount of the
+// volume, are changed and the driver is not called.
+// Errors ErrEnoEnt, ErrNotMounted, ErrNotSupported, ErrVolDetached,
+// ErrVolMaintenance may be returned.
+func MountWithOptions(ctx context.Context,
+	d ProtoDriver,
+	volumeID api.VolumeID,
+	mountpath string,
+	options *api.MountOptions) error {
+	if options == nil {
+		return MountCtx(ctx, d, volumeID, mountpath)
+	}
+	if _, ok := propagationFlags[options.Propagation]; !ok && options.Propagation != api.PropagationNone {
+		return fmt.Errorf("Invalid mount propagation %q", options.Propagation)
+	}
+	if err := checkSubPath(options.SubPath); err != nil {
+		return err
+	}
+	if om, ok := d.(OptionsMounter); ok {
+		if err := checkMaintenance(d, volumeID); err != nil {
+			return err
+		}
+		err := RunContext(ctx, func() error { return om.MountWithOptions(volumeID, mountpath, options) })
+		if err == nil && !options.Remount {
+			recordUsage(d, volumeID, api.UsageMount, mountpath)
+		}
+		return err
+	}
+	if options.Remount {
+		// Volumes in maintenance must stay read-only.
+		if err := checkMaintenance(d, volumeID); err != nil {
+			return err
+		}
+		if err := checkMounted(d, volumeID, mountpath); err != nil {
+			return err
+		}
+		return applyMountOptions(mountpath, options)
+	}
+	var err error
+	if options.SubPath != "" {
+		err = mountSubpath(ctx, d, volumeID, mountpath, options.SubPath)
+	} else {
+		err = MountCtx(ctx, d, volumeID, mountpath)
+	}
+	if err != nil {
+		return err
+	}
+	if err = applyMountOptions(mountpath, options); err != nil {
+		if uerr := UnmountCtx(ctx, d, volumeID, mountpath); uerr != nil {
+			log.Warnf("Failed to unmount volume %v from %s: %v", volumeID, mountpath, uerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// applyMountOptions applies options to the mount at path.
+func applyMountOptions(path string, options *api.MountOptions) error {
+	// A read-only mount is made writable again before it is relabeled.
+	if options.Remount && !options.ReadOnly {
+		if err := remount(path, false); err != nil {
+			return err
+		}
+	}
+	if err := fs.Relabel(path, options.SELinuxLabel); err != nil {
+		return fmt.Errorf("Failed to relabel %v: %v", path, err)
+	}
+	if options.ReadOnly {
+		if err := remount(path, true); err != nil {
+			return err
+		}
+	}
+	if flags, ok := propagationFlags[options.Propagation]; ok {
+		if err := syscall.Mount("", path, "", flags, ""); err != nil {
+			return fmt.Errorf("Failed to make %v %s: %v", path, options.Propagation, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package volume
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type optionsDriver struct {
+	historyDriver
+	options []api.MountOptions
+}
+
+func (d *optionsDriver) MountWithOptions(volumeID api.VolumeID, mountpath string, options *api.MountOptions) error {
+	d.options = append(d.options, *options)
+	return nil
+}
+
+func TestMountWithOptions(t *testing.T) {
+	d := &optionsDriver{}
+	d.DefaultEnumerator = NewDefaultEnumerator("mountopts_test", kvdb.Instance())
+	vol := &api.Volume{ID: "mountopts_test_vol", Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(vol))
+	defer d.DeleteVol(vol.ID)
+	ctx := context.Background()
+
+	err := MountWithOptions(ctx, d, vol.ID, "/mnt/opts", &api.MountOptions{Propagation: "shared"})
+	assert.Error(t, err, "Invalid propagation accepted")
+	assert.Empty(t, d.options)
+
+	options := api.MountOptions{
+		ReadOnly:     true,
+		SELinuxLabel: "system_u:object_r:container_file_t:s0",
+		Propagation:  api.PropagationSlave,
+	}
+	assert.NoError(t, MountWithOptions(ctx, d, vol.ID, "/mnt/opts", &options))
+	remount := api.MountOptions{Remount: true}
+	assert.NoError(t, MountWithOptions(ctx, d, vol.ID, "/mnt/opts", &remount))
+	assert.Equal(t, []api.MountOptions{options, remount}, d.options)
+
+	// Mounts without options go to Mount.
+	assert.NoError(t, MountWithOptions(ctx, d, vol.ID, "/mnt/opts", nil))
+	assert.Len(t, d.options, 2)
+
+	events, err := History(d, vol.ID)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2, "Remount recorded as a mount")
+
+	// Only the mounts of the volume are remounted by the package.
+	hd := &d.historyDriver
+	vol.AttachPath = "/mnt/opts"
+	assert.NoError(t, d.UpdateVol(vol))
+	err = MountWithOptions(ctx, hd, vol.ID, "/", &api.MountOptions{Remount: true, ReadOnly: true})
+	assert.Equal(t, ErrNotMounted, err, "Host path remounted")
+	err = ForceUnmount(ctx, hd, vol.ID, "/", &api.DetachOptions{Kill: true})
+	assert.Equal(t, ErrNotMounted, err, "Users of a host path killed")
+	assert.NoError(t, checkMounted(hd, vol.ID, "/mnt/opts/"))
+}
+
+func TestSubpathDir(t *testing.T) {
+	for _, sub := range []string{"/data", "..", "../other", "a/../../b"} {
+		assert.Error(t, checkSubPath(sub), "Sub path %q accepted", sub)
+	}
+	for _, sub := range []string{"", "data", "a/b/", "a/../b"} {
+		assert.NoError(t, checkSubPath(sub), "Sub path %q rejected", sub)
+	}
+
+	root, err := ioutil.TempDir("", "subpath_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	root, err = filepath.EvalSymlinks(root)
+	assert.NoError(t, err)
+
+	dir, err := openSubpath(root, "a/b")
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.Join(root, "a/b"), dir.Name())
+		info, err := dir.Stat()
+		if assert.NoError(t, err) {
+			assert.True(t, info.IsDir())
+		}
+		dir.Close()
+	}
+	dir, err = openSubpath(root, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, root, dir.Name())
+		dir.Close()
+	}
+
+	assert.NoError(t, os.Symlink("a", filepath.Join(root, "in")))
+	_, err = openSubpath(root, "in/b")
+	assert.Error(t, err, "Link followed")
+
+	assert.NoError(t, os.Symlink(os.TempDir(), filepath.Join(root, "out")))
+	_, err = openSubpath(root, "out/c")
+	assert.Error(t, err, "Link out of the volume followed")
+	_, err = os.Stat(filepath.Join(os.TempDir(), "c"))
+	assert.True(t, os.IsNotExist(err), "Directory created out of the volume")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "file"), nil, 0644))
+	_, err = openSubpath(root, "file")
+	assert.Error(t, err, "File opened as a directory")
+
+	assert.False(t, mountedHere(root), "Directory reported as a mount")
+}
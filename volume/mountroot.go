@@ -0,0 +1,38 @@
+package volume
+
+import (
+	"fmt"
+	"path"
+)
+
+const (
+	// MountRootParam DriverParams key for the directory drivers mount their
+	// backends and volumes under. Each driver instance mounts under a
+	// directory of its own in it.
+	MountRootParam = "mount_root"
+	// MountLabelParam DriverParams key for the SELinux context the
+	// directories a driver creates are labeled with, such as
+	// system_u:object_r:container_file_t:s0. They are not labeled if empty.
+	MountLabelParam = "mount_selinux_label"
+	// DefaultMountRoot directory drivers mount under.
+	DefaultMountRoot = "/var/lib/openstorage"
+)
+
+// MountRoot returns the directory the instance of driver started with params
+// mounts under, named after the instance so that instances of the same
+// driver do not share it. Drivers not started with New use the directory
+// named after driver.
+func MountRoot(params DriverParams, driver string) (string, error) {
+	root := params[MountRootParam]
+	if root == "" {
+		root = DefaultMountRoot
+	}
+	if !path.IsAbs(root) {
+		return "", fmt.Errorf("Invalid %s %q, must be an absolute path", MountRootParam, root)
+	}
+	name := params[InstanceNameParam]
+	if name == "" {
+		name = driver
+	}
+	return path.Join(root, name), nil
+}
@@ -0,0 +1,102 @@
+package volume
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+)
+
+// MountLister is implemented by drivers that report the mounts of their
+// volumes themselves, such as clients of a remote node. Use Mounts to list
+// the mounts of a volume of any driver.
+type MountLister interface {
+	// Mounts returns the paths volumeID is mounted at and the processes
+	// using them.
+	// Errors ErrEnoEnt may be returned.
+	Mounts(volumeID api.VolumeID) ([]api.MountInfo, error)
+}
+
+// Mounts returns the paths a volume of d is mounted at on this node and the
+// processes using them. The mount table is searched for mounts of the
+// device or directory of the volume, including bind mounts made by container
+// runtimes, and the mount recorded by the driver is reported even if it is
+// missing from the table. It helps to find out why a volume is busy.
+// Errors ErrEnoEnt may be returned.
+func Mounts(d VolumeDriver, volumeID api.VolumeID) ([]api.MountInfo, error) {
+	if ml, ok := d.(MountLister); ok {
+		return ml.Mounts(volumeID)
+	}
+	vols, err := d.Inspect([]api.VolumeID{volumeID})
+	if err != nil {
+		return nil, err
+	}
+	if len(vols) != 1 {
+		return nil, ErrEnoEnt
+	}
+	table, err := fs.MountTable()
+	if err != nil {
+		return nil, err
+	}
+	return mounts(table, d, &vols[0]), nil
+}
+
+func mounts(table []fs.Mount, d VolumeDriver, v *api.Volume) []api.MountInfo {
+	var infos []api.MountInfo
+	recorded := false
+	if v.DevicePath != "" {
+		source := TopDevice(d, v.ID, v.DevicePath)
+		for _, m := range fs.MountsOf(table, source) {
+			infos = append(infos, api.MountInfo{
+				Path:     m.Path,
+				Source:   m.Source,
+				Fstype:   m.Fstype,
+				Options:  m.Options,
+				Recorded: m.Path == v.AttachPath,
+			})
+			recorded = recorded || m.Path == v.AttachPath
+		}
+	}
+	if v.AttachPath != "" && !recorded {
+		infos = append(infos, api.MountInfo{
+			Path:     v.AttachPath,
+			Source:   v.DevicePath,
+			Recorded: true,
+		})
+	}
+	for i := range infos {
+		// Processes cannot be found if /proc is not readable, the mounts
+		// are still worth reporting.
+		infos[i].Processes, _ = fs.Users(infos[i].Path)
+	}
+	sort.Sort(byPath(infos))
+	return infos
+}
+
+// checkMounted fails with ErrNotMounted unless mountpath is one of the
+// mounts of volumeID on this node, so that calls acting on the mounts of a
+// volume cannot be pointed at other paths of the host.
+func checkMounted(d interface{}, volumeID api.VolumeID, mountpath string) error {
+	vd, ok := d.(VolumeDriver)
+	if !ok {
+		return ErrNotSupported
+	}
+	mounts, err := Mounts(vd, volumeID)
+	if err != nil {
+		return err
+	}
+	mountpath = filepath.Clean(mountpath)
+	for _, m := range mounts {
+		if filepath.Clean(m.Path) == mountpath {
+			return nil
+		}
+	}
+	return ErrNotMounted
+}
+
+type byPath []api.MountInfo
+
+func (b byPath) Len() int           { return len(b) }
+func (b byPath) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byPath) Less(i, j int) bool { return b[i].Path < b[j].Path }
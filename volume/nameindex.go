@@ -0,0 +1,74 @@
+package volume
+
+import (
+	"encoding/json"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// Volumes are looked up by name, as the Docker plugin and creates that
+// FailIfExists do, with a Get of the reservation of the name, see
+// reserveName, instead of reading every volume of the driver. The names of
+// the volumes created before names were reserved are reserved once.
+const namesReady = "/names.reserved"
+
+// lookupName returns the ID of the volume named name, if any. The volume
+// must still be checked for the name, the reservation may be stale. It
+// returns false if names are not reserved on the driver, the volumes must
+// then be enumerated.
+func (e *DefaultEnumerator) lookupName(name string) ([]api.VolumeID, bool, error) {
+	if !e.enforceNames() {
+		return nil, false, nil
+	}
+	if err := e.reserveNames(); err != nil {
+		return nil, false, err
+	}
+	_, cur, err := e.reservation(name)
+	if err == kvdb.ErrNotFound {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return []api.VolumeID{cur.VolumeID}, true, nil
+}
+
+// reserveNames reserves the names of the volumes created before names were
+// reserved. It runs once per driver.
+func (e *DefaultEnumerator) reserveNames() error {
+	e.indexLock.Lock()
+	defer e.indexLock.Unlock()
+	if e.namesReserved {
+		return nil
+	}
+	if _, err := e.kvdb.Get(e.namesReadyKey); err == nil {
+		e.namesReserved = true
+		return nil
+	}
+	kvp, err := e.kvdb.Enumerate(e.volKeyPrefix)
+	if err != nil {
+		return err
+	}
+	log.Infof("Reserving the names of %d %s volumes", len(kvp), e.driver)
+	for _, v := range kvp {
+		var vol api.Volume
+		if err = json.Unmarshal(v.Value, &vol); err != nil {
+			return err
+		}
+		if vol.Locator.Name == "" {
+			continue
+		}
+		r := &nameReservation{VolumeID: vol.ID, Reserved: vol.Ctime}
+		if _, err = e.kvdb.Create(e.nameKey(vol.Locator.Name), r, 0); err != nil && err != kvdb.ErrExist {
+			return err
+		}
+	}
+	if _, err = e.kvdb.Put(e.namesReadyKey, true, 0); err != nil {
+		return err
+	}
+	e.namesReserved = true
+	return nil
+}
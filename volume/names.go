@@ -0,0 +1,214 @@
+package volume
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// UniqueNamesParam DriverParams key, volume names must be unique per
+	// driver instance unless set to false.
+	UniqueNamesParam = "unique_names"
+
+	names = "/names/"
+	// staleReservation time after which the reservation of a name by a
+	// volume that does not exist is released. It covers creates
+	// interrupted between reserving the name and storing the volume.
+	staleReservation = time.Minute
+)
+
+// LocatorUpdater is implemented by drivers that update the locators of their
+// volumes themselves, such as clients of a remote node. Use UpdateLocator to
+// rename a volume of any driver.
+type LocatorUpdater interface {
+	// UpdateLocator replaces the locator of volumeID.
+	// Errors ErrEnoEnt, ErrEexist may be returned.
+	UpdateLocator(volumeID api.VolumeID, locator api.VolumeLocator) error
+}
+
+var (
+	namesLock sync.Mutex
+	// sharedNames driver instances that allow volumes with the same name.
+	sharedNames = make(map[string]bool)
+)
+
+// uniqueNames reads UniqueNamesParam from params.
+func uniqueNames(params DriverParams) (bool, error) {
+	v, ok := params[UniqueNamesParam]
+	if !ok {
+		return true, nil
+	}
+	unique, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("Invalid value %q for %s: %v", v, UniqueNamesParam, err)
+	}
+	return unique, nil
+}
+
+func setUniqueNames(name string, unique bool) {
+	namesLock.Lock()
+	defer namesLock.Unlock()
+	if unique {
+		delete(sharedNames, name)
+		return
+	}
+	sharedNames[name] = true
+}
+
+// checkName fails a create early if the name of locator is taken on a driver
+// with unique names or if options ask for it, before the driver allocates
+// storage. The name is only reserved once the volume is stored.
+// Errors ErrEexist may be returned.
+func checkName(d ProtoDriver, name string, locator api.VolumeLocator, options *api.CreateOptions) error {
+	if locator.Name == "" {
+		return nil
+	}
+	namesLock.Lock()
+	unique := name != "" && !sharedNames[name]
+	namesLock.Unlock()
+	if !unique && (options == nil || !options.FailIfExists) {
+		return nil
+	}
+	e, ok := d.(Enumerator)
+	if !ok {
+		return nil
+	}
+	vols, err := e.Enumerate(api.VolumeLocator{Name: locator.Name}, nil)
+	if err != nil {
+		return err
+	}
+	if len(vols) > 0 {
+		return ErrEexist
+	}
+	return nil
+}
+
+// nameReservation is stored under the name a volume reserves.
+type nameReservation struct {
+	VolumeID api.VolumeID
+	Reserved time.Time
+}
+
+func (e *DefaultEnumerator) nameKey(name string) string {
+	return e.nameKeyPrefix + url.QueryEscape(name)
+}
+
+// enforceNames returns whether names are reserved for volumes.
+func (e *DefaultEnumerator) enforceNames() bool {
+	namesLock.Lock()
+	defer namesLock.Unlock()
+	return !sharedNames[e.driver]
+}
+
+// reserveName reserves the name of vol in the KVDB, so that concurrent
+// creates and renames to the same name cannot both succeed. Unnamed volumes
+// are not reserved.
+// Errors ErrEexist may be returned.
+func (e *DefaultEnumerator) reserveName(vol *api.Volume) error {
+	name := vol.Locator.Name
+	if name == "" || !e.enforceNames() {
+		return nil
+	}
+	r := &nameReservation{VolumeID: vol.ID, Reserved: time.Now()}
+	_, err := e.kvdb.Create(e.nameKey(name), r, 0)
+	if err != kvdb.ErrExist {
+		return err
+	}
+	kvp, cur, err := e.reservation(name)
+	if err != nil {
+		return err
+	}
+	if cur.VolumeID == vol.ID {
+		return nil
+	}
+	if _, err = e.kvdb.Get(e.volKey(cur.VolumeID)); err != kvdb.ErrNotFound ||
+		time.Since(cur.Reserved) < staleReservation {
+		return ErrEexist
+	}
+	// The volume holding the name is gone, take the name over. Only the
+	// stale reservation read above is deleted, and Create settles
+	// concurrent takeovers.
+	log.Infof("%s: releasing name %q of missing volume %v", e.driver, name, cur.VolumeID)
+	if _, err = e.kvdb.CompareAndDelete(kvp, kvdb.KVModifiedIndex); err != nil &&
+		err != kvdb.ErrNotFound {
+		if err == kvdb.ErrModified {
+			return ErrEexist
+		}
+		return err
+	}
+	if _, err = e.kvdb.Create(e.nameKey(name), r, 0); err == kvdb.ErrExist {
+		return ErrEexist
+	}
+	return err
+}
+
+// reservation returns the reservation of name and the KVDB pair holding it.
+func (e *DefaultEnumerator) reservation(name string) (*kvdb.KVPair, *nameReservation, error) {
+	kvp, err := e.kvdb.Get(e.nameKey(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	var r nameReservation
+	if err = json.Unmarshal(kvp.Value, &r); err != nil {
+		return nil, nil, err
+	}
+	return kvp, &r, nil
+}
+
+// releaseName releases name if it is reserved by volID.
+func (e *DefaultEnumerator) releaseName(name string, volID api.VolumeID) {
+	if name == "" {
+		return
+	}
+	kvp, cur, err := e.reservation(name)
+	if err != nil || cur.VolumeID != volID {
+		return
+	}
+	// The name may be taken over in between, only release the reservation
+	// read above.
+	if _, err = e.kvdb.CompareAndDelete(kvp, kvdb.KVModifiedIndex); err != nil &&
+		err != kvdb.ErrModified && err != kvdb.ErrNotFound {
+		log.Warnf("%s: failed to release name %q of volume %v: %v", e.driver, name, volID, err)
+	}
+}
+
+// UpdateLocator replaces the locator of a volume of d. On drivers with
+// unique names the new name must not be used by another volume.
+// Errors ErrEnoEnt, ErrEexist, ErrNotSupported may be returned.
+func UpdateLocator(d VolumeDriver, volumeID api.VolumeID, locator api.VolumeLocator) error {
+	if u, ok := d.(LocatorUpdater); ok {
+		return u.UpdateLocator(volumeID, locator)
+	}
+	store, ok := d.(Store)
+	if !ok {
+		return ErrNotSupported
+	}
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer store.Unlock(token)
+
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	old := v.Locator.Name
+	v.Locator = locator
+	if err = store.UpdateVol(v); err != nil {
+		return err
+	}
+	if old != locator.Name {
+		log.Infof("Volume %v renamed from %q to %q", volumeID, old, locator.Name)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package volume
+
+import (
+	"testing"
+	"time"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestUniqueNames(t *testing.T) {
+	d := &ownershipDriver{DefaultEnumerator: NewDefaultEnumerator("names_test", kvdb.Instance())}
+	a := &api.Volume{ID: "names_test_a", Locator: api.VolumeLocator{Name: "a"}, Spec: &api.VolumeSpec{}}
+	b := &api.Volume{ID: "names_test_b", Locator: api.VolumeLocator{Name: "a"}, Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(a))
+	defer d.DeleteVol(a.ID)
+	assert.Equal(t, ErrEexist, d.CreateVol(b), "Volume created with a taken name")
+
+	b.Locator.Name = "b"
+	assert.NoError(t, d.CreateVol(b))
+	defer d.DeleteVol(b.ID)
+	assert.Equal(t, ErrEexist, UpdateLocator(d, b.ID, api.VolumeLocator{Name: "a"}), "Volume renamed to a taken name")
+
+	assert.NoError(t, UpdateLocator(d, a.ID, api.VolumeLocator{Name: "c"}))
+	vol, err := d.GetVol(a.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "c", vol.Locator.Name)
+	assert.NoError(t, UpdateLocator(d, b.ID, api.VolumeLocator{Name: "a"}), "Old name kept after rename")
+
+	assert.NoError(t, d.DeleteVol(a.ID))
+	c := &api.Volume{ID: "names_test_c", Locator: api.VolumeLocator{Name: "c"}, Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(c), "Name kept after delete")
+	defer d.DeleteVol(c.ID)
+
+	// The reservation of a volume whose create was interrupted is taken
+	// over once stale.
+	e := d.DefaultEnumerator
+	stale := &nameReservation{VolumeID: "names_test_gone", Reserved: time.Now().Add(-2 * staleReservation)}
+	_, err = kvdb.Instance().Put(e.nameKey("stale"), stale, 0)
+	assert.NoError(t, err)
+	s := &api.Volume{ID: "names_test_s", Locator: api.VolumeLocator{Name: "stale"}, Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(s), "Stale reservation not taken over")
+	defer d.DeleteVol(s.ID)
+	_, cur, err := e.reservation("stale")
+	if assert.NoError(t, err) {
+		assert.Equal(t, s.ID, cur.VolumeID)
+	}
+
+	setUniqueNames("names_test", false)
+	defer setUniqueNames("names_test", true)
+	dup := &api.Volume{ID: "names_test_dup", Locator: api.VolumeLocator{Name: "c"}, Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(dup), "Duplicate name refused with unique names disabled")
+	defer d.DeleteVol(dup.ID)
+}
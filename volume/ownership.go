@@ -0,0 +1,156 @@
+package volume
+
+import (
+	"context"
+	"errors"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// ErrPermission is returned when a principal lacks the access an operation
+// on a volume requires.
+var ErrPermission = errors.New("Permission denied")
+
+// OwnershipSetter is implemented by drivers that track the ownership of
+// their volumes themselves, such as clients of a remote node. Use Transfer
+// and SetAccess to change the ownership of a volume of any driver.
+type OwnershipSetter interface {
+	// Transfer makes owner the owner of volumeID.
+	// Errors ErrEnoEnt may be returned.
+	Transfer(volumeID api.VolumeID, owner string) error
+	// SetAccess grants principal access to volumeID, an empty access
+	// revokes it.
+	// Errors ErrEnoEnt, ErrEinval may be returned.
+	SetAccess(volumeID api.VolumeID, principal string, access api.AccessType) error
+}
+
+// principalKey is the context key of the principal operations are made for.
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx for the operations made for principal,
+// which hooks are told.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Principal returns the principal operations with ctx are made for, empty
+// for local callers.
+func Principal(ctx context.Context) string {
+	p, _ := ctx.Value(principalKey{}).(string)
+	return p
+}
+
+// accessRank orders access types, 0 for those that cannot be granted.
+func accessRank(access api.AccessType) int {
+	switch access {
+	case api.AccessRead:
+		return 1
+	case api.AccessWrite:
+		return 2
+	case api.AccessOwner:
+		return 3
+	}
+	return 0
+}
+
+// Authorize returns ErrPermission if principal lacks access to v. Anyone
+// may use volumes without an owner, the owner has all access and other
+// principals the access the volume is shared with them.
+func Authorize(v *api.Volume, principal string, access api.AccessType) error {
+	o := v.Ownership
+	if o.Owner == "" || o.Owner == principal {
+		return nil
+	}
+	if granted, ok := o.Acl[principal]; ok &&
+		accessRank(granted) >= accessRank(access) && access != api.AccessOwner {
+		return nil
+	}
+	return ErrPermission
+}
+
+// updateOwnership applies fn to the ownership of a volume of d under the
+// volume lock.
+func updateOwnership(d VolumeDriver, volumeID api.VolumeID, fn func(o *api.Ownership) error) error {
+	store, ok := d.(Store)
+	if !ok {
+		return ErrNotSupported
+	}
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer store.Unlock(token)
+
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if err = fn(&v.Ownership); err != nil {
+		return err
+	}
+	return store.UpdateVol(v)
+}
+
+// Transfer makes owner the owner of a volume of d, once the pre hooks admit
+// it. The volume is no longer shared: the grants of the previous owner are
+// revoked.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported, HookVetoError may be
+// returned.
+func Transfer(d VolumeDriver, volumeID api.VolumeID, owner string) (err error) {
+	if setter, ok := d.(OwnershipSetter); ok {
+		return setter.Transfer(volumeID, owner)
+	}
+	if owner == "" {
+		return ErrEinval
+	}
+	ctx := context.Background()
+	req := &api.HookRequest{Op: HookTransfer, VolumeID: volumeID, Owner: owner}
+	if err := preHooks(ctx, d, req); err != nil {
+		return err
+	}
+	defer func() { postHooks(ctx, d, req, err) }()
+	err = updateOwnership(d, volumeID, func(o *api.Ownership) error {
+		o.Owner = owner
+		o.Acl = nil
+		return nil
+	})
+	if err == nil {
+		log.Infof("Volume %v transferred to %v", volumeID, owner)
+	}
+	return err
+}
+
+// SetAccess shares a volume of d with principal, read or write access, or
+// revokes the access of principal if access is empty. Only volumes with an
+// owner can be shared.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported may be returned.
+func SetAccess(d VolumeDriver, volumeID api.VolumeID, principal string, access api.AccessType) error {
+	if setter, ok := d.(OwnershipSetter); ok {
+		return setter.SetAccess(volumeID, principal, access)
+	}
+	if principal == "" || (access != "" && access != api.AccessRead && access != api.AccessWrite) {
+		return ErrEinval
+	}
+	return updateOwnership(d, volumeID, func(o *api.Ownership) error {
+		if o.Owner == "" || o.Owner == principal {
+			return ErrEinval
+		}
+		// Copy the acl, volumes returned by the cache share it.
+		acl := make(map[string]api.AccessType)
+		for p, a := range o.Acl {
+			acl[p] = a
+		}
+		if access == "" {
+			delete(acl, principal)
+		} else {
+			acl[principal] = access
+		}
+		if len(acl) == 0 {
+			acl = nil
+		}
+		o.Acl = acl
+		return nil
+	})
+}
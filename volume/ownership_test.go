@@ -0,0 +1,51 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type ownershipDriver struct {
+	ProtoDriver
+	*DefaultEnumerator
+	NotSupportedBlockDriver
+}
+
+func TestOwnership(t *testing.T) {
+	d := &ownershipDriver{DefaultEnumerator: NewDefaultEnumerator("ownership_test", kvdb.Instance())}
+	vol := &api.Volume{ID: "ownership_test_vol", Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(vol))
+	defer d.DeleteVol(vol.ID)
+
+	assert.NoError(t, Authorize(vol, "bob", api.AccessOwner), "Volumes without owner are open to anyone")
+	assert.Equal(t, ErrEinval, SetAccess(d, vol.ID, "bob", api.AccessRead), "Volume without owner shared")
+
+	assert.NoError(t, Transfer(d, vol.ID, "alice"))
+	assert.NoError(t, SetAccess(d, vol.ID, "bob", api.AccessRead))
+	assert.NoError(t, SetAccess(d, vol.ID, "carol", api.AccessWrite))
+	assert.Equal(t, ErrEinval, SetAccess(d, vol.ID, "dave", api.AccessOwner), "Owner access granted")
+
+	vol, err := d.GetVol(vol.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, Authorize(vol, "alice", api.AccessOwner))
+	assert.NoError(t, Authorize(vol, "bob", api.AccessRead))
+	assert.Equal(t, ErrPermission, Authorize(vol, "bob", api.AccessWrite))
+	assert.NoError(t, Authorize(vol, "carol", api.AccessWrite))
+	assert.Equal(t, ErrPermission, Authorize(vol, "carol", api.AccessOwner))
+	assert.Equal(t, ErrPermission, Authorize(vol, "dave", api.AccessRead))
+
+	assert.NoError(t, SetAccess(d, vol.ID, "bob", ""))
+	vol, err = d.GetVol(vol.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrPermission, Authorize(vol, "bob", api.AccessRead), "Revoked access")
+
+	assert.NoError(t, Transfer(d, vol.ID, "bob"))
+	vol, err = d.GetVol(vol.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrPermission, Authorize(vol, "alice", api.AccessRead), "Previous owner kept access")
+	assert.Equal(t, ErrPermission, Authorize(vol, "carol", api.AccessRead), "Shares kept after transfer")
+}
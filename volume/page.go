@@ -0,0 +1,180 @@
+package volume
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// PagedEnumerator is implemented by enumerators that paginate natively. Use
+// EnumeratePage and SnapEnumeratePage to paginate any Enumerator.
+type PagedEnumerator interface {
+	// EnumeratePage is Enumerate returning the page of volumes selected by
+	// opts and the token to the next page, empty on the last page.
+	EnumeratePage(locator api.VolumeLocator,
+		labels api.Labels,
+		opts *api.EnumerateOptions) ([]api.Volume, string, error)
+
+	// SnapEnumeratePage is SnapEnumerate returning the page of snaps
+	// selected by opts and the token to the next page.
+	SnapEnumeratePage(volIDs []api.VolumeID,
+		snapLabels api.Labels,
+		opts *api.EnumerateOptions) ([]api.VolumeSnap, string, error)
+}
+
+// pageKey orders an item within a paginated enumeration. Items are ordered
+// by key, then by ID, so that every item has a unique position.
+type pageKey struct {
+	Sort api.SortKey `json:"s"`
+	Key  string      `json:"k"`
+	ID   string      `json:"i"`
+}
+
+func (k pageKey) less(o pageKey) bool {
+	if k.Key != o.Key {
+		return k.Key < o.Key
+	}
+	return k.ID < o.ID
+}
+
+func sortBy(opts *api.EnumerateOptions) (api.SortKey, error) {
+	switch opts.SortBy {
+	case "", api.SortByName:
+		return api.SortByName, nil
+	case api.SortByCtime:
+		return api.SortByCtime, nil
+	}
+	return "", fmt.Errorf("Cannot sort by %q: %v", opts.SortBy, ErrEinval)
+}
+
+func newPageKey(by api.SortKey, name string, ctime time.Time, id string) pageKey {
+	if by == api.SortByCtime {
+		// Zero padded so that keys compare as strings.
+		name = fmt.Sprintf("%020d", ctime.UnixNano())
+	}
+	return pageKey{Sort: by, Key: name, ID: id}
+}
+
+func encodeToken(k pageKey) string {
+	b, _ := json.Marshal(k)
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+func decodeToken(token string, by api.SortKey) (*pageKey, error) {
+	if token == "" {
+		return nil, nil
+	}
+	var k pageKey
+	b, err := base64.URLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(b, &k)
+	}
+	if err != nil || k.Sort != by {
+		return nil, fmt.Errorf("Invalid continuation token: %v", ErrEinval)
+	}
+	return &k, nil
+}
+
+// page returns the indexes of the items in the page selected by opts, in
+// order, and the token to the next page.
+func page(keys []pageKey, opts *api.EnumerateOptions) ([]int, string, error) {
+	by, _ := sortBy(opts)
+	after, err := decodeToken(opts.Token, by)
+	if err != nil {
+		return nil, "", err
+	}
+	order := make([]int, 0, len(keys))
+	for i := range keys {
+		if after == nil || after.less(keys[i]) {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool { return keys[order[i]].less(keys[order[j]]) })
+	if opts.Limit <= 0 || len(order) <= opts.Limit {
+		return order, "", nil
+	}
+	order = order[:opts.Limit]
+	return order, encodeToken(keys[order[len(order)-1]]), nil
+}
+
+// PageVolumes returns the page of vols selected by opts and the token to the
+// next page, empty on the last page.
+// Errors ErrEinval may be returned.
+func PageVolumes(vols []api.Volume, opts *api.EnumerateOptions) ([]api.Volume, string, error) {
+	by, err := sortBy(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	keys := make([]pageKey, len(vols))
+	for i, v := range vols {
+		keys[i] = newPageKey(by, v.Locator.Name, v.Ctime, string(v.ID))
+	}
+	order, next, err := page(keys, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	paged := make([]api.Volume, len(order))
+	for i, j := range order {
+		paged[i] = vols[j]
+	}
+	return paged, next, nil
+}
+
+// PageSnaps returns the page of snaps selected by opts and the token to the
+// next page, empty on the last page.
+// Errors ErrEinval may be returned.
+func PageSnaps(snaps []api.VolumeSnap, opts *api.EnumerateOptions) ([]api.VolumeSnap, string, error) {
+	by, err := sortBy(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	keys := make([]pageKey, len(snaps))
+	for i, s := range snaps {
+		keys[i] = newPageKey(by, string(s.ID), s.Ctime, string(s.ID))
+	}
+	order, next, err := page(keys, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	paged := make([]api.VolumeSnap, len(order))
+	for i, j := range order {
+		paged[i] = snaps[j]
+	}
+	return paged, next, nil
+}
+
+// EnumeratePage enumerates a page of volumes through e if it paginates
+// natively, otherwise it paginates the result of Enumerate.
+func EnumeratePage(e Enumerator,
+	locator api.VolumeLocator,
+	labels api.Labels,
+	opts *api.EnumerateOptions) ([]api.Volume, string, error) {
+	if pe, ok := e.(PagedEnumerator); ok {
+		return pe.EnumeratePage(locator, labels, opts)
+	}
+	vols, err := e.Enumerate(locator, labels)
+	if err != nil {
+		return nil, "", err
+	}
+	return PageVolumes(vols, opts)
+}
+
+// SnapEnumeratePage enumerates a page of snaps through e if it paginates
+// natively, otherwise it paginates the result of SnapEnumerate.
+func SnapEnumeratePage(e Enumerator,
+	volIDs []api.VolumeID,
+	snapLabels api.Labels,
+	opts *api.EnumerateOptions) ([]api.VolumeSnap, string, error) {
+	if pe, ok := e.(PagedEnumerator); ok {
+		return pe.SnapEnumeratePage(volIDs, snapLabels, opts)
+	}
+	snaps, err := e.SnapEnumerate(volIDs, snapLabels)
+	if err != nil {
+		return nil, "", err
+	}
+	return PageSnaps(snaps, opts)
+}
@@ -0,0 +1,46 @@
+package volume
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestPageVolumes(t *testing.T) {
+	now := time.Now()
+	vols := []api.Volume{
+		{ID: "3", Locator: api.VolumeLocator{Name: "c"}, Ctime: now},
+		{ID: "1", Locator: api.VolumeLocator{Name: "a"}, Ctime: now.Add(time.Second)},
+		{ID: "2", Locator: api.VolumeLocator{Name: "b"}, Ctime: now.Add(-time.Second)},
+	}
+
+	opts := &api.EnumerateOptions{Limit: 2}
+	page, next, err := PageVolumes(vols, opts)
+	assert.NoError(t, err, "Failed in PageVolumes")
+	assert.Equal(t, 2, len(page), "First page should be full")
+	assert.Equal(t, api.VolumeID("1"), page[0].ID, "Volumes should be sorted by name")
+	assert.Equal(t, api.VolumeID("2"), page[1].ID, "Volumes should be sorted by name")
+	assert.NotEqual(t, "", next, "First page should have a next token")
+
+	opts.Token = next
+	page, next, err = PageVolumes(vols, opts)
+	assert.NoError(t, err, "Failed in PageVolumes")
+	assert.Equal(t, 1, len(page), "Last page should hold the remaining volume")
+	assert.Equal(t, api.VolumeID("3"), page[0].ID, "Last page should continue after the token")
+	assert.Equal(t, "", next, "Last page should not have a next token")
+
+	page, _, err = PageVolumes(vols, &api.EnumerateOptions{SortBy: api.SortByCtime})
+	assert.NoError(t, err, "Failed in PageVolumes")
+	assert.Equal(t, []api.VolumeID{"2", "3", "1"}, []api.VolumeID{page[0].ID, page[1].ID, page[2].ID},
+		"Volumes should be sorted by ctime")
+
+	_, _, err = PageVolumes(vols, &api.EnumerateOptions{Token: "bogus"})
+	assert.Error(t, err, "Invalid token should be rejected")
+	_, _, err = PageVolumes(vols, &api.EnumerateOptions{SortBy: api.SortByCtime, Token: opts.Token})
+	assert.Error(t, err, "Token of another sort order should be rejected")
+	_, _, err = PageVolumes(vols, &api.EnumerateOptions{SortBy: "size"})
+	assert.Error(t, err, "Unknown sort key should be rejected")
+}
@@ -0,0 +1,148 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+)
+
+// Reattacher is implemented by drivers that restore the attachments and
+// mounts of their volumes themselves when they start. The volumes of other
+// drivers that implement Store are reattached by New.
+type Reattacher interface {
+	// Reattach restores the attachments and mounts of the volumes recorded
+	// on this node.
+	Reattach() error
+}
+
+// reattach restores the devices and mounts of the volumes of d recorded as
+// attached or mounted on this node, which a restart of the daemon or of the
+// node loses. Volumes whose device cannot be restored are marked detached,
+// volumes that cannot be mounted again are marked in error, so that the
+// metadata matches the host.
+func reattach(name string, d VolumeDriver) {
+	if r, ok := d.(Reattacher); ok {
+		if err := r.Reattach(); err != nil {
+			log.Warnf("%s: failed to reattach volumes: %v", name, err)
+		}
+		return
+	}
+	// Object drivers have nothing to reattach, and the metadata of drivers
+	// that are not stores is not kept by this node.
+	if _, ok := d.(Store); !ok || d.Type()&(Block|File) == 0 {
+		return
+	}
+	vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		log.Warnf("%s: failed to list the volumes to reattach: %v", name, err)
+		return
+	}
+	var table []fs.Mount
+	node := NodeID()
+	for i := range vols {
+		v := &vols[i]
+		a := attachmentOn(v, node)
+		if a == nil {
+			continue
+		}
+		if d.Type()&Block != 0 && !deviceExists(d, v) {
+			log.Infof("%s: reattaching volume %v", name, v.ID)
+			if _, err = AttachCtx(withInternal(context.Background()), d, v.ID, &a.Options); err != nil {
+				log.Warnf("%s: failed to reattach volume %v, marking it detached: %v", name, v.ID, err)
+				markStranded(d, v.ID, false, err)
+				continue
+			}
+		}
+		if v.AttachPath == "" {
+			continue
+		}
+		if table == nil {
+			if table, err = fs.MountTable(); err != nil {
+				log.Warnf("%s: failed to read the mount table, volumes are not mounted again: %v", name, err)
+				return
+			}
+		}
+		if mountedAt(table, v.AttachPath) {
+			continue
+		}
+		log.Infof("%s: mounting volume %v at %s again", name, v.ID, v.AttachPath)
+		if err = MountCtx(context.Background(), d, v.ID, v.AttachPath); err != nil {
+			log.Warnf("%s: failed to mount volume %v at %s, marking it in error: %v",
+				name, v.ID, v.AttachPath, err)
+			markStranded(d, v.ID, true, err)
+		}
+	}
+}
+
+// attachmentOn returns the attachment of v on node, nil if v is not attached
+// on node.
+func attachmentOn(v *api.Volume, node api.MachineID) *api.Attachment {
+	for i := range v.Attachments {
+		if v.Attachments[i].Node == node {
+			return &v.Attachments[i]
+		}
+	}
+	// Volumes attached before attachments were tracked.
+	if v.AttachedOn == node && v.State == api.VolumeAttached {
+		return &api.Attachment{Node: node}
+	}
+	return nil
+}
+
+// deviceExists returns true if the top device of v, under its layers, VDO
+// and cache if any, exists.
+func deviceExists(d VolumeDriver, v *api.Volume) bool {
+	if v.DevicePath == "" {
+		return false
+	}
+	_, err := os.Stat(TopDevice(d, v.ID, v.DevicePath))
+	return err == nil
+}
+
+func mountedAt(table []fs.Mount, path string) bool {
+	for _, m := range table {
+		if m.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// markStranded records that volumeID could not be reattached, or mounted
+// again if mount is set, on this node.
+func markStranded(d VolumeDriver, volumeID api.VolumeID, mount bool, cause error) {
+	store, ok := d.(Store)
+	if !ok {
+		return
+	}
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		log.Warnf("Failed to mark volume %v: %v", volumeID, err)
+		return
+	}
+	defer store.Unlock(token)
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		log.Warnf("Failed to mark volume %v: %v", volumeID, err)
+		return
+	}
+	v.AttachPath = ""
+	if mount {
+		v.Error = fmt.Sprintf("Failed to mount again after a restart: %v", cause)
+		err = SetState(v, api.VolumeError, "mount lost")
+	} else {
+		v.Error = fmt.Sprintf("Failed to reattach after a restart: %v", cause)
+		RecordDetach(v, NodeID())
+	}
+	if err == nil {
+		err = store.UpdateVol(v)
+	}
+	if err != nil {
+		log.Warnf("Failed to mark volume %v: %v", volumeID, err)
+	}
+}
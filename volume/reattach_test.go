@@ -0,0 +1,72 @@
+package volume
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type reattachDriver struct {
+	ProtoDriver
+	*DefaultEnumerator
+	NotSupportedBlockDriver
+	mounted map[api.VolumeID]string
+}
+
+func (d *reattachDriver) String() string   { return "reattach_test" }
+func (d *reattachDriver) Type() DriverType { return Block }
+
+func (d *reattachDriver) Mount(volumeID api.VolumeID, mountpath string) error {
+	if volumeID == "reattach_test_broken" {
+		return errors.New("broken")
+	}
+	d.mounted[volumeID] = mountpath
+	return nil
+}
+
+func TestReattach(t *testing.T) {
+	d := &reattachDriver{
+		DefaultEnumerator: NewDefaultEnumerator("reattach_test", kvdb.Instance()),
+		mounted:           make(map[api.VolumeID]string),
+	}
+	attached := func(id api.VolumeID, device string) *api.Volume {
+		v := &api.Volume{ID: id, Spec: &api.VolumeSpec{}, DevicePath: device,
+			AttachPath: "/reattach_test/" + string(id)}
+		RecordAttach(v, NodeID(), nil)
+		assert.NoError(t, d.CreateVol(v))
+		return v
+	}
+	// Attach is not supported, the device cannot be restored.
+	lost := attached("reattach_test_lost", "/reattach_test/missing")
+	defer d.DeleteVol(lost.ID)
+	// The device exists, the mount is missing.
+	unmounted := attached("reattach_test_unmounted", "/")
+	defer d.DeleteVol(unmounted.ID)
+	broken := attached("reattach_test_broken", "/")
+	defer d.DeleteVol(broken.ID)
+	other := &api.Volume{ID: "reattach_test_other", Spec: &api.VolumeSpec{}, AttachPath: "/other"}
+	RecordAttach(other, "reattach_test_node", nil)
+	assert.NoError(t, d.CreateVol(other))
+	defer d.DeleteVol(other.ID)
+
+	reattach("reattach_test", d)
+
+	assert.Equal(t, map[api.VolumeID]string{unmounted.ID: unmounted.AttachPath}, d.mounted,
+		"Only the volumes of this node with their device should be mounted")
+	v, err := d.GetVol(lost.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, api.VolumeDetached, v.State, "Volume without device should be detached")
+	assert.Empty(t, v.Attachments)
+	assert.Equal(t, "", v.AttachPath)
+	v, err = d.GetVol(broken.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, api.VolumeError, v.State, "Volume that cannot be mounted should be in error")
+	assert.Contains(t, v.Error, "broken")
+	v, err = d.GetVol(unmounted.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, api.VolumeAttached, v.State)
+}
@@ -0,0 +1,398 @@
+package volume
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// RebalanceIntervalParam DriverParams key for the number of hours
+	// between automatic rebalances of the volumes of a driver that
+	// implements Mover. Volumes are only rebalanced on request if 0, the
+	// default.
+	RebalanceIntervalParam = "rebalance_interval"
+	// RebalanceThresholdParam DriverParams key for the Threshold of
+	// automatic rebalances.
+	RebalanceThresholdParam = "rebalance_threshold"
+	// defaultRebalanceThreshold percentage points of imbalance tolerated.
+	defaultRebalanceThreshold = 10
+)
+
+// rebalancePause is the pause between two moves, so that a rebalance does
+// not starve the backends of IO.
+var rebalancePause = 10 * time.Second
+
+var (
+	// ErrRebalanceRunning is returned when starting a rebalance while
+	// another one runs.
+	ErrRebalanceRunning = errors.New("A rebalance is already running")
+	// ErrNoRebalance is returned for the progress of a driver that has not
+	// been rebalanced.
+	ErrNoRebalance = errors.New("No rebalance has been run")
+)
+
+// Mover is implemented by drivers that spread volumes over several backends,
+// such as NFS exports or nodes, and can move volumes between them. Use
+// GetRebalancer to even out the load of the backends of a driver.
+type Mover interface {
+	// Backends returns the backends of the driver with the volumes on each.
+	// Volumes that cannot be moved now, for instance because they are
+	// mounted, are left out.
+	Backends() ([]api.Backend, error)
+
+	// Move moves a volume from one backend to another. It returns once the
+	// volume is only on the new backend.
+	// Errors ErrEnoEnt, ErrVolAttached may be returned.
+	Move(volumeID api.VolumeID, from, to string) error
+}
+
+// RebalanceRequester is implemented by clients that rebalance the volumes of
+// a remote driver.
+type RebalanceRequester interface {
+	// Rebalance starts moving volumes between the backends of the driver.
+	// Errors ErrNotSupported, ErrRebalanceRunning may be returned.
+	Rebalance(req *api.RebalanceRequest) (*api.RebalanceJob, error)
+
+	// RebalanceJob returns the progress of the running or last rebalance.
+	// Errors ErrNoRebalance may be returned.
+	RebalanceJob() (*api.RebalanceJob, error)
+
+	// CancelRebalance stops the running rebalance after the current move.
+	// Errors ErrNoRebalance may be returned.
+	CancelRebalance() error
+}
+
+// Rebalancer evens out the used space or IO of the backends of a driver by
+// moving volumes from the most to the least loaded backends. Moves run one
+// at a time with a pause in between.
+type Rebalancer struct {
+	name      string
+	driver    VolumeDriver
+	mover     Mover
+	interval  time.Duration
+	threshold int
+	stop      func()
+
+	lock   sync.Mutex
+	job    *api.RebalanceJob
+	cancel chan struct{}
+}
+
+func newRebalancer(name string, d VolumeDriver, params DriverParams) (*Rebalancer, error) {
+	mover, ok := d.(Mover)
+	if !ok {
+		return nil, nil
+	}
+	hours, err := intParam(params, RebalanceIntervalParam, 0)
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := intParam(params, RebalanceThresholdParam, defaultRebalanceThreshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Rebalancer{
+		name:      name,
+		driver:    d,
+		mover:     mover,
+		interval:  time.Duration(hours) * time.Hour,
+		threshold: threshold,
+	}, nil
+}
+
+// GetRebalancer returns the rebalancer of the named driver.
+// Errors ErrNotSupported may be returned if the driver cannot move volumes.
+func GetRebalancer(name string) (*Rebalancer, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if r, ok := rebalancers[name]; ok {
+		return r, nil
+	}
+	return nil, ErrNotSupported
+}
+
+// Start plans a rebalance and makes the moves in the background. A dry run
+// only plans the moves. The job is returned as planned, use Job to follow
+// its progress.
+// Errors ErrRebalanceRunning may be returned.
+func (r *Rebalancer) Start(req api.RebalanceRequest) (api.RebalanceJob, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.job != nil && r.job.State == api.JobRunning {
+		return api.RebalanceJob{}, ErrRebalanceRunning
+	}
+	if req.Threshold <= 0 {
+		req.Threshold = defaultRebalanceThreshold
+	}
+	moves, err := r.plan(&req)
+	if err != nil {
+		return api.RebalanceJob{}, err
+	}
+	job := &api.RebalanceJob{
+		Driver:  r.name,
+		Request: req,
+		State:   api.JobRunning,
+		Moves:   moves,
+		Start:   time.Now(),
+	}
+	if req.DryRun || len(moves) == 0 {
+		job.State = api.JobDone
+		job.End = job.Start
+	}
+	r.job = job
+	if job.State == api.JobRunning {
+		log.Infof("%s: rebalancing %d volumes", r.name, len(moves))
+		r.cancel = make(chan struct{})
+		go r.run(job, r.cancel)
+	}
+	return copyJob(job), nil
+}
+
+// Job returns the progress of the running or last rebalance.
+// Errors ErrNoRebalance may be returned.
+func (r *Rebalancer) Job() (api.RebalanceJob, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.job == nil {
+		return api.RebalanceJob{}, ErrNoRebalance
+	}
+	return copyJob(r.job), nil
+}
+
+// Cancel stops the running rebalance after the current move.
+// Errors ErrNoRebalance may be returned if no rebalance is running.
+func (r *Rebalancer) Cancel() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.job == nil || r.job.State != api.JobRunning {
+		return ErrNoRebalance
+	}
+	close(r.cancel)
+	r.job.State = api.JobCancelled
+	return nil
+}
+
+func copyJob(job *api.RebalanceJob) api.RebalanceJob {
+	c := *job
+	c.Moves = append([]api.RebalanceMove(nil), job.Moves...)
+	return c
+}
+
+// plan returns the moves that even out the backends of the driver.
+func (r *Rebalancer) plan(req *api.RebalanceRequest) ([]api.RebalanceMove, error) {
+	backends, err := r.mover.Backends()
+	if err != nil {
+		return nil, err
+	}
+	var load map[api.VolumeID]uint64
+	if req.IO {
+		load = make(map[api.VolumeID]uint64)
+		for _, b := range backends {
+			for id := range b.Volumes {
+				// Volumes without stats count as idle.
+				if stats, err := r.driver.Stats(id); err == nil {
+					load[id] = stats.ReadBytes + stats.WriteBytes
+				}
+			}
+		}
+	}
+	return planMoves(backends, load, req.Threshold, req.MaxMoves), nil
+}
+
+// run makes the moves of job until they are done or cancel is closed. A
+// volume that fails to move is recorded and skipped.
+func (r *Rebalancer) run(job *api.RebalanceJob, cancel chan struct{}) {
+	for i := range job.Moves {
+		if i > 0 {
+			select {
+			case <-cancel:
+				r.finish(job)
+				return
+			case <-time.After(rebalancePause):
+			}
+		}
+		m := job.Moves[i]
+		err := r.mover.Move(m.VolumeID, m.From, m.To)
+		r.lock.Lock()
+		if err != nil {
+			log.Warnf("%s: failed to move volume %v from %s to %s: %v",
+				r.name, m.VolumeID, m.From, m.To, err)
+			job.Moves[i].Error = err.Error()
+		} else {
+			job.Moves[i].Done = true
+			job.Moved++
+			job.BytesMoved += m.Size
+		}
+		r.lock.Unlock()
+	}
+	r.finish(job)
+}
+
+func (r *Rebalancer) finish(job *api.RebalanceJob) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if job.State == api.JobRunning {
+		job.State = api.JobDone
+	}
+	job.End = time.Now()
+	log.Infof("%s: rebalance %s, %d of %d volumes moved", r.name, job.State, job.Moved, len(job.Moves))
+}
+
+// start rebalances the driver every interval. Drivers may share their
+// backends across nodes, only one node rebalances a driver.
+func (r *Rebalancer) start() {
+	if r.interval <= 0 {
+		return
+	}
+	r.stop = singleton("rebalance/"+r.name, func(stop <-chan struct{}) {
+		tick := time.NewTicker(r.interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				_, err := r.Start(api.RebalanceRequest{Threshold: r.threshold})
+				if err != nil && err != ErrRebalanceRunning {
+					log.Warnf("%s: automatic rebalance failed: %v", r.name, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	})
+}
+
+func (r *Rebalancer) shutdown() {
+	if r.stop != nil {
+		r.stop()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.job != nil && r.job.State == api.JobRunning {
+		close(r.cancel)
+		r.job.State = api.JobCancelled
+	}
+}
+
+// site is a backend as the planner sees it.
+type site struct {
+	id       string
+	capacity uint64
+	used     uint64
+	load     float64
+	norm     float64
+	volumes  []api.VolumeID
+	sizes    map[api.VolumeID]uint64
+}
+
+func (s *site) util() float64 {
+	return 100 * s.load / s.norm
+}
+
+// planMoves returns the moves from the most to the least loaded backend that
+// bring the difference of their load within threshold percentage points,
+// at most maxMoves if it is not 0. The load of a backend is the share of its
+// capacity used by its volumes, or its share of the IO of all volumes if
+// load gives the IO of each volume. A volume is only moved to a backend with
+// room for it and moves never swap which backend is the most loaded.
+func planMoves(backends []api.Backend,
+	load map[api.VolumeID]uint64,
+	threshold int,
+	maxMoves int) []api.RebalanceMove {
+
+	weight := func(s *site, id api.VolumeID) float64 {
+		if load != nil {
+			return float64(load[id])
+		}
+		return float64(s.sizes[id])
+	}
+	var total float64
+	for _, w := range load {
+		total += float64(w)
+	}
+	var sites []*site
+	for _, b := range backends {
+		if b.Capacity == 0 {
+			continue
+		}
+		s := &site{
+			id:       b.ID,
+			capacity: b.Capacity,
+			used:     b.Used,
+			norm:     float64(b.Capacity),
+			sizes:    make(map[api.VolumeID]uint64),
+		}
+		if load != nil {
+			s.norm = total
+		}
+		for id, size := range b.Volumes {
+			s.volumes = append(s.volumes, id)
+			s.sizes[id] = size
+		}
+		sort.Slice(s.volumes, func(i, j int) bool { return s.volumes[i] < s.volumes[j] })
+		if load != nil {
+			for _, id := range s.volumes {
+				s.load += weight(s, id)
+			}
+		} else {
+			s.load = float64(b.Used)
+		}
+		sites = append(sites, s)
+	}
+	if len(sites) < 2 || (load != nil && total == 0) {
+		return nil
+	}
+
+	var moves []api.RebalanceMove
+	moved := make(map[api.VolumeID]bool)
+	for maxMoves <= 0 || len(moves) < maxMoves {
+		sort.SliceStable(sites, func(i, j int) bool { return sites[i].util() > sites[j].util() })
+		hi, lo := sites[0], sites[len(sites)-1]
+		if hi.util()-lo.util() <= float64(threshold) {
+			break
+		}
+		best := api.VolumeID("")
+		bestSpread := 0.0
+		for _, id := range hi.volumes {
+			w := weight(hi, id)
+			if moved[id] || w == 0 || lo.used+hi.sizes[id] > lo.capacity {
+				continue
+			}
+			newHi := 100 * (hi.load - w) / hi.norm
+			newLo := 100 * (lo.load + w) / lo.norm
+			if newLo >= hi.util() {
+				continue
+			}
+			spread := newHi - newLo
+			if spread < 0 {
+				spread = -spread
+			}
+			if best == "" || spread < bestSpread {
+				best = id
+				bestSpread = spread
+			}
+		}
+		if best == "" {
+			break
+		}
+		w, size := weight(hi, best), hi.sizes[best]
+		moves = append(moves, api.RebalanceMove{
+			VolumeID: best,
+			From:     hi.id,
+			To:       lo.id,
+			Size:     size,
+		})
+		moved[best] = true
+		hi.load -= w
+		hi.used -= size
+		lo.load += w
+		lo.used += size
+		lo.sizes[best] = size
+	}
+	return moves
+}
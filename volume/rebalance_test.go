@@ -0,0 +1,50 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestPlanMoves(t *testing.T) {
+	backends := []api.Backend{
+		{ID: "a", Capacity: 100, Used: 80, Volumes: map[api.VolumeID]uint64{"v1": 30, "v2": 20, "v3": 10}},
+		{ID: "b", Capacity: 100, Used: 20, Volumes: map[api.VolumeID]uint64{}},
+	}
+	moves := planMoves(backends, nil, 10, 0)
+	assert.Equal(t, []api.RebalanceMove{{VolumeID: "v1", From: "a", To: "b", Size: 30}}, moves)
+
+	moves = planMoves(backends, nil, 60, 0)
+	assert.Empty(t, moves, "Backends within threshold rebalanced")
+
+	// Volumes only move to backends with room for them.
+	backends = []api.Backend{
+		{ID: "a", Capacity: 1000, Used: 900, Volumes: map[api.VolumeID]uint64{"v1": 150}},
+		{ID: "b", Capacity: 100, Used: 0, Volumes: map[api.VolumeID]uint64{}},
+	}
+	moves = planMoves(backends, nil, 10, 0)
+	assert.Empty(t, moves, "Volume moved to a backend too small")
+
+	backends = []api.Backend{
+		{ID: "a", Capacity: 100, Used: 90, Volumes: map[api.VolumeID]uint64{}},
+		{ID: "b", Capacity: 100, Used: 0, Volumes: map[api.VolumeID]uint64{}},
+	}
+	for _, id := range []api.VolumeID{"v1", "v2", "v3", "v4", "v5", "v6", "v7", "v8", "v9"} {
+		backends[0].Volumes[id] = 10
+	}
+	moves = planMoves(backends, nil, 10, 0)
+	assert.Len(t, moves, 4)
+	moves = planMoves(backends, nil, 10, 2)
+	assert.Len(t, moves, 2)
+
+	// In IO mode v2 would make a the least loaded backend.
+	backends = []api.Backend{
+		{ID: "a", Capacity: 100, Used: 20, Volumes: map[api.VolumeID]uint64{"v1": 10, "v2": 10}},
+		{ID: "b", Capacity: 100, Used: 10, Volumes: map[api.VolumeID]uint64{"v3": 10}},
+	}
+	load := map[api.VolumeID]uint64{"v1": 100, "v2": 300}
+	moves = planMoves(backends, load, 10, 0)
+	assert.Equal(t, []api.RebalanceMove{{VolumeID: "v1", From: "a", To: "b", Size: 10}}, moves)
+}
@@ -0,0 +1,40 @@
+package volume
+
+import (
+	"context"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+)
+
+// Resize grows a volume of d to size bytes, once the pre hooks admit it. The
+// filesystem of a Block volume mounted on this node is grown to the new size
+// of the top device of its layers.
+// Errors ErrEnoEnt, ErrEinval, ErrNotSupported, HookVetoError may be
+// returned.
+func Resize(d VolumeDriver, volumeID api.VolumeID, size uint64) (err error) {
+	r, ok := d.(Resizer)
+	if !ok {
+		return ErrNotSupported
+	}
+	ctx := context.Background()
+	req := &api.HookRequest{Op: HookResize, VolumeID: volumeID, Spec: &api.VolumeSpec{Size: size}}
+	if err := preHooks(ctx, d, req); err != nil {
+		return err
+	}
+	defer func() { postHooks(ctx, d, req, err) }()
+	if err := r.Resize(volumeID, size); err != nil {
+		return err
+	}
+	if d.Type()&Block == 0 {
+		return nil
+	}
+	vols, err := d.Inspect([]api.VolumeID{volumeID})
+	if err != nil {
+		return err
+	}
+	if len(vols) != 1 {
+		return ErrEnoEnt
+	}
+	return fs.ResizeFS(&vols[0], TopDevice(d, volumeID, vols[0].DevicePath))
+}
@@ -0,0 +1,231 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/events"
+	"github.com/libopenstorage/openstorage/pkg/worker"
+)
+
+const (
+	// SnapScheduleParam DriverParams key, set to true to snapshot the
+	// volumes of the driver every SnapshotInterval of their spec and
+	// enforce their retention policies. Off by default: enable it on a
+	// single node for drivers whose volumes are shared by several nodes.
+	SnapScheduleParam = "snap_schedule"
+)
+
+// snapCheckInterval is how often the snapshot scheduler looks for volumes
+// due for a snapshot.
+var snapCheckInterval = time.Minute
+
+// SnapProtector is implemented by drivers that record the protection of
+// snapshots natively. Use ProtectSnap to protect the snapshots of any
+// driver.
+type SnapProtector interface {
+	// ProtectSnap pins a snapshot, or unpins it if protected is false.
+	// Errors ErrEnoEnt may be returned.
+	ProtectSnap(snapID api.SnapID, protected bool) error
+}
+
+// ProtectSnap pins a snapshot of d so that retention policies never delete
+// it, or unpins it if protected is false.
+// Errors ErrEnoEnt, ErrNotSupported may be returned.
+func ProtectSnap(d VolumeDriver, snapID api.SnapID, protected bool) error {
+	if p, ok := d.(SnapProtector); ok {
+		return p.ProtectSnap(snapID, protected)
+	}
+	store, ok := d.(Store)
+	if !ok {
+		return ErrNotSupported
+	}
+	snap, err := store.GetSnap(snapID)
+	if err != nil {
+		return err
+	}
+	snap.Protected = protected
+	return store.UpdateSnap(snap)
+}
+
+// period of a GFS rule, with the number of periods the rule keeps.
+type period struct {
+	key  string
+	keep int
+}
+
+// periods returns the period of t of each GFS rule of p.
+func periods(p *api.RetentionPolicy, t time.Time) []period {
+	t = t.UTC()
+	year, week := t.ISOWeek()
+	return []period{
+		{"h" + t.Format("2006010215"), p.Hourly},
+		{"d" + t.Format("20060102"), p.Daily},
+		{fmt.Sprintf("w%d%02d", year, week), p.Weekly},
+		{"m" + t.Format("200601"), p.Monthly},
+	}
+}
+
+// Expired returns the snapshots of snaps that policy p does not keep. The
+// latest snapshot of each period, hour, day, week or month, is kept for as
+// many periods as the rule of the period says, and the KeepLast latest
+// snapshots are kept. Protected snapshots are never expired and do not
+// count towards the rules. Policies without rules expire nothing.
+func Expired(snaps []api.VolumeSnap, p *api.RetentionPolicy) []api.VolumeSnap {
+	if p == nil || *p == (api.RetentionPolicy{}) {
+		return nil
+	}
+	sorted := make([]api.VolumeSnap, 0, len(snaps))
+	for _, s := range snaps {
+		if !s.Protected {
+			sorted = append(sorted, s)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Ctime.After(sorted[j].Ctime)
+	})
+
+	// seen periods of each rule, by rule index.
+	seen := make([]map[string]bool, 4)
+	for i := range seen {
+		seen[i] = make(map[string]bool)
+	}
+	var expired []api.VolumeSnap
+	for i, s := range sorted {
+		keep := i < p.KeepLast
+		for r, b := range periods(p, s.Ctime) {
+			if seen[r][b.key] || len(seen[r]) >= b.keep {
+				continue
+			}
+			seen[r][b.key] = true
+			keep = true
+		}
+		if !keep {
+			expired = append(expired, s)
+		}
+	}
+	return expired
+}
+
+// snapScheduler snapshots the volumes of a driver every SnapshotInterval
+// and deletes the scheduled snapshots their retention policy expires.
+type snapScheduler struct {
+	name   string
+	driver VolumeDriver
+	pool   *worker.Pool
+	stop   chan struct{}
+}
+
+func newSnapScheduler(name string,
+	d VolumeDriver,
+	pool *worker.Pool,
+	params DriverParams) (*snapScheduler, error) {
+	v, ok := params[SnapScheduleParam]
+	if !ok {
+		return nil, nil
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid value %q for %s: %v", v, SnapScheduleParam, err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	return &snapScheduler{
+		name:   name,
+		driver: d,
+		pool:   pool,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+func (s *snapScheduler) start() {
+	go func() {
+		t := time.NewTicker(snapCheckInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := s.pool.Submit(s.run); err != nil {
+					log.Warnf("%s: skipping scheduled snapshots: %v", s.name, err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *snapScheduler) shutdown() {
+	close(s.stop)
+}
+
+// run snapshots the volumes that are due and enforces the retention
+// policies.
+func (s *snapScheduler) run() {
+	vols, err := s.driver.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		log.Warnf("%s: failed to enumerate volumes to snapshot: %v", s.name, err)
+		return
+	}
+	for _, v := range vols {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		if v.Spec == nil || (v.Spec.SnapshotInterval <= 0 && v.Spec.Retention == nil) {
+			continue
+		}
+		if err := s.schedule(&v, time.Now()); err != nil {
+			log.Warnf("%s: failed to schedule the snapshots of volume %v: %v", s.name, v.ID, err)
+		}
+	}
+}
+
+// schedule snapshots v if its last scheduled snapshot is older than its
+// interval at now, then deletes its expired snapshots.
+func (s *snapScheduler) schedule(v *api.Volume, now time.Time) error {
+	ctx := withInternal(context.Background())
+	labels := api.Labels{api.ScheduledSnapLabel: "true"}
+	snaps, err := s.driver.SnapEnumerate([]api.VolumeID{v.ID}, labels)
+	if err != nil {
+		return err
+	}
+	if interval := time.Duration(v.Spec.SnapshotInterval) * time.Minute; interval > 0 {
+		var last time.Time
+		for _, snap := range snaps {
+			if snap.Ctime.After(last) {
+				last = snap.Ctime
+			}
+		}
+		if now.Sub(last) >= interval {
+			id, err := SnapshotCtx(ctx, s.driver, v.ID, labels, false)
+			if err != nil {
+				return err
+			}
+			events.Publish(api.Event{
+				Type:     api.EventSnapshotCompleted,
+				Driver:   s.name,
+				VolumeID: v.ID,
+				SnapID:   id,
+			})
+			snaps = append(snaps, api.VolumeSnap{ID: id, VolumeID: v.ID, Ctime: now, SnapLabels: labels})
+		}
+	}
+	for _, snap := range Expired(snaps, v.Spec.Retention) {
+		if err := SnapDeleteCtx(ctx, s.driver, snap.ID); err != nil {
+			log.Warnf("%s: failed to delete expired snapshot %v of volume %v: %v",
+				s.name, snap.ID, v.ID, err)
+			continue
+		}
+		log.Infof("%s: deleted expired snapshot %v of volume %v", s.name, snap.ID, v.ID)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package volume
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func snapIDs(snaps []api.VolumeSnap) []api.SnapID {
+	ids := make([]api.SnapID, 0, len(snaps))
+	for _, s := range snaps {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2017, 3, 15, 12, 30, 0, 0, time.UTC)
+	// Snaps every 6 hours over 10 days, newest first.
+	var snaps []api.VolumeSnap
+	for i := 0; i < 40; i++ {
+		snaps = append(snaps, api.VolumeSnap{
+			ID:    api.SnapID(now.Add(-time.Duration(i) * 6 * time.Hour).Format("0102-15")),
+			Ctime: now.Add(-time.Duration(i) * 6 * time.Hour),
+		})
+	}
+
+	assert.Empty(t, Expired(snaps, nil))
+	assert.Len(t, Expired(snaps, &api.RetentionPolicy{KeepLast: 5}), 35)
+	assert.Empty(t, Expired(snaps, &api.RetentionPolicy{}), "Policy without rules expired snapshots")
+
+	expired := Expired(snaps, &api.RetentionPolicy{KeepLast: 2, Daily: 3})
+	kept := make(map[api.SnapID]bool)
+	for _, s := range snaps {
+		kept[s.ID] = true
+	}
+	for _, id := range snapIDs(expired) {
+		delete(kept, id)
+	}
+	// The last 2 snaps, and the last snaps of the 15th, 14th and 13th.
+	assert.Equal(t, map[api.SnapID]bool{
+		"0315-12": true,
+		"0315-06": true,
+		"0314-18": true,
+		"0313-18": true,
+	}, kept)
+
+	// Protected snaps are kept and do not count towards the rules.
+	snaps[1].Protected = true
+	expired = Expired(snaps, &api.RetentionPolicy{KeepLast: 2})
+	assert.Len(t, expired, 37)
+	for _, s := range expired {
+		assert.NotEqual(t, api.SnapID("0315-06"), s.ID)
+	}
+}
+
+// scheduledDriver records the snapshots of its volume.
+type scheduledDriver struct {
+	capabilityDriver
+	snaps map[api.SnapID]api.VolumeSnap
+	next  int
+}
+
+func (d *scheduledDriver) String() string { return "scheduled_test" }
+
+func (d *scheduledDriver) SnapEnumerate(ids []api.VolumeID, labels api.Labels) ([]api.VolumeSnap, error) {
+	var snaps []api.VolumeSnap
+	for _, s := range d.snaps {
+		if _, ok := s.SnapLabels[api.ScheduledSnapLabel]; ok {
+			snaps = append(snaps, s)
+		}
+	}
+	return snaps, nil
+}
+
+func (d *scheduledDriver) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
+	d.next++
+	id := api.SnapID(string(rune('a' + d.next)))
+	d.snaps[id] = api.VolumeSnap{ID: id, VolumeID: volumeID, Ctime: time.Now(), SnapLabels: labels}
+	return id, nil
+}
+
+func (d *scheduledDriver) SnapDelete(snapID api.SnapID) error {
+	delete(d.snaps, snapID)
+	return nil
+}
+
+func TestSnapSchedule(t *testing.T) {
+	d := &scheduledDriver{
+		capabilityDriver: capabilityDriver{t: File},
+		snaps:            make(map[api.SnapID]api.VolumeSnap),
+	}
+	s, err := newSnapScheduler("scheduled_test", d, nil, DriverParams{SnapScheduleParam: "true"})
+	assert.NoError(t, err)
+	_, err = newSnapScheduler("scheduled_test", d, nil, DriverParams{SnapScheduleParam: "often"})
+	assert.Error(t, err)
+
+	v := &api.Volume{ID: "v1", Spec: &api.VolumeSpec{
+		SnapshotInterval: 60,
+		Retention:        &api.RetentionPolicy{KeepLast: 2},
+	}}
+	assert.NoError(t, s.schedule(v, time.Now()))
+	assert.Len(t, d.snaps, 1)
+	assert.NoError(t, s.schedule(v, time.Now()))
+	assert.Len(t, d.snaps, 1, "Snapshot taken before the interval")
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.schedule(v, time.Now().Add(time.Duration(i+1)*time.Hour)))
+	}
+	assert.Len(t, d.snaps, 2, "Expired snapshots not deleted")
+
+	// Snaps not taken by the scheduler are not expired.
+	d.snaps["manual"] = api.VolumeSnap{ID: "manual", Ctime: time.Now().Add(-time.Hour)}
+	assert.NoError(t, s.schedule(v, time.Now().Add(5*time.Hour)))
+	assert.Len(t, d.snaps, 3)
+}
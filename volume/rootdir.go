@@ -0,0 +1,61 @@
+package volume
+
+import (
+	"os"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// SetRootDir sets the owner and permissions of dir, the root directory of a
+// volume, to the RootDir of spec. It is a no-op if they are already set or
+// if spec has no RootDir. File drivers call it on the directory of the
+// volumes they create, MountCtx on the mounts of all volumes.
+func SetRootDir(dir string, spec *api.VolumeSpec) error {
+	if spec == nil || spec.RootDir == nil {
+		return nil
+	}
+	r := spec.RootDir
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		return &os.PathError{Op: "stat", Path: dir, Err: err}
+	}
+	// os.Chown leaves the IDs that are -1 unchanged.
+	uid, gid := -1, -1
+	if r.UID != nil && uint32(*r.UID) != st.Uid {
+		uid = *r.UID
+	}
+	if r.GID != nil && uint32(*r.GID) != st.Gid {
+		gid = *r.GID
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(dir, uid, gid); err != nil {
+			return err
+		}
+	}
+	// Chmod as chown may clear the setgid bit.
+	if r.Mode != 0 {
+		if err := syscall.Chmod(dir, r.Mode); err != nil {
+			return &os.PathError{Op: "chmod", Path: dir, Err: err}
+		}
+	}
+	return nil
+}
+
+// setMountRootDir sets the owner and permissions of the root directory of a
+// volume of d mounted at mountpath.
+func setMountRootDir(d interface{}, volumeID api.VolumeID, mountpath string) {
+	e, ok := d.(Enumerator)
+	if !ok {
+		return
+	}
+	vols, err := e.Inspect([]api.VolumeID{volumeID})
+	if err != nil || len(vols) != 1 {
+		return
+	}
+	if err = SetRootDir(mountpath, vols[0].Spec); err != nil {
+		log.Warnf("Failed to set the owner and permissions of volume %v: %v", volumeID, err)
+	}
+}
@@ -0,0 +1,31 @@
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestSetRootDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rootdir_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, SetRootDir(dir, &api.VolumeSpec{}))
+	spec := &api.VolumeSpec{RootDir: &api.RootDirSpec{Mode: 02770}}
+	assert.NoError(t, SetRootDir(dir, spec))
+	info, err := os.Stat(dir)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.ModeDir|os.ModeSetgid|0770, info.Mode())
+	}
+
+	uid := os.Getuid()
+	spec.RootDir.UID = &uid
+	assert.NoError(t, SetRootDir(dir, spec), "Owner already set")
+	assert.Error(t, SetRootDir(filepath.Join(dir, "missing"), spec))
+}
@@ -0,0 +1,247 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/events"
+	"github.com/libopenstorage/openstorage/pkg/worker"
+)
+
+const (
+	// ScrubIntervalParam DriverParams key for the number of hours between
+	// integrity scans of a volume. Volumes are not scanned if 0, the
+	// default.
+	ScrubIntervalParam = "scrub_interval"
+)
+
+// scrubCheckInterval is how often the scrubber looks for volumes due for a
+// scan.
+var scrubCheckInterval = 10 * time.Minute
+
+// Scrubber is implemented by drivers that can verify the integrity of a
+// volume, for instance with a read-only fsck of its filesystem or by
+// verifying the checksums of its data.
+type Scrubber interface {
+	// Scrub checks a volume without modifying it and returns the problems
+	// found, none if the volume is intact.
+	// Errors ErrEnoEnt may be returned, ErrVolDetached or ErrVolAttached
+	// if the volume cannot be checked in its current state.
+	Scrub(volumeID api.VolumeID) ([]string, error)
+}
+
+// VerifyDir reads every file under path and returns the files that fail to
+// read with an IO error. On filesystems that checksum data, such as btrfs,
+// this verifies the checksums of the data of a volume. Files are read within
+// the scrub bandwidth.
+func VerifyDir(path string) ([]string, error) {
+	var problems []string
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in := ThrottleReader(context.Background(), BandwidthScrub, f)
+		if _, err = io.Copy(ioutil.Discard, in); err != nil {
+			if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.EIO {
+				rel, _ := filepath.Rel(path, p)
+				problems = append(problems, fmt.Sprintf("%s: %v", rel, pe.Err))
+				return nil
+			}
+			return err
+		}
+		return nil
+	})
+	return problems, err
+}
+
+// scrubber periodically scans the volumes of a driver. A volume is scanned
+// once its LastScan is older than the interval. Volumes found corrupt are
+// marked Down, an EventVolumeCorrupt alert is raised on them and the event
+// published. Volumes found intact again are marked Up and the alert cleared.
+type scrubber struct {
+	name     string
+	driver   VolumeDriver
+	checker  Scrubber
+	store    Store
+	pool     *worker.Pool
+	interval time.Duration
+	stop     chan struct{}
+}
+
+func newScrubber(name string,
+	d VolumeDriver,
+	pool *worker.Pool,
+	params DriverParams) (*scrubber, error) {
+
+	checker, ok := d.(Scrubber)
+	if !ok {
+		return nil, nil
+	}
+	store, ok := d.(Store)
+	if !ok {
+		return nil, nil
+	}
+	interval, err := intParam(params, ScrubIntervalParam, 0)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, nil
+	}
+	return &scrubber{
+		name:     name,
+		driver:   d,
+		checker:  checker,
+		store:    store,
+		pool:     pool,
+		interval: time.Duration(interval) * time.Hour,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+func (s *scrubber) start() {
+	go func() {
+		t := time.NewTicker(scrubCheckInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := s.pool.Submit(s.scan); err != nil {
+					log.Warnf("%s: skipping integrity scan: %v", s.name, err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *scrubber) shutdown() {
+	close(s.stop)
+}
+
+// scan checks the volumes that are due for a scan.
+func (s *scrubber) scan() {
+	vols, err := s.driver.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		log.Warnf("%s: failed to enumerate volumes to scan: %v", s.name, err)
+		return
+	}
+	for _, v := range vols {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		if time.Since(v.LastScan) < s.interval {
+			continue
+		}
+		problems, err := s.checker.Scrub(v.ID)
+		switch err {
+		case nil:
+		case ErrVolDetached, ErrVolAttached:
+			log.Debugf("%s: volume %v cannot be scanned now: %v", s.name, v.ID, err)
+			continue
+		default:
+			log.Warnf("%s: failed to scan volume %v: %v", s.name, v.ID, err)
+			continue
+		}
+		if err = s.update(v.ID, problems); err != nil {
+			log.Warnf("%s: failed to record the scan of volume %v: %v", s.name, v.ID, err)
+		}
+	}
+}
+
+// update records the result of the scan of a volume.
+func (s *scrubber) update(volumeID api.VolumeID, problems []string) error {
+	token, err := s.store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer s.store.Unlock(token)
+
+	v, err := s.store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	v.LastScan = time.Now()
+	if len(problems) > 0 {
+		log.Errorf("%s: volume %v is corrupt: %s", s.name, volumeID,
+			strings.Join(problems, "; "))
+		v.Status = api.Down
+		raiseAlert(v, api.VolumeAlert{
+			Type:    api.EventVolumeCorrupt,
+			Time:    v.LastScan,
+			Message: strings.Join(problems, "\n"),
+		})
+		events.Publish(api.Event{
+			Type:     api.EventVolumeCorrupt,
+			Driver:   s.name,
+			VolumeID: volumeID,
+			Message:  strings.Join(problems, "\n"),
+		})
+	} else {
+		if v.Status == api.Down {
+			v.Status = api.Up
+		}
+		clearAlert(v, api.EventVolumeCorrupt)
+	}
+	return s.store.UpdateVol(v)
+}
+
+// raiseAlert raises alert on v, replacing the alert of its type.
+func raiseAlert(v *api.Volume, alert api.VolumeAlert) {
+	clearAlert(v, alert.Type)
+	v.Alerts = append(v.Alerts, alert)
+}
+
+// clearAlert clears the alert of type t of v.
+func clearAlert(v *api.Volume, t api.EventType) {
+	alerts := v.Alerts[:0]
+	for _, a := range v.Alerts {
+		if a.Type != t {
+			alerts = append(alerts, a)
+		}
+	}
+	if len(alerts) == 0 {
+		alerts = nil
+	}
+	v.Alerts = alerts
+}
+
+// Alerts returns the alerts of a volume of d, those the driver reports and
+// those raised on the volume, such as by integrity scans.
+// Errors ErrEnoEnt may be returned.
+func Alerts(d VolumeDriver, volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	alerts, err := d.Alerts(volumeID)
+	if err != nil && err != ErrNotSupported {
+		return alerts, err
+	}
+	vols, err := d.Inspect([]api.VolumeID{volumeID})
+	if err != nil {
+		return alerts, err
+	}
+	if len(vols) != 1 {
+		return alerts, ErrEnoEnt
+	}
+	alerts.Alerts = append(alerts.Alerts, vols[0].Alerts...)
+	return alerts, nil
+}
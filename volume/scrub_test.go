@@ -0,0 +1,81 @@
+package volume
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/events"
+)
+
+type scrubDriver struct {
+	ProtoDriver
+	*DefaultEnumerator
+	NotSupportedBlockDriver
+	corrupt map[api.VolumeID]bool
+}
+
+func (d *scrubDriver) Scrub(volumeID api.VolumeID) ([]string, error) {
+	if d.corrupt[volumeID] {
+		return []string{"bad superblock"}, nil
+	}
+	return nil, nil
+}
+
+func (d *scrubDriver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	return api.VolumeAlerts{}, ErrNotSupported
+}
+
+func TestScrubber(t *testing.T) {
+	d := &scrubDriver{DefaultEnumerator: e, corrupt: make(map[api.VolumeID]bool)}
+	s, err := newScrubber("scrub_test", d, nil, DriverParams{ScrubIntervalParam: "24"})
+	assert.NoError(t, err, "Failed to create scrubber")
+
+	id := api.VolumeID("TestScrubbedVolume")
+	err = e.CreateVol(&api.Volume{
+		ID:      id,
+		Locator: api.VolumeLocator{Name: string(id)},
+		State:   api.VolumeAvailable,
+		Status:  api.Up,
+		Spec:    &api.VolumeSpec{},
+	})
+	assert.NoError(t, err, "Failed in CreateVol")
+	defer e.DeleteVol(id)
+
+	sub := events.Subscribe(api.EventVolumeCorrupt)
+	defer sub.Close()
+
+	d.corrupt[id] = true
+	s.scan()
+	v, err := e.GetVol(id)
+	assert.NoError(t, err, "Failed in GetVol")
+	assert.Equal(t, api.Down, v.Status, "Corrupt volume should be down")
+	assert.False(t, v.LastScan.IsZero(), "LastScan should be set")
+	alerts, err := Alerts(d, id)
+	assert.NoError(t, err, "Failed in Alerts")
+	if assert.Len(t, alerts.Alerts, 1, "Corruption should raise an alert") {
+		assert.Equal(t, api.EventVolumeCorrupt, alerts.Alerts[0].Type)
+		assert.Equal(t, "bad superblock", alerts.Alerts[0].Message)
+	}
+	select {
+	case ev := <-sub.C:
+		assert.Equal(t, id, ev.VolumeID, "Unexpected corrupt volume")
+		assert.Equal(t, "bad superblock", ev.Message, "Unexpected problems")
+	case <-time.After(time.Second):
+		t.Fatal("No corruption event published")
+	}
+
+	// The volume is not scanned again until its interval elapses.
+	d.corrupt[id] = false
+	s.scan()
+	v, _ = e.GetVol(id)
+	assert.Equal(t, api.Down, v.Status, "Volume should not be rescanned yet")
+
+	s.interval = time.Nanosecond
+	s.scan()
+	v, _ = e.GetVol(id)
+	assert.Equal(t, api.Up, v.Status, "Intact volume should be up")
+	assert.Len(t, v.Alerts, 0, "Alert should be cleared once the volume is intact")
+}
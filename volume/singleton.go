@@ -0,0 +1,28 @@
+package volume
+
+// Singleton runs service until the returned function is called. In a cluster
+// it runs service on one node at a time, see cluster.SingletonRunner.
+type Singleton func(name string, service func(stop <-chan struct{})) (stop func())
+
+var singleton Singleton = runLocal
+
+// SetSingleton sets how background services that must not run on several
+// nodes at once, such as the trash reaper, are run. They run on every node
+// by default. It must be called before drivers are started.
+func SetSingleton(s Singleton) {
+	singleton = s
+}
+
+// runLocal runs service on this node.
+func runLocal(name string, service func(stop <-chan struct{})) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service(stop)
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
@@ -5,7 +5,7 @@ import "github.com/libopenstorage/openstorage/api"
 type SnapshotNotSupported struct {
 }
 
-func (s *SnapshotNotSupported) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+func (s *SnapshotNotSupported) Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error) {
 	return api.BadSnapID, ErrNotSupported
 }
 
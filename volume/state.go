@@ -0,0 +1,91 @@
+package volume
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// MaxStateHistory is the number of state transitions retained per volume.
+const MaxStateHistory = 16
+
+var (
+	// ErrInvalidTransition is returned for a volume state change that is not
+	// permitted from the volume's current state.
+	ErrInvalidTransition = errors.New("Invalid volume state transition")
+)
+
+// transitions maps a state to the set of states it may move to.
+var transitions = map[api.VolumeState]api.VolumeState{
+	api.VolumePending: api.VolumeAvailable | api.VolumeAttached |
+		api.VolumeDetached | api.VolumeError | api.VolumeDeleted,
+	api.VolumeAvailable: api.VolumePending | api.VolumeAttached |
+		api.VolumeDetached | api.VolumeError | api.VolumeDeleted,
+	api.VolumeAttached: api.VolumePending | api.VolumeAvailable |
+		api.VolumeDetached | api.VolumeError,
+	api.VolumeDetached: api.VolumePending | api.VolumeAvailable |
+		api.VolumeAttached | api.VolumeError | api.VolumeDeleted,
+	api.VolumeError: api.VolumePending | api.VolumeAvailable |
+		api.VolumeAttached | api.VolumeDetached | api.VolumeDeleted,
+	// Deleted volumes are only kept while in the trash.
+	api.VolumeDeleted: api.VolumeAvailable,
+}
+
+// CheckTransition validates that a volume may move from one state to another.
+// Staying in the same state is always valid.
+// Errors ErrVolAttached, ErrInvalidTransition may be returned.
+func CheckTransition(from, to api.VolumeState) error {
+	if from == to {
+		return nil
+	}
+	// Volumes created before states were tracked have no state.
+	if from == 0 {
+		return nil
+	}
+	if transitions[from]&to != 0 {
+		return nil
+	}
+	if from == api.VolumeAttached && to == api.VolumeDeleted {
+		return ErrVolAttached
+	}
+	log.Warnf("Rejecting volume state transition %v -> %v", from, to)
+	return ErrInvalidTransition
+}
+
+// SetState moves vol to state, recording the transition and reason in the
+// volume's StateHistory.
+// Errors ErrVolAttached, ErrInvalidTransition may be returned.
+func SetState(vol *api.Volume, state api.VolumeState, reason string) error {
+	if err := CheckTransition(vol.State, state); err != nil {
+		return err
+	}
+	recordTransition(vol, vol.State, state, reason)
+	vol.State = state
+	return nil
+}
+
+// recordTransition appends from -> to to the history of vol, unless it is a
+// no-op or was already recorded by SetState.
+func recordTransition(vol *api.Volume, from, to api.VolumeState, reason string) {
+	if from == to {
+		return
+	}
+	if n := len(vol.StateHistory); n != 0 {
+		last := vol.StateHistory[n-1]
+		if last.From == from && last.To == to && vol.State == to {
+			return
+		}
+	}
+	vol.StateHistory = append(vol.StateHistory, api.StateTransition{
+		From:   from,
+		To:     to,
+		Time:   time.Now(),
+		Reason: reason,
+	})
+	if n := len(vol.StateHistory); n > MaxStateHistory {
+		vol.StateHistory = vol.StateHistory[n-MaxStateHistory:]
+	}
+}
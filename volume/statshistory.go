@@ -0,0 +1,237 @@
+package volume
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/worker"
+)
+
+const (
+	// StatsIntervalParam DriverParams key for the number of seconds between
+	// samples of the IO statistics of the volumes, 0 disables the history.
+	StatsIntervalParam = "stats_interval"
+	// StatsRetentionParam DriverParams key for the number of seconds of
+	// samples kept for each volume.
+	StatsRetentionParam = "stats_retention"
+	// DefaultStatsInterval number of seconds between stats samples.
+	DefaultStatsInterval = 60
+	// DefaultStatsRetention number of seconds of stats samples kept.
+	DefaultStatsRetention = 3600
+)
+
+// StatsHistorian is implemented by drivers that keep the history of the IO
+// statistics of their volumes natively, and by clients of remote drivers.
+// Use StatsHistory to get the history of the volumes of any driver.
+type StatsHistorian interface {
+	// StatsHistory returns the samples of volumeID taken after since,
+	// oldest first.
+	// Errors ErrEnoEnt, ErrNotSupported may be returned.
+	StatsHistory(volumeID api.VolumeID, since time.Time) ([]api.VolumeStatsSample, error)
+}
+
+// StatsHistory returns the IO rates of volumeID of d sampled after since,
+// oldest first. The samples are kept in memory for StatsRetentionParam
+// seconds and are lost when the driver restarts.
+// Errors ErrEnoEnt, ErrNotSupported may be returned.
+func StatsHistory(d VolumeDriver, volumeID api.VolumeID, since time.Time) ([]api.VolumeStatsSample, error) {
+	if h, ok := d.(StatsHistorian); ok {
+		return h.StatsHistory(volumeID, since)
+	}
+	name := instanceName(d)
+	mutex.Lock()
+	h, ok := histories[name]
+	mutex.Unlock()
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	if samples, ok := h.samples(volumeID, since); ok {
+		return samples, nil
+	}
+	if _, err := d.Inspect([]api.VolumeID{volumeID}); err != nil {
+		return nil, err
+	}
+	return []api.VolumeStatsSample{}, nil
+}
+
+// statsRing holds the latest samples of a volume, overwriting the oldest
+// once full.
+type statsRing struct {
+	samples []api.VolumeStatsSample
+	next    int
+	full    bool
+	last    api.VolumeStats
+	lastAt  time.Time
+}
+
+func (r *statsRing) add(s api.VolumeStatsSample) {
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// since returns the samples taken after t, oldest first.
+func (r *statsRing) since(t time.Time) []api.VolumeStatsSample {
+	ordered := r.samples[:r.next]
+	if r.full {
+		ordered = append(append([]api.VolumeStatsSample{}, r.samples[r.next:]...), ordered...)
+	}
+	out := make([]api.VolumeStatsSample, 0, len(ordered))
+	for _, s := range ordered {
+		if s.Time.After(t) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// rate returns the sample of the IO between prev at from and cur at to, or
+// false if the counters went backwards, as when the volume was recreated.
+func rate(prev, cur api.VolumeStats, from, to time.Time) (api.VolumeStatsSample, bool) {
+	secs := to.Sub(from).Seconds()
+	if secs <= 0 || cur.Reads < prev.Reads || cur.Writes < prev.Writes ||
+		cur.ReadBytes < prev.ReadBytes || cur.WriteBytes < prev.WriteBytes ||
+		cur.ReadMs < prev.ReadMs || cur.WriteMs < prev.WriteMs {
+		return api.VolumeStatsSample{}, false
+	}
+	s := api.VolumeStatsSample{
+		Time:      to,
+		ReadIOPS:  float64(cur.Reads-prev.Reads) / secs,
+		WriteIOPS: float64(cur.Writes-prev.Writes) / secs,
+		ReadBps:   float64(cur.ReadBytes-prev.ReadBytes) / secs,
+		WriteBps:  float64(cur.WriteBytes-prev.WriteBytes) / secs,
+	}
+	if n := cur.Reads - prev.Reads; n > 0 {
+		s.ReadLatencyMs = float64(cur.ReadMs-prev.ReadMs) / float64(n)
+	}
+	if n := cur.Writes - prev.Writes; n > 0 {
+		s.WriteLatencyMs = float64(cur.WriteMs-prev.WriteMs) / float64(n)
+	}
+	return s, true
+}
+
+// statsHistory periodically samples the IO statistics of all volumes of a
+// driver into a ring per volume.
+type statsHistory struct {
+	name     string
+	driver   VolumeDriver
+	pool     *worker.Pool
+	interval time.Duration
+	size     int
+	stop     chan struct{}
+	lock     sync.Mutex
+	rings    map[api.VolumeID]*statsRing
+}
+
+func newStatsHistory(name string,
+	d VolumeDriver,
+	pool *worker.Pool,
+	params DriverParams) (*statsHistory, error) {
+
+	if _, ok := d.(StatsHistorian); ok {
+		return nil, nil
+	}
+	interval, err := intParam(params, StatsIntervalParam, DefaultStatsInterval)
+	if err != nil {
+		return nil, err
+	}
+	retention, err := intParam(params, StatsRetentionParam, DefaultStatsRetention)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 || retention <= 0 {
+		return nil, nil
+	}
+	size := retention / interval
+	if size < 1 {
+		size = 1
+	}
+	return &statsHistory{
+		name:     name,
+		driver:   d,
+		pool:     pool,
+		interval: time.Duration(interval) * time.Second,
+		size:     size,
+		stop:     make(chan struct{}),
+		rings:    make(map[api.VolumeID]*statsRing),
+	}, nil
+}
+
+func (h *statsHistory) start() {
+	go func() {
+		t := time.NewTicker(h.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := h.pool.Submit(func() { h.sample(time.Now()) }); err != nil {
+					log.Warnf("%s: skipping stats sample: %v", h.name, err)
+				}
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (h *statsHistory) shutdown() {
+	close(h.stop)
+}
+
+// sample records the IO rates of each volume since the previous sample at
+// now. Volumes that no longer exist lose their history.
+func (h *statsHistory) sample(now time.Time) {
+	vols, err := h.driver.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		log.Warnf("%s: failed to enumerate volumes for stats: %v", h.name, err)
+		return
+	}
+	current := make(map[api.VolumeID]api.VolumeStats, len(vols))
+	for _, v := range vols {
+		stats, err := h.driver.Stats(v.ID)
+		switch err {
+		case nil:
+			current[v.ID] = stats
+		case ErrNotSupported:
+			return
+		default:
+			log.Debugf("%s: failed to get stats for %v: %v", h.name, v.ID, err)
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for id := range h.rings {
+		if _, ok := current[id]; !ok {
+			delete(h.rings, id)
+		}
+	}
+	for id, stats := range current {
+		r, ok := h.rings[id]
+		if !ok {
+			r = &statsRing{samples: make([]api.VolumeStatsSample, h.size)}
+			h.rings[id] = r
+		} else if s, ok := rate(r.last, stats, r.lastAt, now); ok {
+			r.add(s)
+		}
+		r.last = stats
+		r.lastAt = now
+	}
+}
+
+// samples returns the samples of volumeID taken after since, or false if the
+// volume has not been sampled.
+func (h *statsHistory) samples(volumeID api.VolumeID, since time.Time) ([]api.VolumeStatsSample, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	r, ok := h.rings[volumeID]
+	if !ok {
+		return nil, false
+	}
+	return r.since(since), true
+}
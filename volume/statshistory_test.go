@@ -0,0 +1,87 @@
+package volume
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// statsDriver has the volumes of its stats.
+type statsDriver struct {
+	capabilityDriver
+	stats map[api.VolumeID]api.VolumeStats
+}
+
+func (d *statsDriver) String() string { return "stats_test" }
+
+func (d *statsDriver) Enumerate(locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error) {
+	vols := make([]api.Volume, 0, len(d.stats))
+	for id := range d.stats {
+		vols = append(vols, api.Volume{ID: id})
+	}
+	return vols, nil
+}
+
+func (d *statsDriver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	return d.stats[volumeID], nil
+}
+
+func TestStatsHistory(t *testing.T) {
+	d := &statsDriver{
+		capabilityDriver: capabilityDriver{t: File},
+		stats:            map[api.VolumeID]api.VolumeStats{"v1": {}},
+	}
+	_, err := newStatsHistory("stats_test", d, nil, DriverParams{StatsIntervalParam: "often"})
+	assert.Error(t, err)
+	h, err := newStatsHistory("stats_test", d, nil, DriverParams{
+		StatsIntervalParam:  "10",
+		StatsRetentionParam: "30",
+	})
+	assert.NoError(t, err)
+
+	start := time.Now()
+	h.sample(start)
+	samples, ok := h.samples("v1", time.Time{})
+	assert.True(t, ok)
+	assert.Empty(t, samples, "Sampled without a previous sample")
+
+	for i := 1; i <= 4; i++ {
+		d.stats["v1"] = api.VolumeStats{
+			Reads:      uint64(100 * i),
+			ReadMs:     uint64(200 * i),
+			ReadBytes:  uint64(4096 * 100 * i),
+			Writes:     uint64(10 * i),
+			WriteBytes: uint64(4096 * 10 * i),
+		}
+		h.sample(start.Add(time.Duration(i) * 10 * time.Second))
+	}
+	samples, _ = h.samples("v1", time.Time{})
+	if assert.Len(t, samples, 3, "Retention not applied") {
+		assert.Equal(t, start.Add(20*time.Second), samples[0].Time)
+		assert.Equal(t, start.Add(40*time.Second), samples[2].Time)
+		assert.Equal(t, api.VolumeStatsSample{
+			Time:          start.Add(40 * time.Second),
+			ReadIOPS:      10,
+			WriteIOPS:     1,
+			ReadBps:       40960,
+			WriteBps:      4096,
+			ReadLatencyMs: 2,
+		}, samples[2])
+	}
+	samples, _ = h.samples("v1", start.Add(30*time.Second))
+	assert.Len(t, samples, 1)
+
+	// Counters going backwards are not sampled.
+	d.stats["v1"] = api.VolumeStats{}
+	h.sample(start.Add(50 * time.Second))
+	samples, _ = h.samples("v1", time.Time{})
+	assert.Equal(t, start.Add(40*time.Second), samples[len(samples)-1].Time)
+
+	delete(d.stats, "v1")
+	h.sample(start.Add(60 * time.Second))
+	_, ok = h.samples("v1", time.Time{})
+	assert.False(t, ok, "History of a deleted volume kept")
+}
@@ -0,0 +1,207 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/fs"
+)
+
+// subpathRoot is where volumes that are not mounted are mounted to bind mount
+// their subdirectories from.
+var subpathRoot = path.Join(DefaultMountRoot, "subpath")
+
+// stagingPath returns where volumeID is mounted to bind mount its
+// subdirectories from if it is not mounted elsewhere.
+func stagingPath(volumeID api.VolumeID) string {
+	return path.Join(subpathRoot, string(volumeID))
+}
+
+// checkSubPath returns an error if sub is not a path relative to the root of
+// a volume that stays within it.
+func checkSubPath(sub string) error {
+	c := path.Clean(sub)
+	if path.IsAbs(c) || c == ".." || strings.HasPrefix(c, "../") {
+		return fmt.Errorf("Invalid sub path %q, must be relative to the volume and within it", sub)
+	}
+	return nil
+}
+
+// openSubpath creates the directory sub, and its missing parents, of the
+// volume mounted at root and returns it open. Each component is opened
+// relative to its parent without following symbolic links, so that the
+// files of the volume cannot have a directory of the host bind mounted
+// instead, even if they are changed while it is opened. The directory is to
+// be bind mounted through its /proc/self/fd path.
+func openSubpath(root string, sub string) (*os.File, error) {
+	fd, err := syscall.Open(root, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	dir := root
+	for _, name := range strings.Split(path.Clean(sub), "/") {
+		if name == "." {
+			continue
+		}
+		dir = path.Join(dir, name)
+		if err = syscall.Mkdirat(fd, name, 0755); err != nil && err != syscall.EEXIST {
+			syscall.Close(fd)
+			return nil, &os.PathError{Op: "mkdir", Path: dir, Err: err}
+		}
+		next, err := syscall.Openat(fd, name,
+			syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+		syscall.Close(fd)
+		if err == syscall.ELOOP || err == syscall.ENOTDIR {
+			return nil, fmt.Errorf("Invalid sub path %q, %s is not a directory of the volume", sub, dir)
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: dir, Err: err}
+		}
+		fd = next
+	}
+	return os.NewFile(uintptr(fd), dir), nil
+}
+
+// mountedHere returns true if a filesystem is mounted at mountpath on this
+// node.
+func mountedHere(mountpath string) bool {
+	table, err := fs.MountTable()
+	if err != nil {
+		return false
+	}
+	mountpath = filepath.Clean(mountpath)
+	for _, m := range table {
+		if m.Path == mountpath {
+			return true
+		}
+	}
+	return false
+}
+
+// mountSubpath bind mounts the directory sub of a volume of d at mountpath.
+// A volume that is not mounted on this node, as the mount table tells, is
+// mounted at its staging path first. The bind mount is recorded in the volume so that UnmountCtx
+// unmounts it, and the staged mount with the last bind mount.
+// Errors ErrEnoEnt, ErrNotSupported, ErrVolMaintenance may be returned.
+func mountSubpath(ctx context.Context,
+	d ProtoDriver,
+	volumeID api.VolumeID,
+	mountpath string,
+	sub string) (err error) {
+	store, ok := d.(Store)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err = checkMaintenance(d, volumeID); err != nil {
+		return err
+	}
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	source := v.AttachPath
+	if source == "" || !mountedHere(source) {
+		source = stagingPath(volumeID)
+		if err = os.MkdirAll(source, 0755); err != nil {
+			return err
+		}
+		if err = MountCtx(ctx, d, volumeID, source); err != nil {
+			return err
+		}
+		defer func() {
+			if err == nil {
+				return
+			}
+			if uerr := UnmountCtx(ctx, d, volumeID, source); uerr != nil {
+				log.Warnf("Failed to unmount volume %v from %s: %v", volumeID, source, uerr)
+			}
+		}()
+	}
+	dir, err := openSubpath(source, sub)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if err = os.MkdirAll(mountpath, 0755); err != nil {
+		return err
+	}
+	fdPath := fmt.Sprintf("/proc/self/fd/%d", dir.Fd())
+	if err = syscall.Mount(fdPath, mountpath, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("Failed to bind mount %v at %v: %v", dir.Name(), mountpath, err)
+	}
+	if _, err = updateSubpathMounts(store, volumeID, mountpath, true); err != nil {
+		syscall.Unmount(mountpath, 0)
+		return err
+	}
+	recordUsage(d, volumeID, api.UsageMount, mountpath)
+	return nil
+}
+
+// unmountSubpath unmounts mountpath if it is a bind mount of a subdirectory
+// of a volume of d, and the volume from its staging path once no such bind
+// mount is left. It returns false if mountpath is not such a bind mount.
+func unmountSubpath(ctx context.Context,
+	d ProtoDriver,
+	volumeID api.VolumeID,
+	mountpath string) (bool, error) {
+	store, ok := d.(Store)
+	if !ok {
+		return false, nil
+	}
+	v, err := store.GetVol(volumeID)
+	if err != nil || indexOf(v.SubpathMounts, mountpath) < 0 {
+		return false, nil
+	}
+	// The bind mount may be gone already, such as after a reboot.
+	if err = syscall.Unmount(mountpath, 0); err != nil && err != syscall.EINVAL {
+		return true, fmt.Errorf("Failed to unmount %v: %v", mountpath, err)
+	}
+	if v, err = updateSubpathMounts(store, volumeID, mountpath, false); err != nil {
+		return true, err
+	}
+	if len(v.SubpathMounts) == 0 && v.AttachPath == stagingPath(volumeID) {
+		return true, UnmountCtx(ctx, d, volumeID, v.AttachPath)
+	}
+	return true, nil
+}
+
+// updateSubpathMounts adds or removes mountpath from the subpath mounts of
+// volumeID and returns the updated volume.
+func updateSubpathMounts(store Store,
+	volumeID api.VolumeID,
+	mountpath string,
+	add bool) (*api.Volume, error) {
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Unlock(token)
+	v, err := store.GetVol(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	i := indexOf(v.SubpathMounts, mountpath)
+	if add && i < 0 {
+		v.SubpathMounts = append(v.SubpathMounts, mountpath)
+	} else if !add && i >= 0 {
+		v.SubpathMounts = append(v.SubpathMounts[:i], v.SubpathMounts[i+1:]...)
+	}
+	return v, store.UpdateVol(v)
+}
+
+func indexOf(paths []string, p string) int {
+	for i := range paths {
+		if paths[i] == p {
+			return i
+		}
+	}
+	return -1
+}
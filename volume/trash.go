@@ -0,0 +1,201 @@
+package volume
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/worker"
+)
+
+const (
+	// TrashGraceParam DriverParams key for the number of hours a deleted
+	// volume is kept in the trash before it is purged. Volumes are deleted
+	// immediately if 0, which is the default.
+	TrashGraceParam = "trash_grace"
+	// trashReapInterval time between checks for expired volumes.
+	trashReapInterval = 10 * time.Minute
+)
+
+var (
+	// ErrNotInTrash is returned when restoring a volume that is not in the
+	// trash.
+	ErrNotInTrash = errors.New("Volume is not in the trash")
+)
+
+// Recycler is implemented by drivers and clients that keep deleted volumes
+// in a trash for a grace period.
+type Recycler interface {
+	// Restore moves a volume out of the trash.
+	// Errors ErrEnoEnt, ErrNotInTrash may be returned.
+	Restore(volumeID api.VolumeID) error
+
+	// Trashed lists the volumes in the trash.
+	Trashed() ([]api.Volume, error)
+}
+
+// trashStore is the Store of a driver that can list deleted volumes.
+type trashStore interface {
+	Store
+	CanDelete(volumeID api.VolumeID) error
+	EnumerateDeleted() ([]api.Volume, error)
+}
+
+// Trash soft deletes the volumes of a driver. Deleted volumes are moved to
+// the VolumeDeleted state and keep their data until they are restored or
+// their grace period expires and they are purged.
+type Trash struct {
+	name   string
+	driver VolumeDriver
+	store  trashStore
+	pool   *worker.Pool
+	grace  time.Duration
+	stop   func()
+}
+
+func newTrash(name string,
+	d VolumeDriver,
+	pool *worker.Pool,
+	params DriverParams) (*Trash, error) {
+
+	hours, err := intParam(params, TrashGraceParam, 0)
+	if err != nil {
+		return nil, err
+	}
+	if hours <= 0 {
+		return nil, nil
+	}
+	store, ok := d.(trashStore)
+	if !ok {
+		log.Warnf("%s: cannot keep deleted volumes in the trash: %v", name, ErrNotSupported)
+		return nil, nil
+	}
+	return &Trash{
+		name:   name,
+		driver: d,
+		store:  store,
+		pool:   pool,
+		grace:  time.Duration(hours) * time.Hour,
+	}, nil
+}
+
+// GetTrash returns the trash of the named driver.
+// Errors ErrNotSupported may be returned if the driver deletes volumes
+// immediately.
+func GetTrash(name string) (*Trash, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if t, ok := trashes[name]; ok {
+		return t, nil
+	}
+	return nil, ErrNotSupported
+}
+
+// Delete moves a volume to the trash.
+// Errors ErrEnoEnt, ErrVolAttached, ErrVolHasSnaps may be returned.
+func (t *Trash) Delete(volumeID api.VolumeID) error {
+	if err := t.store.CanDelete(volumeID); err != nil {
+		return err
+	}
+	return t.update(volumeID, func(vol *api.Volume) error {
+		if err := SetState(vol, api.VolumeDeleted, "moved to trash"); err != nil {
+			return err
+		}
+		vol.DeleteTime = time.Now()
+		return nil
+	})
+}
+
+// Restore moves a volume out of the trash.
+// Errors ErrEnoEnt, ErrNotInTrash may be returned.
+func (t *Trash) Restore(volumeID api.VolumeID) error {
+	return t.update(volumeID, func(vol *api.Volume) error {
+		if vol.State != api.VolumeDeleted {
+			return ErrNotInTrash
+		}
+		if err := SetState(vol, api.VolumeAvailable, "restored from trash"); err != nil {
+			return err
+		}
+		vol.DeleteTime = time.Time{}
+		return nil
+	})
+}
+
+// Trashed lists the volumes in the trash.
+func (t *Trash) Trashed() ([]api.Volume, error) {
+	return t.store.EnumerateDeleted()
+}
+
+// Purge deletes a volume in the trash and its data.
+// Errors ErrEnoEnt, ErrNotInTrash may be returned.
+func (t *Trash) Purge(volumeID api.VolumeID) error {
+	vol, err := t.store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if vol.State != api.VolumeDeleted {
+		return ErrNotInTrash
+	}
+	return t.driver.Delete(volumeID)
+}
+
+func (t *Trash) update(volumeID api.VolumeID, f func(vol *api.Volume) error) error {
+	token, err := t.store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer t.store.Unlock(token)
+	vol, err := t.store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if err = f(vol); err != nil {
+		return err
+	}
+	return t.store.UpdateVol(vol)
+}
+
+// start purges expired volumes periodically. Drivers may share their
+// volumes across nodes, only one node purges the trash of a driver.
+func (t *Trash) start() {
+	t.stop = singleton("trash/"+t.name, func(stop <-chan struct{}) {
+		tick := time.NewTicker(trashReapInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				if err := t.pool.Submit(t.reap); err != nil {
+					log.Warnf("%s: skipping trash purge: %v", t.name, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	})
+}
+
+func (t *Trash) shutdown() {
+	if t.stop != nil {
+		t.stop()
+	}
+}
+
+// reap purges the volumes whose grace period has expired.
+func (t *Trash) reap() {
+	vols, err := t.Trashed()
+	if err != nil {
+		log.Warnf("%s: failed to list the trash: %v", t.name, err)
+		return
+	}
+	for _, v := range vols {
+		if time.Since(v.DeleteTime) < t.grace {
+			continue
+		}
+		log.Infof("%s: purging volume %v deleted at %v", t.name, v.ID, v.DeleteTime)
+		if err := t.Purge(v.ID); err != nil {
+			log.Warnf("%s: failed to purge volume %v: %v", t.name, v.ID, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package volume
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type trashDriver struct {
+	ProtoDriver
+	*DefaultEnumerator
+	NotSupportedBlockDriver
+}
+
+func (d *trashDriver) Delete(volumeID api.VolumeID) error {
+	return d.DeleteVol(volumeID)
+}
+
+func TestTrash(t *testing.T) {
+	d := &trashDriver{DefaultEnumerator: e}
+	trash, err := newTrash("trash_test", d, nil, DriverParams{TrashGraceParam: "1"})
+	assert.NoError(t, err, "Failed to create trash")
+
+	id := api.VolumeID("TestTrashedVolume")
+	vol := api.Volume{
+		ID:      id,
+		Locator: api.VolumeLocator{Name: string(id)},
+		State:   api.VolumeAvailable,
+		Spec:    &api.VolumeSpec{},
+	}
+	err = e.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+
+	assert.Equal(t, ErrNotInTrash, trash.Restore(id), "Live volume should not be restored")
+	assert.NoError(t, trash.Delete(id), "Failed to move volume to the trash")
+	vols, err := e.Enumerate(api.VolumeLocator{Name: string(id)}, nil)
+	assert.NoError(t, err, "Failed in Enumerate")
+	assert.Equal(t, 0, len(vols), "Trashed volume should not be enumerated")
+	vols, err = trash.Trashed()
+	assert.NoError(t, err, "Failed to list the trash")
+	assert.Equal(t, 1, len(vols), "Trashed volume should be listed")
+
+	assert.NoError(t, trash.Restore(id), "Failed to restore volume")
+	v, err := e.GetVol(id)
+	assert.NoError(t, err, "Failed in GetVol")
+	assert.Equal(t, api.VolumeAvailable, v.State, "Restored volume should be available")
+	assert.True(t, v.DeleteTime.IsZero(), "Restored volume should not have a delete time")
+
+	assert.NoError(t, trash.Delete(id), "Failed to move volume to the trash")
+	trash.reap()
+	_, err = e.GetVol(id)
+	assert.NoError(t, err, "Volume should be kept for its grace period")
+
+	trash.grace = time.Nanosecond
+	trash.reap()
+	_, err = e.GetVol(id)
+	assert.Error(t, err, "Expired volume should be purged")
+}
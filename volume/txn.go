@@ -0,0 +1,287 @@
+package volume
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pborman/uuid"
+	"github.com/portworx/kvdb"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const txns = "/txns/"
+
+// TxnRecoverer is implemented by stores that complete the transactions
+// interrupted by a crash, such as DefaultEnumerator. New recovers them
+// before the driver is returned.
+type TxnRecoverer interface {
+	// RecoverTxns completes the transactions this node left half done.
+	RecoverTxns() error
+}
+
+// Txn is a set of KVDB writes applied all or nothing. Before the writes are
+// applied, they are saved with the values they replace in a log in the KVDB,
+// which commits the transaction. A failed commit is rolled back, and a commit
+// interrupted by a crash is rolled forward by RecoverTxns when the driver
+// starts again, leaving alone the keys written since by others. Keys written
+// by a transaction must not be written concurrently by others, which the
+// volume locks ensure for the keys of a volume.
+type Txn struct {
+	kv     kvdb.Kvdb
+	prefix string
+	ops    []txnOp
+	err    error
+}
+
+type txnOp struct {
+	key    string
+	value  []byte
+	create bool
+	delete bool
+}
+
+// txnUndo restores a key written by a transaction.
+type txnUndo struct {
+	Key     string
+	Value   []byte `json:",omitempty"`
+	Existed bool
+	// Index is the ModifiedIndex of the key before the transaction.
+	Index uint64 `json:",omitempty"`
+}
+
+// txnRedo is a write of a transaction.
+type txnRedo struct {
+	Key    string
+	Value  []byte `json:",omitempty"`
+	Delete bool   `json:",omitempty"`
+}
+
+// txnLog is the log of a transaction being committed.
+type txnLog struct {
+	ID      string
+	Started time.Time
+	Undo    []txnUndo
+	Redo    []txnRedo
+	// Aborted is set when a failed commit could not be rolled back, so that
+	// RecoverTxns rolls it back rather than forward.
+	Aborted bool `json:",omitempty"`
+}
+
+// Txn returns a new transaction on the KVDB of e.
+func (e *DefaultEnumerator) Txn() *Txn {
+	return &Txn{
+		kv:     e.kvdb,
+		prefix: e.txnKeyPrefix + string(NodeID()) + "/",
+	}
+}
+
+func (t *Txn) add(key string, value interface{}, create bool) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		if t.err == nil {
+			t.err = err
+		}
+		return
+	}
+	t.ops = append(t.ops, txnOp{key: key, value: b, create: create})
+}
+
+// Put sets key to value on commit.
+func (t *Txn) Put(key string, value interface{}) {
+	t.add(key, value, false)
+}
+
+// Create sets key to value on commit. The commit fails with kvdb.ErrExist
+// if key exists.
+func (t *Txn) Create(key string, value interface{}) {
+	t.add(key, value, true)
+}
+
+// Delete removes key on commit, if it exists.
+func (t *Txn) Delete(key string) {
+	t.ops = append(t.ops, txnOp{key: key, delete: true})
+}
+
+// Commit applies the writes of t. If any fails, those applied are rolled
+// back and the error is returned.
+// Errors kvdb.ErrExist may be returned.
+func (t *Txn) Commit() error {
+	if t.err != nil {
+		return t.err
+	}
+	t.compact()
+	if len(t.ops) == 0 {
+		return nil
+	}
+	l := &txnLog{ID: uuid.New(), Started: time.Now()}
+	for _, op := range t.ops {
+		u := txnUndo{Key: op.key}
+		kvp, err := t.kv.Get(op.key)
+		switch err {
+		case nil:
+			if op.create {
+				return kvdb.ErrExist
+			}
+			u.Value, u.Existed, u.Index = kvp.Value, true, kvp.ModifiedIndex
+		case kvdb.ErrNotFound:
+		default:
+			return err
+		}
+		l.Undo = append(l.Undo, u)
+		l.Redo = append(l.Redo, txnRedo{Key: op.key, Value: op.value, Delete: op.delete})
+	}
+	key := t.prefix + l.ID
+	if _, err := t.kv.Put(key, l, 0); err != nil {
+		return err
+	}
+
+	err := t.apply()
+	if err == nil {
+		// The transaction is committed, a log left behind is rolled forward
+		// on restart, which finds its writes done.
+		if _, err = t.kv.Delete(key); err != nil {
+			log.Warnf("Failed to remove the log of transaction %s: %v", l.ID, err)
+		}
+		return nil
+	}
+	if rerr := rollback(t.kv, l); rerr != nil {
+		log.Warnf("Failed to roll back transaction %s, it is rolled back on restart: %v", l.ID, rerr)
+		l.Aborted = true
+		if _, perr := t.kv.Put(key, l, 0); perr != nil {
+			log.Warnf("Failed to abort transaction %s: %v", l.ID, perr)
+		}
+		return err
+	}
+	if _, derr := t.kv.Delete(key); derr != nil && derr != kvdb.ErrNotFound {
+		log.Warnf("Failed to remove the log of transaction %s: %v", l.ID, derr)
+	}
+	return err
+}
+
+// compact merges the writes of t to the same key into the last one, so that
+// each key is written once.
+func (t *Txn) compact() {
+	ops := make([]txnOp, 0, len(t.ops))
+	index := make(map[string]int, len(t.ops))
+	for _, op := range t.ops {
+		i, ok := index[op.key]
+		if !ok {
+			index[op.key] = len(ops)
+			ops = append(ops, op)
+			continue
+		}
+		// A key created and then written must still not exist.
+		op.create = op.create || (ops[i].create && !op.delete)
+		ops[i] = op
+	}
+	t.ops = ops
+}
+
+func (t *Txn) apply() error {
+	for _, op := range t.ops {
+		var err error
+		switch {
+		case op.delete:
+			if _, err = t.kv.Delete(op.key); err == kvdb.ErrNotFound {
+				err = nil
+			}
+		case op.create:
+			_, err = t.kv.Create(op.key, op.value, 0)
+		default:
+			_, err = t.kv.Put(op.key, op.value, 0)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback restores the keys of l to their values before the transaction.
+func rollback(kv kvdb.Kvdb, l *txnLog) error {
+	for i := len(l.Undo) - 1; i >= 0; i-- {
+		u := l.Undo[i]
+		var err error
+		if u.Existed {
+			_, err = kv.Put(u.Key, u.Value, 0)
+		} else if _, err = kv.Delete(u.Key); err == kvdb.ErrNotFound {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollForward applies the writes of l not done yet. Keys changed since the
+// transaction started, by it or by others, are left as they are.
+func rollForward(kv kvdb.Kvdb, l *txnLog) error {
+	for i, r := range l.Redo {
+		if i >= len(l.Undo) || l.Undo[i].Key != r.Key {
+			return fmt.Errorf("Malformed log of transaction %s", l.ID)
+		}
+		u := l.Undo[i]
+		kvp, err := kv.Get(r.Key)
+		switch {
+		case err == kvdb.ErrNotFound:
+			if u.Existed || r.Delete {
+				continue
+			}
+			_, err = kv.Create(r.Key, r.Value, 0)
+		case err != nil:
+			return err
+		case !u.Existed || kvp.ModifiedIndex != u.Index:
+			continue
+		case r.Delete:
+			_, err = kv.CompareAndDelete(kvp, kvdb.KVModifiedIndex)
+		default:
+			kvp.Value = r.Value
+			_, err = kv.CompareAndSet(kvp, kvdb.KVModifiedIndex, nil)
+		}
+		if err != nil && err != kvdb.ErrExist && err != kvdb.ErrModified && err != kvdb.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecoverTxns completes the transactions this node left half done on the
+// volumes of e: committed ones are rolled forward, aborted ones rolled back.
+// Logs that cannot be recovered are kept for the next try.
+func (e *DefaultEnumerator) RecoverTxns() error {
+	prefix := e.txnKeyPrefix + string(NodeID()) + "/"
+	kvp, err := e.kvdb.Enumerate(prefix)
+	if err != nil || len(kvp) == 0 {
+		return err
+	}
+	for _, v := range kvp {
+		var l txnLog
+		if err = json.Unmarshal(v.Value, &l); err != nil {
+			log.Warnf("%s: skipping malformed transaction log %s: %v", e.driver, v.Key, err)
+			continue
+		}
+		if l.Aborted {
+			log.Infof("%s: rolling back aborted transaction %s started at %v", e.driver, l.ID, l.Started)
+			err = rollback(e.kvdb, &l)
+		} else {
+			log.Infof("%s: rolling forward interrupted transaction %s started at %v", e.driver, l.ID, l.Started)
+			err = rollForward(e.kvdb, &l)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = e.kvdb.Delete(v.Key); err != nil {
+			return err
+		}
+	}
+	// The cache may hold the volumes recovered.
+	e.cacheLock.Lock()
+	e.cache = make(map[api.VolumeID]cachedVol)
+	e.cacheWarm = false
+	e.cacheLock.Unlock()
+	return nil
+}
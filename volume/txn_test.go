@@ -0,0 +1,129 @@
+package volume
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// failingKvdb fails the writes of keys containing fail.
+type failingKvdb struct {
+	kvdb.Kvdb
+	fail string
+}
+
+var errKvdbDown = errors.New("kvdb down")
+
+func (f *failingKvdb) Put(key string, value interface{}, ttl uint64) (*kvdb.KVPair, error) {
+	if f.fail != "" && strings.Contains(key, f.fail) {
+		return nil, errKvdbDown
+	}
+	return f.Kvdb.Put(key, value, ttl)
+}
+
+func getString(kv kvdb.Kvdb, key string) string {
+	var s string
+	if _, err := kv.GetVal(key, &s); err != nil {
+		return ""
+	}
+	return s
+}
+
+func TestTxn(t *testing.T) {
+	kv := &failingKvdb{Kvdb: kvdb.Instance()}
+	te := NewDefaultEnumerator("txn_test", kv)
+	defer kv.DeleteTree(keyBase + "txn_test")
+	key := func(k string) string { return keyBase + "txn_test/keys/" + k }
+
+	txn := te.Txn()
+	txn.Put(key("a"), "1")
+	txn.Put(key("b"), "1")
+	assert.NoError(t, txn.Commit())
+	assert.Equal(t, "1", getString(kv, key("a")))
+
+	txn = te.Txn()
+	txn.Put(key("c"), "1")
+	txn.Create(key("a"), "2")
+	assert.Equal(t, kvdb.ErrExist, txn.Commit())
+	assert.Equal(t, "", getString(kv, key("c")), "Failed create wrote")
+
+	kv.fail = "keys/fail"
+	txn = te.Txn()
+	txn.Put(key("a"), "2")
+	txn.Delete(key("b"))
+	txn.Put(key("c"), "2")
+	txn.Put(key("fail"), "2")
+	assert.Equal(t, errKvdbDown, txn.Commit())
+	assert.Equal(t, "1", getString(kv, key("a")), "Put not rolled back")
+	assert.Equal(t, "1", getString(kv, key("b")), "Delete not rolled back")
+	assert.Equal(t, "", getString(kv, key("c")), "New key not rolled back")
+	logs, err := kv.Enumerate(te.txnKeyPrefix)
+	assert.NoError(t, err)
+	assert.Empty(t, logs, "Log of rolled back transaction kept")
+
+	// A volume is not created if its index cannot be updated.
+	kv.fail = labelIndex
+	vol := &api.Volume{
+		ID:      "txn_test_vol",
+		Locator: api.VolumeLocator{Name: "txn_test_vol", VolumeLabels: api.Labels{"l": "v"}},
+		Spec:    &api.VolumeSpec{},
+	}
+	assert.Equal(t, errKvdbDown, te.CreateVol(vol))
+	_, err = kv.Get(te.volKey(vol.ID))
+	assert.Equal(t, kvdb.ErrNotFound, err)
+	ids, _, err := te.lookupName(vol.Locator.Name)
+	assert.NoError(t, err)
+	assert.Empty(t, ids, "Name indexed without the volume")
+	kv.fail = ""
+
+	// A transaction interrupted by a crash is rolled forward on recovery,
+	// except for the keys written since.
+	a, err := kv.Put(key("a"), []byte(`"1"`), 0)
+	assert.NoError(t, err)
+	b, err := kv.Put(key("b"), []byte(`"1"`), 0)
+	assert.NoError(t, err)
+	_, err = kv.Put(key("b"), []byte(`"3"`), 0)
+	assert.NoError(t, err)
+	_, err = kv.Put(te.txnKeyPrefix+string(NodeID())+"/crashed", &txnLog{
+		ID:      "crashed",
+		Started: time.Now(),
+		Undo: []txnUndo{
+			{Key: key("a"), Value: a.Value, Existed: true, Index: a.ModifiedIndex},
+			{Key: key("b"), Value: b.Value, Existed: true, Index: b.ModifiedIndex},
+			{Key: key("d")},
+		},
+		Redo: []txnRedo{
+			{Key: key("a"), Value: []byte(`"2"`)},
+			{Key: key("b"), Value: []byte(`"2"`)},
+			{Key: key("d"), Value: []byte(`"2"`)},
+		},
+	}, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, te.RecoverTxns())
+	assert.Equal(t, "2", getString(kv, key("a")), "Interrupted write not rolled forward")
+	assert.Equal(t, "3", getString(kv, key("b")), "Later write overwritten")
+	assert.Equal(t, "2", getString(kv, key("d")), "Interrupted create not rolled forward")
+	logs, _ = kv.Enumerate(te.txnKeyPrefix)
+	assert.Empty(t, logs)
+
+	// An aborted transaction is rolled back on recovery.
+	_, err = kv.Put(te.txnKeyPrefix+string(NodeID())+"/aborted", &txnLog{
+		ID:      "aborted",
+		Started: time.Now(),
+		Undo:    []txnUndo{{Key: key("a"), Value: []byte(`"1"`), Existed: true}, {Key: key("d")}},
+		Redo:    []txnRedo{{Key: key("a"), Value: []byte(`"2"`)}, {Key: key("d"), Value: []byte(`"2"`)}},
+		Aborted: true,
+	}, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, te.RecoverTxns())
+	assert.Equal(t, "1", getString(kv, key("a")))
+	assert.Equal(t, "", getString(kv, key("d")))
+	logs, _ = kv.Enumerate(te.txnKeyPrefix)
+	assert.Empty(t, logs)
+}
@@ -0,0 +1,163 @@
+package volume
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/worker"
+)
+
+const (
+	// UsageIntervalParam DriverParams key for the number of seconds between
+	// usage refreshes.
+	UsageIntervalParam = "usage_interval"
+	// DefaultUsageInterval number of seconds between usage refreshes.
+	DefaultUsageInterval = 60
+)
+
+// UsageReporter is implemented by drivers that can report the number of
+// bytes consumed by a volume on the backend.
+type UsageReporter interface {
+	// UsedSize returns the number of bytes used by the volume.
+	// Errors ErrEnoEnt may be returned.
+	UsedSize(volumeID api.VolumeID) (uint64, error)
+}
+
+// DirUsage returns the space allocated to the files under path, so that
+// sparse files only count the blocks they use. Files hard linked more than
+// once under path are counted once.
+func DirUsage(path string) (uint64, error) {
+	type inode struct {
+		dev uint64
+		ino uint64
+	}
+	var size uint64
+	seen := make(map[inode]bool)
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			if info.Mode().IsRegular() {
+				size += uint64(info.Size())
+			}
+			return nil
+		}
+		if st.Nlink > 1 && !info.IsDir() {
+			i := inode{uint64(st.Dev), uint64(st.Ino)}
+			if seen[i] {
+				return nil
+			}
+			seen[i] = true
+		}
+		size += uint64(st.Blocks) * 512
+		return nil
+	})
+	return size, err
+}
+
+// usageCollector periodically refreshes Volume.Usage for all volumes of a
+// driver.
+type usageCollector struct {
+	name     string
+	driver   VolumeDriver
+	reporter UsageReporter
+	store    Store
+	pool     *worker.Pool
+	interval time.Duration
+	stop     chan struct{}
+}
+
+func newUsageCollector(name string,
+	d VolumeDriver,
+	pool *worker.Pool,
+	params DriverParams) (*usageCollector, error) {
+
+	reporter, ok := d.(UsageReporter)
+	if !ok {
+		return nil, nil
+	}
+	store, ok := d.(Store)
+	if !ok {
+		return nil, nil
+	}
+	interval, err := intParam(params, UsageIntervalParam, DefaultUsageInterval)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, nil
+	}
+	return &usageCollector{
+		name:     name,
+		driver:   d,
+		reporter: reporter,
+		store:    store,
+		pool:     pool,
+		interval: time.Duration(interval) * time.Second,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+func (u *usageCollector) start() {
+	go func() {
+		t := time.NewTicker(u.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := u.pool.Submit(u.refresh); err != nil {
+					log.Warnf("%s: skipping usage refresh: %v", u.name, err)
+				}
+			case <-u.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (u *usageCollector) shutdown() {
+	close(u.stop)
+}
+
+func (u *usageCollector) refresh() {
+	vols, err := u.driver.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		log.Warnf("%s: failed to enumerate volumes for usage: %v", u.name, err)
+		return
+	}
+	for _, v := range vols {
+		used, err := u.reporter.UsedSize(v.ID)
+		if err != nil {
+			log.Warnf("%s: failed to get usage for %v: %v", u.name, v.ID, err)
+			continue
+		}
+		if used == v.Usage {
+			continue
+		}
+		if err = u.update(v.ID, used); err != nil {
+			log.Warnf("%s: failed to update usage for %v: %v", u.name, v.ID, err)
+		}
+	}
+}
+
+func (u *usageCollector) update(volumeID api.VolumeID, used uint64) error {
+	token, err := u.store.Lock(volumeID)
+	if err != nil {
+		return err
+	}
+	defer u.store.Unlock(token)
+
+	v, err := u.store.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	v.Usage = used
+	return u.store.UpdateVol(v)
+}
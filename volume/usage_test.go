@@ -0,0 +1,37 @@
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usage_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	empty, err := DirUsage(dir)
+	assert.NoError(t, err)
+
+	// A sparse file only counts the blocks written.
+	f, err := os.Create(filepath.Join(dir, "sparse"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Truncate(1<<30))
+	_, err = f.WriteAt(make([]byte, 4096), 0)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	used, err := DirUsage(dir)
+	assert.NoError(t, err)
+	assert.True(t, used > empty, "Written blocks not counted")
+	assert.True(t, used < 1<<20, "Holes counted: %d", used)
+
+	// Hard links are counted once.
+	assert.NoError(t, os.Link(filepath.Join(dir, "sparse"), filepath.Join(dir, "link")))
+	linked, err := DirUsage(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, used, linked)
+}
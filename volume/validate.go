@@ -0,0 +1,218 @@
+package volume
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// cacheBlockUnit is the granularity of the block size of volume caches.
+const cacheBlockUnit = 32 << 10
+
+// ValidationError lists the problems found with the fields of a VolumeSpec.
+type ValidationError []api.FieldError
+
+func (e ValidationError) Error() string {
+	problems := make([]string, len(e))
+	for i, f := range e {
+		problems[i] = f.Field + ": " + f.Reason
+	}
+	return "Invalid volume spec: " + strings.Join(problems, "; ")
+}
+
+// Constraints declares the specs a driver supports, see RegisterConstraints.
+// Zero fields are not checked.
+type Constraints struct {
+	// MinSize smallest volume size in bytes. Clones of snapshots may have
+	// no size.
+	MinSize uint64
+	// MaxSize largest volume size in bytes.
+	MaxSize uint64
+	// Formats filesystems the driver can create, in addition to the default
+	// of the driver which an empty Format selects.
+	Formats []api.Filesystem
+	// MaxHALevel highest HALevel the driver supports. Drivers that declare
+	// constraints without it do not replicate volumes.
+	MaxHALevel int
+	// MaxCos highest class of service the driver distinguishes.
+	MaxCos api.VolumeCos
+	// Compressions algorithms the driver compresses volumes with, the
+	// first is its default. Drivers that declare constraints without them
+	// do not compress volumes.
+	Compressions []api.Compression
+}
+
+var (
+	constraintsLock sync.Mutex
+	constraints     = make(map[string]Constraints)
+	clusterSize     func() int
+)
+
+// RegisterConstraints declares the specs driver supports. Drivers register
+// their constraints along with their InitFunc, specs are validated against
+// them before volumes are created.
+func RegisterConstraints(driver string, c Constraints) {
+	constraintsLock.Lock()
+	defer constraintsLock.Unlock()
+	constraints[driver] = c
+}
+
+// SetClusterSize sets the function returning the number of nodes available
+// to host the replicas of a volume. HALevel is not checked against the size
+// of the cluster if it is not set.
+func SetClusterSize(size func() int) {
+	constraintsLock.Lock()
+	defer constraintsLock.Unlock()
+	clusterSize = size
+}
+
+// Validate checks spec before a volume is created with options on the named
+// driver instance. Every spec is checked for sanity, then against the
+// constraints the driver registered.
+// Errors ValidationError may be returned.
+func Validate(name string, options *api.CreateOptions, spec *api.VolumeSpec) error {
+	if spec == nil {
+		return ValidationError{{Field: "Spec", Reason: "missing"}}
+	}
+	var errs ValidationError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, api.FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	if spec.Cos < api.VolumeCosNone || spec.Cos > api.VolumeCosMax {
+		add("Cos", "%d is out of range %d-%d", spec.Cos, api.VolumeCosNone, api.VolumeCosMax)
+	}
+	if spec.HALevel < 0 {
+		add("HALevel", "%d is negative", spec.HALevel)
+	}
+	if spec.BlockSize < 0 || spec.BlockSize&(spec.BlockSize-1) != 0 {
+		add("BlockSize", "%d is not a power of 2", spec.BlockSize)
+	}
+	if spec.SnapshotInterval < 0 {
+		add("SnapshotInterval", "%d is negative", spec.SnapshotInterval)
+	}
+	if r := spec.Retention; r != nil {
+		rules := 0
+		for _, rule := range []struct {
+			field string
+			n     int
+		}{
+			{"KeepLast", r.KeepLast},
+			{"Hourly", r.Hourly},
+			{"Daily", r.Daily},
+			{"Weekly", r.Weekly},
+			{"Monthly", r.Monthly},
+		} {
+			if rule.n < 0 {
+				add("Retention."+rule.field, "%d is negative", rule.n)
+			} else if rule.n > 0 {
+				rules++
+			}
+		}
+		if rules == 0 {
+			// A policy without rules would expire every snapshot.
+			add("Retention", "sets no rule")
+		}
+	}
+	if spec.Compression != "" && !spec.Compressed {
+		add("Compression", "%q is set on a volume that is not compressed", spec.Compression)
+	}
+	if spec.Cache != nil {
+		if spec.Cache.Device == "" {
+			add("Cache.Device", "missing")
+		}
+		if spec.Cache.BlockSize%cacheBlockUnit != 0 {
+			add("Cache.BlockSize", "%d is not a multiple of %d", spec.Cache.BlockSize, cacheBlockUnit)
+		}
+		switch spec.Cache.Mode {
+		case "", api.CacheWritethrough, api.CacheWriteback:
+		default:
+			add("Cache.Mode", "%q is not writethrough or writeback", spec.Cache.Mode)
+		}
+	}
+
+	if r := spec.RootDir; r != nil {
+		if r.UID != nil && *r.UID < 0 {
+			add("RootDir.UID", "%d is not a user ID", *r.UID)
+		}
+		if r.GID != nil && *r.GID < 0 {
+			add("RootDir.GID", "%d is not a group ID", *r.GID)
+		}
+		if r.Mode&^07777 != 0 {
+			add("RootDir.Mode", "%#o is not a permission mode", r.Mode)
+		}
+		if r.UID == nil && r.GID == nil && r.Mode == 0 {
+			add("RootDir", "sets neither an owner nor a mode")
+		}
+	}
+
+	driver := name
+	if d, err := DriverOf(name); err == nil {
+		driver = d
+	}
+	constraintsLock.Lock()
+	size := clusterSize
+	c, ok := constraints[driver]
+	constraintsLock.Unlock()
+
+	if size != nil && spec.HALevel > 0 {
+		// HALevel nodes may fail, so the volume needs one more.
+		if n := size(); spec.HALevel >= n {
+			add("HALevel", "%d needs more than the %d nodes of the cluster", spec.HALevel, n)
+		}
+	}
+	if !ok {
+		return errOrNil(errs)
+	}
+	clone := options != nil && options.CreateFromSnap != ""
+	if c.MinSize != 0 && spec.Size < c.MinSize && !(clone && spec.Size == 0) {
+		add("Size", "%d is below the minimum of %d bytes", spec.Size, c.MinSize)
+	}
+	if c.MaxSize != 0 && spec.Size > c.MaxSize {
+		add("Size", "%d is above the maximum of %d bytes", spec.Size, c.MaxSize)
+	}
+	if spec.Format != "" && len(c.Formats) > 0 && !hasFormat(c.Formats, spec.Format) {
+		add("Format", "%q is not supported by %s", spec.Format, driver)
+	}
+	if spec.HALevel > c.MaxHALevel {
+		add("HALevel", "%d is above the maximum of %d supported by %s", spec.HALevel, c.MaxHALevel, driver)
+	}
+	if c.MaxCos != 0 && spec.Cos > c.MaxCos {
+		add("Cos", "%d is above the maximum of %d supported by %s", spec.Cos, c.MaxCos, driver)
+	}
+	if spec.Compressed && len(c.Compressions) == 0 {
+		add("Compressed", "compression is not supported by %s", driver)
+	} else if spec.Compression != "" && !hasCompression(c.Compressions, spec.Compression) {
+		add("Compression", "%q is not supported by %s", spec.Compression, driver)
+	}
+	return errOrNil(errs)
+}
+
+func hasFormat(formats []api.Filesystem, f api.Filesystem) bool {
+	for _, v := range formats {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+func hasCompression(compressions []api.Compression, c api.Compression) bool {
+	for _, v := range compressions {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+// errOrNil returns nil for an empty ValidationError, so that callers can
+// compare the result to nil.
+func errOrNil(errs ValidationError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
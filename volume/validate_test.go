@@ -0,0 +1,62 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate("validate_test", nil, &api.VolumeSpec{Size: 1 << 30}))
+
+	gid := -2
+	err := Validate("validate_test", nil, &api.VolumeSpec{
+		Cos:       api.VolumeCosMax + 1,
+		BlockSize: 3000,
+		Cache:     &api.CacheSpec{Device: "/dev/sdz", BlockSize: 1000},
+		RootDir:   &api.RootDirSpec{GID: &gid, Mode: 010000},
+	})
+	if assert.Error(t, err) {
+		var fields []string
+		for _, f := range err.(ValidationError) {
+			fields = append(fields, f.Field)
+		}
+		assert.Equal(t, []string{"Cos", "BlockSize", "Cache.BlockSize", "RootDir.GID", "RootDir.Mode"}, fields)
+	}
+	assert.Error(t, Validate("validate_test", nil, &api.VolumeSpec{Size: 1 << 30, RootDir: &api.RootDirSpec{}}),
+		"Empty root directory spec accepted")
+	assert.Error(t, Validate("validate_test", nil, &api.VolumeSpec{Size: 1 << 30, Retention: &api.RetentionPolicy{}}),
+		"Retention policy without rules accepted")
+
+	RegisterConstraints("validate_test", Constraints{
+		MinSize: 1 << 20,
+		MaxSize: 1 << 40,
+		Formats: []api.Filesystem{api.FsExt4},
+	})
+	defer RegisterConstraints("validate_test", Constraints{})
+	assert.NoError(t, Validate("validate_test", nil, &api.VolumeSpec{Size: 1 << 30, Format: api.FsExt4}))
+	assert.NoError(t, Validate("validate_test", &api.CreateOptions{CreateFromSnap: "snap"}, &api.VolumeSpec{}),
+		"Clones take the size of the snapshot")
+
+	err = Validate("validate_test", nil, &api.VolumeSpec{Size: 1 << 41, Format: api.FsXfs, HALevel: 1})
+	if assert.Error(t, err) {
+		assert.Len(t, err.(ValidationError), 3)
+	}
+	assert.Error(t, Validate("validate_test", nil, &api.VolumeSpec{}), "Volume without size")
+	assert.Error(t, Validate("validate_test", nil, &api.VolumeSpec{Size: 1 << 30, Compressed: true}),
+		"Compression without support")
+
+	RegisterConstraints("validate_test", Constraints{Compressions: []api.Compression{api.CompressionLz4}})
+	assert.NoError(t, Validate("validate_test", nil, &api.VolumeSpec{Compressed: true}))
+	assert.Error(t, Validate("validate_test", nil, &api.VolumeSpec{Compressed: true, Compression: api.CompressionZstd}))
+	assert.Error(t, Validate("validate_test", nil, &api.VolumeSpec{Compression: api.CompressionLz4}),
+		"Algorithm of an uncompressed volume")
+
+	SetClusterSize(func() int { return 2 })
+	defer SetClusterSize(nil)
+	RegisterConstraints("validate_test", Constraints{MaxHALevel: 3})
+	assert.NoError(t, Validate("validate_test", nil, &api.VolumeSpec{HALevel: 1}))
+	assert.Error(t, Validate("validate_test", nil, &api.VolumeSpec{HALevel: 2}), "More replicas than nodes")
+}
@@ -0,0 +1,28 @@
+package volume
+
+import (
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// Versioner is implemented by drivers that can only be served with some
+// versions of the REST API, for instance because older versions lack the
+// options their volumes need. Drivers that do not implement it are served
+// with every version the server supports.
+type Versioner interface {
+	// APIVersions returns the oldest and newest API versions the driver
+	// supports.
+	APIVersions() api.VersionRange
+}
+
+// APIVersions returns the API versions d can be served with, those supported
+// by both the server and d. The range is empty, its Min after its Max, if
+// they have no version in common.
+func APIVersions(d VolumeDriver) api.VersionRange {
+	server := api.VersionRange{Min: api.MinVersion, Max: api.Version}
+	v, ok := d.(Versioner)
+	if !ok {
+		return server
+	}
+	r, _ := server.Intersect(v.APIVersions())
+	return r
+}
@@ -0,0 +1,33 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type versionDriver struct {
+	capabilityDriver
+	versions api.VersionRange
+}
+
+func (d *versionDriver) APIVersions() api.VersionRange {
+	return d.versions
+}
+
+func TestAPIVersions(t *testing.T) {
+	server := api.VersionRange{Min: api.MinVersion, Max: api.Version}
+	assert.Equal(t, server, APIVersions(&capabilityDriver{}))
+
+	r := APIVersions(&versionDriver{versions: api.VersionRange{Min: "v2", Max: "v9"}})
+	assert.Equal(t, api.VersionRange{Min: "v2", Max: api.Version}, r)
+	assert.True(t, r.Contains("v2"))
+	assert.False(t, r.Contains("v1"), "Versions older than the driver supports")
+	assert.False(t, r.Contains("v9"), "Versions newer than the server supports")
+	assert.False(t, r.Contains("latest"), "Malformed versions")
+
+	_, ok := server.Intersect(api.VersionRange{Min: "v7", Max: "v9"})
+	assert.False(t, ok, "Disjoint ranges should have no version in common")
+}
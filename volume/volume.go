@@ -2,13 +2,49 @@ package volume
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/portworx/kvdb"
 
 	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/worker"
+)
+
+const (
+	// WorkerConcurrencyParam DriverParams key for the number of background
+	// workers available to a driver.
+	WorkerConcurrencyParam = "worker_concurrency"
+	// WorkerQueueDepthParam DriverParams key for the number of background jobs
+	// that may be queued for a driver before submissions are rejected.
+	WorkerQueueDepthParam = "worker_queue_depth"
+	// InstanceOfParam DriverParams key for the driver an instance runs, so
+	// that a driver can run as several instances, such as nfs-a and nfs-b.
+	// The instance name is the driver if it is not set.
+	InstanceOfParam = "instance_of"
+	// InstanceNameParam DriverParams key New sets to the name of the
+	// instance before initializing the driver.
+	InstanceNameParam = "instance_name"
 )
 
 var (
 	instances         map[string]VolumeDriver
+	instanceDrivers   map[string]string
+	pools             map[string]*worker.Pool
+	collectors        map[string]*usageCollector
+	trashes           map[string]*Trash
+	scrubbers         map[string]*scrubber
+	snapSchedulers    map[string]*snapScheduler
+	histories         map[string]*statsHistory
+	rebalancers       map[string]*Rebalancer
+	gcs               map[string]*GC
+	reapers           map[string]*ephemeralReaper
+	warmPools         map[string]*warmPool
 	drivers           map[string]InitFunc
 	mutex             sync.Mutex
 	ErrExist          = errors.New("Driver already exists")
@@ -20,18 +56,33 @@ var (
 	ErrVolAttached    = errors.New("Volume is attached")
 	ErrVolHasSnaps    = errors.New("Volume has snapshots associated")
 	ErrNotSupported   = errors.New("Operation not supported")
+	ErrSnapReadOnly   = errors.New("Snapshot is read-only")
+	ErrVolMaintenance = errors.New("Volume is in maintenance")
+	ErrDriverInUse    = errors.New("Driver is in use")
+	ErrNoSpace        = errors.New("Not enough free space")
+	ErrEexist         = errors.New("Volume with this name already exists")
+	ErrWrongDevice    = errors.New("Device does not hold the filesystem of the volume")
+	ErrNotMounted     = errors.New("Path is not a mount of the volume")
 )
 
 type DriverParams map[string]string
 
-type InitFunc func(params DriverParams) (VolumeDriver, error)
+// InitFunc initializes an instance of a driver with the context c.
+type InitFunc func(c *DriverContext) (VolumeDriver, error)
 
+// DriverType is a set of capabilities of a driver. New verifies that drivers
+// implement the interfaces their type claims.
 type DriverType int
 
 const (
-	File = 1 << iota
+	// File drivers provide volumes that are mounted.
+	File DriverType = 1 << iota
+	// Block drivers provide volumes that are attached as block devices and
+	// implement BlockDriver.
 	Block
+	// Object drivers provide buckets and implement ObjectDriver.
 	Object
+	// Clustered drivers span multiple nodes.
 	Clustered
 )
 
@@ -74,9 +125,9 @@ type ProtoDriver interface {
 	Unmount(volumeID api.VolumeID, mountpath string) error
 
 	// Snap specified volume. IO to the underlying volume should be quiesced before
-	// calling this function.
+	// calling this function. Writable snaps may be mounted like volumes.
 	// Errors ErrEnoEnt may be returned
-	Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error)
+	Snapshot(volumeID api.VolumeID, labels api.Labels, writable bool) (api.SnapID, error)
 
 	// SnapDelete snap specified by snapID.
 	// Errors ErrEnoEnt may be returned
@@ -90,9 +141,14 @@ type ProtoDriver interface {
 	// Errors ErrEnoEnt may be returned
 	Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error)
 
-	// Status returns a set of key-value pairs which give low
-	// level diagnostic status about this driver.
-	Status() [][2]string
+	// Status returns the diagnostic status of this driver, such as its
+	// capacity and the backends it uses.
+	Status() api.DriverStatus
+
+	// HealthCheck verifies that the driver can serve requests, for instance
+	// that its backing storage is reachable and writable. It returns the
+	// checks that failed, none if the driver is healthy.
+	HealthCheck() []api.HealthReason
 
 	// Shutdown and cleanup.
 	Shutdown()
@@ -116,13 +172,107 @@ type Enumerator interface {
 	SnapEnumerate(volID []api.VolumeID, snapLabels api.Labels) ([]api.VolumeSnap, error)
 }
 
+// ConsistentEnumerator is implemented by enumerators that can serve reads at
+// a caller specified consistency level.
+type ConsistentEnumerator interface {
+	// InspectAt is Inspect at the specified read consistency.
+	InspectAt(volumeIDs []api.VolumeID, c api.Consistency) ([]api.Volume, error)
+
+	// EnumerateAt is Enumerate at the specified read consistency.
+	EnumerateAt(locator api.VolumeLocator,
+		labels api.Labels,
+		c api.Consistency) ([]api.Volume, error)
+}
+
+// Grapher is implemented by drivers that compute volume dependency graphs
+// natively. Use Graph to build a graph for any Enumerator.
+type Grapher interface {
+	// Graph returns the snapshots, clones and replicas that depend on a volume.
+	// Errors ErrEnoEnt may be returned.
+	Graph(volumeID api.VolumeID) (*api.VolumeGraph, error)
+}
+
+// ObjectDriver is implemented by Object drivers. Each volume of an Object
+// driver is a bucket, objects within a bucket are addressed by key.
+type ObjectDriver interface {
+	// CreateBucket creates an empty bucket.
+	CreateBucket(bucket string) error
+
+	// DeleteBucket deletes an empty bucket.
+	// Errors ErrEnoEnt may be returned.
+	DeleteBucket(bucket string) error
+
+	// PutObject stores size bytes read from r as key in bucket.
+	// Errors ErrEnoEnt may be returned.
+	PutObject(bucket, key string, r io.Reader, size int64) error
+
+	// GetObject returns the contents of key in bucket.
+	// Errors ErrEnoEnt may be returned.
+	GetObject(bucket, key string) (io.ReadCloser, error)
+
+	// DeleteObject deletes key from bucket.
+	// Errors ErrEnoEnt may be returned.
+	DeleteObject(bucket, key string) error
+
+	// PresignedURL returns a URL that allows anyone holding it to perform
+	// method, GET or PUT, on key in bucket until expiry elapses.
+	PresignedURL(method, bucket, key string, expiry time.Duration) (string, error)
+}
+
+// Cataloger is implemented by File drivers that can list the contents of a
+// volume without it being mounted.
+type Cataloger interface {
+	// Catalog lists the directory at path within a volume, or the file at
+	// path if it is not a directory. Paths are relative to the volume root.
+	// Errors ErrEnoEnt, ErrEinval may be returned.
+	Catalog(volumeID api.VolumeID, path string) ([]api.CatalogEntry, error)
+}
+
+// Exporter is implemented by drivers that export volumes to remote hosts
+// natively. Use the export package to export block volumes of any driver.
+type Exporter interface {
+	// Export publishes a volume over protocol.
+	// Errors ErrEnoEnt, ErrNotSupported may be returned.
+	Export(volumeID api.VolumeID, protocol api.ExportProtocol) (*api.VolumeExport, error)
+
+	// Unexport removes the protocol export of a volume.
+	// Errors ErrEnoEnt may be returned.
+	Unexport(volumeID api.VolumeID, protocol api.ExportProtocol) error
+}
+
+// Replicator is implemented by drivers that keep copies of a volume on the
+// nodes of its ReplicaSet. The replication package decides placement and
+// tracks replica health, the driver moves the data.
+type Replicator interface {
+	// AddReplica creates a copy of a volume on node and synchronizes it
+	// with the existing copies within the bandwidth of BandwidthRebuild,
+	// see replication.CopyReplica. It returns once the copy is in sync.
+	// Errors ErrEnoEnt may be returned.
+	AddReplica(volumeID api.VolumeID, node api.MachineID) error
+
+	// RemoveReplica drops the copy of a volume on node.
+	// Errors ErrEnoEnt may be returned.
+	RemoveReplica(volumeID api.VolumeID, node api.MachineID) error
+}
+
+// Resizer is implemented by drivers that can grow volumes. Use Resize so
+// that the filesystem of a mounted block volume grows with it.
+type Resizer interface {
+	// Resize grows a volume to size bytes and updates its Spec.Size.
+	// Errors ErrEnoEnt, ErrEinval may be returned if size is smaller than
+	// the volume.
+	Resize(volumeID api.VolumeID, size uint64) error
+}
+
 // BlockDriver needs to be implemented by block volume drivers.  Filesystem volume
-// drivers can ignore this interface and include the builtin DefaultBlockDriver.
+// drivers can ignore this interface and include the builtin NotSupportedBlockDriver.
 type BlockDriver interface {
 	// Attach map device to the host.
 	// On success the devicePath specifies location where the device is exported
+	// Options may be nil, in which case the device is attached read-write
+	// and exclusive to this node.
 	// Errors ErrEnoEnt, ErrVolAttached may be returned.
-	Attach(volumeID api.VolumeID) (string, error)
+	Attach(volumeID api.VolumeID, options *api.AttachOptions) (string, error)
 
 	// Format volume according to spec provided in Create
 	// Errors ErrEnoEnt, ErrVolDetached may be returned.
@@ -136,32 +286,316 @@ type BlockDriver interface {
 func Shutdown() {
 	mutex.Lock()
 	defer mutex.Unlock()
+	for _, c := range collectors {
+		c.shutdown()
+	}
+	for _, r := range rebalancers {
+		r.shutdown()
+	}
+	for _, g := range gcs {
+		g.shutdown()
+	}
+	for _, r := range reapers {
+		r.shutdown()
+	}
+	for _, w := range warmPools {
+		w.shutdown()
+	}
 	for _, v := range instances {
 		v.Shutdown()
+		stopCache(v)
 	}
+	for _, t := range trashes {
+		t.shutdown()
+	}
+	for _, s := range scrubbers {
+		s.shutdown()
+	}
+	for _, s := range snapSchedulers {
+		s.shutdown()
+	}
+	for _, h := range histories {
+		h.shutdown()
+	}
+	for _, p := range pools {
+		p.Shutdown()
+	}
+}
+
+// Workers returns the background worker pool for the named driver. Drivers
+// should run usage refresh, snapshot and GC jobs on this pool and treat
+// worker.ErrFull as a signal to back off.
+func Workers(name string) (*worker.Pool, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if p, ok := pools[name]; ok {
+		return p, nil
+	}
+	return nil, ErrDriverNotFound
+}
+
+func intParam(params DriverParams, key string, def int) (int, error) {
+	v, ok := params[key]
+	if !ok {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid value %q for %s: %v", v, key, err)
+	}
+	return i, nil
 }
 
+func newPool(name string, params DriverParams) (*worker.Pool, error) {
+	concurrency, err := intParam(params, WorkerConcurrencyParam, worker.DefaultConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	depth, err := intParam(params, WorkerQueueDepthParam, worker.DefaultQueueDepth)
+	if err != nil {
+		return nil, err
+	}
+	return worker.New(name, concurrency, depth)
+}
+
+// Get returns the running driver instance name.
 func Get(name string) (VolumeDriver, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
 	if v, ok := instances[name]; ok {
 		return v, nil
 	}
 	return nil, ErrDriverNotFound
 }
 
+// InstanceName returns the name of the instance a driver is initialized
+// with, driver if params do not come from New.
+func InstanceName(params DriverParams, driver string) string {
+	if name := params[InstanceNameParam]; name != "" {
+		return name
+	}
+	return driver
+}
+
+// DriverOf returns the driver instance name runs.
+// Errors ErrDriverNotFound may be returned.
+func DriverOf(name string) (string, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if d, ok := instanceDrivers[name]; ok {
+		return d, nil
+	}
+	return "", ErrDriverNotFound
+}
+
+// Instances returns the names of the drivers that have been started.
+func Instances() []string {
+	mutex.Lock()
+	defer mutex.Unlock()
+	names := make([]string, 0, len(instances))
+	for name := range instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New starts an instance of a driver named name. The instance runs the driver
+// of the InstanceOfParam of params, driver name if it is not set. The
+// metadata transactions and the operations the instance left in the journal
+// are recovered, and the volumes attached or mounted on this node are
+// reattached, before it is returned.
 func New(name string, params DriverParams) (VolumeDriver, error) {
+	return NewWithKvdb(name, params, nil)
+}
+
+// NewWithKvdb is New with the metadata of the instance stored in kv rather
+// than the KVDB set by SetKvdb, so that instances may use different KVDBs.
+func NewWithKvdb(name string, params DriverParams, kv kvdb.Kvdb) (VolumeDriver, error) {
+	d, err := newInstance(name, params, kv)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := d.(TxnRecoverer); ok {
+		if err := r.RecoverTxns(); err != nil {
+			log.Warnf("%s: failed to recover transactions: %v", name, err)
+		}
+	}
+	mutex.Lock()
+	j := journal
+	mutex.Unlock()
+	if j != nil {
+		j.recover(name, d)
+	}
+	reattach(name, d)
+	return d, nil
+}
+
+func newInstance(name string, params DriverParams, kv kvdb.Kvdb) (VolumeDriver, error) {
 	mutex.Lock()
 	defer mutex.Unlock()
 
 	if _, ok := instances[name]; ok {
 		return nil, ErrExist
 	}
-	if initFunc, exists := drivers[name]; exists {
-		driver, err := initFunc(params)
+	driverName := name
+	if d := params[InstanceOfParam]; d != "" {
+		driverName = d
+	}
+	if initFunc, exists := drivers[driverName]; exists {
+		pool, err := newPool(name, params)
+		if err != nil {
+			return nil, err
+		}
+		lims, err := newLimiters(params)
+		if err != nil {
+			pool.Shutdown()
+			return nil, err
+		}
+		unique, err := uniqueNames(params)
+		if err != nil {
+			pool.Shutdown()
+			return nil, err
+		}
+		reserve, err := freeReserve(params)
+		if err != nil {
+			pool.Shutdown()
+			return nil, err
+		}
+		stack, err := newLayers(params)
+		if err != nil {
+			pool.Shutdown()
+			return nil, err
+		}
+		initParams := DriverParams{InstanceNameParam: name}
+		for k, v := range params {
+			if k != InstanceNameParam {
+				initParams[k] = v
+			}
+		}
+		driver, err := initFunc(newDriverContext(name, initParams, kv))
 		if err != nil {
+			pool.Shutdown()
 			return nil, err
 		}
+		if err = CheckCapabilities(name, driver); err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		if err = checkLayers(driver, stack); err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		if err = setCacheTTL(driver, params); err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		collector, err := newUsageCollector(name, driver, pool, params)
+		if err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		trash, err := newTrash(name, driver, pool, params)
+		if err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		scrub, err := newScrubber(name, driver, pool, params)
+		if err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		snapSched, err := newSnapScheduler(name, driver, pool, params)
+		if err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		history, err := newStatsHistory(name, driver, pool, params)
+		if err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		rebalancer, err := newRebalancer(name, driver, params)
+		if err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		gc, err := newGC(name, driver, pool, params)
+		if err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		reaper, err := newEphemeralReaper(name, driver, pool, params)
+		if err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		warm, err := newWarmPool(name, driver, pool, params)
+		if err != nil {
+			driver.Shutdown()
+			pool.Shutdown()
+			return nil, err
+		}
+		if collector != nil {
+			collector.start()
+			collectors[name] = collector
+		}
+		if trash != nil {
+			trash.start()
+			trashes[name] = trash
+		}
+		if scrub != nil {
+			scrub.start()
+			scrubbers[name] = scrub
+		}
+		if snapSched != nil {
+			snapSched.start()
+			snapSchedulers[name] = snapSched
+		}
+		if history != nil {
+			history.start()
+			histories[name] = history
+		}
+		if rebalancer != nil {
+			rebalancer.start()
+			rebalancers[name] = rebalancer
+		}
+		if gc != nil {
+			gc.start()
+			gcs[name] = gc
+		}
+		if reaper != nil {
+			reaper.start()
+			reapers[name] = reaper
+		}
+		if warm != nil {
+			warm.start()
+			warmPools[name] = warm
+		}
 		instances[name] = driver
-		return driver, err
+		instanceDrivers[name] = driverName
+		pools[name] = pool
+		setLimiters(name, lims)
+		setUniqueNames(name, unique)
+		setFreeReserve(name, reserve)
+		setLayers(name, stack)
+		if configStore != nil {
+			if err := configStore.Save(name, storedParams(name, params)); err != nil {
+				log.Warnf("Failed to save the params of driver %s: %v", name, err)
+			}
+		}
+		return driver, nil
 	}
 	return nil, ErrNotSupported
 }
@@ -176,7 +610,63 @@ func Register(name string, initFunc InitFunc) error {
 	return nil
 }
 
+// Deregister removes the driver registered as name, so that it can no longer
+// be started. The running instances of the driver must be removed first.
+// Errors ErrDriverNotFound, ErrDriverInUse may be returned.
+func Deregister(name string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, exists := drivers[name]; !exists {
+		return ErrDriverNotFound
+	}
+	for _, d := range instanceDrivers {
+		if d == name {
+			return ErrDriverInUse
+		}
+	}
+	delete(drivers, name)
+	return nil
+}
+
+// Remove shuts down the running driver name and forgets its params, as
+// Disable does. Drivers with attached or mounted volumes are refused unless
+// force is set, their volumes are then left as they are.
+// Errors ErrDriverNotFound, ErrDriverInUse may be returned.
+func Remove(name string, force bool) error {
+	mutex.Lock()
+	d, ok := instances[name]
+	mutex.Unlock()
+	if !ok {
+		return ErrDriverNotFound
+	}
+	if !force {
+		vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+		if err != nil {
+			return err
+		}
+		for _, v := range vols {
+			if v.State == api.VolumeAttached || v.AttachPath != "" {
+				log.Warnf("Refusing to remove driver %s, volume %v is in use", name, v.ID)
+				return ErrDriverInUse
+			}
+		}
+	}
+	log.Infof("Removing volume driver %s", name)
+	return Disable(name)
+}
+
 func init() {
 	drivers = make(map[string]InitFunc)
 	instances = make(map[string]VolumeDriver)
+	instanceDrivers = make(map[string]string)
+	pools = make(map[string]*worker.Pool)
+	collectors = make(map[string]*usageCollector)
+	trashes = make(map[string]*Trash)
+	scrubbers = make(map[string]*scrubber)
+	snapSchedulers = make(map[string]*snapScheduler)
+	histories = make(map[string]*statsHistory)
+	rebalancers = make(map[string]*Rebalancer)
+	gcs = make(map[string]*GC)
+	reapers = make(map[string]*ephemeralReaper)
+	warmPools = make(map[string]*warmPool)
 }
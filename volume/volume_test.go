@@ -0,0 +1,104 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+type removeDriver struct {
+	capabilityDriver
+}
+
+func (d *removeDriver) Shutdown() {}
+
+func TestRemove(t *testing.T) {
+	enumerator := NewDefaultEnumerator("remove_test", kvdb.Instance())
+	err := Register("remove_test", func(c *DriverContext) (VolumeDriver, error) {
+		return &removeDriver{capabilityDriver{Enumerator: enumerator, t: File}}, nil
+	})
+	assert.NoError(t, err, "Failed to register driver")
+	_, err = New("remove_test", nil)
+	assert.NoError(t, err, "Failed to start driver")
+
+	vol := &api.Volume{ID: "remove_test_vol", State: api.VolumeAttached, Spec: &api.VolumeSpec{}}
+	assert.NoError(t, enumerator.CreateVol(vol))
+	defer enumerator.DeleteVol(vol.ID)
+
+	assert.Equal(t, ErrDriverInUse, Deregister("remove_test"), "Running driver deregistered")
+	assert.Equal(t, ErrDriverInUse, Remove("remove_test", false), "Driver with attached volumes removed")
+	assert.NoError(t, Remove("remove_test", true), "Failed to force the removal")
+	_, err = Get("remove_test")
+	assert.Equal(t, ErrDriverNotFound, err)
+
+	assert.NoError(t, Deregister("remove_test"))
+	_, err = New("remove_test", nil)
+	assert.Equal(t, ErrNotSupported, err, "Deregistered driver started")
+}
+
+func TestNamedInstances(t *testing.T) {
+	var names []string
+	err := Register("instance_test", func(c *DriverContext) (VolumeDriver, error) {
+		assert.Equal(t, c.Name, InstanceName(c.Params, "instance_test"))
+		names = append(names, c.Name)
+		enumerator := c.NewEnumerator()
+		return &removeDriver{capabilityDriver{Enumerator: enumerator, t: File}}, nil
+	})
+	assert.NoError(t, err, "Failed to register driver")
+	for _, name := range []string{"instance_a", "instance_b"} {
+		_, err = New(name, DriverParams{InstanceOfParam: "instance_test"})
+		assert.NoError(t, err, "Failed to start instance %s", name)
+		d, err := DriverOf(name)
+		assert.NoError(t, err)
+		assert.Equal(t, "instance_test", d)
+	}
+	assert.Equal(t, []string{"instance_a", "instance_b"}, names)
+	_, err = New("instance_a", DriverParams{InstanceOfParam: "instance_test"})
+	assert.Equal(t, ErrExist, err, "Instance started twice")
+
+	assert.Equal(t, ErrDriverInUse, Deregister("instance_test"), "Driver with instances deregistered")
+	assert.NoError(t, Remove("instance_a", false))
+	assert.NoError(t, Remove("instance_b", false))
+	assert.NoError(t, Deregister("instance_test"))
+}
+
+func TestNewWithKvdb(t *testing.T) {
+	kv := &failingKvdb{Kvdb: kvdb.Instance()}
+	var got kvdb.Kvdb
+	err := Register("kvdb_test", func(c *DriverContext) (VolumeDriver, error) {
+		got = c.Kvdb
+		return &removeDriver{capabilityDriver{Enumerator: c.NewEnumerator(), t: File}}, nil
+	})
+	assert.NoError(t, err, "Failed to register driver")
+	defer Deregister("kvdb_test")
+
+	_, err = NewWithKvdb("kvdb_test", nil, kv)
+	assert.NoError(t, err, "Failed to start driver")
+	assert.Equal(t, kvdb.Kvdb(kv), got, "Driver not given the KVDB")
+	assert.NoError(t, Remove("kvdb_test", false))
+
+	_, err = New("kvdb_test", nil)
+	assert.NoError(t, err, "Failed to start driver")
+	assert.Equal(t, kvdb.Instance(), got, "Driver not given the default KVDB")
+	assert.NoError(t, Remove("kvdb_test", false))
+}
+
+func TestMountRoot(t *testing.T) {
+	root, err := MountRoot(nil, "nfs")
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/lib/openstorage/nfs", root)
+
+	root, err = MountRoot(DriverParams{MountRootParam: "/mnt/osd/"}, "nfs")
+	assert.NoError(t, err)
+	assert.Equal(t, "/mnt/osd/nfs", root)
+
+	root, err = MountRoot(DriverParams{InstanceNameParam: "nfs2"}, "nfs")
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/lib/openstorage/nfs2", root, "Instances share their mount root")
+
+	_, err = MountRoot(DriverParams{MountRootParam: "mnt"}, "nfs")
+	assert.Error(t, err, "Relative mount root accepted")
+}
@@ -0,0 +1,290 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/worker"
+	"github.com/libopenstorage/openstorage/profile"
+)
+
+const (
+	// WarmPoolParam DriverParams key for the profiles whose volumes are
+	// created ahead of requests and how many of each are kept ready, such
+	// as "db-fast=3,web=5". No volume is created ahead if empty.
+	WarmPoolParam = "warm_pool"
+	// warmPoolInterval time between checks of the size of the warm pool.
+	warmPoolInterval = time.Minute
+)
+
+// warmPool keeps volumes of a driver created, and formatted for block
+// drivers, from profiles ahead of requests. Creates from a profile whose
+// spec matches that of a warm volume claim it instead of creating a volume,
+// which saves the time a container waits for its volume. Warm volumes carry
+// api.WarmPoolLabel until they are claimed.
+type warmPool struct {
+	name   string
+	driver VolumeDriver
+	pool   *worker.Pool
+	// sizes number of volumes kept ready by profile.
+	sizes map[string]int
+	fill  chan struct{}
+	stop  func()
+}
+
+func newWarmPool(name string,
+	d VolumeDriver,
+	pool *worker.Pool,
+	params DriverParams) (*warmPool, error) {
+
+	sizes, err := parseWarmPool(params[WarmPoolParam])
+	if err != nil || len(sizes) == 0 {
+		return nil, err
+	}
+	if _, ok := d.(Store); !ok {
+		log.Warnf("%s: cannot keep a warm pool: %v", name, ErrNotSupported)
+		return nil, nil
+	}
+	return &warmPool{
+		name:   name,
+		driver: d,
+		pool:   pool,
+		sizes:  sizes,
+		fill:   make(chan struct{}, 1),
+	}, nil
+}
+
+// parseWarmPool parses the value of WarmPoolParam.
+func parseWarmPool(v string) (map[string]int, error) {
+	sizes := make(map[string]int)
+	for _, kv := range strings.Split(v, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("Invalid value %q for %s", v, WarmPoolParam)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(pair[1]))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid size %q of profile %s in %s", pair[1], pair[0], WarmPoolParam)
+		}
+		sizes[strings.TrimSpace(pair[0])] = n
+	}
+	return sizes, nil
+}
+
+// start refills the warm pool after claims and periodically. Drivers may
+// share their volumes across nodes, only one node refills the pool of a
+// driver, claims are made on any node.
+func (p *warmPool) start() {
+	p.stop = singleton("warm_pool/"+p.name, func(stop <-chan struct{}) {
+		tick := time.NewTicker(warmPoolInterval)
+		defer tick.Stop()
+		p.submit()
+		for {
+			select {
+			case <-tick.C:
+				p.submit()
+			case <-p.fill:
+				p.submit()
+			case <-stop:
+				return
+			}
+		}
+	})
+}
+
+func (p *warmPool) shutdown() {
+	if p.stop != nil {
+		p.stop()
+	}
+}
+
+func (p *warmPool) submit() {
+	if err := p.pool.Submit(p.refill); err != nil {
+		log.Warnf("%s: skipping refill of the warm pool: %v", p.name, err)
+	}
+}
+
+// refill creates the volumes missing from the warm pool and deletes the
+// warm volumes that no longer match their profile, or in excess.
+func (p *warmPool) refill() {
+	vols, err := p.driver.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		log.Warnf("%s: failed to list the warm pool: %v", p.name, err)
+		return
+	}
+	warm := make(map[string][]api.Volume)
+	for _, v := range vols {
+		if name, ok := v.Locator.VolumeLabels[api.WarmPoolLabel]; ok {
+			warm[name] = append(warm[name], v)
+		}
+	}
+	ctx := withInternal(context.Background())
+	for name, vols := range warm {
+		var spec *api.VolumeSpec
+		if prof, err := profile.Get(name); err == nil {
+			spec = &prof.Spec
+		} else if err != profile.ErrNotFound {
+			log.Warnf("%s: failed to read profile %s: %v", p.name, name, err)
+			continue
+		}
+		kept := 0
+		for _, v := range vols {
+			if spec != nil && reflect.DeepEqual(v.Spec, spec) && kept < p.sizes[name] {
+				kept++
+				continue
+			}
+			log.Infof("%s: deleting volume %v of the warm pool of profile %s", p.name, v.ID, name)
+			if err = p.remove(ctx, &v, name); err != nil {
+				log.Warnf("%s: failed to delete warm volume %v: %v", p.name, v.ID, err)
+			}
+		}
+		warm[name] = vols[:kept]
+	}
+	for name, size := range p.sizes {
+		for n := len(warm[name]); n < size; n++ {
+			if err = p.create(ctx, name); err != nil {
+				log.Warnf("%s: failed to fill the warm pool of profile %s: %v", p.name, name, err)
+				break
+			}
+		}
+	}
+}
+
+// create adds a volume of the named profile to the warm pool.
+func (p *warmPool) create(ctx context.Context, name string) error {
+	prof, err := profile.Get(name)
+	if err != nil {
+		return err
+	}
+	locator := api.VolumeLocator{VolumeLabels: api.Labels{api.WarmPoolLabel: name}}
+	id, err := CreateCtx(ctx, p.driver, locator, nil, &prof.Spec)
+	if err != nil {
+		return err
+	}
+	if p.driver.Type()&Block != 0 {
+		if err = p.format(ctx, id); err != nil {
+			log.Warnf("%s: failed to format warm volume %v: %v", p.name, id, err)
+			if derr := DeleteCtx(ctx, p.driver, id); derr != nil {
+				log.Warnf("%s: failed to delete warm volume %v: %v", p.name, id, derr)
+			}
+			return err
+		}
+	}
+	log.Infof("%s: created volume %v in the warm pool of profile %s", p.name, id, name)
+	return nil
+}
+
+// format formats the filesystem of volumeID while it is attached on this
+// node, it is detached afterwards.
+func (p *warmPool) format(ctx context.Context, volumeID api.VolumeID) (err error) {
+	if _, err = AttachCtx(ctx, p.driver, volumeID, nil); err != nil {
+		return err
+	}
+	defer func() {
+		if derr := DetachCtx(ctx, p.driver, volumeID); derr != nil && err == nil {
+			err = derr
+		}
+	}()
+	if err = FormatCtx(ctx, p.driver, volumeID); err == ErrNotSupported {
+		err = nil
+	}
+	return err
+}
+
+// remove deletes v from the warm pool of prof. It is taken from the pool
+// first, so that it is not deleted once claimed on any node.
+func (p *warmPool) remove(ctx context.Context, v *api.Volume, prof string) error {
+	locator := v.Locator
+	locator.VolumeLabels = make(api.Labels, len(v.Locator.VolumeLabels))
+	for k, l := range v.Locator.VolumeLabels {
+		if k != api.WarmPoolLabel {
+			locator.VolumeLabels[k] = l
+		}
+	}
+	ok, err := p.take(v.ID, prof, locator)
+	if err != nil || !ok {
+		return err
+	}
+	return DeleteCtx(ctx, p.driver, v.ID)
+}
+
+// claim returns a warm volume matching a create from a profile, renamed
+// and labeled after locator. It returns false if options do not name a
+// profile of the pool or no warm volume of the profile has spec.
+func (p *warmPool) claim(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, bool) {
+	if options == nil || options.CreateFromSnap != "" || p.sizes[options.Profile] == 0 {
+		return api.BadVolumeID, false
+	}
+	vols, err := p.driver.Enumerate(api.VolumeLocator{
+		VolumeLabels: api.Labels{api.WarmPoolLabel: options.Profile},
+	}, nil)
+	if err != nil {
+		log.Warnf("%s: failed to list the warm pool: %v", p.name, err)
+		return api.BadVolumeID, false
+	}
+	for _, v := range vols {
+		if !reflect.DeepEqual(v.Spec, spec) {
+			continue
+		}
+		ok, err := p.take(v.ID, options.Profile, locator)
+		if err != nil {
+			log.Warnf("%s: failed to claim warm volume %v: %v", p.name, v.ID, err)
+			return api.BadVolumeID, false
+		}
+		if ok {
+			log.Infof("%s: claimed volume %v of the warm pool of profile %s", p.name, v.ID, options.Profile)
+			select {
+			case p.fill <- struct{}{}:
+			default:
+			}
+			return v.ID, true
+		}
+	}
+	return api.BadVolumeID, false
+}
+
+// take gives volumeID locator if it is still in the warm pool of prof,
+// so that concurrent claims of a volume, on any node, take it once.
+func (p *warmPool) take(volumeID api.VolumeID, prof string, locator api.VolumeLocator) (bool, error) {
+	store := p.driver.(Store)
+	token, err := store.Lock(volumeID)
+	if err != nil {
+		return false, err
+	}
+	defer store.Unlock(token)
+	v, err := store.GetVol(volumeID)
+	if err != nil || v.Locator.VolumeLabels[api.WarmPoolLabel] != prof {
+		// Claimed or deleted since it was listed.
+		return false, nil
+	}
+	v.Locator = locator
+	v.Ctime = time.Now()
+	return true, store.UpdateVol(v)
+}
+
+// claimWarm returns a volume of the warm pool of the named driver instance
+// matching a create, see warmPool.claim.
+func claimWarm(name string,
+	locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, bool) {
+	mutex.Lock()
+	p, ok := warmPools[name]
+	mutex.Unlock()
+	if !ok {
+		return api.BadVolumeID, false
+	}
+	return p.claim(locator, options, spec)
+}
@@ -0,0 +1,102 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/portworx/kvdb"
+	"github.com/portworx/kvdb/mem"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/profile"
+)
+
+type warmDriver struct {
+	ProtoDriver
+	*DefaultEnumerator
+	NotSupportedBlockDriver
+	created int
+}
+
+func (d *warmDriver) String() string   { return "warm_test" }
+func (d *warmDriver) Type() DriverType { return File }
+
+func (d *warmDriver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+	d.created++
+	v := &api.Volume{
+		ID:      api.VolumeID(fmt.Sprintf("warm_test_%d", d.created)),
+		Locator: locator,
+		Spec:    spec,
+	}
+	return v.ID, d.CreateVol(v)
+}
+
+func (d *warmDriver) Delete(volumeID api.VolumeID) error {
+	return d.DeleteVol(volumeID)
+}
+
+func TestWarmPool(t *testing.T) {
+	kv, err := kvdb.New(mem.Name, "warm_test", nil, nil)
+	assert.NoError(t, err)
+	profile.SetStore(kv)
+	defer profile.SetStore(nil)
+	prof := &api.VolumeProfile{Name: "warm", Spec: api.VolumeSpec{Size: 1 << 30}}
+	assert.NoError(t, profile.Put(prof))
+
+	for _, v := range []string{"warm", "warm=-1", "warm=x"} {
+		_, err = parseWarmPool(v)
+		assert.Error(t, err, "Invalid pool %q accepted", v)
+	}
+	d := &warmDriver{DefaultEnumerator: NewDefaultEnumerator("warm_test", kv)}
+	p, err := newWarmPool("warm_test", d, nil, DriverParams{WarmPoolParam: "warm=2"})
+	assert.NoError(t, err)
+	warm := func() []api.Volume {
+		vols, err := d.Enumerate(api.VolumeLocator{VolumeLabels: api.Labels{api.WarmPoolLabel: "warm"}}, nil)
+		assert.NoError(t, err)
+		return vols
+	}
+
+	p.refill()
+	assert.Len(t, warm(), 2)
+
+	options := &api.CreateOptions{Profile: "warm"}
+	locator := api.VolumeLocator{Name: "warm_app", VolumeLabels: api.Labels{"app": "web"}}
+	_, ok := p.claim(locator, options, &api.VolumeSpec{Size: 2 << 30})
+	assert.False(t, ok, "Volume of another spec claimed")
+	_, ok = p.claim(locator, nil, &prof.Spec)
+	assert.False(t, ok, "Volume claimed without a profile")
+	id, ok := p.claim(locator, options, &prof.Spec)
+	assert.True(t, ok, "Warm volume not claimed")
+	v, err := d.GetVol(id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, locator, v.Locator, "Claimed volume should take the locator of the request")
+	}
+	assert.Len(t, warm(), 1)
+
+	p.refill()
+	assert.Len(t, warm(), 2, "Pool should be refilled")
+	assert.Equal(t, 3, d.created)
+
+	prof.Spec.Size = 2 << 30
+	assert.NoError(t, profile.Put(prof))
+	p.refill()
+	vols := warm()
+	if assert.Len(t, vols, 2) {
+		assert.Equal(t, &prof.Spec, vols[0].Spec, "Volumes of the old spec should be replaced")
+	}
+	_, err = d.GetVol(id)
+	assert.NoError(t, err, "Claimed volume should be kept")
+
+	// A volume claimed after the refill listed it is not deleted.
+	listed := vols[0]
+	ok, err = p.take(listed.ID, "warm", api.VolumeLocator{Name: "warm_app2"})
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.NoError(t, p.remove(context.Background(), &listed, "warm"))
+	_, err = d.GetVol(listed.ID)
+	assert.NoError(t, err, "Volume claimed during a refill deleted")
+}